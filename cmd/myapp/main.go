@@ -5,10 +5,23 @@ import (
 	"BuildasTechnicalAssessmentGo/internal/database"
 	"BuildasTechnicalAssessmentGo/internal/repository"
 	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
 	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // The main is the entry point of the program.
@@ -16,11 +29,11 @@ import (
 // It performs the following steps:
 // 1. Loads environment variables.
 // 2. Initializes the database and runs migrations.
-// 3. Create a new Gin router.
+// 3. Create a new Gin router and set up the services.
 // 4. Loads HTML templates.
 // 5. Serves static files for assets (CSS, JS, etc.).
 // 6. Register routes.
-// 7. Start the server.
+// 7. Start the server, over TLS and with client certificates if configured.
 func main() {
 	// Load environment variables
 	cfg := config.LoadConfig()
@@ -31,9 +44,137 @@ func main() {
 	// Create a new Gin router
 	r := gin.New()
 
+	// Only believe the client IP forwarded by the configured proxies, so the
+	// per-IP rate limits and the recorded IPs cannot be spoofed
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid value for TRUSTED_PROXIES: %v", err)
+	}
+
 	// Set up the repository and service layer
 	userRepo := repository.PostgresUserRepository{DB: database.DB}
-	userService := services.UserService{Repo: &userRepo}
+	passwordPolicy := services.PasswordPolicy{
+		MinLength:    cfg.PasswordMinLength,
+		MinStrength:  cfg.PasswordMinStrength,
+		ContextWords: cfg.PasswordContextWords,
+	}
+	if cfg.PasswordBreachFile != "" {
+		passwordPolicy.Breaches = &repository.FileBreachedPasswordRepository{Path: cfg.PasswordBreachFile}
+	}
+	previousPeppers, err := services.ParsePreviousPeppers(cfg.PasswordPreviousPeppers)
+	if err != nil {
+		log.Fatalf("Invalid value for PASSWORD_PREVIOUS_PEPPERS: %v", err)
+	}
+	passwordHasher := services.PHCPasswordHasher{
+		Algorithm:         cfg.PasswordHashAlgorithm,
+		BcryptCost:        cfg.BcryptCost,
+		Argon2Memory:      uint32(cfg.Argon2Memory),
+		Argon2Iterations:  uint32(cfg.Argon2Iterations),
+		Argon2Parallelism: uint8(cfg.Argon2Parallelism),
+		Pepper:            []byte(cfg.PasswordPepper),
+		PepperID:          cfg.PasswordPepperID,
+		PreviousPeppers:   previousPeppers,
+	}
+	usernamePolicy := services.UsernamePolicy{
+		MinLength:     cfg.UsernameMinLength,
+		MaxLength:     cfg.UsernameMaxLength,
+		ReservedNames: append(services.DefaultReservedUsernames, cfg.UsernameReservedNames...),
+	}
+	userService := services.UserService{
+		Repo:           &userRepo,
+		Policy:         &passwordPolicy,
+		Hasher:         &passwordHasher,
+		UsernamePolicy: &usernamePolicy,
+	}
+
+	// Set up the rate limiter with the configured backend
+	rateLimitPolicies, err := services.ParseRateLimitPolicies(cfg.RateLimitPolicies)
+	if err != nil {
+		panic(err)
+	}
+	var rateLimitRepo repository.RateLimitRepository = repository.NewMemoryRateLimitRepository()
+	if cfg.RateLimitBackend == "redis" {
+		rateLimitRepo = repository.NewRedisRateLimitRepository(redis.NewClient(&redis.Options{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+		}))
+	}
+	rateLimitService := services.NewRateLimitService(rateLimitRepo, rateLimitPolicies)
+
+	// Set up the audit log and give the configured users the admin role
+	auditRepo := repository.PostgresAuditRepository{DB: database.DB}
+	auditService := services.NewAuditService(&auditRepo)
+	promoteAdmins(&userService, auditService, cfg.AdminUsernames)
+	grantPermission(&userService, auditService, cfg.ImpersonatorUsernames, models.PermissionImpersonate)
+
+	// Set up personal access tokens for scripts
+	accessTokenRepo := repository.PostgresAccessTokenRepository{DB: database.DB}
+	accessTokenService := services.NewAccessTokenService(&accessTokenRepo, time.Duration(cfg.AccessTokenMaxLifetimeDays)*24*time.Hour)
+
+	// Set up the OpenID Connect provider
+	oauthRepo := repository.PostgresOAuthRepository{DB: database.DB}
+	signingKey := loadSigningKey(cfg.OIDCSigningKeyFile)
+	oidcService := services.NewOIDCService(&oauthRepo, &userService, cfg.OIDCIssuer, signingKey)
+	oidcService.Limiter = rateLimitRepo
+	oidcService.UserCodeLimit.Limit = cfg.OIDCDeviceCodeLimit
+
+	// Sign the session tokens
+	tokenService := newTokenService(cfg, signingKey)
+
+	// Set up the logins with external OpenID Connect providers
+	identityRepo := repository.PostgresIdentityRepository{DB: database.DB}
+	externalLoginService := services.NewExternalLoginService(&identityRepo, &userService, cfg.OIDCIssuer,
+		deriveKey(signingKey, "external-login-state"), externalProviders(cfg.OIDCProviders))
+
+	// Set up the organizations requests act in
+	organizationRepo := repository.PostgresOrganizationRepository{DB: database.DB}
+	organizationService := services.NewOrganizationService(&organizationRepo, &userRepo, cfg.DefaultOrganization)
+
+	// Set up the SCIM provisioning of users and groups
+	groupRepo := repository.PostgresGroupRepository{DB: database.DB}
+	scimService := services.NewSCIMService(&userService, &userRepo, &organizationRepo, &groupRepo, cfg.OIDCIssuer)
+
+	// Set up the invitations admins send instead of choosing passwords
+	mailer := newMailer(cfg)
+	invitationRepo := repository.PostgresInvitationRepository{DB: database.DB}
+	invitationService := services.NewInvitationService(&invitationRepo, &userService, &userRepo, &organizationRepo,
+		mailer, cfg.OIDCIssuer, time.Duration(cfg.InvitationTTLHours)*time.Hour)
+
+	// Set up the account statuses checked on every request
+	userLifecycleService := services.NewUserLifecycleService(&userRepo)
+	sessionRepo := repository.PostgresSessionRepository{DB: database.DB}
+	sessionService := services.NewSessionService(&sessionRepo)
+	accountService := services.NewAccountService(&userService, &userRepo)
+
+	// Set up the impersonation of users by the allowed admins
+	impersonationService := services.NewImpersonationService(&userRepo)
+
+	// Set up the login history and the alerts of suspicious logins
+	loginAttemptRepo := repository.PostgresLoginAttemptRepository{DB: database.DB}
+	loginHistoryService := services.NewLoginHistoryService(&loginAttemptRepo, geoLocator(cfg.GeoIPDatabaseFile),
+		&services.MailLoginNotifier{Mailer: mailer})
+
+	// Set up the registration policy and the approval queue
+	registrationService := services.NewRegistrationService(&userService, &userRepo, mailer, registrationPolicy(cfg),
+		cfg.OIDCIssuer, deriveKey(signingKey, "email-verification"))
+
+	// Set up the login links emailed to users instead of passwords
+	magicLinkRepo := repository.PostgresMagicLinkRepository{DB: database.DB}
+	magicLinkService := services.NewMagicLinkService(&magicLinkRepo, &userRepo, mailer, rateLimitRepo, cfg.MagicLinkAddressLimit,
+		deriveKey(signingKey, "magic-link"), cfg.OIDCIssuer, time.Duration(cfg.MagicLinkTTLMinutes)*time.Minute)
+
+	// Set up the passkeys logging in without a password or after it
+	webAuthnRepo := repository.PostgresWebAuthnRepository{DB: database.DB}
+	rpID, origins := webAuthnRelyingParty(cfg)
+	webAuthnService := services.NewWebAuthnService(&webAuthnRepo, &userRepo, rpID, cfg.WebAuthnRPName, origins)
+
+	// Set up the backends checking the passwords of logins, such as a
+	// directory
+	authenticator := loginAuthenticator(cfg, &userService, &userRepo, &identityRepo)
+
+	// Set up the service accounts internal services authenticate as with
+	// client certificates
+	tlsConfig := serverTLSConfig(cfg)
+	clientCertificateService := newClientCertificateService(cfg, &userRepo)
 
 	// Get the absolute base path of the project
 	basePath, err := os.Getwd()
@@ -51,11 +192,381 @@ func main() {
 	// Serve static files for assets (CSS, JS, etc.)
 	r.Static("/assets", assetsPath)
 
-	// Register routes
-	handlers.RegisterRoutes(r, &userService)
+	// Tag every request with an ID and make the audit log available
+	r.Use(middlewares.RequestIDMiddleware(), middlewares.AuditMiddleware(auditService))
 
-	// Start the server
-	if err := r.Run(":8080"); err != nil {
+	// Let AuthMiddleware verify the session tokens, and the handlers issue
+	// them
+	r.Use(middlewares.TokenMiddleware(tokenService))
+
+	// Let AuthMiddleware accept personal access tokens
+	r.Use(middlewares.AccessTokenMiddleware(accessTokenService))
+
+	// Let AuthMiddleware accept the client certificates of service accounts
+	if clientCertificateService != nil {
+		r.Use(middlewares.ClientCertificateMiddleware(clientCertificateService))
+	}
+
+	// Let AuthMiddleware end the sessions of blocked accounts
+	r.Use(middlewares.UserLifecycleMiddleware(userLifecycleService))
+
+	// Record the sessions of users and let AuthMiddleware end revoked ones
+	r.Use(middlewares.SessionMiddleware(sessionService))
+
+	// Let the login form record the login history
+	r.Use(middlewares.LoginHistoryMiddleware(loginHistoryService))
+
+	// Let the login form check passwords with the configured backends
+	if authenticator != nil {
+		r.Use(middlewares.AuthenticatorMiddleware(authenticator))
+	}
+
+	// Let the login form and the account page use passkeys
+	if cfg.WebAuthnEnabled {
+		r.Use(middlewares.WebAuthnMiddleware(webAuthnService))
+	}
+
+	// Show a banner on every page while impersonating a user, and let the
+	// home page offer impersonation
+	r.Use(middlewares.ImpersonationBannerMiddleware(), middlewares.ImpersonationMiddleware(impersonationService))
+
+	// Let AuthMiddleware resolve the organization of each request
+	r.Use(middlewares.OrganizationMiddleware(organizationService))
+
+	// Let the registration handlers apply the registration policy
+	r.Use(middlewares.RegistrationMiddleware(registrationService))
+
+	// Register routes, validating requests with the configured policies
+	handlers.SetValidationPolicies(&usernamePolicy, &passwordPolicy)
+	handlers.RegisterRoutes(r, &userService, rateLimitService)
+	handlers.RegisterAuditRoutes(r, auditService)
+	handlers.RegisterAccessTokenRoutes(r, accessTokenService)
+	handlers.RegisterOIDCRoutes(r, oidcService)
+	handlers.RegisterExternalLoginRoutes(r, externalLoginService)
+	handlers.RegisterSCIMRoutes(r, scimService)
+	handlers.RegisterOrganizationRoutes(r, organizationService)
+	handlers.RegisterInvitationRoutes(r, invitationService)
+	handlers.RegisterRegistrationRoutes(r, registrationService)
+	handlers.RegisterUserLifecycleRoutes(r, userLifecycleService)
+	handlers.RegisterAccountRoutes(r, accountService)
+	handlers.RegisterSessionRoutes(r, sessionService)
+	handlers.RegisterLoginHistoryRoutes(r, loginHistoryService)
+	handlers.RegisterImpersonationRoutes(r, impersonationService)
+	if cfg.MagicLinkEnabled {
+		handlers.RegisterMagicLinkRoutes(r, magicLinkService, rateLimitService)
+	}
+	if cfg.WebAuthnEnabled {
+		handlers.RegisterWebAuthnRoutes(r, webAuthnService, rateLimitService)
+	}
+
+	// Start the server, over TLS when configured
+	server := &http.Server{Addr: ":8080", Handler: r, TLSConfig: tlsConfig}
+	if cfg.TLSCertFile != "" {
+		err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil {
 		panic(err)
 	}
 }
+
+// promoteAdmins gives the admin role to the users listed in ADMIN_USERNAMES.
+//
+// Each promotion is recorded in the audit log with "system" as the actor.
+// Users that do not exist yet are skipped, and promoted on the next start.
+func promoteAdmins(userService *services.UserService, auditService services.AuditServiceInterface, usernames []string) {
+	for _, username := range usernames {
+		user, previous, err := userService.SetRole(username, models.RoleAdmin)
+		if err != nil {
+			log.Printf("Could not make %s an admin: %v", username, err)
+			continue
+		}
+		if previous == models.RoleAdmin {
+			continue
+		}
+
+		err = auditService.Record(models.AuditEvent{
+			Action:         models.AuditRoleChange,
+			Outcome:        models.AuditSuccess,
+			ActorUsername:  "system",
+			TargetID:       &user.ID,
+			TargetUsername: user.Username,
+			Changes: services.AuditChanges(
+				map[string]interface{}{"role": previous},
+				map[string]interface{}{"role": models.RoleAdmin},
+			),
+		})
+		if err != nil {
+			log.Printf("Failed to record audit event %s: %v", models.AuditRoleChange, err)
+		}
+	}
+}
+
+// grantPermission grants a permission to the users listed in the
+// configuration, such as IMPERSONATOR_USERNAMES.
+//
+// Each grant is recorded in the audit log with "system" as the actor. Users
+// that do not exist yet are skipped, and granted it on the next start.
+func grantPermission(userService *services.UserService, auditService services.AuditServiceInterface, usernames []string, permission string) {
+	for _, username := range usernames {
+		user, granted, err := userService.GrantPermission(username, permission)
+		if err != nil {
+			log.Printf("Could not grant %s the %s permission: %v", username, permission, err)
+			continue
+		}
+		if !granted {
+			continue
+		}
+
+		err = auditService.Record(models.AuditEvent{
+			Action:         models.AuditPermissionAdd,
+			Outcome:        models.AuditSuccess,
+			ActorUsername:  "system",
+			TargetID:       &user.ID,
+			TargetUsername: user.Username,
+			Changes:        services.AuditChanges(nil, map[string]interface{}{"permission": permission}),
+		})
+		if err != nil {
+			log.Printf("Failed to record audit event %s: %v", models.AuditPermissionAdd, err)
+		}
+	}
+}
+
+// loadSigningKey loads the RSA key signing the OpenID Connect tokens.
+//
+// Without a key file, a key is generated for this run only: tokens issued
+// before a restart stop verifying, and instances do not share it.
+func loadSigningKey(path string) *rsa.PrivateKey {
+	if path != "" {
+		key, err := utils.LoadRSAPrivateKey(path)
+		if err != nil {
+			log.Fatalf("Failed to load the OIDC signing key: %v", err)
+		}
+		return key
+	}
+
+	log.Println("OIDC_SIGNING_KEY_FILE is not set, generating a temporary signing key")
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("Failed to generate the OIDC signing key: %v", err)
+	}
+	return key
+}
+
+// deriveKey derives a secret for another purpose from the signing key, so
+// instances sharing the key file share it too
+func deriveKey(signingKey *rsa.PrivateKey, purpose string) []byte {
+	sum := sha256.Sum256(append([]byte(purpose+":"), x509.MarshalPKCS1PrivateKey(signingKey)...))
+	return sum[:]
+}
+
+// newTokenService returns the service of the session tokens, issued in the
+// configured format and verified in the accepted ones. Without a configured
+// secret, the key is derived from the signing key.
+func newTokenService(cfg config.Config, signingKey *rsa.PrivateKey) services.TokenService {
+	key := []byte(cfg.TokenSecret)
+	if len(key) == 0 {
+		key = deriveKey(signingKey, "session-token")
+	}
+	secrets := [][]byte{key}
+	for _, secret := range cfg.TokenPreviousSecrets {
+		secrets = append(secrets, []byte(secret))
+	}
+	format, err := services.NewTokenFormat(cfg.TokenFormat, secrets...)
+	if err != nil {
+		log.Fatalf("Invalid TOKEN_FORMAT: %v", err)
+	}
+	acceptedNames := cfg.TokenAcceptedFormats
+	if len(acceptedNames) == 0 {
+		acceptedNames = []string{services.TokenFormatJWT, services.TokenFormatPASETOLocal, services.TokenFormatPASETOPublic}
+	}
+	var accepted []services.TokenFormat
+	for _, name := range acceptedNames {
+		if name == cfg.TokenFormat {
+			continue
+		}
+		acceptedFormat, err := services.NewTokenFormat(name, secrets...)
+		if err != nil {
+			log.Fatalf("Invalid TOKEN_ACCEPTED_FORMATS: %v", err)
+		}
+		accepted = append(accepted, acceptedFormat)
+	}
+
+	issuer := cfg.TokenIssuer
+	if issuer == "" {
+		issuer = cfg.OIDCIssuer
+	}
+	tokenService := services.NewSessionTokenService(format, issuer, cfg.TokenAudience, accepted...)
+	tokenService.ClockSkew = time.Duration(cfg.TokenClockSkewSeconds) * time.Second
+	return tokenService
+}
+
+// externalProviders converts the configured external OpenID Connect
+// providers for the ExternalLoginService
+func externalProviders(configs []config.OIDCProviderConfig) []services.ExternalProvider {
+	providers := make([]services.ExternalProvider, len(configs))
+	for i, provider := range configs {
+		providers[i] = services.ExternalProvider{
+			ID:             provider.ID,
+			Name:           provider.Name,
+			Issuer:         provider.Issuer,
+			ClientID:       provider.ClientID,
+			ClientSecret:   provider.ClientSecret,
+			Scopes:         provider.Scopes,
+			Provisioning:   provider.Provisioning,
+			AllowedDomains: provider.AllowedDomains,
+			DefaultRole:    provider.DefaultRole,
+			UsernameClaim:  provider.UsernameClaim,
+		}
+	}
+	return providers
+}
+
+// newMailer returns the mailer of the configured MAIL_BACKEND
+func newMailer(cfg config.Config) services.Mailer {
+	switch cfg.MailBackend {
+	case "smtp":
+		return &services.SMTPMailer{Addr: cfg.SMTPAddr, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword, From: cfg.MailFrom}
+	case "log":
+		return services.LogMailer{}
+	default:
+		log.Fatalf("Invalid value for MAIL_BACKEND: %s", cfg.MailBackend)
+		return nil
+	}
+}
+
+// geoLocator returns the locator of the IP of logins with the database of
+// GEOIP_DATABASE_FILE, or nil to leave logins unlocated without one
+func geoLocator(path string) services.GeoLocator {
+	if path == "" {
+		return nil
+	}
+	reader, err := utils.OpenMMDB(path)
+	if err != nil {
+		log.Fatalf("Failed to load the GeoIP database: %v", err)
+	}
+	return &services.MMDBGeoLocator{Reader: reader}
+}
+
+// loginAuthenticator returns the chain of the login backends listed in
+// AUTH_BACKENDS, or nil to check the local passwords only
+func loginAuthenticator(cfg config.Config, userService services.UserServiceInterface, userRepo repository.UserRepository, identityRepo repository.IdentityRepository) services.Authenticator {
+	var chain services.AuthenticatorChain
+	for _, backend := range cfg.AuthBackends {
+		switch backend {
+		case "local":
+			chain = append(chain, &services.LocalAuthenticator{Users: userService})
+		case "ldap":
+			if cfg.LDAPURL == "" || cfg.LDAPBaseDN == "" {
+				log.Fatal("LDAP_URL and LDAP_BASE_DN are required by the ldap login backend")
+			}
+			groupRoles, err := services.ParseLDAPGroupRoles(cfg.LDAPGroupRoles)
+			if err != nil {
+				log.Fatalf("Invalid value for LDAP_GROUP_ROLES: %v", err)
+			}
+			ldap := services.NewLDAPAuthenticator(userService, userRepo, identityRepo, cfg.LDAPURL, cfg.LDAPBaseDN)
+			ldap.BindDN, ldap.BindPassword = cfg.LDAPBindDN, cfg.LDAPBindPassword
+			ldap.UserFilter = cfg.LDAPUserFilter
+			ldap.UsernameAttribute, ldap.GroupAttribute = cfg.LDAPUsernameAttribute, cfg.LDAPGroupAttribute
+			ldap.GroupRoles, ldap.DefaultRole = groupRoles, cfg.LDAPDefaultRole
+			ldap.Timeout = time.Duration(cfg.LDAPTimeoutSeconds) * time.Second
+			chain = append(chain, ldap)
+		default:
+			log.Fatalf("Invalid value for AUTH_BACKENDS: %s", backend)
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	return chain
+}
+
+// webAuthnRelyingParty returns the ID of the relying party passkeys are
+// scoped to and the origins allowed to use them: WEBAUTHN_RP_ID and
+// WEBAUTHN_ORIGINS, or the host and origin of OIDC_ISSUER
+func webAuthnRelyingParty(cfg config.Config) (string, []string) {
+	issuer, err := url.Parse(cfg.OIDCIssuer)
+	if err != nil || issuer.Host == "" {
+		log.Fatalf("Invalid value for OIDC_ISSUER: %s", cfg.OIDCIssuer)
+	}
+	rpID, origins := cfg.WebAuthnRPID, cfg.WebAuthnOrigins
+	if rpID == "" {
+		rpID = issuer.Hostname()
+	}
+	if len(origins) == 0 {
+		origins = []string{issuer.Scheme + "://" + issuer.Host}
+	}
+	return rpID, origins
+}
+
+// registrationPolicy returns the registration policy of the configured
+// REGISTRATION_MODE and REGISTRATION_ALLOWED_DOMAINS
+func registrationPolicy(cfg config.Config) services.RegistrationPolicy {
+	policy := services.RegistrationPolicy{Mode: cfg.RegistrationMode, AllowedDomains: cfg.RegistrationAllowedDomains}
+	valid := false
+	for _, mode := range services.RegistrationModes {
+		valid = valid || mode == policy.Mode
+	}
+	if !valid {
+		log.Fatalf("Invalid value for REGISTRATION_MODE: %s", cfg.RegistrationMode)
+	}
+	if policy.Mode == services.RegistrationDomainAllowlist && len(policy.AllowedDomains) == 0 {
+		log.Fatal("REGISTRATION_ALLOWED_DOMAINS is required in the domain_allowlist registration mode")
+	}
+	return policy
+}
+
+// serverTLSConfig returns the TLS configuration of the server for the
+// configured MTLS_CLIENT_AUTH: client certificates are verified against the
+// CAs of MTLS_CA_FILE, and optional or required. It returns nil when client
+// certificates are off.
+func serverTLSConfig(cfg config.Config) *tls.Config {
+	var clientAuth tls.ClientAuthType
+	switch cfg.MTLSClientAuth {
+	case "off":
+		return nil
+	case "accept":
+		clientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		log.Fatalf("Invalid value for MTLS_CLIENT_AUTH: %s", cfg.MTLSClientAuth)
+	}
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" || cfg.MTLSCAFile == "" {
+		log.Fatal("TLS_CERT_FILE, TLS_KEY_FILE and MTLS_CA_FILE are required to accept client certificates")
+	}
+
+	bundle, err := os.ReadFile(cfg.MTLSCAFile)
+	if err != nil {
+		log.Fatalf("Failed to load the client certificate CAs: %v", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(bundle) {
+		log.Fatalf("No certificates found in MTLS_CA_FILE: %s", cfg.MTLSCAFile)
+	}
+	return &tls.Config{ClientCAs: clientCAs, ClientAuth: clientAuth, MinVersion: tls.VersionTLS12}
+}
+
+// newClientCertificateService returns the service mapping client
+// certificates to the service accounts of MTLS_SERVICE_ACCOUNTS, or nil when
+// client certificates are off
+func newClientCertificateService(cfg config.Config, userRepo repository.UserRepository) services.ClientCertificateServiceInterface {
+	if cfg.MTLSClientAuth == "off" {
+		return nil
+	}
+	accounts := make([]services.ServiceAccount, len(cfg.ServiceAccounts))
+	for i, account := range cfg.ServiceAccounts {
+		accounts[i] = services.ServiceAccount{
+			ID:       account.ID,
+			Username: account.Username,
+			Subjects: account.Subjects,
+			Scopes:   account.Scopes,
+		}
+	}
+	clientCertificateService, err := services.NewClientCertificateService(userRepo, accounts)
+	if err != nil {
+		log.Fatalf("Invalid value for MTLS_SERVICE_ACCOUNTS: %v", err)
+	}
+	return clientCertificateService
+}
@@ -7,4 +7,140 @@ type Config struct {
 	PostgresDB       string
 	PostgresHost     string
 	PostgresPort     string
+
+	// Rate limiting settings
+	RateLimitBackend  string
+	RateLimitPolicies string
+	RedisAddr         string
+	RedisPassword     string
+	// TrustedProxies are the addresses whose X-Forwarded-For header is
+	// believed, none if empty
+	TrustedProxies []string
+
+	// Password policy settings
+	PasswordMinLength    int
+	PasswordMinStrength  int
+	PasswordContextWords []string
+	PasswordBreachFile   string
+
+	// Username policy settings
+	UsernameMinLength     int
+	UsernameMaxLength     int
+	UsernameReservedNames []string
+
+	// Password hashing settings
+	PasswordHashAlgorithm   string
+	BcryptCost              int
+	Argon2Memory            int
+	Argon2Iterations        int
+	Argon2Parallelism       int
+	PasswordPepper          string
+	PasswordPepperID        string
+	PasswordPreviousPeppers string
+
+	// Audit settings
+	AdminUsernames []string
+	// ImpersonatorUsernames are the admins allowed to impersonate users
+	ImpersonatorUsernames []string
+
+	// Session token settings
+	TokenSecret           string
+	TokenIssuer           string
+	TokenAudience         string
+	TokenClockSkewSeconds int
+	// TokenFormat is the format the session tokens are issued in
+	TokenFormat string
+	// TokenPreviousSecrets still verify the tokens issued before rotating
+	// TokenSecret, newest first
+	TokenPreviousSecrets []string
+	// TokenAcceptedFormats are the formats verified besides TokenFormat,
+	// all of them if empty
+	TokenAcceptedFormats []string
+
+	// Personal access token settings
+	AccessTokenMaxLifetimeDays int
+
+	// OpenID Connect provider settings
+	OIDCIssuer         string
+	OIDCSigningKeyFile string
+	// OIDCDeviceCodeLimit is the number of device user codes a user may
+	// enter an hour
+	OIDCDeviceCodeLimit int
+
+	// External OpenID Connect providers users can log in with
+	OIDCProviders []OIDCProviderConfig
+
+	// Organization settings
+	DefaultOrganization string
+
+	// Email and invitation settings
+	MailBackend        string
+	SMTPAddr           string
+	SMTPUsername       string
+	SMTPPassword       string
+	MailFrom           string
+	InvitationTTLHours int
+
+	// Registration settings
+	RegistrationMode           string
+	RegistrationAllowedDomains []string
+
+	// Login history settings
+	GeoIPDatabaseFile string
+
+	// Magic link login settings
+	MagicLinkEnabled      bool
+	MagicLinkTTLMinutes   int
+	MagicLinkAddressLimit int
+
+	// Passkey settings
+	WebAuthnEnabled bool
+	WebAuthnRPID    string
+	WebAuthnRPName  string
+	WebAuthnOrigins []string
+
+	// Login backend settings
+	AuthBackends          []string
+	LDAPURL               string
+	LDAPBindDN            string
+	LDAPBindPassword      string
+	LDAPBaseDN            string
+	LDAPUserFilter        string
+	LDAPUsernameAttribute string
+	LDAPGroupAttribute    string
+	LDAPGroupRoles        string
+	LDAPDefaultRole       string
+	LDAPTimeoutSeconds    int
+
+	// TLS and client certificate settings
+	TLSCertFile     string
+	TLSKeyFile      string
+	MTLSClientAuth  string
+	MTLSCAFile      string
+	ServiceAccounts []ServiceAccountConfig
+}
+
+// OIDCProviderConfig holds the settings of an external OpenID Connect
+// provider, read from the OIDC_PROVIDER_<ID>_* variables
+type OIDCProviderConfig struct {
+	ID             string
+	Name           string
+	Issuer         string
+	ClientID       string
+	ClientSecret   string
+	Scopes         []string
+	Provisioning   string
+	AllowedDomains []string
+	DefaultRole    string
+	UsernameClaim  string
+}
+
+// ServiceAccountConfig holds the settings of a service account internal
+// services authenticate as with a client certificate, read from the
+// MTLS_SERVICE_ACCOUNT_<ID>_* variables
+type ServiceAccountConfig struct {
+	ID       string
+	Username string
+	Subjects []string
+	Scopes   []string
 }
@@ -4,6 +4,8 @@ import (
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 )
 
 // LoadConfig loads environment variables from a .env file and returns a
@@ -20,6 +22,85 @@ import (
 // - POSTGRES_DB
 // - POSTGRES_HOST
 // - POSTGRES_PORT
+// - RATE_LIMIT_BACKEND (memory or redis, defaults to memory)
+// - RATE_LIMIT_POLICIES
+// - REDIS_ADDR
+// - REDIS_PASSWORD
+// - TRUSTED_PROXIES (comma-separated IPs or CIDRs allowed to set X-Forwarded-For, none by default)
+// - PASSWORD_MIN_LENGTH (defaults to 8)
+// - PASSWORD_MIN_STRENGTH (zxcvbn score from 0 to 4, defaults to 2)
+// - PASSWORD_CONTEXT_WORDS (comma-separated)
+// - PASSWORD_BREACH_FILE (sorted Pwned Passwords SHA-1 file, optional)
+// - USERNAME_MIN_LENGTH (defaults to 3)
+// - USERNAME_MAX_LENGTH (defaults to 32)
+// - USERNAME_RESERVED_NAMES (comma-separated, added to the built-in list)
+// - PASSWORD_HASH_ALGORITHM (argon2id or bcrypt, defaults to argon2id)
+// - BCRYPT_COST (defaults to 12)
+// - ARGON2_MEMORY (in KiB, defaults to 65536)
+// - ARGON2_ITERATIONS (defaults to 3)
+// - ARGON2_PARALLELISM (defaults to 2)
+// - PASSWORD_PEPPER (optional)
+// - PASSWORD_PEPPER_ID (defaults to 1)
+// - PASSWORD_PREVIOUS_PEPPERS (semicolon-separated <pepper ID>:<pepper> of retired peppers, optional)
+// - ADMIN_USERNAMES (comma-separated users given the admin role at startup)
+// - IMPERSONATOR_USERNAMES (comma-separated admins allowed to impersonate users)
+// - TOKEN_SECRET (key signing the session tokens, derived from the OIDC signing key if unset)
+// - TOKEN_ISSUER (defaults to OIDC_ISSUER)
+// - TOKEN_AUDIENCE (defaults to buildas-sessions)
+// - TOKEN_CLOCK_SKEW_SECONDS (defaults to 60)
+// - TOKEN_FORMAT (jwt, v4.local or v4.public, defaults to jwt)
+// - TOKEN_PREVIOUS_SECRETS (comma separated, still verifying the tokens issued with them)
+// - TOKEN_ACCEPTED_FORMATS (comma separated formats verified besides TOKEN_FORMAT, defaults to all)
+// - ACCESS_TOKEN_MAX_LIFETIME_DAYS (defaults to 365)
+// - OIDC_ISSUER (public base URL, defaults to http://localhost:8080)
+// - OIDC_SIGNING_KEY_FILE (PEM RSA private key, generated at startup if unset)
+// - OIDC_DEVICE_CODE_LIMIT (device codes a user may enter per hour, defaults to 10)
+// - OIDC_PROVIDERS (comma-separated IDs of external providers)
+// - OIDC_PROVIDER_<ID>_ISSUER
+// - OIDC_PROVIDER_<ID>_CLIENT_ID
+// - OIDC_PROVIDER_<ID>_CLIENT_SECRET
+// - OIDC_PROVIDER_<ID>_NAME (defaults to the ID)
+// - OIDC_PROVIDER_<ID>_SCOPES (comma-separated, defaults to openid,profile,email)
+// - OIDC_PROVIDER_<ID>_PROVISIONING (none, create or link, defaults to create)
+// - OIDC_PROVIDER_<ID>_ALLOWED_DOMAINS (comma-separated email domains, optional)
+// - OIDC_PROVIDER_<ID>_DEFAULT_ROLE (defaults to user)
+// - OIDC_PROVIDER_<ID>_USERNAME_CLAIM (defaults to preferred_username)
+// - DEFAULT_ORGANIZATION (slug joined by users without organization, defaults to default)
+// - MAIL_BACKEND (log or smtp, defaults to log)
+// - SMTP_ADDR (host:port, defaults to localhost:25)
+// - SMTP_USERNAME (optional)
+// - SMTP_PASSWORD (optional)
+// - MAIL_FROM (defaults to no-reply@localhost)
+// - INVITATION_TTL_HOURS (defaults to 72)
+// - REGISTRATION_MODE (open, disabled, invite_only, domain_allowlist or approval, defaults to open)
+// - REGISTRATION_ALLOWED_DOMAINS (comma-separated email domains of the domain_allowlist mode)
+// - GEOIP_DATABASE_FILE (GeoLite2 or GeoIP2 City database locating logins, optional)
+// - MAGIC_LINK_ENABLED (true to offer login links by email, defaults to false)
+// - MAGIC_LINK_TTL_MINUTES (defaults to 15)
+// - MAGIC_LINK_ADDRESS_LIMIT (login links sent to an email address per hour, defaults to 5)
+// - WEBAUTHN_ENABLED (true to offer passkeys, defaults to false)
+// - WEBAUTHN_RP_ID (domain passkeys are scoped to, defaults to the host of OIDC_ISSUER)
+// - WEBAUTHN_RP_NAME (name of the service shown by authenticators, defaults to Buildas)
+// - WEBAUTHN_ORIGINS (comma-separated origins of the pages using passkeys, defaults to the origin of OIDC_ISSUER)
+// - AUTH_BACKENDS (comma-separated login backends tried in order, local or ldap, defaults to local)
+// - LDAP_URL (ldap:// or ldaps:// URL of the directory)
+// - LDAP_BIND_DN (service account searching the users, optional)
+// - LDAP_BIND_PASSWORD (optional)
+// - LDAP_BASE_DN
+// - LDAP_USER_FILTER (with {username}, defaults to (uid={username}))
+// - LDAP_USERNAME_ATTRIBUTE (defaults to uid)
+// - LDAP_GROUP_ATTRIBUTE (defaults to memberOf)
+// - LDAP_GROUP_ROLES (semicolon-separated <role>:<group DN>, first match wins)
+// - LDAP_DEFAULT_ROLE (defaults to user)
+// - LDAP_TIMEOUT_SECONDS (defaults to 5)
+// - TLS_CERT_FILE (PEM certificate chain of the server, serves HTTPS when set with TLS_KEY_FILE)
+// - TLS_KEY_FILE (PEM private key of the server)
+// - MTLS_CLIENT_AUTH (off, accept or require client certificates, defaults to off)
+// - MTLS_CA_FILE (PEM bundle of the CAs client certificates are verified against)
+// - MTLS_SERVICE_ACCOUNTS (comma-separated IDs of the service accounts of client certificates)
+// - MTLS_SERVICE_ACCOUNT_<ID>_USERNAME (user the service account acts as, defaults to the ID)
+// - MTLS_SERVICE_ACCOUNT_<ID>_SUBJECTS (comma-separated CN=, DNS:, URI: or EMAIL: certificate identities)
+// - MTLS_SERVICE_ACCOUNT_<ID>_SCOPES (comma-separated scopes granted to the service account)
 func LoadConfig() Config {
 	err := godotenv.Load(".env")
 	if err != nil {
@@ -28,10 +109,186 @@ func LoadConfig() Config {
 
 	// Populate the Config struct with environment variables
 	return Config{
-		PostgresUser:     os.Getenv("POSTGRES_USER"),
-		PostgresPassword: os.Getenv("POSTGRES_PASSWORD"),
-		PostgresDB:       os.Getenv("POSTGRES_DB"),
-		PostgresHost:     os.Getenv("POSTGRES_HOST"),
-		PostgresPort:     os.Getenv("POSTGRES_PORT"),
+		PostgresUser:      os.Getenv("POSTGRES_USER"),
+		PostgresPassword:  os.Getenv("POSTGRES_PASSWORD"),
+		PostgresDB:        os.Getenv("POSTGRES_DB"),
+		PostgresHost:      os.Getenv("POSTGRES_HOST"),
+		PostgresPort:      os.Getenv("POSTGRES_PORT"),
+		RateLimitBackend:  getEnv("RATE_LIMIT_BACKEND", "memory"),
+		RateLimitPolicies: os.Getenv("RATE_LIMIT_POLICIES"),
+		RedisAddr:         getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisPassword:     os.Getenv("REDIS_PASSWORD"),
+		TrustedProxies:    getEnvList("TRUSTED_PROXIES"),
+
+		PasswordMinLength:    getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMinStrength:  getEnvInt("PASSWORD_MIN_STRENGTH", 2),
+		PasswordContextWords: getEnvList("PASSWORD_CONTEXT_WORDS"),
+		PasswordBreachFile:   os.Getenv("PASSWORD_BREACH_FILE"),
+
+		UsernameMinLength:     getEnvInt("USERNAME_MIN_LENGTH", 3),
+		UsernameMaxLength:     getEnvInt("USERNAME_MAX_LENGTH", 32),
+		UsernameReservedNames: getEnvList("USERNAME_RESERVED_NAMES"),
+
+		PasswordHashAlgorithm:   getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		BcryptCost:              getEnvInt("BCRYPT_COST", 12),
+		Argon2Memory:            getEnvInt("ARGON2_MEMORY", 64*1024),
+		Argon2Iterations:        getEnvInt("ARGON2_ITERATIONS", 3),
+		Argon2Parallelism:       getEnvInt("ARGON2_PARALLELISM", 2),
+		PasswordPepper:          os.Getenv("PASSWORD_PEPPER"),
+		PasswordPepperID:        getEnv("PASSWORD_PEPPER_ID", "1"),
+		PasswordPreviousPeppers: os.Getenv("PASSWORD_PREVIOUS_PEPPERS"),
+
+		AdminUsernames:        getEnvList("ADMIN_USERNAMES"),
+		ImpersonatorUsernames: getEnvList("IMPERSONATOR_USERNAMES"),
+
+		TokenSecret:           os.Getenv("TOKEN_SECRET"),
+		TokenIssuer:           os.Getenv("TOKEN_ISSUER"),
+		TokenAudience:         getEnv("TOKEN_AUDIENCE", "buildas-sessions"),
+		TokenClockSkewSeconds: getEnvInt("TOKEN_CLOCK_SKEW_SECONDS", 60),
+		TokenFormat:           getEnv("TOKEN_FORMAT", "jwt"),
+		TokenPreviousSecrets:  getEnvList("TOKEN_PREVIOUS_SECRETS"),
+		TokenAcceptedFormats:  getEnvList("TOKEN_ACCEPTED_FORMATS"),
+
+		AccessTokenMaxLifetimeDays: getEnvInt("ACCESS_TOKEN_MAX_LIFETIME_DAYS", 365),
+
+		OIDCIssuer:          getEnv("OIDC_ISSUER", "http://localhost:8080"),
+		OIDCSigningKeyFile:  os.Getenv("OIDC_SIGNING_KEY_FILE"),
+		OIDCDeviceCodeLimit: getEnvInt("OIDC_DEVICE_CODE_LIMIT", 10),
+
+		OIDCProviders: getOIDCProviders(),
+
+		DefaultOrganization: getEnv("DEFAULT_ORGANIZATION", "default"),
+
+		MailBackend:        getEnv("MAIL_BACKEND", "log"),
+		SMTPAddr:           getEnv("SMTP_ADDR", "localhost:25"),
+		SMTPUsername:       os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:       os.Getenv("SMTP_PASSWORD"),
+		MailFrom:           getEnv("MAIL_FROM", "no-reply@localhost"),
+		InvitationTTLHours: getEnvInt("INVITATION_TTL_HOURS", 72),
+
+		RegistrationMode:           getEnv("REGISTRATION_MODE", "open"),
+		RegistrationAllowedDomains: getEnvList("REGISTRATION_ALLOWED_DOMAINS"),
+
+		GeoIPDatabaseFile: os.Getenv("GEOIP_DATABASE_FILE"),
+
+		MagicLinkEnabled:      getEnv("MAGIC_LINK_ENABLED", "false") == "true",
+		MagicLinkTTLMinutes:   getEnvInt("MAGIC_LINK_TTL_MINUTES", 15),
+		MagicLinkAddressLimit: getEnvInt("MAGIC_LINK_ADDRESS_LIMIT", 5),
+
+		WebAuthnEnabled: getEnv("WEBAUTHN_ENABLED", "false") == "true",
+		WebAuthnRPID:    os.Getenv("WEBAUTHN_RP_ID"),
+		WebAuthnRPName:  getEnv("WEBAUTHN_RP_NAME", "Buildas"),
+		WebAuthnOrigins: getEnvList("WEBAUTHN_ORIGINS"),
+
+		AuthBackends:          getEnvList("AUTH_BACKENDS"),
+		LDAPURL:               os.Getenv("LDAP_URL"),
+		LDAPBindDN:            os.Getenv("LDAP_BIND_DN"),
+		LDAPBindPassword:      os.Getenv("LDAP_BIND_PASSWORD"),
+		LDAPBaseDN:            os.Getenv("LDAP_BASE_DN"),
+		LDAPUserFilter:        getEnv("LDAP_USER_FILTER", "(uid={username})"),
+		LDAPUsernameAttribute: getEnv("LDAP_USERNAME_ATTRIBUTE", "uid"),
+		LDAPGroupAttribute:    getEnv("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+		LDAPGroupRoles:        os.Getenv("LDAP_GROUP_ROLES"),
+		LDAPDefaultRole:       getEnv("LDAP_DEFAULT_ROLE", "user"),
+		LDAPTimeoutSeconds:    getEnvInt("LDAP_TIMEOUT_SECONDS", 5),
+
+		TLSCertFile:     os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:      os.Getenv("TLS_KEY_FILE"),
+		MTLSClientAuth:  getEnv("MTLS_CLIENT_AUTH", "off"),
+		MTLSCAFile:      os.Getenv("MTLS_CA_FILE"),
+		ServiceAccounts: getServiceAccounts(),
+	}
+}
+
+// getServiceAccounts returns the service accounts listed in
+// MTLS_SERVICE_ACCOUNTS. It logs a fatal error if an account has no
+// subjects.
+func getServiceAccounts() []ServiceAccountConfig {
+	var accounts []ServiceAccountConfig
+	for _, id := range getEnvList("MTLS_SERVICE_ACCOUNTS") {
+		prefix := "MTLS_SERVICE_ACCOUNT_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(id)) + "_"
+		account := ServiceAccountConfig{
+			ID:       id,
+			Username: getEnv(prefix+"USERNAME", id),
+			Subjects: getEnvList(prefix + "SUBJECTS"),
+			Scopes:   getEnvList(prefix + "SCOPES"),
+		}
+		if len(account.Subjects) == 0 {
+			log.Fatalf("%sSUBJECTS is required", prefix)
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+// getOIDCProviders returns the external providers listed in OIDC_PROVIDERS.
+// It logs a fatal error if a provider has no issuer or client ID, or an
+// unknown provisioning rule.
+func getOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, id := range getEnvList("OIDC_PROVIDERS") {
+		prefix := "OIDC_PROVIDER_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(id)) + "_"
+		provider := OIDCProviderConfig{
+			ID:             id,
+			Name:           getEnv(prefix+"NAME", id),
+			Issuer:         os.Getenv(prefix + "ISSUER"),
+			ClientID:       os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret:   os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:         getEnvList(prefix + "SCOPES"),
+			Provisioning:   getEnv(prefix+"PROVISIONING", "create"),
+			AllowedDomains: getEnvList(prefix + "ALLOWED_DOMAINS"),
+			DefaultRole:    getEnv(prefix+"DEFAULT_ROLE", "user"),
+			UsernameClaim:  getEnv(prefix+"USERNAME_CLAIM", "preferred_username"),
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "profile", "email"}
+		}
+
+		if provider.Issuer == "" || provider.ClientID == "" {
+			log.Fatalf("%sISSUER and %sCLIENT_ID are required", prefix, prefix)
+		}
+		switch provider.Provisioning {
+		case "none", "create", "link":
+		default:
+			log.Fatalf("Invalid value for %sPROVISIONING: %s", prefix, provider.Provisioning)
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// getEnv returns the value of the environment variable named by the key,
+// or the fallback value if the variable is not set or empty.
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt returns the integer value of the environment variable named by
+// the key, or the fallback value if the variable is not set. It logs a fatal
+// error if the value is not an integer.
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid value for %s: %v", key, err)
+	}
+	return number
+}
+
+// getEnvList returns the comma-separated values of the environment variable
+// named by the key, ignoring empty entries.
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
 	}
+	return values
 }
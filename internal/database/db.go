@@ -11,12 +11,12 @@ import (
 
 var DB *gorm.DB
 
-// ConnectDB connects to the PostgresSQL database, migrates the User model,
-// and logs a success message.
+// ConnectDB connects to the PostgresSQL database, migrates the models,
+// runs the pending migrations, and logs a success message.
 //
 // This function takes the application configuration as a parameter and
 // uses it to construct the PostgresSQL connection string. It then opens
-// a connection to the database using GORM and migrates the User model.
+// a connection to the database using GORM and migrates the models.
 // If either of these operations fails, it logs a fatal error message.
 // Otherwise, it logs a success message.
 func ConnectDB(cfg config.Config) {
@@ -28,17 +28,27 @@ func ConnectDB(cfg config.Config) {
 
 	// Open a connection to the database
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		log.Fatalf("Failed to connect to the database: %v", err)
 	}
 
-	// Migrate the User model
-	err = DB.AutoMigrate(&models.User{})
+	// Migrate the models
+	err = DB.AutoMigrate(&models.User{}, &models.AuditEvent{}, &models.PersonalAccessToken{},
+		&models.OAuthClient{}, &models.OAuthAuthorizationCode{}, &models.OAuthConsent{}, &models.OAuthDeviceAuthorization{},
+		&models.Identity{}, &models.Group{}, &models.Organization{}, &models.Membership{}, &models.Invitation{},
+		&models.UsernameChange{}, &models.Session{}, &models.LoginAttempt{},
+		&models.MagicLink{}, &models.WebAuthnCredential{}, &models.WebAuthnChallenge{})
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	// Apply the migrations AutoMigrate cannot handle
+	DefaultOrganization = cfg.DefaultOrganization
+	if err := RunMigrations(DB); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
 	// Log a success message
 	log.Println("Database connection and migration successful")
 }
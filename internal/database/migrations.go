@@ -0,0 +1,237 @@
+package database
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is a change to the schema or the data that AutoMigrate cannot
+// make on its own. Each migration is applied once, in order.
+type Migration struct {
+	ID string
+	Up func(db *gorm.DB) error
+	// Requires lists the migrations that must be applied first. The
+	// migration waits while one of them is pending.
+	Requires []string
+}
+
+// SchemaMigration records a migration that has been applied
+type SchemaMigration struct {
+	ID        string `gorm:"primaryKey"`
+	AppliedAt time.Time
+}
+
+// errMigrationPending is returned by a migration that cannot complete until
+// an operator steps in. It is retried on the next start.
+var errMigrationPending = errors.New("migration pending")
+
+// migrations lists every migration, in the order they are applied
+var migrations = []Migration{
+	{ID: "0001_normalize_usernames", Up: normalizeUsernames},
+	{ID: "0002_default_organization", Up: moveToDefaultOrganization},
+}
+
+// DefaultOrganization is the slug of the organization the users and groups
+// created before organizations are moved to. ConnectDB sets it from the
+// configuration.
+var DefaultOrganization = "default"
+
+// UsernameCollision groups the users whose usernames are considered equal
+type UsernameCollision struct {
+	Key       string
+	Usernames []string
+}
+
+// RunMigrations applies the migrations that have not been applied yet.
+//
+// It stops at the first migration that fails and returns its error. A
+// migration that is pending is logged and skipped, together with the ones
+// requiring it, so the application can still start; the others still run.
+func RunMigrations(db *gorm.DB) error {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return err
+	}
+
+	pending := make(map[string]bool)
+	for _, migration := range migrations {
+		var applied int64
+		if err := db.Model(&SchemaMigration{}).Where("id = ?", migration.ID).Count(&applied).Error; err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+		if waitsFor := pendingRequirement(migration, pending); waitsFor != "" {
+			log.Printf("Migration %s waits for the pending migration %s", migration.ID, waitsFor)
+			pending[migration.ID] = true
+			continue
+		}
+
+		err := migration.Up(db)
+		if errors.Is(err, errMigrationPending) {
+			log.Printf("Migration %s is pending and will be retried on the next start", migration.ID)
+			pending[migration.ID] = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := db.Create(&SchemaMigration{ID: migration.ID, AppliedAt: time.Now()}).Error; err != nil {
+			return err
+		}
+		log.Printf("Applied migration %s", migration.ID)
+	}
+	return nil
+}
+
+// pendingRequirement returns the first migration required by migration that
+// is still pending, or "" if there is none
+func pendingRequirement(migration Migration, pending map[string]bool) string {
+	for _, id := range migration.Requires {
+		if pending[id] {
+			return id
+		}
+	}
+	return ""
+}
+
+// normalizeUsernames backfills the normalized username and skeleton of
+// existing users, then makes normalized usernames unique among active users.
+//
+// The unique index cannot be created while two active users share a
+// normalized username (for example "Alice" and "alice"), so these collisions
+// are reported and the migration stays pending until they are resolved.
+// Users with confusable usernames are reported too, but do not block it.
+func normalizeUsernames(db *gorm.DB) error {
+	// Backfill the users registered before usernames were normalized
+	var users []models.User
+	err := db.Unscoped().Where("normalized_username = ''").FindInBatches(&users, 500, func(tx *gorm.DB, batch int) error {
+		for _, user := range users {
+			canonical := services.CanonicalUsername(user.Username)
+			err := tx.Model(&user).Updates(map[string]interface{}{
+				"normalized_username": canonical,
+				"username_skeleton":   services.UsernameSkeleton(canonical),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	// Confusable usernames are only reported
+	lookalikes, err := ReportUsernameCollisions(db, "username_skeleton")
+	if err != nil {
+		return err
+	}
+	for _, collision := range lookalikes {
+		log.Printf("Backfill report: confusable usernames %s", strings.Join(collision.Usernames, ", "))
+	}
+
+	// Usernames equal once normalized have to be resolved first
+	collisions, err := ReportUsernameCollisions(db, "normalized_username")
+	if err != nil {
+		return err
+	}
+	if len(collisions) > 0 {
+		for _, collision := range collisions {
+			log.Printf("Backfill report: usernames %s collide as %q; rename or delete all but one",
+				strings.Join(collision.Usernames, ", "), collision.Key)
+		}
+		return errMigrationPending
+	}
+
+	return db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_normalized_username
+		ON users (normalized_username) WHERE deleted_at IS NULL`).Error
+}
+
+// ReportUsernameCollisions returns the groups of active users sharing the
+// same value in the given column (normalized_username or username_skeleton)
+func ReportUsernameCollisions(db *gorm.DB, column string) ([]UsernameCollision, error) {
+	if column != "normalized_username" && column != "username_skeleton" {
+		return nil, errors.New("unsupported username column " + column)
+	}
+
+	duplicates := db.Model(&models.User{}).Select(column).Group(column).Having("COUNT(*) > 1")
+
+	var users []models.User
+	err := db.Where(column+" IN (?)", duplicates).Order(column).Order("id").Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var collisions []UsernameCollision
+	for _, user := range users {
+		key := user.NormalizedUsername
+		if column == "username_skeleton" {
+			key = user.UsernameSkeleton
+		}
+		if len(collisions) == 0 || collisions[len(collisions)-1].Key != key {
+			collisions = append(collisions, UsernameCollision{Key: key})
+		}
+		last := &collisions[len(collisions)-1]
+		last.Usernames = append(last.Usernames, user.Username)
+	}
+	return collisions, nil
+}
+
+// moveToDefaultOrganization moves the users and groups created before
+// organizations to the default organization, and drops the index that made
+// group display names unique across organizations.
+//
+// Users join as members, admins as owners so the organization can be
+// managed. Nothing is created when there is nothing to move.
+func moveToDefaultOrganization(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if migrator.HasIndex(&models.Group{}, "idx_groups_display_name") {
+		if err := migrator.DropIndex(&models.Group{}, "idx_groups_display_name"); err != nil {
+			return err
+		}
+	}
+	if !migrator.HasTable(&models.Organization{}) || !migrator.HasTable(&models.Membership{}) {
+		return nil
+	}
+
+	var users, groups int64
+	if err := db.Model(&models.User{}).Where("id NOT IN (?)", db.Model(&models.Membership{}).Select("user_id")).Count(&users).Error; err != nil {
+		return err
+	}
+	if migrator.HasTable(&models.Group{}) {
+		if err := db.Model(&models.Group{}).Where("organization_id = 0").Count(&groups).Error; err != nil {
+			return err
+		}
+	}
+	if users == 0 && groups == 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		organization := models.Organization{Name: DefaultOrganization, Slug: DefaultOrganization}
+		if err := tx.Where("slug = ?", DefaultOrganization).FirstOrCreate(&organization).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		err := tx.Exec(`INSERT INTO memberships (organization_id, user_id, role, created_at, updated_at)
+			SELECT ?, id, CASE WHEN role = ? THEN ? ELSE ? END, ?, ? FROM users
+			WHERE deleted_at IS NULL AND id NOT IN (SELECT user_id FROM memberships)`,
+			organization.ID, models.RoleAdmin, models.OrgRoleOwner, models.OrgRoleMember, now, now).Error
+		if err != nil {
+			return err
+		}
+		if groups > 0 {
+			return tx.Model(&models.Group{}).Where("organization_id = 0").Update("organization_id", organization.ID).Error
+		}
+		return nil
+	})
+}
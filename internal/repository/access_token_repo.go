@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"time"
+)
+
+// AccessTokenRepository defines methods for storing personal access tokens.
+//
+// Tokens are not scoped to a tenant, even though they act in one: they are
+// looked up by hash before any organization is known, and users list and
+// revoke all of their tokens from any organization, so a leaked token can
+// always be revoked. Every other query is keyed by the user.
+type AccessTokenRepository interface {
+	// CreateToken adds a new token to the database.
+	//
+	// It takes a pointer to a PersonalAccessToken struct and returns an
+	// error. If the token is successfully created, it will return nil.
+	CreateToken(token *models.PersonalAccessToken) error
+
+	// GetTokenByHash fetches a token, with its user, by the hash of the token.
+	//
+	// It returns the token and nil if it is found, or nil and nil if there is
+	// no such token. Revoked and expired tokens are returned too.
+	GetTokenByHash(hash string) (*models.PersonalAccessToken, error)
+
+	// ListTokensByUser retrieves the tokens of a user, most recent first.
+	//
+	// It returns a slice of PersonalAccessToken structs and an error. If
+	// there is an error, it will return nil and the error.
+	ListTokensByUser(userID uint) ([]models.PersonalAccessToken, error)
+
+	// RevokeToken marks a token of a user as revoked at the given time.
+	//
+	// It returns false if the user has no such token, or if it was already
+	// revoked.
+	RevokeToken(userID, tokenID uint, at time.Time) (bool, error)
+
+	// UpdateTokenUsage records when and from which IP a token was last used
+	UpdateTokenUsage(tokenID uint, at time.Time, ip string) error
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// PostgresAccessTokenRepository implements AccessTokenRepository interface for PostgresSQL
+type PostgresAccessTokenRepository struct {
+	DB *gorm.DB
+}
+
+// CreateToken creates a new token in the database
+func (r *PostgresAccessTokenRepository) CreateToken(token *models.PersonalAccessToken) error {
+	return r.DB.Omit("User").Create(token).Error
+}
+
+// GetTokenByHash retrieves a token and its user by the hash of the token
+func (r *PostgresAccessTokenRepository) GetTokenByHash(hash string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	result := r.DB.Preload("User").Where("token_hash = ?", hash).First(&token)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // Token not found
+		}
+		return nil, result.Error
+	}
+	return &token, nil
+}
+
+// ListTokensByUser retrieves the tokens of a user, most recent first
+func (r *PostgresAccessTokenRepository) ListTokensByUser(userID uint) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	err := r.DB.Where("user_id = ?", userID).Order("id DESC").Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RevokeToken marks a token of a user as revoked
+func (r *PostgresAccessTokenRepository) RevokeToken(userID, tokenID uint, at time.Time) (bool, error) {
+	result := r.DB.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateTokenUsage records when and from which IP a token was last used
+func (r *PostgresAccessTokenRepository) UpdateTokenUsage(tokenID uint, at time.Time, ip string) error {
+	return r.DB.Model(&models.PersonalAccessToken{}).Where("id = ?", tokenID).
+		Updates(map[string]interface{}{"last_used_at": at, "last_used_ip": ip}).Error
+}
@@ -0,0 +1,28 @@
+package repository
+
+import "BuildasTechnicalAssessmentGo/pkg/models"
+
+// AuditRepository defines methods for storing audit events. Events can only
+// be appended, never updated or deleted.
+//
+// The audit log is not scoped to a tenant: its events form a single hash
+// chain that can only be verified whole, and only site admins read it.
+type AuditRepository interface {
+	// AppendEvent adds an event at the end of the audit chain.
+	//
+	// It takes a pointer to an AuditEvent with its CreatedAt set, fills in
+	// its PrevHash and Hash from the last event of the chain, and saves it.
+	// If the event is successfully appended, it will return nil.
+	AppendEvent(event *models.AuditEvent) error
+
+	// ListEvents retrieves the events matching a filter, most recent first.
+	//
+	// It returns a slice of AuditEvent structs and an error. If there is an
+	// error, it will return nil and the error.
+	ListEvents(filter models.AuditFilter) ([]models.AuditEvent, error)
+
+	// WalkEvents calls fn with every event in chain order, in batches.
+	//
+	// It stops and returns the error returned by fn, if any.
+	WalkEvents(fn func(batch []models.AuditEvent) error) error
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"errors"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxAppendAttempts bounds the retries when concurrent appends race for the
+// same position in the chain
+const maxAppendAttempts = 5
+
+// PostgresAuditRepository implements AuditRepository interface for PostgresSQL
+type PostgresAuditRepository struct {
+	DB *gorm.DB
+	mu sync.Mutex
+}
+
+// AppendEvent adds an event at the end of the audit chain.
+//
+// The unique index on PrevHash guarantees the chain never forks: when two
+// instances append at the same time, one of the inserts fails and is retried
+// on top of the other.
+func (r *PostgresAuditRepository) AppendEvent(event *models.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < maxAppendAttempts; attempt++ {
+		err = r.DB.Transaction(func(tx *gorm.DB) error {
+			var last models.AuditEvent
+			result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id DESC").Limit(1).Find(&last)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			event.ID = 0
+			event.PrevHash = models.AuditGenesisHash
+			if result.RowsAffected > 0 {
+				event.PrevHash = last.Hash
+			}
+			event.Hash = event.ComputeHash()
+			return tx.Create(event).Error
+		})
+		if err == nil || !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return err
+		}
+	}
+	return err
+}
+
+// ListEvents retrieves the events matching a filter, most recent first
+func (r *PostgresAuditRepository) ListEvents(filter models.AuditFilter) ([]models.AuditEvent, error) {
+	query := r.DB.Order("id DESC")
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor_username = ?", filter.Actor)
+	}
+	if filter.Target != "" {
+		query = query.Where("target_username = ?", filter.Target)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	var events []models.AuditEvent
+	if err := query.Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// WalkEvents calls fn with every event in chain order, in batches
+func (r *PostgresAuditRepository) WalkEvents(fn func(batch []models.AuditEvent) error) error {
+	var batch []models.AuditEvent
+	return r.DB.FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		return fn(batch)
+	}).Error
+}
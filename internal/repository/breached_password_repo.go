@@ -0,0 +1,14 @@
+package repository
+
+// BreachedPasswordRepository defines methods for looking up passwords that
+// appeared in known data breaches
+type BreachedPasswordRepository interface {
+	// GetRange returns the breached SHA-1 hashes starting with a prefix.
+	//
+	// It takes the first five hexadecimal characters of a SHA-1 hash and
+	// returns a map from the remaining 35 characters (upper case) to the number
+	// of times the password was seen in breaches. Only the prefix is ever
+	// handed to the repository, following the k-anonymity model of the Pwned
+	// Passwords range API.
+	GetRange(prefix string) (map[string]int, error)
+}
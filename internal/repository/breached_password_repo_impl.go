@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FileBreachedPasswordRepository implements BreachedPasswordRepository on
+// top of an offline copy of the Pwned Passwords SHA-1 list.
+//
+// The file must hold one "HASH:COUNT" entry per line, sorted by hash, as in
+// the "ordered by hash" downloads. It is binary searched on every lookup, so
+// it is never loaded in memory.
+type FileBreachedPasswordRepository struct {
+	Path string
+}
+
+// GetRange returns the breached SHA-1 hashes starting with a prefix
+func (r *FileBreachedPasswordRepository) GetRange(prefix string) (map[string]int, error) {
+	prefix = strings.ToUpper(prefix)
+
+	file, err := os.Open(r.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	// Find a line start at or before the first line matching the prefix
+	low, high := int64(0), size
+	for low < high {
+		mid := (low + high) / 2
+		line, next, err := readLineAt(file, size, mid)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" || hashPrefix(line) >= prefix {
+			high = mid
+		} else {
+			low = next
+		}
+	}
+
+	// Scan forward and collect the lines sharing the prefix
+	hashes := make(map[string]int)
+	scanner := bufio.NewScanner(io.NewSectionReader(file, low, size-low))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		linePrefix := hashPrefix(line)
+		if linePrefix < prefix {
+			continue
+		}
+		if linePrefix > prefix {
+			break
+		}
+
+		hash, count, _ := strings.Cut(line, ":")
+		hashes[strings.ToUpper(hash[len(prefix):])], _ = strconv.Atoi(count)
+	}
+	return hashes, scanner.Err()
+}
+
+// readLineAt reads the first line starting at or after offset.
+//
+// It returns the line and the offset of the following line. The line is
+// empty when there is no line left after the offset.
+func readLineAt(file *os.File, size, offset int64) (string, int64, error) {
+	start := offset
+	if offset > 0 {
+		// Skip the rest of the line the offset falls in
+		start = offset - 1
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, start, size-start))
+	if offset > 0 {
+		skipped, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return "", size, nil
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		start += int64(len(skipped))
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", 0, err
+	}
+	return strings.TrimSpace(line), start + int64(len(line)), nil
+}
+
+// hashPrefix returns the upper case five character prefix of a line
+func hashPrefix(line string) string {
+	if len(line) < 5 {
+		return strings.ToUpper(line)
+	}
+	return strings.ToUpper(line[:5])
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"context"
+)
+
+// GroupRepository defines methods for storing groups and their members.
+//
+// Groups belong to an organization, and every method is scoped to the
+// organization carried by its context (see the tenant package). A context
+// without one returns tenant.ErrNoTenant.
+type GroupRepository interface {
+	// CreateGroup adds a new group, with its members, to the organization
+	// of the context.
+	//
+	// It takes a pointer to a Group struct and returns an error. Display
+	// names are unique within an organization, so gorm.ErrDuplicatedKey is
+	// returned for a taken one.
+	CreateGroup(ctx context.Context, group *models.Group) error
+
+	// GetGroup fetches a group of the organization of the context, with its
+	// members, by its ID.
+	//
+	// It returns the group and nil if it is found, or nil and nil if there
+	// is no such group in the organization.
+	GetGroup(ctx context.Context, id uint) (*models.Group, error)
+
+	// SearchGroups retrieves a page of the groups of the organization of the
+	// context matching a SCIM filter, with their members, in ID order.
+	//
+	// A nil filter matches every group. It returns the groups of the page
+	// and the total number of matching groups.
+	SearchGroups(ctx context.Context, filter utils.SCIMFilter, offset, limit int) ([]models.Group, int64, error)
+
+	// UpdateGroup saves the attributes of a group of the organization of the
+	// context and replaces its members with the members of the struct. It
+	// returns gorm.ErrRecordNotFound for a group of another organization.
+	UpdateGroup(ctx context.Context, group *models.Group) error
+
+	// DeleteGroup deletes a group of the organization of the context and its
+	// memberships
+	DeleteGroup(ctx context.Context, id uint) error
+
+	// ListGroupsByUser retrieves the groups of the organization of the
+	// context a user is a member of, without their members
+	ListGroupsByUser(ctx context.Context, userID uint) ([]models.Group, error)
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/tenant"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"context"
+	"errors"
+	"gorm.io/gorm"
+)
+
+// PostgresGroupRepository implements GroupRepository interface for PostgresSQL
+type PostgresGroupRepository struct {
+	DB *gorm.DB
+}
+
+// CreateGroup creates a new group and its memberships in the organization
+// of the context
+func (r *PostgresGroupRepository) CreateGroup(ctx context.Context, group *models.Group) error {
+	organizationID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return err
+	}
+	group.OrganizationID = organizationID
+	// Only link the members, never create or update users
+	return r.DB.WithContext(ctx).Omit("Members.*").Create(group).Error
+}
+
+// GetGroup retrieves a group and its members by its ID
+func (r *PostgresGroupRepository) GetGroup(ctx context.Context, id uint) (*models.Group, error) {
+	query, err := r.groups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var group models.Group
+	result := query.Preload("Members", orderByID).First(&group, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // Group not found
+		}
+		return nil, result.Error
+	}
+	return &group, nil
+}
+
+// SearchGroups retrieves a page of the groups matching a SCIM filter
+func (r *PostgresGroupRepository) SearchGroups(ctx context.Context, filter utils.SCIMFilter, offset, limit int) ([]models.Group, int64, error) {
+	query, err := r.groups(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if query, err = applySCIMFilter(query, filter, groupSCIMColumns); err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var groups []models.Group
+	if err := query.Preload("Members", orderByID).Order("id").Offset(offset).Limit(limit).Find(&groups).Error; err != nil {
+		return nil, 0, err
+	}
+	return groups, total, nil
+}
+
+// UpdateGroup saves a group and replaces its members
+func (r *PostgresGroupRepository) UpdateGroup(ctx context.Context, group *models.Group) error {
+	organizationID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return err
+	}
+	if group.OrganizationID != organizationID {
+		return gorm.ErrRecordNotFound
+	}
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Members").Save(group).Error; err != nil {
+			return err
+		}
+		return tx.Model(group).Omit("Members.*").Association("Members").Replace(group.Members)
+	})
+}
+
+// DeleteGroup deletes a group and its memberships
+func (r *PostgresGroupRepository) DeleteGroup(ctx context.Context, id uint) error {
+	organizationID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return err
+	}
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("DELETE FROM group_members WHERE group_id IN (SELECT id FROM groups WHERE id = ? AND organization_id = ?)",
+			id, organizationID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("organization_id = ?", organizationID).Delete(&models.Group{}, id).Error
+	})
+}
+
+// ListGroupsByUser retrieves the groups of a user
+func (r *PostgresGroupRepository) ListGroupsByUser(ctx context.Context, userID uint) ([]models.Group, error) {
+	query, err := r.groups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var groups []models.Group
+	err = query.Where("id IN (SELECT group_id FROM group_members WHERE user_id = ?)", userID).Order("id").Find(&groups).Error
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// groups returns a query on the groups of the organization of the context
+func (r *PostgresGroupRepository) groups(ctx context.Context) (*gorm.DB, error) {
+	organizationID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.DB.WithContext(ctx).Model(&models.Group{}).Where("organization_id = ?", organizationID), nil
+}
+
+// orderByID sorts preloaded associations by ID
+func orderByID(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"time"
+)
+
+// IdentityRepository defines methods for storing the external identities
+// linked to users
+type IdentityRepository interface {
+	// CreateIdentity links a new external identity to a user.
+	//
+	// It takes a pointer to an Identity struct and returns an error. The
+	// provider and subject are unique, so an identity cannot be linked twice.
+	CreateIdentity(identity *models.Identity) error
+
+	// GetIdentity fetches an identity, with its user, by provider and
+	// subject.
+	//
+	// It returns the identity and nil if it is found, or nil and nil if the
+	// external account is not linked to any user.
+	GetIdentity(provider, subject string) (*models.Identity, error)
+
+	// UpdateIdentityLogin records when an identity was last used to log in,
+	// and the email the provider reported then
+	UpdateIdentityLogin(identityID uint, at time.Time, email string) error
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// PostgresIdentityRepository implements IdentityRepository interface for PostgresSQL
+type PostgresIdentityRepository struct {
+	DB *gorm.DB
+}
+
+// CreateIdentity creates a new identity in the database
+func (r *PostgresIdentityRepository) CreateIdentity(identity *models.Identity) error {
+	return r.DB.Omit("User").Create(identity).Error
+}
+
+// GetIdentity retrieves an identity and its user by provider and subject
+func (r *PostgresIdentityRepository) GetIdentity(provider, subject string) (*models.Identity, error) {
+	var identity models.Identity
+	result := r.DB.Preload("User").Where("provider = ? AND subject = ?", provider, subject).First(&identity)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // Identity not linked
+		}
+		return nil, result.Error
+	}
+	return &identity, nil
+}
+
+// UpdateIdentityLogin records the last login through an identity
+func (r *PostgresIdentityRepository) UpdateIdentityLogin(identityID uint, at time.Time, email string) error {
+	return r.DB.Model(&models.Identity{}).Where("id = ?", identityID).
+		Updates(map[string]interface{}{"last_login_at": at, "email": email}).Error
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"context"
+	"time"
+)
+
+// InvitationRepository defines methods for storing invitations.
+//
+// The methods taking a context are scoped to the organization it carries,
+// like those of OrganizationRepository. The others are used by invitees,
+// who are not members of any organization yet, and find an invitation by
+// its token.
+type InvitationRepository interface {
+	// CreateInvitation adds a new invitation to the organization of the
+	// context, whatever the OrganizationID of the invitation
+	CreateInvitation(ctx context.Context, invitation *models.Invitation) error
+
+	// ListInvitations retrieves the invitations of the organization of the
+	// context, with who sent them, most recent first
+	ListInvitations(ctx context.Context) ([]models.Invitation, error)
+
+	// GetInvitation fetches an invitation of the organization of the
+	// context, with who sent it and the organization.
+	//
+	// It returns nil and nil if there is no such invitation in the
+	// organization.
+	GetInvitation(ctx context.Context, id uint) (*models.Invitation, error)
+
+	// FindPendingInvitation fetches the invitation of the organization of
+	// the context to an email address that is neither accepted, revoked nor
+	// expired at the given time, or nil and nil if there is none
+	FindPendingInvitation(ctx context.Context, email string, now time.Time) (*models.Invitation, error)
+
+	// ResendInvitation replaces the token hash of an invitation of the
+	// organization of the context, and its sent and expiry times. It
+	// returns false if there is no such invitation, or if it was accepted
+	// or revoked.
+	ResendInvitation(ctx context.Context, invitation *models.Invitation) (bool, error)
+
+	// RevokeInvitation marks an invitation of the organization of the
+	// context as revoked at the given time. It returns false if there is no
+	// such invitation, or if it was already accepted or revoked.
+	RevokeInvitation(ctx context.Context, id uint, at time.Time) (bool, error)
+
+	// GetInvitationByTokenHash fetches an invitation, with its organization,
+	// by the hash of its token.
+	//
+	// It returns nil and nil if there is no such invitation. Accepted,
+	// revoked and expired invitations are returned too.
+	GetInvitationByTokenHash(hash string) (*models.Invitation, error)
+
+	// ClaimInvitation marks an invitation as accepted at the given time,
+	// unless it was already accepted or revoked, or has expired. It returns
+	// false in those cases, so an invitation is only ever accepted once,
+	// even by concurrent requests.
+	ClaimInvitation(id uint, at time.Time) (bool, error)
+
+	// ReleaseInvitation undoes ClaimInvitation, when the account of the
+	// invitee cannot be created
+	ReleaseInvitation(id uint) error
+
+	// SetAcceptedUser records the user created by accepting an invitation
+	SetAcceptedUser(id, userID uint) error
+}
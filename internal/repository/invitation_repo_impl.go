@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/tenant"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// PostgresInvitationRepository implements InvitationRepository interface for PostgresSQL
+type PostgresInvitationRepository struct {
+	DB *gorm.DB
+}
+
+// CreateInvitation creates a new invitation in the organization of the
+// context
+func (r *PostgresInvitationRepository) CreateInvitation(ctx context.Context, invitation *models.Invitation) error {
+	organizationID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return err
+	}
+	invitation.OrganizationID = organizationID
+	return r.DB.WithContext(ctx).Omit("Organization", "InvitedBy").Create(invitation).Error
+}
+
+// ListInvitations retrieves the invitations of the organization of the
+// context, most recent first
+func (r *PostgresInvitationRepository) ListInvitations(ctx context.Context) ([]models.Invitation, error) {
+	query, err := r.invitations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var invitations []models.Invitation
+	if err := query.Preload("InvitedBy").Order("invitations.id DESC").Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// GetInvitation retrieves an invitation of the organization of the context
+func (r *PostgresInvitationRepository) GetInvitation(ctx context.Context, id uint) (*models.Invitation, error) {
+	query, err := r.invitations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return firstInvitation(query.Preload("InvitedBy").Preload("Organization").Where("id = ?", id))
+}
+
+// FindPendingInvitation retrieves the pending invitation of the
+// organization of the context to an email address
+func (r *PostgresInvitationRepository) FindPendingInvitation(ctx context.Context, email string, now time.Time) (*models.Invitation, error) {
+	query, err := r.invitations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return firstInvitation(query.Where("email = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", email, now))
+}
+
+// ResendInvitation replaces the token of an invitation of the organization
+// of the context
+func (r *PostgresInvitationRepository) ResendInvitation(ctx context.Context, invitation *models.Invitation) (bool, error) {
+	query, err := r.invitations(ctx)
+	if err != nil {
+		return false, err
+	}
+	result := query.Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.ID).
+		Updates(map[string]interface{}{
+			"token_hash": invitation.TokenHash,
+			"sent_at":    invitation.SentAt,
+			"expires_at": invitation.ExpiresAt,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeInvitation marks an invitation of the organization of the context
+// as revoked
+func (r *PostgresInvitationRepository) RevokeInvitation(ctx context.Context, id uint, at time.Time) (bool, error) {
+	query, err := r.invitations(ctx)
+	if err != nil {
+		return false, err
+	}
+	result := query.Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).Update("revoked_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetInvitationByTokenHash retrieves an invitation and its organization by
+// the hash of its token
+func (r *PostgresInvitationRepository) GetInvitationByTokenHash(hash string) (*models.Invitation, error) {
+	return firstInvitation(r.DB.Preload("Organization").Preload("InvitedBy").Where("token_hash = ?", hash))
+}
+
+// ClaimInvitation marks a pending invitation as accepted
+func (r *PostgresInvitationRepository) ClaimInvitation(id uint, at time.Time) (bool, error) {
+	result := r.DB.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", id, at).
+		Update("accepted_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReleaseInvitation marks a claimed invitation as pending again
+func (r *PostgresInvitationRepository) ReleaseInvitation(id uint) error {
+	return r.DB.Model(&models.Invitation{}).Where("id = ? AND accepted_user_id IS NULL", id).
+		Update("accepted_at", nil).Error
+}
+
+// SetAcceptedUser records the user who accepted an invitation
+func (r *PostgresInvitationRepository) SetAcceptedUser(id, userID uint) error {
+	return r.DB.Model(&models.Invitation{}).Where("id = ?", id).Update("accepted_user_id", userID).Error
+}
+
+// invitations returns a query on the invitations of the organization of the
+// context
+func (r *PostgresInvitationRepository) invitations(ctx context.Context) (*gorm.DB, error) {
+	organizationID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.DB.WithContext(ctx).Model(&models.Invitation{}).Where("invitations.organization_id = ?", organizationID), nil
+}
+
+// firstInvitation runs a query for a single invitation, returning nil and
+// nil if there is none
+func firstInvitation(query *gorm.DB) (*models.Invitation, error) {
+	var invitation models.Invitation
+	result := query.First(&invitation)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // Invitation not found
+		}
+		return nil, result.Error
+	}
+	return &invitation, nil
+}
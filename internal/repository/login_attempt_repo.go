@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"time"
+)
+
+// LoginAttemptRepository defines methods for storing the login history.
+//
+// Logins are not scoped to a tenant, since they are recorded before an
+// organization is chosen. Every query is keyed by the user, and only site
+// admins read the history of others.
+type LoginAttemptRepository interface {
+	// CreateLoginAttempt adds a login to the history.
+	//
+	// It takes a pointer to a LoginAttempt struct and returns an error. If
+	// the login is successfully created, it will return nil.
+	CreateLoginAttempt(attempt *models.LoginAttempt) error
+
+	// ListLoginAttempts retrieves the most recent logins to the account of
+	// a user, most recent first, at most limit of them.
+	//
+	// It returns a slice of LoginAttempt structs and an error. If there is
+	// an error, it will return nil and the error.
+	ListLoginAttempts(userID uint, limit int) ([]models.LoginAttempt, error)
+
+	// GetLastSuccessfulLogin fetches the most recent successful login of a
+	// user.
+	//
+	// It returns the login and nil if there is one, or nil and nil if the
+	// user never logged in.
+	GetLastSuccessfulLogin(userID uint) (*models.LoginAttempt, error)
+
+	// CountSuccessfulLogins counts the successful logins of a user, only
+	// those with the given user agent unless it is empty
+	CountSuccessfulLogins(userID uint, userAgent string) (int64, error)
+
+	// CountFailedLogins counts the failed logins to the account of a user
+	// since the given time
+	CountFailedLogins(userID uint, since time.Time) (int64, error)
+}
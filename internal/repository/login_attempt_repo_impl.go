@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// PostgresLoginAttemptRepository implements LoginAttemptRepository interface for PostgresSQL
+type PostgresLoginAttemptRepository struct {
+	DB *gorm.DB
+}
+
+// CreateLoginAttempt adds a login to the history
+func (r *PostgresLoginAttemptRepository) CreateLoginAttempt(attempt *models.LoginAttempt) error {
+	return r.DB.Create(attempt).Error
+}
+
+// ListLoginAttempts retrieves the most recent logins to the account of a user
+func (r *PostgresLoginAttemptRepository) ListLoginAttempts(userID uint, limit int) ([]models.LoginAttempt, error) {
+	var attempts []models.LoginAttempt
+	err := r.DB.Where("user_id = ?", userID).Order("id DESC").Limit(limit).Find(&attempts).Error
+	if err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// GetLastSuccessfulLogin fetches the most recent successful login of a user
+func (r *PostgresLoginAttemptRepository) GetLastSuccessfulLogin(userID uint) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	result := r.DB.Where("user_id = ? AND outcome = ?", userID, models.AuditSuccess).Order("id DESC").First(&attempt)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // Never logged in
+		}
+		return nil, result.Error
+	}
+	return &attempt, nil
+}
+
+// CountSuccessfulLogins counts the successful logins of a user
+func (r *PostgresLoginAttemptRepository) CountSuccessfulLogins(userID uint, userAgent string) (int64, error) {
+	query := r.DB.Model(&models.LoginAttempt{}).Where("user_id = ? AND outcome = ?", userID, models.AuditSuccess)
+	if userAgent != "" {
+		query = query.Where("user_agent = ?", userAgent)
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// CountFailedLogins counts the failed logins to the account of a user
+func (r *PostgresLoginAttemptRepository) CountFailedLogins(userID uint, since time.Time) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.LoginAttempt{}).
+		Where("user_id = ? AND outcome = ? AND created_at >= ?", userID, models.AuditFailure, since).
+		Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"time"
+)
+
+// MagicLinkRepository defines methods for storing the login links emailed
+// to users
+type MagicLinkRepository interface {
+	// CreateMagicLink adds a new login link to the database.
+	//
+	// It takes a pointer to a MagicLink struct and returns an error. If the
+	// link is successfully created, it will return nil and its ID is set.
+	CreateMagicLink(link *models.MagicLink) error
+
+	// GetMagicLinkByTokenHash fetches a login link by the hash of its token.
+	//
+	// It returns nil and nil if there is no such link. Used and expired
+	// links are returned too.
+	GetMagicLinkByTokenHash(hash string) (*models.MagicLink, error)
+
+	// ClaimMagicLink marks a login link as used at the given time, unless
+	// it was already used or has expired. It returns false in those cases,
+	// so a link only ever logs in once, even with concurrent requests.
+	ClaimMagicLink(id uint, at time.Time) (bool, error)
+}
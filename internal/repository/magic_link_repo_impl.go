@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// PostgresMagicLinkRepository implements MagicLinkRepository interface for PostgresSQL
+type PostgresMagicLinkRepository struct {
+	DB *gorm.DB
+}
+
+// CreateMagicLink creates a new login link in the database
+func (r *PostgresMagicLinkRepository) CreateMagicLink(link *models.MagicLink) error {
+	return r.DB.Create(link).Error
+}
+
+// GetMagicLinkByTokenHash retrieves a login link by the hash of its token
+func (r *PostgresMagicLinkRepository) GetMagicLinkByTokenHash(hash string) (*models.MagicLink, error) {
+	var link models.MagicLink
+	result := r.DB.Where("token_hash = ?", hash).First(&link)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // Link not found
+		}
+		return nil, result.Error
+	}
+	return &link, nil
+}
+
+// ClaimMagicLink marks an unused login link as used
+func (r *PostgresMagicLinkRepository) ClaimMagicLink(id uint, at time.Time) (bool, error) {
+	result := r.DB.Model(&models.MagicLink{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", id, at).
+		Update("used_at", at)
+	return result.RowsAffected > 0, result.Error
+}
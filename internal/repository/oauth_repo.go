@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"time"
+)
+
+// OAuthRepository defines methods for storing the clients, authorization
+// codes, consents and device authorizations of the OpenID Connect provider.
+//
+// These are not scoped to a tenant: clients are registered by site admins
+// for every organization, codes and device authorizations are looked up by
+// hash before a user is known, and consents are keyed by their user.
+type OAuthRepository interface {
+	// CreateClient adds a new client to the database.
+	//
+	// It takes a pointer to an OAuthClient struct and returns an error. If
+	// the client is successfully created, it will return nil.
+	CreateClient(client *models.OAuthClient) error
+
+	// GetClientByClientID fetches a client by its client ID.
+	//
+	// It returns the client and nil if it is found, or nil and nil if there
+	// is no such client.
+	GetClientByClientID(clientID string) (*models.OAuthClient, error)
+
+	// ListClients retrieves all clients, ordered by name.
+	ListClients() ([]models.OAuthClient, error)
+
+	// CreateAuthorizationCode adds a new authorization code to the database.
+	CreateAuthorizationCode(code *models.OAuthAuthorizationCode) error
+
+	// ConsumeAuthorizationCode marks an authorization code as used and
+	// returns it.
+	//
+	// Marking and reading happen atomically, so a code can only be consumed
+	// once. It returns nil and nil if there is no unused code with that hash.
+	ConsumeAuthorizationCode(hash string, at time.Time) (*models.OAuthAuthorizationCode, error)
+
+	// GetConsent fetches the consent a user gave a client.
+	//
+	// It returns nil and nil if the user never consented.
+	GetConsent(userID uint, clientID string) (*models.OAuthConsent, error)
+
+	// SaveConsent creates or replaces the consent a user gave a client.
+	SaveConsent(consent *models.OAuthConsent) error
+
+	// CreateDeviceAuthorization adds a new device authorization to the
+	// database.
+	CreateDeviceAuthorization(authorization *models.OAuthDeviceAuthorization) error
+
+	// GetDeviceAuthorizationByDeviceCodeHash fetches a device authorization
+	// by the hash of its device code.
+	//
+	// It returns nil and nil if there is no such authorization. Used and
+	// expired authorizations are returned too.
+	GetDeviceAuthorizationByDeviceCodeHash(hash string) (*models.OAuthDeviceAuthorization, error)
+
+	// GetPendingDeviceAuthorization fetches the pending device
+	// authorization with the hash of a user code, unexpired at the given
+	// time.
+	//
+	// It returns nil and nil if there is no such authorization.
+	GetPendingDeviceAuthorization(userCodeHash string, at time.Time) (*models.OAuthDeviceAuthorization, error)
+
+	// DecideDeviceAuthorization sets the status of a pending device
+	// authorization and the user who decided, unless it was already decided
+	// or has expired. It returns false in those cases.
+	DecideDeviceAuthorization(id, userID uint, status string, at time.Time) (bool, error)
+
+	// RecordDevicePoll saves the time of the last poll of a device
+	// authorization and the interval the device must now wait.
+	RecordDevicePoll(id uint, at time.Time, interval int) error
+
+	// ClaimDeviceAuthorization marks an approved device authorization as
+	// used at the given time, unless it was already used. It returns false
+	// in that case, so a device code only ever gets one token, even with
+	// concurrent requests.
+	ClaimDeviceAuthorization(id uint, at time.Time) (bool, error)
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// PostgresOAuthRepository implements OAuthRepository interface for PostgresSQL
+type PostgresOAuthRepository struct {
+	DB *gorm.DB
+}
+
+// CreateClient creates a new client in the database
+func (r *PostgresOAuthRepository) CreateClient(client *models.OAuthClient) error {
+	return r.DB.Create(client).Error
+}
+
+// GetClientByClientID retrieves a client by its client ID
+func (r *PostgresOAuthRepository) GetClientByClientID(clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	result := r.DB.Where("client_id = ?", clientID).First(&client)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // Client not found
+		}
+		return nil, result.Error
+	}
+	return &client, nil
+}
+
+// ListClients retrieves all clients, ordered by name
+func (r *PostgresOAuthRepository) ListClients() ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	if err := r.DB.Order("name").Find(&clients).Error; err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// CreateAuthorizationCode creates a new authorization code in the database
+func (r *PostgresOAuthRepository) CreateAuthorizationCode(code *models.OAuthAuthorizationCode) error {
+	return r.DB.Create(code).Error
+}
+
+// ConsumeAuthorizationCode marks an unused authorization code as used and
+// returns it
+func (r *PostgresOAuthRepository) ConsumeAuthorizationCode(hash string, at time.Time) (*models.OAuthAuthorizationCode, error) {
+	var code *models.OAuthAuthorizationCode
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the request that flips used_at gets the code
+		result := tx.Model(&models.OAuthAuthorizationCode{}).
+			Where("code_hash = ? AND used_at IS NULL", hash).
+			Update("used_at", at)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		code = &models.OAuthAuthorizationCode{}
+		return tx.Where("code_hash = ?", hash).First(code).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// GetConsent retrieves the consent a user gave a client
+func (r *PostgresOAuthRepository) GetConsent(userID uint, clientID string) (*models.OAuthConsent, error) {
+	var consent models.OAuthConsent
+	result := r.DB.Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // No consent
+		}
+		return nil, result.Error
+	}
+	return &consent, nil
+}
+
+// SaveConsent creates or replaces the consent a user gave a client
+func (r *PostgresOAuthRepository) SaveConsent(consent *models.OAuthConsent) error {
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scope", "updated_at"}),
+	}).Create(consent).Error
+}
+
+// CreateDeviceAuthorization creates a new device authorization in the
+// database
+func (r *PostgresOAuthRepository) CreateDeviceAuthorization(authorization *models.OAuthDeviceAuthorization) error {
+	return r.DB.Create(authorization).Error
+}
+
+// GetDeviceAuthorizationByDeviceCodeHash retrieves a device authorization
+// by the hash of its device code
+func (r *PostgresOAuthRepository) GetDeviceAuthorizationByDeviceCodeHash(hash string) (*models.OAuthDeviceAuthorization, error) {
+	var authorization models.OAuthDeviceAuthorization
+	result := r.DB.Where("device_code_hash = ?", hash).First(&authorization)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // Authorization not found
+		}
+		return nil, result.Error
+	}
+	return &authorization, nil
+}
+
+// GetPendingDeviceAuthorization retrieves the pending, unexpired device
+// authorization with the hash of a user code
+func (r *PostgresOAuthRepository) GetPendingDeviceAuthorization(userCodeHash string, at time.Time) (*models.OAuthDeviceAuthorization, error) {
+	var authorization models.OAuthDeviceAuthorization
+	result := r.DB.Where("user_code_hash = ? AND status = ? AND expires_at > ?", userCodeHash, models.DeviceAuthorizationPending, at).
+		Order("id DESC").First(&authorization)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // No pending authorization
+		}
+		return nil, result.Error
+	}
+	return &authorization, nil
+}
+
+// DecideDeviceAuthorization approves or denies a pending device
+// authorization
+func (r *PostgresOAuthRepository) DecideDeviceAuthorization(id, userID uint, status string, at time.Time) (bool, error) {
+	result := r.DB.Model(&models.OAuthDeviceAuthorization{}).
+		Where("id = ? AND status = ? AND expires_at > ?", id, models.DeviceAuthorizationPending, at).
+		Updates(map[string]interface{}{"status": status, "user_id": userID})
+	return result.RowsAffected > 0, result.Error
+}
+
+// RecordDevicePoll saves the last poll of a device authorization
+func (r *PostgresOAuthRepository) RecordDevicePoll(id uint, at time.Time, interval int) error {
+	return r.DB.Model(&models.OAuthDeviceAuthorization{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_polled_at": at, "interval": interval}).Error
+}
+
+// ClaimDeviceAuthorization marks an approved, unused device authorization
+// as used
+func (r *PostgresOAuthRepository) ClaimDeviceAuthorization(id uint, at time.Time) (bool, error) {
+	result := r.DB.Model(&models.OAuthDeviceAuthorization{}).
+		Where("id = ? AND status = ? AND used_at IS NULL", id, models.DeviceAuthorizationApproved).
+		Update("used_at", at)
+	return result.RowsAffected > 0, result.Error
+}
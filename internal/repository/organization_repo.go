@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"context"
+)
+
+// OrganizationRepository defines methods for storing organizations and
+// their members.
+//
+// The methods taking a context are scoped to the organization it carries
+// (see the tenant package): they only read and write the members of that
+// organization, and return tenant.ErrNoTenant for a context without one.
+type OrganizationRepository interface {
+	// CreateOrganization adds a new organization to the database, with its
+	// first owner if one is given.
+	//
+	// Slugs are unique, so gorm.ErrDuplicatedKey is returned for a taken
+	// one.
+	CreateOrganization(organization *models.Organization, owner *models.Membership) error
+
+	// GetOrganizationBySlug fetches an organization by its slug.
+	//
+	// It returns the organization and nil if it is found, or nil and nil if
+	// there is no such organization.
+	GetOrganizationBySlug(slug string) (*models.Organization, error)
+
+	// ListMemberships retrieves the memberships of a user in every
+	// organization, with their organization, in organization name order.
+	// This is the only query across organizations, and only returns the
+	// user's own memberships.
+	ListMemberships(userID uint) ([]models.Membership, error)
+
+	// GetMembership fetches the membership of a user in the organization of
+	// the context, with the user and the organization.
+	//
+	// It returns nil and nil if the user is not a member, or has been
+	// deleted.
+	GetMembership(ctx context.Context, userID uint) (*models.Membership, error)
+
+	// ListMembers retrieves the memberships of the organization of the
+	// context, with their users, in username order
+	ListMembers(ctx context.Context) ([]models.Membership, error)
+
+	// SearchMembers retrieves a page of the memberships of the organization
+	// of the context whose user matches a SCIM filter, with their users, in
+	// user ID order.
+	//
+	// A nil filter matches every member. It returns the memberships of the
+	// page and the total number of matching members. Filters on unsupported
+	// attributes return an error wrapping utils.ErrInvalidSCIMFilter.
+	SearchMembers(ctx context.Context, filter utils.SCIMFilter, offset, limit int) ([]models.Membership, int64, error)
+
+	// AddMember adds a user to the organization of the context, whatever the
+	// OrganizationID of the membership. A user already a member returns
+	// gorm.ErrDuplicatedKey.
+	AddMember(ctx context.Context, membership *models.Membership) error
+
+	// UpdateMember saves the role and state of a membership of the
+	// organization of the context. It returns gorm.ErrRecordNotFound if the
+	// membership belongs to another organization.
+	UpdateMember(ctx context.Context, membership *models.Membership) error
+
+	// RemoveMember removes a user from the organization of the context and
+	// from its groups
+	RemoveMember(ctx context.Context, userID uint) error
+}
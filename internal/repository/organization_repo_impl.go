@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/tenant"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"context"
+	"errors"
+	"gorm.io/gorm"
+)
+
+// PostgresOrganizationRepository implements OrganizationRepository interface for PostgresSQL
+type PostgresOrganizationRepository struct {
+	DB *gorm.DB
+}
+
+// CreateOrganization creates a new organization and its first owner
+func (r *PostgresOrganizationRepository) CreateOrganization(organization *models.Organization, owner *models.Membership) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(organization).Error; err != nil {
+			return err
+		}
+		if owner == nil {
+			return nil
+		}
+		owner.OrganizationID = organization.ID
+		return tx.Omit("Organization", "User").Create(owner).Error
+	})
+}
+
+// GetOrganizationBySlug retrieves an organization by its slug
+func (r *PostgresOrganizationRepository) GetOrganizationBySlug(slug string) (*models.Organization, error) {
+	var organization models.Organization
+	result := r.DB.Where("slug = ?", slug).First(&organization)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // Organization not found
+		}
+		return nil, result.Error
+	}
+	return &organization, nil
+}
+
+// ListMemberships retrieves the memberships of a user
+func (r *PostgresOrganizationRepository) ListMemberships(userID uint) ([]models.Membership, error) {
+	var memberships []models.Membership
+	err := r.DB.Joins("Organization").Where("memberships.user_id = ?", userID).
+		Order(`"Organization"."name"`).Find(&memberships).Error
+	if err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// GetMembership retrieves the membership of a user in the organization of
+// the context
+func (r *PostgresOrganizationRepository) GetMembership(ctx context.Context, userID uint) (*models.Membership, error) {
+	query, err := r.members(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var membership models.Membership
+	result := query.Joins("Organization").Where("memberships.user_id = ?", userID).First(&membership)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // Not a member
+		}
+		return nil, result.Error
+	}
+	return &membership, nil
+}
+
+// ListMembers retrieves the memberships of the organization of the context
+func (r *PostgresOrganizationRepository) ListMembers(ctx context.Context) ([]models.Membership, error) {
+	query, err := r.members(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var memberships []models.Membership
+	if err := query.Order(`"User"."username"`).Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// SearchMembers retrieves a page of the members matching a SCIM filter
+func (r *PostgresOrganizationRepository) SearchMembers(ctx context.Context, filter utils.SCIMFilter, offset, limit int) ([]models.Membership, int64, error) {
+	query, err := r.members(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if query, err = applySCIMFilter(query, filter, userSCIMColumns); err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var memberships []models.Membership
+	if err := query.Order(`"User"."id"`).Offset(offset).Limit(limit).Find(&memberships).Error; err != nil {
+		return nil, 0, err
+	}
+	return memberships, total, nil
+}
+
+// AddMember adds a user to the organization of the context
+func (r *PostgresOrganizationRepository) AddMember(ctx context.Context, membership *models.Membership) error {
+	organizationID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return err
+	}
+	membership.OrganizationID = organizationID
+	return r.DB.WithContext(ctx).Omit("Organization", "User").Create(membership).Error
+}
+
+// UpdateMember saves a membership of the organization of the context
+func (r *PostgresOrganizationRepository) UpdateMember(ctx context.Context, membership *models.Membership) error {
+	organizationID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return err
+	}
+	result := r.DB.WithContext(ctx).Model(&models.Membership{}).
+		Where("id = ? AND organization_id = ?", membership.ID, organizationID).
+		Updates(map[string]interface{}{"role": membership.Role, "deactivated_at": membership.DeactivatedAt})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RemoveMember removes a user from the organization of the context and its
+// groups
+func (r *PostgresOrganizationRepository) RemoveMember(ctx context.Context, userID uint) error {
+	organizationID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return err
+	}
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("DELETE FROM group_members WHERE user_id = ? AND group_id IN (SELECT id FROM groups WHERE organization_id = ?)",
+			userID, organizationID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("organization_id = ? AND user_id = ?", organizationID, userID).Delete(&models.Membership{}).Error
+	})
+}
+
+// members returns a query on the memberships of the organization of the
+// context joined with their users, leaving out deleted users
+func (r *PostgresOrganizationRepository) members(ctx context.Context) (*gorm.DB, error) {
+	organizationID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.DB.WithContext(ctx).Model(&models.Membership{}).InnerJoins("User").
+		Where("memberships.organization_id = ?", organizationID), nil
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"time"
+)
+
+// RateLimitRepository defines methods for storing rate limit buckets
+type RateLimitRepository interface {
+	// Take consumes a single request from the bucket identified by key.
+	//
+	// It takes the bucket key, the policy the bucket is metered with and the
+	// current time, and returns the result of the attempt. A rejected request
+	// is not an error: it is reported through the Allowed field of the result.
+	// An error is only returned if the backend could not be reached.
+	Take(key string, policy models.RateLimitPolicy, now time.Time) (models.RateLimitResult, error)
+}
+
+// newRateLimitResult builds a RateLimitResult from the raw GCRA values
+// computed by a backend.
+//
+// diff is the distance between now and the earliest time the request is
+// allowed (negative when the request is rejected), and resetAfter is the
+// time left until the bucket is completely full again.
+func newRateLimitResult(policy models.RateLimitPolicy, allowed bool, diff, resetAfter time.Duration) models.RateLimitResult {
+	result := models.RateLimitResult{
+		Allowed:    allowed,
+		Limit:      policy.Limit,
+		ResetAfter: resetAfter,
+	}
+	if allowed {
+		result.Remaining = int(diff / policy.EmissionInterval())
+	} else {
+		result.RetryAfter = -diff
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"sync"
+	"time"
+)
+
+// sweepInterval is the number of calls to Take between two sweeps of the
+// expired buckets.
+const sweepInterval = 1000
+
+// MemoryRateLimitRepository implements RateLimitRepository in process memory.
+//
+// Buckets are not shared between instances of the application, so it is
+// only suitable when a single instance is running.
+type MemoryRateLimitRepository struct {
+	mu      sync.Mutex
+	buckets map[string]time.Time
+	calls   int
+}
+
+// NewMemoryRateLimitRepository creates a new MemoryRateLimitRepository
+func NewMemoryRateLimitRepository() *MemoryRateLimitRepository {
+	return &MemoryRateLimitRepository{buckets: make(map[string]time.Time)}
+}
+
+// Take consumes a single request from the bucket identified by key
+func (r *MemoryRateLimitRepository) Take(key string, policy models.RateLimitPolicy, now time.Time) (models.RateLimitResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls++
+	if r.calls%sweepInterval == 0 {
+		r.sweep(now)
+	}
+
+	// The theoretical arrival time can never be in the past
+	tat, ok := r.buckets[key]
+	if !ok || tat.Before(now) {
+		tat = now
+	}
+
+	newTat := tat.Add(policy.EmissionInterval())
+	diff := now.Sub(newTat.Add(-policy.BurstOffset()))
+	if diff < 0 {
+		return newRateLimitResult(policy, false, diff, tat.Sub(now)), nil
+	}
+
+	r.buckets[key] = newTat
+	return newRateLimitResult(policy, true, diff, newTat.Sub(now)), nil
+}
+
+// sweep removes the buckets that are full again, since they hold no state
+func (r *MemoryRateLimitRepository) sweep(now time.Time) {
+	for key, tat := range r.buckets {
+		if !tat.After(now) {
+			delete(r.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraScript atomically applies the GCRA algorithm to a bucket.
+//
+// All times are expressed in milliseconds. It returns whether the request is
+// allowed, the distance to the earliest allowed time, and the time left until
+// the bucket is full again.
+var gcraScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local increment = tonumber(ARGV[2])
+local burst_offset = tonumber(ARGV[3])
+
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+
+local new_tat = tat + increment
+local diff = now - (new_tat - burst_offset)
+if diff < 0 then
+	return {0, diff, tat - now}
+end
+
+redis.call("SET", KEYS[1], new_tat, "PX", new_tat - now)
+return {1, diff, new_tat - now}
+`)
+
+// RedisRateLimitRepository implements RateLimitRepository on top of any
+// server speaking the Redis protocol, so buckets are shared between instances
+type RedisRateLimitRepository struct {
+	Client redis.UniversalClient
+	Prefix string
+}
+
+// NewRedisRateLimitRepository creates a new RedisRateLimitRepository
+func NewRedisRateLimitRepository(client redis.UniversalClient) *RedisRateLimitRepository {
+	return &RedisRateLimitRepository{Client: client, Prefix: "ratelimit:"}
+}
+
+// Take consumes a single request from the bucket identified by key
+func (r *RedisRateLimitRepository) Take(key string, policy models.RateLimitPolicy, now time.Time) (models.RateLimitResult, error) {
+	values, err := gcraScript.Run(
+		context.Background(),
+		r.Client,
+		[]string{r.Prefix + key},
+		now.UnixMilli(),
+		policy.EmissionInterval().Milliseconds(),
+		policy.BurstOffset().Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return models.RateLimitResult{}, err
+	}
+
+	allowed := values[0] == 1
+	diff := time.Duration(values[1]) * time.Millisecond
+	resetAfter := time.Duration(values[2]) * time.Millisecond
+	return newRateLimitResult(policy, allowed, diff, resetAfter), nil
+}
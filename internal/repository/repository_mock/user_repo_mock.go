@@ -3,6 +3,7 @@ package repository_mock
 import (
 	"BuildasTechnicalAssessmentGo/internal/repository"
 	"BuildasTechnicalAssessmentGo/pkg/models"
+	"context"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -20,10 +21,81 @@ func (m *MockUserRepository) CreateUser(user *models.User) error {
 
 func (m *MockUserRepository) GetUserByUsername(username string) (*models.User, error) {
 	args := m.Called(username)
-	return args.Get(0).(*models.User), args.Error(1)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
 }
 
-func (m *MockUserRepository) GetAllUsers() ([]models.User, error) {
-	args := m.Called()
+func (m *MockUserRepository) GetUserByID(id uint) (*models.User, error) {
+	args := m.Called(id)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByUsernameSkeleton(skeleton string) (*models.User, error) {
+	args := m.Called(skeleton)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(user *models.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	args := m.Called(ctx)
 	return args.Get(0).([]models.User), args.Error(1)
 }
+
+func (m *MockUserRepository) ListUsersByStatus(status string) ([]models.User, error) {
+	args := m.Called(status)
+	if users := args.Get(0); users != nil {
+		return users.([]models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockUserRepository) ListUsersByEmail(email string) ([]models.User, error) {
+	args := m.Called(email)
+	if users := args.Get(0); users != nil {
+		return users.([]models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockUserRepository) SetUserStatus(user *models.User, from string) (bool, error) {
+	args := m.Called(user, from)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserRepository) RenameUser(user *models.User, change *models.UsernameChange) error {
+	args := m.Called(user, change)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) ListUsernameChanges(userID uint) ([]models.UsernameChange, error) {
+	args := m.Called(userID)
+	if changes := args.Get(0); changes != nil {
+		return changes.([]models.UsernameChange), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockUserRepository) GetUsernameChange(username string) (*models.UsernameChange, error) {
+	args := m.Called(username)
+	if change := args.Get(0); change != nil {
+		return change.(*models.UsernameChange), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockUserRepository) DeleteUser(id uint) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
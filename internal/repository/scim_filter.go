@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// scimColumn maps a SCIM attribute onto a column
+type scimColumn struct {
+	// Expr is the column, or the SQL expression, holding the attribute
+	Expr string
+	// Kind is one of "string", "id", "time", "active" or "member"
+	Kind string
+	// CaseExact compares strings with their case
+	CaseExact bool
+}
+
+// userSCIMColumns maps the filterable attributes of SCIM users onto the
+// memberships joined with their users, aliased "User"
+var userSCIMColumns = map[string]scimColumn{
+	"id":                {Expr: `"User"."id"`, Kind: "id"},
+	"externalid":        {Expr: `"User"."external_id"`, Kind: "string", CaseExact: true},
+	"username":          {Expr: `"User"."username"`, Kind: "string"},
+	"displayname":       {Expr: `"User"."display_name"`, Kind: "string"},
+	"name.givenname":    {Expr: `"User"."given_name"`, Kind: "string"},
+	"name.familyname":   {Expr: `"User"."family_name"`, Kind: "string"},
+	"emails":            {Expr: `"User"."email"`, Kind: "string"},
+	"emails.value":      {Expr: `"User"."email"`, Kind: "string"},
+	"emails.type":       {Expr: "'work'", Kind: "string"},
+	"active":            {Expr: "memberships.deactivated_at", Kind: "active"},
+	"meta.created":      {Expr: `"User"."created_at"`, Kind: "time"},
+	"meta.lastmodified": {Expr: `"User"."updated_at"`, Kind: "time"},
+}
+
+// groupSCIMColumns maps the filterable attributes of SCIM groups
+var groupSCIMColumns = map[string]scimColumn{
+	"id":                {Expr: "id", Kind: "id"},
+	"externalid":        {Expr: "external_id", Kind: "string", CaseExact: true},
+	"displayname":       {Expr: "display_name", Kind: "string"},
+	"members":           {Expr: "id IN (SELECT group_id FROM group_members WHERE user_id = ?)", Kind: "member"},
+	"members.value":     {Expr: "id IN (SELECT group_id FROM group_members WHERE user_id = ?)", Kind: "member"},
+	"meta.created":      {Expr: "created_at", Kind: "time"},
+	"meta.lastmodified": {Expr: "updated_at", Kind: "time"},
+}
+
+// applySCIMFilter adds the SQL condition of a filter to a query. A nil
+// filter leaves the query unchanged.
+func applySCIMFilter(query *gorm.DB, filter utils.SCIMFilter, columns map[string]scimColumn) (*gorm.DB, error) {
+	if filter == nil {
+		return query, nil
+	}
+	condition, args, err := scimFilterSQL(filter, columns)
+	if err != nil {
+		return nil, err
+	}
+	return query.Where(condition, args...), nil
+}
+
+// scimFilterSQL translates a filter into an SQL condition and its arguments
+func scimFilterSQL(filter utils.SCIMFilter, columns map[string]scimColumn) (string, []interface{}, error) {
+	switch f := filter.(type) {
+	case utils.SCIMLogical:
+		left, leftArgs, err := scimFilterSQL(f.Left, columns)
+		if err != nil {
+			return "", nil, err
+		}
+		right, rightArgs, err := scimFilterSQL(f.Right, columns)
+		if err != nil {
+			return "", nil, err
+		}
+		return "(" + left + " " + strings.ToUpper(f.Operator) + " " + right + ")", append(leftArgs, rightArgs...), nil
+	case utils.SCIMNot:
+		inner, args, err := scimFilterSQL(f.Filter, columns)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + inner + ")", args, nil
+	case utils.SCIMComparison:
+		column, ok := columns[f.Path]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: cannot filter on %s", utils.ErrInvalidSCIMFilter, f.Path)
+		}
+		return scimComparisonSQL(column, f)
+	}
+	return "", nil, utils.ErrInvalidSCIMFilter
+}
+
+// scimComparisonSQL translates a comparison on a column
+func scimComparisonSQL(column scimColumn, comparison utils.SCIMComparison) (string, []interface{}, error) {
+	invalid := fmt.Errorf("%w: %s does not support %s %v", utils.ErrInvalidSCIMFilter, comparison.Path, comparison.Operator, comparison.Value)
+	operator, value := comparison.Operator, comparison.Value
+
+	switch column.Kind {
+	case "active":
+		active, ok := value.(bool)
+		switch {
+		case operator == "pr":
+			return "1 = 1", nil, nil
+		case !ok || (operator != "eq" && operator != "ne"):
+			return "", nil, invalid
+		case active == (operator == "eq"):
+			return column.Expr + " IS NULL", nil, nil
+		default:
+			return column.Expr + " IS NOT NULL", nil, nil
+		}
+
+	case "member":
+		id, err := scimID(value)
+		if operator != "eq" || err != nil {
+			return "", nil, invalid
+		}
+		return column.Expr, []interface{}{id}, nil
+
+	case "id":
+		if operator == "pr" {
+			return "1 = 1", nil, nil
+		}
+		id, err := scimID(value)
+		sql, ok := sqlComparisons[operator]
+		if err != nil || !ok {
+			return "", nil, invalid
+		}
+		return column.Expr + " " + sql + " ?", []interface{}{id}, nil
+
+	case "time":
+		if operator == "pr" {
+			return column.Expr + " IS NOT NULL", nil, nil
+		}
+		text, _ := value.(string)
+		at, err := time.Parse(time.RFC3339Nano, text)
+		sql, ok := sqlComparisons[operator]
+		if err != nil || !ok {
+			return "", nil, invalid
+		}
+		return column.Expr + " " + sql + " ?", []interface{}{at}, nil
+	}
+
+	// Strings
+	if operator == "pr" {
+		return "(" + column.Expr + " IS NOT NULL AND " + column.Expr + " <> '')", nil, nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return "", nil, invalid
+	}
+	expr := column.Expr
+	if !column.CaseExact {
+		expr = "LOWER(" + expr + ")"
+		text = strings.ToLower(text)
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text)
+	switch operator {
+	case "co":
+		return expr + ` LIKE ? ESCAPE '\'`, []interface{}{"%" + escaped + "%"}, nil
+	case "sw":
+		return expr + ` LIKE ? ESCAPE '\'`, []interface{}{escaped + "%"}, nil
+	case "ew":
+		return expr + ` LIKE ? ESCAPE '\'`, []interface{}{"%" + escaped}, nil
+	}
+	return expr + " " + sqlComparisons[operator] + " ?", []interface{}{text}, nil
+}
+
+// sqlComparisons maps the ordering operators onto SQL
+var sqlComparisons = map[string]string{
+	"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<=",
+}
+
+// scimID parses the id of a resource, sent as a string
+func scimID(value interface{}) (uint64, error) {
+	text, ok := value.(string)
+	if !ok {
+		return 0, utils.ErrInvalidSCIMFilter
+	}
+	return strconv.ParseUint(text, 10, 64)
+}
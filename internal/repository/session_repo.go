@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"time"
+)
+
+// SessionRepository defines methods for storing the sessions of users.
+//
+// Sessions are not scoped to a tenant: a session belongs to its user and
+// moves between their organizations when they switch, so every query is
+// keyed by the user instead. Only site admins read the sessions of others.
+type SessionRepository interface {
+	// CreateSession adds a new session to the database.
+	//
+	// It takes a pointer to a Session struct and returns an error. If the
+	// session is successfully created, it will return nil and its ID is set.
+	CreateSession(session *models.Session) error
+
+	// GetSession fetches a session by its ID.
+	//
+	// It returns the session and nil if it is found, or nil and nil if there
+	// is no such session. Revoked and expired sessions are returned too.
+	GetSession(sessionID uint) (*models.Session, error)
+
+	// ListActiveSessions retrieves the sessions of a user that are neither
+	// revoked nor expired at the given time, most recently seen first.
+	//
+	// It returns a slice of Session structs and an error. If there is an
+	// error, it will return nil and the error.
+	ListActiveSessions(userID uint, now time.Time) ([]models.Session, error)
+
+	// RevokeSession marks a session of a user as revoked at the given time.
+	//
+	// It returns false if the user has no such session, or if it was already
+	// revoked.
+	RevokeSession(userID, sessionID uint, at time.Time) (bool, error)
+
+	// RevokeUserSessions marks every session of a user as revoked at the
+	// given time, except the one with the ID exceptID, if not zero.
+	//
+	// It returns the number of sessions revoked.
+	RevokeUserSessions(userID, exceptID uint, at time.Time) (int64, error)
+
+	// UpdateSessionActivity records when and from which IP a session was
+	// last seen
+	UpdateSessionActivity(sessionID uint, at time.Time, ip string) error
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// PostgresSessionRepository implements SessionRepository interface for PostgresSQL
+type PostgresSessionRepository struct {
+	DB *gorm.DB
+}
+
+// CreateSession creates a new session in the database
+func (r *PostgresSessionRepository) CreateSession(session *models.Session) error {
+	return r.DB.Create(session).Error
+}
+
+// GetSession retrieves a session by its ID
+func (r *PostgresSessionRepository) GetSession(sessionID uint) (*models.Session, error) {
+	var session models.Session
+	result := r.DB.First(&session, sessionID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // Session not found
+		}
+		return nil, result.Error
+	}
+	return &session, nil
+}
+
+// ListActiveSessions retrieves the active sessions of a user, most recently
+// seen first
+func (r *PostgresSessionRepository) ListActiveSessions(userID uint, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at DESC, id DESC").Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession marks a session of a user as revoked
+func (r *PostgresSessionRepository) RevokeSession(userID, sessionID uint, at time.Time) (bool, error) {
+	result := r.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeUserSessions marks the sessions of a user as revoked, but one
+func (r *PostgresSessionRepository) RevokeUserSessions(userID, exceptID uint, at time.Time) (int64, error) {
+	result := r.DB.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptID).
+		Update("revoked_at", at)
+	return result.RowsAffected, result.Error
+}
+
+// UpdateSessionActivity records when and from which IP a session was last seen
+func (r *PostgresSessionRepository) UpdateSessionActivity(sessionID uint, at time.Time, ip string) error {
+	return r.DB.Model(&models.Session{}).Where("id = ?", sessionID).
+		Updates(map[string]interface{}{"last_seen_at": at, "ip": ip}).Error
+}
@@ -1,6 +1,9 @@
 package repository
 
-import "BuildasTechnicalAssessmentGo/pkg/models"
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"context"
+)
 
 // UserRepository defines methods for interacting with users in the database
 type UserRepository interface {
@@ -12,15 +15,74 @@ type UserRepository interface {
 
 	// GetUserByUsername fetches a user by their username from the database.
 	//
-	// It takes a string argument representing the username and returns a pointer
-	// to a User struct and an error. If the user is found, it will return the
-	// user and nil. If the user is not found, it will return nil and an error.
+	// It takes a string argument representing the canonical (case-folded)
+	// username, as stored in NormalizedUsername, and returns a pointer to a
+	// User struct and an error. If the user is found, it will return the user
+	// and nil. If the user is not found, it will return nil and nil.
 	GetUserByUsername(username string) (*models.User, error)
 
-	// GetAllUsers retrieves all users from the database.
+	// GetUserByID fetches a user by their ID from the database.
+	//
+	// It returns a pointer to a User struct and nil if the user is found, or
+	// nil and nil if there is no such user.
+	GetUserByID(id uint) (*models.User, error)
+
+	// GetUserByUsernameSkeleton fetches a user whose username looks like the
+	// given one.
+	//
+	// It takes the skeleton of a username and returns the first user sharing
+	// it, or nil and nil if there is none.
+	GetUserByUsernameSkeleton(skeleton string) (*models.User, error)
+
+	// UpdateUser saves the changes made to an existing user.
+	//
+	// It takes a pointer to a User struct with its ID set and returns an
+	// error. If the user is successfully saved, it will return nil.
+	UpdateUser(user *models.User) error
+
+	// GetAllUsers retrieves the members of the organization carried by the
+	// context (see the tenant package), in ID order.
 	//
 	// It returns a slice of User structs and an error. If the users are
-	// successfully retrieved, it will return the slice and nil. If there
-	// is an error, it will return nil and an error.
-	GetAllUsers() ([]models.User, error)
+	// successfully retrieved, it will return the slice and nil. A context
+	// without an organization returns nil and tenant.ErrNoTenant, never
+	// the users of every organization.
+	GetAllUsers(ctx context.Context) ([]models.User, error)
+
+	// ListUsersByStatus retrieves the users of every organization with an
+	// account status, such as the accounts awaiting approval, oldest first.
+	// Only site admins see this list, as new accounts belong to no
+	// organization yet.
+	ListUsersByStatus(status string) ([]models.User, error)
+
+	// ListUsersByEmail retrieves the users of every organization with an
+	// email address, compared case-insensitively, oldest first. Addresses
+	// are not unique, so several users may share one.
+	ListUsersByEmail(email string) ([]models.User, error)
+
+	// SetUserStatus saves the status of a user, with its reason and change
+	// time and the deactivation time, if it still is the given one.
+	//
+	// It returns true if the status was changed, and false if the user does
+	// not exist or another request changed their status first.
+	SetUserStatus(user *models.User, from string) (bool, error)
+
+	// RenameUser saves a user whose username changed, and records the
+	// change in their username history, in one transaction.
+	RenameUser(user *models.User, change *models.UsernameChange) error
+
+	// ListUsernameChanges retrieves the username history of a user, most
+	// recent first.
+	ListUsernameChanges(userID uint) ([]models.UsernameChange, error)
+
+	// GetUsernameChange fetches the most recent change away from a
+	// username, given its canonical form, or returns nil and nil if no user
+	// ever gave it up.
+	GetUsernameChange(username string) (*models.UsernameChange, error)
+
+	// DeleteUser deletes a user and removes them from their organizations
+	// and groups.
+	//
+	// Users are soft deleted, so the audit log can still refer to them.
+	DeleteUser(id uint) error
 }
@@ -1,7 +1,9 @@
 package repository
 
 import (
+	"BuildasTechnicalAssessmentGo/internal/tenant"
 	"BuildasTechnicalAssessmentGo/pkg/models"
+	"context"
 	"errors"
 	"gorm.io/gorm"
 )
@@ -16,10 +18,10 @@ func (r *PostgresUserRepository) CreateUser(user *models.User) error {
 	return r.DB.Create(user).Error
 }
 
-// GetUserByUsername retrieves a user by their username
+// GetUserByUsername retrieves a user by their canonical username
 func (r *PostgresUserRepository) GetUserByUsername(username string) (*models.User, error) {
 	var user models.User
-	result := r.DB.Where("username = ?", username).First(&user)
+	result := r.DB.Where("normalized_username = ?", username).First(&user)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, nil // User not found
@@ -29,12 +31,124 @@ func (r *PostgresUserRepository) GetUserByUsername(username string) (*models.Use
 	return &user, nil // User found
 }
 
-// GetAllUsers retrieves all users
-func (r *PostgresUserRepository) GetAllUsers() ([]models.User, error) {
+// GetUserByUsernameSkeleton retrieves a user by the skeleton of their username
+func (r *PostgresUserRepository) GetUserByUsernameSkeleton(skeleton string) (*models.User, error) {
+	var user models.User
+	result := r.DB.Where("username_skeleton = ?", skeleton).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // User not found
+		}
+		return nil, result.Error // Some other error occurred
+	}
+	return &user, nil // User found
+}
+
+// GetUserByID retrieves a user by their ID
+func (r *PostgresUserRepository) GetUserByID(id uint) (*models.User, error) {
+	var user models.User
+	result := r.DB.First(&user, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // User not found
+		}
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
+// UpdateUser saves the changes made to an existing user
+func (r *PostgresUserRepository) UpdateUser(user *models.User) error {
+	return r.DB.Save(user).Error
+}
+
+// GetAllUsers retrieves the members of the organization of the context
+func (r *PostgresUserRepository) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	organizationID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
 	var users []models.User
-	err := r.DB.Find(&users).Error
+	err = r.DB.WithContext(ctx).Where("id IN (SELECT user_id FROM memberships WHERE organization_id = ?)", organizationID).
+		Order("id").Find(&users).Error
 	if err != nil {
 		return nil, err
 	}
 	return users, nil
 }
+
+// ListUsersByStatus retrieves the users with an account status, oldest first
+func (r *PostgresUserRepository) ListUsersByStatus(status string) ([]models.User, error) {
+	var users []models.User
+	if err := r.DB.Where("status = ?", status).Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ListUsersByEmail retrieves the users with an email address, oldest first
+func (r *PostgresUserRepository) ListUsersByEmail(email string) ([]models.User, error) {
+	var users []models.User
+	if err := r.DB.Where("LOWER(email) = LOWER(?)", email).Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// SetUserStatus saves the status of a user if it still is the given one
+func (r *PostgresUserRepository) SetUserStatus(user *models.User, from string) (bool, error) {
+	result := r.DB.Model(&models.User{}).Where("id = ? AND status = ?", user.ID, from).Updates(map[string]interface{}{
+		"status":            user.Status,
+		"status_reason":     user.StatusReason,
+		"status_changed_at": user.StatusChangedAt,
+		"deactivated_at":    user.DeactivatedAt,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// RenameUser saves a renamed user and records the change
+func (r *PostgresUserRepository) RenameUser(user *models.User, change *models.UsernameChange) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(user).Error; err != nil {
+			return err
+		}
+		return tx.Create(change).Error
+	})
+}
+
+// ListUsernameChanges retrieves the username history of a user, most
+// recent first
+func (r *PostgresUserRepository) ListUsernameChanges(userID uint) ([]models.UsernameChange, error) {
+	var changes []models.UsernameChange
+	if err := r.DB.Where("user_id = ?", userID).Order("id DESC").Find(&changes).Error; err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// GetUsernameChange fetches the most recent change away from a username
+func (r *PostgresUserRepository) GetUsernameChange(username string) (*models.UsernameChange, error) {
+	var change models.UsernameChange
+	result := r.DB.Where("normalized_username = ?", username).Order("id DESC").Limit(1).Find(&change)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &change, nil
+}
+
+// DeleteUser soft deletes a user and removes them from their organizations
+// and groups
+func (r *PostgresUserRepository) DeleteUser(id uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM group_members WHERE user_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&models.Membership{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, id).Error
+	})
+}
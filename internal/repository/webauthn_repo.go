@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"time"
+)
+
+// WebAuthnRepository defines methods for storing the WebAuthn credentials
+// of users and the challenges of the ceremonies in progress
+type WebAuthnRepository interface {
+	// CreateCredential adds a new credential to the database.
+	//
+	// It takes a pointer to a WebAuthnCredential struct and returns an
+	// error. If the credential is successfully created, it will return nil
+	// and its ID is set.
+	CreateCredential(credential *models.WebAuthnCredential) error
+
+	// GetCredential fetches a credential by the ID its authenticator knows
+	// it by, base64url encoded.
+	//
+	// It returns nil and nil if there is no such credential.
+	GetCredential(credentialID string) (*models.WebAuthnCredential, error)
+
+	// ListCredentials retrieves the credentials of a user, oldest first.
+	ListCredentials(userID uint) ([]models.WebAuthnCredential, error)
+
+	// UpdateCredentialUse records the signature counter of a credential and
+	// when it was last used to log in
+	UpdateCredentialUse(id uint, signCount uint32, at time.Time) error
+
+	// DeleteCredential deletes a credential of a user.
+	//
+	// It returns false if the user has no such credential.
+	DeleteCredential(userID, id uint) (bool, error)
+
+	// CreateChallenge adds the challenge of a new ceremony to the database,
+	// deleting the challenges that expired before it.
+	CreateChallenge(challenge *models.WebAuthnChallenge) error
+
+	// ClaimChallenge fetches and deletes a challenge that has not expired at
+	// the given time. It returns nil and nil if there is no such challenge,
+	// or if another request claimed it first, so a challenge is only ever
+	// used once.
+	ClaimChallenge(challenge string, at time.Time) (*models.WebAuthnChallenge, error)
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// PostgresWebAuthnRepository implements WebAuthnRepository interface for PostgresSQL
+type PostgresWebAuthnRepository struct {
+	DB *gorm.DB
+}
+
+// CreateCredential creates a new credential in the database
+func (r *PostgresWebAuthnRepository) CreateCredential(credential *models.WebAuthnCredential) error {
+	return r.DB.Create(credential).Error
+}
+
+// GetCredential retrieves a credential by its authenticator's ID
+func (r *PostgresWebAuthnRepository) GetCredential(credentialID string) (*models.WebAuthnCredential, error) {
+	var credential models.WebAuthnCredential
+	result := r.DB.Where("credential_id = ?", credentialID).First(&credential)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // Credential not found
+		}
+		return nil, result.Error
+	}
+	return &credential, nil
+}
+
+// ListCredentials retrieves the credentials of a user, oldest first
+func (r *PostgresWebAuthnRepository) ListCredentials(userID uint) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	if err := r.DB.Where("user_id = ?", userID).Order("id").Find(&credentials).Error; err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// UpdateCredentialUse saves the signature counter and last use of a
+// credential
+func (r *PostgresWebAuthnRepository) UpdateCredentialUse(id uint, signCount uint32, at time.Time) error {
+	return r.DB.Model(&models.WebAuthnCredential{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"sign_count": signCount, "last_used_at": at}).Error
+}
+
+// DeleteCredential deletes a credential of a user
+func (r *PostgresWebAuthnRepository) DeleteCredential(userID, id uint) (bool, error) {
+	result := r.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// CreateChallenge creates a new challenge in the database, and deletes the
+// expired ones
+func (r *PostgresWebAuthnRepository) CreateChallenge(challenge *models.WebAuthnChallenge) error {
+	if err := r.DB.Where("expires_at <= ?", challenge.CreatedAt).Delete(&models.WebAuthnChallenge{}).Error; err != nil {
+		return err
+	}
+	return r.DB.Create(challenge).Error
+}
+
+// ClaimChallenge fetches and deletes an unexpired challenge
+func (r *PostgresWebAuthnRepository) ClaimChallenge(challenge string, at time.Time) (*models.WebAuthnChallenge, error) {
+	var claimed models.WebAuthnChallenge
+	result := r.DB.Where("challenge = ? AND expires_at > ?", challenge, at).First(&claimed)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // Challenge not found
+		}
+		return nil, result.Error
+	}
+	deleted := r.DB.Delete(&models.WebAuthnChallenge{}, claimed.ID)
+	if deleted.Error != nil || deleted.RowsAffected == 0 {
+		return nil, deleted.Error // Claimed by another request
+	}
+	return &claimed, nil
+}
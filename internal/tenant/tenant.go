@@ -0,0 +1,36 @@
+// Package tenant carries the organization a request acts in through its
+// context, so the repositories can scope their queries to it.
+//
+// Only the repositories of organization data (users, memberships, groups
+// and invitations) are scoped. The ones storing data owned by a user or by
+// the whole site explain why they are not.
+package tenant
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoTenant is returned by tenant-scoped queries run with a context
+// that carries no organization. Queries never fall back to every tenant.
+var ErrNoTenant = errors.New("no organization in context")
+
+// organizationKey is the context key of the organization ID
+type organizationKey struct{}
+
+// WithOrganization returns a copy of the context acting in the
+// organization with the given ID
+func WithOrganization(ctx context.Context, organizationID uint) context.Context {
+	return context.WithValue(ctx, organizationKey{}, organizationID)
+}
+
+// OrganizationID returns the ID of the organization of the context, or
+// ErrNoTenant if it carries none
+func OrganizationID(ctx context.Context) (uint, error) {
+	if ctx != nil {
+		if id, ok := ctx.Value(organizationKey{}).(uint); ok && id != 0 {
+			return id, nil
+		}
+	}
+	return 0, ErrNoTenant
+}
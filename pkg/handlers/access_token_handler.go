@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// tokensPath is the page listing the personal access tokens of the user
+const tokensPath = "/api/v1/user/tokens"
+
+// RegisterAccessTokenRoutes registers the routes for managing personal
+// access tokens.
+//
+// The routes are protected by the middleware.AuthMiddleware function, and
+// personal access tokens can only use them when granted the tokens:write
+// scope. Admins impersonating the user may list the tokens, but not create
+// or revoke them. The accessTokenService parameter is used by the handlers to mint,
+// list and revoke the tokens of the authenticated user.
+func RegisterAccessTokenRoutes(r *gin.Engine, accessTokenService services.AccessTokenServiceInterface) {
+	tokens := r.Group(tokensPath)
+	tokens.Use(middlewares.AuthMiddleware(), middlewares.RequireScope(models.ScopeTokensWrite))
+	{
+		tokens.GET("", func(c *gin.Context) { ListAccessTokens(c, accessTokenService) })
+		tokens.POST("", middlewares.DenyImpersonation(), func(c *gin.Context) { CreateAccessToken(c, accessTokenService) })
+		tokens.POST("/:id/revoke", middlewares.DenyImpersonation(), func(c *gin.Context) { RevokeAccessToken(c, accessTokenService) })
+		tokens.DELETE("/:id", middlewares.DenyImpersonation(), func(c *gin.Context) { RevokeAccessToken(c, accessTokenService) })
+	}
+}
+
+// ListAccessTokens handles the HTTP GET request for the token list.
+//
+// It fetches the tokens of the authenticated user using the provided
+// accessTokenService and renders the tokens.html template, or responds with
+// the tokens as JSON. The tokens themselves are never shown again, only
+// their prefix.
+//
+// If the tokens cannot be loaded, it responds with HTTP status 500 and an
+// error message.
+func ListAccessTokens(context *gin.Context, accessTokenService services.AccessTokenServiceInterface) {
+	renderAccessTokens(context, accessTokenService, http.StatusOK, gin.H{})
+}
+
+// CreateAccessToken handles the HTTP POST request for minting a token.
+//
+// It binds the name, scopes and lifetime from the form or JSON body, mints
+// the token using the provided accessTokenService and records it in the
+// audit log. The token is shown once: JSON clients receive it in the "token"
+// field with HTTP status 201, and the tokens.html template displays it
+// above the list.
+//
+// A token authenticating the request can only mint tokens with the scopes it
+// holds itself, and acts in the organization of the request. If the request
+// is invalid, it responds with HTTP status 400
+// and the field-level errors.
+func CreateAccessToken(context *gin.Context, accessTokenService services.AccessTokenServiceInterface) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return
+	}
+
+	// Bind and validate the request
+	var request CreateAccessTokenRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderAccessTokenError(context, accessTokenService, err)
+		return
+	}
+
+	// A token, service account or device cannot mint a token more powerful
+	// than itself
+	if claims := middlewares.GetClaims(context); claims.IsScoped() {
+		for _, scope := range request.Scopes {
+			if !claims.HasScope(scope) {
+				renderAccessTokenError(context, accessTokenService, fmt.Errorf("this token cannot grant the %s scope", scope))
+				return
+			}
+		}
+	}
+
+	// The token acts in the organization it was created in
+	var organizationID uint
+	if membership := middlewares.CurrentMembership(context); membership != nil {
+		organizationID = membership.OrganizationID
+	}
+
+	ttl := time.Duration(request.ExpiresInDays) * 24 * time.Hour
+	plain, token, err := accessTokenService.CreateToken(userID, organizationID, request.Name, request.Scopes, ttl)
+	if err != nil {
+		renderAccessTokenError(context, accessTokenService, err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:   models.AuditTokenCreate,
+		Outcome:  models.AuditSuccess,
+		TargetID: &userID,
+		Changes: services.AuditChanges(nil, map[string]interface{}{
+			"name":       token.Name,
+			"prefix":     token.DisplayPrefix,
+			"scopes":     token.Scopes,
+			"expires_at": token.ExpiresAt.UTC().Format(time.RFC3339),
+		}),
+	})
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusCreated, gin.H{"token": plain, "access_token": token})
+		return
+	}
+	renderAccessTokens(context, accessTokenService, http.StatusCreated, gin.H{"newToken": plain, "newTokenName": token.Name})
+}
+
+// RevokeAccessToken handles the HTTP POST and DELETE requests for revoking a
+// token.
+//
+// It revokes the token with the ID in the path, if it belongs to the
+// authenticated user, and records it in the audit log. JSON clients get HTTP
+// status 204; forms are redirected back to the token list. If there is no
+// such active token, it responds with HTTP status 404.
+func RevokeAccessToken(context *gin.Context, accessTokenService services.AccessTokenServiceInterface) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return
+	}
+
+	tokenID, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err == nil {
+		err = accessTokenService.RevokeToken(userID, uint(tokenID))
+	} else {
+		err = services.ErrAccessTokenMissing
+	}
+
+	switch {
+	case errors.Is(err, services.ErrAccessTokenMissing):
+		renderFormError(context, http.StatusNotFound, "error.html", nil, err)
+		return
+	case err != nil:
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to revoke the token"))
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:   models.AuditTokenRevoke,
+		Outcome:  models.AuditSuccess,
+		TargetID: &userID,
+		Changes:  services.AuditChanges(nil, map[string]interface{}{"token_id": tokenID}),
+	})
+
+	if wantsJSON(context) {
+		context.Status(http.StatusNoContent)
+		return
+	}
+	context.Redirect(http.StatusSeeOther, tokensPath)
+}
+
+// renderAccessTokens renders the token list of the authenticated user, with
+// the given extra values, or responds with it as JSON
+func renderAccessTokens(context *gin.Context, accessTokenService services.AccessTokenServiceInterface, status int, values gin.H) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return
+	}
+
+	tokens, err := accessTokenService.ListTokens(userID)
+	if err != nil {
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to load tokens"))
+		return
+	}
+
+	if wantsJSON(context) {
+		context.JSON(status, gin.H{"tokens": tokens})
+		return
+	}
+
+	values["tokens"] = tokens
+	values["scopes"] = models.AccessTokenScopes
+	values["now"] = time.Now()
+	context.HTML(status, "tokens.html", values)
+}
+
+// renderAccessTokenError responds to a token request that failed with HTTP
+// status 400, showing the error above the token list on the HTML page
+func renderAccessTokenError(context *gin.Context, accessTokenService services.AccessTokenServiceInterface, err error) {
+	if wantsJSON(context) {
+		renderFormError(context, http.StatusBadRequest, "tokens.html", nil, err)
+		return
+	}
+
+	values := gin.H{"error": err.Error()}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		values["error"] = "Please correct the highlighted fields"
+		values["fieldErrors"] = validationErr.ByField()
+	}
+	renderAccessTokens(context, accessTokenService, http.StatusBadRequest, values)
+}
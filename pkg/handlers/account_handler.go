@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// accountPath is the page of the authenticated user's account
+const accountPath = "/api/v1/user/account"
+
+// usersPath is the prefix of the profile pages, followed by a username
+const usersPath = "/api/v1/users/"
+
+// RegisterAccountRoutes registers the routes letting users manage their own
+// account, and the profile pages.
+//
+// They are only available to authenticated users. Personal access tokens
+// need the users:read scope to read and the users:write scope to update a
+// profile, and can never change a password or username, even with it. Admins impersonating
+// the user cannot change the account at all. The accountService
+// parameter is used by the handlers to load and update accounts.
+func RegisterAccountRoutes(r *gin.Engine, accountService services.AccountServiceInterface) {
+	account := r.Group(accountPath)
+	account.Use(middlewares.AuthMiddleware())
+	{
+		account.GET("", middlewares.RequireScope(models.ScopeUsersRead), func(c *gin.Context) { AccountPage(c, accountService) })
+		account.POST("/profile", middlewares.RequireScope(models.ScopeUsersWrite), middlewares.DenyImpersonation(), func(c *gin.Context) { UpdateProfile(c, accountService) })
+		account.POST("/password", middlewares.RequireScope(models.ScopeUsersWrite), middlewares.DenyImpersonation(), func(c *gin.Context) { ChangePassword(c, accountService) })
+		account.POST("/username", middlewares.RequireScope(models.ScopeUsersWrite), middlewares.DenyImpersonation(), func(c *gin.Context) { ChangeUsername(c, accountService) })
+	}
+
+	r.GET(usersPath+":username", middlewares.AuthMiddleware(), middlewares.RequireScope(models.ScopeUsersRead),
+		func(c *gin.Context) { UserProfile(c, accountService) })
+}
+
+// AccountPage handles the HTTP GET request for the account page.
+//
+// It renders the account.html template with the profile and username
+// history of the authenticated user, and the forms changing them, or
+// responds with them as JSON.
+func AccountPage(context *gin.Context, accountService services.AccountServiceInterface) {
+	renderAccount(context, accountService, http.StatusOK, gin.H{"notice": accountNotice(context.Query("updated"))})
+}
+
+// UpdateProfile handles the HTTP POST request updating the profile of the
+// authenticated user.
+//
+// It binds the names and email address from the form or JSON body, saves
+// them using the provided accountService and records the change in the
+// audit log. JSON clients get the user; forms are redirected back to the
+// account page. Invalid values get HTTP status 400.
+func UpdateProfile(context *gin.Context, accountService services.AccountServiceInterface) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return
+	}
+
+	var request UpdateProfileRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderAccountError(context, accountService, http.StatusBadRequest, err)
+		return
+	}
+
+	user, previous, err := accountService.UpdateProfile(userID, services.Profile{
+		DisplayName: request.DisplayName,
+		GivenName:   request.GivenName,
+		FamilyName:  request.FamilyName,
+		Email:       request.Email,
+	})
+	if err != nil {
+		renderAccountError(context, accountService, accountErrorStatus(err), err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditUserUpdate,
+		Outcome:        models.AuditSuccess,
+		TargetID:       &user.ID,
+		TargetUsername: user.Username,
+		Changes:        services.AuditChanges(profileAuditState(previous), profileAuditState(services.ProfileOf(user))),
+	})
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"user": user})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, accountPath+"?updated=profile")
+}
+
+// ChangePassword handles the HTTP POST request changing the password of the
+// authenticated user.
+//
+// It binds the current and new passwords from the form or JSON body,
+// changes the password using the provided accountService and records it
+// in the audit log. The other sessions of the user end; the session making
+// the change gets a new cookie, and JSON clients a new token. Forms are
+// redirected back to the account page.
+//
+// If the current password is wrong, it responds with HTTP status 403. If
+// the new password breaks the policy, it responds with HTTP status 400 and
+// the field-level errors. Personal access tokens get HTTP status 403.
+func ChangePassword(context *gin.Context, accountService services.AccountServiceInterface) {
+	userID, ok := sessionUserID(context)
+	if !ok {
+		return
+	}
+
+	var request ChangePasswordRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderAccountError(context, accountService, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := accountService.ChangePassword(userID, request.CurrentPassword, request.Password)
+	if err != nil {
+		if errors.Is(err, services.ErrWrongPassword) {
+			recordAudit(context, models.AuditEvent{
+				Action:   models.AuditPasswordChange,
+				Outcome:  models.AuditFailure,
+				TargetID: &userID,
+			})
+		}
+		renderAccountError(context, accountService, accountErrorStatus(err), err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditPasswordChange,
+		Outcome:        models.AuditSuccess,
+		TargetID:       &user.ID,
+		TargetUsername: user.Username,
+		Changes: services.AuditChanges(
+			map[string]interface{}{"password": services.Redacted},
+			map[string]interface{}{"password": services.Redacted, "session_version": user.SessionVersion},
+		),
+	})
+
+	// The session version already ends the other sessions; revoking them
+	// also removes them from the active sessions
+	if sessionService := middlewares.GetSessionService(context); sessionService != nil {
+		if _, err := sessionService.RevokeSessions(user.ID, currentSessionID(context)); err != nil {
+			log.Printf("Failed to revoke the other sessions of user %d: %v", user.ID, err)
+		}
+	}
+	renewSession(context, user, "password")
+}
+
+// ChangeUsername handles the HTTP POST request changing the username of the
+// authenticated user.
+//
+// It binds the new username from the form or JSON body, renames the user
+// using the provided accountService and records it in the audit log. Links
+// to the old username redirect to the new one. The session gets a new
+// cookie with the new username, and JSON clients a new token; forms are
+// redirected back to the account page.
+//
+// If the username breaks the policy, is taken or is unchanged, it responds
+// with HTTP status 400 and the field-level errors. Personal access tokens
+// get HTTP status 403.
+func ChangeUsername(context *gin.Context, accountService services.AccountServiceInterface) {
+	userID, ok := sessionUserID(context)
+	if !ok {
+		return
+	}
+
+	var request ChangeUsernameRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderAccountError(context, accountService, http.StatusBadRequest, err)
+		return
+	}
+
+	user, previousUsername, err := accountService.ChangeUsername(userID, request.Username)
+	if err != nil {
+		renderAccountError(context, accountService, accountErrorStatus(err), err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditUsernameChange,
+		Outcome:        models.AuditSuccess,
+		ActorUsername:  user.Username,
+		TargetID:       &user.ID,
+		TargetUsername: user.Username,
+		Changes: services.AuditChanges(
+			map[string]interface{}{"username": previousUsername},
+			map[string]interface{}{"username": user.Username},
+		),
+	})
+	renewSession(context, user, "username")
+}
+
+// UserProfile handles the HTTP GET request for the profile page of a user.
+//
+// It renders the profile.html template with the public attributes of the
+// user with the username in the path, or responds with them as JSON. A
+// username the user has since changed redirects to their current one with
+// HTTP status 301. Unknown usernames get HTTP status 404.
+func UserProfile(context *gin.Context, accountService services.AccountServiceInterface) {
+	user, renamed, err := accountService.ResolveUsername(context.Param("username"))
+	if err != nil {
+		status := http.StatusNotFound
+		if !errors.Is(err, services.ErrUsernameUnknown) {
+			log.Printf("Failed to resolve a username: %v", err)
+			status, err = http.StatusInternalServerError, errors.New("Failed to load the profile")
+		}
+		renderFormError(context, status, "error.html", nil, err)
+		return
+	}
+	if renamed {
+		context.Redirect(http.StatusMovedPermanently, usersPath+url.PathEscape(user.Username))
+		return
+	}
+
+	profile := gin.H{"id": user.ID, "username": user.Username, "display_name": user.DisplayName}
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"user": profile})
+		return
+	}
+	context.HTML(http.StatusOK, "profile.html", gin.H{"user": user})
+}
+
+// sessionUserID returns the ID of the user of a browser or JWT session.
+// Personal access tokens, service accounts and device sessions get an error
+// response with HTTP status 403, so a leaked token cannot take over the
+// account.
+func sessionUserID(context *gin.Context) (uint, bool) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return 0, false
+	}
+	if claims := middlewares.GetClaims(context); claims.IsScoped() {
+		renderFormError(context, http.StatusForbidden, "error.html", nil,
+			errors.New("Access tokens, service accounts and devices cannot change the password or username"))
+		return 0, false
+	}
+	return userID, true
+}
+
+// renewSession issues a new token for the current session after a change to
+// the account of the user, setting the cookie and returning the token to JSON clients, or
+// redirecting back to the account page with the name of the change
+func renewSession(context *gin.Context, user *models.User, change string) {
+	token, err := renewSessionToken(context, user)
+	if err != nil {
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Could not generate token"))
+		return
+	}
+	context.SetCookie("Authorization", token, 3600, "/", "localhost", false, true)
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"token": token, "user": user})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, accountPath+"?updated="+change)
+}
+
+// renderAccount renders the account page of the authenticated user, with
+// the given extra values and its recent logins, or responds with the
+// account as JSON
+func renderAccount(context *gin.Context, accountService services.AccountServiceInterface, status int, values gin.H) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return
+	}
+	user, err := accountService.GetAccount(userID)
+	if err == nil {
+		values["usernameChanges"], err = accountService.ListUsernameChanges(userID)
+	}
+	if err == nil {
+		values["logins"], err = recentLogins(context, userID)
+	}
+	if err == nil {
+		values["passkeys"], err = userPasskeys(context, userID)
+	}
+	if err != nil {
+		log.Printf("Failed to load the account of user %d: %v", userID, err)
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to load your account"))
+		return
+	}
+
+	if wantsJSON(context) {
+		context.JSON(status, gin.H{"user": user, "username_changes": values["usernameChanges"], "recent_logins": values["logins"],
+			"passkeys": values["passkeys"]})
+		return
+	}
+	values["user"] = user
+	values["passkeysEnabled"] = middlewares.GetWebAuthnService(context) != nil
+	context.HTML(status, "account.html", values)
+}
+
+// renderAccountError responds to an account request that failed, showing
+// the error above the account page. Errors not meant for the user are
+// logged and replaced by a generic message.
+func renderAccountError(context *gin.Context, accountService services.AccountServiceInterface, status int, err error) {
+	if status == http.StatusInternalServerError {
+		log.Printf("Account request failed: %v", err)
+		err = errors.New("Failed to update your account")
+	}
+	if wantsJSON(context) {
+		renderFormError(context, status, "account.html", nil, err)
+		return
+	}
+
+	values := gin.H{"error": err.Error()}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		validationErr = policyFieldErrors(err)
+	}
+	if validationErr != nil {
+		values["error"] = "Please correct the highlighted fields"
+		values["fieldErrors"] = validationErr.ByField()
+	}
+	renderAccount(context, accountService, status, values)
+}
+
+// accountNotice returns the message confirming a change to the account
+// page, given the change named in its query
+func accountNotice(change string) string {
+	switch change {
+	case "profile":
+		return "Your profile was updated."
+	case "password":
+		return "Your password was changed. Your other sessions were logged out."
+	case "username":
+		return "Your username was changed. Links to your old username redirect to the new one."
+	case "passkey":
+		return "Your passkey was added. You can now log in with it, and will be asked for it after your password."
+	case "passkey-removed":
+		return "Your passkey was removed."
+	default:
+		return ""
+	}
+}
+
+// profileAuditState returns the audited fields of a profile, for
+// AuditChanges
+func profileAuditState(profile services.Profile) map[string]interface{} {
+	return map[string]interface{}{
+		"display_name": profile.DisplayName,
+		"given_name":   profile.GivenName,
+		"family_name":  profile.FamilyName,
+		"email":        profile.Email,
+	}
+}
+
+// accountErrorStatus returns the HTTP status for an error returned by the
+// AccountService
+func accountErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrWrongPassword):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrSamePassword), errors.Is(err, services.ErrSameUsername),
+		errors.Is(err, services.ErrProfileTooLong), errors.Is(err, services.ErrInvalidEmail):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	default:
+		return registrationErrorStatus(err)
+	}
+}
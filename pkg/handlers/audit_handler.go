@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"time"
+)
+
+// auditPageSize is the number of events shown by the audit view
+const auditPageSize = 100
+
+// RegisterAuditRoutes registers the routes of the admin audit view.
+//
+// The routes are only available to authenticated users with the admin role:
+// they are protected by the middleware.AuthMiddleware and
+// middleware.RequireRole functions. Personal access tokens need the
+// audit:read scope, and the audit:export scope to export the whole log. The
+// auditService parameter is used by the handlers to read and verify the audit
+// log.
+func RegisterAuditRoutes(r *gin.Engine, auditService services.AuditServiceInterface) {
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middlewares.AuthMiddleware(), middlewares.RequireRole(models.RoleAdmin), middlewares.RequireScope(models.ScopeAuditRead))
+	{
+		admin.GET("/audit", func(c *gin.Context) { ListAuditEvents(c, auditService) })
+		admin.GET("/audit/export", middlewares.RequireScope(models.ScopeAuditExport), func(c *gin.Context) { ExportAuditEvents(c, auditService) })
+	}
+}
+
+// ListAuditEvents handles the HTTP GET request for the audit view.
+//
+// It binds the filter from the query string (action, outcome, actor, target,
+// since, until and offset), fetches the matching events using the provided
+// auditService and checks the hash chain. It renders the audit.html template,
+// or responds with the events and the verification as JSON.
+//
+// If the filter is invalid, it responds with HTTP status 400. If the events
+// cannot be loaded, it responds with HTTP status 500 and an error message.
+func ListAuditEvents(context *gin.Context, auditService services.AuditServiceInterface) {
+	filter, err := bindAuditFilter(context)
+	if err != nil {
+		renderFormError(context, http.StatusBadRequest, "error.html", nil, err)
+		return
+	}
+	filter.Limit = auditPageSize
+
+	// Fetch the events and check the chain
+	events, err := auditService.ListEvents(filter)
+	if err != nil {
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to load audit events"))
+		return
+	}
+	verification, err := auditService.VerifyChain()
+	if err != nil {
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to verify audit events"))
+		return
+	}
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"events": events, "verification": verification})
+		return
+	}
+
+	// Link to the next page, keeping the filter
+	nextPage := ""
+	if len(events) == auditPageSize {
+		query := context.Request.URL.Query()
+		query.Set("offset", fmt.Sprint(filter.Offset+auditPageSize))
+		nextPage = "?" + query.Encode()
+	}
+
+	context.HTML(http.StatusOK, "audit.html", gin.H{
+		"events":       events,
+		"verification": verification,
+		"filter":       context.Request.URL.Query(),
+		"actions": []string{
+			models.AuditLogin, models.AuditRegister, models.AuditUserCreate, models.AuditUserUpdate,
+			models.AuditPasswordChange, models.AuditRoleChange, models.AuditUserDelete,
+			models.AuditGroupCreate, models.AuditGroupUpdate, models.AuditGroupDelete,
+			models.AuditTokenCreate, models.AuditTokenRevoke, models.AuditClientCreate, models.AuditConsentGrant,
+			models.AuditIdentityLink, models.AuditOrgCreate, models.AuditOrgMemberAdd, models.AuditOrgRoleChange,
+			models.AuditOrgMemberDrop, models.AuditInviteCreate, models.AuditInviteResend, models.AuditInviteRevoke,
+			models.AuditInviteAccept, models.AuditEmailVerify, models.AuditSignupApprove, models.AuditSignupReject,
+			models.AuditUserSuspend, models.AuditUserReactivate, models.AuditStatusChange,
+			models.AuditUsernameChange, models.AuditSessionRevoke, models.AuditPasskeyAdd, models.AuditPasskeyRemove,
+			models.AuditPermissionAdd, models.AuditImpersonate, models.AuditImpersonateEnd, models.AuditImpersonatedRequest,
+		},
+		"nextPage": nextPage,
+	})
+}
+
+// ExportAuditEvents handles the HTTP GET request for the audit export.
+//
+// It binds the same filter as ListAuditEvents, without a page size, and sends
+// the matching events together with the chain verification as a JSON file
+// attachment.
+//
+// If the filter is invalid, it responds with HTTP status 400. If the events
+// cannot be loaded, it responds with HTTP status 500 and an error message.
+func ExportAuditEvents(context *gin.Context, auditService services.AuditServiceInterface) {
+	filter, err := bindAuditFilter(context)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.Limit, filter.Offset = 0, 0
+
+	events, err := auditService.ListEvents(filter)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load audit events"})
+		return
+	}
+	verification, err := auditService.VerifyChain()
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify audit events"})
+		return
+	}
+
+	filename := fmt.Sprintf("audit-%s.json", time.Now().UTC().Format("20060102T150405Z"))
+	context.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	context.JSON(http.StatusOK, gin.H{
+		"exported_at":  time.Now().UTC(),
+		"verification": verification,
+		"events":       events,
+	})
+}
+
+// bindAuditFilter binds the audit filter from the query string. The until
+// date is inclusive, so the whole day is selected.
+func bindAuditFilter(context *gin.Context) (models.AuditFilter, error) {
+	var filter models.AuditFilter
+	if err := context.ShouldBindQuery(&filter); err != nil {
+		return filter, errors.New("invalid filter: dates must be formatted as YYYY-MM-DD")
+	}
+	if !filter.Until.IsZero() {
+		filter.Until = filter.Until.AddDate(0, 0, 1)
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return filter, nil
+}
+
+// recordAudit records an audit event for the current request.
+//
+// The IP, user agent and request ID are taken from the request, and the
+// actor from the claims unless the event already names one. During an
+// impersonation, the actor is the admin. Nothing is
+// recorded when auditing is not set up; failures are logged, since an
+// action that already happened cannot be undone.
+func recordAudit(context *gin.Context, event models.AuditEvent) {
+	auditService := middlewares.GetAuditService(context)
+	if auditService == nil {
+		return
+	}
+
+	event.IP = context.ClientIP()
+	event.UserAgent = context.Request.UserAgent()
+	event.RequestID = context.GetString(middlewares.RequestIDKey)
+
+	if event.ActorUsername == "" {
+		if claims := middlewares.GetClaims(context); claims != nil {
+			if actor := claims.Actor; actor != nil {
+				id := actor.UserID()
+				event.ActorID, event.ActorUsername = &id, actor.Username
+			} else {
+				event.ActorUsername = claims.Username
+				if id, ok := currentUserID(context); ok {
+					event.ActorID = &id
+				}
+			}
+		}
+	}
+
+	if err := auditService.Record(event); err != nil {
+		log.Printf("Failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+// userRef returns the ID of a user for an audit event, or nil
+func userRef(user *models.User) *uint {
+	if user == nil {
+		return nil
+	}
+	id := user.ID
+	return &id
+}
+
+// currentUserID returns the ID of the authenticated user
+func currentUserID(context *gin.Context) (uint, bool) {
+	claims := middlewares.GetClaims(context)
+	if claims == nil {
+		return 0, false
+	}
+	userID := claims.UserID()
+	return userID, userID != 0
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+// externalLoginCookie holds the state of a login with an external provider
+// while the user is away
+const externalLoginCookie = "external_login"
+
+// externalLoginPath is the path the login and callback routes live under
+const externalLoginPath = "/api/v1/user/login/"
+
+// loginProviders are the external providers offered on the login form. They
+// are set by RegisterExternalLoginRoutes.
+var loginProviders []services.ExternalProvider
+
+// RegisterExternalLoginRoutes registers the routes for logging in with
+// external OpenID Connect providers, and adds a button for each provider to
+// the login form.
+//
+// The externalLoginService parameter is used by the handlers to send the
+// user to the provider and to resolve the account they come back with.
+func RegisterExternalLoginRoutes(r *gin.Engine, externalLoginService services.ExternalLoginServiceInterface) {
+	loginProviders = externalLoginService.Providers()
+
+	login := r.Group(externalLoginPath)
+	{
+		login.GET("/:provider", func(c *gin.Context) { BeginExternalLogin(c, externalLoginService) })
+		login.GET("/:provider/callback", func(c *gin.Context) { CompleteExternalLogin(c, externalLoginService) })
+	}
+}
+
+// BeginExternalLogin handles the HTTP GET request of a "Sign in with"
+// button.
+//
+// It starts the login using the provided externalLoginService, keeps its
+// state in a cookie and redirects the user to the provider. The local page
+// in the "next" query parameter is restored after the login. If the
+// provider is unknown, it responds with HTTP status 404; if it cannot be
+// reached, with HTTP status 502.
+func BeginExternalLogin(context *gin.Context, externalLoginService services.ExternalLoginServiceInterface) {
+	authURL, state, err := externalLoginService.BeginLogin(context.Param("provider"), localRedirectPath(context.Query("next")))
+	switch {
+	case errors.Is(err, services.ErrUnknownProvider):
+		context.HTML(http.StatusNotFound, "error.html", gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("External login failed to start: %v", err)
+		context.HTML(http.StatusBadGateway, "error.html", gin.H{"error": "The identity provider is unavailable, please try again later"})
+		return
+	}
+
+	// The provider redirects back with a top-level GET, which Lax cookies
+	// survive
+	context.SetSameSite(http.SameSiteLaxMode)
+	context.SetCookie(externalLoginCookie, state, 600, externalLoginPath, "", false, true)
+	context.Redirect(http.StatusFound, authURL)
+}
+
+// CompleteExternalLogin handles the HTTP GET request of the provider
+// redirecting the user back.
+//
+// It completes the login using the provided externalLoginService, records
+// it in the audit log with the user creation or account linking it caused,
+// asks users with a passkey to confirm with it like LoginUser does, sets
+// the session cookie and redirects to the page the login started from, or
+// to /home.
+//
+// Errors are shown on the login form: HTTP status 400 when the state does
+// not match this browser, 403 when the account may not log in, 409 when a
+// new user cannot take its username and 502 when the provider failed.
+func CompleteExternalLogin(context *gin.Context, externalLoginService services.ExternalLoginServiceInterface) {
+	providerID := context.Param("provider")
+	state, _ := context.Cookie(externalLoginCookie)
+	context.SetCookie(externalLoginCookie, "", -1, externalLoginPath, "", false, true)
+
+	if providerError := context.Query("error"); providerError != "" {
+		recordExternalLogin(context, providerID, nil, models.AuditFailure, providerError)
+		context.HTML(http.StatusUnauthorized, "login.html", loginPageValues(gin.H{"error": "The identity provider did not sign you in (" + providerError + ")"}))
+		return
+	}
+
+	login, err := externalLoginService.CompleteLogin(providerID, state, context.Query("state"), context.Query("code"))
+	if err != nil {
+		status, message := externalLoginErrorStatus(err)
+		if status == http.StatusBadGateway {
+			log.Printf("External login with %s failed: %v", providerID, err)
+		}
+		recordExternalLogin(context, providerID, nil, models.AuditFailure, err.Error())
+		context.HTML(status, "login.html", loginPageValues(gin.H{"error": message}))
+		return
+	}
+
+	user := login.User
+	switch {
+	case login.Created:
+		changes := services.UserAuditState(user)
+		changes["provider"] = providerID
+		recordAudit(context, models.AuditEvent{
+			Action:         models.AuditRegister,
+			Outcome:        models.AuditSuccess,
+			ActorID:        &user.ID,
+			ActorUsername:  user.Username,
+			TargetID:       &user.ID,
+			TargetUsername: user.Username,
+			Changes:        services.AuditChanges(nil, changes),
+		})
+	case login.Linked:
+		recordAudit(context, models.AuditEvent{
+			Action:         models.AuditIdentityLink,
+			Outcome:        models.AuditSuccess,
+			ActorID:        &user.ID,
+			ActorUsername:  user.Username,
+			TargetID:       &user.ID,
+			TargetUsername: user.Username,
+			Changes:        services.AuditChanges(nil, map[string]interface{}{"provider": providerID, "email": login.Identity.Email}),
+		})
+	}
+
+	// Users with a passkey confirm the login with it, as after a password
+	if beginSecondFactor(context, user, login.Next) {
+		return
+	}
+
+	token, err := startSession(context, user)
+	if err != nil {
+		context.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Could not generate token"})
+		return
+	}
+	context.SetCookie("Authorization", token, 3600, "/", "localhost", false, true)
+	recordExternalLogin(context, providerID, user, models.AuditSuccess, "")
+
+	next := login.Next
+	if next == "" {
+		next = "/api/v1/user/home"
+	}
+	context.Redirect(http.StatusSeeOther, next)
+}
+
+// externalLoginErrorStatus returns the HTTP status and the message shown
+// for an error returned by ExternalLoginService.CompleteLogin
+func externalLoginErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrUnknownProvider):
+		return http.StatusNotFound, err.Error()
+	case errors.Is(err, services.ErrExternalLoginState):
+		return http.StatusBadRequest, "The sign-in has expired or was started in another browser, please try again"
+	case errors.Is(err, services.ErrIdentityNotLinked), errors.Is(err, services.ErrIdentityDomain),
+		errors.Is(err, services.ErrIdentityLink), errors.Is(err, services.ErrUserDeactivated):
+		return http.StatusForbidden, "Your account is not allowed to sign in here: " + err.Error()
+	case errors.Is(err, services.ErrUserExists), errors.Is(err, services.ErrUsernameConfusable), policyFieldErrors(err) != nil:
+		return http.StatusConflict, "An account cannot be created for you: " + err.Error() + ". Please contact an admin."
+	default:
+		return http.StatusBadGateway, "The sign-in with the identity provider failed, please try again"
+	}
+}
+
+// recordExternalLogin records a login attempt through a provider. The user
+// is nil when the login failed.
+func recordExternalLogin(context *gin.Context, providerID string, user *models.User, outcome, reason string) {
+	event := models.AuditEvent{
+		Action:  models.AuditLogin,
+		Outcome: outcome,
+		ActorID: userRef(user),
+	}
+	if user != nil {
+		event.ActorUsername = user.Username
+		event.TargetID = &user.ID
+		event.TargetUsername = user.Username
+	}
+	changes := map[string]interface{}{"provider": providerID}
+	if reason != "" {
+		changes["reason"] = reason
+	}
+	event.Changes = services.AuditChanges(nil, changes)
+	recordAudit(context, event)
+}
+
+// loginPageValues adds the external providers, and whether magic links and
+// passkeys are offered, to the values of the login form
+func loginPageValues(values gin.H) gin.H {
+	values["providers"] = loginProviders
+	values["magicLink"] = magicLinkEnabled
+	values["passkeys"] = passkeysEnabled
+	return values
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// RegisterImpersonationRoutes registers the routes for starting and
+// stopping impersonations.
+//
+// Only authenticated admins granted the impersonate permission can start
+// one, from a browser session: personal access tokens cannot.
+// Impersonations cannot be nested. The impersonationService parameter is
+// used by the handlers to check who may impersonate whom.
+func RegisterImpersonationRoutes(r *gin.Engine, impersonationService services.ImpersonationServiceInterface) {
+	r.POST("/api/v1/admin/users/:id/impersonate", middlewares.AuthMiddleware(), middlewares.RequireRole(models.RoleAdmin),
+		middlewares.RequireScope(models.ScopeUsersWrite), middlewares.DenyImpersonation(),
+		func(c *gin.Context) { StartImpersonation(c, impersonationService) })
+	r.POST(middlewares.ImpersonationStopPath, middlewares.AuthMiddleware(),
+		func(c *gin.Context) { StopImpersonation(c, impersonationService) })
+}
+
+// StartImpersonation handles the HTTP POST request starting to impersonate
+// a user.
+//
+// It binds the reason from the form or JSON body, checks with the provided
+// impersonationService that the admin may impersonate the user with the ID
+// in the path, and logs the admin in as them. Their token carries the admin
+// in its "act" claim, so every request is attributed to the admin, and
+// expires after services.ImpersonationLifetime. The start, with its reason, is recorded
+// in the audit log, and so are refused attempts. JSON clients get the token
+// and the user; forms are redirected to the home page of the user.
+//
+// If the reason is missing or too long, it responds with HTTP status 400.
+// Admins who may not impersonate, or who try to impersonate themselves,
+// another admin or a user who cannot log in, get HTTP status 403, and
+// unknown users HTTP status 404.
+func StartImpersonation(context *gin.Context, impersonationService services.ImpersonationServiceInterface) {
+	adminID, ok := sessionUserID(context)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err != nil {
+		renderFormError(context, http.StatusNotFound, "error.html", nil, services.ErrUserNotFound)
+		return
+	}
+
+	var request ImpersonationRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderFormError(context, http.StatusBadRequest, "error.html", nil, err)
+		return
+	}
+
+	admin, user, err := impersonationService.StartImpersonation(adminID, uint(userID))
+	if err != nil {
+		code := impersonationErrorStatus(err)
+		if code == http.StatusInternalServerError {
+			log.Printf("Failed to impersonate user %d: %v", userID, err)
+			err = errors.New("Failed to impersonate the user")
+		}
+		if code == http.StatusForbidden {
+			event := models.AuditEvent{
+				Action:  models.AuditImpersonate,
+				Outcome: models.AuditFailure,
+				Changes: services.AuditChanges(nil, map[string]interface{}{"reason": request.Reason, "error": err.Error()}),
+			}
+			if user != nil {
+				event.TargetID, event.TargetUsername = &user.ID, user.Username
+			}
+			recordAudit(context, event)
+		}
+		renderFormError(context, code, "error.html", nil, err)
+		return
+	}
+
+	token, err := issueToken(context, services.NewImpersonationClaims(user, &models.Actor{
+		Subject:        strconv.FormatUint(uint64(admin.ID), 10),
+		Username:       admin.Username,
+		SessionID:      currentSessionID(context),
+		SessionVersion: admin.SessionVersion,
+	}))
+	if err != nil {
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Could not generate token"))
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditImpersonate,
+		Outcome:        models.AuditSuccess,
+		TargetID:       &user.ID,
+		TargetUsername: user.Username,
+		Changes:        services.AuditChanges(nil, map[string]interface{}{"reason": request.Reason}),
+	})
+
+	context.SetCookie("Authorization", token, 3600, "/", "localhost", false, true)
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"token": token, "user": user})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, "/api/v1/user/home")
+}
+
+// StopImpersonation handles the HTTP POST request stopping an
+// impersonation, sent by the button of the banner.
+//
+// It logs the admin back in to the session they started the impersonation
+// from, using the provided impersonationService to load them, and records
+// the end in the audit log. JSON clients get the token and the admin; forms
+// are redirected to the home page.
+//
+// If the request is not an impersonation, it responds with HTTP status 400.
+// If the admin can no longer log in, the session is ended and it responds
+// with HTTP status 401.
+func StopImpersonation(context *gin.Context, impersonationService services.ImpersonationServiceInterface) {
+	claims := middlewares.GetClaims(context)
+	if claims == nil || claims.Actor == nil {
+		renderFormError(context, http.StatusBadRequest, "error.html", nil, errors.New("You are not impersonating anyone"))
+		return
+	}
+
+	actor := claims.Actor
+	admin, err := impersonationService.StopImpersonation(actor.UserID())
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) || errors.Is(err, services.ErrImpersonationNotAllowed) {
+			context.SetCookie("Authorization", "", -1, "/", "localhost", false, true)
+			renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Your session has expired, please log in again"))
+			return
+		}
+		log.Printf("Failed to stop the impersonation of admin %d: %v", actor.UserID(), err)
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to stop impersonating"))
+		return
+	}
+
+	token, err := issueToken(context, services.NewSessionClaims(admin, actor.SessionID))
+	if err != nil {
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Could not generate token"))
+		return
+	}
+
+	userID := claims.UserID()
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditImpersonateEnd,
+		Outcome:        models.AuditSuccess,
+		TargetID:       &userID,
+		TargetUsername: claims.Username,
+	})
+
+	context.SetCookie("Authorization", token, 3600, "/", "localhost", false, true)
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"token": token, "user": admin})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, "/api/v1/user/home")
+}
+
+// impersonationErrorStatus returns the HTTP status for an error returned by
+// the ImpersonationService
+func impersonationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrImpersonationNotAllowed), errors.Is(err, services.ErrImpersonationTarget):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
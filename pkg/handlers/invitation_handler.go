@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// invitationsPath is the page listing the invitations of the active
+// organization
+const invitationsPath = "/api/v1/admin/invitations"
+
+// RegisterInvitationRoutes registers the routes for inviting users and
+// accepting invitations.
+//
+// The admin routes are only available to authenticated users with the
+// admin role, and personal access tokens need the users:write scope. They
+// manage the invitations of the organization the request acts in. The
+// accept page is public: the token in its path is the credential. The
+// invitationService parameter is used by the handlers to send, list,
+// resend, revoke and accept invitations.
+func RegisterInvitationRoutes(r *gin.Engine, invitationService services.InvitationServiceInterface) {
+	admin := r.Group(invitationsPath)
+	admin.Use(middlewares.AuthMiddleware(), middlewares.RequireRole(models.RoleAdmin), middlewares.RequireScope(models.ScopeUsersWrite))
+	{
+		admin.GET("", func(c *gin.Context) { ListInvitations(c, invitationService) })
+		admin.POST("", func(c *gin.Context) { CreateInvitation(c, invitationService) })
+		admin.POST("/:id/resend", func(c *gin.Context) { ResendInvitation(c, invitationService) })
+		admin.POST("/:id/revoke", func(c *gin.Context) { RevokeInvitation(c, invitationService) })
+		admin.DELETE("/:id", func(c *gin.Context) { RevokeInvitation(c, invitationService) })
+	}
+
+	accept := r.Group(services.InvitationPath)
+	{
+		accept.GET("/:token", func(c *gin.Context) { InvitationForm(c, invitationService) })
+		accept.POST("/:token", func(c *gin.Context) { AcceptInvitation(c, invitationService) })
+	}
+}
+
+// ListInvitations handles the HTTP GET request for the invitation list.
+//
+// It renders the invitations.html template with the invitations of the
+// active organization and their status, or responds with them as JSON.
+//
+// If they cannot be loaded, it responds with HTTP status 500 and an error
+// message.
+func ListInvitations(context *gin.Context, invitationService services.InvitationServiceInterface) {
+	renderInvitations(context, invitationService, http.StatusOK, gin.H{})
+}
+
+// CreateInvitation handles the HTTP POST request for inviting someone.
+//
+// It binds the email address and the roles from the form or JSON body,
+// sends the invitation using the provided invitationService and records it
+// in the audit log. JSON clients get the invitation with HTTP status 201;
+// forms are redirected back to the invitation list. The token is only ever
+// sent to the invitee.
+//
+// If the request is invalid, it responds with HTTP status 400, and with
+// HTTP status 409 if the address already has a pending invitation. If the
+// invitation was saved but the email could not be sent, it responds with
+// HTTP status 502.
+func CreateInvitation(context *gin.Context, invitationService services.InvitationServiceInterface) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return
+	}
+
+	var request CreateInvitationRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderInvitationError(context, invitationService, http.StatusBadRequest, err)
+		return
+	}
+
+	invitation, err := invitationService.CreateInvitation(context.Request.Context(), userID, request.Email, request.Role, request.OrgRole)
+	if invitation == nil {
+		renderInvitationError(context, invitationService, invitationErrorStatus(err), err)
+		return
+	}
+	recordInvitation(context, models.AuditInviteCreate, invitation)
+	if err != nil {
+		renderInvitationError(context, invitationService, invitationErrorStatus(err), err)
+		return
+	}
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusCreated, gin.H{"invitation": invitation})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, invitationsPath)
+}
+
+// ResendInvitation handles the HTTP POST request for sending an invitation
+// again.
+//
+// It sends the invitation with the ID in the path with a new link and a new
+// expiry time, and records it in the audit log. Earlier links stop working.
+// JSON clients get the invitation; forms are redirected back to the
+// invitation list.
+//
+// Invitations of other organizations, and accepted or revoked ones, get
+// HTTP status 404.
+func ResendInvitation(context *gin.Context, invitationService services.InvitationServiceInterface) {
+	invitationID, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err != nil {
+		renderInvitationError(context, invitationService, http.StatusNotFound, services.ErrInvitationMissing)
+		return
+	}
+
+	invitation, err := invitationService.ResendInvitation(context.Request.Context(), uint(invitationID))
+	if invitation == nil {
+		renderInvitationError(context, invitationService, invitationErrorStatus(err), err)
+		return
+	}
+	recordInvitation(context, models.AuditInviteResend, invitation)
+	if err != nil {
+		renderInvitationError(context, invitationService, invitationErrorStatus(err), err)
+		return
+	}
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"invitation": invitation})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, invitationsPath)
+}
+
+// RevokeInvitation handles the HTTP POST and DELETE requests for revoking an
+// invitation.
+//
+// It revokes the invitation with the ID in the path, so its link stops
+// working, and records it in the audit log. JSON clients get HTTP status
+// 204; forms are redirected back to the invitation list.
+//
+// Invitations of other organizations, and accepted or revoked ones, get
+// HTTP status 404.
+func RevokeInvitation(context *gin.Context, invitationService services.InvitationServiceInterface) {
+	invitationID, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err != nil {
+		renderInvitationError(context, invitationService, http.StatusNotFound, services.ErrInvitationMissing)
+		return
+	}
+
+	invitation, err := invitationService.RevokeInvitation(context.Request.Context(), uint(invitationID))
+	if err != nil {
+		renderInvitationError(context, invitationService, invitationErrorStatus(err), err)
+		return
+	}
+	recordInvitation(context, models.AuditInviteRevoke, invitation)
+
+	if wantsJSON(context) {
+		context.Status(http.StatusNoContent)
+		return
+	}
+	context.Redirect(http.StatusSeeOther, invitationsPath)
+}
+
+// InvitationForm handles the HTTP GET request for the accept page.
+//
+// It renders the invitation.html template, asking the invitee for a
+// username and password, or responds with the invitation as JSON. Unknown,
+// accepted and revoked invitations get HTTP status 404, expired ones HTTP
+// status 410. While registration is disabled, it responds with HTTP status
+// 403.
+func InvitationForm(context *gin.Context, invitationService services.InvitationServiceInterface) {
+	if registrationDisabled(context) {
+		renderFormError(context, http.StatusForbidden, "error.html", nil, services.ErrRegistrationDisabled)
+		return
+	}
+
+	invitation, err := invitationService.GetPendingInvitation(context.Param("token"))
+	if err != nil {
+		renderFormError(context, invitationErrorStatus(err), "error.html", nil, err)
+		return
+	}
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"invitation": invitation, "organization": invitation.Organization})
+		return
+	}
+	context.HTML(http.StatusOK, "invitation.html", invitationPageValues(context, invitation, gin.H{}))
+}
+
+// AcceptInvitation handles the HTTP POST request accepting an invitation.
+//
+// It binds the username and password from the form or JSON body, creates
+// the account with the roles of the invitation using the provided
+// invitationService, records it in the audit log and logs the new user in.
+// Forms are redirected to the home page; JSON clients get the token and the
+// user with HTTP status 201.
+//
+// If the username or password breaks a policy or the username is taken, it
+// responds with HTTP status 400 and the field-level errors, and the
+// invitation can be used again. Unknown, accepted and revoked invitations
+// get HTTP status 404, expired ones HTTP status 410. While registration is
+// disabled, it responds with HTTP status 403.
+func AcceptInvitation(context *gin.Context, invitationService services.InvitationServiceInterface) {
+	if registrationDisabled(context) {
+		renderFormError(context, http.StatusForbidden, "error.html", nil, services.ErrRegistrationDisabled)
+		return
+	}
+
+	token := context.Param("token")
+	invitation, err := invitationService.GetPendingInvitation(token)
+	if err != nil {
+		renderFormError(context, invitationErrorStatus(err), "error.html", nil, err)
+		return
+	}
+
+	var request RegisterRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderFormError(context, http.StatusBadRequest, "invitation.html",
+			invitationPageValues(context, invitation, gin.H{"username": request.Username}), err)
+		return
+	}
+
+	user, invitation, err := invitationService.AcceptInvitation(token, request.Username, request.Password)
+	if err != nil {
+		status := invitationErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			status = registrationErrorStatus(err)
+		}
+		if status == http.StatusInternalServerError {
+			log.Printf("Failed to accept invitation: %v", err)
+			err = errors.New("Failed to create your account")
+		}
+		pending, _ := invitationService.GetPendingInvitation(token)
+		if pending == nil {
+			renderFormError(context, status, "error.html", nil, err)
+			return
+		}
+		renderFormError(context, status, "invitation.html",
+			invitationPageValues(context, pending, gin.H{"username": request.Username}), err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditInviteAccept,
+		Outcome:        models.AuditSuccess,
+		ActorID:        &user.ID,
+		ActorUsername:  user.Username,
+		TargetID:       &user.ID,
+		TargetUsername: user.Username,
+		Changes: services.AuditChanges(nil, map[string]interface{}{
+			"invitation_id":   invitation.ID,
+			"organization_id": invitation.OrganizationID,
+			"role":            invitation.Role,
+			"org_role":        invitation.OrgRole,
+		}),
+	})
+
+	sessionToken, err := startSession(context, user)
+	if err != nil {
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Could not generate token"))
+		return
+	}
+	context.SetCookie("Authorization", sessionToken, 3600, "/", "localhost", false, true)
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusCreated, gin.H{"token": sessionToken, "user": user})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, "/api/v1/user/home")
+}
+
+// renderInvitations renders the invitation list of the active organization,
+// with the given extra values, or responds with it as JSON
+func renderInvitations(context *gin.Context, invitationService services.InvitationServiceInterface, status int, values gin.H) {
+	invitations, err := invitationService.ListInvitations(context.Request.Context())
+	if err != nil {
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to load invitations"))
+		return
+	}
+
+	now := time.Now()
+	if wantsJSON(context) {
+		listed := make([]gin.H, len(invitations))
+		for i := range invitations {
+			listed[i] = gin.H{"invitation": invitations[i], "status": invitations[i].Status(now)}
+		}
+		context.JSON(status, gin.H{"invitations": listed})
+		return
+	}
+
+	values["invitations"] = invitations
+	values["organization"] = middlewares.CurrentMembership(context)
+	values["roles"] = []string{models.RoleUser, models.RoleAdmin}
+	values["orgRoles"] = models.OrganizationRoles
+	values["now"] = now
+	context.HTML(status, "invitations.html", values)
+}
+
+// renderInvitationError responds to an invitation request that failed,
+// showing the error above the invitation list on the HTML page. Errors not
+// meant for the user are logged and replaced by a generic message.
+func renderInvitationError(context *gin.Context, invitationService services.InvitationServiceInterface, status int, err error) {
+	if status == http.StatusInternalServerError {
+		log.Printf("Invitation request failed: %v", err)
+		err = errors.New("Failed to update the invitation")
+	}
+	if wantsJSON(context) {
+		renderFormError(context, status, "invitations.html", nil, err)
+		return
+	}
+
+	values := gin.H{"error": err.Error()}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		values["error"] = "Please correct the highlighted fields"
+		values["fieldErrors"] = validationErr.ByField()
+	}
+	renderInvitations(context, invitationService, status, values)
+}
+
+// invitationPageValues returns the values of the accept page of an
+// invitation, with the given extra values
+func invitationPageValues(context *gin.Context, invitation *models.Invitation, values gin.H) gin.H {
+	values["invitation"] = invitation
+	values["token"] = context.Param("token")
+	return values
+}
+
+// recordInvitation records a change to an invitation in the audit log. The
+// target is the invitee, who has no account yet, so their address is used.
+func recordInvitation(context *gin.Context, action string, invitation *models.Invitation) {
+	recordAudit(context, models.AuditEvent{
+		Action:         action,
+		Outcome:        models.AuditSuccess,
+		TargetUsername: invitation.Email,
+		Changes: services.AuditChanges(nil, map[string]interface{}{
+			"invitation_id":   invitation.ID,
+			"organization_id": invitation.OrganizationID,
+			"role":            invitation.Role,
+			"org_role":        invitation.OrgRole,
+			"expires_at":      invitation.ExpiresAt.UTC().Format(time.RFC3339),
+		}),
+	})
+}
+
+// invitationErrorStatus returns the HTTP status for an error returned by
+// the InvitationService
+func invitationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidEmail), errors.Is(err, services.ErrInvalidRole),
+		errors.Is(err, services.ErrInvalidOrganizationRole):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrNotMember):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrInvitationMissing), errors.Is(err, services.ErrInvitationInvalid):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvitationExists):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvitationExpired):
+		return http.StatusGone
+	case errors.Is(err, services.ErrInvitationNotSent):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Number of logins shown on the login history pages and the account page
+const (
+	loginHistoryLimit = 100
+	recentLoginsLimit = 5
+)
+
+// RegisterLoginHistoryRoutes registers the routes for viewing the login
+// history.
+//
+// Users view the logins to their own account, with the suspicious ones
+// flagged; personal access tokens need the users:read scope. Admins view
+// the login history of any user. The loginHistoryService parameter is used
+// by the handlers to list the logins.
+func RegisterLoginHistoryRoutes(r *gin.Engine, loginHistoryService services.LoginHistoryServiceInterface) {
+	r.GET(accountPath+"/logins", middlewares.AuthMiddleware(), middlewares.RequireScope(models.ScopeUsersRead), func(c *gin.Context) { ListLogins(c, loginHistoryService) })
+
+	admin := r.Group("/api/v1/admin/users")
+	admin.Use(middlewares.AuthMiddleware(), middlewares.RequireRole(models.RoleAdmin))
+	{
+		admin.GET("/:id/logins", middlewares.RequireScope(models.ScopeUsersRead), func(c *gin.Context) { ListUserLogins(c, loginHistoryService) })
+	}
+}
+
+// ListLogins handles the HTTP GET request for the login history of the
+// authenticated user.
+//
+// It renders the logins.html template, with the outcome, device, address,
+// location and suspicious signs of each recent login, or responds with the
+// logins as JSON.
+func ListLogins(context *gin.Context, loginHistoryService services.LoginHistoryServiceInterface) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return
+	}
+	renderLogins(context, loginHistoryService, userID, false)
+}
+
+// ListUserLogins handles the HTTP GET request for the login history of a
+// user, for admins.
+//
+// It renders the logins.html template with the recent logins of the user
+// with the ID in the path, or responds with them as JSON.
+func ListUserLogins(context *gin.Context, loginHistoryService services.LoginHistoryServiceInterface) {
+	userID, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err != nil {
+		renderFormError(context, http.StatusNotFound, "error.html", nil, services.ErrUserNotFound)
+		return
+	}
+	renderLogins(context, loginHistoryService, uint(userID), true)
+}
+
+// renderLogins renders the recent logins of a user, or responds with them
+// as JSON
+func renderLogins(context *gin.Context, loginHistoryService services.LoginHistoryServiceInterface, userID uint, admin bool) {
+	logins, err := loginHistoryService.ListLogins(userID, loginHistoryLimit)
+	if err != nil {
+		log.Printf("Failed to load the logins of user %d: %v", userID, err)
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to load the login history"))
+		return
+	}
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"logins": logins})
+		return
+	}
+	context.HTML(http.StatusOK, "logins.html", gin.H{
+		"logins": logins,
+		"admin":  admin,
+		"userID": userID,
+	})
+}
+
+// recentLogins returns the most recent logins of a user for the account
+// page, or nil when the login history is not recorded
+func recentLogins(context *gin.Context, userID uint) ([]models.LoginAttempt, error) {
+	loginHistoryService := middlewares.GetLoginHistoryService(context)
+	if loginHistoryService == nil {
+		return nil, nil
+	}
+	return loginHistoryService.ListLogins(userID, recentLoginsLimit)
+}
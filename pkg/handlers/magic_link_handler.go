@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+// Magic link routes, and the cookie binding the links to the browser they
+// were requested from
+const (
+	magicLinkPath   = "/api/v1/user/magic-link"
+	magicLinkCookie = "magic_link"
+	// magicLinkCookieAge outlives the links, in seconds
+	magicLinkCookieAge = 24 * 60 * 60
+)
+
+// magicLinkNotice is shown after a login link is requested, whether or not
+// an account matched, so the form does not reveal which accounts exist
+const magicLinkNotice = "If an account matches, we emailed it a login link. Open it in this browser: it works once and expires soon."
+
+// magicLinkEnabled tells the login form to offer magic links. It is set by
+// RegisterMagicLinkRoutes.
+var magicLinkEnabled bool
+
+// RegisterMagicLinkRoutes registers the routes for logging in with a link
+// emailed to the user instead of a password, and adds a link to them on the
+// login form.
+//
+// The magicLinkService parameter is used by the handlers to send the links
+// and to log in with them. The routes are metered by the
+// middleware.RateLimitMiddleware function using the rateLimitService, so
+// the requests of an IP can be limited on top of the links sent to each
+// address.
+func RegisterMagicLinkRoutes(r *gin.Engine, magicLinkService services.MagicLinkServiceInterface, rateLimitService services.RateLimitServiceInterface) {
+	magicLinkEnabled = true
+
+	magicLink := r.Group(magicLinkPath)
+	magicLink.Use(middlewares.RateLimitMiddleware(rateLimitService))
+	{
+		magicLink.GET("", MagicLinkForm)
+		magicLink.POST("", func(c *gin.Context) { RequestMagicLink(c, magicLinkService) })
+		magicLink.GET("/verify", MagicLinkConfirm)
+		magicLink.POST("/verify", func(c *gin.Context) { MagicLinkLogin(c, magicLinkService) })
+	}
+}
+
+// MagicLinkForm handles the HTTP GET request for the form asking for a
+// login link. It renders the magic_link.html template.
+func MagicLinkForm(context *gin.Context) {
+	context.HTML(http.StatusOK, "magic_link.html", gin.H{})
+}
+
+// RequestMagicLink handles the HTTP POST request asking for a login link.
+//
+// It emails a link to the account with the username or email address
+// submitted, using the provided magicLinkService, and keeps the secret the
+// link is bound to in a cookie. The response is the same whether or not an
+// account matched: a notice on the form, or HTTP status 202 for JSON
+// clients.
+func RequestMagicLink(context *gin.Context, magicLinkService services.MagicLinkServiceInterface) {
+	var request MagicLinkRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderFormError(context, http.StatusBadRequest, "magic_link.html", gin.H{"identifier": request.Identifier}, err)
+		return
+	}
+
+	browserSecret, _ := context.Cookie(magicLinkCookie)
+	browserSecret, err := magicLinkService.RequestLink(request.Identifier, context.ClientIP(), browserSecret)
+	if err != nil {
+		log.Printf("Failed to send a login link: %v", err)
+		renderFormError(context, http.StatusInternalServerError, "magic_link.html", gin.H{"identifier": request.Identifier},
+			errors.New("Failed to send the login link, please try again later"))
+		return
+	}
+
+	// The link is opened from the email with a top-level GET, which Lax
+	// cookies survive
+	context.SetSameSite(http.SameSiteLaxMode)
+	context.SetCookie(magicLinkCookie, browserSecret, magicLinkCookieAge, magicLinkPath, "", false, true)
+	if wantsJSON(context) {
+		context.JSON(http.StatusAccepted, gin.H{"message": magicLinkNotice})
+		return
+	}
+	context.HTML(http.StatusOK, "magic_link.html", gin.H{"notice": magicLinkNotice})
+}
+
+// MagicLinkConfirm handles the HTTP GET request of a login link opened from
+// the email.
+//
+// It renders the magic_link.html template with a button logging in, so
+// mail scanners following the link do not use it up.
+func MagicLinkConfirm(context *gin.Context) {
+	context.HTML(http.StatusOK, "magic_link.html", gin.H{"token": context.Query("token")})
+}
+
+// MagicLinkLogin handles the HTTP POST request logging in with a login
+// link.
+//
+// It uses the link with the provided magicLinkService, asks users with a
+// passkey to confirm with it like LoginUser does, records the login, sets
+// the session cookie and redirects to /home; JSON clients get the token
+// and the user. It responds with HTTP status 400 if
+// the link is invalid, expired or used, and 403 if it was requested from
+// another browser or the account may not log in.
+func MagicLinkLogin(context *gin.Context, magicLinkService services.MagicLinkServiceInterface) {
+	var request MagicLinkLoginRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderFormError(context, http.StatusBadRequest, "magic_link.html", nil, err)
+		return
+	}
+
+	browserSecret, _ := context.Cookie(magicLinkCookie)
+	user, err := magicLinkService.ConsumeLink(request.Token, browserSecret)
+	switch {
+	case errors.Is(err, services.ErrMagicLinkInvalid):
+		renderFormError(context, http.StatusBadRequest, "magic_link.html", nil, err)
+		return
+	case errors.Is(err, services.ErrMagicLinkBrowser):
+		renderFormError(context, http.StatusForbidden, "magic_link.html", nil, err)
+		return
+	case err != nil && user != nil:
+		recordLogin(context, user.Username, user, models.AuditFailure)
+		renderFormError(context, http.StatusForbidden, "magic_link.html", nil, errors.New(accountStatusMessage(err)))
+		return
+	case err != nil:
+		log.Printf("Failed to log in with a login link: %v", err)
+		renderFormError(context, http.StatusInternalServerError, "magic_link.html", nil, errors.New("Failed to log in, please try again later"))
+		return
+	}
+
+	// The link is used up; users with a passkey still confirm the login
+	// with it, as after a password
+	context.SetCookie(magicLinkCookie, "", -1, magicLinkPath, "", false, true)
+	if beginSecondFactor(context, user, "") {
+		return
+	}
+
+	token, err := startSession(context, user) // Recorded in the active sessions
+	if err != nil {
+		context.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Could not generate token"})
+		return
+	}
+	context.SetCookie("Authorization", token, 3600, "/", "localhost", false, true)
+	recordLogin(context, user.Username, user, models.AuditSuccess)
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"token": token, "user": user})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, "/api/v1/user/home")
+}
@@ -0,0 +1,537 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RegisterOIDCRoutes registers the routes of the OpenID Connect provider.
+//
+// The discovery document, JWKS, token, userinfo and device authorization
+// endpoints are public. The authorization endpoint and the /device page,
+// where users approve the sign-in of a device, send anonymous users to the
+// login form and back. Clients are registered by admins on
+// /api/v1/admin/oauth/clients, protected by the middleware.AuthMiddleware
+// and middleware.RequireRole functions; personal access tokens need the
+// users:write scope. The oidcService parameter is used by the handlers to
+// run the flows.
+func RegisterOIDCRoutes(r *gin.Engine, oidcService services.OIDCServiceInterface) {
+	r.GET("/.well-known/openid-configuration", func(c *gin.Context) { OpenIDConfiguration(c, oidcService) })
+
+	oauth := r.Group("/oauth2")
+	{
+		oauth.GET("/jwks", func(c *gin.Context) { JWKS(c, oidcService) })
+		oauth.GET("/authorize", func(c *gin.Context) { Authorize(c, oidcService) })
+		oauth.POST("/authorize", func(c *gin.Context) { AuthorizeConsent(c, oidcService) })
+		oauth.POST("/token", func(c *gin.Context) { Token(c, oidcService) })
+		oauth.POST("/device_authorization", func(c *gin.Context) { DeviceAuthorization(c, oidcService) })
+		oauth.GET("/userinfo", func(c *gin.Context) { UserInfo(c, oidcService) })
+		oauth.POST("/userinfo", func(c *gin.Context) { UserInfo(c, oidcService) })
+	}
+
+	r.GET(services.DevicePath, func(c *gin.Context) { DevicePage(c, oidcService) })
+	r.POST(services.DevicePath, func(c *gin.Context) { DeviceDecision(c, oidcService) })
+
+	admin := r.Group("/api/v1/admin/oauth")
+	admin.Use(middlewares.AuthMiddleware(), middlewares.RequireRole(models.RoleAdmin), middlewares.RequireScope(models.ScopeUsersWrite))
+	{
+		admin.GET("/clients", func(c *gin.Context) { ListOAuthClients(c, oidcService) })
+		admin.POST("/clients", func(c *gin.Context) { CreateOAuthClient(c, oidcService) })
+	}
+}
+
+// OpenIDConfiguration handles the HTTP GET request for the discovery
+// document (OpenID Connect Discovery 1.0)
+func OpenIDConfiguration(context *gin.Context, oidcService services.OIDCServiceInterface) {
+	context.JSON(http.StatusOK, oidcService.Discovery())
+}
+
+// JWKS handles the HTTP GET request for the public keys that verify the ID
+// tokens
+func JWKS(context *gin.Context, oidcService services.OIDCServiceInterface) {
+	context.JSON(http.StatusOK, oidcService.JWKS())
+}
+
+// Authorize handles the HTTP GET request for the authorization endpoint.
+//
+// It validates the request of the client. Errors are shown to the user when
+// the client or redirect URI is unknown, and sent back to the client
+// otherwise. Users without a session, or whose session fails the checks of
+// middlewares.AuthMiddleware, are sent to the login form, which brings them
+// back here. If the user already allowed the requested scopes,
+// an authorization code is issued right away; otherwise the consent.html
+// template asks them. Admins impersonating the user cannot authorize
+// clients on their behalf.
+func Authorize(context *gin.Context, oidcService services.OIDCServiceInterface) {
+	var request services.AuthorizationRequest
+	_ = context.ShouldBindQuery(&request)
+
+	client, ok := validateAuthorization(context, oidcService, &request)
+	if !ok {
+		return
+	}
+
+	// Log in first, then come back
+	claims := middlewares.AuthenticatedSession(context)
+	if claims == nil {
+		context.Redirect(http.StatusFound, "/api/v1/user/login?next="+url.QueryEscape(context.Request.URL.RequestURI()))
+		return
+	}
+	if claims.Actor != nil {
+		context.HTML(http.StatusForbidden, "error.html", gin.H{"error": services.ErrImpersonating.Error()})
+		return
+	}
+	userID := claims.UserID()
+
+	needsConsent, err := oidcService.NeedsConsent(userID, &request)
+	if err != nil {
+		context.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Failed to load your consent"})
+		return
+	}
+	if needsConsent {
+		context.HTML(http.StatusOK, "consent.html", gin.H{
+			"client":       client,
+			"username":     claims.Username,
+			"scopes":       strings.Fields(request.Scope),
+			"request":      request,
+			"consentToken": oidcService.ConsentToken(userID, &request),
+		})
+		return
+	}
+
+	issueAuthorizationCode(context, oidcService, claims, &request)
+}
+
+// AuthorizeConsent handles the HTTP POST request of the consent form.
+//
+// It validates the request again, checks the session like
+// middlewares.AuthMiddleware, and the consent token binding the decision to
+// the user and the request. If the user allowed access, the
+// consent is recorded in the audit log and an authorization code is sent to
+// the client; otherwise the client receives an access_denied error.
+func AuthorizeConsent(context *gin.Context, oidcService services.OIDCServiceInterface) {
+	var request services.AuthorizationRequest
+	_ = context.ShouldBind(&request)
+
+	if _, ok := validateAuthorization(context, oidcService, &request); !ok {
+		return
+	}
+
+	claims := middlewares.AuthenticatedSession(context)
+	if claims == nil {
+		context.HTML(http.StatusUnauthorized, "error.html", gin.H{"error": "Your session has expired, please log in again"})
+		return
+	}
+	if claims.Actor != nil {
+		context.HTML(http.StatusForbidden, "error.html", gin.H{"error": services.ErrImpersonating.Error()})
+		return
+	}
+
+	if context.PostForm("decision") != "allow" {
+		redirectAuthorizationError(context, &request, &services.OAuthError{Code: "access_denied", Description: "the user denied access"})
+		return
+	}
+
+	if err := oidcService.GrantConsent(claims.UserID(), &request, context.PostForm("consent_token")); err != nil {
+		var oauthErr *services.OAuthError
+		if errors.As(err, &oauthErr) {
+			redirectAuthorizationError(context, &request, oauthErr)
+			return
+		}
+		context.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Failed to save your consent"})
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditConsentGrant,
+		Outcome:        models.AuditSuccess,
+		TargetUsername: request.ClientID,
+		Changes:        services.AuditChanges(nil, map[string]interface{}{"client_id": request.ClientID, "scope": request.Scope}),
+	})
+
+	issueAuthorizationCode(context, oidcService, claims, &request)
+}
+
+// Token handles the HTTP POST request for the token endpoint.
+//
+// Clients authenticate with HTTP Basic authentication or with client_id and
+// client_secret in the form. It responds with the tokens, or with an RFC
+// 6749 error: HTTP status 401 for invalid_client and 400 for the others,
+// including the authorization_pending and slow_down answers to devices.
+// Responses are never cached.
+func Token(context *gin.Context, oidcService services.OIDCServiceInterface) {
+	context.Header("Cache-Control", "no-store")
+	context.Header("Pragma", "no-cache")
+
+	var request services.TokenRequest
+	if err := context.ShouldBind(&request); err != nil {
+		context.JSON(http.StatusBadRequest, services.OAuthError{Code: "invalid_request", Description: "the request body is invalid"})
+		return
+	}
+
+	// Credentials sent with Basic authentication are form encoded
+	clientID, secret, basic := context.Request.BasicAuth()
+	if basic {
+		request.ClientID, _ = url.QueryUnescape(clientID)
+		request.ClientSecret, _ = url.QueryUnescape(secret)
+	}
+
+	var response *services.TokenResponse
+	var err error
+	if request.GrantType == services.DeviceCodeGrantType {
+		response, err = deviceToken(context, oidcService, &request)
+	} else {
+		response, err = oidcService.Exchange(&request)
+	}
+	if err != nil {
+		var oauthErr *services.OAuthError
+		if !errors.As(err, &oauthErr) {
+			log.Printf("Token request failed: %v", err)
+			context.JSON(http.StatusInternalServerError, services.OAuthError{Code: "server_error"})
+			return
+		}
+		status := http.StatusBadRequest
+		if oauthErr.Code == "invalid_client" {
+			status = http.StatusUnauthorized
+			if basic {
+				context.Header("WWW-Authenticate", `Basic realm="oauth2"`)
+			}
+		}
+		context.JSON(status, oauthErr)
+		return
+	}
+
+	context.JSON(http.StatusOK, response)
+}
+
+// deviceToken answers a device polling the token endpoint. Once the user
+// approved it, the device signs in to a session of the user, recorded in
+// the active sessions and the login history. Its token is issued like those
+// of browsers, but limited to the approved scope on the API, like a
+// personal access token.
+func deviceToken(context *gin.Context, oidcService services.OIDCServiceInterface, request *services.TokenRequest) (*services.TokenResponse, error) {
+	user, tokens, err := oidcService.PollDeviceAuthorization(request)
+	if err != nil {
+		return nil, err
+	}
+	sessionID, err := recordSession(context, user)
+	if err != nil {
+		return nil, err
+	}
+	tokens.AccessToken, err = issueToken(context, services.NewDeviceClaims(user, sessionID, request.ClientID, tokens.Scope))
+	if err != nil {
+		return nil, err
+	}
+	tokens.ExpiresIn = int(services.SessionLifetime.Seconds())
+	recordLogin(context, user.Username, user, models.AuditSuccess)
+	return tokens, nil
+}
+
+// DeviceAuthorization handles the HTTP POST request for the device
+// authorization endpoint (RFC 8628).
+//
+// Clients authenticate like on the token endpoint. It responds with the
+// device code the device polls the token endpoint with, and the user code
+// and /device page it shows the user, or with an RFC 6749 error.
+func DeviceAuthorization(context *gin.Context, oidcService services.OIDCServiceInterface) {
+	context.Header("Cache-Control", "no-store")
+
+	var request services.DeviceAuthorizationRequest
+	if err := context.ShouldBind(&request); err != nil {
+		context.JSON(http.StatusBadRequest, services.OAuthError{Code: "invalid_request", Description: "the request body is invalid"})
+		return
+	}
+	clientID, secret, basic := context.Request.BasicAuth()
+	if basic {
+		request.ClientID, _ = url.QueryUnescape(clientID)
+		request.ClientSecret, _ = url.QueryUnescape(secret)
+	}
+
+	response, err := oidcService.AuthorizeDevice(&request)
+	if err != nil {
+		var oauthErr *services.OAuthError
+		if !errors.As(err, &oauthErr) {
+			log.Printf("Device authorization request failed: %v", err)
+			context.JSON(http.StatusInternalServerError, services.OAuthError{Code: "server_error"})
+			return
+		}
+		status := http.StatusBadRequest
+		if oauthErr.Code == "invalid_client" {
+			status = http.StatusUnauthorized
+		}
+		context.JSON(status, oauthErr)
+		return
+	}
+
+	context.JSON(http.StatusOK, response)
+}
+
+// DevicePage handles the HTTP GET request for the /device page.
+//
+// Users without a session, or whose session fails the checks of
+// middlewares.AuthMiddleware, are sent to the login form, which brings them
+// back here. It renders the device.html template asking for the code shown
+// by the device or, once the user_code parameter holds a pending one, the
+// client asking to sign in and the scopes it asks for, with Allow and Deny
+// buttons. Admins
+// impersonating the user cannot approve devices on their behalf.
+func DevicePage(context *gin.Context, oidcService services.OIDCServiceInterface) {
+	claims := middlewares.AuthenticatedSession(context)
+	if claims == nil {
+		context.Redirect(http.StatusFound, "/api/v1/user/login?next="+url.QueryEscape(context.Request.URL.RequestURI()))
+		return
+	}
+	if claims.Actor != nil {
+		context.HTML(http.StatusForbidden, "error.html", gin.H{"error": services.ErrImpersonating.Error()})
+		return
+	}
+
+	userCode := strings.TrimSpace(context.Query("user_code"))
+	if userCode == "" {
+		context.HTML(http.StatusOK, "device.html", gin.H{})
+		return
+	}
+	authorization, client, err := oidcService.PendingDeviceAuthorization(claims.UserID(), userCode)
+	if err != nil {
+		renderDeviceError(context, userCode, err)
+		return
+	}
+	context.HTML(http.StatusOK, "device.html", gin.H{
+		"client":       client,
+		"scopes":       strings.Fields(authorization.Scope),
+		"username":     claims.Username,
+		"userCode":     userCode,
+		"consentToken": oidcService.DeviceConsentToken(claims.UserID(), userCode),
+	})
+}
+
+// DeviceDecision handles the HTTP POST request of the /device page.
+//
+// It checks the session like middlewares.AuthMiddleware and the consent
+// token binding the decision to the user and the code, approves or denies
+// the device and records it in the audit log. The device learns the
+// decision the next time it polls the token endpoint.
+func DeviceDecision(context *gin.Context, oidcService services.OIDCServiceInterface) {
+	claims := middlewares.AuthenticatedSession(context)
+	if claims == nil {
+		context.HTML(http.StatusUnauthorized, "error.html", gin.H{"error": "Your session has expired, please log in again"})
+		return
+	}
+	if claims.Actor != nil {
+		context.HTML(http.StatusForbidden, "error.html", gin.H{"error": services.ErrImpersonating.Error()})
+		return
+	}
+
+	userCode := context.PostForm("user_code")
+	allow := context.PostForm("decision") == "allow"
+	authorization, err := oidcService.DecideDeviceAuthorization(claims.UserID(), userCode, allow, context.PostForm("consent_token"))
+	if err != nil {
+		renderDeviceError(context, userCode, err)
+		return
+	}
+
+	outcome, notice := models.AuditFailure, "The device was denied access."
+	if allow {
+		outcome, notice = models.AuditSuccess, "The device is now connected to your account. You can return to it."
+	}
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditDeviceApprove,
+		Outcome:        outcome,
+		TargetUsername: authorization.ClientID,
+		Changes:        services.AuditChanges(nil, map[string]interface{}{"client_id": authorization.ClientID, "scope": authorization.Scope}),
+	})
+	context.HTML(http.StatusOK, "device.html", gin.H{"notice": notice})
+}
+
+// renderDeviceError shows an error of the /device page above the code form
+func renderDeviceError(context *gin.Context, userCode string, err error) {
+	switch {
+	case errors.Is(err, services.ErrDeviceCodeInvalid), errors.Is(err, services.ErrDeviceConsentFailed):
+		context.HTML(http.StatusBadRequest, "device.html", gin.H{"error": err.Error(), "userCode": userCode})
+	case errors.Is(err, services.ErrDeviceCodeAttempts):
+		context.HTML(http.StatusTooManyRequests, "device.html", gin.H{"error": err.Error()})
+	default:
+		log.Printf("Device authorization failed: %v", err)
+		context.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Failed to process the device sign-in"})
+	}
+}
+
+// UserInfo handles the HTTP GET and POST requests for the userinfo endpoint.
+//
+// It takes the access token from the Authorization header and responds
+// with the claims of its user. Invalid tokens get HTTP status 401.
+func UserInfo(context *gin.Context, oidcService services.OIDCServiceInterface) {
+	scheme, token, _ := strings.Cut(context.GetHeader("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		context.Header("WWW-Authenticate", `Bearer realm="oauth2"`)
+		context.JSON(http.StatusUnauthorized, services.OAuthError{Code: "invalid_token", Description: "an access token is required"})
+		return
+	}
+
+	info, err := oidcService.UserInfo(token)
+	if err != nil {
+		var oauthErr *services.OAuthError
+		if !errors.As(err, &oauthErr) {
+			log.Printf("Userinfo request failed: %v", err)
+			context.JSON(http.StatusInternalServerError, services.OAuthError{Code: "server_error"})
+			return
+		}
+		context.Header("WWW-Authenticate", `Bearer error="`+oauthErr.Code+`"`)
+		context.JSON(http.StatusUnauthorized, oauthErr)
+		return
+	}
+
+	context.JSON(http.StatusOK, info)
+}
+
+// ListOAuthClients handles the HTTP GET request for the client list.
+//
+// It fetches all clients using the provided oidcService and renders the
+// clients.html template, or responds with the clients as JSON.
+func ListOAuthClients(context *gin.Context, oidcService services.OIDCServiceInterface) {
+	renderOAuthClients(context, oidcService, http.StatusOK, gin.H{})
+}
+
+// CreateOAuthClient handles the HTTP POST request for registering a client.
+//
+// It binds the name, the redirect URIs (separated by spaces or new lines)
+// and whether the client is public, registers the client using the provided
+// oidcService and records it in the audit log. The client secret is shown
+// once: JSON clients receive it with HTTP status 201, and the clients.html
+// template displays it above the list. If the request is invalid, it
+// responds with HTTP status 400.
+func CreateOAuthClient(context *gin.Context, oidcService services.OIDCServiceInterface) {
+	var request CreateOAuthClientRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderOAuthClientError(context, oidcService, err)
+		return
+	}
+
+	adminID, _ := currentUserID(context)
+	secret, client, err := oidcService.RegisterClient(request.Name, strings.Fields(request.RedirectURIs), request.Public, adminID)
+	if err != nil {
+		renderOAuthClientError(context, oidcService, err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditClientCreate,
+		Outcome:        models.AuditSuccess,
+		TargetUsername: client.ClientID,
+		Changes: services.AuditChanges(nil, map[string]interface{}{
+			"name":          client.Name,
+			"redirect_uris": client.RedirectURIs,
+			"public":        client.Public,
+		}),
+	})
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusCreated, gin.H{"client": client, "client_secret": secret})
+		return
+	}
+	renderOAuthClients(context, oidcService, http.StatusCreated, gin.H{"newClient": client, "newSecret": secret})
+}
+
+// validateAuthorization validates an authorization request and reports
+// whether it can go on. Otherwise the error has been sent to the user or
+// the client.
+func validateAuthorization(context *gin.Context, oidcService services.OIDCServiceInterface, request *services.AuthorizationRequest) (*models.OAuthClient, bool) {
+	client, err := oidcService.ValidateAuthorizationRequest(request)
+	if err == nil {
+		return client, true
+	}
+
+	var oauthErr *services.OAuthError
+	switch {
+	case errors.Is(err, services.ErrOAuthUnknownClient), errors.Is(err, services.ErrOAuthRedirectURI):
+		context.HTML(http.StatusBadRequest, "error.html", gin.H{"error": "Invalid sign-in request: " + err.Error()})
+	case errors.As(err, &oauthErr):
+		redirectAuthorizationError(context, request, oauthErr)
+	default:
+		context.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Failed to process the sign-in request"})
+	}
+	return nil, false
+}
+
+// issueAuthorizationCode sends the user back to the client with a new
+// authorization code and the state of the request
+func issueAuthorizationCode(context *gin.Context, oidcService services.OIDCServiceInterface, claims *models.Claims, request *services.AuthorizationRequest) {
+	authTime := claims.IssuedAt
+	if authTime.IsZero() {
+		authTime = time.Now()
+	}
+
+	code, err := oidcService.CreateAuthorizationCode(claims.UserID(), authTime, request)
+	if err != nil {
+		context.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Failed to complete the sign-in"})
+		return
+	}
+	redirectToClient(context, request, url.Values{"code": {code}})
+}
+
+// redirectAuthorizationError sends an authorization error back to the client
+func redirectAuthorizationError(context *gin.Context, request *services.AuthorizationRequest, oauthErr *services.OAuthError) {
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	redirectToClient(context, request, params)
+}
+
+// redirectToClient redirects to the redirect URI of a validated request,
+// adding the parameters and the state to its query
+func redirectToClient(context *gin.Context, request *services.AuthorizationRequest, params url.Values) {
+	target, _ := url.Parse(request.RedirectURI)
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if request.State != "" {
+		query.Set("state", request.State)
+	}
+	target.RawQuery = query.Encode()
+	context.Redirect(http.StatusFound, target.String())
+}
+
+// renderOAuthClients renders the client list with the given extra values,
+// or responds with it as JSON
+func renderOAuthClients(context *gin.Context, oidcService services.OIDCServiceInterface, status int, values gin.H) {
+	clients, err := oidcService.ListClients()
+	if err != nil {
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to load clients"))
+		return
+	}
+
+	if wantsJSON(context) {
+		context.JSON(status, gin.H{"clients": clients})
+		return
+	}
+	values["clients"] = clients
+	context.HTML(status, "clients.html", values)
+}
+
+// renderOAuthClientError responds to a client registration that failed
+// with HTTP status 400, showing the error above the client list on the HTML
+// page
+func renderOAuthClientError(context *gin.Context, oidcService services.OIDCServiceInterface, err error) {
+	if wantsJSON(context) {
+		renderFormError(context, http.StatusBadRequest, "clients.html", nil, err)
+		return
+	}
+
+	values := gin.H{"error": err.Error()}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		values["error"] = "Please correct the highlighted fields"
+		values["fieldErrors"] = validationErr.ByField()
+	}
+	renderOAuthClients(context, oidcService, http.StatusBadRequest, values)
+}
@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// organizationsPath is the page listing the organizations of the user
+const organizationsPath = "/api/v1/user/orgs"
+
+// RegisterOrganizationRoutes registers the routes for switching and managing
+// organizations.
+//
+// The routes are protected by the middleware.AuthMiddleware function, and
+// personal access tokens can only change organizations when granted the
+// users:write scope. Only owners and admins of the active organization can
+// manage its members. The organizationService parameter is used by the
+// handlers to list, create and switch organizations and to manage members.
+func RegisterOrganizationRoutes(r *gin.Engine, organizationService services.OrganizationServiceInterface) {
+	orgs := r.Group(organizationsPath)
+	orgs.Use(middlewares.AuthMiddleware())
+	{
+		orgs.GET("", middlewares.RequireScope(models.ScopeUsersRead), func(c *gin.Context) { ListOrganizations(c, organizationService) })
+		orgs.POST("", middlewares.RequireScope(models.ScopeUsersWrite), func(c *gin.Context) { CreateOrganization(c, organizationService) })
+		orgs.POST("/switch", middlewares.RequireScope(models.ScopeUsersWrite), func(c *gin.Context) { SwitchOrganization(c, organizationService) })
+	}
+
+	members := orgs.Group("/members")
+	members.Use(middlewares.RequireScope(models.ScopeUsersWrite), middlewares.RequireOrganizationRole(models.OrgRoleOwner, models.OrgRoleAdmin))
+	{
+		members.POST("", func(c *gin.Context) { AddOrganizationMember(c, organizationService) })
+		members.POST("/:id/role", func(c *gin.Context) { SetOrganizationMemberRole(c, organizationService) })
+		members.POST("/:id/remove", func(c *gin.Context) { RemoveOrganizationMember(c, organizationService) })
+		members.DELETE("/:id", func(c *gin.Context) { RemoveOrganizationMember(c, organizationService) })
+	}
+}
+
+// ListOrganizations handles the HTTP GET request for the organization list.
+//
+// It renders the organizations.html template with the organizations of the
+// authenticated user, the active one and its members, or responds with them
+// as JSON.
+//
+// If they cannot be loaded, it responds with HTTP status 500 and an error
+// message.
+func ListOrganizations(context *gin.Context, organizationService services.OrganizationServiceInterface) {
+	renderOrganizations(context, organizationService, http.StatusOK, gin.H{})
+}
+
+// CreateOrganization handles the HTTP POST request for creating an
+// organization.
+//
+// It binds the name and slug from the form or JSON body, creates the
+// organization with the authenticated user as its owner and records it in
+// the audit log. JSON clients get the membership of the owner with HTTP
+// status 201; forms are redirected back to the organization list. The new
+// organization only becomes active once switched to.
+//
+// If the request is invalid, it responds with HTTP status 400, and with
+// HTTP status 409 if the slug is taken.
+func CreateOrganization(context *gin.Context, organizationService services.OrganizationServiceInterface) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return
+	}
+
+	var request CreateOrganizationRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderOrganizationError(context, organizationService, http.StatusBadRequest, err)
+		return
+	}
+
+	owner := &models.User{}
+	owner.ID = userID
+	membership, err := organizationService.CreateOrganization(owner, request.Name, request.Slug)
+	if err != nil {
+		renderOrganizationError(context, organizationService, organizationErrorStatus(err), err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:   models.AuditOrgCreate,
+		Outcome:  models.AuditSuccess,
+		TargetID: &userID,
+		Changes: services.AuditChanges(nil, map[string]interface{}{
+			"organization_id": membership.OrganizationID,
+			"name":            membership.Organization.Name,
+			"slug":            membership.Organization.Slug,
+		}),
+	})
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusCreated, gin.H{"membership": membership})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, organizationsPath)
+}
+
+// SwitchOrganization handles the HTTP POST request for switching the active
+// organization.
+//
+// It makes the organization in the body the active one of the authenticated
+// user and issues a new session cookie acting in it. JSON clients get the
+// new token and the membership; forms are redirected to the home page.
+//
+// Personal access tokens cannot switch, they act in the organization they
+// were created in, and neither can service accounts and device sessions:
+// they get HTTP status 400. Users who are not active members of the organization get HTTP status
+// 403.
+func SwitchOrganization(context *gin.Context, organizationService services.OrganizationServiceInterface) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return
+	}
+	if claims := middlewares.GetClaims(context); claims.IsScoped() {
+		renderFormError(context, http.StatusBadRequest, "error.html", nil,
+			errors.New("Access tokens, service accounts and devices cannot switch organizations"))
+		return
+	}
+
+	var request SwitchOrganizationRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderFormError(context, http.StatusBadRequest, "error.html", nil, err)
+		return
+	}
+
+	user, membership, err := organizationService.SwitchOrganization(userID, request.OrganizationID)
+	switch {
+	case errors.Is(err, services.ErrNotMember):
+		renderFormError(context, http.StatusForbidden, "error.html", nil, err)
+		return
+	case err != nil:
+		log.Printf("Failed to switch user %d to organization %d: %v", userID, request.OrganizationID, err)
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to switch organization"))
+		return
+	}
+
+	token, err := renewSessionToken(context, user)
+	if err != nil {
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Could not generate token"))
+		return
+	}
+	context.SetCookie("Authorization", token, 3600, "/", "localhost", false, true)
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"token": token, "membership": membership})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, "/api/v1/user/home")
+}
+
+// AddOrganizationMember handles the HTTP POST request for adding an existing
+// user to the active organization.
+//
+// It binds the username and role from the form or JSON body, adds the user
+// and records it in the audit log. JSON clients get the membership with
+// HTTP status 201; forms are redirected back to the organization list.
+//
+// Unknown users get HTTP status 404, users who are already members HTTP
+// status 409, and admins granting the owner role HTTP status 403.
+func AddOrganizationMember(context *gin.Context, organizationService services.OrganizationServiceInterface) {
+	var request AddMemberRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderOrganizationError(context, organizationService, http.StatusBadRequest, err)
+		return
+	}
+
+	actor := middlewares.CurrentMembership(context)
+	membership, err := organizationService.AddMember(context.Request.Context(), actor, request.Username, request.Role)
+	if err != nil {
+		renderOrganizationError(context, organizationService, organizationErrorStatus(err), err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditOrgMemberAdd,
+		Outcome:        models.AuditSuccess,
+		TargetID:       &membership.UserID,
+		TargetUsername: membership.User.Username,
+		Changes: services.AuditChanges(nil, map[string]interface{}{
+			"organization_id": membership.OrganizationID,
+			"role":            membership.Role,
+		}),
+	})
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusCreated, gin.H{"membership": membership})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, organizationsPath)
+}
+
+// SetOrganizationMemberRole handles the HTTP POST request for changing the
+// role of a member of the active organization.
+//
+// It changes the role of the member with the user ID in the path and
+// records the change in the audit log. JSON clients get the membership;
+// forms are redirected back to the organization list.
+//
+// Members of other organizations get HTTP status 404, admins granting or
+// revoking the owner role HTTP status 403, and demoting the last owner
+// HTTP status 409.
+func SetOrganizationMemberRole(context *gin.Context, organizationService services.OrganizationServiceInterface) {
+	userID, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err != nil {
+		renderOrganizationError(context, organizationService, http.StatusNotFound, services.ErrNotMember)
+		return
+	}
+
+	var request SetMemberRoleRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderOrganizationError(context, organizationService, http.StatusBadRequest, err)
+		return
+	}
+
+	actor := middlewares.CurrentMembership(context)
+	membership, previousRole, err := organizationService.SetMemberRole(context.Request.Context(), actor, uint(userID), request.Role)
+	if err != nil {
+		renderOrganizationError(context, organizationService, organizationErrorStatus(err), err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditOrgRoleChange,
+		Outcome:        models.AuditSuccess,
+		TargetID:       &membership.UserID,
+		TargetUsername: membership.User.Username,
+		Changes: services.AuditChanges(
+			map[string]interface{}{"organization_id": membership.OrganizationID, "role": previousRole},
+			map[string]interface{}{"organization_id": membership.OrganizationID, "role": membership.Role},
+		),
+	})
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"membership": membership})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, organizationsPath)
+}
+
+// RemoveOrganizationMember handles the HTTP POST and DELETE requests for
+// removing a member from the active organization.
+//
+// It removes the member with the user ID in the path from the organization
+// and its groups, and records it in the audit log. Their account is kept.
+// JSON clients get HTTP status 204; forms are redirected back to the
+// organization list.
+//
+// Members of other organizations get HTTP status 404, admins removing an
+// owner HTTP status 403, and removing the last owner HTTP status 409.
+func RemoveOrganizationMember(context *gin.Context, organizationService services.OrganizationServiceInterface) {
+	userID, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err != nil {
+		renderOrganizationError(context, organizationService, http.StatusNotFound, services.ErrNotMember)
+		return
+	}
+
+	actor := middlewares.CurrentMembership(context)
+	membership, err := organizationService.RemoveMember(context.Request.Context(), actor, uint(userID))
+	if err != nil {
+		renderOrganizationError(context, organizationService, organizationErrorStatus(err), err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditOrgMemberDrop,
+		Outcome:        models.AuditSuccess,
+		TargetID:       &membership.UserID,
+		TargetUsername: membership.User.Username,
+		Changes: services.AuditChanges(
+			map[string]interface{}{"organization_id": membership.OrganizationID, "role": membership.Role},
+			nil,
+		),
+	})
+
+	if wantsJSON(context) {
+		context.Status(http.StatusNoContent)
+		return
+	}
+	context.Redirect(http.StatusSeeOther, organizationsPath)
+}
+
+// renderOrganizations renders the organization list of the authenticated
+// user, with the members of the active organization and the given extra
+// values, or responds with it as JSON
+func renderOrganizations(context *gin.Context, organizationService services.OrganizationServiceInterface, status int, values gin.H) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return
+	}
+
+	memberships, err := organizationService.ListMemberships(userID)
+	if err != nil {
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to load organizations"))
+		return
+	}
+	active := middlewares.CurrentMembership(context)
+	var members []models.Membership
+	if active != nil {
+		if members, err = organizationService.ListMembers(context.Request.Context()); err != nil {
+			renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to load members"))
+			return
+		}
+	}
+
+	if wantsJSON(context) {
+		context.JSON(status, gin.H{"organizations": memberships, "active": active, "members": members})
+		return
+	}
+
+	values["organizations"] = memberships
+	values["active"] = active
+	values["members"] = members
+	values["roles"] = models.OrganizationRoles
+	context.HTML(status, "organizations.html", values)
+}
+
+// renderOrganizationError responds to an organization request that failed,
+// showing the error above the organization list on the HTML page. Errors
+// not meant for the user are logged and replaced by a generic message.
+func renderOrganizationError(context *gin.Context, organizationService services.OrganizationServiceInterface, status int, err error) {
+	if status == http.StatusInternalServerError {
+		log.Printf("Organization request failed: %v", err)
+		err = errors.New("Failed to update the organization")
+	}
+	if wantsJSON(context) {
+		renderFormError(context, status, "organizations.html", nil, err)
+		return
+	}
+
+	values := gin.H{"error": err.Error()}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		values["error"] = "Please correct the highlighted fields"
+		values["fieldErrors"] = validationErr.ByField()
+	}
+	renderOrganizations(context, organizationService, status, values)
+}
+
+// organizationErrorStatus returns the HTTP status for an error returned by
+// the OrganizationService
+func organizationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidOrganizationName), errors.Is(err, services.ErrInvalidOrganizationSlug),
+		errors.Is(err, services.ErrInvalidOrganizationRole):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrOwnerRequired):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrNotMember), errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrOrganizationExists), errors.Is(err, services.ErrAlreadyMember),
+		errors.Is(err, services.ErrLastOwner):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
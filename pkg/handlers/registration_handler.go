@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// registrationsPath is the page listing the accounts awaiting approval
+const registrationsPath = "/api/v1/admin/registrations"
+
+// RegisterRegistrationRoutes registers the routes for verifying the email
+// address of a new account and for the approval queue.
+//
+// The verification link is public: the signed token in its query is the
+// credential. The approval routes are only available to authenticated
+// users with the admin role, and personal access tokens need the
+// users:write scope. The registrationService parameter is used by the
+// handlers to verify addresses and to list, approve and reject the
+// accounts awaiting approval.
+func RegisterRegistrationRoutes(r *gin.Engine, registrationService services.RegistrationServiceInterface) {
+	r.GET(services.EmailVerificationPath, func(c *gin.Context) { VerifyEmail(c, registrationService) })
+
+	admin := r.Group(registrationsPath)
+	admin.Use(middlewares.AuthMiddleware(), middlewares.RequireRole(models.RoleAdmin), middlewares.RequireScope(models.ScopeUsersWrite))
+	{
+		admin.GET("", func(c *gin.Context) { ListRegistrations(c, registrationService) })
+		admin.POST("/:id/approve", func(c *gin.Context) { ApproveRegistration(c, registrationService) })
+		admin.POST("/:id/reject", func(c *gin.Context) { RejectRegistration(c, registrationService) })
+	}
+}
+
+// VerifyEmail handles the HTTP GET request for the link verifying the email
+// address of a new account.
+//
+// It activates the account the token in the query was sent for using the
+// provided registrationService, records it in the audit log and renders the
+// login.html template, inviting the user to log in. JSON clients get the
+// user.
+//
+// If the link is invalid, has expired or was already used, it responds
+// with HTTP status 400.
+func VerifyEmail(context *gin.Context, registrationService services.RegistrationServiceInterface) {
+	user, err := registrationService.VerifyEmail(context.Query("token"))
+	if err != nil {
+		status := http.StatusBadRequest
+		if !errors.Is(err, services.ErrVerificationInvalid) {
+			log.Printf("Failed to verify an email address: %v", err)
+			status, err = http.StatusInternalServerError, errors.New("Failed to verify your email address")
+		}
+		renderFormError(context, status, "error.html", nil, err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditEmailVerify,
+		Outcome:        models.AuditSuccess,
+		ActorID:        &user.ID,
+		ActorUsername:  user.Username,
+		TargetID:       &user.ID,
+		TargetUsername: user.Username,
+		Changes:        services.AuditChanges(nil, map[string]interface{}{"email": user.Email}),
+	})
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"user": user})
+		return
+	}
+	context.HTML(http.StatusOK, "login.html", gin.H{
+		"username": user.Username,
+		"notice":   "Your email address is verified. You can now log in.",
+	})
+}
+
+// ListRegistrations handles the HTTP GET request for the approval queue.
+//
+// It renders the registrations.html template with the accounts awaiting
+// approval, oldest first, or responds with them as JSON.
+//
+// If they cannot be loaded, it responds with HTTP status 500 and an error
+// message.
+func ListRegistrations(context *gin.Context, registrationService services.RegistrationServiceInterface) {
+	renderRegistrations(context, registrationService, http.StatusOK, gin.H{})
+}
+
+// ApproveRegistration handles the HTTP POST request approving an account.
+//
+// It activates the account with the ID in the path, emails its owner and
+// records it in the audit log. JSON clients get the user; forms are
+// redirected back to the approval queue.
+//
+// Accounts that are not awaiting approval get HTTP status 404.
+func ApproveRegistration(context *gin.Context, registrationService services.RegistrationServiceInterface) {
+	decideRegistration(context, registrationService, models.AuditSignupApprove, registrationService.ApproveUser)
+}
+
+// RejectRegistration handles the HTTP POST request rejecting an account.
+//
+// It deletes the account with the ID in the path, emails its owner and
+// records it in the audit log. JSON clients get the user; forms are
+// redirected back to the approval queue.
+//
+// Accounts that are not awaiting approval get HTTP status 404.
+func RejectRegistration(context *gin.Context, registrationService services.RegistrationServiceInterface) {
+	decideRegistration(context, registrationService, models.AuditSignupReject, registrationService.RejectUser)
+}
+
+// decideRegistration applies the decision of an admin to the account with
+// the ID in the path, and records it in the audit log with the action
+func decideRegistration(context *gin.Context, registrationService services.RegistrationServiceInterface, action string,
+	decide func(userID uint) (*models.User, error)) {
+	userID, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err != nil {
+		renderRegistrationError(context, registrationService, http.StatusNotFound, services.ErrRegistrationMissing)
+		return
+	}
+
+	user, err := decide(uint(userID))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrRegistrationMissing) {
+			status = http.StatusNotFound
+		}
+		renderRegistrationError(context, registrationService, status, err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         action,
+		Outcome:        models.AuditSuccess,
+		TargetID:       &user.ID,
+		TargetUsername: user.Username,
+		Changes:        services.AuditChanges(nil, map[string]interface{}{"email": user.Email, "status": user.Status}),
+	})
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"user": user})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, registrationsPath)
+}
+
+// renderRegistrations renders the approval queue, with the given extra
+// values, or responds with it as JSON
+func renderRegistrations(context *gin.Context, registrationService services.RegistrationServiceInterface, status int, values gin.H) {
+	users, err := registrationService.ListPendingUsers()
+	if err != nil {
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to load registrations"))
+		return
+	}
+
+	if wantsJSON(context) {
+		context.JSON(status, gin.H{"users": users})
+		return
+	}
+	values["users"] = users
+	values["mode"] = registrationService.Policy().Mode
+	context.HTML(status, "registrations.html", values)
+}
+
+// renderRegistrationError responds to an approval request that failed,
+// showing the error above the approval queue on the HTML page. Errors not
+// meant for the user are logged and replaced by a generic message.
+func renderRegistrationError(context *gin.Context, registrationService services.RegistrationServiceInterface, status int, err error) {
+	if status == http.StatusInternalServerError {
+		log.Printf("Registration request failed: %v", err)
+		err = errors.New("Failed to update the registration")
+	}
+	if wantsJSON(context) {
+		renderFormError(context, status, "registrations.html", nil, err)
+		return
+	}
+	renderRegistrations(context, registrationService, status, gin.H{"error": err.Error()})
+}
+
+// registrationDisabled reports whether the registration policy closes
+// registration, invitations included
+func registrationDisabled(context *gin.Context) bool {
+	registrationService := middlewares.GetRegistrationService(context)
+	return registrationService != nil && registrationService.Policy().Mode == services.RegistrationDisabled
+}
@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// scimPath is the base path of the SCIM endpoints
+const scimPath = "/scim/v2"
+
+// RegisterSCIMRoutes registers the SCIM 2.0 endpoints (RFC 7644) used by
+// identity providers to provision users and groups.
+//
+// Every endpoint is protected by the middleware.SCIMAuthMiddleware function,
+// which requires an admin personal access token with the scim scope. The
+// scimService parameter is used by the handlers to map the resources onto
+// users and groups.
+func RegisterSCIMRoutes(r *gin.Engine, scimService services.SCIMServiceInterface) {
+	scim := r.Group(scimPath)
+	scim.Use(middlewares.SCIMAuthMiddleware())
+	{
+		scim.GET("/ServiceProviderConfig", SCIMServiceProviderConfig)
+		scim.GET("/ResourceTypes", SCIMResourceTypes)
+
+		scim.GET("/Users", func(c *gin.Context) { ListSCIMUsers(c, scimService) })
+		scim.POST("/Users", func(c *gin.Context) { CreateSCIMUser(c, scimService) })
+		scim.GET("/Users/:id", func(c *gin.Context) { GetSCIMUser(c, scimService) })
+		scim.PUT("/Users/:id", func(c *gin.Context) { ReplaceSCIMUser(c, scimService) })
+		scim.PATCH("/Users/:id", func(c *gin.Context) { PatchSCIMUser(c, scimService) })
+		scim.DELETE("/Users/:id", func(c *gin.Context) { DeleteSCIMUser(c, scimService) })
+
+		scim.GET("/Groups", func(c *gin.Context) { ListSCIMGroups(c, scimService) })
+		scim.POST("/Groups", func(c *gin.Context) { CreateSCIMGroup(c, scimService) })
+		scim.GET("/Groups/:id", func(c *gin.Context) { GetSCIMGroup(c, scimService) })
+		scim.PUT("/Groups/:id", func(c *gin.Context) { ReplaceSCIMGroup(c, scimService) })
+		scim.PATCH("/Groups/:id", func(c *gin.Context) { PatchSCIMGroup(c, scimService) })
+		scim.DELETE("/Groups/:id", func(c *gin.Context) { DeleteSCIMGroup(c, scimService) })
+	}
+}
+
+// SCIMServiceProviderConfig handles the HTTP GET request for the features
+// supported by the SCIM endpoints (RFC 7643 section 5)
+func SCIMServiceProviderConfig(context *gin.Context) {
+	unsupported := gin.H{"supported": false}
+	renderSCIM(context, http.StatusOK, gin.H{
+		"schemas":        []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": services.SCIMMaxCount},
+		"changePassword": gin.H{"supported": true},
+		"sort":           unsupported,
+		"etag":           unsupported,
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Personal access token",
+			"description": "An admin personal access token with the " + models.ScopeSCIM + " scope",
+		}},
+	})
+}
+
+// SCIMResourceTypes handles the HTTP GET request for the resource types
+// served by the SCIM endpoints (RFC 7643 section 6)
+func SCIMResourceTypes(context *gin.Context) {
+	resourceType := func(name, endpoint, schema string) gin.H {
+		return gin.H{
+			"schemas":  []string{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"},
+			"id":       name,
+			"name":     name,
+			"endpoint": endpoint,
+			"schema":   schema,
+		}
+	}
+	resources := []interface{}{
+		resourceType("User", "/Users", services.SCIMUserSchema),
+		resourceType("Group", "/Groups", services.SCIMGroupSchema),
+	}
+	renderSCIM(context, http.StatusOK, &services.SCIMListResponse{
+		Schemas:      []string{services.SCIMListResponseSchema},
+		TotalResults: int64(len(resources)),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// ListSCIMUsers handles the HTTP GET request for a page of users.
+//
+// It reads the filter, startIndex and count query parameters and responds
+// with a SCIM list response. Invalid filters get a SCIM error with HTTP
+// status 400.
+func ListSCIMUsers(context *gin.Context, scimService services.SCIMServiceInterface) {
+	response, err := scimService.ListUsers(context.Request.Context(), scimListQuery(context))
+	if err != nil {
+		renderSCIMError(context, err)
+		return
+	}
+	renderSCIM(context, http.StatusOK, response)
+}
+
+// CreateSCIMUser handles the HTTP POST request for provisioning a user.
+//
+// It responds with the created user, HTTP status 201 and its location. A
+// taken username gets a SCIM error with HTTP status 409.
+func CreateSCIMUser(context *gin.Context, scimService services.SCIMServiceInterface) {
+	var resource services.SCIMUser
+	if !decodeSCIMBody(context, &resource) {
+		return
+	}
+	user, err := scimService.CreateUser(context.Request.Context(), &resource)
+	if err != nil {
+		renderSCIMError(context, err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditUserCreate,
+		Outcome:        models.AuditSuccess,
+		TargetID:       scimResourceID(user.ID),
+		TargetUsername: user.UserName,
+		Changes:        services.AuditChanges(nil, map[string]interface{}{"source": "scim", "external_id": user.ExternalID}),
+	})
+	context.Header("Location", user.Meta.Location)
+	renderSCIM(context, http.StatusCreated, user)
+}
+
+// GetSCIMUser handles the HTTP GET request for a user. Unknown users get a
+// SCIM error with HTTP status 404.
+func GetSCIMUser(context *gin.Context, scimService services.SCIMServiceInterface) {
+	user, err := scimService.GetUser(context.Request.Context(), context.Param("id"))
+	if err != nil {
+		renderSCIMError(context, err)
+		return
+	}
+	renderSCIM(context, http.StatusOK, user)
+}
+
+// ReplaceSCIMUser handles the HTTP PUT request replacing the attributes of
+// a user, and responds with the updated user
+func ReplaceSCIMUser(context *gin.Context, scimService services.SCIMServiceInterface) {
+	var resource services.SCIMUser
+	if !decodeSCIMBody(context, &resource) {
+		return
+	}
+	user, err := scimService.ReplaceUser(context.Request.Context(), context.Param("id"), &resource)
+	if err != nil {
+		renderSCIMError(context, err)
+		return
+	}
+	recordSCIMUserUpdate(context, user)
+	renderSCIM(context, http.StatusOK, user)
+}
+
+// PatchSCIMUser handles the HTTP PATCH request modifying a user, such as
+// deactivating them, and responds with the updated user
+func PatchSCIMUser(context *gin.Context, scimService services.SCIMServiceInterface) {
+	var patch services.SCIMPatchRequest
+	if !decodeSCIMBody(context, &patch) {
+		return
+	}
+	user, err := scimService.PatchUser(context.Request.Context(), context.Param("id"), &patch)
+	if err != nil {
+		renderSCIMError(context, err)
+		return
+	}
+	recordSCIMUserUpdate(context, user)
+	renderSCIM(context, http.StatusOK, user)
+}
+
+// DeleteSCIMUser handles the HTTP DELETE request for a user, and responds
+// with HTTP status 204
+func DeleteSCIMUser(context *gin.Context, scimService services.SCIMServiceInterface) {
+	user, err := scimService.GetUser(context.Request.Context(), context.Param("id"))
+	if err == nil {
+		err = scimService.DeleteUser(context.Request.Context(), user.ID)
+	}
+	if err != nil {
+		renderSCIMError(context, err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditUserDelete,
+		Outcome:        models.AuditSuccess,
+		TargetID:       scimResourceID(user.ID),
+		TargetUsername: user.UserName,
+		Changes:        services.AuditChanges(nil, map[string]interface{}{"source": "scim"}),
+	})
+	context.Status(http.StatusNoContent)
+}
+
+// ListSCIMGroups handles the HTTP GET request for a page of groups, like
+// ListSCIMUsers
+func ListSCIMGroups(context *gin.Context, scimService services.SCIMServiceInterface) {
+	response, err := scimService.ListGroups(context.Request.Context(), scimListQuery(context))
+	if err != nil {
+		renderSCIMError(context, err)
+		return
+	}
+	renderSCIM(context, http.StatusOK, response)
+}
+
+// CreateSCIMGroup handles the HTTP POST request for provisioning a group.
+//
+// It responds with the created group, HTTP status 201 and its location. A
+// taken display name gets a SCIM error with HTTP status 409, and unknown
+// members one with HTTP status 400.
+func CreateSCIMGroup(context *gin.Context, scimService services.SCIMServiceInterface) {
+	var resource services.SCIMGroup
+	if !decodeSCIMBody(context, &resource) {
+		return
+	}
+	group, err := scimService.CreateGroup(context.Request.Context(), &resource)
+	if err != nil {
+		renderSCIMError(context, err)
+		return
+	}
+
+	recordSCIMGroupEvent(context, models.AuditGroupCreate, group)
+	context.Header("Location", group.Meta.Location)
+	renderSCIM(context, http.StatusCreated, group)
+}
+
+// GetSCIMGroup handles the HTTP GET request for a group, with its members.
+// Unknown groups get a SCIM error with HTTP status 404.
+func GetSCIMGroup(context *gin.Context, scimService services.SCIMServiceInterface) {
+	group, err := scimService.GetGroup(context.Request.Context(), context.Param("id"))
+	if err != nil {
+		renderSCIMError(context, err)
+		return
+	}
+	renderSCIM(context, http.StatusOK, group)
+}
+
+// ReplaceSCIMGroup handles the HTTP PUT request replacing a group and its
+// members, and responds with the updated group
+func ReplaceSCIMGroup(context *gin.Context, scimService services.SCIMServiceInterface) {
+	var resource services.SCIMGroup
+	if !decodeSCIMBody(context, &resource) {
+		return
+	}
+	group, err := scimService.ReplaceGroup(context.Request.Context(), context.Param("id"), &resource)
+	if err != nil {
+		renderSCIMError(context, err)
+		return
+	}
+	recordSCIMGroupEvent(context, models.AuditGroupUpdate, group)
+	renderSCIM(context, http.StatusOK, group)
+}
+
+// PatchSCIMGroup handles the HTTP PATCH request modifying a group, such as
+// adding or removing members, and responds with the updated group
+func PatchSCIMGroup(context *gin.Context, scimService services.SCIMServiceInterface) {
+	var patch services.SCIMPatchRequest
+	if !decodeSCIMBody(context, &patch) {
+		return
+	}
+	group, err := scimService.PatchGroup(context.Request.Context(), context.Param("id"), &patch)
+	if err != nil {
+		renderSCIMError(context, err)
+		return
+	}
+	recordSCIMGroupEvent(context, models.AuditGroupUpdate, group)
+	renderSCIM(context, http.StatusOK, group)
+}
+
+// DeleteSCIMGroup handles the HTTP DELETE request for a group, and
+// responds with HTTP status 204
+func DeleteSCIMGroup(context *gin.Context, scimService services.SCIMServiceInterface) {
+	group, err := scimService.GetGroup(context.Request.Context(), context.Param("id"))
+	if err == nil {
+		err = scimService.DeleteGroup(context.Request.Context(), group.ID)
+	}
+	if err != nil {
+		renderSCIMError(context, err)
+		return
+	}
+	recordSCIMGroupEvent(context, models.AuditGroupDelete, group)
+	context.Status(http.StatusNoContent)
+}
+
+// scimListQuery reads the query parameters of a list request. Missing or
+// invalid numbers fall back to the first page of SCIMDefaultCount
+// resources.
+func scimListQuery(context *gin.Context) services.SCIMListQuery {
+	query := services.SCIMListQuery{
+		Filter:     context.Query("filter"),
+		StartIndex: 1,
+		Count:      services.SCIMDefaultCount,
+	}
+	if startIndex, err := strconv.Atoi(context.Query("startIndex")); err == nil {
+		query.StartIndex = startIndex
+	}
+	if count, err := strconv.Atoi(context.Query("count")); err == nil {
+		query.Count = count
+	}
+	return query
+}
+
+// decodeSCIMBody decodes the JSON body of a request, whatever its content
+// type, since identity providers send either application/json or
+// application/scim+json. Invalid bodies get a SCIM error with HTTP status
+// 400 and false is returned.
+func decodeSCIMBody(context *gin.Context, body interface{}) bool {
+	if err := json.NewDecoder(context.Request.Body).Decode(body); err != nil {
+		renderSCIMError(context, &services.SCIMError{
+			Status:   http.StatusBadRequest,
+			ScimType: "invalidSyntax",
+			Detail:   "Invalid request body: " + err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// renderSCIM responds with a SCIM resource or message
+func renderSCIM(context *gin.Context, status int, body interface{}) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		renderSCIMError(context, err)
+		return
+	}
+	context.Data(status, middlewares.SCIMContentType, encoded)
+}
+
+// renderSCIMError responds with a SCIM error. Errors other than
+// *services.SCIMError are logged and hidden behind HTTP status 500.
+func renderSCIMError(context *gin.Context, err error) {
+	var scimErr *services.SCIMError
+	if !errors.As(err, &scimErr) {
+		log.Printf("SCIM request %s %s failed: %v", context.Request.Method, context.Request.URL.Path, err)
+		scimErr = &services.SCIMError{Status: http.StatusInternalServerError, Detail: "Internal server error"}
+	}
+	middlewares.AbortWithSCIMError(context, scimErr)
+}
+
+// recordSCIMUserUpdate audits a user updated through SCIM
+func recordSCIMUserUpdate(context *gin.Context, user *services.SCIMUser) {
+	active := user.Active == nil || bool(*user.Active)
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditUserUpdate,
+		Outcome:        models.AuditSuccess,
+		TargetID:       scimResourceID(user.ID),
+		TargetUsername: user.UserName,
+		Changes:        services.AuditChanges(nil, map[string]interface{}{"source": "scim", "active": active}),
+	})
+}
+
+// recordSCIMGroupEvent audits a change to a group made through SCIM
+func recordSCIMGroupEvent(context *gin.Context, action string, group *services.SCIMGroup) {
+	members := make([]string, 0, len(group.Members))
+	for _, member := range group.Members {
+		members = append(members, member.Value)
+	}
+	recordAudit(context, models.AuditEvent{
+		Action:  action,
+		Outcome: models.AuditSuccess,
+		Changes: services.AuditChanges(nil, map[string]interface{}{
+			"group_id":     group.ID,
+			"display_name": group.DisplayName,
+			"members":      members,
+		}),
+	})
+}
+
+// scimResourceID returns the numeric ID of a SCIM resource for an audit
+// event, or nil
+func scimResourceID(id string) *uint {
+	parsed, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil
+	}
+	value := uint(parsed)
+	return &value
+}
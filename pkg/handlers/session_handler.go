@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// sessionsPath is the page listing the active sessions of the user
+const sessionsPath = "/api/v1/user/sessions"
+
+// RegisterSessionRoutes registers the routes for managing sessions.
+//
+// Users list and revoke their own sessions; personal access tokens need the
+// users:read scope to list and the users:write scope to revoke them, and
+// admins impersonating the user cannot revoke them. Admins view and revoke
+// the sessions of any user. The sessionService parameter is
+// used by the handlers to list and revoke sessions.
+func RegisterSessionRoutes(r *gin.Engine, sessionService services.SessionServiceInterface) {
+	sessions := r.Group(sessionsPath)
+	sessions.Use(middlewares.AuthMiddleware())
+	{
+		sessions.GET("", middlewares.RequireScope(models.ScopeUsersRead), func(c *gin.Context) { ListSessions(c, sessionService) })
+		sessions.POST("/:id/revoke", middlewares.RequireScope(models.ScopeUsersWrite), middlewares.DenyImpersonation(), func(c *gin.Context) { RevokeSession(c, sessionService) })
+		sessions.DELETE("/:id", middlewares.RequireScope(models.ScopeUsersWrite), middlewares.DenyImpersonation(), func(c *gin.Context) { RevokeSession(c, sessionService) })
+	}
+
+	admin := r.Group("/api/v1/admin/users")
+	admin.Use(middlewares.AuthMiddleware(), middlewares.RequireRole(models.RoleAdmin))
+	{
+		admin.GET("/:id/sessions", middlewares.RequireScope(models.ScopeUsersRead), func(c *gin.Context) { ListUserSessions(c, sessionService) })
+		admin.POST("/:id/sessions/revoke", middlewares.RequireScope(models.ScopeUsersWrite), func(c *gin.Context) { RevokeUserSessions(c, sessionService) })
+		admin.POST("/:id/sessions/:session/revoke", middlewares.RequireScope(models.ScopeUsersWrite), func(c *gin.Context) { RevokeUserSession(c, sessionService) })
+		admin.DELETE("/:id/sessions/:session", middlewares.RequireScope(models.ScopeUsersWrite), func(c *gin.Context) { RevokeUserSession(c, sessionService) })
+	}
+}
+
+// ListSessions handles the HTTP GET request for the active sessions of the
+// authenticated user.
+//
+// It renders the sessions.html template, with the device, address and last
+// activity of each session and the current one marked, or responds with the
+// sessions as JSON.
+func ListSessions(context *gin.Context, sessionService services.SessionServiceInterface) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return
+	}
+	renderSessions(context, sessionService, userID, sessionsPath)
+}
+
+// RevokeSession handles the HTTP POST and DELETE requests for revoking a
+// session of the authenticated user.
+//
+// It revokes the session with the ID in the path, which logs it out at
+// once, and records it in the audit log. Revoking the current session also
+// clears its cookie. JSON clients get HTTP status 204; forms are redirected
+// back to the session list, or to the login form after revoking the current
+// session. If there is no such active session, it responds with HTTP status
+// 404.
+func RevokeSession(context *gin.Context, sessionService services.SessionServiceInterface) {
+	userID, ok := currentUserID(context)
+	if !ok {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return
+	}
+	sessionID, ok := revokeSession(context, sessionService, userID, context.Param("id"))
+	if !ok {
+		return
+	}
+
+	current := sessionID == currentSessionID(context)
+	if current {
+		context.SetCookie("Authorization", "", -1, "/", "localhost", false, true)
+	}
+	if wantsJSON(context) {
+		context.Status(http.StatusNoContent)
+		return
+	}
+	if current {
+		context.Redirect(http.StatusSeeOther, "/api/v1/user/login")
+		return
+	}
+	context.Redirect(http.StatusSeeOther, sessionsPath)
+}
+
+// ListUserSessions handles the HTTP GET request for the active sessions of
+// a user, for admins.
+//
+// It renders the sessions.html template with the sessions of the user with
+// the ID in the path, or responds with them as JSON.
+func ListUserSessions(context *gin.Context, sessionService services.SessionServiceInterface) {
+	userID, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err != nil {
+		renderFormError(context, http.StatusNotFound, "error.html", nil, services.ErrUserNotFound)
+		return
+	}
+	renderSessions(context, sessionService, uint(userID), adminSessionsPath(uint(userID)))
+}
+
+// RevokeUserSession handles the HTTP POST and DELETE requests for revoking
+// a session of a user, for admins.
+//
+// It revokes the session with the ID in the path, if it belongs to the user
+// with the ID in the path, and records it in the audit log. JSON clients
+// get HTTP status 204; forms are redirected back to the session list. If
+// there is no such active session, it responds with HTTP status 404.
+func RevokeUserSession(context *gin.Context, sessionService services.SessionServiceInterface) {
+	userID, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err != nil {
+		renderFormError(context, http.StatusNotFound, "error.html", nil, services.ErrSessionMissing)
+		return
+	}
+	if _, ok := revokeSession(context, sessionService, uint(userID), context.Param("session")); !ok {
+		return
+	}
+
+	if wantsJSON(context) {
+		context.Status(http.StatusNoContent)
+		return
+	}
+	context.Redirect(http.StatusSeeOther, adminSessionsPath(uint(userID)))
+}
+
+// RevokeUserSessions handles the HTTP POST request for revoking every
+// session of a user, for admins.
+//
+// It logs the user with the ID in the path out everywhere and records it in
+// the audit log. JSON clients get the number of sessions revoked; forms are
+// redirected back to the session list.
+func RevokeUserSessions(context *gin.Context, sessionService services.SessionServiceInterface) {
+	userID, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err != nil {
+		renderFormError(context, http.StatusNotFound, "error.html", nil, services.ErrUserNotFound)
+		return
+	}
+
+	target := uint(userID)
+	revoked, err := sessionService.RevokeSessions(target, 0)
+	if err != nil {
+		log.Printf("Failed to revoke the sessions of user %d: %v", userID, err)
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to revoke the sessions"))
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:   models.AuditSessionRevoke,
+		Outcome:  models.AuditSuccess,
+		TargetID: &target,
+		Changes:  services.AuditChanges(nil, map[string]interface{}{"sessions": revoked}),
+	})
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"revoked": revoked})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, adminSessionsPath(target))
+}
+
+// revokeSession revokes the session with the given ID, parsed from the
+// path, of a user and records it in the audit log. It responds with an
+// error and returns false if the user has no such active session.
+func revokeSession(context *gin.Context, sessionService services.SessionServiceInterface, userID uint, id string) (uint, bool) {
+	sessionID, err := strconv.ParseUint(id, 10, 64)
+	if err == nil {
+		err = sessionService.RevokeSession(userID, uint(sessionID))
+	} else {
+		err = services.ErrSessionMissing
+	}
+
+	switch {
+	case errors.Is(err, services.ErrSessionMissing):
+		renderFormError(context, http.StatusNotFound, "error.html", nil, err)
+		return 0, false
+	case err != nil:
+		log.Printf("Failed to revoke session %s of user %d: %v", id, userID, err)
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to revoke the session"))
+		return 0, false
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:   models.AuditSessionRevoke,
+		Outcome:  models.AuditSuccess,
+		TargetID: &userID,
+		Changes:  services.AuditChanges(nil, map[string]interface{}{"session_id": sessionID}),
+	})
+	return uint(sessionID), true
+}
+
+// renderSessions renders the active sessions of a user, whose forms post to
+// the given path, or responds with them as JSON
+func renderSessions(context *gin.Context, sessionService services.SessionServiceInterface, userID uint, path string) {
+	sessions, err := sessionService.ListSessions(userID)
+	if err != nil {
+		log.Printf("Failed to load the sessions of user %d: %v", userID, err)
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to load sessions"))
+		return
+	}
+
+	current := currentSessionID(context)
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"sessions": sessions, "current_session_id": current})
+		return
+	}
+	context.HTML(http.StatusOK, "sessions.html", gin.H{
+		"sessions": sessions,
+		"current":  current,
+		"path":     path,
+		"admin":    path != sessionsPath,
+		"userID":   userID,
+	})
+}
+
+// startSession records a new session of a user logging in, when sessions
+// are tracked, and returns its token
+func startSession(context *gin.Context, user *models.User) (string, error) {
+	sessionID, err := recordSession(context, user)
+	if err != nil {
+		return "", err
+	}
+	return issueToken(context, services.NewSessionClaims(user, sessionID))
+}
+
+// recordSession records a new session of a user in the active sessions and
+// returns its ID, or zero when sessions are not tracked
+func recordSession(context *gin.Context, user *models.User) (uint, error) {
+	sessionService := middlewares.GetSessionService(context)
+	if sessionService == nil {
+		return 0, nil
+	}
+	session, err := sessionService.StartSession(user.ID, context.Request.UserAgent(), context.ClientIP())
+	if err != nil {
+		log.Printf("Failed to start a session of user %d: %v", user.ID, err)
+		return 0, err
+	}
+	return session.ID, nil
+}
+
+// renewSessionToken returns a new token for the current session, after a
+// change to the user its claims carry, such as their active organization.
+// Impersonations stay impersonations.
+func renewSessionToken(context *gin.Context, user *models.User) (string, error) {
+	if claims := middlewares.GetClaims(context); claims != nil && claims.Actor != nil {
+		return issueToken(context, services.NewImpersonationClaims(user, claims.Actor))
+	}
+	return issueToken(context, services.NewSessionClaims(user, currentSessionID(context)))
+}
+
+// issueToken returns a token for the claims, issued by the service stored
+// by TokenMiddleware. It fails with middlewares.ErrNoTokenService without
+// one.
+func issueToken(context *gin.Context, claims *models.Claims) (string, error) {
+	tokenService := middlewares.GetTokenService(context)
+	if tokenService == nil {
+		return "", middlewares.ErrNoTokenService
+	}
+	return tokenService.Issue(claims)
+}
+
+// currentSessionID returns the ID of the session of the request, or zero
+// for tokens issued without one and personal access tokens
+func currentSessionID(context *gin.Context) uint {
+	if claims := middlewares.GetClaims(context); claims != nil {
+		return claims.SessionID
+	}
+	return 0
+}
+
+// adminSessionsPath returns the admin page listing the sessions of a user
+func adminSessionsPath(userID uint) string {
+	return fmt.Sprintf("/api/v1/admin/users/%d/sessions", userID)
+}
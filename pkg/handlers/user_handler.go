@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
 	"BuildasTechnicalAssessmentGo/pkg/services"
-	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"errors"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 // RegisterRoutes registers all the routes for the user handlers.
@@ -17,119 +20,238 @@ import (
 // middleware.AuthMiddleware function, which checks for a valid JWT token in
 // the Authorization header of the request. The userService parameter is used
 // to create a new instance of the UserService, which is used by the handlers
-// to interact with the database.
-func RegisterRoutes(r *gin.Engine, userService services.UserServiceInterface) {
+// to interact with the database. Both groups are metered by the
+// middleware.RateLimitMiddleware function using the rateLimitService; on the
+// authUser group it runs after authentication so policies can be keyed by user.
+// Personal access tokens need the users:read scope to list users and the
+// users:write scope to add them.
+func RegisterRoutes(r *gin.Engine, userService services.UserServiceInterface, rateLimitService services.RateLimitServiceInterface) {
 	user := r.Group("/api/v1/user")
+	user.Use(middlewares.RateLimitMiddleware(rateLimitService))
 	authUser := r.Group("/api/v1/user")
-	authUser.Use(middlewares.AuthMiddleware())
+	authUser.Use(middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware(rateLimitService))
 	{
 		user.GET("/register", UserRegisterForm)
 		user.POST("/register", func(c *gin.Context) { RegisterUser(c, userService) })
 		user.GET("/login", LoginUserForm)
 		user.POST("/login", func(c *gin.Context) { LoginUser(c, userService) })
-		authUser.GET("/home", func(c *gin.Context) { Home(c, userService) })
-		authUser.POST("/add", func(c *gin.Context) { AddUser(c, userService) })
+		authUser.GET("/home", middlewares.RequireScope(models.ScopeUsersRead), func(c *gin.Context) { Home(c, userService) })
+		authUser.POST("/add", middlewares.RequireScope(models.ScopeUsersWrite), func(c *gin.Context) { AddUser(c, userService) })
 	}
 }
 
 // Home handles the HTTP GET request for the home page.
 //
-// It extracts the username from the JWT claims stored in the request context,
-// fetches all users from the database using the provided userService,
-// and renders the home.html template with the user's username and a list of users.
+// It takes the username from the claims stored by middlewares.AuthMiddleware,
+// fetches the members of the organization the request acts in using the
+// provided userService, and renders the home.html template with the user's
+// username, their organization and a list of users. Admins also get a link
+// to the audit log, and can suspend and reactivate the other users, and
+// impersonate them when allowed to by the service stored by
+// middleware.ImpersonationMiddleware. Clients asking for JSON get the list of
+// users instead.
 //
-// If the user list is not fetched successfully, it responds with HTTP status 500
-// and an error message. Otherwise, it responds with HTTP status 200 and the
-// rendered template.
+// Requests without claims get HTTP status 401. If the user list is not
+// fetched successfully, it responds with HTTP status 500 and an error
+// message. Otherwise, it responds with HTTP status 200 and the rendered
+// template.
 func Home(context *gin.Context, userService services.UserServiceInterface) {
 	// Get the username from the claims
-	claims := context.MustGet("claims").(*jwt.MapClaims)
-	username := (*claims)["username"]
+	claims := middlewares.GetClaims(context)
+	if claims == nil {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return
+	}
 
-	// Fetch all users from the database
-	users, err := userService.GetAllUsers()
+	// Fetch the users of the organization from the database
+	users, err := userService.GetAllUsers(context.Request.Context())
 	if err != nil {
 		context.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Failed to load users"})
 		return
 	}
 
+	// Scripts get the user list as JSON
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"users": users})
+		return
+	}
+
 	// Render the home page with a user list
+	userID := claims.UserID()
+	isAdmin := claims.HasRole(models.RoleAdmin)
+	canImpersonate := false
+	if impersonationService := middlewares.GetImpersonationService(context); impersonationService != nil && isAdmin {
+		if canImpersonate, err = impersonationService.CanImpersonate(userID); err != nil {
+			log.Printf("Failed to check whether user %d may impersonate: %v", userID, err)
+		}
+	}
 	context.HTML(http.StatusOK, "home.html", gin.H{
-		"username": username,
-		"users":    users,
+		"userID":         userID,
+		"username":       claims.Username,
+		"users":          users,
+		"isAdmin":        isAdmin,
+		"canImpersonate": canImpersonate,
+		"organization":   middlewares.CurrentMembership(context),
 	})
 }
 
 // AddUser handles the HTTP POST request for adding a new user.
 //
-// It extracts the username and password from the form data,
-// calls the userService to register the new user,
-// and redirects back to the home page if successful.
+// It binds the username and password from the form or JSON body,
+// calls the userService to register the new user, adds them to the
+// organization the request acts in, records the creation in the audit log,
+// and redirects back to the home page if successful. JSON
+// clients get the new user with HTTP status 201 instead.
 //
-// If the registration fails, it responds with HTTP status 500
-// and an error message.
+// If the request is invalid or the user cannot be registered because of
+// its username or password, it responds with HTTP status 400 and the
+// field-level errors. If the registration fails for any other reason, it
+// responds with HTTP status 500 and an error message.
 func AddUser(context *gin.Context, userService services.UserServiceInterface) {
-	//Get post-data
-	username := context.PostForm("username")
-	password := context.PostForm("password")
+	// Bind and validate the request
+	var request RegisterRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderFormError(context, http.StatusBadRequest, "error.html", nil, err)
+		return
+	}
 
 	// Call the user service to register the new user
-	err := userService.RegisterUser(username, password)
+	err := userService.RegisterUser(request.Username, request.Password)
 	if err != nil {
-		context.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": err.Error()})
+		renderFormError(context, registrationErrorStatus(err), "error.html", nil, err)
 		return
 	}
 
-	// Redirect back to the home page
+	// Record who created the user
+	user, _ := userService.GetUserByUsername(request.Username)
+
+	// The new user joins the organization of whoever created them
+	organizationService := middlewares.GetOrganizationService(context)
+	if membership := middlewares.CurrentMembership(context); organizationService != nil && membership != nil && user != nil {
+		if _, err := organizationService.AddMember(context.Request.Context(), membership, user.Username, models.OrgRoleMember); err != nil {
+			log.Printf("Failed to add user %d to organization %d: %v", user.ID, membership.OrganizationID, err)
+		}
+	}
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditUserCreate,
+		Outcome:        models.AuditSuccess,
+		TargetID:       userRef(user),
+		TargetUsername: request.Username,
+		Changes:        services.AuditChanges(nil, services.UserAuditState(user)),
+	})
+
+	// Scripts get the new user, forms are redirected back to the home page
+	if wantsJSON(context) {
+		context.JSON(http.StatusCreated, gin.H{"user": user})
+		return
+	}
 	context.Redirect(http.StatusSeeOther, "/api/v1/user/home")
 }
 
 // LoginUserForm handles the HTTP GET request for the login form.
 //
 // It checks for an existing Authorization cookie. If it exists, it redirects
-// to /home. If not, it renders the login.html template with an empty
-// gin.H object.
+// to the local page in the "next" query parameter, or to /home. If not, it
+// renders the login.html template, which posts "next" back.
 func LoginUserForm(context *gin.Context) {
+	// Go straight back to the page that asked for a login
+	next := localRedirectPath(context.Query("next"))
+	if next != "" && middlewares.SessionClaims(context) != nil {
+		context.Redirect(http.StatusSeeOther, next)
+		return
+	}
+
 	// Use the helper function to check for redirection
 	if middlewares.RedirectIfAuthenticated(context) {
 		return
 	}
 
 	// If no token, render the login page
-	context.HTML(http.StatusOK, "login.html", gin.H{})
+	context.HTML(http.StatusOK, "login.html", loginPageValues(gin.H{"next": next}))
 }
 
 // LoginUser handles the HTTP POST request for user login.
 //
-// It extracts the username and password from the form data,
-// calls the userService to validate the credentials,
-// generates a JWT token using the utils helper function,
+// It binds the username and password from the form or JSON body,
+// validates the credentials with the authenticator made available by the
+// middleware.AuthenticatorMiddleware function, or the passwords of the
+// userService,
+// issues a session token with the token service of middleware.TokenMiddleware,
 // sets the token as a cookie (optional but useful for session management),
-// and renders the home.html file with the user's username.
+// and renders the home.html file with the user's username, or redirects to
+// the local page in "next". Every attempt, successful or not, is recorded in
+// the audit log.
+//
+// If a field is missing, it responds with HTTP status 400 and the
+// field-level errors. If the credentials are invalid, it responds with
+// HTTP status 401 and an error message, and if the directory cannot be
+// reached, with HTTP status 503. If the user has been deactivated,
+// or their account awaits approval or the verification of their email
+// address, it responds with HTTP status 403; unverified users are sent a
+// new verification link. If there is an error generating the token, it
+// responds with HTTP status 500 and an error message.
 //
-// If the credentials are invalid, it responds with HTTP status 401
-// and an error message. If there is an error generating the token,
-// it responds with HTTP status 500 and an error message.
+// Users who registered a passkey are not logged in yet: they are asked for
+// it by the webauthn_login.html template, or JSON clients get the options
+// of the check, which FinishPasskeyLogin completes.
 func LoginUser(context *gin.Context, userService services.UserServiceInterface) {
-	// Extract credentials from the request
-	username := context.PostForm("username")
-	password := context.PostForm("password")
+	// Bind and validate the request
+	var request LoginRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderFormError(context, http.StatusBadRequest, "login.html", loginPageValues(gin.H{"username": request.Username, "next": localRedirectPath(request.Next)}), err)
+		return
+	}
+	username, password := request.Username, request.Password
 
-	// Validate user credentials
-	user, err := userService.GetUserByUsername(username)
-	if err != nil || user == nil {
-		context.HTML(http.StatusUnauthorized, "error.html", gin.H{"error": "Invalid credentials"})
+	// Validate user credentials with the backends set up, such as a
+	// directory, or against the local passwords
+	authenticator := middlewares.GetAuthenticator(context)
+	if authenticator == nil {
+		authenticator = &services.LocalAuthenticator{Users: userService}
+	}
+	user, err := authenticator.Authenticate(username, password)
+	if err != nil {
+		if user != nil {
+			recordLogin(context, user.Username, user, models.AuditFailure)
+		} else {
+			recordLogin(context, username, nil, models.AuditFailure)
+		}
+		switch {
+		case errors.Is(err, services.ErrDirectoryUnavailable):
+			context.HTML(http.StatusServiceUnavailable, "error.html", gin.H{"error": "Login is unavailable, please try again later"})
+		case errors.Is(err, services.ErrDirectoryUserConflict):
+			context.HTML(http.StatusForbidden, "error.html", gin.H{"error": err.Error()})
+		default:
+			if !errors.Is(err, services.ErrInvalidCredentials) {
+				log.Printf("Failed to check the credentials of %q: %v", username, err)
+			}
+			context.HTML(http.StatusUnauthorized, "error.html", gin.H{"error": "Invalid credentials"})
+		}
 		return
 	}
 
-	// Check password
-	if err := userService.CheckPassword(user.Password, password); err != nil {
-		context.HTML(http.StatusUnauthorized, "error.html", gin.H{"error": "Invalid credentials"})
+	// Suspended, locked and deactivated users keep their password but
+	// cannot log in, nor can new users awaiting approval or the
+	// verification of their address
+	if err := services.AccountStatusError(user); err != nil {
+		recordLogin(context, user.Username, user, models.AuditFailure)
+		if registrationService := middlewares.GetRegistrationService(context); registrationService != nil && errors.Is(err, services.ErrEmailUnverified) {
+			if err := registrationService.SendVerification(user); err != nil {
+				log.Printf("Failed to send the verification email of user %d: %v", user.ID, err)
+			}
+		}
+		context.HTML(http.StatusForbidden, "error.html", gin.H{"error": accountStatusMessage(err)})
 		return
 	}
 
-	// Generate JWT token using the helper function
-	token, err := utils.GenerateJWT(user) // Call the helper function from utils
+	// Users with a passkey confirm the login with it, which is recorded
+	// once they do
+	if beginSecondFactor(context, user, localRedirectPath(request.Next)) {
+		return
+	}
+
+	// Issue the session token
+	token, err := startSession(context, user) // Recorded in the active sessions
 	if err != nil {
 		context.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Could not generate token"})
 		return
@@ -137,6 +259,14 @@ func LoginUser(context *gin.Context, userService services.UserServiceInterface)
 
 	// Set the token as a cookie (optional but useful for session management)
 	context.SetCookie("Authorization", token, 3600, "/", "localhost", false, true)
+	recordLogin(context, user.Username, user, models.AuditSuccess)
+
+	// Go back to the page that asked for a login, such as an OpenID Connect
+	// authorization request
+	if next := localRedirectPath(request.Next); next != "" {
+		context.Redirect(http.StatusSeeOther, next)
+		return
+	}
 
 	// Render the home.html file
 	context.HTML(http.StatusOK, "home.html", gin.H{
@@ -147,28 +277,75 @@ func LoginUser(context *gin.Context, userService services.UserServiceInterface)
 
 // RegisterUser handles the HTTP POST request for user registration.
 //
-// It extracts the username and password from the form data,
-// calls the userService to manage the registration logic,
-// and returns a JSON response indicating the registration outcome.
+// It binds the username, password and email address from the form or JSON
+// body, calls the userService to manage the registration logic, or the
+// registration service when a registration policy is set up, records the
+// registration in the audit log, and logs the new user in.
 //
-// If registration is successful, it responds with HTTP status 200
-// and a success message. If an error occurs, it responds with
-// HTTP status 400 and an error message.
+// If registration is successful, it redirects the user to the home page.
+// Accounts that must first be approved by an admin, or whose email address
+// must be verified, are not logged in: the register.html template explains
+// what happens next, and JSON clients get the user with HTTP status 202.
+// If the request is invalid or the username or password breaks a policy, it
+// responds with HTTP status 400 and the field-level errors, rendered in the
+// register.html template or returned as JSON. If the policy closes
+// registration, it responds with HTTP status 403. Any other error is
+// reported with its message.
 func RegisterUser(context *gin.Context, userService services.UserServiceInterface) {
-	// Extract credentials from the request
-	username := context.PostForm("username")
-	password := context.PostForm("password")
+	registrationService := middlewares.GetRegistrationService(context)
+	values := registerPageValues(registrationService, gin.H{})
+
+	// Bind and validate the request
+	var request RegisterRequest
+	if err := bindRequest(context, &request); err != nil {
+		values["username"], values["email"] = request.Username, request.Email
+		renderFormError(context, http.StatusBadRequest, "register.html", values, err)
+		return
+	}
 
-	// Call the userService to handle registration logic
-	err := userService.RegisterUser(username, password)
+	// Call the userService to handle registration logic, applying the
+	// registration policy if there is one
+	var user *models.User
+	var err error
+	if registrationService != nil {
+		user, err = registrationService.Register(request.Username, request.Password, request.Email)
+	} else if err = userService.RegisterUser(request.Username, request.Password); err == nil {
+		user, _ = userService.GetUserByUsername(request.Username)
+	}
 	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrRegistrationDisabled) || errors.Is(err, services.ErrRegistrationInviteOnly) {
+			status = http.StatusForbidden
+		}
+		values["username"], values["email"] = request.Username, request.Email
+		renderFormError(context, status, "register.html", values, err)
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditRegister,
+		Outcome:        models.AuditSuccess,
+		ActorID:        userRef(user),
+		ActorUsername:  request.Username,
+		TargetID:       userRef(user),
+		TargetUsername: request.Username,
+		Changes:        services.AuditChanges(nil, services.UserAuditState(user)),
+	})
+
+	// Accounts awaiting approval or verification cannot log in yet
+	if user != nil && !user.Active() {
+		message := accountStatusMessage(services.AccountStatusError(user))
+		if wantsJSON(context) {
+			context.JSON(http.StatusAccepted, gin.H{"user": user, "message": message})
+			return
+		}
+		values["notice"] = message
+		context.HTML(http.StatusOK, "register.html", values)
 		return
 	}
 
 	// Generate JWT token after successful registration
-	user, _ := userService.GetUserByUsername(username)
-	token, err := utils.GenerateJWT(user)
+	token, err := startSession(context, user)
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -184,8 +361,9 @@ func RegisterUser(context *gin.Context, userService services.UserServiceInterfac
 // UserRegisterForm handles the HTTP GET request for the registration form.
 //
 // It checks for an existing Authorization cookie. If it exists, it redirects
-// to /home. If not, it renders the register.html template with an empty
-// gin.H object.
+// to /home. If not, it renders the register.html template with the
+// registration mode, which tells whether the form is shown and asks for an
+// email address.
 func UserRegisterForm(context *gin.Context) {
 	// Use the helper function to check for redirection
 	if middlewares.RedirectIfAuthenticated(context) {
@@ -193,5 +371,122 @@ func UserRegisterForm(context *gin.Context) {
 	}
 
 	// If no token, render the register page
-	context.HTML(http.StatusOK, "register.html", gin.H{})
+	context.HTML(http.StatusOK, "register.html", registerPageValues(middlewares.GetRegistrationService(context), gin.H{}))
+}
+
+// registerPageValues returns the values of the register page under the
+// registration policy of the service, if any, with the given extra values
+func registerPageValues(registrationService services.RegistrationServiceInterface, values gin.H) gin.H {
+	policy := services.RegistrationPolicy{Mode: services.RegistrationOpen}
+	if registrationService != nil {
+		policy = registrationService.Policy()
+	}
+	values["mode"] = policy.Mode
+	values["emailRequired"] = policy.EmailRequired()
+	values["allowedDomains"] = policy.AllowedDomains
+	return values
+}
+
+// accountStatusMessage returns the message shown to a user whose account
+// cannot be used, for an error returned by services.AccountStatusError
+func accountStatusMessage(err error) string {
+	switch {
+	case errors.Is(err, services.ErrAccountPending):
+		return "Thanks for registering! An administrator will review your account, and you will get an email once it is approved."
+	case errors.Is(err, services.ErrEmailUnverified):
+		return "Almost done! Follow the link we emailed you to verify your address and activate your account."
+	case errors.Is(err, services.ErrAccountSuspended):
+		return "This account has been suspended. Contact an administrator."
+	case errors.Is(err, services.ErrAccountLocked):
+		return "This account has been locked for your protection. Contact an administrator."
+	default:
+		return "This account has been deactivated"
+	}
+}
+
+// recordLogin records a login attempt in the audit log and, when logins are
+// recorded, in the login history of the user. The user is nil when the
+// username does not exist.
+func recordLogin(context *gin.Context, username string, user *models.User, outcome string) {
+	recordAudit(context, models.AuditEvent{
+		Action:         models.AuditLogin,
+		Outcome:        outcome,
+		ActorID:        userRef(user),
+		ActorUsername:  username,
+		TargetID:       userRef(user),
+		TargetUsername: username,
+	})
+
+	if loginHistoryService := middlewares.GetLoginHistoryService(context); loginHistoryService != nil {
+		_, err := loginHistoryService.RecordLogin(username, user, outcome, context.ClientIP(), context.Request.UserAgent())
+		if err != nil {
+			log.Printf("Failed to record the login of %q: %v", username, err)
+		}
+	}
+}
+
+// renderFormError responds to a form or JSON request that failed.
+//
+// JSON clients receive the error message and, when fields were rejected by
+// validation or by the username and password policies, an "errors" list with
+// one entry per broken rule. Form submissions get the template back with the
+// same information, the field errors grouped by field in "fieldErrors", and
+// the submitted values so the form can be filled in again.
+func renderFormError(context *gin.Context, status int, template string, values gin.H, err error) {
+	response := gin.H{"error": err.Error()}
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		validationErr = policyFieldErrors(err)
+	}
+	if validationErr != nil {
+		response["error"] = "Please correct the highlighted fields"
+		response["errors"] = validationErr.Fields
+	}
+
+	if wantsJSON(context) {
+		context.JSON(status, response)
+		return
+	}
+
+	for key, value := range values {
+		response[key] = value
+	}
+	if validationErr != nil {
+		response["fieldErrors"] = validationErr.ByField()
+	}
+	context.HTML(status, template, response)
+}
+
+// registrationErrorStatus returns the HTTP status for an error returned by
+// UserService.RegisterUser: the client's fault for policy violations and
+// taken usernames, the server's otherwise
+func registrationErrorStatus(err error) int {
+	if policyFieldErrors(err) != nil || errors.Is(err, services.ErrUserExists) || errors.Is(err, services.ErrUsernameConfusable) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// localRedirectPath returns the path if it is safe to redirect to after a
+// login: an absolute path on this site. Anything else, including
+// protocol-relative URLs such as //evil.example, gives an empty string.
+func localRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return ""
+	}
+	parsed, err := url.Parse(path)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" {
+		return ""
+	}
+	return path
+}
+
+// wantsJSON reports whether the client sent or asked for JSON rather than
+// an HTML form and page
+func wantsJSON(context *gin.Context) bool {
+	if context.ContentType() == gin.MIMEJSON {
+		return true
+	}
+	return context.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON
 }
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// RegisterUserLifecycleRoutes registers the routes for changing the status
+// of accounts.
+//
+// They are only available to authenticated users with the admin role, and
+// personal access tokens need the users:write scope. The
+// userLifecycleService parameter is used by the handlers to suspend,
+// reactivate, lock and deactivate accounts.
+func RegisterUserLifecycleRoutes(r *gin.Engine, userLifecycleService services.UserLifecycleServiceInterface) {
+	admin := r.Group("/api/v1/admin/users")
+	admin.Use(middlewares.AuthMiddleware(), middlewares.RequireRole(models.RoleAdmin), middlewares.RequireScope(models.ScopeUsersWrite))
+	{
+		admin.POST("/:id/suspend", func(c *gin.Context) { SetUserStatus(c, userLifecycleService, models.UserStatusSuspended) })
+		admin.POST("/:id/reactivate", func(c *gin.Context) { SetUserStatus(c, userLifecycleService, models.UserStatusActive) })
+		admin.POST("/:id/status", func(c *gin.Context) { SetUserStatus(c, userLifecycleService, "") })
+	}
+}
+
+// SetUserStatus handles the HTTP POST requests changing the status of an
+// account.
+//
+// It binds the reason, and the status unless the route implies one, from
+// the form or JSON body, changes the status of the user with the ID in the
+// path using the provided userLifecycleService and records it in the audit
+// log. Suspending, locking or deactivating an account ends its sessions at
+// once. JSON clients get the user and their previous status; forms are
+// redirected back to the home page.
+//
+// If the status is unknown or the reason is missing or too long, it
+// responds with HTTP status 400, and with HTTP status 409 if the account
+// cannot change to the status from its current one. Admins changing their
+// own status get HTTP status 403, and unknown users HTTP status 404.
+func SetUserStatus(context *gin.Context, userLifecycleService services.UserLifecycleServiceInterface, status string) {
+	actorID, ok := currentUserID(context)
+	if !ok {
+		renderFormError(context, http.StatusUnauthorized, "error.html", nil, errors.New("Authorization token not provided"))
+		return
+	}
+	userID, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err != nil {
+		renderFormError(context, http.StatusNotFound, "error.html", nil, services.ErrUserNotFound)
+		return
+	}
+
+	var request SetUserStatusRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderFormError(context, http.StatusBadRequest, "error.html", nil, err)
+		return
+	}
+	if status == "" {
+		status = request.Status
+	}
+
+	user, previousStatus, err := userLifecycleService.Transition(actorID, uint(userID), status, request.Reason)
+	if err != nil {
+		code := userStatusErrorStatus(err)
+		if code == http.StatusInternalServerError {
+			log.Printf("Failed to change the status of user %d: %v", userID, err)
+			err = errors.New("Failed to change the status of the account")
+		}
+		renderFormError(context, code, "error.html", nil, err)
+		return
+	}
+
+	action := models.AuditStatusChange
+	switch user.Status {
+	case models.UserStatusSuspended:
+		action = models.AuditUserSuspend
+	case models.UserStatusActive:
+		action = models.AuditUserReactivate
+	}
+	recordAudit(context, models.AuditEvent{
+		Action:         action,
+		Outcome:        models.AuditSuccess,
+		TargetID:       &user.ID,
+		TargetUsername: user.Username,
+		Changes: services.AuditChanges(
+			map[string]interface{}{"status": previousStatus},
+			map[string]interface{}{"status": user.Status, "reason": user.StatusReason},
+		),
+	})
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"user": user, "previous_status": previousStatus})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, "/api/v1/user/home")
+}
+
+// userStatusErrorStatus returns the HTTP status for an error returned by
+// the UserLifecycleService
+func userStatusErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUnknownStatus), errors.Is(err, services.ErrStatusReasonRequired),
+		errors.Is(err, services.ErrStatusReasonTooLong):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrOwnStatus):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrIllegalTransition):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
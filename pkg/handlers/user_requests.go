@@ -0,0 +1,138 @@
+package handlers
+
+import "BuildasTechnicalAssessmentGo/pkg/services"
+
+// RegisterRequest is the body of the registration and add user requests.
+//
+// It can be sent as JSON, as a URL encoded form or as a multipart form. The
+// username and password are checked against the username and password
+// policies. The email address is only used by registration, and required by
+// some registration modes.
+type RegisterRequest struct {
+	Username string `form:"username" json:"username" binding:"required,username"`
+	Password string `form:"password" json:"password" binding:"required,password"`
+	Email    string `form:"email" json:"email" binding:"omitempty,email"`
+}
+
+// LoginRequest is the body of the login request. Next is the local page to
+// go back to after logging in, if any.
+type LoginRequest struct {
+	Username string `form:"username" json:"username" binding:"required"`
+	Password string `form:"password" json:"password" binding:"required"`
+	Next     string `form:"next" json:"next"`
+}
+
+// CreateAccessTokenRequest is the body of the request minting a personal
+// access token. Scopes are sent as repeated form fields or a JSON array.
+type CreateAccessTokenRequest struct {
+	Name          string   `form:"name" json:"name" binding:"required,max=100"`
+	Scopes        []string `form:"scopes" json:"scopes" binding:"required"`
+	ExpiresInDays int      `form:"expires_in_days" json:"expires_in_days" binding:"required,min=1"`
+}
+
+// CreateOAuthClientRequest is the body of the request registering an
+// OpenID Connect client. Redirect URIs are separated by spaces or new lines.
+type CreateOAuthClientRequest struct {
+	Name         string `form:"name" json:"name" binding:"required,max=100"`
+	RedirectURIs string `form:"redirect_uris" json:"redirect_uris" binding:"required"`
+	Public       bool   `form:"public" json:"public"`
+}
+
+// CreateOrganizationRequest is the body of the request creating an
+// organization. The slug is derived from the name when empty.
+type CreateOrganizationRequest struct {
+	Name string `form:"name" json:"name" binding:"required,max=100"`
+	Slug string `form:"slug" json:"slug" binding:"max=40"`
+}
+
+// SwitchOrganizationRequest is the body of the request switching the active
+// organization of the session
+type SwitchOrganizationRequest struct {
+	OrganizationID uint `form:"organization_id" json:"organization_id" binding:"required"`
+}
+
+// AddMemberRequest is the body of the request adding an existing user to
+// the active organization. The role defaults to member.
+type AddMemberRequest struct {
+	Username string `form:"username" json:"username" binding:"required"`
+	Role     string `form:"role" json:"role"`
+}
+
+// SetMemberRoleRequest is the body of the request changing the role of a
+// member of the active organization
+type SetMemberRoleRequest struct {
+	Role string `form:"role" json:"role" binding:"required"`
+}
+
+// CreateInvitationRequest is the body of the request inviting someone to
+// the active organization. The role defaults to user and the organization
+// role to member.
+type CreateInvitationRequest struct {
+	Email   string `form:"email" json:"email" binding:"required,email"`
+	Role    string `form:"role" json:"role"`
+	OrgRole string `form:"org_role" json:"org_role"`
+}
+
+// SetUserStatusRequest is the body of the requests changing the status of
+// an account. The status is implied by the suspend and reactivate
+// requests; a reason is required to suspend, lock or deactivate an account.
+type SetUserStatusRequest struct {
+	Status string `form:"status" json:"status"`
+	Reason string `form:"reason" json:"reason" binding:"max=500"`
+}
+
+// ImpersonationRequest is the body of the request starting to impersonate a
+// user. The reason, such as a support ticket, is kept in the audit log.
+type ImpersonationRequest struct {
+	Reason string `form:"reason" json:"reason" binding:"required,max=500"`
+}
+
+// ChangePasswordRequest is the body of the request changing the password of
+// the authenticated user. The new password is checked against the password
+// policy.
+type ChangePasswordRequest struct {
+	CurrentPassword string `form:"current_password" json:"current_password" binding:"required"`
+	Password        string `form:"password" json:"password" binding:"required,password"`
+}
+
+// UpdateProfileRequest is the body of the request updating the profile of
+// the authenticated user. Empty fields are cleared.
+type UpdateProfileRequest struct {
+	DisplayName string `form:"display_name" json:"display_name" binding:"max=100"`
+	GivenName   string `form:"given_name" json:"given_name" binding:"max=100"`
+	FamilyName  string `form:"family_name" json:"family_name" binding:"max=100"`
+	Email       string `form:"email" json:"email" binding:"omitempty,email"`
+}
+
+// ChangeUsernameRequest is the body of the request changing the username of
+// the authenticated user. The username is checked against the username
+// policy.
+type ChangeUsernameRequest struct {
+	Username string `form:"username" json:"username" binding:"required,username"`
+}
+
+// MagicLinkRequest is the body of the request emailing a login link. The
+// identifier is a username or an email address.
+type MagicLinkRequest struct {
+	Identifier string `form:"identifier" json:"identifier" binding:"required,max=254"`
+}
+
+// MagicLinkLoginRequest is the body of the request logging in with a login
+// link
+type MagicLinkLoginRequest struct {
+	Token string `form:"token" json:"token" binding:"required"`
+}
+
+// PasskeyRegisterRequest is the body of the request adding a passkey to the
+// account of the authenticated user: the credential created by the
+// browser, and a name telling it apart from the other passkeys of the user
+type PasskeyRegisterRequest struct {
+	Name       string                       `json:"name" binding:"max=64"`
+	Credential services.PublicKeyCredential `json:"credential"`
+}
+
+// PasskeyLoginRequest is the body of the request logging in with a
+// passkey: the credential the browser got from the authenticator
+type PasskeyLoginRequest struct {
+	Credential services.PublicKeyCredential `json:"credential"`
+}
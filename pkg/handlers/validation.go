@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// The policies used by the "username" and "password" validation tags. They
+// default to the service defaults and are replaced by SetValidationPolicies.
+var (
+	usernamePolicy = services.DefaultUsernamePolicy()
+	passwordPolicy = services.DefaultPasswordPolicy()
+)
+
+// FieldError describes why the value of a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned by bindRequest when the request body does not
+// satisfy the validation tags of the request struct
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error joins the messages of all field errors
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ByField groups the messages by field name, for the templates
+func (e *ValidationError) ByField() map[string][]string {
+	fields := make(map[string][]string)
+	for _, field := range e.Fields {
+		fields[field.Field] = append(fields[field.Field], field.Message)
+	}
+	return fields
+}
+
+func init() {
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	// Report fields by the name clients use for them
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			return field.Name
+		}
+		return name
+	})
+
+	_ = validate.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		_, err := usernamePolicy.Normalize(fl.Field().String())
+		return err == nil
+	})
+	_ = validate.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+		return passwordPolicy.Validate(siblingUsername(fl.Parent()), fl.Field().String()) == nil
+	})
+}
+
+// SetValidationPolicies sets the username and password policies used by the
+// "username" and "password" validation tags
+func SetValidationPolicies(username *services.UsernamePolicy, password *services.PasswordPolicy) {
+	usernamePolicy, passwordPolicy = username, password
+}
+
+// bindRequest binds the request body to the given struct and validates it.
+//
+// The binding is chosen from the method and the Content-Type, so JSON, URL
+// encoded forms and multipart forms are all accepted. It returns a
+// *ValidationError with one entry per broken rule when the values are
+// invalid, or a plain error when the body cannot be decoded at all.
+func bindRequest(context *gin.Context, request interface{}) error {
+	err := context.ShouldBind(request)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return errors.New("invalid request body")
+	}
+
+	username := siblingUsername(reflect.ValueOf(request))
+	result := &ValidationError{}
+	for _, fieldErr := range validationErrors {
+		result.Fields = append(result.Fields, translateFieldError(fieldErr, username)...)
+	}
+	return result
+}
+
+// policyFieldErrors converts the violations of a username or password policy
+// error into field errors. It returns nil for any other error.
+func policyFieldErrors(err error) *ValidationError {
+	var usernameErr *services.UsernamePolicyError
+	var passwordErr *services.PasswordPolicyError
+	switch {
+	case errors.As(err, &usernameErr):
+		return &ValidationError{Fields: violationsToFieldErrors("username", usernameErr.Violations)}
+	case errors.As(err, &passwordErr):
+		return &ValidationError{Fields: violationsToFieldErrors("password", passwordErr.Violations)}
+	}
+	return nil
+}
+
+// translateFieldError returns the human readable errors for a failed
+// validation tag. The username and password tags expand into one error per
+// violated policy rule; the username of the request is needed to explain
+// password violations.
+func translateFieldError(fieldErr validator.FieldError, username string) []FieldError {
+	field := fieldErr.Field()
+	label := strings.ToUpper(field[:1]) + field[1:]
+
+	switch fieldErr.Tag() {
+	case "username":
+		_, err := usernamePolicy.Normalize(fieldErr.Value().(string))
+		if validationErr := policyFieldErrors(err); validationErr != nil {
+			return validationErr.Fields
+		}
+	case "password":
+		err := passwordPolicy.Validate(username, fieldErr.Value().(string))
+		if validationErr := policyFieldErrors(err); validationErr != nil {
+			return validationErr.Fields
+		}
+	}
+
+	var message string
+	switch fieldErr.Tag() {
+	case "required":
+		message = fmt.Sprintf("%s is required", label)
+	case "min":
+		message = fmt.Sprintf("%s must be at least %s%s", label, fieldErr.Param(), lengthUnit(fieldErr.Kind()))
+	case "max":
+		message = fmt.Sprintf("%s must be at most %s%s", label, fieldErr.Param(), lengthUnit(fieldErr.Kind()))
+	case "email":
+		message = fmt.Sprintf("%s must be a valid email address", label)
+	case "oneof":
+		message = fmt.Sprintf("%s must be one of: %s", label, fieldErr.Param())
+	default:
+		message = fmt.Sprintf("%s is invalid", label)
+	}
+	return []FieldError{{Field: field, Rule: fieldErr.Tag(), Message: message}}
+}
+
+// lengthUnit returns the unit of the min and max tags: strings are limited
+// in characters, lists in items and numbers in value
+func lengthUnit(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return " characters long"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return " items long"
+	}
+	return ""
+}
+
+// violationsToFieldErrors attaches policy violations to a field
+func violationsToFieldErrors(field string, violations []services.PolicyViolation) []FieldError {
+	fieldErrors := make([]FieldError, len(violations))
+	for i, violation := range violations {
+		fieldErrors[i] = FieldError{Field: field, Rule: violation.Rule, Message: violation.Message}
+	}
+	return fieldErrors
+}
+
+// siblingUsername returns the Username field of the struct being validated,
+// if there is one
+func siblingUsername(parent reflect.Value) string {
+	if parent.Kind() == reflect.Ptr {
+		parent = parent.Elem()
+	}
+	if parent.Kind() != reflect.Struct {
+		return ""
+	}
+	if username := parent.FieldByName("Username"); username.Kind() == reflect.String {
+		return username.String()
+	}
+	return ""
+}
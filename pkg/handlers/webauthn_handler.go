@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// webAuthnPath is the prefix of the passkey routes
+const webAuthnPath = "/api/v1/user/webauthn"
+
+// passkeysEnabled tells the login form to offer passkeys. It is set by
+// RegisterWebAuthnRoutes.
+var passkeysEnabled bool
+
+// RegisterWebAuthnRoutes registers the routes for passkeys: logging in with
+// one without a password, and adding and removing the passkeys of the
+// authenticated user. Users with a passkey are also asked for it by
+// LoginUser after their password, when the webAuthnService is made
+// available by the middleware.WebAuthnMiddleware function.
+//
+// The ceremonies are run by the JavaScript of the pages, which posts JSON
+// to these routes. The login routes are metered by the
+// middleware.RateLimitMiddleware function using the rateLimitService.
+// Passkeys are managed from browser sessions only: personal access tokens,
+// even with the users:write scope, service accounts and admins
+// impersonating the user cannot add or remove them.
+func RegisterWebAuthnRoutes(r *gin.Engine, webAuthnService services.WebAuthnServiceInterface, rateLimitService services.RateLimitServiceInterface) {
+	passkeysEnabled = true
+
+	login := r.Group(webAuthnPath + "/login")
+	login.Use(middlewares.RateLimitMiddleware(rateLimitService))
+	{
+		login.POST("/begin", func(c *gin.Context) { BeginPasskeyLogin(c, webAuthnService) })
+		login.POST("/finish", func(c *gin.Context) { FinishPasskeyLogin(c, webAuthnService) })
+	}
+
+	passkeys := r.Group(webAuthnPath)
+	passkeys.Use(middlewares.AuthMiddleware(), middlewares.RequireScope(models.ScopeUsersWrite), middlewares.DenyImpersonation())
+	{
+		passkeys.POST("/register/begin", func(c *gin.Context) { BeginPasskeyRegistration(c, webAuthnService) })
+		passkeys.POST("/register/finish", func(c *gin.Context) { FinishPasskeyRegistration(c, webAuthnService) })
+		passkeys.POST("/credentials/:id/delete", func(c *gin.Context) { RemovePasskey(c, webAuthnService) })
+		passkeys.DELETE("/credentials/:id", func(c *gin.Context) { RemovePasskey(c, webAuthnService) })
+	}
+}
+
+// BeginPasskeyLogin handles the HTTP POST request starting a passwordless
+// login. It responds with the options of navigator.credentials.get in
+// "public_key".
+func BeginPasskeyLogin(context *gin.Context, webAuthnService services.WebAuthnServiceInterface) {
+	options, err := webAuthnService.BeginLogin()
+	if err != nil {
+		log.Printf("Failed to start a passkey login: %v", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start the passkey login"})
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"public_key": options})
+}
+
+// FinishPasskeyLogin handles the HTTP POST request completing a login with
+// a passkey, either passwordless or as the second factor after a password.
+//
+// It verifies the credential posted with the provided webAuthnService,
+// records the login like LoginUser and sets the session cookie. JSON
+// clients get the token, the user and the page to go to next; forms are
+// redirected there. It responds with HTTP status 401 if the passkey is
+// unknown or does not verify, and 403 if the account may not log in.
+func FinishPasskeyLogin(context *gin.Context, webAuthnService services.WebAuthnServiceInterface) {
+	var request PasskeyLoginRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderFormError(context, http.StatusBadRequest, "error.html", nil, err)
+		return
+	}
+
+	login, err := webAuthnService.FinishLogin(&request.Credential)
+	if err != nil {
+		if login != nil {
+			recordLogin(context, login.User.Username, login.User, models.AuditFailure)
+		}
+		switch {
+		case errors.Is(err, services.ErrWebAuthnChallenge), errors.Is(err, services.ErrWebAuthnInvalid),
+			errors.Is(err, services.ErrWebAuthnUnknownCredential):
+			renderFormError(context, http.StatusUnauthorized, "error.html", nil, err)
+		case login != nil:
+			renderFormError(context, http.StatusForbidden, "error.html", nil, errors.New(accountStatusMessage(err)))
+		default:
+			log.Printf("Failed to log in with a passkey: %v", err)
+			renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to log in, please try again later"))
+		}
+		return
+	}
+
+	user := login.User
+	token, err := startSession(context, user) // Recorded in the active sessions
+	if err != nil {
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Could not generate token"))
+		return
+	}
+	context.SetCookie("Authorization", token, 3600, "/", "localhost", false, true)
+	recordLogin(context, user.Username, user, models.AuditSuccess)
+
+	next := localRedirectPath(login.Next)
+	if next == "" {
+		next = "/api/v1/user/home"
+	}
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"token": token, "user": user, "next": next})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, next)
+}
+
+// BeginPasskeyRegistration handles the HTTP POST request starting to add a
+// passkey to the account of the authenticated user. It responds with the
+// options of navigator.credentials.create in "public_key".
+func BeginPasskeyRegistration(context *gin.Context, webAuthnService services.WebAuthnServiceInterface) {
+	userID, ok := sessionUserID(context)
+	if !ok {
+		return
+	}
+	options, err := webAuthnService.BeginRegistration(userID)
+	if err != nil {
+		log.Printf("Failed to start the passkey registration of user %d: %v", userID, err)
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to add a passkey"))
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"public_key": options})
+}
+
+// FinishPasskeyRegistration handles the HTTP POST request adding a passkey
+// to the account of the authenticated user.
+//
+// It verifies the credential posted with the provided webAuthnService,
+// saves it under the name given and records it in the audit log. JSON
+// clients get the passkey with HTTP status 201; forms are redirected back
+// to the account page. It responds with HTTP status 400 if the credential
+// does not verify, and 409 if it is already registered.
+func FinishPasskeyRegistration(context *gin.Context, webAuthnService services.WebAuthnServiceInterface) {
+	userID, ok := sessionUserID(context)
+	if !ok {
+		return
+	}
+	var request PasskeyRegisterRequest
+	if err := bindRequest(context, &request); err != nil {
+		renderFormError(context, http.StatusBadRequest, "error.html", nil, err)
+		return
+	}
+
+	credential, err := webAuthnService.FinishRegistration(userID, request.Name, &request.Credential)
+	switch {
+	case errors.Is(err, services.ErrWebAuthnChallenge), errors.Is(err, services.ErrWebAuthnInvalid):
+		renderFormError(context, http.StatusBadRequest, "error.html", nil, err)
+		return
+	case errors.Is(err, services.ErrWebAuthnCredentialExists):
+		renderFormError(context, http.StatusConflict, "error.html", nil, err)
+		return
+	case err != nil:
+		log.Printf("Failed to add a passkey to user %d: %v", userID, err)
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to add the passkey"))
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:   models.AuditPasskeyAdd,
+		Outcome:  models.AuditSuccess,
+		TargetID: &userID,
+		Changes:  services.AuditChanges(nil, map[string]interface{}{"passkey_id": credential.ID, "name": credential.Name}),
+	})
+	if wantsJSON(context) {
+		context.JSON(http.StatusCreated, gin.H{"passkey": credential})
+		return
+	}
+	context.Redirect(http.StatusSeeOther, accountPath+"?updated=passkey")
+}
+
+// RemovePasskey handles the HTTP POST and DELETE requests removing a
+// passkey of the authenticated user.
+//
+// It removes the passkey with the ID in the path and records it in the
+// audit log. JSON clients get HTTP status 204; forms are redirected back to
+// the account page. If the user has no such passkey, it responds with HTTP
+// status 404.
+func RemovePasskey(context *gin.Context, webAuthnService services.WebAuthnServiceInterface) {
+	userID, ok := sessionUserID(context)
+	if !ok {
+		return
+	}
+	passkeyID, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err == nil {
+		err = webAuthnService.RemoveCredential(userID, uint(passkeyID))
+	} else {
+		err = services.ErrWebAuthnCredentialMissing
+	}
+
+	switch {
+	case errors.Is(err, services.ErrWebAuthnCredentialMissing):
+		renderFormError(context, http.StatusNotFound, "error.html", nil, err)
+		return
+	case err != nil:
+		log.Printf("Failed to remove passkey %d of user %d: %v", passkeyID, userID, err)
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to remove the passkey"))
+		return
+	}
+
+	recordAudit(context, models.AuditEvent{
+		Action:   models.AuditPasskeyRemove,
+		Outcome:  models.AuditSuccess,
+		TargetID: &userID,
+		Changes:  services.AuditChanges(map[string]interface{}{"passkey_id": passkeyID}, nil),
+	})
+	if wantsJSON(context) {
+		context.Status(http.StatusNoContent)
+		return
+	}
+	context.Redirect(http.StatusSeeOther, accountPath+"?updated=passkey-removed")
+}
+
+// beginSecondFactor asks a user who logged in any other way than with a
+// passkey (a password, a login link or an external provider) for one of
+// their passkeys, when passkeys are enabled and the user has one. It
+// responds with the options of navigator.credentials.get, as JSON in
+// "public_key" or in the webauthn_login.html template, and returns true; it
+// returns false if the first factor is enough. Failing to start the check
+// fails the login.
+func beginSecondFactor(context *gin.Context, user *models.User, next string) bool {
+	webAuthnService := middlewares.GetWebAuthnService(context)
+	if webAuthnService == nil {
+		return false
+	}
+	options, err := webAuthnService.BeginSecondFactor(user, next)
+	if err != nil {
+		log.Printf("Failed to start the passkey check of user %d: %v", user.ID, err)
+		renderFormError(context, http.StatusInternalServerError, "error.html", nil, errors.New("Failed to log in, please try again later"))
+		return true
+	}
+	if options == nil {
+		return false
+	}
+
+	if wantsJSON(context) {
+		context.JSON(http.StatusOK, gin.H{"second_factor": "webauthn", "public_key": options})
+		return true
+	}
+	context.HTML(http.StatusOK, "webauthn_login.html", gin.H{"username": user.Username, "options": options})
+	return true
+}
+
+// userPasskeys returns the passkeys of a user for the account page, or nil
+// if passkeys are not enabled
+func userPasskeys(context *gin.Context, userID uint) ([]models.WebAuthnCredential, error) {
+	webAuthnService := middlewares.GetWebAuthnService(context)
+	if webAuthnService == nil {
+		return nil, nil
+	}
+	return webAuthnService.ListCredentials(userID)
+}
@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+// accessTokenServiceKey is the key of the access token service in the context
+const accessTokenServiceKey = "access_token_service"
+
+// AccessTokenMiddleware is a middleware that lets AuthMiddleware accept
+// personal access tokens, checked by the given service. Handlers retrieve
+// the service with GetAccessTokenService.
+func AccessTokenMiddleware(accessTokenService services.AccessTokenServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(accessTokenServiceKey, accessTokenService)
+		c.Next()
+	}
+}
+
+// GetAccessTokenService returns the service stored by AccessTokenMiddleware,
+// or nil if personal access tokens are not set up
+func GetAccessTokenService(c *gin.Context) services.AccessTokenServiceInterface {
+	if value, exists := c.Get(accessTokenServiceKey); exists {
+		if accessTokenService, ok := value.(services.AccessTokenServiceInterface); ok {
+			return accessTokenService
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package middlewares
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"regexp"
+)
+
+// Keys of the values stored in the gin context by the audit middlewares
+const (
+	RequestIDKey    = "request_id"
+	auditServiceKey = "audit_service"
+)
+
+// RequestIDHeader carries the ID of a request, from a proxy or to the client
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID matches the request IDs accepted from the client
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware is a middleware that gives every request an ID.
+//
+// It reuses the X-Request-ID header set by a proxy if it looks sane, or
+// generates a random one otherwise. The ID is stored in the context under
+// RequestIDKey and echoed in the X-Request-ID response header, so a request
+// can be traced from the client to the audit log.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Set(RequestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		// Proceed to the next handler
+		c.Next()
+	}
+}
+
+// newRequestID returns a random 128-bit request ID
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+// AuditMiddleware is a middleware that makes the audit service available to
+// the handlers, which retrieve it with GetAuditService.
+func AuditMiddleware(auditService services.AuditServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(auditServiceKey, auditService)
+		c.Next()
+	}
+}
+
+// GetAuditService returns the audit service stored by AuditMiddleware, or nil
+// if auditing is not set up for the request
+func GetAuditService(c *gin.Context) services.AuditServiceInterface {
+	if value, exists := c.Get(auditServiceKey); exists {
+		if auditService, ok := value.(services.AuditServiceInterface); ok {
+			return auditService
+		}
+	}
+	return nil
+}
@@ -1,10 +1,14 @@
 package middlewares
 
 import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -12,10 +16,89 @@ import (
 // in the Authorization cookie. It stores the parsed claims in the context for later
 // use by other handlers_test. If the token is missing or invalid, it sends an error response
 // with HTTP status 401 and aborts the request chain.
+//
+// Session tokens are verified with the service stored by TokenMiddleware.
+// Scripts can instead send an "Authorization: Bearer" header holding either a
+// session token or a personal access token. Personal access tokens are checked by the
+// service stored by AccessTokenMiddleware, and turned into claims for their
+// user with the granted scopes in Scope. Handlers retrieve the claims with
+// GetClaims.
+//
+// The account of the user is checked on every request with the service
+// stored by UserLifecycleMiddleware, so suspending, locking or deactivating
+// it ends its sessions at once, and so does changing its password for the
+// other sessions: they get an error response with HTTP status 401.
+//
+// Sessions are checked with the service stored by SessionMiddleware, which
+// also records when and from where each was last seen, so revoking one logs
+// it out at once with HTTP status 401.
+//
+// Internal services can instead present a client certificate, verified by
+// the TLS server against its CA bundle. It is checked by the service stored
+// by ClientCertificateMiddleware, and turned into claims for the user of the
+// service account it is mapped to, with the scopes granted to the account in
+// Scope. Tokens take precedence over client certificates, and certificates
+// mapped to no service account get an error response with HTTP status 401.
+//
+// Once authenticated, the request acts in the organization of the session
+// or token, resolved with the service stored by OrganizationMiddleware and
+// carried by the request context. Users with no access to it get an error
+// response with HTTP status 403.
+//
+// Requests made while an admin impersonates the user, whose token carries
+// the admin in its "act" claim, are recorded in the audit log under the name of
+// the admin once handled.
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get the token from the Authorization header
+		// Prefer the Authorization header sent by scripts
+		if header := c.GetHeader("Authorization"); header != "" {
+			claims, err := bearerClaims(c, header)
+			if err != nil {
+				c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+				abortWithError(c, http.StatusUnauthorized, err.Error())
+				return
+			}
+			if err := checkAccountStatus(c, claims); err != nil {
+				abortWithAccountError(c, err)
+				return
+			}
+			if err := checkSession(c, claims); err != nil {
+				abortWithAccountError(c, err)
+				return
+			}
+			if err := resolveTenant(c, claims); err != nil {
+				abortWithTenantError(c, err)
+				return
+			}
+			SetClaims(c, claims)
+			c.Next()
+			recordImpersonatedRequest(c, claims)
+			return
+		}
+
+		// Get the token from the Authorization cookie
 		token, err := c.Cookie("Authorization")
+
+		// Without one, accept the client certificate of internal services
+		if token == "" && hasClientCertificate(c) {
+			claims, err := clientCertificateClaims(c)
+			if err != nil {
+				abortWithClientCertificateError(c, err)
+				return
+			}
+			if err := checkAccountStatus(c, claims); err != nil {
+				abortWithAccountError(c, err)
+				return
+			}
+			if err := resolveTenant(c, claims); err != nil {
+				abortWithTenantError(c, err)
+				return
+			}
+			SetClaims(c, claims)
+			c.Next()
+			return
+		}
+
 		if token == "" {
 			c.HTML(http.StatusUnauthorized, "error.html", gin.H{"error": "Authorization token not provided"})
 			c.Abort()
@@ -26,45 +109,130 @@ func AuthMiddleware() gin.HandlerFunc {
 		token = strings.TrimPrefix(token, "Bearer ")
 
 		// Parse the token and check validity
-		claims, err := parseJWTToken(token)
+		claims, err := verifyToken(c, token)
 		if err != nil {
 			c.HTML(http.StatusUnauthorized, "error.html", gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
+		// Check that the account can still be used
+		if err := checkAccountStatus(c, claims); err != nil {
+			abortWithAccountError(c, err)
+			return
+		}
+
+		// Check that the session was not logged out
+		if err := checkSession(c, claims); err != nil {
+			abortWithAccountError(c, err)
+			return
+		}
+
+		// Act in the organization of the session
+		if err := resolveTenant(c, claims); err != nil {
+			abortWithTenantError(c, err)
+			return
+		}
+
 		// Store the claims in the context for later use
-		c.Set("claims", claims)
+		SetClaims(c, claims)
 
 		// Proceed to the next handler
 		c.Next()
+
+		// Attribute the request to the admin impersonating the user
+		recordImpersonatedRequest(c, claims)
 	}
 }
 
-// parseJWTToken takes a JWT token and returns the claims if the token is valid
-//
-// It takes a string argument containing the JWT token, and returns a pointer
-// to jwt.MapClaims and an error. If the token is invalid or missing, it
-// returns an error. If the token is valid, it returns a pointer to the claims
-// and nil.
-func parseJWTToken(token string) (*jwt.MapClaims, error) {
-	// Parse the JWT token and validate it
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		// Provide the secret key used for signing the token
-		return []byte("your_secret_key"), nil
-	})
+// bearerClaims returns the claims of the JWT or personal access token sent
+// in an Authorization header
+func bearerClaims(c *gin.Context, header string) (*models.Claims, error) {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, errors.New("Authorization header must be a Bearer token")
+	}
 
-	if err != nil || !parsedToken.Valid {
-		return nil, err
+	if !strings.HasPrefix(token, models.AccessTokenPrefix) {
+		claims, err := verifyToken(c, token)
+		if err != nil {
+			return nil, errors.New("Invalid token")
+		}
+		return claims, nil
 	}
 
-	// Get the claims from the parsed token
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, errors.New("invalid token claims")
+	accessTokenService := GetAccessTokenService(c)
+	if accessTokenService == nil {
+		return nil, errors.New("Access tokens are not accepted")
+	}
+	accessToken, err := accessTokenService.Authenticate(token, c.ClientIP())
+	if err != nil {
+		return nil, errors.New("Invalid or expired access token")
 	}
 
-	return &claims, nil
+	claims := &models.Claims{
+		Subject:  strconv.FormatUint(uint64(accessToken.UserID), 10),
+		Username: accessToken.User.Username,
+		Roles:    []string{accessToken.User.Role},
+		Scope:    accessToken.Scopes,
+		TokenID:  accessToken.ID,
+	}
+	if accessToken.OrganizationID != nil {
+		claims.OrganizationID = *accessToken.OrganizationID
+	}
+	return claims, nil
+}
+
+// SessionClaims returns the claims of the valid token in the Authorization
+// cookie, or nil if the browser has no session. Unlike AuthMiddleware, it
+// never aborts, so pages can send anonymous users to the login form.
+func SessionClaims(c *gin.Context) *models.Claims {
+	token, err := c.Cookie("Authorization")
+	if err != nil || token == "" {
+		return nil
+	}
+	claims, err := verifyToken(c, strings.TrimPrefix(token, "Bearer "))
+	if err != nil {
+		return nil
+	}
+	return claims
+}
+
+// AuthenticatedSession returns the claims of the session in the Authorization
+// cookie once checked like AuthMiddleware checks them: the account must
+// still be usable, the session not revoked and the organization resolved.
+// The claims are stored with SetClaims, so the audit log names the user. It
+// returns nil if the browser has no such session and, unlike AuthMiddleware,
+// never aborts, so pages can send users to the login form.
+func AuthenticatedSession(c *gin.Context) *models.Claims {
+	claims := SessionClaims(c)
+	if claims == nil {
+		return nil
+	}
+	if err := checkAccountStatus(c, claims); err != nil {
+		logSessionCheckError(err)
+		return nil
+	}
+	if err := checkSession(c, claims); err != nil {
+		logSessionCheckError(err)
+		return nil
+	}
+	if err := resolveTenant(c, claims); err != nil {
+		logSessionCheckError(err)
+		return nil
+	}
+	SetClaims(c, claims)
+	return claims
+}
+
+// logSessionCheckError logs the errors of AuthenticatedSession that are not
+// about the account, the session or the organization of the user
+func logSessionCheckError(err error) {
+	if errors.Is(err, services.ErrUserNotFound) || errors.Is(err, services.ErrSessionRevoked) || isAccountStatusError(err) ||
+		errors.Is(err, services.ErrNotMember) || errors.Is(err, services.ErrNoOrganization) {
+		return
+	}
+	log.Printf("Failed to check the session of the request: %v", err)
 }
 
 // RedirectIfAuthenticated checks for the presence of an Authorization cookie.
@@ -79,3 +247,36 @@ func RedirectIfAuthenticated(context *gin.Context) bool {
 	}
 	return false
 }
+
+// RequireRole is a middleware that only lets through users with the given
+// role. It relies on the claims stored by AuthMiddleware, so it must run
+// after it. Other users get an error response with HTTP status 403.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := GetClaims(c)
+		if claims == nil || !claims.HasRole(role) {
+			abortWithError(c, http.StatusForbidden, "You are not allowed to access this page")
+			return
+		}
+
+		// Proceed to the next handler
+		c.Next()
+	}
+}
+
+// RequireScope is a middleware that only lets through personal access tokens
+// granted the given scope. Browser sessions are not scoped and always pass.
+// It must run after AuthMiddleware. Tokens without the scope get an error
+// response with HTTP status 403.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims := GetClaims(c); claims != nil && !claims.HasScope(scope) {
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+			abortWithError(c, http.StatusForbidden, "This token is missing the "+scope+" scope")
+			return
+		}
+
+		// Proceed to the next handler
+		c.Next()
+	}
+}
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+// authenticatorKey is the key of the login authenticator in the context
+const authenticatorKey = "authenticator"
+
+// AuthenticatorMiddleware is a middleware that makes the given
+// authenticator, such as a chain of a directory and the local passwords,
+// available to the login handler. Handlers retrieve it with
+// GetAuthenticator.
+func AuthenticatorMiddleware(authenticator services.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(authenticatorKey, authenticator)
+		c.Next()
+	}
+}
+
+// GetAuthenticator returns the authenticator stored by
+// AuthenticatorMiddleware, or nil if only local passwords are checked
+func GetAuthenticator(c *gin.Context) services.Authenticator {
+	if value, exists := c.Get(authenticatorKey); exists {
+		if authenticator, ok := value.(services.Authenticator); ok {
+			return authenticator
+		}
+	}
+	return nil
+}
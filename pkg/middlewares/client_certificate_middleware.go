@@ -0,0 +1,75 @@
+package middlewares
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// clientCertificateServiceKey is the key of the client certificate service
+// in the context
+const clientCertificateServiceKey = "client_certificate_service"
+
+// ClientCertificateMiddleware is a middleware that lets AuthMiddleware
+// accept the client certificates of internal services, mapped to service
+// accounts by the given service. Handlers retrieve the service with
+// GetClientCertificateService.
+func ClientCertificateMiddleware(clientCertificateService services.ClientCertificateServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(clientCertificateServiceKey, clientCertificateService)
+		c.Next()
+	}
+}
+
+// GetClientCertificateService returns the service stored by
+// ClientCertificateMiddleware, or nil if client certificates are not
+// accepted
+func GetClientCertificateService(c *gin.Context) services.ClientCertificateServiceInterface {
+	if value, exists := c.Get(clientCertificateServiceKey); exists {
+		if clientCertificateService, ok := value.(services.ClientCertificateServiceInterface); ok {
+			return clientCertificateService
+		}
+	}
+	return nil
+}
+
+// hasClientCertificate reports whether the request came with a client
+// certificate verified by the TLS server and client certificates are
+// accepted. Certificates the server did not verify against its CA bundle
+// are ignored.
+func hasClientCertificate(c *gin.Context) bool {
+	return GetClientCertificateService(c) != nil && c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0
+}
+
+// clientCertificateClaims returns the claims of the service account the
+// verified client certificate of the request is mapped to, with the scopes
+// granted to the account
+func clientCertificateClaims(c *gin.Context) (*models.Claims, error) {
+	certificate := c.Request.TLS.VerifiedChains[0][0]
+	account, user, err := GetClientCertificateService(c).Authenticate(certificate)
+	if err != nil {
+		return nil, err
+	}
+	return &models.Claims{
+		Subject:        strconv.FormatUint(uint64(user.ID), 10),
+		Username:       user.Username,
+		Roles:          []string{user.Role},
+		Scope:          strings.Join(account.Scopes, " "),
+		ServiceAccount: account.ID,
+	}, nil
+}
+
+// abortWithClientCertificateError responds to a request whose client
+// certificate is mapped to no service account with HTTP status 401, and to
+// the others like abortWithAccountError
+func abortWithClientCertificateError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrUnknownClientCertificate) {
+		abortWithError(c, http.StatusUnauthorized, "This client certificate is not allowed")
+		return
+	}
+	abortWithAccountError(c, err)
+}
@@ -0,0 +1,173 @@
+package middlewares
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ImpersonationStopPath is the route that ends an impersonation, posted by
+// the button of the banner
+const ImpersonationStopPath = "/api/v1/user/impersonation/stop"
+
+// impersonationServiceKey is the key of the impersonation service in the
+// context
+const impersonationServiceKey = "impersonation_service"
+
+// ImpersonationMiddleware is a middleware that makes the given service
+// available to the home page, to offer impersonation to the admins allowed
+// to. Handlers retrieve the service with GetImpersonationService.
+func ImpersonationMiddleware(impersonationService services.ImpersonationServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(impersonationServiceKey, impersonationService)
+		c.Next()
+	}
+}
+
+// GetImpersonationService returns the service stored by
+// ImpersonationMiddleware, or nil if impersonation is not enabled
+func GetImpersonationService(c *gin.Context) services.ImpersonationServiceInterface {
+	if value, exists := c.Get(impersonationServiceKey); exists {
+		if impersonationService, ok := value.(services.ImpersonationServiceInterface); ok {
+			return impersonationService
+		}
+	}
+	return nil
+}
+
+// DenyImpersonation is a middleware that blocks sensitive actions, such as
+// changing the password or creating access tokens, during an
+// impersonation: they are left to the user. It must run after
+// AuthMiddleware. Impersonated requests get an error response with HTTP
+// status 403.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims := GetClaims(c); claims != nil && claims.Actor != nil {
+			abortWithError(c, http.StatusForbidden, services.ErrImpersonating.Error())
+			return
+		}
+
+		// Proceed to the next handler
+		c.Next()
+	}
+}
+
+// recordImpersonatedRequest records a request made during an impersonation
+// in the audit log, attributed to the admin, with its method, path and
+// response status. It runs once the request was handled, and does nothing
+// for other requests or when auditing is not set up.
+func recordImpersonatedRequest(c *gin.Context, claims *models.Claims) {
+	actor := claims.Actor
+	auditService := GetAuditService(c)
+	if actor == nil || auditService == nil {
+		return
+	}
+
+	outcome := models.AuditSuccess
+	if c.Writer.Status() >= http.StatusBadRequest {
+		outcome = models.AuditFailure
+	}
+	actorID := actor.UserID()
+	target := claims.UserID()
+	event := models.AuditEvent{
+		Action:         models.AuditImpersonatedRequest,
+		Outcome:        outcome,
+		ActorID:        &actorID,
+		ActorUsername:  actor.Username,
+		TargetID:       &target,
+		TargetUsername: claims.Username,
+		IP:             c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+		RequestID:      c.GetString(RequestIDKey),
+		Changes: services.AuditChanges(nil, map[string]interface{}{
+			"method": c.Request.Method,
+			"path":   c.Request.URL.Path,
+			"status": c.Writer.Status(),
+		}),
+	}
+	if err := auditService.Record(event); err != nil {
+		log.Printf("Failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+// ImpersonationBannerMiddleware is a middleware that shows a banner at the
+// top of every HTML page during an impersonation, naming the impersonated
+// user and the admin, with a button to stop impersonating.
+//
+// HTML responses are held back until the handler is done, and the banner is
+// inserted right after their opening body tag. Other responses are sent
+// unchanged.
+func ImpersonationBannerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := SessionClaims(c)
+		if claims == nil || claims.Actor == nil {
+			c.Next()
+			return
+		}
+
+		writer := &bannerWriter{ResponseWriter: c.Writer, banner: impersonationBanner(claims.Username, claims.Actor.Username)}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+		writer.flush()
+	}
+}
+
+// impersonationBanner returns the HTML of the banner
+func impersonationBanner(username, actor string) string {
+	return fmt.Sprintf(`<div class="impersonation-banner" role="alert">`+
+		`You are impersonating <strong>%s</strong> as %s. Everything you do is recorded in the audit log. `+
+		`<form method="POST" action="%s" class="inline-form"><button type="submit">Stop impersonating</button></form>`+
+		`</div>`, html.EscapeString(username), html.EscapeString(actor), ImpersonationStopPath)
+}
+
+// bannerWriter holds back HTML responses to insert the impersonation banner
+type bannerWriter struct {
+	gin.ResponseWriter
+	banner string
+	body   bytes.Buffer
+}
+
+// isHTML reports whether the response is an HTML page
+func (w *bannerWriter) isHTML() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "text/html")
+}
+
+// Write holds back HTML, and sends anything else
+func (w *bannerWriter) Write(data []byte) (int, error) {
+	if !w.isHTML() {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+// WriteString holds back HTML, and sends anything else
+func (w *bannerWriter) WriteString(s string) (int, error) {
+	if !w.isHTML() {
+		return w.ResponseWriter.WriteString(s)
+	}
+	return w.body.WriteString(s)
+}
+
+// flush sends the HTML held back, with the banner after the body tag
+func (w *bannerWriter) flush() {
+	if w.body.Len() == 0 {
+		return
+	}
+	page := w.body.String()
+	if start := strings.Index(strings.ToLower(page), "<body"); start >= 0 {
+		if end := strings.IndexByte(page[start:], '>'); end >= 0 {
+			at := start + end + 1
+			page = page[:at] + "\n" + w.banner + page[at:]
+		}
+	}
+	if _, err := w.ResponseWriter.WriteString(page); err != nil {
+		log.Printf("Failed to send the page: %v", err)
+	}
+}
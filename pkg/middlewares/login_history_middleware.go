@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+// loginHistoryServiceKey is the key of the login history service in the
+// context
+const loginHistoryServiceKey = "login_history_service"
+
+// LoginHistoryMiddleware is a middleware that makes the given service
+// available to the login handler, to record every login and flag the
+// suspicious ones. Handlers retrieve the service with
+// GetLoginHistoryService.
+func LoginHistoryMiddleware(loginHistoryService services.LoginHistoryServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(loginHistoryServiceKey, loginHistoryService)
+		c.Next()
+	}
+}
+
+// GetLoginHistoryService returns the service stored by
+// LoginHistoryMiddleware, or nil if logins are not recorded
+func GetLoginHistoryService(c *gin.Context) services.LoginHistoryServiceInterface {
+	if value, exists := c.Get(loginHistoryServiceKey); exists {
+		if loginHistoryService, ok := value.(services.LoginHistoryServiceInterface); ok {
+			return loginHistoryService
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package middlewares
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/tenant"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+// organizationServiceKey is the key of the organization service in the context
+const organizationServiceKey = "organization_service"
+
+// membershipKey is the key of the membership of the authenticated user in
+// the organization of the request
+const membershipKey = "membership"
+
+// OrganizationMiddleware is a middleware that lets AuthMiddleware resolve
+// the organization, or tenant, each request acts in, using the given
+// service. Handlers retrieve the service with GetOrganizationService.
+func OrganizationMiddleware(organizationService services.OrganizationServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(organizationServiceKey, organizationService)
+		c.Next()
+	}
+}
+
+// GetOrganizationService returns the service stored by
+// OrganizationMiddleware, or nil if organizations are not set up
+func GetOrganizationService(c *gin.Context) services.OrganizationServiceInterface {
+	if value, exists := c.Get(organizationServiceKey); exists {
+		if organizationService, ok := value.(services.OrganizationServiceInterface); ok {
+			return organizationService
+		}
+	}
+	return nil
+}
+
+// CurrentMembership returns the membership of the authenticated user in the
+// organization of the request, or nil if no organization was resolved
+func CurrentMembership(c *gin.Context) *models.Membership {
+	if value, exists := c.Get(membershipKey); exists {
+		if membership, ok := value.(*models.Membership); ok {
+			return membership
+		}
+	}
+	return nil
+}
+
+// RequireOrganizationRole is a middleware that only lets through members
+// with one of the given roles in the organization of the request. It must
+// run after AuthMiddleware. Other users get an error response with HTTP
+// status 403.
+func RequireOrganizationRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if membership := CurrentMembership(c); membership != nil {
+			for _, role := range roles {
+				if membership.Role == role {
+					c.Next()
+					return
+				}
+			}
+		}
+		abortWithError(c, http.StatusForbidden, "You are not allowed to manage this organization")
+	}
+}
+
+// resolveTenant resolves the organization the request of the claims acts
+// in and stores it in the request context, for the repositories, and the
+// membership for CurrentMembership. The claims get the organization in
+// OrganizationID and the role in it in OrganizationRole.
+//
+// Personal access tokens act in the organization they were created in.
+// Sessions act in the organization of their "org" claim, or fall back to
+// another organization of the user if they have left it. Service accounts
+// act in the organization their user last switched to. It does nothing
+// when organizations are not set up.
+func resolveTenant(c *gin.Context, claims *models.Claims) error {
+	organizationService := GetOrganizationService(c)
+	if organizationService == nil {
+		return nil
+	}
+
+	membership, err := organizationService.ResolveTenant(claims.UserID(), claims.OrganizationID, !claims.IsAccessToken())
+	if err != nil {
+		return err
+	}
+
+	claims.OrganizationID = membership.OrganizationID
+	claims.OrganizationRole = membership.Role
+	c.Set(membershipKey, membership)
+	c.Request = c.Request.WithContext(tenant.WithOrganization(c.Request.Context(), membership.OrganizationID))
+	return nil
+}
+
+// abortWithTenantError aborts a request whose organization could not be
+// resolved by resolveTenant, with HTTP status 403 if the user has no access
+// to it
+func abortWithTenantError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrNotMember) || errors.Is(err, services.ErrNoOrganization) {
+		abortWithError(c, http.StatusForbidden, err.Error())
+		return
+	}
+	log.Printf("Failed to resolve the organization of the request: %v", err)
+	abortWithError(c, http.StatusInternalServerError, "Failed to load your organization")
+}
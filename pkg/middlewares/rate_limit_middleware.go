@@ -0,0 +1,100 @@
+package middlewares
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimitMiddleware is a middleware that meters requests against the rate
+// limit policy of the matched route. Routes without a policy are not limited.
+//
+// Every limited response carries the RateLimit-Limit, RateLimit-Remaining,
+// RateLimit-Reset and RateLimit-Policy headers. When the limit is exceeded, it
+// sends an error response with HTTP status 429 and a Retry-After header, and
+// aborts the request chain. If the rate limit backend fails, the request is
+// let through so an outage of the backend does not take the site down.
+//
+// Policies keyed by user rely on the claims stored by AuthMiddleware, so the
+// middleware must run after it on authenticated routes. Without claims, the
+// client IP is used instead.
+func RateLimitMiddleware(rateLimitService services.RateLimitServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy := rateLimitService.PolicyFor(c.Request.Method, c.FullPath())
+		if policy == nil {
+			c.Next()
+			return
+		}
+
+		result, err := rateLimitService.Take(*policy, rateLimitSubject(c, policy.KeyBy))
+		if err != nil {
+			log.Printf("Rate limiter unavailable, letting request through: %v", err)
+			c.Next()
+			return
+		}
+
+		// Advertise the quota to the client
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+		c.Header("RateLimit-Policy", rateLimitPolicyHeader(*policy))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			abortWithError(c, http.StatusTooManyRequests, "Too many requests, please try again later")
+			return
+		}
+
+		// Proceed to the next handler
+		c.Next()
+	}
+}
+
+// rateLimitSubject returns the value the bucket of a request is keyed by
+func rateLimitSubject(c *gin.Context, keyBy string) string {
+	switch keyBy {
+	case models.RateLimitByRoute:
+		return ""
+	case models.RateLimitByUser:
+		if claims := GetClaims(c); claims != nil {
+			return claims.Subject
+		}
+	}
+	return c.ClientIP()
+}
+
+// rateLimitPolicyHeader describes a policy in the RateLimit-Policy header,
+// including the burst the limiter allows when it differs from the limit
+func rateLimitPolicyHeader(policy models.RateLimitPolicy) string {
+	header := fmt.Sprintf("%d;w=%d", policy.Limit, ceilSeconds(policy.Period))
+	if policy.Burst > 0 && policy.Burst != policy.Limit {
+		header += fmt.Sprintf(";burst=%d", policy.Burst)
+	}
+	return header
+}
+
+// ceilSeconds rounds a duration up to whole seconds, as expected by the
+// rate limit headers
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// abortWithError sends an error response in the format requested by the
+// client and aborts the request chain.
+//
+// Clients asking for JSON get an {"error": message} body; everyone else gets
+// the error.html template.
+func abortWithError(c *gin.Context, status int, message string) {
+	if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		c.AbortWithStatusJSON(status, gin.H{"error": message})
+		return
+	}
+	c.HTML(status, "error.html", gin.H{"error": message})
+	c.Abort()
+}
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+// registrationServiceKey is the key of the registration service in the
+// context
+const registrationServiceKey = "registration_service"
+
+// RegistrationMiddleware is a middleware that makes the registration policy
+// available to the handlers creating accounts, which retrieve the service
+// with GetRegistrationService.
+func RegistrationMiddleware(registrationService services.RegistrationServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(registrationServiceKey, registrationService)
+		c.Next()
+	}
+}
+
+// GetRegistrationService returns the service stored by
+// RegistrationMiddleware, or nil if registration is open to anyone
+func GetRegistrationService(c *gin.Context) services.RegistrationServiceInterface {
+	if value, exists := c.Get(registrationServiceKey); exists {
+		if registrationService, ok := value.(services.RegistrationServiceInterface); ok {
+			return registrationService
+		}
+	}
+	return nil
+}
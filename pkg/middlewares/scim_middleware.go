@@ -0,0 +1,70 @@
+package middlewares
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+// SCIMContentType is the media type of SCIM requests and responses
+const SCIMContentType = "application/scim+json"
+
+// SCIMAuthMiddleware is a middleware that only lets through personal access
+// tokens of admins granted the scim scope, sent in an "Authorization:
+// Bearer" header. Browser sessions are not accepted, so identity providers
+// need a dedicated credential. It stores the claims of the token like
+// AuthMiddleware, and provisions the organization the token was created in.
+//
+// Requests without a valid token get a SCIM error with HTTP status 401, and
+// tokens without the scope or of non-admins one with HTTP status 403.
+func SCIMAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			AbortWithSCIMError(c, &services.SCIMError{Status: http.StatusUnauthorized, Detail: "Authorization token not provided"})
+			return
+		}
+
+		claims, err := bearerClaims(c, header)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="scim", error="invalid_token"`)
+			AbortWithSCIMError(c, &services.SCIMError{Status: http.StatusUnauthorized, Detail: err.Error()})
+			return
+		}
+
+		if !claims.IsAccessToken() || !claims.HasScope(models.ScopeSCIM) || !claims.HasRole(models.RoleAdmin) {
+			c.Header("WWW-Authenticate", `Bearer realm="scim", error="insufficient_scope", scope="`+models.ScopeSCIM+`"`)
+			AbortWithSCIMError(c, &services.SCIMError{Status: http.StatusForbidden, Detail: "SCIM requires an admin access token with the " + models.ScopeSCIM + " scope"})
+			return
+		}
+
+		if err := resolveTenant(c, claims); err != nil {
+			if !errors.Is(err, services.ErrNotMember) && !errors.Is(err, services.ErrNoOrganization) {
+				log.Printf("Failed to resolve the organization of the request: %v", err)
+				AbortWithSCIMError(c, &services.SCIMError{Status: http.StatusInternalServerError, Detail: "Failed to load the organization"})
+				return
+			}
+			AbortWithSCIMError(c, &services.SCIMError{Status: http.StatusForbidden, Detail: err.Error()})
+			return
+		}
+		SetClaims(c, claims)
+		c.Next()
+	}
+}
+
+// AbortWithSCIMError sends a SCIM error response (RFC 7644 section 3.12)
+// and aborts the request chain
+func AbortWithSCIMError(c *gin.Context, scimErr *services.SCIMError) {
+	body, err := json.Marshal(scimErr)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Data(scimErr.Status, SCIMContentType, body)
+	c.Abort()
+}
@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+// sessionServiceKey is the key of the session service in the context
+const sessionServiceKey = "session_service"
+
+// SessionMiddleware is a middleware that lets AuthMiddleware check, on every
+// request, that the session of the JWT was not revoked, and record when it
+// was last seen, using the given service. Handlers retrieve the service with
+// GetSessionService.
+func SessionMiddleware(sessionService services.SessionServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(sessionServiceKey, sessionService)
+		c.Next()
+	}
+}
+
+// GetSessionService returns the service stored by SessionMiddleware, or nil
+// if sessions are not tracked
+func GetSessionService(c *gin.Context) services.SessionServiceInterface {
+	if value, exists := c.Get(sessionServiceKey); exists {
+		if sessionService, ok := value.(services.SessionServiceInterface); ok {
+			return sessionService
+		}
+	}
+	return nil
+}
+
+// checkSession checks that the session carried by the "sid" claim is still
+// active, returning ErrSessionRevoked once it was revoked or expired. Tokens
+// issued without a session, and personal access tokens, are not checked,
+// and neither is anything when sessions are not tracked.
+//
+// During an impersonation, the session of the admin is checked instead, so
+// revoking it also ends the impersonation.
+func checkSession(c *gin.Context, claims *models.Claims) error {
+	sessionService := GetSessionService(c)
+	if sessionService == nil {
+		return nil
+	}
+	if actor := claims.Actor; actor != nil {
+		if actor.SessionID == 0 {
+			return nil
+		}
+		_, err := sessionService.CheckSession(actor.UserID(), actor.SessionID, c.ClientIP())
+		return err
+	}
+	if claims.SessionID == 0 {
+		return nil
+	}
+	_, err := sessionService.CheckSession(claims.UserID(), claims.SessionID, c.ClientIP())
+	return err
+}
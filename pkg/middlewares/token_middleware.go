@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+)
+
+// tokenServiceKey is the key of the token service in the context
+const tokenServiceKey = "token_service"
+
+// claimsKey is the key of the claims of the authenticated user in the
+// context
+const claimsKey = "claims"
+
+// ErrNoTokenService is returned when a session token is issued or verified
+// for a request without the token service of TokenMiddleware
+var ErrNoTokenService = errors.New("no token service is configured")
+
+// TokenMiddleware is a middleware that lets AuthMiddleware verify session
+// tokens with the given service. Handlers retrieve the service with
+// GetTokenService to issue them.
+func TokenMiddleware(tokenService services.TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(tokenServiceKey, tokenService)
+		c.Next()
+	}
+}
+
+// GetTokenService returns the service stored by TokenMiddleware, or nil if
+// none was stored. There is no fallback, so that a router missing the
+// middleware rejects every session instead of trusting a well-known key.
+func GetTokenService(c *gin.Context) services.TokenService {
+	if value, exists := c.Get(tokenServiceKey); exists {
+		if tokenService, ok := value.(services.TokenService); ok {
+			return tokenService
+		}
+	}
+	return nil
+}
+
+// verifyToken verifies a session token with the service stored by
+// TokenMiddleware, failing with ErrNoTokenService without one
+func verifyToken(c *gin.Context, token string) (*models.Claims, error) {
+	tokenService := GetTokenService(c)
+	if tokenService == nil {
+		return nil, ErrNoTokenService
+	}
+	return tokenService.Verify(token)
+}
+
+// SetClaims stores the claims of the authenticated user in the context
+func SetClaims(c *gin.Context, claims *models.Claims) {
+	c.Set(claimsKey, claims)
+}
+
+// GetClaims returns the claims stored by AuthMiddleware, or nil if the
+// request is not authenticated
+func GetClaims(c *gin.Context) *models.Claims {
+	if value, exists := c.Get(claimsKey); exists {
+		if claims, ok := value.(*models.Claims); ok {
+			return claims
+		}
+	}
+	return nil
+}
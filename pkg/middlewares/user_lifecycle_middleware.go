@@ -0,0 +1,102 @@
+package middlewares
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+// userLifecycleServiceKey is the key of the user lifecycle service in the
+// context
+const userLifecycleServiceKey = "user_lifecycle_service"
+
+// UserLifecycleMiddleware is a middleware that lets AuthMiddleware check,
+// on every request, that the user of the session or token may still use
+// their account, using the given service. Handlers retrieve the service
+// with GetUserLifecycleService.
+func UserLifecycleMiddleware(userLifecycleService services.UserLifecycleServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(userLifecycleServiceKey, userLifecycleService)
+		c.Next()
+	}
+}
+
+// GetUserLifecycleService returns the service stored by
+// UserLifecycleMiddleware, or nil if account statuses are not checked
+func GetUserLifecycleService(c *gin.Context) services.UserLifecycleServiceInterface {
+	if value, exists := c.Get(userLifecycleServiceKey); exists {
+		if userLifecycleService, ok := value.(services.UserLifecycleServiceInterface); ok {
+			return userLifecycleService
+		}
+	}
+	return nil
+}
+
+// checkAccountStatus checks that the user of the claims may still use their
+// account: a session issued before the account was suspended, locked,
+// deactivated or deleted stops working, and so does a session whose version
+// is not the current one of the user, such as after a password change. It
+// does nothing when account statuses are not checked.
+//
+// The admin impersonating the user, if any, is checked too: blocking their
+// account, changing their password or taking away their permission to
+// impersonate ends the impersonation.
+func checkAccountStatus(c *gin.Context, claims *models.Claims) error {
+	userLifecycleService := GetUserLifecycleService(c)
+	if userLifecycleService == nil {
+		return nil
+	}
+	user, err := userLifecycleService.CheckUser(claims.UserID())
+	if err != nil {
+		return err
+	}
+
+	// Personal access tokens and service accounts are not sessions and have
+	// no version
+	if !claims.IsAccessToken() && !claims.IsServiceAccount() && claims.SessionVersion != user.SessionVersion {
+		return services.ErrSessionRevoked
+	}
+
+	if actor := claims.Actor; actor != nil {
+		// The impersonated user is not told what happened to the admin
+		admin, err := userLifecycleService.CheckUser(actor.UserID())
+		if errors.Is(err, services.ErrUserNotFound) || isAccountStatusError(err) {
+			return services.ErrSessionRevoked
+		}
+		if err != nil {
+			return err
+		}
+		if admin.SessionVersion != actor.SessionVersion || !services.MayImpersonate(admin) {
+			return services.ErrSessionRevoked
+		}
+	}
+	return nil
+}
+
+// abortWithAccountError responds to a request whose user may no longer use
+// their account, or whose session has ended, with HTTP status 401, so
+// clients log in again. Errors looking up the user get HTTP status 500.
+func abortWithAccountError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		abortWithError(c, http.StatusUnauthorized, "Invalid token")
+	case errors.Is(err, services.ErrSessionRevoked):
+		abortWithError(c, http.StatusUnauthorized, err.Error())
+	case isAccountStatusError(err):
+		abortWithError(c, http.StatusUnauthorized, err.Error())
+	default:
+		log.Printf("Failed to check the account of the request: %v", err)
+		abortWithError(c, http.StatusInternalServerError, "Failed to load your account")
+	}
+}
+
+// isAccountStatusError reports whether the error is one of those returned by
+// services.AccountStatusError for accounts that cannot be used
+func isAccountStatusError(err error) bool {
+	return errors.Is(err, services.ErrAccountSuspended) || errors.Is(err, services.ErrAccountLocked) ||
+		errors.Is(err, services.ErrUserDeactivated) || errors.Is(err, services.ErrAccountPending) ||
+		errors.Is(err, services.ErrEmailUnverified)
+}
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+// webAuthnServiceKey is the key of the WebAuthn service in the context
+const webAuthnServiceKey = "webauthn_service"
+
+// WebAuthnMiddleware is a middleware that makes the given service available
+// to the login handler, to ask users with a passkey for it after their
+// password, and to the account page, to list their passkeys. Handlers
+// retrieve the service with GetWebAuthnService.
+func WebAuthnMiddleware(webAuthnService services.WebAuthnServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(webAuthnServiceKey, webAuthnService)
+		c.Next()
+	}
+}
+
+// GetWebAuthnService returns the service stored by WebAuthnMiddleware, or
+// nil if passkeys are not enabled
+func GetWebAuthnService(c *gin.Context) services.WebAuthnServiceInterface {
+	if value, exists := c.Get(webAuthnServiceKey); exists {
+		if webAuthnService, ok := value.(services.WebAuthnServiceInterface); ok {
+			return webAuthnService
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// AccessTokenPrefix starts every personal access token, so leaked tokens are
+// easy to recognize (and to find with secret scanners)
+const AccessTokenPrefix = "bpat_"
+
+// Scopes a personal access token can be granted
+const (
+	ScopeUsersRead   = "users:read"
+	ScopeUsersWrite  = "users:write"
+	ScopeTokensWrite = "tokens:write"
+	ScopeSCIM        = "scim"
+	ScopeAuditRead   = "audit:read"
+	ScopeAuditExport = "audit:export"
+)
+
+// AccessTokenScopes lists every scope, in the order they are displayed
+var AccessTokenScopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeTokensWrite, ScopeSCIM, ScopeAuditRead, ScopeAuditExport}
+
+// PersonalAccessToken is a named, scoped and expiring credential a user
+// mints for scripts. Only the SHA-256 hash of the token is stored; the token
+// itself is shown once, when it is created.
+type PersonalAccessToken struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `json:"-" gorm:"index;not null"`
+	User      User      `json:"-"`
+	// OrganizationID is the organization the token acts in, the one active
+	// when it was created. Tokens created without one act in the active
+	// organization of their user.
+	OrganizationID *uint  `json:"organization_id,omitempty" gorm:"index"`
+	Name           string `json:"name" gorm:"not null"`
+	// DisplayPrefix is the start of the token, to tell tokens apart
+	DisplayPrefix string `json:"prefix" gorm:"not null"`
+	TokenHash     string `json:"-" gorm:"uniqueIndex;not null"`
+	// Scopes is the space-separated list of granted scopes
+	Scopes     string     `json:"scopes" gorm:"not null"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// ScopeList returns the granted scopes
+func (t *PersonalAccessToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// Active reports whether the token can still be used at the given time
+func (t *PersonalAccessToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Claims are the claims of a session token, or of a personal access token
+// or a client certificate once authenticated. They are issued and verified by a TokenService, and
+// stored in the request by AuthMiddleware for the handlers.
+//
+// The registered claims are not serialized with the others, since each
+// token format encodes them its own way.
+type Claims struct {
+	// Issuer identifies the application that issued the token ("iss")
+	Issuer string `json:"-"`
+	// Subject is the ID of the user, as a decimal string ("sub")
+	Subject string `json:"-"`
+	// Audience lists the applications the token is meant for ("aud")
+	Audience []string `json:"-"`
+	// ID is unique to the token ("jti")
+	ID        string    `json:"-"`
+	IssuedAt  time.Time `json:"-"`
+	NotBefore time.Time `json:"-"`
+	// ExpiresAt is left zero when issuing to get the default lifetime of
+	// the TokenService
+	ExpiresAt time.Time `json:"-"`
+
+	Username string `json:"username"`
+	// Roles are checked by RequireRole
+	Roles []string `json:"roles,omitempty"`
+	// SessionID is the session checked by AuthMiddleware, zero for tokens
+	// issued without one
+	SessionID uint `json:"sid,omitempty"`
+	// SessionVersion must match the one of the user, see
+	// User.SessionVersion
+	SessionVersion uint `json:"sv"`
+	// OrganizationID is the organization the request acts in, zero for
+	// none
+	OrganizationID uint `json:"org,omitempty"`
+	// Actor is the admin impersonating the user, if any (RFC 8693 §4.1)
+	Actor *Actor `json:"act,omitempty"`
+
+	// Scope and TokenID are set for personal access tokens only; Scope
+	// lists the scopes granted to the token, to the service account, or to
+	// the device session
+	Scope   string `json:"scope,omitempty"`
+	TokenID uint   `json:"token_id,omitempty"`
+	// ClientID is the OAuth client a device signed in through with the
+	// device authorization grant. Its session is limited to Scope.
+	ClientID string `json:"client_id,omitempty"`
+	// ServiceAccount is the ID of the service account of a client
+	// certificate, set by AuthMiddleware and never issued
+	ServiceAccount string `json:"-"`
+	// OrganizationRole is the role of the user in the organization the
+	// request acts in, set by AuthMiddleware and never issued
+	OrganizationRole string `json:"-"`
+}
+
+// Actor is the admin impersonating a user
+type Actor struct {
+	// Subject is the ID of the admin, as a decimal string
+	Subject  string `json:"sub"`
+	Username string `json:"username"`
+	// SessionID is the session the admin started the impersonation from,
+	// restored when it stops, and checked on every request
+	SessionID uint `json:"sid,omitempty"`
+	// SessionVersion is the session version of the admin, so changing
+	// their password also ends the impersonation
+	SessionVersion uint `json:"sv"`
+}
+
+// UserID returns the ID of the user of the claims, or zero if the subject
+// is not one
+func (c *Claims) UserID() uint {
+	return parseSubject(c.Subject)
+}
+
+// HasRole reports whether the claims carry the role
+func (c *Claims) HasRole(role string) bool {
+	for _, granted := range c.Roles {
+		if granted == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAccessToken reports whether the claims are those of a personal access
+// token rather than a session
+func (c *Claims) IsAccessToken() bool {
+	return c.TokenID != 0
+}
+
+// IsServiceAccount reports whether the claims are those of a service
+// account authenticated with a client certificate
+func (c *Claims) IsServiceAccount() bool {
+	return c.ServiceAccount != ""
+}
+
+// IsDeviceSession reports whether the claims are those of a session a
+// device signed in to with the device authorization grant
+func (c *Claims) IsDeviceSession() bool {
+	return c.ClientID != ""
+}
+
+// IsScoped reports whether the claims are limited to their Scope: those of
+// personal access tokens, service accounts and device sessions, unlike
+// browser sessions
+func (c *Claims) IsScoped() bool {
+	return c.IsAccessToken() || c.IsServiceAccount() || c.IsDeviceSession()
+}
+
+// HasScope reports whether the request may use the scope: browser sessions
+// are not scoped, and personal access tokens, service accounts and device
+// sessions must have been granted it
+func (c *Claims) HasScope(scope string) bool {
+	if !c.IsScoped() {
+		return true
+	}
+	for _, granted := range strings.Fields(c.Scope) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// UserID returns the ID of the admin, or zero if the subject is not one
+func (a *Actor) UserID() uint {
+	return parseSubject(a.Subject)
+}
+
+// parseSubject returns the user ID of a subject, or zero
+func parseSubject(subject string) uint {
+	id, err := strconv.ParseUint(subject, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
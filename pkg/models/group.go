@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Group is a named set of members of an organization, pushed by its HR
+// system over SCIM. Display names are unique within an organization.
+type Group struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	OrganizationID uint      `json:"organization_id" gorm:"uniqueIndex:idx_groups_organization_display_name;not null;default:0"`
+	DisplayName    string    `json:"display_name" gorm:"uniqueIndex:idx_groups_organization_display_name;not null"`
+	ExternalID     string    `json:"-" gorm:"index;not null;default:''"`
+	Members        []User    `json:"-" gorm:"many2many:group_members"`
+}
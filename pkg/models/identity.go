@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Identity links an account at an external OpenID Connect provider to a
+// local user. The account is identified by the issuer-scoped subject of the
+// provider, which never changes, unlike its email or username.
+type Identity struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"-"`
+	UserID    uint      `json:"-" gorm:"index;not null"`
+	User      User      `json:"-"`
+	// Provider is the ID of the configured provider
+	Provider string `json:"provider" gorm:"uniqueIndex:idx_identities_provider_subject;not null"`
+	Subject  string `json:"-" gorm:"uniqueIndex:idx_identities_provider_subject;not null"`
+	// Email is the last email the provider reported, for display only
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
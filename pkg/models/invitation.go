@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Statuses of an invitation
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Invitation asks someone to create an account and join an organization.
+//
+// It is sent by email as a link holding a single-use token, of which only
+// the SHA-256 hash is stored. The invitee chooses their username and
+// password when accepting, and is given the roles chosen by the admin.
+type Invitation struct {
+	ID             uint         `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	OrganizationID uint         `json:"organization_id" gorm:"index;not null"`
+	Organization   Organization `json:"-"`
+	Email          string       `json:"email" gorm:"index;not null"`
+	// Role is the site role of the new user, OrgRole their role in the
+	// organization
+	Role      string `json:"role" gorm:"not null;default:'user'"`
+	OrgRole   string `json:"org_role" gorm:"not null;default:'member'"`
+	TokenHash string `json:"-" gorm:"uniqueIndex;not null"`
+	// SentAt is when the invitation was last sent; resending it replaces
+	// the token and pushes back ExpiresAt
+	SentAt    time.Time `json:"sent_at"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
+	// InvitedByID is the admin who sent the invitation
+	InvitedByID    uint       `json:"invited_by_id"`
+	InvitedBy      User       `json:"-"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	AcceptedUserID *uint      `json:"accepted_user_id,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Status returns whether the invitation is pending, accepted, revoked or
+// expired at the given time
+func (i *Invitation) Status(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Suspicious signs flagged on a login
+const (
+	// LoginAlertNewDevice flags a login from a browser the user never
+	// logged in with before
+	LoginAlertNewDevice = "new_device"
+	// LoginAlertImpossibleTravel flags a login too far from the previous
+	// one to have traveled between them
+	LoginAlertImpossibleTravel = "impossible_travel"
+	// LoginAlertFailureBurst flags a burst of failed logins to an account
+	LoginAlertFailureBurst = "failure_burst"
+)
+
+// LoginAttempt records a login to the login form, successful or not, with
+// where it came from
+type LoginAttempt struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+	// UserID is the user whose account was tried, nil for unknown usernames
+	UserID    *uint  `json:"user_id" gorm:"index"`
+	Username  string `json:"username"`
+	Outcome   string `json:"outcome" gorm:"not null"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Device    string `json:"device"`
+	// The coarse location of the IP, when a geolocation database is set up
+	CountryCode string   `json:"country_code"`
+	Country     string   `json:"country"`
+	City        string   `json:"city"`
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+	// Alerts is the comma-separated list of suspicious signs of the login
+	Alerts string `json:"alerts"`
+}
+
+// AlertList returns the suspicious signs of the login
+func (a *LoginAttempt) AlertList() []string {
+	if a.Alerts == "" {
+		return nil
+	}
+	return strings.Split(a.Alerts, ",")
+}
+
+// AlertMessages returns the explanations of the suspicious signs of the
+// login, shown to its user
+func (a *LoginAttempt) AlertMessages() []string {
+	var messages []string
+	for _, alert := range a.AlertList() {
+		switch alert {
+		case LoginAlertNewDevice:
+			messages = append(messages, "Login from a new device or browser")
+		case LoginAlertImpossibleTravel:
+			messages = append(messages, "Login too far from the previous one to have traveled between them")
+		case LoginAlertFailureBurst:
+			messages = append(messages, "Many failed attempts to log in")
+		default:
+			messages = append(messages, alert)
+		}
+	}
+	return messages
+}
+
+// Location returns the city and country of the login, or an empty string
+// if it was not located
+func (a *LoginAttempt) Location() string {
+	country := a.Country
+	if country == "" {
+		country = a.CountryCode
+	}
+	if a.City != "" && country != "" {
+		return a.City + ", " + country
+	}
+	return a.City + country
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// MagicLink is a link emailed to a user that logs them in without their
+// password.
+//
+// Its token is signed and single-use, and only its SHA-256 hash is stored.
+// The link is bound to the browser it was requested from, through the hash
+// of a secret kept in a cookie of that browser, so a link intercepted on
+// its way to the user cannot be used elsewhere.
+type MagicLink struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"index;not null"`
+	TokenHash string `gorm:"uniqueIndex;not null"`
+	// BrowserHash is the hash of the secret of the requesting browser
+	BrowserHash string `gorm:"not null"`
+	// IP is the address the link was requested from
+	IP        string
+	ExpiresAt time.Time `gorm:"not null"`
+	// UsedAt is when the link logged the user in, nil until then
+	UsedAt *time.Time
+}
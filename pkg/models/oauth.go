@@ -0,0 +1,105 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// OAuthClient is an application that signs its users in through this
+// service, acting as an OpenID Connect provider.
+//
+// Confidential clients authenticate to the token endpoint with a secret, of
+// which only the SHA-256 hash is stored. Public clients (single page and
+// native apps) have no secret and must use PKCE.
+type OAuthClient struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time `json:"created_at"`
+	ClientID   string    `json:"client_id" gorm:"uniqueIndex;not null"`
+	SecretHash string    `json:"-"`
+	Name       string    `json:"name" gorm:"not null"`
+	// RedirectURIs is the space-separated list of allowed redirect URIs,
+	// compared exactly
+	RedirectURIs string `json:"redirect_uris" gorm:"not null"`
+	Public       bool   `json:"public"`
+	// CreatedByID is the admin who registered the client
+	CreatedByID uint `json:"-"`
+}
+
+// RedirectURIList returns the allowed redirect URIs
+func (c *OAuthClient) RedirectURIList() []string {
+	return strings.Fields(c.RedirectURIs)
+}
+
+// AllowsRedirectURI reports whether the redirect URI is registered
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	for _, allowed := range c.RedirectURIList() {
+		if allowed == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthAuthorizationCode is the single-use code handed to a client at the
+// end of the authorization code flow. Only its hash is stored.
+type OAuthAuthorizationCode struct {
+	ID                  uint `gorm:"primarykey"`
+	CreatedAt           time.Time
+	CodeHash            string `gorm:"uniqueIndex;not null"`
+	ClientID            string `gorm:"index;not null"`
+	UserID              uint   `gorm:"not null"`
+	RedirectURI         string `gorm:"not null"`
+	Scope               string `gorm:"not null"`
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	AuthTime            time.Time
+	ExpiresAt           time.Time `gorm:"not null"`
+	UsedAt              *time.Time
+}
+
+// OAuthConsent records the scopes a user allowed a client to access, so
+// the consent screen is only shown again when more is asked
+type OAuthConsent struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint   `gorm:"uniqueIndex:idx_oauth_consents_user_client;not null"`
+	ClientID  string `gorm:"uniqueIndex:idx_oauth_consents_user_client;not null"`
+	Scope     string `gorm:"not null"`
+}
+
+// Statuses of an OAuthDeviceAuthorization
+const (
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+)
+
+// OAuthDeviceAuthorization is a sign-in started by a device without a
+// browser, such as a CLI on a headless machine (RFC 8628).
+//
+// The device polls the token endpoint with its device code while the user
+// enters the short user code on the /device page of a browser where they
+// are logged in, and approves or denies the request. Only the hashes of
+// both codes are stored.
+type OAuthDeviceAuthorization struct {
+	ID             uint `gorm:"primarykey"`
+	CreatedAt      time.Time
+	DeviceCodeHash string `gorm:"uniqueIndex;not null"`
+	// UserCodeHash is the hash of the normalized user code. User codes are
+	// short, so they are only unique among the pending authorizations.
+	UserCodeHash string `gorm:"index;not null"`
+	ClientID     string `gorm:"index;not null"`
+	Scope        string `gorm:"not null"`
+	Status       string `gorm:"not null"`
+	// UserID is the user who approved or denied the request
+	UserID *uint
+	// Interval is the number of seconds the device must wait between two
+	// polls, raised each time it polls too fast
+	Interval     int `gorm:"not null"`
+	LastPolledAt *time.Time
+	ExpiresAt    time.Time `gorm:"not null"`
+	// UsedAt is when the device got its token, nil until then
+	UsedAt *time.Time
+}
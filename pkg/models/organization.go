@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Roles of a member within an organization, independent of the site-wide
+// user roles
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// OrganizationRoles lists every organization role, from the most to the
+// least privileged
+var OrganizationRoles = []string{OrgRoleOwner, OrgRoleAdmin, OrgRoleMember}
+
+// Organization is a tenant: a customer team whose members, groups and
+// tokens are isolated from the other organizations
+type Organization struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name" gorm:"not null"`
+	// Slug is the unique, URL-safe identifier of the organization
+	Slug string `json:"slug" gorm:"uniqueIndex;not null"`
+}
+
+// Membership makes a user a member of an organization, with a role in it
+type Membership struct {
+	ID             uint         `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	OrganizationID uint         `json:"organization_id" gorm:"uniqueIndex:idx_memberships_organization_user;not null"`
+	Organization   Organization `json:"organization"`
+	UserID         uint         `json:"user_id" gorm:"uniqueIndex:idx_memberships_organization_user;index;not null"`
+	User           User         `json:"user"`
+	Role           string       `json:"role" gorm:"not null;default:'member'"`
+	// DeactivatedAt is set while the member is deactivated, such as by the
+	// SCIM provisioning of the organization, and cannot act in it
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+}
+
+// Active reports whether the member may act in the organization
+func (m *Membership) Active() bool {
+	return m.DeactivatedAt == nil
+}
+
+// CanManage reports whether the member may manage the members of the
+// organization
+func (m *Membership) CanManage() bool {
+	return m.Role == OrgRoleOwner || m.Role == OrgRoleAdmin
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Rate limit keys decide which part of the request a bucket is tracked by.
+const (
+	RateLimitByIP    = "ip"
+	RateLimitByUser  = "user"
+	RateLimitByRoute = "route"
+)
+
+// RateLimitPolicy describes how many requests a route accepts per period.
+//
+// Requests are metered with the generic cell rate algorithm (GCRA): one
+// request is allowed every Period/Limit, and up to Burst requests may be
+// made back to back before the limiter starts rejecting them.
+type RateLimitPolicy struct {
+	Method string
+	Route  string
+	Limit  int
+	Burst  int
+	Period time.Duration
+	KeyBy  string
+}
+
+// EmissionInterval returns the time it takes for a single request to be
+// refilled in the bucket.
+func (p RateLimitPolicy) EmissionInterval() time.Duration {
+	return p.Period / time.Duration(p.Limit)
+}
+
+// BurstOffset returns how far ahead of now the theoretical arrival time may
+// drift before requests are rejected.
+func (p RateLimitPolicy) BurstOffset() time.Duration {
+	burst := p.Burst
+	if burst <= 0 {
+		burst = p.Limit
+	}
+	return p.EmissionInterval() * time.Duration(burst)
+}
+
+// RateLimitResult is the outcome of consuming a request from a bucket
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	ResetAfter time.Duration
+}
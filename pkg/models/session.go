@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Session is a login of a user from a browser or script, carried by the
+// "sid" claim of its JWT. Revoking a session logs it out at once.
+type Session struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `json:"user_id" gorm:"index;not null"`
+	// Device is a short description of the browser and system, taken from
+	// the user agent
+	Device    string `json:"device"`
+	UserAgent string `json:"user_agent"`
+	// IP is the address the session was last seen from
+	IP         string     `json:"ip"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// Active reports whether the session can still be used at the given time
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
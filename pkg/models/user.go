@@ -1,11 +1,98 @@
 package models
 
 import (
+	"strings"
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Permissions granted to users on top of their role
+const (
+	// PermissionImpersonate lets an admin log in as other users to help
+	// them
+	PermissionImpersonate = "impersonate"
+)
+
+// Account statuses. The legal transitions between them are enforced by the
+// UserLifecycleService.
+const (
+	UserStatusActive = "active"
+	// UserStatusPending accounts await the approval of an admin
+	UserStatusPending = "pending"
+	// UserStatusUnverified accounts await the verification of their email
+	// address
+	UserStatusUnverified = "unverified"
+	// UserStatusSuspended accounts were suspended by an admin, for example
+	// while a complaint is investigated
+	UserStatusSuspended = "suspended"
+	// UserStatusLocked accounts were locked for their protection, for
+	// example after suspicious logins
+	UserStatusLocked = "locked"
+	// UserStatusDeactivated accounts are closed, but kept for the audit log
+	UserStatusDeactivated = "deactivated"
+)
+
+// UserStatuses lists every account status
+var UserStatuses = []string{UserStatusPending, UserStatusUnverified, UserStatusActive, UserStatusSuspended,
+	UserStatusLocked, UserStatusDeactivated}
+
 type User struct {
 	gorm.Model
 	Username string `json:"username" gorm:"unique;not null"`
-	Password string `json:"password" gorm:"not null"`
+	Password string `json:"-" gorm:"not null"` // never sent to clients
+	// NormalizedUsername is the case-folded username, unique among active
+	// users (see the 0001_normalize_usernames migration)
+	NormalizedUsername string `json:"-" gorm:"not null;default:''"`
+	// UsernameSkeleton is the username with look-alike characters made
+	// identical, used to detect confusable usernames
+	UsernameSkeleton string `json:"-" gorm:"index;not null;default:''"`
+	Role             string `json:"role" gorm:"not null;default:'user'"`
+	// Permissions are the space-separated permissions of the user, on top
+	// of those of their role
+	Permissions string `json:"permissions,omitempty" gorm:"not null;default:''"`
+	// Status tells whether the account may be used; see Active
+	Status string `json:"status" gorm:"index;not null;default:'active'"`
+	// StatusReason explains the last status change, such as why the account
+	// was suspended
+	StatusReason string `json:"status_reason,omitempty" gorm:"not null;default:''"`
+	// StatusChangedAt is when the status last changed, nil if it never did
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+
+	// Profile attributes, mostly set by SCIM provisioning
+	ExternalID  string `json:"-" gorm:"index;not null;default:''"`
+	DisplayName string `json:"display_name,omitempty" gorm:"not null;default:''"`
+	GivenName   string `json:"-" gorm:"not null;default:''"`
+	FamilyName  string `json:"-" gorm:"not null;default:''"`
+	Email       string `json:"email,omitempty" gorm:"not null;default:''"`
+	// DeactivatedAt is set while the user is deactivated and cannot log in
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+	// ActiveOrganizationID is the organization the user last switched to,
+	// put in their next session
+	ActiveOrganizationID *uint `json:"-"`
+	// SessionVersion is put in the sessions of the user, and incremented to
+	// end them, such as when their password changes
+	SessionVersion uint `json:"-" gorm:"not null;default:0"`
+}
+
+// Active reports whether the user may log in: their account is not awaiting
+// approval or verification, suspended, locked or deactivated
+func (u *User) Active() bool {
+	return u.DeactivatedAt == nil && (u.Status == "" || u.Status == UserStatusActive)
+}
+
+// HasPermission reports whether the user was granted the permission
+func (u *User) HasPermission(permission string) bool {
+	for _, granted := range strings.Fields(u.Permissions) {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// UsernameChange records a username a user gave up, so links to it
+// redirect to their new username while nobody else takes it
+type UsernameChange struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+	UserID    uint      `json:"user_id" gorm:"index;not null"`
+	// OldUsername is the username as it was displayed
+	OldUsername string `json:"old_username" gorm:"not null"`
+	// NormalizedUsername is the canonical form of the old username, looked
+	// up to redirect
+	NormalizedUsername string `json:"-" gorm:"index;not null"`
+	NewUsername        string `json:"new_username" gorm:"not null"`
+}
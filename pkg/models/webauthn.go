@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// WebAuthn ceremonies a challenge is issued for
+const (
+	// WebAuthnCeremonyRegistration adds a credential to an account
+	WebAuthnCeremonyRegistration = "registration"
+	// WebAuthnCeremonyLogin logs in without a password, with a credential
+	// the authenticator discovers
+	WebAuthnCeremonyLogin = "login"
+	// WebAuthnCeremonySecondFactor completes a password login with one of
+	// the credentials of the user
+	WebAuthnCeremonySecondFactor = "second_factor"
+)
+
+// WebAuthnCredential is a passkey or security key registered by a user, to
+// log in without a password or as a second factor
+type WebAuthnCredential struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `json:"-" gorm:"index;not null"`
+	// CredentialID is the base64url ID the authenticator knows the
+	// credential by
+	CredentialID string `json:"credential_id" gorm:"uniqueIndex;not null"`
+	// PublicKey is the COSE key of the credential, verifying its assertions
+	PublicKey []byte `json:"-" gorm:"not null"`
+	Algorithm int64  `json:"algorithm"`
+	// SignCount is the last signature counter seen, which detects cloned
+	// authenticators; synced passkeys leave it at zero
+	SignCount uint32 `json:"-" gorm:"not null;default:0"`
+	Name      string `json:"name"`
+	// Transports is the comma-separated list of the ways the browser can
+	// reach the authenticator, such as usb or internal
+	Transports string `json:"transports"`
+	// BackupEligible is set for passkeys synced between devices
+	BackupEligible bool       `json:"backup_eligible"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+}
+
+// WebAuthnChallenge is the random challenge of a WebAuthn ceremony in
+// progress. It is deleted when the ceremony completes, so a signed
+// response cannot be replayed.
+type WebAuthnChallenge struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	// Challenge is base64url encoded, as in the client data
+	Challenge string `gorm:"uniqueIndex;not null"`
+	Ceremony  string `gorm:"not null"`
+	// UserID is the user the ceremony is for, nil for passwordless logins
+	// where the authenticator picks the user
+	UserID *uint
+	// Next is the local page to go back to after a second factor login
+	Next      string
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
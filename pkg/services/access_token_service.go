@@ -0,0 +1,165 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Errors returned by the AccessTokenService
+var (
+	ErrInvalidAccessToken = errors.New("invalid access token")
+	ErrAccessTokenExpired = errors.New("access token expired or revoked")
+	ErrAccessTokenMissing = errors.New("access token not found")
+)
+
+// accessTokenDisplayLength is the number of characters of a token kept to
+// tell tokens apart, prefix included
+const accessTokenDisplayLength = len(models.AccessTokenPrefix) + 6
+
+// accessTokenUsageInterval is how often the last use of a token is saved,
+// so busy scripts do not write on every request
+const accessTokenUsageInterval = time.Minute
+
+// AccessTokenServiceInterface defines the interface for the AccessTokenService
+type AccessTokenServiceInterface interface {
+	CreateToken(userID, organizationID uint, name string, scopes []string, ttl time.Duration) (string, *models.PersonalAccessToken, error)
+	ListTokens(userID uint) ([]models.PersonalAccessToken, error)
+	RevokeToken(userID, tokenID uint) error
+	Authenticate(token, ip string) (*models.PersonalAccessToken, error)
+}
+
+// AccessTokenService mints and checks personal access tokens
+type AccessTokenService struct {
+	Repo repository.AccessTokenRepository
+	// MaxLifetime is the longest lifetime a token can be given
+	MaxLifetime time.Duration
+	Now         func() time.Time
+}
+
+// NewAccessTokenService creates a new AccessTokenService
+func NewAccessTokenService(repo repository.AccessTokenRepository, maxLifetime time.Duration) *AccessTokenService {
+	return &AccessTokenService{Repo: repo, MaxLifetime: maxLifetime, Now: time.Now}
+}
+
+// CreateToken mints a token for a user.
+//
+// The name is required, every scope must be known and the lifetime must be
+// positive and at most MaxLifetime. It returns the token, which cannot be
+// retrieved again, and the stored record. The token acts in the given
+// organization only; zero leaves it without one, for setups without
+// organizations.
+func (s *AccessTokenService) CreateToken(userID, organizationID uint, name string, scopes []string, ttl time.Duration) (string, *models.PersonalAccessToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, errors.New("token name is required")
+	}
+	if len(scopes) == 0 {
+		return "", nil, errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !containsString(models.AccessTokenScopes, scope) {
+			return "", nil, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	if ttl <= 0 || (s.MaxLifetime > 0 && ttl > s.MaxLifetime) {
+		return "", nil, fmt.Errorf("token lifetime must be between 1 and %d days", int(s.MaxLifetime.Hours()/24))
+	}
+
+	// 256 random bits, URL safe so the token can be pasted anywhere
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	plain := models.AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	now := s.Now()
+	token := &models.PersonalAccessToken{
+		UserID:        userID,
+		Name:          name,
+		DisplayPrefix: plain[:accessTokenDisplayLength],
+		TokenHash:     hashAccessToken(plain),
+		Scopes:        strings.Join(scopes, " "),
+		ExpiresAt:     now.Add(ttl),
+	}
+	if organizationID != 0 {
+		token.OrganizationID = &organizationID
+	}
+	if err := s.Repo.CreateToken(token); err != nil {
+		return "", nil, err
+	}
+	return plain, token, nil
+}
+
+// ListTokens uses the repository to fetch the tokens of a user
+func (s *AccessTokenService) ListTokens(userID uint) ([]models.PersonalAccessToken, error) {
+	return s.Repo.ListTokensByUser(userID)
+}
+
+// RevokeToken revokes a token of a user, or returns ErrAccessTokenMissing
+// if the user has no such active token
+func (s *AccessTokenService) RevokeToken(userID, tokenID uint) error {
+	revoked, err := s.Repo.RevokeToken(userID, tokenID, s.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrAccessTokenMissing
+	}
+	return nil
+}
+
+// Authenticate checks a token presented by a client and returns it with its
+// user.
+//
+// The time and IP of the use are saved, at most once a minute per token
+// unless the IP changes. Failing to save them does not fail the check.
+func (s *AccessTokenService) Authenticate(plain, ip string) (*models.PersonalAccessToken, error) {
+	if !strings.HasPrefix(plain, models.AccessTokenPrefix) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	token, err := s.Repo.GetTokenByHash(hashAccessToken(plain))
+	if err != nil {
+		return nil, err
+	}
+	// Tokens of deleted or deactivated users stop working with them
+	if token == nil || token.User.ID == 0 || !token.User.Active() {
+		return nil, ErrInvalidAccessToken
+	}
+
+	now := s.Now()
+	if !token.Active(now) {
+		return nil, ErrAccessTokenExpired
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= accessTokenUsageInterval || token.LastUsedIP != ip {
+		if err := s.Repo.UpdateTokenUsage(token.ID, now, ip); err != nil {
+			log.Printf("Failed to record use of access token %d: %v", token.ID, err)
+		}
+		token.LastUsedAt, token.LastUsedIP = &now, ip
+	}
+	return token, nil
+}
+
+// hashAccessToken returns the hash a token is stored under. Tokens are long
+// and random, so a fast unsalted hash is enough.
+func hashAccessToken(plain string) string {
+	return sha256Hex(plain)
+}
+
+// containsString reports whether the list contains the value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
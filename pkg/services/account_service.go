@@ -0,0 +1,197 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxProfileFieldLength is the longest name a profile can be given
+const maxProfileFieldLength = 100
+
+// Errors returned by the AccountService
+var (
+	ErrWrongPassword   = errors.New("the current password is incorrect")
+	ErrSamePassword    = errors.New("the new password must differ from the current one")
+	ErrSameUsername    = errors.New("this already is your username")
+	ErrProfileTooLong  = errors.New("names cannot be longer than 100 characters")
+	ErrSessionRevoked  = errors.New("your session has ended, please log in again")
+	ErrUsernameUnknown = errors.New("no user has this username")
+)
+
+// Profile holds the profile attributes users edit themselves
+type Profile struct {
+	DisplayName string `json:"display_name"`
+	GivenName   string `json:"given_name"`
+	FamilyName  string `json:"family_name"`
+	Email       string `json:"email"`
+}
+
+// ProfileOf returns the profile attributes of a user
+func ProfileOf(user *models.User) Profile {
+	return Profile{DisplayName: user.DisplayName, GivenName: user.GivenName, FamilyName: user.FamilyName, Email: user.Email}
+}
+
+// AccountServiceInterface defines the interface for the AccountService
+type AccountServiceInterface interface {
+	GetAccount(userID uint) (*models.User, error)
+	ChangePassword(userID uint, currentPassword, newPassword string) (*models.User, error)
+	UpdateProfile(userID uint, profile Profile) (*models.User, Profile, error)
+	ChangeUsername(userID uint, username string) (*models.User, string, error)
+	ListUsernameChanges(userID uint) ([]models.UsernameChange, error)
+	ResolveUsername(username string) (*models.User, bool, error)
+}
+
+// AccountService lets users manage their own account: their password,
+// profile and username
+type AccountService struct {
+	Users    UserServiceInterface
+	UserRepo repository.UserRepository
+	Now      func() time.Time
+}
+
+// NewAccountService creates a new AccountService
+func NewAccountService(users UserServiceInterface, userRepo repository.UserRepository) *AccountService {
+	return &AccountService{Users: users, UserRepo: userRepo, Now: time.Now}
+}
+
+// GetAccount returns the account of a user, or ErrUserNotFound
+func (s *AccountService) GetAccount(userID uint) (*models.User, error) {
+	user, err := s.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// ChangePassword changes the password of a user who proved they know the
+// current one, or returns ErrWrongPassword.
+//
+// The new password is checked against the password policy. Changing it
+// increments the session version of the user, ending all their sessions:
+// the caller issues a new one for the session making the change.
+func (s *AccountService) ChangePassword(userID uint, currentPassword, newPassword string) (*models.User, error) {
+	user, err := s.GetAccount(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Password == "" || s.Users.CheckPassword(user, currentPassword) != nil {
+		return nil, ErrWrongPassword
+	}
+	if currentPassword == newPassword {
+		return nil, ErrSamePassword
+	}
+
+	user.SessionVersion++
+	if err := s.Users.SetPassword(user, newPassword); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdateProfile changes the profile attributes of a user. Names are
+// trimmed, and the email address is normalized or must be empty. It returns
+// the user with their previous profile, so the change can be audited.
+func (s *AccountService) UpdateProfile(userID uint, profile Profile) (*models.User, Profile, error) {
+	profile.DisplayName = strings.TrimSpace(profile.DisplayName)
+	profile.GivenName = strings.TrimSpace(profile.GivenName)
+	profile.FamilyName = strings.TrimSpace(profile.FamilyName)
+	for _, name := range []string{profile.DisplayName, profile.GivenName, profile.FamilyName} {
+		if utf8.RuneCountInString(name) > maxProfileFieldLength {
+			return nil, Profile{}, ErrProfileTooLong
+		}
+	}
+	if profile.Email = strings.TrimSpace(profile.Email); profile.Email != "" {
+		email, err := normalizeEmail(profile.Email)
+		if err != nil {
+			return nil, Profile{}, err
+		}
+		profile.Email = email
+	}
+
+	user, err := s.GetAccount(userID)
+	if err != nil {
+		return nil, Profile{}, err
+	}
+	previous := ProfileOf(user)
+	user.DisplayName, user.GivenName, user.FamilyName, user.Email =
+		profile.DisplayName, profile.GivenName, profile.FamilyName, profile.Email
+	if err := s.UserRepo.UpdateUser(user); err != nil {
+		return nil, Profile{}, err
+	}
+	return user, previous, nil
+}
+
+// ChangeUsername renames a user and records their old username in their
+// history, so links to it redirect to the new one until someone else
+// takes it.
+//
+// The new username is checked like in UserService.ChangeUsername. It
+// returns the user with their previous username, or ErrSameUsername if it
+// does not change.
+func (s *AccountService) ChangeUsername(userID uint, username string) (*models.User, string, error) {
+	user, err := s.GetAccount(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	previous, previousNormalized := user.Username, user.NormalizedUsername
+	if err := s.Users.ChangeUsername(user, username); err != nil {
+		return nil, "", err
+	}
+	if user.Username == previous {
+		return nil, "", ErrSameUsername
+	}
+
+	change := &models.UsernameChange{
+		CreatedAt:          s.Now(),
+		UserID:             user.ID,
+		OldUsername:        previous,
+		NormalizedUsername: previousNormalized,
+		NewUsername:        user.Username,
+	}
+	if err := s.UserRepo.RenameUser(user, change); err != nil {
+		return nil, "", err
+	}
+	return user, previous, nil
+}
+
+// ListUsernameChanges returns the username history of a user, most recent
+// first
+func (s *AccountService) ListUsernameChanges(userID uint) ([]models.UsernameChange, error) {
+	return s.UserRepo.ListUsernameChanges(userID)
+}
+
+// ResolveUsername returns the user with a username, or the user who last
+// gave it up, in which case it also returns true so the caller redirects
+// to their current username. Unknown usernames return ErrUsernameUnknown.
+func (s *AccountService) ResolveUsername(username string) (*models.User, bool, error) {
+	user, err := s.Users.GetUserByUsername(username)
+	if err != nil {
+		return nil, false, err
+	}
+	if user != nil {
+		return user, false, nil
+	}
+
+	change, err := s.UserRepo.GetUsernameChange(CanonicalUsername(username))
+	if err != nil {
+		return nil, false, err
+	}
+	if change == nil {
+		return nil, false, ErrUsernameUnknown
+	}
+	user, err = s.UserRepo.GetUserByID(change.UserID)
+	if err != nil {
+		return nil, false, err
+	}
+	if user == nil {
+		return nil, false, ErrUsernameUnknown
+	}
+	return user, true, nil
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Redacted replaces secret values (such as passwords) in audit diffs
+const Redacted = "[redacted]"
+
+// AuditServiceInterface defines the interface for the AuditService
+type AuditServiceInterface interface {
+	Record(event models.AuditEvent) error
+	ListEvents(filter models.AuditFilter) ([]models.AuditEvent, error)
+	VerifyChain() (*AuditVerification, error)
+}
+
+// AuditVerification is the result of checking the audit chain
+type AuditVerification struct {
+	Valid   bool `json:"valid"`
+	Checked int  `json:"checked"`
+	// BrokenAt is the ID of the first event that does not match the chain
+	BrokenAt uint   `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// AuditService records and checks the audit log
+type AuditService struct {
+	Repo repository.AuditRepository
+	Now  func() time.Time
+}
+
+// NewAuditService creates a new AuditService
+func NewAuditService(repo repository.AuditRepository) *AuditService {
+	return &AuditService{Repo: repo, Now: time.Now}
+}
+
+// Record appends an event to the audit log, timestamped with the current time
+func (s *AuditService) Record(event models.AuditEvent) error {
+	// Keep the precision the database stores, so the hash can be recomputed
+	event.CreatedAt = s.Now().UTC().Truncate(time.Microsecond)
+	return s.Repo.AppendEvent(&event)
+}
+
+// ListEvents uses the repository to fetch the events matching a filter
+func (s *AuditService) ListEvents(filter models.AuditFilter) ([]models.AuditEvent, error) {
+	return s.Repo.ListEvents(filter)
+}
+
+// VerifyChain recomputes the hash of every event and checks that each one
+// points to the previous one.
+//
+// It returns the first event at which the chain is broken, which is where
+// events have been modified, inserted or deleted.
+func (s *AuditService) VerifyChain() (*AuditVerification, error) {
+	result := &AuditVerification{Valid: true}
+	prevHash := models.AuditGenesisHash
+
+	err := s.Repo.WalkEvents(func(batch []models.AuditEvent) error {
+		for i := range batch {
+			event := &batch[i]
+			if !result.Valid {
+				return nil
+			}
+			result.Checked++
+
+			switch {
+			case event.PrevHash != prevHash:
+				result.Valid, result.BrokenAt, result.Reason = false, event.ID, "previous event is missing or was altered"
+			case event.ComputeHash() != event.Hash:
+				result.Valid, result.BrokenAt, result.Reason = false, event.ID, "event was altered"
+			}
+			prevHash = event.Hash
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AuditChanges returns the JSON diff between the before and after states of
+// a record, as stored in AuditEvent.Changes.
+//
+// Each field whose value differs is mapped to its {"from": ..., "to": ...}
+// values; fields missing from one side are reported as null. Secrets must
+// never be passed in: a changed password is recorded by only passing
+// {"password": Redacted} as the after state. It returns an empty string when
+// nothing changed.
+func AuditChanges(before, after map[string]interface{}) string {
+	fields := make(map[string]bool)
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	changes := make(map[string]map[string]interface{})
+	for _, field := range names {
+		from, to := before[field], after[field]
+		if reflect.DeepEqual(from, to) {
+			continue
+		}
+		changes[field] = map[string]interface{}{"from": from, "to": to}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Sprintf("%q", err.Error())
+	}
+	return string(encoded)
+}
+
+// UserAuditState returns the audited fields of a user, for AuditChanges
+func UserAuditState(user *models.User) map[string]interface{} {
+	if user == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"username": user.Username,
+		"role":     user.Role,
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"errors"
+	"log"
+)
+
+// Errors returned by the authenticators
+var (
+	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrDirectoryUnavailable = errors.New("the directory is unavailable")
+)
+
+// Authenticator checks the username and password of a login against a
+// backend, such as the local password hashes or a directory.
+//
+// Authenticate returns the user on success. It returns
+// ErrInvalidCredentials if the backend does not know the username or the
+// password is wrong, along with the user if the backend knows who they
+// are, so the failure can be recorded against them. Any other error means
+// the backend could not check the password.
+//
+// Account statuses are not checked: the caller decides whether the user
+// may log in.
+type Authenticator interface {
+	Authenticate(username, password string) (*models.User, error)
+}
+
+// LocalAuthenticator checks passwords against the hashes of the users
+type LocalAuthenticator struct {
+	Users UserServiceInterface
+}
+
+// Authenticate checks the password of the user with the username. Users
+// without a local password, such as those of a directory, are not
+// recognized, so another backend can report on them.
+func (a *LocalAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	user, err := a.Users.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidCredentials
+	}
+	if err := a.Users.CheckPassword(user, password); err != nil {
+		if user.Password == "" {
+			return nil, ErrInvalidCredentials
+		}
+		return user, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// AuthenticatorChain tries authenticators in order, and returns the user of
+// the first that accepts the password.
+//
+// If none does, it returns ErrInvalidCredentials with the first user a
+// backend recognized, if any. A backend that fails, such as a directory
+// that is down, is logged and skipped; its error is returned only if no
+// other backend recognized the user, so an outage is not reported as a
+// wrong password.
+type AuthenticatorChain []Authenticator
+
+// Authenticate tries the authenticators of the chain in order
+func (c AuthenticatorChain) Authenticate(username, password string) (*models.User, error) {
+	var recognized *models.User
+	var failure error
+	for _, authenticator := range c {
+		user, err := authenticator.Authenticate(username, password)
+		switch {
+		case err == nil:
+			return user, nil
+		case errors.Is(err, ErrInvalidCredentials):
+			if recognized == nil {
+				recognized = user
+			}
+		default:
+			log.Printf("Authenticator %T failed: %v", authenticator, err)
+			if failure == nil {
+				failure = err
+			}
+		}
+	}
+	if recognized != nil || failure == nil {
+		return recognized, ErrInvalidCredentials
+	}
+	return nil, failure
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Kinds of certificate identities a service account can be mapped from: the
+// common name of the subject, and the DNS, URI (such as a SPIFFE ID) and
+// email subject alternative names
+const (
+	CertificateIdentityCommonName = "CN="
+	CertificateIdentityDNS        = "DNS:"
+	CertificateIdentityURI        = "URI:"
+	CertificateIdentityEmail      = "EMAIL:"
+)
+
+// ErrUnknownClientCertificate is returned for client certificates that are
+// not mapped to a service account
+var ErrUnknownClientCertificate = errors.New("the client certificate is not mapped to a service account")
+
+// ClientCertificateServiceInterface defines the interface for the
+// ClientCertificateService
+type ClientCertificateServiceInterface interface {
+	Authenticate(certificate *x509.Certificate) (*ServiceAccount, *models.User, error)
+}
+
+// ServiceAccount is an internal service calling the API with a client
+// certificate instead of a password. It acts as the user with the username,
+// with the scopes it is granted only.
+type ServiceAccount struct {
+	ID       string
+	Username string
+	// Subjects are the certificate identities mapped to the account, such as
+	// "CN=billing", "DNS:billing.internal" or "URI:spiffe://corp/billing"
+	Subjects []string
+	Scopes   []string
+}
+
+// ClientCertificateService maps the client certificates of TLS connections,
+// verified against the configured CA bundle by the server, to service
+// accounts
+type ClientCertificateService struct {
+	Users    repository.UserRepository
+	Accounts []ServiceAccount
+}
+
+// NewClientCertificateService creates a new ClientCertificateService for the
+// service accounts. It fails if an account has no subjects, a subject of an
+// unknown kind or an unknown scope.
+func NewClientCertificateService(users repository.UserRepository, accounts []ServiceAccount) (*ClientCertificateService, error) {
+	accounts = append([]ServiceAccount(nil), accounts...)
+	for i, account := range accounts {
+		if account.Username == "" {
+			return nil, fmt.Errorf("service account %s has no username", account.ID)
+		}
+		if len(account.Subjects) == 0 {
+			return nil, fmt.Errorf("service account %s has no subjects", account.ID)
+		}
+		subjects := make([]string, len(account.Subjects))
+		for j, subject := range account.Subjects {
+			normalized, ok := normalizeCertificateIdentity(subject)
+			if !ok {
+				return nil, fmt.Errorf("service account %s has an unknown subject %q", account.ID, subject)
+			}
+			subjects[j] = normalized
+		}
+		for _, scope := range account.Scopes {
+			if !containsString(models.AccessTokenScopes, scope) {
+				return nil, fmt.Errorf("service account %s has an unknown scope %q", account.ID, scope)
+			}
+		}
+		accounts[i].Subjects = subjects
+	}
+	return &ClientCertificateService{Users: users, Accounts: accounts}, nil
+}
+
+// Authenticate returns the service account a verified client certificate is
+// mapped to, with its user. The first account with a subject matching one of
+// the identities of the certificate is used.
+//
+// It returns ErrUnknownClientCertificate if no account matches,
+// ErrUserNotFound if the user of the account does not exist, and the errors
+// of AccountStatusError, with the user, if its account cannot be used.
+func (s *ClientCertificateService) Authenticate(certificate *x509.Certificate) (*ServiceAccount, *models.User, error) {
+	identities := certificateIdentities(certificate)
+	for i := range s.Accounts {
+		account := &s.Accounts[i]
+		matched := false
+		for _, identity := range identities {
+			matched = matched || containsString(account.Subjects, identity)
+		}
+		if !matched {
+			continue
+		}
+
+		user, err := s.Users.GetUserByUsername(CanonicalUsername(account.Username))
+		if err != nil {
+			return nil, nil, err
+		}
+		if user == nil {
+			return nil, nil, ErrUserNotFound
+		}
+		if err := AccountStatusError(user); err != nil {
+			return nil, user, err
+		}
+		return account, user, nil
+	}
+	return nil, nil, ErrUnknownClientCertificate
+}
+
+// certificateIdentities returns the identities of a certificate, normalized
+// like the subjects of the service accounts
+func certificateIdentities(certificate *x509.Certificate) []string {
+	var identities []string
+	if certificate.Subject.CommonName != "" {
+		identities = append(identities, CertificateIdentityCommonName+certificate.Subject.CommonName)
+	}
+	for _, name := range certificate.DNSNames {
+		identities = append(identities, CertificateIdentityDNS+strings.ToLower(name))
+	}
+	for _, uri := range certificate.URIs {
+		identities = append(identities, CertificateIdentityURI+uri.String())
+	}
+	for _, email := range certificate.EmailAddresses {
+		identities = append(identities, CertificateIdentityEmail+strings.ToLower(email))
+	}
+	return identities
+}
+
+// normalizeCertificateIdentity returns an identity with its kind in upper
+// case, and DNS names and email addresses in lower case, since they are not
+// case-sensitive. It reports false for identities of an unknown kind.
+func normalizeCertificateIdentity(identity string) (string, bool) {
+	for _, kind := range []string{CertificateIdentityCommonName, CertificateIdentityDNS, CertificateIdentityURI, CertificateIdentityEmail} {
+		if len(identity) <= len(kind) || !strings.EqualFold(identity[:len(kind)], kind) {
+			continue
+		}
+		value := identity[len(kind):]
+		if kind == CertificateIdentityDNS || kind == CertificateIdentityEmail {
+			value = strings.ToLower(value)
+		}
+		return kind + value, true
+	}
+	return "", false
+}
@@ -0,0 +1,545 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Provisioning rules, applied when an external account that is not linked
+// to a user yet logs in
+const (
+	// ProvisionNone only lets linked accounts log in
+	ProvisionNone = "none"
+	// ProvisionCreate creates a new user, and fails if the username is taken
+	ProvisionCreate = "create"
+	// ProvisionLink links the existing user with the same username, and
+	// creates one otherwise. An existing user is only linked when the
+	// provider asserts their verified email, and never when they are an
+	// admin, since the username claim is not verified.
+	ProvisionLink = "link"
+)
+
+// Errors returned by the ExternalLoginService
+var (
+	ErrUnknownProvider    = errors.New("unknown identity provider")
+	ErrExternalLoginState = errors.New("the sign-in request has expired or was started in another browser")
+	ErrInvalidIDToken     = errors.New("the identity provider sent an invalid ID token")
+	ErrIdentityNotLinked  = errors.New("this account is not linked to any user")
+	ErrIdentityDomain     = errors.New("accounts with this email address cannot sign in")
+	ErrIdentityLink       = errors.New("this account cannot be linked to the existing user with the same username")
+)
+
+// idTokenLeeway is the clock skew tolerated when checking the ID tokens
+const idTokenLeeway = time.Minute
+
+// ExternalProvider is an external OpenID Connect identity provider users
+// can log in with
+type ExternalProvider struct {
+	// ID names the provider in URLs and in the identities table
+	ID           string
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Provisioning is the rule applied to unlinked accounts
+	Provisioning string
+	// AllowedDomains restricts provisioning to verified emails in these
+	// domains; empty allows any account
+	AllowedDomains []string
+	// DefaultRole is the role of the users created through the provider
+	DefaultRole string
+	// UsernameClaim is the ID token claim holding the username of new
+	// users. Email addresses are cut at the "@".
+	UsernameClaim string
+}
+
+// ExternalLogin is the result of a login through an external provider
+type ExternalLogin struct {
+	User     *models.User
+	Identity *models.Identity
+	Provider *ExternalProvider
+	// Next is the local page the user logged in from, if any
+	Next string
+	// Created and Linked report whether this login created the user, or
+	// linked the account to an existing one
+	Created bool
+	Linked  bool
+}
+
+// ExternalLoginServiceInterface defines the interface for the
+// ExternalLoginService
+type ExternalLoginServiceInterface interface {
+	Providers() []ExternalProvider
+	BeginLogin(providerID, next string) (authURL string, stateCookie string, err error)
+	CompleteLogin(providerID, stateCookie, state, code string) (*ExternalLogin, error)
+}
+
+// ExternalLoginService logs users in with external OpenID Connect
+// providers, using the authorization code flow.
+//
+// Each login is protected by a state, a nonce and a PKCE verifier, kept in
+// a cookie signed with StateKey so the callback only succeeds in the
+// browser that started it. External accounts are linked to users in the
+// identities table, and created according to the provisioning rule of the
+// provider.
+type ExternalLoginService struct {
+	Repo  repository.IdentityRepository
+	Users UserServiceInterface
+	// BaseURL is the public base URL of this service, without trailing
+	// slash, used to build the redirect URIs
+	BaseURL       string
+	StateKey      []byte
+	StateLifetime time.Duration
+	HTTPClient    *http.Client
+	Now           func() time.Time
+
+	providers []ExternalProvider
+	mu        sync.Mutex
+	metadata  map[string]*providerMetadata
+}
+
+// providerMetadata is the discovery document of a provider, with its keys
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	keys          map[string]*rsa.PublicKey
+	keysFetchedAt time.Time
+}
+
+// loginState is the content of the state cookie
+type loginState struct {
+	Provider string `json:"prv"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"cv"`
+	Next     string `json:"next,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// NewExternalLoginService creates a new ExternalLoginService for the
+// providers, with 10 minutes to complete a login. Without a state key, a
+// random one is generated, and logins cannot span restarts.
+func NewExternalLoginService(repo repository.IdentityRepository, users UserServiceInterface, baseURL string, stateKey []byte, providers []ExternalProvider) *ExternalLoginService {
+	if len(stateKey) == 0 {
+		stateKey = make([]byte, 32)
+		if _, err := rand.Read(stateKey); err != nil {
+			panic(err)
+		}
+	}
+	return &ExternalLoginService{
+		Repo:          repo,
+		Users:         users,
+		BaseURL:       strings.TrimRight(baseURL, "/"),
+		StateKey:      stateKey,
+		StateLifetime: 10 * time.Minute,
+		HTTPClient:    &http.Client{Timeout: 10 * time.Second},
+		Now:           time.Now,
+		providers:     providers,
+		metadata:      make(map[string]*providerMetadata),
+	}
+}
+
+// Providers returns the configured providers, in order
+func (s *ExternalLoginService) Providers() []ExternalProvider {
+	return s.providers
+}
+
+// RedirectURI returns the callback URL to register at a provider
+func (s *ExternalLoginService) RedirectURI(providerID string) string {
+	return s.BaseURL + "/api/v1/user/login/" + url.PathEscape(providerID) + "/callback"
+}
+
+// BeginLogin starts a login with a provider.
+//
+// It returns the authorization URL to send the user to, and the value of
+// the state cookie to set in their browser. next is the local page to go
+// back to after the login.
+func (s *ExternalLoginService) BeginLogin(providerID, next string) (string, string, error) {
+	provider := s.provider(providerID)
+	if provider == nil {
+		return "", "", ErrUnknownProvider
+	}
+	metadata, err := s.discover(provider)
+	if err != nil {
+		return "", "", err
+	}
+
+	state := loginState{Provider: provider.ID, Next: next}
+	for _, value := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		if *value, err = randomToken(32); err != nil {
+			return "", "", err
+		}
+	}
+	state.ExpiresAt = jwt.NewNumericDate(s.Now().Add(s.StateLifetime))
+	cookie, err := jwt.NewWithClaims(jwt.SigningMethodHS256, state).SignedString(s.StateKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid authorization endpoint of %s: %w", provider.ID, err)
+	}
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientID)
+	query.Set("redirect_uri", s.RedirectURI(provider.ID))
+	query.Set("scope", strings.Join(provider.Scopes, " "))
+	query.Set("state", state.State)
+	query.Set("nonce", state.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), cookie, nil
+}
+
+// CompleteLogin finishes a login when the provider redirects the user back
+// with a code.
+//
+// The state must match the state cookie of the browser. The code is
+// exchanged for an ID token, whose signature, issuer, audience, expiry and
+// nonce are checked. The account is then resolved to a user: through its
+// linked identity, or by applying the provisioning rule of the provider.
+func (s *ExternalLoginService) CompleteLogin(providerID, stateCookie, state, code string) (*ExternalLogin, error) {
+	provider := s.provider(providerID)
+	if provider == nil {
+		return nil, ErrUnknownProvider
+	}
+
+	expected, err := s.parseState(stateCookie)
+	if err != nil || expected.Provider != provider.ID || subtle.ConstantTimeCompare([]byte(expected.State), []byte(state)) != 1 {
+		return nil, ErrExternalLoginState
+	}
+
+	metadata, err := s.discover(provider)
+	if err != nil {
+		return nil, err
+	}
+	rawIDToken, err := s.exchangeCode(provider, metadata, code, expected.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.verifyIDToken(provider, metadata, rawIDToken, expected.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	login, err := s.resolveIdentity(provider, claims)
+	if err != nil {
+		return nil, err
+	}
+	login.Next = expected.Next
+	return login, nil
+}
+
+// provider returns the provider with the ID, or nil
+func (s *ExternalLoginService) provider(id string) *ExternalProvider {
+	for i := range s.providers {
+		if s.providers[i].ID == id {
+			return &s.providers[i]
+		}
+	}
+	return nil
+}
+
+// parseState verifies the signature and expiry of a state cookie
+func (s *ExternalLoginService) parseState(cookie string) (*loginState, error) {
+	var state loginState
+	parser := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Alg()}, SkipClaimsValidation: true}
+	if _, err := parser.ParseWithClaims(cookie, &state, func(*jwt.Token) (interface{}, error) {
+		return s.StateKey, nil
+	}); err != nil {
+		return nil, err
+	}
+	if !state.VerifyExpiresAt(s.Now(), true) {
+		return nil, ErrExternalLoginState
+	}
+	return &state, nil
+}
+
+// discover returns the discovery document of a provider, fetched on first
+// use. The issuer it declares must be the configured one.
+func (s *ExternalLoginService) discover(provider *ExternalProvider) (*providerMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if metadata, ok := s.metadata[provider.ID]; ok {
+		return metadata, nil
+	}
+
+	var metadata providerMetadata
+	if err := s.getJSON(strings.TrimRight(provider.Issuer, "/")+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, fmt.Errorf("discovery of %s failed: %w", provider.ID, err)
+	}
+	if metadata.Issuer != provider.Issuer {
+		return nil, fmt.Errorf("discovery of %s failed: unexpected issuer %q", provider.ID, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery of %s failed: missing endpoints", provider.ID)
+	}
+	s.metadata[provider.ID] = &metadata
+	return &metadata, nil
+}
+
+// signingKey returns the key of a provider with the key ID. The JWKS is
+// fetched again when the key is unknown, at most once a minute, to follow
+// key rotations.
+func (s *ExternalLoginService) signingKey(metadata *providerMetadata, kid string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := metadata.keys[kid]; ok {
+		return key, nil
+	}
+	if s.Now().Sub(metadata.keysFetchedAt) < time.Minute {
+		return nil, errors.New("unknown signing key")
+	}
+
+	var jwks struct {
+		Keys []utils.JWK `json:"keys"`
+	}
+	if err := s.getJSON(metadata.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch the signing keys: %w", err)
+	}
+	metadata.keys = make(map[string]*rsa.PublicKey)
+	metadata.keysFetchedAt = s.Now()
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := utils.RSAPublicKeyFromJWK(jwk); err == nil {
+			metadata.keys[jwk.Kid] = key
+		}
+	}
+
+	if key, ok := metadata.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// exchangeCode exchanges an authorization code for an ID token at the
+// token endpoint of the provider
+func (s *ExternalLoginService) exchangeCode(provider *ExternalProvider, metadata *providerMetadata, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.RedirectURI(provider.ID)},
+		"code_verifier": {verifier},
+	}
+	if provider.ClientSecret == "" {
+		form.Set("client_id", provider.ClientID)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if provider.ClientSecret != "" {
+		// RFC 6749 section 2.3.1 form encodes the Basic credentials
+		request.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+	}
+
+	response, err := s.HTTPClient.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("token request to %s failed: %w", provider.ID, err)
+	}
+	defer response.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("token request to %s failed: %s", provider.ID, response.Status)
+	}
+	if response.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("token request to %s failed: %s %s", provider.ID, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("%w: no ID token in the token response", ErrInvalidIDToken)
+	}
+	return body.IDToken, nil
+}
+
+// verifyIDToken checks an ID token and returns its claims
+func (s *ExternalLoginService) verifyIDToken(provider *ExternalProvider, metadata *providerMetadata, rawIDToken, nonce string) (jwt.MapClaims, error) {
+	parser := jwt.Parser{ValidMethods: []string{"RS256"}, SkipClaimsValidation: true}
+	token, err := parser.Parse(rawIDToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return s.signingKey(metadata, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+
+	now := s.Now()
+	audiences, _ := claims["aud"].([]interface{})
+	azp, _ := claims["azp"].(string)
+	tokenNonce, _ := claims["nonce"].(string)
+	subject, _ := claims["sub"].(string)
+	switch {
+	case claims["iss"] != metadata.Issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidIDToken)
+	case !claims.VerifyAudience(provider.ClientID, true):
+		return nil, fmt.Errorf("%w: not issued for this client", ErrInvalidIDToken)
+	case len(audiences) > 1 && azp != provider.ClientID:
+		return nil, fmt.Errorf("%w: not issued for this client", ErrInvalidIDToken)
+	case !claims.VerifyExpiresAt(now.Add(-idTokenLeeway).Unix(), true):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case !claims.VerifyIssuedAt(now.Add(idTokenLeeway).Unix(), false):
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	case subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	case subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// resolveIdentity returns the user of an external account, applying the
+// provisioning rule of the provider when the account is not linked yet
+func (s *ExternalLoginService) resolveIdentity(provider *ExternalProvider, claims jwt.MapClaims) (*ExternalLogin, error) {
+	subject := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	now := s.Now()
+
+	identity, err := s.Repo.GetIdentity(provider.ID, subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		// Deleted users are not loaded with their identities
+		if identity.User.ID == 0 {
+			return nil, ErrIdentityNotLinked
+		}
+		if !identity.User.Active() {
+			return nil, ErrUserDeactivated
+		}
+		if err := s.Repo.UpdateIdentityLogin(identity.ID, now, email); err != nil {
+			log.Printf("Failed to record the login of identity %d: %v", identity.ID, err)
+		}
+		user := identity.User
+		return &ExternalLogin{User: &user, Identity: identity, Provider: provider}, nil
+	}
+
+	if provider.Provisioning != ProvisionCreate && provider.Provisioning != ProvisionLink {
+		return nil, ErrIdentityNotLinked
+	}
+	if len(provider.AllowedDomains) > 0 && !emailDomainAllowed(claims, provider.AllowedDomains) {
+		return nil, ErrIdentityDomain
+	}
+
+	usernameClaim := provider.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+	username, _ := claims[usernameClaim].(string)
+	username, _, _ = strings.Cut(username, "@")
+	if username == "" {
+		return nil, fmt.Errorf("%w: no %s claim", ErrInvalidIDToken, usernameClaim)
+	}
+
+	login := &ExternalLogin{Provider: provider}
+	if provider.Provisioning == ProvisionLink {
+		if login.User, err = s.Users.GetUserByUsername(username); err != nil {
+			return nil, err
+		}
+		login.Linked = login.User != nil
+		if login.Linked && !linkAllowed(login.User, claims) {
+			return nil, ErrIdentityLink
+		}
+		if login.Linked && !login.User.Active() {
+			return nil, ErrUserDeactivated
+		}
+	}
+	if login.User == nil {
+		if login.User, err = s.Users.ProvisionUser(username, provider.DefaultRole); err != nil {
+			return nil, err
+		}
+		login.Created = true
+	}
+
+	login.Identity = &models.Identity{
+		UserID:      login.User.ID,
+		Provider:    provider.ID,
+		Subject:     subject,
+		Email:       email,
+		LastLoginAt: &now,
+	}
+	if err := s.Repo.CreateIdentity(login.Identity); err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+// getJSON fetches a JSON document
+func (s *ExternalLoginService) getJSON(url string, target interface{}) error {
+	response, err := s.HTTPClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return errors.New(response.Status)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(target)
+}
+
+// linkAllowed reports whether an external account may be linked to the
+// existing user with its username: the ID token must have the verified
+// email of the user, and admins are never linked
+func linkAllowed(user *models.User, claims jwt.MapClaims) bool {
+	email, _ := claims["email"].(string)
+	return user.Role != models.RoleAdmin && user.Email != "" && emailVerified(claims) && strings.EqualFold(email, user.Email)
+}
+
+// emailVerified reports whether the provider verified the email of the ID
+// token
+func emailVerified(claims jwt.MapClaims) bool {
+	// Some providers send the flag as a string
+	return claims["email_verified"] == true || claims["email_verified"] == "true"
+}
+
+// emailDomainAllowed reports whether the ID token has a verified email in
+// one of the domains
+func emailDomainAllowed(claims jwt.MapClaims, domains []string) bool {
+	email, _ := claims["email"].(string)
+	at := strings.LastIndex(email, "@")
+	if !emailVerified(claims) || at < 0 {
+		return false
+	}
+	for _, domain := range domains {
+		if strings.EqualFold(email[at+1:], domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"errors"
+)
+
+// Errors returned by the ImpersonationService
+var (
+	ErrImpersonationNotAllowed = errors.New("you are not allowed to impersonate users")
+	ErrImpersonationTarget     = errors.New("this user cannot be impersonated")
+	ErrImpersonating           = errors.New("this action is not available while impersonating a user")
+)
+
+// ImpersonationServiceInterface defines the interface for the
+// ImpersonationService
+type ImpersonationServiceInterface interface {
+	CanImpersonate(actorID uint) (bool, error)
+	StartImpersonation(actorID, targetID uint) (*models.User, *models.User, error)
+	StopImpersonation(actorID uint) (*models.User, error)
+}
+
+// ImpersonationService lets admins granted the impersonate permission log
+// in as other users, for example to reproduce a problem they report.
+//
+// Only active users who are not admins can be impersonated, so an
+// impersonation never gains more privileges than the admin already has.
+type ImpersonationService struct {
+	UserRepo repository.UserRepository
+}
+
+// NewImpersonationService returns an ImpersonationService looking up users
+// in the repository
+func NewImpersonationService(userRepo repository.UserRepository) *ImpersonationService {
+	return &ImpersonationService{UserRepo: userRepo}
+}
+
+// MayImpersonate reports whether the user is an active admin granted the
+// impersonate permission. It is checked when an impersonation starts, and
+// again on every request made during it.
+func MayImpersonate(user *models.User) bool {
+	return user != nil && user.Active() && user.Role == models.RoleAdmin &&
+		user.HasPermission(models.PermissionImpersonate)
+}
+
+// CanImpersonate reports whether the user with the ID may impersonate
+// others, so pages only offer it to them
+func (s *ImpersonationService) CanImpersonate(actorID uint) (bool, error) {
+	actor, err := s.UserRepo.GetUserByID(actorID)
+	if err != nil {
+		return false, err
+	}
+	return MayImpersonate(actor), nil
+}
+
+// StartImpersonation checks that the actor may impersonate the target, and
+// returns them both.
+//
+// It returns ErrImpersonationNotAllowed if the actor may not impersonate
+// anyone, ErrUserNotFound if there is no target with the ID, and
+// ErrImpersonationTarget if the target is the actor, an admin or a user who
+// cannot log in.
+func (s *ImpersonationService) StartImpersonation(actorID, targetID uint) (*models.User, *models.User, error) {
+	actor, err := s.UserRepo.GetUserByID(actorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !MayImpersonate(actor) {
+		return nil, nil, ErrImpersonationNotAllowed
+	}
+
+	target, err := s.UserRepo.GetUserByID(targetID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if target == nil {
+		return actor, nil, ErrUserNotFound
+	}
+	if target.ID == actor.ID || target.Role == models.RoleAdmin || !target.Active() {
+		return actor, target, ErrImpersonationTarget
+	}
+	return actor, target, nil
+}
+
+// StopImpersonation returns the actor of an impersonation, so they can be
+// logged back in as themselves. It returns ErrUserNotFound if they were
+// deleted, and ErrImpersonationNotAllowed if they can no longer log in.
+func (s *ImpersonationService) StopImpersonation(actorID uint) (*models.User, error) {
+	actor, err := s.UserRepo.GetUserByID(actorID)
+	if err != nil {
+		return nil, err
+	}
+	if actor == nil {
+		return nil, ErrUserNotFound
+	}
+	if !actor.Active() {
+		return nil, ErrImpersonationNotAllowed
+	}
+	return actor, nil
+}
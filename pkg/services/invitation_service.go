@@ -0,0 +1,301 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/internal/tenant"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// InvitationPath is the path of the page accepting an invitation, followed
+// by its token
+const InvitationPath = "/api/v1/user/invitations/"
+
+// InvitationServiceInterface defines the interface for the InvitationService
+type InvitationServiceInterface interface {
+	CreateInvitation(ctx context.Context, inviterID uint, email, role, orgRole string) (*models.Invitation, error)
+	ListInvitations(ctx context.Context) ([]models.Invitation, error)
+	ResendInvitation(ctx context.Context, id uint) (*models.Invitation, error)
+	RevokeInvitation(ctx context.Context, id uint) (*models.Invitation, error)
+	GetPendingInvitation(token string) (*models.Invitation, error)
+	AcceptInvitation(token, username, password string) (*models.User, *models.Invitation, error)
+}
+
+// Errors returned by the InvitationService
+var (
+	ErrInvalidEmail      = errors.New("a valid email address is required")
+	ErrInvalidRole       = errors.New("unknown role")
+	ErrInvitationExists  = errors.New("this address already has a pending invitation")
+	ErrInvitationMissing = errors.New("invitation not found, or already accepted or revoked")
+	ErrInvitationInvalid = errors.New("this invitation is invalid or has already been used")
+	ErrInvitationExpired = errors.New("this invitation has expired, ask for a new one")
+	ErrInvitationNotSent = errors.New("the invitation was saved but could not be sent, resend it later")
+)
+
+// InvitationService sends invitations to create an account and join an
+// organization, and accepts them
+type InvitationService struct {
+	Repo          repository.InvitationRepository
+	Users         UserServiceInterface
+	UserRepo      repository.UserRepository
+	Organizations repository.OrganizationRepository
+	Mailer        Mailer
+	// BaseURL is the public URL of the service, the accept links point to
+	BaseURL string
+	// TTL is how long an invitation can be accepted after it is sent
+	TTL time.Duration
+	Now func() time.Time
+}
+
+// NewInvitationService creates a new InvitationService
+func NewInvitationService(repo repository.InvitationRepository, users UserServiceInterface, userRepo repository.UserRepository,
+	organizationRepo repository.OrganizationRepository, mailer Mailer, baseURL string, ttl time.Duration) *InvitationService {
+	return &InvitationService{
+		Repo:          repo,
+		Users:         users,
+		UserRepo:      userRepo,
+		Organizations: organizationRepo,
+		Mailer:        mailer,
+		BaseURL:       strings.TrimSuffix(baseURL, "/"),
+		TTL:           ttl,
+		Now:           time.Now,
+	}
+}
+
+// CreateInvitation invites an email address to the organization of the
+// context, on behalf of a member of it.
+//
+// The role is the site role of the new user and defaults to
+// models.RoleUser; orgRole is their role in the organization and defaults
+// to models.OrgRoleMember. An address can only have one pending invitation
+// per organization. If the email cannot be sent, the invitation is kept
+// and returned with ErrInvitationNotSent, so it can be resent.
+func (s *InvitationService) CreateInvitation(ctx context.Context, inviterID uint, email, role, orgRole string) (*models.Invitation, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		role = models.RoleUser
+	}
+	if role != models.RoleUser && role != models.RoleAdmin {
+		return nil, ErrInvalidRole
+	}
+	if orgRole == "" {
+		orgRole = models.OrgRoleMember
+	}
+	if !containsString(models.OrganizationRoles, orgRole) {
+		return nil, ErrInvalidOrganizationRole
+	}
+
+	inviter, err := s.Organizations.GetMembership(ctx, inviterID)
+	if err != nil {
+		return nil, err
+	}
+	if inviter == nil || !inviter.Active() {
+		return nil, ErrNotMember
+	}
+
+	now := s.Now()
+	existing, err := s.Repo.FindPendingInvitation(ctx, email, now)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrInvitationExists
+	}
+
+	token, hash, err := newInvitationToken()
+	if err != nil {
+		return nil, err
+	}
+	invitation := &models.Invitation{
+		Email:       email,
+		Role:        role,
+		OrgRole:     orgRole,
+		TokenHash:   hash,
+		SentAt:      now,
+		ExpiresAt:   now.Add(s.TTL),
+		InvitedByID: inviterID,
+	}
+	if err := s.Repo.CreateInvitation(ctx, invitation); err != nil {
+		return nil, err
+	}
+	invitation.Organization = inviter.Organization
+	invitation.InvitedBy = inviter.User
+	return invitation, s.send(invitation, token)
+}
+
+// ListInvitations returns the invitations of the organization of the
+// context, whatever their status
+func (s *InvitationService) ListInvitations(ctx context.Context) ([]models.Invitation, error) {
+	return s.Repo.ListInvitations(ctx)
+}
+
+// ResendInvitation sends an invitation of the organization of the context
+// again, with a new token and a new expiry time. The previous link stops
+// working. Expired invitations can be resent; accepted and revoked ones
+// return ErrInvitationMissing.
+func (s *InvitationService) ResendInvitation(ctx context.Context, id uint) (*models.Invitation, error) {
+	invitation, err := s.Repo.GetInvitation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if invitation == nil {
+		return nil, ErrInvitationMissing
+	}
+
+	token, hash, err := newInvitationToken()
+	if err != nil {
+		return nil, err
+	}
+	now := s.Now()
+	invitation.TokenHash, invitation.SentAt, invitation.ExpiresAt = hash, now, now.Add(s.TTL)
+	resent, err := s.Repo.ResendInvitation(ctx, invitation)
+	if err != nil {
+		return nil, err
+	}
+	if !resent {
+		return nil, ErrInvitationMissing
+	}
+	return invitation, s.send(invitation, token)
+}
+
+// RevokeInvitation revokes a pending or expired invitation of the
+// organization of the context, or returns ErrInvitationMissing
+func (s *InvitationService) RevokeInvitation(ctx context.Context, id uint) (*models.Invitation, error) {
+	revoked, err := s.Repo.RevokeInvitation(ctx, id, s.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		return nil, ErrInvitationMissing
+	}
+	return s.Repo.GetInvitation(ctx, id)
+}
+
+// GetPendingInvitation returns the invitation a token was sent with, with
+// its organization.
+//
+// It returns ErrInvitationExpired if it has expired, and
+// ErrInvitationInvalid if there is no such invitation or it was accepted or
+// revoked.
+func (s *InvitationService) GetPendingInvitation(token string) (*models.Invitation, error) {
+	if token == "" {
+		return nil, ErrInvitationInvalid
+	}
+	invitation, err := s.Repo.GetInvitationByTokenHash(sha256Hex(token))
+	if err != nil {
+		return nil, err
+	}
+	if invitation == nil {
+		return nil, ErrInvitationInvalid
+	}
+	switch invitation.Status(s.Now()) {
+	case models.InvitationPending:
+		return invitation, nil
+	case models.InvitationExpired:
+		return nil, ErrInvitationExpired
+	default:
+		return nil, ErrInvitationInvalid
+	}
+}
+
+// AcceptInvitation creates the account of an invitee.
+//
+// The username and password are checked like in UserService.CreateAccount.
+// The user is given the roles of the invitation and its email address, and
+// joins its organization, which becomes their active one. The invitation
+// is claimed first, so concurrent requests cannot use it twice; if the
+// account cannot be created, for example because the username is taken,
+// the invitation can be used again.
+func (s *InvitationService) AcceptInvitation(token, username, password string) (*models.User, *models.Invitation, error) {
+	invitation, err := s.GetPendingInvitation(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := s.Now()
+	claimed, err := s.Repo.ClaimInvitation(invitation.ID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !claimed {
+		return nil, nil, ErrInvitationInvalid
+	}
+
+	user, err := s.Users.CreateAccount(username, password, invitation.Email, models.UserStatusActive)
+	if err != nil {
+		if releaseErr := s.Repo.ReleaseInvitation(invitation.ID); releaseErr != nil {
+			log.Printf("Failed to release invitation %d: %v", invitation.ID, releaseErr)
+		}
+		return nil, nil, err
+	}
+	if err := s.Repo.SetAcceptedUser(invitation.ID, user.ID); err != nil {
+		return nil, nil, err
+	}
+
+	// Apply the roles chosen by the admin
+	organizationID := invitation.OrganizationID
+	user.Role = invitation.Role
+	user.ActiveOrganizationID = &organizationID
+	if err := s.UserRepo.UpdateUser(user); err != nil {
+		return nil, nil, err
+	}
+	ctx := tenant.WithOrganization(context.Background(), organizationID)
+	if err := s.Organizations.AddMember(ctx, &models.Membership{UserID: user.ID, Role: invitation.OrgRole}); err != nil {
+		return nil, nil, err
+	}
+
+	invitation.AcceptedAt = &now
+	invitation.AcceptedUserID = &user.ID
+	return user, invitation, nil
+}
+
+// send emails the accept link of an invitation to the invitee
+func (s *InvitationService) send(invitation *models.Invitation, token string) error {
+	inviter := invitation.InvitedBy.Username
+	if inviter == "" {
+		inviter = "An administrator"
+	}
+	subject := fmt.Sprintf("You are invited to join %s", invitation.Organization.Name)
+	body := fmt.Sprintf("%s invited you to join %s.\n\n"+
+		"Choose your username and password to create your account:\n%s\n\n"+
+		"This link can be used once and expires on %s.\n",
+		inviter, invitation.Organization.Name, s.BaseURL+InvitationPath+token,
+		invitation.ExpiresAt.UTC().Format("January 2, 2006 at 15:04 UTC"))
+
+	if err := s.Mailer.Send(invitation.Email, subject, body); err != nil {
+		log.Printf("Failed to send invitation %d: %v", invitation.ID, err)
+		return ErrInvitationNotSent
+	}
+	return nil
+}
+
+// normalizeEmail returns a bare email address in lower case, or
+// ErrInvalidEmail
+func normalizeEmail(email string) (string, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || address.Name != "" {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(address.Address), nil
+}
+
+// newInvitationToken returns a random invitation token and its hash
+func newInvitationToken() (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	return token, sha256Hex(token), nil
+}
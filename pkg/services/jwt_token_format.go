@@ -0,0 +1,110 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// jwtClaims is the payload of a session JWT: the registered claims, then the
+// others of the session
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	*models.Claims
+}
+
+// JWTFormat is the TokenFormat of JWTs signed with HS256. Other algorithms
+// are refused, whatever the header of the token says. The key is named by
+// the "kid" header.
+type JWTFormat struct {
+	keys []tokenKey
+}
+
+// NewJWTFormat creates a new JWTFormat signing with the secrets, newest
+// first, used as HMAC keys as they are
+func NewJWTFormat(secrets ...[]byte) *JWTFormat {
+	format := &JWTFormat{}
+	for _, secret := range secrets {
+		format.keys = append(format.keys, tokenKey{ID: tokenKeyID(secret), Key: secret})
+	}
+	return format
+}
+
+// Name returns TokenFormatJWT
+func (f *JWTFormat) Name() string {
+	return TokenFormatJWT
+}
+
+// Detect reports whether the token starts with a JSON header, as JWTs do
+func (f *JWTFormat) Detect(token string) bool {
+	return strings.HasPrefix(token, "eyJ")
+}
+
+// Seal signs the claims with the newest key
+func (f *JWTFormat) Seal(claims *models.Claims) (string, error) {
+	payload := jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    claims.Issuer,
+			Subject:   claims.Subject,
+			Audience:  claims.Audience,
+			ID:        claims.ID,
+			IssuedAt:  numericDate(claims.IssuedAt),
+			NotBefore: numericDate(claims.NotBefore),
+			ExpiresAt: numericDate(claims.ExpiresAt),
+		},
+		Claims: claims,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
+	token.Header["kid"] = f.keys[0].ID
+	return token.SignedString(f.keys[0].Key)
+}
+
+// Open checks the signature of a token with the key it names, or the newest
+// key if it names none, and returns its claims
+func (f *JWTFormat) Open(token string) (*models.Claims, error) {
+	payload := jwtClaims{Claims: &models.Claims{}}
+	parser := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Alg()}, SkipClaimsValidation: true}
+	if _, err := parser.ParseWithClaims(token, &payload, func(token *jwt.Token) (interface{}, error) {
+		kid, named := token.Header["kid"].(string)
+		if !named {
+			return f.keys[0].Key, nil
+		}
+		for _, key := range f.keys {
+			if key.ID == kid {
+				return key.Key, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims, registered := payload.Claims, payload.RegisteredClaims
+	claims.Issuer = registered.Issuer
+	claims.Subject = registered.Subject
+	claims.Audience = registered.Audience
+	claims.ID = registered.ID
+	claims.IssuedAt = numericTime(registered.IssuedAt)
+	claims.NotBefore = numericTime(registered.NotBefore)
+	claims.ExpiresAt = numericTime(registered.ExpiresAt)
+	return claims, nil
+}
+
+// numericDate returns the JWT date of a time, nil if zero
+func numericDate(t time.Time) *jwt.NumericDate {
+	if t.IsZero() {
+		return nil
+	}
+	return jwt.NewNumericDate(t)
+}
+
+// numericTime returns the time of a JWT date, zero if absent
+func numericTime(date *jwt.NumericDate) time.Time {
+	if date == nil {
+		return time.Time{}
+	}
+	return date.Time
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// LDAPProvider names the directory in the identities table
+const LDAPProvider = "ldap"
+
+// ErrDirectoryUserConflict is returned when a directory account has the
+// username of a local user it is not linked to
+var ErrDirectoryUserConflict = errors.New("a local account already has this username, ask an administrator to link it to the directory")
+
+// LDAPGroupRole gives a role to the members of a directory group
+type LDAPGroupRole struct {
+	// Group is the DN of the group, as listed in the group attribute of its
+	// members
+	Group string
+	Role  string
+}
+
+// LDAPAuthenticator checks passwords by binding to an LDAP directory, such
+// as Active Directory, as the entry of the user.
+//
+// The entry is first looked up with the service account, if any, using the
+// UserFilter. Directory users are linked to local users in the identities
+// table by the DN of their entry, and created on their first login. The
+// directory is authoritative for them: their role is set from their groups
+// and their email address and names from their entry on every login.
+type LDAPAuthenticator struct {
+	Users      UserServiceInterface
+	UserRepo   repository.UserRepository
+	Identities repository.IdentityRepository
+	// URL is the ldap:// or ldaps:// URL of the directory
+	URL       string
+	TLSConfig *tls.Config
+	// BindDN and BindPassword are the service account searching the
+	// users; an empty BindDN searches anonymously
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter finds the entry of a user, with "{username}" replaced by
+	// the escaped username, such as "(sAMAccountName={username})" on
+	// Active Directory
+	UserFilter string
+	// UsernameAttribute holds the username of the users created
+	UsernameAttribute string
+	// GroupAttribute lists the DNs of the groups of a user
+	GroupAttribute string
+	// GroupRoles are tried in order; the first group the user is a member
+	// of gives their role, and DefaultRole is used if none matches
+	GroupRoles  []LDAPGroupRole
+	DefaultRole string
+	Timeout     time.Duration
+	Now         func() time.Time
+}
+
+// NewLDAPAuthenticator returns an authenticator for the directory at the
+// URL, looking up users under the base DN by uid, with their groups in
+// memberOf. Set the other fields to match the schema of the directory.
+func NewLDAPAuthenticator(users UserServiceInterface, userRepo repository.UserRepository, identities repository.IdentityRepository, url, baseDN string) *LDAPAuthenticator {
+	return &LDAPAuthenticator{
+		Users:             users,
+		UserRepo:          userRepo,
+		Identities:        identities,
+		URL:               url,
+		BaseDN:            baseDN,
+		UserFilter:        "(uid={username})",
+		UsernameAttribute: "uid",
+		GroupAttribute:    "memberOf",
+		DefaultRole:       models.RoleUser,
+		Timeout:           5 * time.Second,
+		Now:               time.Now,
+	}
+}
+
+// ParseLDAPGroupRoles parses the group roles from their configuration
+// format: "<role>:<group DN>" entries separated by semicolons, as in
+// "admin:cn=admins,ou=groups,dc=example,dc=com".
+func ParseLDAPGroupRoles(spec string) ([]LDAPGroupRole, error) {
+	var groupRoles []LDAPGroupRole
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		role, group, ok := strings.Cut(entry, ":")
+		role, group = strings.TrimSpace(role), strings.TrimSpace(group)
+		if !ok || group == "" {
+			return nil, fmt.Errorf("group role %q: expected '<role>:<group DN>'", entry)
+		}
+		if role != models.RoleUser && role != models.RoleAdmin {
+			return nil, fmt.Errorf("group role %q: unknown role %q", entry, role)
+		}
+		groupRoles = append(groupRoles, LDAPGroupRole{Group: group, Role: role})
+	}
+	return groupRoles, nil
+}
+
+// Authenticate looks up the entry of the username and binds as it with the
+// password. Errors reaching the directory wrap ErrDirectoryUnavailable.
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	// An empty password would make an unauthenticated bind, which succeeds
+	username = strings.TrimSpace(username)
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := utils.DialLDAP(a.URL, a.TLSConfig, a.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDirectoryUnavailable, err)
+	}
+	defer conn.Close()
+
+	if a.BindDN != "" {
+		if err := conn.Bind(a.BindDN, a.BindPassword); err != nil {
+			return nil, fmt.Errorf("%w: service account: %v", ErrDirectoryUnavailable, err)
+		}
+	}
+	entries, err := conn.Search(utils.LDAPSearch{
+		BaseDN:     a.BaseDN,
+		Scope:      utils.LDAPScopeWholeSubtree,
+		Filter:     strings.ReplaceAll(a.UserFilter, "{username}", utils.EscapeLDAPFilter(username)),
+		Attributes: []string{a.UsernameAttribute, a.GroupAttribute, "mail", "givenName", "sn", "displayName"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: search: %v", ErrDirectoryUnavailable, err)
+	}
+	if len(entries) != 1 {
+		if len(entries) > 1 {
+			log.Printf("LDAP: %d entries match the username %q, refusing to pick one", len(entries), username)
+		}
+		return nil, ErrInvalidCredentials
+	}
+	entry := &entries[0]
+
+	identity, err := a.Identities.GetIdentity(LDAPProvider, strings.ToLower(entry.DN))
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if !utils.IsLDAPError(err, utils.LDAPResultInvalidCredentials) {
+			return nil, fmt.Errorf("%w: bind: %v", ErrDirectoryUnavailable, err)
+		}
+		// Deleted users are not loaded with their identities
+		if identity != nil && identity.User.ID != 0 {
+			user := identity.User
+			return &user, ErrInvalidCredentials
+		}
+		return nil, ErrInvalidCredentials
+	}
+	return a.resolveUser(entry, identity, username)
+}
+
+// resolveUser returns the user linked to a directory entry, creating it on
+// the first login, and updates its role and profile from the entry
+func (a *LDAPAuthenticator) resolveUser(entry *utils.LDAPEntry, identity *models.Identity, username string) (*models.User, error) {
+	now := a.Now()
+	email := entry.Get("mail")
+	role := a.role(entry.GetAll(a.GroupAttribute))
+
+	var user *models.User
+	if identity != nil {
+		if identity.User.ID == 0 {
+			return nil, ErrIdentityNotLinked
+		}
+		if err := a.Identities.UpdateIdentityLogin(identity.ID, now, email); err != nil {
+			log.Printf("Failed to record the login of identity %d: %v", identity.ID, err)
+		}
+		linked := identity.User
+		user = &linked
+	} else {
+		if name := entry.Get(a.UsernameAttribute); name != "" {
+			username = name
+		}
+		// Local users are not taken over by directory accounts with the
+		// same name
+		existing, err := a.Users.GetUserByUsername(username)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			log.Printf("LDAP: %s has the username of user %d, refusing to link them", entry.DN, existing.ID)
+			return nil, ErrDirectoryUserConflict
+		}
+		if user, err = a.Users.ProvisionUser(username, role); err != nil {
+			return nil, err
+		}
+		if err := a.Identities.CreateIdentity(&models.Identity{
+			UserID:      user.ID,
+			Provider:    LDAPProvider,
+			Subject:     strings.ToLower(entry.DN),
+			Email:       email,
+			LastLoginAt: &now,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	changed := false
+	update := func(field *string, value string) {
+		if value != "" && *field != value {
+			*field, changed = value, true
+		}
+	}
+	update(&user.Role, role)
+	update(&user.Email, email)
+	update(&user.GivenName, entry.Get("givenName"))
+	update(&user.FamilyName, entry.Get("sn"))
+	update(&user.DisplayName, entry.Get("displayName"))
+	if changed {
+		if err := a.UserRepo.UpdateUser(user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// role returns the role given by the first group role the user has
+func (a *LDAPAuthenticator) role(groups []string) string {
+	for _, groupRole := range a.GroupRoles {
+		for _, group := range groups {
+			if strings.EqualFold(group, groupRole.Group) {
+				return groupRole.Role
+			}
+		}
+	}
+	if a.DefaultRole == "" {
+		return models.RoleUser
+	}
+	return a.DefaultRole
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+// Thresholds of the suspicious login detection
+const (
+	// maxTravelSpeed is the fastest users are believed to travel between
+	// two logins, in km/h: about the speed of an airliner
+	maxTravelSpeed = 1000
+	// minTravelDistance is the shortest distance, in km, flagged as
+	// impossible travel, since IP geolocation is coarse
+	minTravelDistance = 500
+	// earthRadius is the mean radius of the Earth, in km
+	earthRadius = 6371
+)
+
+// GeoLocation is the coarse location of an IP address
+type GeoLocation struct {
+	CountryCode string
+	Country     string
+	City        string
+	Latitude    float64
+	Longitude   float64
+	// HasCoordinates is false for addresses only located to a country
+	HasCoordinates bool
+}
+
+// GeoLocator resolves the location of IP addresses. It returns nil and nil
+// for addresses it cannot locate.
+type GeoLocator interface {
+	Locate(ip string) (*GeoLocation, error)
+}
+
+// MMDBGeoLocator locates IP addresses with a GeoIP2 or GeoLite2 City
+// database in the MaxMind DB format
+type MMDBGeoLocator struct {
+	Reader *utils.MMDBReader
+}
+
+// Locate looks up the city of an IP address in the database
+func (l *MMDBGeoLocator) Locate(ip string) (*GeoLocation, error) {
+	address := net.ParseIP(ip)
+	if address == nil {
+		return nil, nil
+	}
+	city, found, err := l.Reader.City(address)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &GeoLocation{
+		CountryCode:    city.CountryCode,
+		Country:        city.Country,
+		City:           city.City,
+		Latitude:       city.Latitude,
+		Longitude:      city.Longitude,
+		HasCoordinates: city.HasCoordinates,
+	}, nil
+}
+
+// LoginNotifier alerts users of suspicious logins to their account
+type LoginNotifier interface {
+	NotifyLogin(user *models.User, attempt *models.LoginAttempt) error
+}
+
+// MailLoginNotifier emails the alerts to the address of the user. Users
+// without an address are not alerted.
+type MailLoginNotifier struct {
+	Mailer Mailer
+}
+
+// NotifyLogin emails the suspicious signs of a login to its user
+func (n *MailLoginNotifier) NotifyLogin(user *models.User, attempt *models.LoginAttempt) error {
+	if user.Email == "" {
+		return nil
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hello %s,\n\nWe noticed a login attempt to your account that looks unusual:\n\n", user.Username)
+	for _, message := range attempt.AlertMessages() {
+		fmt.Fprintf(&body, "- %s\n", message)
+	}
+	fmt.Fprintf(&body, "\nTime: %s\nDevice: %s\nIP address: %s\n", attempt.CreatedAt.UTC().Format(time.RFC1123), attempt.Device, attempt.IP)
+	if location := attempt.Location(); location != "" {
+		fmt.Fprintf(&body, "Location: %s\n", location)
+	}
+	body.WriteString("\nIf this was you, you can ignore this email. Otherwise, change your password and log out your other sessions from your account page.\n")
+	return n.Mailer.Send(user.Email, "Unusual login to your account", body.String())
+}
+
+// LoginHistoryServiceInterface defines the interface for the
+// LoginHistoryService
+type LoginHistoryServiceInterface interface {
+	RecordLogin(username string, user *models.User, outcome, ip, userAgent string) (*models.LoginAttempt, error)
+	ListLogins(userID uint, limit int) ([]models.LoginAttempt, error)
+}
+
+// LoginHistoryService records the logins to the login form and flags the
+// suspicious ones: logins from a new device, impossible travel between two
+// logins, and bursts of failed logins
+type LoginHistoryService struct {
+	Repo repository.LoginAttemptRepository
+	// Locator locates the IP of logins; nil leaves them unlocated and
+	// disables the impossible travel detection
+	Locator GeoLocator
+	// Notifier alerts users of suspicious logins; nil disables the alerts
+	Notifier LoginNotifier
+	// FailureThreshold failed logins to an account within FailureWindow
+	// are a burst
+	FailureThreshold int64
+	FailureWindow    time.Duration
+	Now              func() time.Time
+}
+
+// NewLoginHistoryService creates a new LoginHistoryService, flagging five
+// failed logins within 15 minutes as a burst
+func NewLoginHistoryService(repo repository.LoginAttemptRepository, locator GeoLocator, notifier LoginNotifier) *LoginHistoryService {
+	return &LoginHistoryService{
+		Repo:             repo,
+		Locator:          locator,
+		Notifier:         notifier,
+		FailureThreshold: 5,
+		FailureWindow:    15 * time.Minute,
+		Now:              time.Now,
+	}
+}
+
+// RecordLogin records a login with the given outcome, from an IP and user
+// agent, to the account of a user, or to an unknown username when user is
+// nil. It returns the recorded login.
+//
+// Successful logins from a user agent the user never logged in with before
+// are flagged as a new device, unless it is their first login or the agent
+// is unknown. Successful logins too far from the previous one for the time
+// between them are flagged as impossible travel. The failed login reaching
+// FailureThreshold within FailureWindow is flagged as a burst, so a burst
+// raises one alert. The user is alerted of flagged logins through the
+// Notifier; failing to alert them does not fail the recording.
+func (s *LoginHistoryService) RecordLogin(username string, user *models.User, outcome, ip, userAgent string) (*models.LoginAttempt, error) {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	now := s.Now()
+	attempt := &models.LoginAttempt{
+		CreatedAt: now,
+		Username:  username,
+		Outcome:   outcome,
+		IP:        ip,
+		UserAgent: userAgent,
+		Device:    DescribeDevice(userAgent),
+	}
+	s.locate(attempt)
+
+	if user != nil {
+		attempt.UserID = &user.ID
+		alerts, err := s.detect(user.ID, attempt)
+		if err != nil {
+			return nil, err
+		}
+		attempt.Alerts = strings.Join(alerts, ",")
+	}
+	if err := s.Repo.CreateLoginAttempt(attempt); err != nil {
+		return nil, err
+	}
+
+	if attempt.Alerts != "" && s.Notifier != nil {
+		if err := s.Notifier.NotifyLogin(user, attempt); err != nil {
+			log.Printf("Failed to alert user %d of a suspicious login: %v", user.ID, err)
+		}
+	}
+	return attempt, nil
+}
+
+// ListLogins returns the most recent logins to the account of a user, at
+// most limit of them
+func (s *LoginHistoryService) ListLogins(userID uint, limit int) ([]models.LoginAttempt, error) {
+	return s.Repo.ListLoginAttempts(userID, limit)
+}
+
+// locate sets the location of the IP of a login. Failing to locate it only
+// leaves the login unlocated.
+func (s *LoginHistoryService) locate(attempt *models.LoginAttempt) {
+	if s.Locator == nil {
+		return
+	}
+	location, err := s.Locator.Locate(attempt.IP)
+	if err != nil {
+		log.Printf("Failed to locate IP %s: %v", attempt.IP, err)
+		return
+	}
+	if location == nil {
+		return
+	}
+	attempt.CountryCode, attempt.Country, attempt.City = location.CountryCode, location.Country, location.City
+	if location.HasCoordinates {
+		latitude, longitude := location.Latitude, location.Longitude
+		attempt.Latitude, attempt.Longitude = &latitude, &longitude
+	}
+}
+
+// detect returns the suspicious signs of a login to the account of a user,
+// compared with their previous logins
+func (s *LoginHistoryService) detect(userID uint, attempt *models.LoginAttempt) ([]string, error) {
+	var alerts []string
+	if attempt.Outcome != models.AuditSuccess {
+		failures, err := s.Repo.CountFailedLogins(userID, attempt.CreatedAt.Add(-s.FailureWindow))
+		if err != nil {
+			return nil, err
+		}
+		if failures+1 == s.FailureThreshold {
+			alerts = append(alerts, models.LoginAlertFailureBurst)
+		}
+		return alerts, nil
+	}
+
+	if attempt.UserAgent != "" {
+		logins, err := s.Repo.CountSuccessfulLogins(userID, "")
+		if err != nil {
+			return nil, err
+		}
+		sameAgent, err := s.Repo.CountSuccessfulLogins(userID, attempt.UserAgent)
+		if err != nil {
+			return nil, err
+		}
+		if logins > 0 && sameAgent == 0 {
+			alerts = append(alerts, models.LoginAlertNewDevice)
+		}
+	}
+
+	if attempt.Latitude != nil {
+		previous, err := s.Repo.GetLastSuccessfulLogin(userID)
+		if err != nil {
+			return nil, err
+		}
+		if previous != nil && previous.Latitude != nil && impossibleTravel(previous, attempt) {
+			alerts = append(alerts, models.LoginAlertImpossibleTravel)
+		}
+	}
+	return alerts, nil
+}
+
+// impossibleTravel reports whether the user of two located logins could not
+// have traveled between them in the time between them
+func impossibleTravel(previous, attempt *models.LoginAttempt) bool {
+	distance := greatCircleDistance(*previous.Latitude, *previous.Longitude, *attempt.Latitude, *attempt.Longitude)
+	if distance < minTravelDistance {
+		return false
+	}
+	hours := attempt.CreatedAt.Sub(previous.CreatedAt).Hours()
+	return hours <= 0 || distance/hours > maxTravelSpeed
+}
+
+// greatCircleDistance returns the distance between two coordinates, in km,
+// with the haversine formula
+func greatCircleDistance(latitude1, longitude1, latitude2, longitude2 float64) float64 {
+	radians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLatitude, dLongitude := radians(latitude2-latitude1), radians(longitude2-longitude1)
+	a := math.Sin(dLatitude/2)*math.Sin(dLatitude/2) +
+		math.Cos(radians(latitude1))*math.Cos(radians(latitude2))*math.Sin(dLongitude/2)*math.Sin(dLongitude/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MagicLinkPath is the page logging in with a magic link, given its token
+// in the "token" query parameter
+const MagicLinkPath = "/api/v1/user/magic-link/verify"
+
+// Errors returned by the MagicLinkService
+var (
+	ErrMagicLinkInvalid = errors.New("this login link is invalid, has expired or was already used")
+	ErrMagicLinkBrowser = errors.New("this login link was requested from another browser, open it there or ask for a new one")
+)
+
+// MagicLinkServiceInterface defines the interface for the MagicLinkService
+type MagicLinkServiceInterface interface {
+	RequestLink(identifier, ip, browserSecret string) (string, error)
+	ConsumeLink(token, browserSecret string) (*models.User, error)
+}
+
+// MagicLinkService emails users links logging them in without their
+// password, and logs them in with those links
+type MagicLinkService struct {
+	Repo     repository.MagicLinkRepository
+	UserRepo repository.UserRepository
+	Mailer   Mailer
+	// Limiter meters the links sent to each email address with AddressLimit,
+	// so the service cannot be used to flood a mailbox
+	Limiter      repository.RateLimitRepository
+	AddressLimit models.RateLimitPolicy
+	// Secret signs the tokens of the links
+	Secret []byte
+	// BaseURL is the public URL of the service, the links point to
+	BaseURL string
+	// TTL is how long a link can be used after it is sent
+	TTL time.Duration
+	Now func() time.Time
+}
+
+// NewMagicLinkService creates a new MagicLinkService, sending at most
+// perHour links an hour to each email address
+func NewMagicLinkService(repo repository.MagicLinkRepository, userRepo repository.UserRepository, mailer Mailer,
+	limiter repository.RateLimitRepository, perHour int, secret []byte, baseURL string, ttl time.Duration) *MagicLinkService {
+	return &MagicLinkService{
+		Repo:     repo,
+		UserRepo: userRepo,
+		Mailer:   mailer,
+		Limiter:  limiter,
+		AddressLimit: models.RateLimitPolicy{
+			Method: "MAIL",
+			Route:  "magic-link",
+			Limit:  perHour,
+			Period: time.Hour,
+			KeyBy:  "email",
+		},
+		Secret:  secret,
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		TTL:     ttl,
+		Now:     time.Now,
+	}
+}
+
+// RequestLink emails a login link to the user with the given username or
+// email address, requested from an IP.
+//
+// The link only works in the browser holding browserSecret; a new secret is
+// made when it is empty. RequestLink returns the secret, to be kept in a
+// cookie of the browser. Links are only sent to active users with an email
+// address, at most AddressLimit to each address. Every user sharing an
+// address gets their own link. To not reveal which accounts exist, unknown
+// users, refused links and failures to send them are not errors, and are
+// only logged.
+func (s *MagicLinkService) RequestLink(identifier, ip, browserSecret string) (string, error) {
+	if browserSecret == "" {
+		var err error
+		if browserSecret, _, err = newInvitationToken(); err != nil {
+			return "", err
+		}
+	}
+
+	users, err := s.recipients(identifier)
+	if err != nil {
+		return "", err
+	}
+	limited := map[string]bool{}
+	for i := range users {
+		user := &users[i]
+		if user.Email == "" || AccountStatusError(user) != nil {
+			continue
+		}
+		address := strings.ToLower(user.Email)
+		allowed, seen := limited[address]
+		if !seen {
+			allowed = s.allow(address)
+			limited[address] = allowed
+		}
+		if !allowed {
+			log.Printf("Not sending a login link to user %d: too many links sent to their address", user.ID)
+			continue
+		}
+		if err := s.send(user, ip, browserSecret); err != nil {
+			return "", err
+		}
+	}
+	return browserSecret, nil
+}
+
+// ConsumeLink logs in with the login link of a token, opened in the browser
+// holding browserSecret, and returns its user.
+//
+// It returns ErrMagicLinkInvalid if the token was not signed by the
+// service, was already used or has expired, and ErrMagicLinkBrowser if the
+// link was requested from another browser; such a link can still be used
+// in the right browser. The link is used once, even by concurrent requests.
+// If the user may no longer log in, it is returned with the error of
+// AccountStatusError.
+func (s *MagicLinkService) ConsumeLink(token, browserSecret string) (*models.User, error) {
+	nonce, _, _ := strings.Cut(token, ".")
+	if nonce == "" || !hmac.Equal([]byte(token), []byte(s.signToken(nonce))) {
+		return nil, ErrMagicLinkInvalid
+	}
+	link, err := s.Repo.GetMagicLinkByTokenHash(sha256Hex(token))
+	if err != nil {
+		return nil, err
+	}
+	now := s.Now()
+	if link == nil || link.UsedAt != nil || !now.Before(link.ExpiresAt) {
+		return nil, ErrMagicLinkInvalid
+	}
+	if browserSecret == "" || !hmac.Equal([]byte(sha256Hex(browserSecret)), []byte(link.BrowserHash)) {
+		return nil, ErrMagicLinkBrowser
+	}
+
+	claimed, err := s.Repo.ClaimMagicLink(link.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrMagicLinkInvalid
+	}
+	user, err := s.UserRepo.GetUserByID(link.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrMagicLinkInvalid
+	}
+	return user, AccountStatusError(user)
+}
+
+// recipients returns the users with a username, or sharing an email
+// address
+func (s *MagicLinkService) recipients(identifier string) ([]models.User, error) {
+	identifier = strings.TrimSpace(identifier)
+	if strings.Contains(identifier, "@") {
+		email, err := normalizeEmail(identifier)
+		if err != nil {
+			return nil, nil
+		}
+		return s.UserRepo.ListUsersByEmail(email)
+	}
+	user, err := s.UserRepo.GetUserByUsername(CanonicalUsername(identifier))
+	if err != nil || user == nil {
+		return nil, err
+	}
+	return []models.User{*user}, nil
+}
+
+// allow consumes a link from the quota of an email address. If the rate
+// limit backend fails, the link is sent.
+func (s *MagicLinkService) allow(address string) bool {
+	if s.Limiter == nil {
+		return true
+	}
+	result, err := s.Limiter.Take("magic-link|email:"+address, s.AddressLimit, s.Now())
+	if err != nil {
+		log.Printf("Rate limiter unavailable, sending the login link: %v", err)
+		return true
+	}
+	return result.Allowed
+}
+
+// send creates a login link of a user, bound to a browser, and emails it
+// to them. Failing to send the email is only logged.
+func (s *MagicLinkService) send(user *models.User, ip, browserSecret string) error {
+	nonce, _, err := newInvitationToken()
+	if err != nil {
+		return err
+	}
+	token := s.signToken(nonce)
+	now := s.Now()
+	link := &models.MagicLink{
+		UserID:      user.ID,
+		TokenHash:   sha256Hex(token),
+		BrowserHash: sha256Hex(browserSecret),
+		IP:          ip,
+		ExpiresAt:   now.Add(s.TTL),
+	}
+	if err := s.Repo.CreateMagicLink(link); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hello %s,\n\n"+
+		"Follow this link to log in:\n%s\n\n"+
+		"The link can be used once, in the browser you asked for it from, and expires on %s. "+
+		"If you did not ask for it, ignore this email.\n",
+		user.Username, s.BaseURL+MagicLinkPath+"?token="+url.QueryEscape(token),
+		link.ExpiresAt.UTC().Format("January 2, 2006 at 15:04 UTC"))
+	if err := s.Mailer.Send(user.Email, "Your login link", body); err != nil {
+		log.Printf("Failed to send login link %d: %v", link.ID, err)
+	}
+	return nil
+}
+
+// signToken returns the token of a login link: its random nonce, signed so
+// forged tokens are rejected without a database lookup
+func (s *MagicLinkService) signToken(nonce string) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte("magic-link:" + nonce))
+	return nonce + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeviceCodeGrantType is the grant_type of the token requests of devices
+// polling for their token
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// DevicePath is the page where users enter the code shown by a device
+const DevicePath = "/device"
+
+// User codes are made of consonants, so they spell no words and are easy to
+// type, and shown in two groups of four
+const (
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// devicePollPenalty is added to the interval of a device each time it polls
+// too fast
+const devicePollPenalty = 5
+
+// Errors returned to the user on the device page
+var (
+	ErrDeviceCodeInvalid   = errors.New("this code is invalid or has expired, check the code shown by your device")
+	ErrDeviceConsentFailed = errors.New("the form has expired, please enter the code again")
+	ErrDeviceCodeAttempts  = errors.New("too many codes were entered, please try again later")
+)
+
+// DeviceAuthorizationRequest holds the parameters of a request to the
+// device authorization endpoint
+type DeviceAuthorizationRequest struct {
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	Scope        string `form:"scope"`
+}
+
+// DeviceAuthorizationResponse is the successful response of the device
+// authorization endpoint: the device code to poll with, and the code the
+// user enters at the verification URI
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// AuthorizeDevice handles a request to the device authorization endpoint.
+//
+// It authenticates the client like the token endpoint does, drops the
+// scopes missing from DeviceScopes, and returns a new device code with its user code.
+// Failures are *OAuthError values.
+func (s *OIDCService) AuthorizeDevice(request *DeviceAuthorizationRequest) (*DeviceAuthorizationResponse, error) {
+	client, err := s.authenticateClient(request.ClientID, request.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceCode, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	userCode, err := newUserCode()
+	if err != nil {
+		return nil, err
+	}
+
+	interval := int(s.DevicePollInterval.Seconds())
+	err = s.Repo.CreateDeviceAuthorization(&models.OAuthDeviceAuthorization{
+		DeviceCodeHash: sha256Hex(deviceCode),
+		UserCodeHash:   sha256Hex(userCode),
+		ClientID:       client.ClientID,
+		Scope:          supportedScopes(request.Scope, DeviceScopes),
+		Status:         models.DeviceAuthorizationPending,
+		Interval:       interval,
+		ExpiresAt:      s.Now().Add(s.DeviceCodeLifetime),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	displayed := userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+	return &DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                displayed,
+		VerificationURI:         s.Issuer + DevicePath,
+		VerificationURIComplete: s.Issuer + DevicePath + "?user_code=" + url.QueryEscape(displayed),
+		ExpiresIn:               int(s.DeviceCodeLifetime.Seconds()),
+		Interval:                interval,
+	}, nil
+}
+
+// PendingDeviceAuthorization returns the device authorization waiting for
+// a user code, as typed by the user with the given ID, and its client. It
+// returns ErrDeviceCodeInvalid if there is none, and ErrDeviceCodeAttempts
+// once the user entered UserCodeLimit codes.
+func (s *OIDCService) PendingDeviceAuthorization(userID uint, userCode string) (*models.OAuthDeviceAuthorization, *models.OAuthClient, error) {
+	if !s.allowUserCode(userID) {
+		return nil, nil, ErrDeviceCodeAttempts
+	}
+	return s.pendingDeviceAuthorization(userCode)
+}
+
+// allowUserCode consumes a user code from the quota of a user. If the rate
+// limit backend fails, the code is looked up.
+func (s *OIDCService) allowUserCode(userID uint) bool {
+	if s.Limiter == nil {
+		return true
+	}
+	result, err := s.Limiter.Take("device|user:"+strconv.FormatUint(uint64(userID), 10), s.UserCodeLimit, s.Now())
+	if err != nil {
+		log.Printf("Rate limiter unavailable, looking up the user code: %v", err)
+		return true
+	}
+	return result.Allowed
+}
+
+// pendingDeviceAuthorization returns the device authorization waiting for
+// a user code and its client, like PendingDeviceAuthorization
+func (s *OIDCService) pendingDeviceAuthorization(userCode string) (*models.OAuthDeviceAuthorization, *models.OAuthClient, error) {
+	authorization, err := s.Repo.GetPendingDeviceAuthorization(sha256Hex(normalizeUserCode(userCode)), s.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	if authorization == nil {
+		return nil, nil, ErrDeviceCodeInvalid
+	}
+	client, err := s.Repo.GetClientByClientID(authorization.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if client == nil {
+		return nil, nil, ErrDeviceCodeInvalid
+	}
+	return authorization, client, nil
+}
+
+// DeviceConsentToken returns the token the device page must post back,
+// binding the decision to the user and the user code shown to them, like
+// ConsentToken
+func (s *OIDCService) DeviceConsentToken(userID uint, userCode string) string {
+	mac := hmac.New(sha256.New, s.consentKey())
+	for _, field := range []string{"device", strconv.FormatUint(uint64(userID), 10), normalizeUserCode(userCode)} {
+		fmt.Fprintf(mac, "%d:%s;", len(field), field)
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DecideDeviceAuthorization approves or denies the device authorization
+// waiting for a user code, after checking the consent token of the form,
+// and returns it.
+//
+// It returns ErrDeviceConsentFailed if the consent token does not match,
+// and ErrDeviceCodeInvalid if no authorization is waiting for the code.
+func (s *OIDCService) DecideDeviceAuthorization(userID uint, userCode string, allow bool, consentToken string) (*models.OAuthDeviceAuthorization, error) {
+	if !hmac.Equal([]byte(consentToken), []byte(s.DeviceConsentToken(userID, userCode))) {
+		return nil, ErrDeviceConsentFailed
+	}
+	authorization, _, err := s.pendingDeviceAuthorization(userCode)
+	if err != nil {
+		return nil, err
+	}
+
+	status := models.DeviceAuthorizationDenied
+	if allow {
+		status = models.DeviceAuthorizationApproved
+	}
+	decided, err := s.Repo.DecideDeviceAuthorization(authorization.ID, userID, status, s.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !decided {
+		return nil, ErrDeviceCodeInvalid
+	}
+	authorization.Status = status
+	authorization.UserID = &userID
+	return authorization, nil
+}
+
+// PollDeviceAuthorization handles a request of a device polling the token
+// endpoint with its device code, and returns the user who approved it with
+// the approved scope and, with the openid scope, an ID token. The access
+// token is left to the caller: the device signs in to a session of the
+// user, issued by the TokenService and limited to the scope (see
+// NewDeviceClaims).
+//
+// It authenticates the client and answers with the errors of RFC 8628:
+// authorization_pending until the user decides, slow_down when the device
+// polls more often than its interval (which is then raised by 5 seconds),
+// access_denied if the user denied it and expired_token once the device
+// code has expired. An approved device code gets a token once. Failures are
+// *OAuthError values.
+func (s *OIDCService) PollDeviceAuthorization(request *TokenRequest) (*models.User, *TokenResponse, error) {
+	client, err := s.authenticateClient(request.ClientID, request.ClientSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	authorization, err := s.Repo.GetDeviceAuthorizationByDeviceCodeHash(sha256Hex(request.DeviceCode))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := s.Now()
+	switch {
+	case authorization == nil, authorization.ClientID != client.ClientID, authorization.UsedAt != nil:
+		return nil, nil, oauthError("invalid_grant", "the device code is invalid or already used")
+	case !now.Before(authorization.ExpiresAt):
+		return nil, nil, oauthError("expired_token", "the device code has expired, start over")
+	}
+
+	interval := authorization.Interval
+	tooFast := authorization.LastPolledAt != nil && now.Sub(*authorization.LastPolledAt) < time.Duration(interval)*time.Second
+	if tooFast {
+		interval += devicePollPenalty
+	}
+	if err := s.Repo.RecordDevicePoll(authorization.ID, now, interval); err != nil {
+		return nil, nil, err
+	}
+	if tooFast {
+		return nil, nil, oauthError("slow_down", fmt.Sprintf("poll at most every %d seconds", interval))
+	}
+
+	switch authorization.Status {
+	case models.DeviceAuthorizationPending:
+		return nil, nil, oauthError("authorization_pending", "the user has not approved the device yet")
+	case models.DeviceAuthorizationDenied:
+		return nil, nil, oauthError("access_denied", "the user denied access")
+	}
+
+	claimed, err := s.Repo.ClaimDeviceAuthorization(authorization.ID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !claimed || authorization.UserID == nil {
+		return nil, nil, oauthError("invalid_grant", "the device code is invalid or already used")
+	}
+	user, err := s.Users.GetUserByID(*authorization.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil {
+		return nil, nil, oauthError("invalid_grant", "the user no longer exists")
+	}
+	if AccountStatusError(user) != nil {
+		return nil, nil, oauthError("access_denied", "the account may not log in")
+	}
+	tokens := &TokenResponse{TokenType: "Bearer", Scope: authorization.Scope}
+	if containsString(strings.Fields(authorization.Scope), OIDCScopeOpenID) {
+		if tokens.IDToken, err = s.issueIDToken(client, user, "", "", time.Time{}); err != nil {
+			return nil, nil, err
+		}
+	}
+	return user, tokens, nil
+}
+
+// newUserCode returns a random user code, without its separator
+func newUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// normalizeUserCode returns a user code as typed by the user in upper case,
+// without separators or spaces
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		if r < 'A' || r > 'Z' {
+			return -1
+		}
+		return r
+	}, code)
+}
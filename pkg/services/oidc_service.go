@@ -0,0 +1,610 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Scopes a client can ask for
+const (
+	OIDCScopeOpenID  = "openid"
+	OIDCScopeProfile = "profile"
+)
+
+// OIDCScopes lists the supported scopes, in the order they are displayed
+var OIDCScopes = []string{OIDCScopeOpenID, OIDCScopeProfile}
+
+// DeviceScopes lists the scopes a device can ask for: those of OIDCScopes,
+// and those of personal access tokens its session is limited to
+var DeviceScopes = append(append([]string{}, OIDCScopes...), models.AccessTokenScopes...)
+
+// oidcSigningAlgorithm signs ID tokens and access tokens
+const oidcSigningAlgorithm = "RS256"
+
+// Errors returned for authorization requests that must not be redirected
+// back to the client, because the client or redirect URI cannot be trusted
+var (
+	ErrOAuthUnknownClient = errors.New("unknown client")
+	ErrOAuthRedirectURI   = errors.New("redirect URI is not registered for this client")
+)
+
+// OAuthError is an error defined by RFC 6749, returned to the client with
+// its code and description
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// Error returns the code and description of the error
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// oauthError returns a new OAuthError
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// AuthorizationRequest holds the parameters of a request to the
+// authorization endpoint
+type AuthorizationRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	Nonce               string `form:"nonce"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+// TokenRequest holds the parameters of a request to the token endpoint
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	CodeVerifier string `form:"code_verifier"`
+	// DeviceCode is sent by devices polling for their token
+	DeviceCode string `form:"device_code"`
+}
+
+// TokenResponse is the successful response of the token endpoint
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token,omitempty"`
+	Scope       string `json:"scope"`
+}
+
+// OIDCServiceInterface defines the interface for the OIDCService
+type OIDCServiceInterface interface {
+	RegisterClient(name string, redirectURIs []string, public bool, createdByID uint) (string, *models.OAuthClient, error)
+	ListClients() ([]models.OAuthClient, error)
+	ValidateAuthorizationRequest(request *AuthorizationRequest) (*models.OAuthClient, error)
+	NeedsConsent(userID uint, request *AuthorizationRequest) (bool, error)
+	ConsentToken(userID uint, request *AuthorizationRequest) string
+	GrantConsent(userID uint, request *AuthorizationRequest, consentToken string) error
+	CreateAuthorizationCode(userID uint, authTime time.Time, request *AuthorizationRequest) (string, error)
+	Exchange(request *TokenRequest) (*TokenResponse, error)
+	AuthorizeDevice(request *DeviceAuthorizationRequest) (*DeviceAuthorizationResponse, error)
+	PendingDeviceAuthorization(userID uint, userCode string) (*models.OAuthDeviceAuthorization, *models.OAuthClient, error)
+	DeviceConsentToken(userID uint, userCode string) string
+	DecideDeviceAuthorization(userID uint, userCode string, allow bool, consentToken string) (*models.OAuthDeviceAuthorization, error)
+	PollDeviceAuthorization(request *TokenRequest) (*models.User, *TokenResponse, error)
+	UserInfo(accessToken string) (map[string]interface{}, error)
+	Discovery() map[string]interface{}
+	JWKS() map[string]interface{}
+}
+
+// OIDCService makes this service an OpenID Connect provider for other apps.
+//
+// It implements the authorization code flow with PKCE (RFC 7636), and the
+// device authorization grant (RFC 8628) for devices without a browser. ID
+// tokens and access tokens are JWTs signed with RS256 by SigningKey, whose
+// public half is published in the JWKS.
+type OIDCService struct {
+	Repo  repository.OAuthRepository
+	Users UserServiceInterface
+	// Issuer is the public base URL of this service, without trailing slash
+	Issuer        string
+	SigningKey    *rsa.PrivateKey
+	CodeLifetime  time.Duration
+	TokenLifetime time.Duration
+	// DeviceCodeLifetime is how long a device has to get its user to
+	// approve it
+	DeviceCodeLifetime time.Duration
+	// DevicePollInterval is how long devices wait between two polls of the
+	// token endpoint, at first
+	DevicePollInterval time.Duration
+	// Limiter meters the user codes each user enters with UserCodeLimit, so
+	// the codes of other users cannot be guessed; nil disables the limit
+	Limiter       repository.RateLimitRepository
+	UserCodeLimit models.RateLimitPolicy
+	Now           func() time.Time
+}
+
+// NewOIDCService creates a new OIDCService with 1 minute codes, 1 hour
+// tokens and 10 minute device codes polled every 5 seconds. Users may enter
+// 10 user codes an hour once a Limiter is set.
+func NewOIDCService(repo repository.OAuthRepository, users UserServiceInterface, issuer string, signingKey *rsa.PrivateKey) *OIDCService {
+	return &OIDCService{
+		Repo:               repo,
+		Users:              users,
+		Issuer:             strings.TrimRight(issuer, "/"),
+		SigningKey:         signingKey,
+		CodeLifetime:       time.Minute,
+		TokenLifetime:      time.Hour,
+		DeviceCodeLifetime: 10 * time.Minute,
+		DevicePollInterval: 5 * time.Second,
+		UserCodeLimit: models.RateLimitPolicy{
+			Method: "CODE",
+			Route:  "device",
+			Limit:  10,
+			Period: time.Hour,
+			KeyBy:  models.RateLimitByUser,
+		},
+		Now: time.Now,
+	}
+}
+
+// RegisterClient registers an application.
+//
+// Redirect URIs must be absolute and without fragment. It returns the
+// client secret, which cannot be retrieved again, or an empty string for
+// public clients.
+func (s *OIDCService) RegisterClient(name string, redirectURIs []string, public bool, createdByID uint) (string, *models.OAuthClient, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, errors.New("client name is required")
+	}
+	if len(redirectURIs) == 0 {
+		return "", nil, errors.New("at least one redirect URI is required")
+	}
+	for _, uri := range redirectURIs {
+		parsed, err := url.Parse(uri)
+		if err != nil || !parsed.IsAbs() || parsed.Host == "" || parsed.Fragment != "" {
+			return "", nil, fmt.Errorf("invalid redirect URI %q", uri)
+		}
+	}
+
+	clientID, err := randomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+	client := &models.OAuthClient{
+		ClientID:     clientID,
+		Name:         name,
+		RedirectURIs: strings.Join(redirectURIs, " "),
+		Public:       public,
+		CreatedByID:  createdByID,
+	}
+
+	secret := ""
+	if !public {
+		if secret, err = randomToken(32); err != nil {
+			return "", nil, err
+		}
+		client.SecretHash = sha256Hex(secret)
+	}
+
+	if err := s.Repo.CreateClient(client); err != nil {
+		return "", nil, err
+	}
+	return secret, client, nil
+}
+
+// ListClients uses the repository to fetch all clients
+func (s *OIDCService) ListClients() ([]models.OAuthClient, error) {
+	return s.Repo.ListClients()
+}
+
+// ValidateAuthorizationRequest checks a request to the authorization
+// endpoint and returns its client.
+//
+// It returns ErrOAuthUnknownClient or ErrOAuthRedirectURI when the error
+// must be shown to the user, and an *OAuthError when it can be sent back to
+// the client. Unknown scopes are dropped from the request; the openid scope
+// and an S256 PKCE challenge are required.
+func (s *OIDCService) ValidateAuthorizationRequest(request *AuthorizationRequest) (*models.OAuthClient, error) {
+	client, err := s.Repo.GetClientByClientID(request.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, ErrOAuthUnknownClient
+	}
+	if !client.AllowsRedirectURI(request.RedirectURI) {
+		return nil, ErrOAuthRedirectURI
+	}
+
+	if request.ResponseType != "code" {
+		return client, oauthError("unsupported_response_type", "only the code response type is supported")
+	}
+
+	request.Scope = supportedScopes(request.Scope, OIDCScopes)
+	if !containsString(strings.Fields(request.Scope), OIDCScopeOpenID) {
+		return client, oauthError("invalid_scope", "the openid scope is required")
+	}
+
+	if request.CodeChallenge == "" {
+		return client, oauthError("invalid_request", "a PKCE code_challenge is required")
+	}
+	if request.CodeChallengeMethod != "S256" {
+		return client, oauthError("invalid_request", "code_challenge_method must be S256")
+	}
+	return client, nil
+}
+
+// NeedsConsent reports whether the user has to be asked before the client
+// gets the requested scopes
+func (s *OIDCService) NeedsConsent(userID uint, request *AuthorizationRequest) (bool, error) {
+	consent, err := s.Repo.GetConsent(userID, request.ClientID)
+	if err != nil {
+		return false, err
+	}
+	if consent == nil {
+		return true, nil
+	}
+	granted := strings.Fields(consent.Scope)
+	for _, scope := range strings.Fields(request.Scope) {
+		if !containsString(granted, scope) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ConsentToken returns the token the consent form must post back, binding
+// the decision to the user and to the exact request shown to them. It
+// prevents other sites from submitting the form on the user's behalf.
+func (s *OIDCService) ConsentToken(userID uint, request *AuthorizationRequest) string {
+	mac := hmac.New(sha256.New, s.consentKey())
+	for _, field := range []string{
+		strconv.FormatUint(uint64(userID), 10), request.ClientID, request.RedirectURI,
+		request.Scope, request.Nonce, request.CodeChallenge,
+	} {
+		fmt.Fprintf(mac, "%d:%s;", len(field), field)
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// consentKey derives the key of the consent tokens from the signing key, so
+// every instance sharing the signing key accepts them
+func (s *OIDCService) consentKey() []byte {
+	sum := sha256.Sum256(append([]byte("oidc-consent:"), x509.MarshalPKCS1PrivateKey(s.SigningKey)...))
+	return sum[:]
+}
+
+// GrantConsent records that the user allowed the client the requested
+// scopes, after checking the consent token of the form
+func (s *OIDCService) GrantConsent(userID uint, request *AuthorizationRequest, consentToken string) error {
+	if !hmac.Equal([]byte(consentToken), []byte(s.ConsentToken(userID, request))) {
+		return oauthError("access_denied", "the consent form has expired, please try again")
+	}
+
+	scopes := strings.Fields(request.Scope)
+	consent, err := s.Repo.GetConsent(userID, request.ClientID)
+	if err != nil {
+		return err
+	}
+	if consent != nil {
+		for _, scope := range strings.Fields(consent.Scope) {
+			if !containsString(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	return s.Repo.SaveConsent(&models.OAuthConsent{
+		UserID:   userID,
+		ClientID: request.ClientID,
+		Scope:    strings.Join(scopes, " "),
+	})
+}
+
+// CreateAuthorizationCode issues the single-use code the client exchanges
+// for tokens. The request must have been validated.
+func (s *OIDCService) CreateAuthorizationCode(userID uint, authTime time.Time, request *AuthorizationRequest) (string, error) {
+	code, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := s.Now()
+	err = s.Repo.CreateAuthorizationCode(&models.OAuthAuthorizationCode{
+		CodeHash:            sha256Hex(code),
+		ClientID:            request.ClientID,
+		UserID:              userID,
+		RedirectURI:         request.RedirectURI,
+		Scope:               request.Scope,
+		Nonce:               request.Nonce,
+		CodeChallenge:       request.CodeChallenge,
+		CodeChallengeMethod: request.CodeChallengeMethod,
+		AuthTime:            authTime,
+		ExpiresAt:           now.Add(s.CodeLifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Exchange handles a request to the token endpoint.
+//
+// It authenticates the client (with its secret unless it is public),
+// consumes the authorization code and checks the redirect URI, the PKCE
+// verifier and that the account of the user can still be used. It returns an ID token carrying the username and an access token
+// for the userinfo endpoint. Failures are *OAuthError values.
+func (s *OIDCService) Exchange(request *TokenRequest) (*TokenResponse, error) {
+	if request.GrantType != "authorization_code" {
+		return nil, oauthError("unsupported_grant_type", "only the authorization_code grant is supported")
+	}
+
+	client, err := s.authenticateClient(request.ClientID, request.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.Now()
+	code, err := s.Repo.ConsumeAuthorizationCode(sha256Hex(request.Code), now)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case code == nil, code.ClientID != client.ClientID, !now.Before(code.ExpiresAt):
+		return nil, oauthError("invalid_grant", "the authorization code is invalid, expired or already used")
+	case code.RedirectURI != request.RedirectURI:
+		return nil, oauthError("invalid_grant", "redirect_uri does not match the authorization request")
+	case !verifyCodeChallenge(code.CodeChallenge, request.CodeVerifier):
+		return nil, oauthError("invalid_grant", "the PKCE code_verifier does not match the code_challenge")
+	}
+
+	user, err := s.Users.GetUserByID(code.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, oauthError("invalid_grant", "the user no longer exists")
+	}
+	if AccountStatusError(user) != nil {
+		return nil, oauthError("invalid_grant", "the account may not log in")
+	}
+
+	return s.issueTokens(client, user, code.Scope, code.Nonce, code.AuthTime)
+}
+
+// issueTokens returns the access token of a user for a client, limited to
+// the scope. With the openid scope, it comes with an ID token carrying the
+// nonce and the time the user authenticated, if known.
+func (s *OIDCService) issueTokens(client *models.OAuthClient, user *models.User, scope, nonce string, authTime time.Time) (*TokenResponse, error) {
+	now := s.Now()
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := s.sign("at+jwt", jwt.MapClaims{
+		"iss":       s.Issuer,
+		"sub":       strconv.FormatUint(uint64(user.ID), 10),
+		"aud":       s.Issuer,
+		"client_id": client.ClientID,
+		"scope":     scope,
+		"iat":       now.Unix(),
+		"exp":       now.Add(s.TokenLifetime).Unix(),
+		"jti":       jti,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response := &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.TokenLifetime.Seconds()),
+		Scope:       scope,
+	}
+	if containsString(strings.Fields(scope), OIDCScopeOpenID) {
+		if response.IDToken, err = s.issueIDToken(client, user, accessToken, nonce, authTime); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// issueIDToken returns the ID token of a user for a client, with the hash
+// of the access token it comes with, if any, the nonce and the time the
+// user authenticated, if known
+func (s *OIDCService) issueIDToken(client *models.OAuthClient, user *models.User, accessToken, nonce string, authTime time.Time) (string, error) {
+	now := s.Now()
+	claims := jwt.MapClaims{
+		"iss":                s.Issuer,
+		"sub":                strconv.FormatUint(uint64(user.ID), 10),
+		"aud":                client.ClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(s.TokenLifetime).Unix(),
+		"preferred_username": user.Username,
+	}
+	if accessToken != "" {
+		claims["at_hash"] = leftHalfHash(accessToken)
+	}
+	if !authTime.IsZero() {
+		claims["auth_time"] = authTime.Unix()
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	return s.sign("JWT", claims)
+}
+
+// authenticateClient checks the credentials a client sent to the token
+// endpoint. Confidential clients must send their secret; public clients
+// must not have one.
+func (s *OIDCService) authenticateClient(clientID, secret string) (*models.OAuthClient, error) {
+	client, err := s.Repo.GetClientByClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, oauthError("invalid_client", "unknown client")
+	}
+	if client.Public {
+		if secret != "" {
+			return nil, oauthError("invalid_client", "public clients have no secret")
+		}
+		return client, nil
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(sha256Hex(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, oauthError("invalid_client", "client authentication failed")
+	}
+	return client, nil
+}
+
+// UserInfo returns the claims of the user an access token was issued for.
+//
+// The preferred_username claim is only returned with the profile scope.
+// Invalid tokens, and tokens of accounts that can no longer be used, are
+// reported as an *OAuthError.
+func (s *OIDCService) UserInfo(accessToken string) (map[string]interface{}, error) {
+	// The expiry is checked against the service clock below
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	parsed, err := parser.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != oidcSigningAlgorithm || token.Header["typ"] != "at+jwt" {
+			return nil, errors.New("not an access token")
+		}
+		return &s.SigningKey.PublicKey, nil
+	})
+	if err != nil || !parsed.Valid {
+		return nil, oauthError("invalid_token", "the access token is invalid or expired")
+	}
+	claims := parsed.Claims.(jwt.MapClaims)
+	if !claims.VerifyExpiresAt(s.Now().Unix(), true) {
+		return nil, oauthError("invalid_token", "the access token is invalid or expired")
+	}
+	if !claims.VerifyIssuer(s.Issuer, true) || !claims.VerifyAudience(s.Issuer, true) {
+		return nil, oauthError("invalid_token", "the access token was not issued for this service")
+	}
+
+	subject, _ := claims["sub"].(string)
+	id, err := strconv.ParseUint(subject, 10, 64)
+	if err != nil {
+		return nil, oauthError("invalid_token", "the access token has no subject")
+	}
+	user, err := s.Users.GetUserByID(uint(id))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, oauthError("invalid_token", "the user no longer exists")
+	}
+	if AccountStatusError(user) != nil {
+		return nil, oauthError("invalid_token", "the account may not log in")
+	}
+
+	info := map[string]interface{}{"sub": subject}
+	scope, _ := claims["scope"].(string)
+	if containsString(strings.Fields(scope), OIDCScopeProfile) {
+		info["preferred_username"] = user.Username
+	}
+	return info, nil
+}
+
+// Discovery returns the OpenID Provider Metadata served at
+// /.well-known/openid-configuration
+func (s *OIDCService) Discovery() map[string]interface{} {
+	return map[string]interface{}{
+		"issuer":                                s.Issuer,
+		"authorization_endpoint":                s.Issuer + "/oauth2/authorize",
+		"token_endpoint":                        s.Issuer + "/oauth2/token",
+		"userinfo_endpoint":                     s.Issuer + "/oauth2/userinfo",
+		"jwks_uri":                              s.Issuer + "/oauth2/jwks",
+		"response_types_supported":              []string{"code"},
+		"device_authorization_endpoint":         s.Issuer + "/oauth2/device_authorization",
+		"grant_types_supported":                 []string{"authorization_code", DeviceCodeGrantType},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{oidcSigningAlgorithm},
+		"scopes_supported":                      OIDCScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "at_hash", "preferred_username"},
+	}
+}
+
+// JWKS returns the JSON Web Key Set holding the public signing key
+func (s *OIDCService) JWKS() map[string]interface{} {
+	return map[string]interface{}{
+		"keys": []utils.JWK{utils.RSAPublicJWK(&s.SigningKey.PublicKey, oidcSigningAlgorithm)},
+	}
+}
+
+// sign signs claims with the signing key, identified by its key ID
+func (s *OIDCService) sign(typ string, claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["typ"] = typ
+	token.Header["kid"] = utils.JWKThumbprint(&s.SigningKey.PublicKey)
+	return token.SignedString(s.SigningKey)
+}
+
+// supportedScopes returns the scopes of a space-separated list found in
+// supported, without duplicates
+func supportedScopes(scope string, supported []string) string {
+	var scopes []string
+	for _, scope := range strings.Fields(scope) {
+		if containsString(supported, scope) && !containsString(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return strings.Join(scopes, " ")
+}
+
+// verifyCodeChallenge checks a PKCE verifier against its S256 challenge
+func verifyCodeChallenge(challenge, verifier string) bool {
+	// RFC 7636 verifiers are 43 to 128 characters long
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// leftHalfHash returns the at_hash of an access token: the base64url
+// encoded left half of its SHA-256 hash
+func leftHalfHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// randomToken returns n random bytes, base64url encoded
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// sha256Hex returns the hex encoded SHA-256 hash of a value
+func sha256Hex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,355 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/internal/tenant"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// OrganizationServiceInterface defines the interface for the OrganizationService
+type OrganizationServiceInterface interface {
+	CreateOrganization(owner *models.User, name, slug string) (*models.Membership, error)
+	ListMemberships(userID uint) ([]models.Membership, error)
+	ResolveTenant(userID, organizationID uint, fallback bool) (*models.Membership, error)
+	SwitchOrganization(userID, organizationID uint) (*models.User, *models.Membership, error)
+	ListMembers(ctx context.Context) ([]models.Membership, error)
+	AddMember(ctx context.Context, actor *models.Membership, username, role string) (*models.Membership, error)
+	SetMemberRole(ctx context.Context, actor *models.Membership, userID uint, role string) (*models.Membership, string, error)
+	RemoveMember(ctx context.Context, actor *models.Membership, userID uint) (*models.Membership, error)
+}
+
+// Errors returned by the OrganizationService
+var (
+	ErrNotMember               = errors.New("you are not a member of this organization")
+	ErrNoOrganization          = errors.New("you are not a member of any organization")
+	ErrOrganizationExists      = errors.New("an organization with this slug already exists")
+	ErrInvalidOrganizationName = errors.New("organization name is required")
+	ErrInvalidOrganizationSlug = errors.New("slug must be 2 to 40 lowercase letters, digits or dashes")
+	ErrInvalidOrganizationRole = errors.New("unknown organization role")
+	ErrAlreadyMember           = errors.New("user is already a member of this organization")
+	ErrOwnerRequired           = errors.New("only owners can grant or revoke the owner role")
+	ErrLastOwner               = errors.New("an organization needs at least one owner")
+)
+
+// organizationSlugPattern matches valid slugs
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,38}[a-z0-9]$`)
+
+// OrganizationService manages organizations, their members and the
+// organization, or tenant, each request acts in
+type OrganizationService struct {
+	Repo  repository.OrganizationRepository
+	Users repository.UserRepository
+	// DefaultOrganization is the slug of the organization joined by users
+	// who belong to none, such as newly registered ones. It is created
+	// when first needed. Empty leaves them without organization.
+	DefaultOrganization string
+}
+
+// NewOrganizationService creates a new OrganizationService
+func NewOrganizationService(repo repository.OrganizationRepository, users repository.UserRepository, defaultOrganization string) *OrganizationService {
+	return &OrganizationService{Repo: repo, Users: users, DefaultOrganization: defaultOrganization}
+}
+
+// CreateOrganization creates an organization owned by a user.
+//
+// The slug is derived from the name when empty. It returns the membership
+// of the owner, with the organization, or ErrOrganizationExists if the slug
+// is taken.
+func (s *OrganizationService) CreateOrganization(owner *models.User, name, slug string) (*models.Membership, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrInvalidOrganizationName
+	}
+	if slug = strings.TrimSpace(slug); slug == "" {
+		slug = slugify(name)
+	}
+	if !organizationSlugPattern.MatchString(slug) {
+		return nil, ErrInvalidOrganizationSlug
+	}
+
+	organization := &models.Organization{Name: name, Slug: slug}
+	membership := &models.Membership{UserID: owner.ID, Role: models.OrgRoleOwner}
+	if err := s.Repo.CreateOrganization(organization, membership); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrOrganizationExists
+		}
+		return nil, err
+	}
+	membership.Organization = *organization
+	return membership, nil
+}
+
+// ListMemberships returns the organizations of a user, with their role in
+// each
+func (s *OrganizationService) ListMemberships(userID uint) ([]models.Membership, error) {
+	return s.Repo.ListMemberships(userID)
+}
+
+// ResolveTenant returns the membership a request of a user acts in.
+//
+// A non-zero organizationID, taken from the session or the access token,
+// must be an organization the user is an active member of; otherwise
+// ErrNotMember is returned, unless fallback is set. Without one, or as a
+// fallback, the organization the user last switched to is used, then their
+// first organization, then the default organization, which they join.
+// ErrNoOrganization is returned when there is none. The organization used
+// is remembered for the next session of the user.
+func (s *OrganizationService) ResolveTenant(userID, organizationID uint, fallback bool) (*models.Membership, error) {
+	if organizationID != 0 {
+		membership, err := s.Repo.GetMembership(tenant.WithOrganization(context.Background(), organizationID), userID)
+		if err != nil {
+			return nil, err
+		}
+		if membership != nil && membership.Active() {
+			return membership, nil
+		}
+		if !fallback {
+			return nil, ErrNotMember
+		}
+	}
+
+	user, err := s.Users.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrNoOrganization
+	}
+
+	memberships, err := s.Repo.ListMemberships(userID)
+	if err != nil {
+		return nil, err
+	}
+	var resolved *models.Membership
+	for i := range memberships {
+		if !memberships[i].Active() {
+			continue
+		}
+		if resolved == nil || (user.ActiveOrganizationID != nil && memberships[i].OrganizationID == *user.ActiveOrganizationID) {
+			resolved = &memberships[i]
+		}
+	}
+	// A user who is only a deactivated member is not moved to the default
+	// organization
+	if resolved == nil && len(memberships) == 0 {
+		if resolved, err = s.joinDefaultOrganization(userID); err != nil {
+			return nil, err
+		}
+	}
+	if resolved == nil {
+		return nil, ErrNoOrganization
+	}
+
+	if user.ActiveOrganizationID == nil || *user.ActiveOrganizationID != resolved.OrganizationID {
+		user.ActiveOrganizationID = &resolved.OrganizationID
+		if err := s.Users.UpdateUser(user); err != nil {
+			log.Printf("Failed to save the active organization of user %d: %v", userID, err)
+		}
+	}
+	return resolved, nil
+}
+
+// SwitchOrganization makes an organization the active one of a user. It
+// returns the user, to issue a new session, and their membership, or
+// ErrNotMember if they are not an active member.
+func (s *OrganizationService) SwitchOrganization(userID, organizationID uint) (*models.User, *models.Membership, error) {
+	membership, err := s.Repo.GetMembership(tenant.WithOrganization(context.Background(), organizationID), userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if membership == nil || !membership.Active() {
+		return nil, nil, ErrNotMember
+	}
+
+	user := membership.User
+	user.ActiveOrganizationID = &membership.OrganizationID
+	if err := s.Users.UpdateUser(&user); err != nil {
+		return nil, nil, err
+	}
+	return &user, membership, nil
+}
+
+// ListMembers returns the members of the organization of the context
+func (s *OrganizationService) ListMembers(ctx context.Context) ([]models.Membership, error) {
+	return s.Repo.ListMembers(ctx)
+}
+
+// AddMember adds an existing user to the organization of the context. An
+// empty role means models.OrgRoleMember, and only owners can add owners.
+func (s *OrganizationService) AddMember(ctx context.Context, actor *models.Membership, username, role string) (*models.Membership, error) {
+	if role == "" {
+		role = models.OrgRoleMember
+	}
+	if err := checkOrganizationRole(actor, role); err != nil {
+		return nil, err
+	}
+
+	user, err := s.Users.GetUserByUsername(CanonicalUsername(username))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	membership := &models.Membership{UserID: user.ID, Role: role}
+	if err := s.Repo.AddMember(ctx, membership); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrAlreadyMember
+		}
+		return nil, err
+	}
+	membership.User = *user
+	return membership, nil
+}
+
+// SetMemberRole changes the role of a member of the organization of the
+// context.
+//
+// Only owners can grant or revoke the owner role, and the last owner
+// cannot be demoted. It returns the membership with its previous role, so
+// the change can be audited, or ErrNotMember.
+func (s *OrganizationService) SetMemberRole(ctx context.Context, actor *models.Membership, userID uint, role string) (*models.Membership, string, error) {
+	membership, err := s.Repo.GetMembership(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if membership == nil {
+		return nil, "", ErrNotMember
+	}
+	if err := checkOrganizationRole(actor, role); err != nil {
+		return nil, "", err
+	}
+	if err := checkOrganizationRole(actor, membership.Role); err != nil {
+		return nil, "", err
+	}
+
+	previousRole := membership.Role
+	if previousRole == models.OrgRoleOwner && role != models.OrgRoleOwner {
+		if err := s.checkOtherOwner(ctx, userID); err != nil {
+			return nil, "", err
+		}
+	}
+	membership.Role = role
+	if err := s.Repo.UpdateMember(ctx, membership); err != nil {
+		return nil, "", err
+	}
+	return membership, previousRole, nil
+}
+
+// RemoveMember removes a member from the organization of the context and
+// its groups.
+//
+// Only owners can remove owners, and the last owner cannot be removed. It
+// returns the removed membership, or ErrNotMember.
+func (s *OrganizationService) RemoveMember(ctx context.Context, actor *models.Membership, userID uint) (*models.Membership, error) {
+	membership, err := s.Repo.GetMembership(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if membership == nil {
+		return nil, ErrNotMember
+	}
+	if err := checkOrganizationRole(actor, membership.Role); err != nil {
+		return nil, err
+	}
+	if membership.Role == models.OrgRoleOwner {
+		if err := s.checkOtherOwner(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.Repo.RemoveMember(ctx, userID); err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+// joinDefaultOrganization adds a user to the default organization,
+// creating it if needed. It returns nil if there is no default
+// organization.
+func (s *OrganizationService) joinDefaultOrganization(userID uint) (*models.Membership, error) {
+	if s.DefaultOrganization == "" {
+		return nil, nil
+	}
+	organization, err := s.Repo.GetOrganizationBySlug(s.DefaultOrganization)
+	if err != nil {
+		return nil, err
+	}
+	if organization == nil {
+		organization = &models.Organization{Name: s.DefaultOrganization, Slug: s.DefaultOrganization}
+		if err := s.Repo.CreateOrganization(organization, nil); err != nil {
+			if !errors.Is(err, gorm.ErrDuplicatedKey) {
+				return nil, err
+			}
+			// Created by a concurrent request
+			if organization, err = s.Repo.GetOrganizationBySlug(s.DefaultOrganization); err != nil || organization == nil {
+				return nil, err
+			}
+		}
+	}
+
+	ctx := tenant.WithOrganization(context.Background(), organization.ID)
+	membership := &models.Membership{UserID: userID, Role: models.OrgRoleMember}
+	if err := s.Repo.AddMember(ctx, membership); err != nil {
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, err
+		}
+		return s.Repo.GetMembership(ctx, userID)
+	}
+	membership.Organization = *organization
+	return membership, nil
+}
+
+// checkOtherOwner returns ErrLastOwner if the user is the only owner of the
+// organization of the context
+func (s *OrganizationService) checkOtherOwner(ctx context.Context, userID uint) error {
+	members, err := s.Repo.ListMembers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.Role == models.OrgRoleOwner && member.UserID != userID {
+			return nil
+		}
+	}
+	return ErrLastOwner
+}
+
+// checkOrganizationRole checks that a role exists and that the actor may
+// grant or revoke it
+func checkOrganizationRole(actor *models.Membership, role string) error {
+	if !containsString(models.OrganizationRoles, role) {
+		return ErrInvalidOrganizationRole
+	}
+	if role == models.OrgRoleOwner && (actor == nil || actor.Role != models.OrgRoleOwner) {
+		return ErrOwnerRequired
+	}
+	return nil
+}
+
+// slugify derives a slug from an organization name
+func slugify(name string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			slug.WriteRune(r)
+			dash = false
+		} else if !dash && slug.Len() > 0 {
+			slug.WriteByte('-')
+			dash = true
+		}
+	}
+	result := strings.TrimRight(slug.String(), "-")
+	if len(result) > 40 {
+		result = strings.TrimRight(result[:40], "-")
+	}
+	return result
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// pasetoClaims is the payload of a session PASETO token: the registered
+// claims, with times as RFC 3339 strings, then the others of the session
+type pasetoClaims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	ExpiresAt string `json:"exp,omitempty"`
+	NotBefore string `json:"nbf,omitempty"`
+	IssuedAt  string `json:"iat,omitempty"`
+	ID        string `json:"jti,omitempty"`
+	*models.Claims
+}
+
+// pasetoFooter is the footer of a session PASETO token
+type pasetoFooter struct {
+	KeyID string `json:"kid"`
+}
+
+// PASETOLocalFormat is the TokenFormat of PASETO v4.local tokens, encrypted
+// and authenticated with a symmetric key, so their claims cannot be read
+// without it. The key is named by the "kid" of the footer.
+type PASETOLocalFormat struct {
+	keys []tokenKey
+}
+
+// NewPASETOLocalFormat creates a new PASETOLocalFormat encrypting with keys
+// derived from the secrets, newest first
+func NewPASETOLocalFormat(secrets ...[]byte) *PASETOLocalFormat {
+	format := &PASETOLocalFormat{}
+	for _, secret := range secrets {
+		key := deriveTokenKey(TokenFormatPASETOLocal, secret)
+		format.keys = append(format.keys, tokenKey{ID: tokenKeyID(key), Key: key})
+	}
+	return format
+}
+
+// Name returns TokenFormatPASETOLocal
+func (f *PASETOLocalFormat) Name() string {
+	return TokenFormatPASETOLocal
+}
+
+// Detect reports whether the token has the v4.local header
+func (f *PASETOLocalFormat) Detect(token string) bool {
+	return strings.HasPrefix(token, utils.PASETOv4Local)
+}
+
+// Seal encrypts the claims with the newest key
+func (f *PASETOLocalFormat) Seal(claims *models.Claims) (string, error) {
+	message, footer, err := encodePASETOClaims(claims, f.keys[0].ID)
+	if err != nil {
+		return "", err
+	}
+	return utils.PASETOv4Encrypt(f.keys[0].Key, message, footer, nil)
+}
+
+// Open decrypts a token with the key it names and returns its claims
+func (f *PASETOLocalFormat) Open(token string) (*models.Claims, error) {
+	key, err := pasetoKey(f.keys, token)
+	if err != nil {
+		return nil, err
+	}
+	message, _, err := utils.PASETOv4Decrypt(key.Key, token, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return decodePASETOClaims(message)
+}
+
+// PASETOPublicFormat is the TokenFormat of PASETO v4.public tokens, signed
+// with Ed25519, so other services can check them with the public key
+// alone. The key is named by the "kid" of the footer.
+type PASETOPublicFormat struct {
+	keys []tokenKey
+}
+
+// NewPASETOPublicFormat creates a new PASETOPublicFormat signing with
+// Ed25519 keys derived from the secrets, newest first
+func NewPASETOPublicFormat(secrets ...[]byte) *PASETOPublicFormat {
+	format := &PASETOPublicFormat{}
+	for _, secret := range secrets {
+		key := ed25519.NewKeyFromSeed(deriveTokenKey(TokenFormatPASETOPublic, secret))
+		format.keys = append(format.keys, tokenKey{ID: tokenKeyID(key.Public().(ed25519.PublicKey)), Key: key})
+	}
+	return format
+}
+
+// Name returns TokenFormatPASETOPublic
+func (f *PASETOPublicFormat) Name() string {
+	return TokenFormatPASETOPublic
+}
+
+// Detect reports whether the token has the v4.public header
+func (f *PASETOPublicFormat) Detect(token string) bool {
+	return strings.HasPrefix(token, utils.PASETOv4Public)
+}
+
+// PublicKeys returns the public keys checking the tokens, by key ID
+func (f *PASETOPublicFormat) PublicKeys() map[string]ed25519.PublicKey {
+	keys := make(map[string]ed25519.PublicKey, len(f.keys))
+	for _, key := range f.keys {
+		keys[key.ID] = ed25519.PrivateKey(key.Key).Public().(ed25519.PublicKey)
+	}
+	return keys
+}
+
+// Seal signs the claims with the newest key
+func (f *PASETOPublicFormat) Seal(claims *models.Claims) (string, error) {
+	message, footer, err := encodePASETOClaims(claims, f.keys[0].ID)
+	if err != nil {
+		return "", err
+	}
+	return utils.PASETOv4Sign(f.keys[0].Key, message, footer, nil), nil
+}
+
+// Open checks the signature of a token with the key it names and returns
+// its claims
+func (f *PASETOPublicFormat) Open(token string) (*models.Claims, error) {
+	key, err := pasetoKey(f.keys, token)
+	if err != nil {
+		return nil, err
+	}
+	publicKey := ed25519.PrivateKey(key.Key).Public().(ed25519.PublicKey)
+	message, _, err := utils.PASETOv4Verify(publicKey, token, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return decodePASETOClaims(message)
+}
+
+// pasetoKey returns the key named by the footer of a token
+func pasetoKey(keys []tokenKey, token string) (*tokenKey, error) {
+	encoded, err := utils.PASETOFooter(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	var footer pasetoFooter
+	if err := json.Unmarshal(encoded, &footer); err != nil {
+		return nil, fmt.Errorf("%w: invalid footer", ErrInvalidToken)
+	}
+	for i := range keys {
+		if keys[i].ID == footer.KeyID {
+			return &keys[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, footer.KeyID)
+}
+
+// encodePASETOClaims returns the message and the footer of a token for the
+// claims, sealed with the key with the ID
+func encodePASETOClaims(claims *models.Claims, keyID string) ([]byte, []byte, error) {
+	payload := pasetoClaims{
+		Issuer:    claims.Issuer,
+		Subject:   claims.Subject,
+		ID:        claims.ID,
+		ExpiresAt: pasetoTime(claims.ExpiresAt),
+		NotBefore: pasetoTime(claims.NotBefore),
+		IssuedAt:  pasetoTime(claims.IssuedAt),
+		Claims:    claims,
+	}
+	if len(claims.Audience) > 0 {
+		payload.Audience = claims.Audience[0]
+	}
+	message, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	footer, err := json.Marshal(pasetoFooter{KeyID: keyID})
+	if err != nil {
+		return nil, nil, err
+	}
+	return message, footer, nil
+}
+
+// decodePASETOClaims returns the claims of the message of a token
+func decodePASETOClaims(message []byte) (*models.Claims, error) {
+	payload := pasetoClaims{Claims: &models.Claims{}}
+	if err := json.Unmarshal(message, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	claims := payload.Claims
+	claims.Issuer = payload.Issuer
+	claims.Subject = payload.Subject
+	claims.ID = payload.ID
+	if payload.Audience != "" {
+		claims.Audience = []string{payload.Audience}
+	}
+	for _, field := range []struct {
+		value string
+		time  *time.Time
+	}{
+		{payload.ExpiresAt, &claims.ExpiresAt},
+		{payload.NotBefore, &claims.NotBefore},
+		{payload.IssuedAt, &claims.IssuedAt},
+	} {
+		if field.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, field.value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid time %q", ErrInvalidToken, field.value)
+		}
+		*field.time = parsed
+	}
+	return claims, nil
+}
+
+// pasetoTime returns the RFC 3339 string of a time, empty if zero
+func pasetoTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
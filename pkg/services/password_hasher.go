@@ -0,0 +1,242 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hashing algorithms
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// ErrUnknownHashFormat is returned when a stored hash cannot be parsed
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// b64 is the unpadded base64 encoding used by the PHC string format
+var b64 = base64.RawStdEncoding
+
+// PasswordHasher hashes passwords and verifies them against stored hashes
+type PasswordHasher interface {
+	// Hash returns the encoded hash of a password using the current parameters
+	Hash(password string) (string, error)
+
+	// Verify checks a password against an encoded hash.
+	//
+	// It returns whether the password matches and, if it does, whether the
+	// hash was made with outdated parameters and should be replaced with a
+	// fresh one from Hash.
+	Verify(encoded, password string) (ok bool, needsRehash bool, err error)
+}
+
+// PHCPasswordHasher implements PasswordHasher with hashes encoded in the PHC
+// string format, for example
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//	$bcrypt$r=12$<salt>$<hash>
+//
+// Hashes produced by bcrypt.GenerateFromPassword ($2a$...) are accepted
+// as well, and always reported as needing a rehash.
+//
+// When a pepper is configured, the password is first run through
+// HMAC-SHA256 keyed with it, and the hash records the pepper ID in its
+// keyid parameter so the pepper can be rotated later: hashes made with one
+// of the PreviousPeppers still verify, and are reported as needing a rehash.
+type PHCPasswordHasher struct {
+	Algorithm         string
+	BcryptCost        int
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	Pepper            []byte
+	PepperID          string
+	// PreviousPeppers are the retired peppers, by pepper ID
+	PreviousPeppers map[string][]byte
+}
+
+// DefaultPasswordHasher returns the hasher used when none is configured
+func DefaultPasswordHasher() *PHCPasswordHasher {
+	return &PHCPasswordHasher{
+		Algorithm:         AlgorithmArgon2id,
+		BcryptCost:        12,
+		Argon2Memory:      64 * 1024,
+		Argon2Iterations:  3,
+		Argon2Parallelism: 2,
+	}
+}
+
+// phcHash is a parsed PHC string
+type phcHash struct {
+	algorithm string
+	params    map[string]string
+	salt      string
+	hash      string
+}
+
+// Hash returns the PHC encoded hash of a password
+func (h *PHCPasswordHasher) Hash(password string) (string, error) {
+	input, keyID := pepperPassword(h.Pepper, password), h.keyID()
+
+	switch h.Algorithm {
+	case AlgorithmBcrypt:
+		hashed, err := bcrypt.GenerateFromPassword(input, h.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		// Split "$2a$12$<22 chars of salt><31 chars of hash>"
+		parts := strings.Split(string(hashed), "$")
+		if len(parts) != 4 || len(parts[3]) != 53 {
+			return "", ErrUnknownHashFormat
+		}
+		params := fmt.Sprintf("r=%d%s", h.BcryptCost, keyID)
+		return fmt.Sprintf("$bcrypt$%s$%s$%s", params, parts[3][:22], parts[3][22:]), nil
+
+	case AlgorithmArgon2id:
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey(input, salt, h.Argon2Iterations, h.Argon2Memory, h.Argon2Parallelism, 32)
+		params := fmt.Sprintf("m=%d,t=%d,p=%d%s", h.Argon2Memory, h.Argon2Iterations, h.Argon2Parallelism, keyID)
+		return fmt.Sprintf("$argon2id$v=%d$%s$%s$%s", argon2.Version, params, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	}
+
+	return "", fmt.Errorf("unsupported password hashing algorithm %q", h.Algorithm)
+}
+
+// Verify checks a password against a PHC or bcrypt encoded hash
+func (h *PHCPasswordHasher) Verify(encoded, password string) (bool, bool, error) {
+	// Legacy hashes straight from bcrypt.GenerateFromPassword
+	if strings.HasPrefix(encoded, "$2") {
+		if bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) != nil {
+			return false, false, nil
+		}
+		return true, true, nil
+	}
+
+	parsed, err := parsePHC(encoded)
+	if err != nil {
+		return false, false, err
+	}
+
+	// Apply the pepper the hash was made with, if any
+	input := []byte(password)
+	keyID, peppered := parsed.params["keyid"]
+	if peppered {
+		pepper := h.PreviousPeppers[keyID]
+		if keyID == h.PepperID && len(h.Pepper) > 0 {
+			pepper = h.Pepper
+		}
+		if len(pepper) == 0 {
+			return false, false, fmt.Errorf("password hash uses unknown pepper %q", keyID)
+		}
+		input = pepperPassword(pepper, password)
+	}
+	needsRehash := parsed.algorithm != h.Algorithm || (len(h.Pepper) > 0 && keyID != h.PepperID)
+
+	switch parsed.algorithm {
+	case AlgorithmBcrypt:
+		cost, err := strconv.Atoi(parsed.params["r"])
+		if err != nil {
+			return false, false, ErrUnknownHashFormat
+		}
+		native := fmt.Sprintf("$2a$%02d$%s%s", cost, parsed.salt, parsed.hash)
+		if bcrypt.CompareHashAndPassword([]byte(native), input) != nil {
+			return false, false, nil
+		}
+		return true, needsRehash || cost != h.BcryptCost, nil
+
+	case AlgorithmArgon2id:
+		memory, errM := strconv.ParseUint(parsed.params["m"], 10, 32)
+		iterations, errT := strconv.ParseUint(parsed.params["t"], 10, 32)
+		parallelism, errP := strconv.ParseUint(parsed.params["p"], 10, 8)
+		salt, errS := b64.DecodeString(parsed.salt)
+		expected, errH := b64.DecodeString(parsed.hash)
+		if err := errors.Join(errM, errT, errP, errS, errH); err != nil {
+			return false, false, ErrUnknownHashFormat
+		}
+
+		key := argon2.IDKey(input, salt, uint32(iterations), uint32(memory), uint8(parallelism), uint32(len(expected)))
+		if subtle.ConstantTimeCompare(key, expected) != 1 {
+			return false, false, nil
+		}
+		outdated := uint32(memory) != h.Argon2Memory ||
+			uint32(iterations) != h.Argon2Iterations ||
+			uint8(parallelism) != h.Argon2Parallelism ||
+			parsed.params["v"] != strconv.Itoa(argon2.Version)
+		return true, needsRehash || outdated, nil
+	}
+
+	return false, false, ErrUnknownHashFormat
+}
+
+// pepperPassword returns the input fed to the hashing algorithm for a
+// password with the pepper, if any
+func pepperPassword(pepper []byte, password string) []byte {
+	if len(pepper) == 0 {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(password))
+	return []byte(b64.EncodeToString(mac.Sum(nil)))
+}
+
+// keyID returns the keyid parameter appended to new hashes
+func (h *PHCPasswordHasher) keyID() string {
+	if len(h.Pepper) == 0 {
+		return ""
+	}
+	return ",keyid=" + h.PepperID
+}
+
+// parsePHC parses a "$alg[$v=version]$params$salt$hash" string
+func parsePHC(encoded string) (*phcHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) < 5 || parts[0] != "" {
+		return nil, ErrUnknownHashFormat
+	}
+
+	parsed := &phcHash{algorithm: parts[1], params: make(map[string]string)}
+	fields := parts[2 : len(parts)-2]
+	parsed.salt, parsed.hash = parts[len(parts)-2], parts[len(parts)-1]
+
+	for _, field := range fields {
+		for _, param := range strings.Split(field, ",") {
+			name, value, ok := strings.Cut(param, "=")
+			if !ok {
+				return nil, ErrUnknownHashFormat
+			}
+			parsed.params[name] = value
+		}
+	}
+	return parsed, nil
+}
+
+// ParsePreviousPeppers parses the retired peppers of a PHCPasswordHasher,
+// given as semicolon-separated "<pepper ID>:<pepper>" entries
+func ParsePreviousPeppers(spec string) (map[string][]byte, error) {
+	peppers := make(map[string][]byte)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, pepper, ok := strings.Cut(entry, ":")
+		if id = strings.TrimSpace(id); !ok || id == "" || pepper == "" {
+			return nil, fmt.Errorf("previous pepper %q: expected '<pepper ID>:<pepper>'", id)
+		}
+		peppers[id] = []byte(pepper)
+	}
+	return peppers, nil
+}
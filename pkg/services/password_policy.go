@@ -0,0 +1,166 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nbutton23/zxcvbn-go"
+)
+
+// Password policy rules, reported with every violation so clients can tell
+// them apart
+const (
+	RuleMinLength   = "min_length"
+	RuleMaxLength   = "max_length"
+	RuleUsername    = "username"
+	RuleContextWord = "context_word"
+	RuleStrength    = "strength"
+	RuleBreached    = "breached"
+)
+
+// maxPasswordLength is the longest password accepted, since bcrypt silently
+// ignores everything after the 72nd byte
+const maxPasswordLength = 72
+
+// strengthLabels describes the zxcvbn scores from 0 to 4
+var strengthLabels = []string{"very weak", "weak", "fair", "strong", "very strong"}
+
+// PolicyViolation describes a single rule a password failed to satisfy
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError is returned when a password breaks one or more rules
+// of the password policy
+type PasswordPolicyError struct {
+	Violations []PolicyViolation
+}
+
+// Error joins the messages of all violations
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Message
+	}
+	return "password does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+// PasswordPolicy holds the rules new passwords are checked against
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters
+	MinLength int
+	// MinStrength is the minimum zxcvbn score, from 0 (disabled) to 4
+	MinStrength int
+	// ContextWords are words specific to this service (company or product
+	// names, ...) that may not appear in a password
+	ContextWords []string
+	// Breaches is used to reject passwords seen in data breaches; nil
+	// disables the check
+	Breaches repository.BreachedPasswordRepository
+}
+
+// DefaultPasswordPolicy returns the policy used when none is configured
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{MinLength: 8, MinStrength: 2}
+}
+
+// Validate checks a password against every rule of the policy.
+//
+// It takes the username the password is chosen for, so it can be rejected
+// when it contains it, and returns a *PasswordPolicyError listing all the
+// violations, or nil if the password is acceptable. Passwords that are too
+// short or too long are rejected before the other rules are checked, so
+// long inputs never reach zxcvbn, whose cost grows faster than their length.
+func (p *PasswordPolicy) Validate(username, password string) error {
+	var violations []PolicyViolation
+	lowered := strings.ToLower(password)
+
+	if length := utf8.RuneCountInString(password); length < p.MinLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if len(password) > maxPasswordLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("Password must be at most %d bytes long", maxPasswordLength),
+		})
+	}
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	if username = strings.ToLower(strings.TrimSpace(username)); username != "" && strings.Contains(lowered, username) {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleUsername,
+			Message: "Password must not contain the username",
+		})
+	}
+
+	for _, word := range p.ContextWords {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" && strings.Contains(lowered, word) {
+			violations = append(violations, PolicyViolation{
+				Rule:    RuleContextWord,
+				Message: fmt.Sprintf("Password must not contain the word %q", word),
+			})
+		}
+	}
+
+	if minStrength := p.minStrength(); minStrength > 0 && password != "" {
+		userInputs := append([]string{username}, p.ContextWords...)
+		result := zxcvbn.PasswordStrength(password, userInputs)
+		if result.Score < minStrength {
+			violations = append(violations, PolicyViolation{
+				Rule: RuleStrength,
+				Message: fmt.Sprintf("Password is %s and could be guessed in %s; it must be at least %s",
+					strengthLabels[result.Score], result.CrackTimeDisplay, strengthLabels[minStrength]),
+			})
+		}
+	}
+
+	if p.Breaches != nil && password != "" {
+		count, err := p.breachCount(password)
+		switch {
+		case err != nil:
+			// Do not lock users out when the breach list is unavailable
+			log.Printf("Breached password lookup failed: %v", err)
+		case count > 0:
+			violations = append(violations, PolicyViolation{
+				Rule:    RuleBreached,
+				Message: fmt.Sprintf("Password has appeared %d times in known data breaches", count),
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// minStrength returns MinStrength clamped to the range of zxcvbn scores
+func (p *PasswordPolicy) minStrength() int {
+	if p.MinStrength >= len(strengthLabels) {
+		return len(strengthLabels) - 1
+	}
+	return p.MinStrength
+}
+
+// breachCount returns how many times a password appeared in data breaches
+func (p *PasswordPolicy) breachCount(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	hashes, err := p.Breaches.GetRange(hash[:5])
+	if err != nil {
+		return 0, err
+	}
+	return hashes[hash[5:]], nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitServiceInterface defines the interface for the RateLimitService
+type RateLimitServiceInterface interface {
+	PolicyFor(method, route string) *models.RateLimitPolicy
+	Take(policy models.RateLimitPolicy, subject string) (models.RateLimitResult, error)
+}
+
+// RateLimitService meters requests against the configured per-route policies
+type RateLimitService struct {
+	Repo     repository.RateLimitRepository
+	Policies []models.RateLimitPolicy
+	Now      func() time.Time
+}
+
+// NewRateLimitService creates a new RateLimitService
+func NewRateLimitService(repo repository.RateLimitRepository, policies []models.RateLimitPolicy) *RateLimitService {
+	return &RateLimitService{Repo: repo, Policies: policies, Now: time.Now}
+}
+
+// PolicyFor returns the policy that applies to the given method and route,
+// or nil if the route is not rate limited
+func (s *RateLimitService) PolicyFor(method, route string) *models.RateLimitPolicy {
+	for i := range s.Policies {
+		policy := &s.Policies[i]
+		if (policy.Method == "*" || policy.Method == method) && policy.Route == route {
+			return policy
+		}
+	}
+	return nil
+}
+
+// Take consumes a request for the given subject (IP address, user ID, or
+// empty for route-wide policies) from the bucket of the policy
+func (s *RateLimitService) Take(policy models.RateLimitPolicy, subject string) (models.RateLimitResult, error) {
+	key := fmt.Sprintf("%s %s|%s:%s", policy.Method, policy.Route, policy.KeyBy, subject)
+	return s.Repo.Take(key, policy, s.Now())
+}
+
+// ParseRateLimitPolicies parses the rate limit policies from their
+// configuration format.
+//
+// Policies are separated by semicolons, and each one is written as
+// "<METHOD> <route>=<limit>/<period>[:<key>]", for example
+// "POST /api/v1/user/login=5/1m:ip". The method may be "*" to match any
+// method, the period is a Go duration, and the key is one of "ip", "user"
+// or "route" (defaults to "ip"). The limit may be followed by "+<burst>" to
+// allow a burst different from the limit, as in "10+20/1m".
+func ParseRateLimitPolicies(spec string) ([]models.RateLimitPolicy, error) {
+	var policies []models.RateLimitPolicy
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		target, rule, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("rate limit policy %q: missing '='", entry)
+		}
+		method, route, ok := strings.Cut(strings.TrimSpace(target), " ")
+		if !ok {
+			return nil, fmt.Errorf("rate limit policy %q: expected '<METHOD> <route>'", entry)
+		}
+
+		policy := models.RateLimitPolicy{
+			Method: strings.ToUpper(method),
+			Route:  strings.TrimSpace(route),
+			KeyBy:  models.RateLimitByIP,
+		}
+
+		rule, keyBy, hasKey := strings.Cut(strings.TrimSpace(rule), ":")
+		if hasKey {
+			switch keyBy {
+			case models.RateLimitByIP, models.RateLimitByUser, models.RateLimitByRoute:
+				policy.KeyBy = keyBy
+			default:
+				return nil, fmt.Errorf("rate limit policy %q: unknown key %q", entry, keyBy)
+			}
+		}
+
+		rate, period, ok := strings.Cut(rule, "/")
+		if !ok {
+			return nil, fmt.Errorf("rate limit policy %q: expected '<limit>/<period>'", entry)
+		}
+		limit, burst, hasBurst := strings.Cut(rate, "+")
+
+		var err error
+		if policy.Limit, err = strconv.Atoi(limit); err != nil || policy.Limit <= 0 {
+			return nil, fmt.Errorf("rate limit policy %q: invalid limit %q", entry, limit)
+		}
+		if hasBurst {
+			if policy.Burst, err = strconv.Atoi(burst); err != nil || policy.Burst <= 0 {
+				return nil, fmt.Errorf("rate limit policy %q: invalid burst %q", entry, burst)
+			}
+		}
+		if policy.Period, err = time.ParseDuration(period); err != nil || policy.Period <= 0 {
+			return nil, fmt.Errorf("rate limit policy %q: invalid period %q", entry, period)
+		}
+
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Registration modes
+const (
+	// RegistrationOpen lets anyone register
+	RegistrationOpen = "open"
+	// RegistrationDisabled closes registration; invitations cannot be
+	// accepted either
+	RegistrationDisabled = "disabled"
+	// RegistrationInviteOnly only creates accounts through invitations
+	RegistrationInviteOnly = "invite_only"
+	// RegistrationDomainAllowlist lets people with an email address at an
+	// allowed domain register, once they prove they own it
+	RegistrationDomainAllowlist = "domain_allowlist"
+	// RegistrationApproval lets anyone register, but an admin must approve
+	// the account before it can be used
+	RegistrationApproval = "approval"
+)
+
+// RegistrationModes lists every registration mode
+var RegistrationModes = []string{RegistrationOpen, RegistrationDisabled, RegistrationInviteOnly,
+	RegistrationDomainAllowlist, RegistrationApproval}
+
+// EmailVerificationPath is the path of the link verifying the email address
+// of a new account
+const EmailVerificationPath = "/api/v1/user/register/verify"
+
+// emailVerificationTTL is how long an email verification link works
+const emailVerificationTTL = 48 * time.Hour
+
+// Errors returned by the RegistrationService
+var (
+	ErrRegistrationDisabled   = errors.New("registration is disabled")
+	ErrRegistrationInviteOnly = errors.New("registration is by invitation only, ask an administrator for one")
+	ErrEmailRequired          = errors.New("an email address is required to register")
+	ErrEmailDomainNotAllowed  = errors.New("registration is restricted to addresses at approved domains")
+	ErrVerificationInvalid    = errors.New("this verification link is invalid, has expired or was already used")
+	ErrRegistrationMissing    = errors.New("no registration awaiting approval with this ID")
+)
+
+// RegistrationPolicy decides who can create an account by registering
+type RegistrationPolicy struct {
+	// Mode is one of the RegistrationModes; empty means RegistrationOpen
+	Mode string
+	// AllowedDomains are the email domains accepted in the
+	// RegistrationDomainAllowlist mode, compared without case. Subdomains
+	// must be listed too.
+	AllowedDomains []string
+}
+
+// EmailRequired reports whether people must give an email address to
+// register: to check its domain, or to tell them the decision of the admin
+func (p RegistrationPolicy) EmailRequired() bool {
+	return p.Mode == RegistrationDomainAllowlist || p.Mode == RegistrationApproval
+}
+
+// RegistrationServiceInterface defines the interface for the RegistrationService
+type RegistrationServiceInterface interface {
+	Policy() RegistrationPolicy
+	Register(username, password, email string) (*models.User, error)
+	SendVerification(user *models.User) error
+	VerifyEmail(token string) (*models.User, error)
+	ListPendingUsers() ([]models.User, error)
+	ApproveUser(userID uint) (*models.User, error)
+	RejectUser(userID uint) (*models.User, error)
+}
+
+// RegistrationService applies the registration policy to people creating
+// their own account, and lets admins approve or reject the accounts
+// awaiting approval
+type RegistrationService struct {
+	Users    UserServiceInterface
+	UserRepo repository.UserRepository
+	Mailer   Mailer
+	Rules    RegistrationPolicy
+	// BaseURL is the public URL of the service, the links sent by email
+	// point to
+	BaseURL string
+	// Secret signs the email verification links
+	Secret []byte
+	Now    func() time.Time
+}
+
+// NewRegistrationService creates a new RegistrationService
+func NewRegistrationService(users UserServiceInterface, userRepo repository.UserRepository, mailer Mailer,
+	policy RegistrationPolicy, baseURL string, secret []byte) *RegistrationService {
+	return &RegistrationService{
+		Users:    users,
+		UserRepo: userRepo,
+		Mailer:   mailer,
+		Rules:    policy,
+		BaseURL:  strings.TrimSuffix(baseURL, "/"),
+		Secret:   secret,
+		Now:      time.Now,
+	}
+}
+
+// Policy returns the registration policy
+func (s *RegistrationService) Policy() RegistrationPolicy {
+	return s.Rules
+}
+
+// Register creates the account of someone registering, if the policy lets
+// them.
+//
+// The username and password are checked like in UserService.CreateAccount.
+// In the RegistrationDomainAllowlist mode, the account is unverified until
+// its owner follows the link emailed to them; in the RegistrationApproval
+// mode, it is pending until an admin approves it. Neither can log in
+// before then. Registering fails with ErrRegistrationDisabled or
+// ErrRegistrationInviteOnly when registration is closed.
+func (s *RegistrationService) Register(username, password, email string) (*models.User, error) {
+	status := models.UserStatusActive
+	switch s.Rules.Mode {
+	case RegistrationDisabled:
+		return nil, ErrRegistrationDisabled
+	case RegistrationInviteOnly:
+		return nil, ErrRegistrationInviteOnly
+	case RegistrationDomainAllowlist:
+		status = models.UserStatusUnverified
+	case RegistrationApproval:
+		status = models.UserStatusPending
+	}
+
+	if email != "" {
+		var err error
+		if email, err = normalizeEmail(email); err != nil {
+			return nil, err
+		}
+	} else if s.Rules.EmailRequired() {
+		return nil, ErrEmailRequired
+	}
+	if s.Rules.Mode == RegistrationDomainAllowlist && !s.domainAllowed(email) {
+		return nil, ErrEmailDomainNotAllowed
+	}
+
+	user, err := s.Users.CreateAccount(username, password, email, status)
+	if err != nil {
+		return nil, err
+	}
+	if status == models.UserStatusUnverified {
+		// The account exists either way; the owner gets a new link when
+		// they try to log in
+		if err := s.SendVerification(user); err != nil {
+			log.Printf("Failed to send the verification email of user %d: %v", user.ID, err)
+		}
+	}
+	return user, nil
+}
+
+// SendVerification emails a link verifying the address of an unverified
+// account. Earlier links keep working until they expire.
+func (s *RegistrationService) SendVerification(user *models.User) error {
+	if user.Status != models.UserStatusUnverified {
+		return nil
+	}
+	expires := s.Now().Add(emailVerificationTTL)
+	token := s.verificationToken(user.ID, user.Email, expires.Unix())
+	body := fmt.Sprintf("Hello %s,\n\n"+
+		"Follow this link to verify your email address and activate your account:\n%s\n\n"+
+		"The link expires on %s. If you did not register, ignore this email.\n",
+		user.Username, s.BaseURL+EmailVerificationPath+"?token="+url.QueryEscape(token),
+		expires.UTC().Format("January 2, 2006 at 15:04 UTC"))
+	return s.Mailer.Send(user.Email, "Verify your email address", body)
+}
+
+// VerifyEmail activates the unverified account a verification link was
+// sent for, or returns ErrVerificationInvalid
+func (s *RegistrationService) VerifyEmail(token string) (*models.User, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrVerificationInvalid
+	}
+	userID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrVerificationInvalid
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || s.Now().Unix() >= expires {
+		return nil, ErrVerificationInvalid
+	}
+
+	user, err := s.UserRepo.GetUserByID(uint(userID))
+	if err != nil {
+		return nil, err
+	}
+	// The link is bound to the address, and only works once
+	if user == nil || user.Status != models.UserStatusUnverified ||
+		!hmac.Equal([]byte(token), []byte(s.verificationToken(user.ID, user.Email, expires))) {
+		return nil, ErrVerificationInvalid
+	}
+
+	user.Status = models.UserStatusActive
+	if err := s.UserRepo.UpdateUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ListPendingUsers returns the accounts awaiting approval, oldest first
+func (s *RegistrationService) ListPendingUsers() ([]models.User, error) {
+	return s.UserRepo.ListUsersByStatus(models.UserStatusPending)
+}
+
+// ApproveUser activates an account awaiting approval and tells its owner by
+// email. Failing to send the email does not fail the approval.
+func (s *RegistrationService) ApproveUser(userID uint) (*models.User, error) {
+	user, err := s.pendingUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	user.Status = models.UserStatusActive
+	if err := s.UserRepo.UpdateUser(user); err != nil {
+		return nil, err
+	}
+
+	s.notify(user, "Your account was approved", fmt.Sprintf("Hello %s,\n\n"+
+		"An administrator approved your account. You can now log in at:\n%s\n",
+		user.Username, s.BaseURL+"/api/v1/user/login"))
+	return user, nil
+}
+
+// RejectUser deletes an account awaiting approval and tells its owner by
+// email. Failing to send the email does not fail the rejection.
+func (s *RegistrationService) RejectUser(userID uint) (*models.User, error) {
+	user, err := s.pendingUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.UserRepo.DeleteUser(user.ID); err != nil {
+		return nil, err
+	}
+
+	s.notify(user, "Your registration was declined", fmt.Sprintf("Hello %s,\n\n"+
+		"An administrator declined your registration, and your account was not created.\n",
+		user.Username))
+	return user, nil
+}
+
+// pendingUser returns the account awaiting approval with the ID, or
+// ErrRegistrationMissing
+func (s *RegistrationService) pendingUser(userID uint) (*models.User, error) {
+	user, err := s.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Status != models.UserStatusPending {
+		return nil, ErrRegistrationMissing
+	}
+	return user, nil
+}
+
+// notify emails the owner of an account, if they gave an address, logging
+// failures
+func (s *RegistrationService) notify(user *models.User, subject, body string) {
+	if user.Email == "" {
+		return
+	}
+	if err := s.Mailer.Send(user.Email, subject, body); err != nil {
+		log.Printf("Failed to email user %d: %v", user.ID, err)
+	}
+}
+
+// domainAllowed reports whether the domain of an email address is allowed
+func (s *RegistrationService) domainAllowed(email string) bool {
+	domain := email[strings.LastIndex(email, "@")+1:]
+	for _, allowed := range s.Rules.AllowedDomains {
+		if strings.EqualFold(domain, strings.TrimPrefix(allowed, "@")) {
+			return true
+		}
+	}
+	return false
+}
+
+// verificationToken returns the email verification token of an account:
+// its ID and expiry time, signed with the address
+func (s *RegistrationService) verificationToken(userID uint, email string, expires int64) string {
+	payload := fmt.Sprintf("%d.%d", userID, expires)
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte("verify-email:" + payload + ":" + email))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
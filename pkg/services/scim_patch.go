@@ -0,0 +1,375 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// scimPatchPath is a parsed PATCH path, such as
+// `members[value eq "2819c223"].display`
+type scimPatchPath struct {
+	Attribute string
+	Filter    utils.SCIMFilter
+	SubAttr   string
+}
+
+// applySCIMPatch applies the operations of a PATCH request (RFC 7644
+// section 3.5.2) to the JSON representation of current and decodes the
+// result into patched.
+//
+// The operations work on the JSON document rather than on the models, so
+// every attribute of the resource can be patched the same way. Attributes
+// of extension schemas are ignored, and readOnly attributes cannot be
+// changed.
+func applySCIMPatch(current, patched interface{}, patch *SCIMPatchRequest, readOnly []string) error {
+	if len(patch.Operations) == 0 {
+		return scimError(http.StatusBadRequest, "invalidSyntax", "Operations is required")
+	}
+
+	encoded, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(encoded, &document); err != nil {
+		return err
+	}
+
+	for _, operation := range patch.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return scimError(http.StatusBadRequest, "invalidSyntax", fmt.Sprintf("Unsupported operation %q", operation.Op))
+		}
+
+		var value interface{}
+		if len(operation.Value) > 0 {
+			if err := json.Unmarshal(operation.Value, &value); err != nil {
+				return scimError(http.StatusBadRequest, "invalidSyntax", "Invalid value: "+err.Error())
+			}
+		}
+
+		if operation.Path == "" {
+			if err := applySCIMPatchValue(document, op, value, readOnly); err != nil {
+				return err
+			}
+			continue
+		}
+		path, err := parseSCIMPatchPath(operation.Path)
+		if err != nil {
+			return err
+		}
+		if err := applySCIMPatchOperation(document, op, path, value, readOnly); err != nil {
+			return err
+		}
+	}
+
+	encoded, err = json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(encoded, patched); err != nil {
+		return scimError(http.StatusBadRequest, "invalidValue", "Invalid value: "+err.Error())
+	}
+	return nil
+}
+
+// applySCIMPatchValue applies an operation without path, whose value holds
+// the attributes to add or replace
+func applySCIMPatchValue(document map[string]interface{}, op string, value interface{}, readOnly []string) error {
+	if op == "remove" {
+		return scimError(http.StatusBadRequest, "noTarget", "remove requires a path")
+	}
+	attributes, ok := value.(map[string]interface{})
+	if !ok {
+		return scimError(http.StatusBadRequest, "invalidValue", "The value of an operation without path must be an object")
+	}
+	for name, attribute := range attributes {
+		if strings.HasPrefix(strings.ToLower(name), strings.ToLower(utils.SCIMCoreSchemaPrefix)) {
+			// Attributes of the core schema sent with their full name
+			if nested, ok := attribute.(map[string]interface{}); ok {
+				if err := applySCIMPatchValue(document, op, nested, readOnly); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		path, err := parseSCIMPatchPath(name)
+		if err != nil {
+			return err
+		}
+		if err := applySCIMPatchOperation(document, op, path, attribute, readOnly); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSCIMPatchPath parses a PATCH path
+func parseSCIMPatchPath(raw string) (scimPatchPath, error) {
+	invalid := scimError(http.StatusBadRequest, "invalidPath", fmt.Sprintf("Invalid path %q", raw))
+
+	var path scimPatchPath
+	attribute := raw
+	if open := strings.Index(raw, "["); open >= 0 {
+		end := strings.LastIndex(raw, "]")
+		if end < open {
+			return path, invalid
+		}
+		filter, err := utils.ParseSCIMFilter(raw[open+1 : end])
+		if err != nil {
+			return path, invalid
+		}
+		path.Filter = filter
+		attribute = raw[:open]
+		if rest := raw[end+1:]; rest != "" {
+			if !strings.HasPrefix(rest, ".") || len(rest) == 1 {
+				return path, invalid
+			}
+			path.SubAttr = strings.ToLower(rest[1:])
+		}
+	}
+
+	attribute = utils.SCIMAttributePath(attribute)
+	if attribute == "" {
+		return path, invalid
+	}
+	if path.Filter == nil {
+		if dot := strings.Index(attribute, "."); dot >= 0 {
+			attribute, path.SubAttr = attribute[:dot], attribute[dot+1:]
+		}
+	}
+	path.Attribute = attribute
+	return path, nil
+}
+
+// applySCIMPatchOperation applies an operation to the attribute of a path
+func applySCIMPatchOperation(document map[string]interface{}, op string, path scimPatchPath, value interface{}, readOnly []string) error {
+	if strings.HasPrefix(path.Attribute, "urn:") {
+		// Extension schemas are not supported
+		return nil
+	}
+	for _, attribute := range readOnly {
+		if strings.EqualFold(attribute, path.Attribute) {
+			return scimError(http.StatusBadRequest, "mutability", path.Attribute+" is read-only")
+		}
+	}
+	if op != "remove" && value == nil {
+		return scimError(http.StatusBadRequest, "invalidValue", op+" requires a value")
+	}
+
+	key := documentKey(document, path.Attribute)
+	current, exists := document[key]
+
+	if path.Filter != nil {
+		elements, _ := current.([]interface{})
+		patchedElements, err := applySCIMPatchFilter(elements, op, path, value)
+		if err != nil {
+			return err
+		}
+		document[key] = patchedElements
+		return nil
+	}
+
+	if path.SubAttr != "" {
+		switch typed := current.(type) {
+		case []interface{}:
+			// Applies to every element of a multi-valued attribute
+			for _, element := range typed {
+				if object, ok := element.(map[string]interface{}); ok {
+					setSCIMSubAttribute(object, op, path.SubAttr, value)
+				}
+			}
+		case map[string]interface{}:
+			setSCIMSubAttribute(typed, op, path.SubAttr, value)
+		default:
+			if op != "remove" {
+				document[key] = map[string]interface{}{path.SubAttr: value}
+			}
+		}
+		return nil
+	}
+
+	switch op {
+	case "remove":
+		elements, isArray := current.([]interface{})
+		if values, ok := value.([]interface{}); ok && isArray {
+			// Removes the elements listed in the value, as sent by some
+			// identity providers for group members
+			document[key] = removeSCIMValues(elements, values)
+		} else {
+			delete(document, key)
+		}
+	case "add":
+		elements, isArray := current.([]interface{})
+		if exists && isArray {
+			document[key] = addSCIMValues(elements, value)
+			return nil
+		}
+		if object, ok := current.(map[string]interface{}); ok {
+			if additions, ok := value.(map[string]interface{}); ok {
+				for name, addition := range additions {
+					object[documentKey(object, name)] = addition
+				}
+				return nil
+			}
+		}
+		document[key] = value
+	case "replace":
+		if object, ok := current.(map[string]interface{}); ok {
+			if replacements, ok := value.(map[string]interface{}); ok {
+				for name, replacement := range replacements {
+					object[documentKey(object, name)] = replacement
+				}
+				return nil
+			}
+		}
+		document[key] = value
+	}
+	return nil
+}
+
+// applySCIMPatchFilter applies an operation to the elements of a
+// multi-valued attribute matching the filter of the path. Adding or
+// replacing a value without match creates an element from the equality
+// comparisons of the filter, as expected by some identity providers.
+func applySCIMPatchFilter(elements []interface{}, op string, path scimPatchPath, value interface{}) ([]interface{}, error) {
+	var patched []interface{}
+	matched := false
+	for _, element := range elements {
+		object, ok := element.(map[string]interface{})
+		if !ok || !utils.MatchSCIMFilter(path.Filter, object, false) {
+			patched = append(patched, element)
+			continue
+		}
+		matched = true
+
+		switch {
+		case op == "remove" && path.SubAttr == "":
+			continue
+		case path.SubAttr != "":
+			setSCIMSubAttribute(object, op, path.SubAttr, value)
+		default:
+			replacement, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, scimError(http.StatusBadRequest, "invalidValue", "The value must be an object")
+			}
+			object = replacement
+		}
+		patched = append(patched, object)
+	}
+
+	if matched || op == "remove" {
+		return patched, nil
+	}
+
+	element := make(map[string]interface{})
+	collectSCIMEqualities(path.Filter, element)
+	if len(element) == 0 {
+		return nil, scimError(http.StatusBadRequest, "noTarget", "No value matches the filter")
+	}
+	if path.SubAttr != "" {
+		element[path.SubAttr] = value
+	} else {
+		replacement, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, scimError(http.StatusBadRequest, "invalidValue", "The value must be an object")
+		}
+		for name, attribute := range replacement {
+			element[documentKey(element, name)] = attribute
+		}
+	}
+	return append(patched, element), nil
+}
+
+// collectSCIMEqualities adds the attributes compared with "eq" by a filter
+// of "and" comparisons to an element
+func collectSCIMEqualities(filter utils.SCIMFilter, element map[string]interface{}) {
+	switch f := filter.(type) {
+	case utils.SCIMComparison:
+		if f.Operator == "eq" {
+			element[f.Path] = f.Value
+		}
+	case utils.SCIMLogical:
+		if f.Operator == "and" {
+			collectSCIMEqualities(f.Left, element)
+			collectSCIMEqualities(f.Right, element)
+		}
+	}
+}
+
+// setSCIMSubAttribute sets or removes a sub-attribute of an object
+func setSCIMSubAttribute(object map[string]interface{}, op, name string, value interface{}) {
+	key := documentKey(object, name)
+	if op == "remove" {
+		delete(object, key)
+		return
+	}
+	object[key] = value
+}
+
+// addSCIMValues appends values to a multi-valued attribute, skipping the
+// elements already present
+func addSCIMValues(elements []interface{}, value interface{}) []interface{} {
+	additions, ok := value.([]interface{})
+	if !ok {
+		additions = []interface{}{value}
+	}
+	for _, addition := range additions {
+		duplicate := false
+		for _, element := range elements {
+			if scimElementValue(element) == scimElementValue(addition) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			elements = append(elements, addition)
+		}
+	}
+	return elements
+}
+
+// removeSCIMValues removes the elements having the values of the removals
+func removeSCIMValues(elements []interface{}, removals []interface{}) []interface{} {
+	var kept []interface{}
+	for _, element := range elements {
+		removed := false
+		for _, removal := range removals {
+			if scimElementValue(element) == scimElementValue(removal) {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			kept = append(kept, element)
+		}
+	}
+	return kept
+}
+
+// scimElementValue returns the "value" sub-attribute of an element of a
+// multi-valued attribute, or the element itself for simple values
+func scimElementValue(element interface{}) string {
+	if object, ok := element.(map[string]interface{}); ok {
+		for name, value := range object {
+			if strings.EqualFold(name, "value") {
+				return fmt.Sprint(value)
+			}
+		}
+	}
+	return fmt.Sprint(element)
+}
+
+// documentKey returns the key of an attribute in a JSON object, whose
+// names are case-insensitive, or the name itself if it is missing
+func documentKey(object map[string]interface{}, name string) string {
+	for key := range object {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
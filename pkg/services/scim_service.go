@@ -0,0 +1,664 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SCIM schemas (RFC 7643 and RFC 7644)
+const (
+	SCIMUserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMGroupSchema        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMPatchOpSchema      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// Page sizes of the list endpoints
+const (
+	SCIMDefaultCount = 100
+	SCIMMaxCount     = 200
+)
+
+// SCIMError is an error returned to SCIM clients with its HTTP status and,
+// for HTTP status 400 and 409, its scimType (RFC 7644 section 3.12)
+type SCIMError struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+// Error returns the detail of the error
+func (e *SCIMError) Error() string {
+	return e.Detail
+}
+
+// MarshalJSON encodes the error as a SCIM error response
+func (e *SCIMError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Schemas  []string `json:"schemas"`
+		Status   string   `json:"status"`
+		ScimType string   `json:"scimType,omitempty"`
+		Detail   string   `json:"detail,omitempty"`
+	}{[]string{SCIMErrorSchema}, strconv.Itoa(e.Status), e.ScimType, e.Detail})
+}
+
+// scimError returns a new SCIMError
+func scimError(status int, scimType, detail string) *SCIMError {
+	return &SCIMError{Status: status, ScimType: scimType, Detail: detail}
+}
+
+// SCIMBool is a boolean that also accepts "true" and "false" strings, as
+// sent by some identity providers
+type SCIMBool bool
+
+// UnmarshalJSON decodes a boolean or a boolean string
+func (b *SCIMBool) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		value, err := strconv.ParseBool(strings.ToLower(text))
+		*b = SCIMBool(value)
+		return err
+	}
+	var value bool
+	err := json.Unmarshal(data, &value)
+	*b = SCIMBool(value)
+	return err
+}
+
+// SCIMMeta holds the metadata of a resource
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+// SCIMName is the name of a user
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// SCIMMultiValue is an element of a multi-valued attribute, such as an
+// email or a group member
+type SCIMMultiValue struct {
+	Value   string   `json:"value"`
+	Display string   `json:"display,omitempty"`
+	Type    string   `json:"type,omitempty"`
+	Primary SCIMBool `json:"primary,omitempty"`
+	Ref     string   `json:"$ref,omitempty"`
+}
+
+// SCIMUser is the SCIM representation of a models.User. The password can
+// be set but is never returned.
+type SCIMUser struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	ExternalID  string           `json:"externalId,omitempty"`
+	UserName    string           `json:"userName"`
+	Name        *SCIMName        `json:"name,omitempty"`
+	DisplayName string           `json:"displayName,omitempty"`
+	Emails      []SCIMMultiValue `json:"emails,omitempty"`
+	Active      *SCIMBool        `json:"active,omitempty"`
+	Password    string           `json:"password,omitempty"`
+	Groups      []SCIMMultiValue `json:"groups,omitempty"`
+	Meta        *SCIMMeta        `json:"meta,omitempty"`
+}
+
+// SCIMGroup is the SCIM representation of a models.Group
+type SCIMGroup struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	ExternalID  string           `json:"externalId,omitempty"`
+	DisplayName string           `json:"displayName"`
+	Members     []SCIMMultiValue `json:"members"`
+	Meta        *SCIMMeta        `json:"meta,omitempty"`
+}
+
+// SCIMListQuery holds the parameters of a list request. StartIndex is
+// 1-based.
+type SCIMListQuery struct {
+	Filter     string
+	StartIndex int
+	Count      int
+}
+
+// SCIMListResponse is a page of resources
+type SCIMListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int64         `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// SCIMPatchOperation is an operation of a PATCH request
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// SCIMPatchRequest is the body of a PATCH request
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+// SCIMServiceInterface defines the interface for the SCIMService
+type SCIMServiceInterface interface {
+	CreateUser(ctx context.Context, resource *SCIMUser) (*SCIMUser, error)
+	GetUser(ctx context.Context, id string) (*SCIMUser, error)
+	ListUsers(ctx context.Context, query SCIMListQuery) (*SCIMListResponse, error)
+	ReplaceUser(ctx context.Context, id string, resource *SCIMUser) (*SCIMUser, error)
+	PatchUser(ctx context.Context, id string, patch *SCIMPatchRequest) (*SCIMUser, error)
+	DeleteUser(ctx context.Context, id string) error
+	CreateGroup(ctx context.Context, resource *SCIMGroup) (*SCIMGroup, error)
+	GetGroup(ctx context.Context, id string) (*SCIMGroup, error)
+	ListGroups(ctx context.Context, query SCIMListQuery) (*SCIMListResponse, error)
+	ReplaceGroup(ctx context.Context, id string, resource *SCIMGroup) (*SCIMGroup, error)
+	PatchGroup(ctx context.Context, id string, patch *SCIMPatchRequest) (*SCIMGroup, error)
+	DeleteGroup(ctx context.Context, id string) error
+}
+
+// SCIMService maps the SCIM 2.0 Users and Groups resources (RFC 7643) onto
+// the members and groups of an organization, so its HR system can
+// provision them.
+//
+// Every method works in the organization of its context: the Users
+// resources are its members, and the users it cannot see do not exist.
+// Users are created without a password unless one is pushed. Setting
+// "active" to false deactivates their membership rather than their
+// account, which other organizations may share, and deleting them removes
+// them from the organization, deleting their account once they belong to
+// none. Errors meant for the client are returned as *SCIMError.
+type SCIMService struct {
+	Users         UserServiceInterface
+	UserRepo      repository.UserRepository
+	Organizations repository.OrganizationRepository
+	GroupRepo     repository.GroupRepository
+	// BaseURL is the public base URL of this service, without trailing
+	// slash, used for the resource locations
+	BaseURL string
+	Now     func() time.Time
+}
+
+// NewSCIMService creates a new SCIMService
+func NewSCIMService(users UserServiceInterface, userRepo repository.UserRepository, organizationRepo repository.OrganizationRepository,
+	groupRepo repository.GroupRepository, baseURL string) *SCIMService {
+	return &SCIMService{
+		Users:         users,
+		UserRepo:      userRepo,
+		Organizations: organizationRepo,
+		GroupRepo:     groupRepo,
+		BaseURL:       strings.TrimRight(baseURL, "/"),
+		Now:           time.Now,
+	}
+}
+
+// CreateUser creates a user from a SCIM resource, as a member of the
+// organization. Taken usernames fail with HTTP status 409.
+func (s *SCIMService) CreateUser(ctx context.Context, resource *SCIMUser) (*SCIMUser, error) {
+	if resource.UserName == "" {
+		return nil, scimError(http.StatusBadRequest, "invalidValue", "userName is required")
+	}
+
+	user, err := s.Users.ProvisionUser(resource.UserName, "")
+	if err != nil {
+		return nil, scimUserError(err)
+	}
+	membership := &models.Membership{UserID: user.ID, Role: models.OrgRoleMember}
+	err = s.Organizations.AddMember(ctx, membership)
+	if err == nil {
+		membership.User = *user
+		err = s.saveUser(ctx, membership, resource)
+	}
+	if err != nil {
+		// Do not leave a half provisioned user behind
+		if deleteErr := s.UserRepo.DeleteUser(user.ID); deleteErr != nil {
+			return nil, deleteErr
+		}
+		return nil, err
+	}
+	return s.toSCIMUser(ctx, membership)
+}
+
+// GetUser returns the member with the id
+func (s *SCIMService) GetUser(ctx context.Context, id string) (*SCIMUser, error) {
+	membership, err := s.findMember(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toSCIMUser(ctx, membership)
+}
+
+// ListUsers returns a page of the members matching the filter
+func (s *SCIMService) ListUsers(ctx context.Context, query SCIMListQuery) (*SCIMListResponse, error) {
+	filter, startIndex, count, err := parseSCIMListQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	memberships, total, err := s.Organizations.SearchMembers(ctx, filter, startIndex-1, count)
+	if err != nil {
+		return nil, scimFilterError(err)
+	}
+
+	response := newSCIMListResponse(total, startIndex)
+	for i := range memberships {
+		resource, err := s.toSCIMUser(ctx, &memberships[i])
+		if err != nil {
+			return nil, err
+		}
+		response.Resources = append(response.Resources, resource)
+	}
+	response.ItemsPerPage = len(response.Resources)
+	return response, nil
+}
+
+// ReplaceUser replaces the attributes of a member with those of a SCIM
+// resource. Attributes missing from the resource are cleared, except
+// "active" and the password, which are left unchanged.
+func (s *SCIMService) ReplaceUser(ctx context.Context, id string, resource *SCIMUser) (*SCIMUser, error) {
+	membership, err := s.findMember(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.saveUser(ctx, membership, resource); err != nil {
+		return nil, err
+	}
+	return s.toSCIMUser(ctx, membership)
+}
+
+// PatchUser applies the operations of a PATCH request to a member
+func (s *SCIMService) PatchUser(ctx context.Context, id string, patch *SCIMPatchRequest) (*SCIMUser, error) {
+	membership, err := s.findMember(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.toSCIMUser(ctx, membership)
+	if err != nil {
+		return nil, err
+	}
+
+	var patched SCIMUser
+	if err := applySCIMPatch(current, &patched, patch, []string{"id", "meta", "groups"}); err != nil {
+		return nil, err
+	}
+	if err := s.saveUser(ctx, membership, &patched); err != nil {
+		return nil, err
+	}
+	return s.toSCIMUser(ctx, membership)
+}
+
+// DeleteUser removes a member from the organization, and deletes their
+// account if they no longer belong to any. Deleted users are gone for SCIM
+// clients; deactivated ones are still listed.
+func (s *SCIMService) DeleteUser(ctx context.Context, id string) error {
+	membership, err := s.findMember(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.Organizations.RemoveMember(ctx, membership.UserID); err != nil {
+		return err
+	}
+	remaining, err := s.Organizations.ListMemberships(membership.UserID)
+	if err != nil || len(remaining) > 0 {
+		return err
+	}
+	return s.UserRepo.DeleteUser(membership.UserID)
+}
+
+// CreateGroup creates a group from a SCIM resource. Taken display names
+// fail with HTTP status 409.
+func (s *SCIMService) CreateGroup(ctx context.Context, resource *SCIMGroup) (*SCIMGroup, error) {
+	group := &models.Group{}
+	if err := s.applySCIMGroup(ctx, group, resource); err != nil {
+		return nil, err
+	}
+	if err := s.GroupRepo.CreateGroup(ctx, group); err != nil {
+		return nil, scimGroupError(err)
+	}
+	return s.toSCIMGroup(group), nil
+}
+
+// GetGroup returns the group with the id
+func (s *SCIMService) GetGroup(ctx context.Context, id string) (*SCIMGroup, error) {
+	group, err := s.findGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toSCIMGroup(group), nil
+}
+
+// ListGroups returns a page of the groups matching the filter
+func (s *SCIMService) ListGroups(ctx context.Context, query SCIMListQuery) (*SCIMListResponse, error) {
+	filter, startIndex, count, err := parseSCIMListQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	groups, total, err := s.GroupRepo.SearchGroups(ctx, filter, startIndex-1, count)
+	if err != nil {
+		return nil, scimFilterError(err)
+	}
+
+	response := newSCIMListResponse(total, startIndex)
+	for i := range groups {
+		response.Resources = append(response.Resources, s.toSCIMGroup(&groups[i]))
+	}
+	response.ItemsPerPage = len(response.Resources)
+	return response, nil
+}
+
+// ReplaceGroup replaces the display name, external ID and members of a
+// group
+func (s *SCIMService) ReplaceGroup(ctx context.Context, id string, resource *SCIMGroup) (*SCIMGroup, error) {
+	group, err := s.findGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applySCIMGroup(ctx, group, resource); err != nil {
+		return nil, err
+	}
+	if err := s.GroupRepo.UpdateGroup(ctx, group); err != nil {
+		return nil, scimGroupError(err)
+	}
+	return s.toSCIMGroup(group), nil
+}
+
+// PatchGroup applies the operations of a PATCH request to a group, such as
+// adding and removing members
+func (s *SCIMService) PatchGroup(ctx context.Context, id string, patch *SCIMPatchRequest) (*SCIMGroup, error) {
+	group, err := s.findGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var patched SCIMGroup
+	if err := applySCIMPatch(s.toSCIMGroup(group), &patched, patch, []string{"id", "meta"}); err != nil {
+		return nil, err
+	}
+	if err := s.applySCIMGroup(ctx, group, &patched); err != nil {
+		return nil, err
+	}
+	if err := s.GroupRepo.UpdateGroup(ctx, group); err != nil {
+		return nil, scimGroupError(err)
+	}
+	return s.toSCIMGroup(group), nil
+}
+
+// DeleteGroup deletes a group
+func (s *SCIMService) DeleteGroup(ctx context.Context, id string) error {
+	group, err := s.findGroup(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.GroupRepo.DeleteGroup(ctx, group.ID)
+}
+
+// findMember returns the membership, with the user, of the member with the
+// id, or a SCIMError with HTTP status 404
+func (s *SCIMService) findMember(ctx context.Context, id string) (*models.Membership, error) {
+	notFound := scimError(http.StatusNotFound, "", "User "+id+" not found")
+	userID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, notFound
+	}
+	membership, err := s.Organizations.GetMembership(ctx, uint(userID))
+	if err != nil {
+		return nil, err
+	}
+	if membership == nil {
+		return nil, notFound
+	}
+	return membership, nil
+}
+
+// findGroup returns the group with the id, or a SCIMError with HTTP status
+// 404
+func (s *SCIMService) findGroup(ctx context.Context, id string) (*models.Group, error) {
+	notFound := scimError(http.StatusNotFound, "", "Group "+id+" not found")
+	groupID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, notFound
+	}
+	group, err := s.GroupRepo.GetGroup(ctx, uint(groupID))
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, notFound
+	}
+	return group, nil
+}
+
+// saveUser applies the attributes of a SCIM resource to a member and saves
+// them, with their new password if one is set
+func (s *SCIMService) saveUser(ctx context.Context, membership *models.Membership, resource *SCIMUser) error {
+	if resource.UserName == "" {
+		return scimError(http.StatusBadRequest, "invalidValue", "userName is required")
+	}
+	user := &membership.User
+	if err := s.Users.ChangeUsername(user, resource.UserName); err != nil {
+		return scimUserError(err)
+	}
+
+	user.ExternalID = resource.ExternalID
+	user.DisplayName = resource.DisplayName
+	user.GivenName, user.FamilyName = "", ""
+	if resource.Name != nil {
+		user.GivenName, user.FamilyName = resource.Name.GivenName, resource.Name.FamilyName
+	}
+	user.Email = primaryValue(resource.Emails)
+
+	if resource.Active != nil && bool(*resource.Active) != membership.Active() {
+		membership.DeactivatedAt = nil
+		if !bool(*resource.Active) {
+			now := s.Now()
+			membership.DeactivatedAt = &now
+		}
+		if err := s.Organizations.UpdateMember(ctx, membership); err != nil {
+			return err
+		}
+	}
+
+	if resource.Password != "" {
+		// SetPassword saves the user too
+		return scimUserError(s.Users.SetPassword(user, resource.Password))
+	}
+	return s.UserRepo.UpdateUser(user)
+}
+
+// applySCIMGroup applies the attributes of a SCIM resource to a group,
+// loading its members
+func (s *SCIMService) applySCIMGroup(ctx context.Context, group *models.Group, resource *SCIMGroup) error {
+	if resource.DisplayName == "" {
+		return scimError(http.StatusBadRequest, "invalidValue", "displayName is required")
+	}
+	group.DisplayName = resource.DisplayName
+	group.ExternalID = resource.ExternalID
+
+	group.Members = nil
+	seen := make(map[string]bool)
+	for _, member := range resource.Members {
+		if seen[member.Value] {
+			continue
+		}
+		seen[member.Value] = true
+
+		membership, err := s.findMember(ctx, member.Value)
+		var scimErr *SCIMError
+		if errors.As(err, &scimErr) {
+			return scimError(http.StatusBadRequest, "invalidValue", "Unknown member "+member.Value)
+		}
+		if err != nil {
+			return err
+		}
+		group.Members = append(group.Members, membership.User)
+	}
+	return nil
+}
+
+// toSCIMUser returns the SCIM representation of a member, with their
+// groups in the organization
+func (s *SCIMService) toSCIMUser(ctx context.Context, membership *models.Membership) (*SCIMUser, error) {
+	user := &membership.User
+	groups, err := s.GroupRepo.ListGroupsByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	id := strconv.FormatUint(uint64(user.ID), 10)
+	active := SCIMBool(membership.Active())
+	resource := &SCIMUser{
+		Schemas:     []string{SCIMUserSchema},
+		ID:          id,
+		ExternalID:  user.ExternalID,
+		UserName:    user.Username,
+		DisplayName: user.DisplayName,
+		Active:      &active,
+		Meta: &SCIMMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt.UTC(),
+			LastModified: user.UpdatedAt.UTC(),
+			Location:     s.BaseURL + "/scim/v2/Users/" + id,
+		},
+	}
+	if user.GivenName != "" || user.FamilyName != "" {
+		resource.Name = &SCIMName{
+			Formatted:  strings.TrimSpace(user.GivenName + " " + user.FamilyName),
+			GivenName:  user.GivenName,
+			FamilyName: user.FamilyName,
+		}
+	}
+	if user.Email != "" {
+		resource.Emails = []SCIMMultiValue{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	for _, group := range groups {
+		groupID := strconv.FormatUint(uint64(group.ID), 10)
+		resource.Groups = append(resource.Groups, SCIMMultiValue{
+			Value:   groupID,
+			Display: group.DisplayName,
+			Ref:     s.BaseURL + "/scim/v2/Groups/" + groupID,
+		})
+	}
+	return resource, nil
+}
+
+// toSCIMGroup returns the SCIM representation of a group, with its members
+func (s *SCIMService) toSCIMGroup(group *models.Group) *SCIMGroup {
+	id := strconv.FormatUint(uint64(group.ID), 10)
+	resource := &SCIMGroup{
+		Schemas:     []string{SCIMGroupSchema},
+		ID:          id,
+		ExternalID:  group.ExternalID,
+		DisplayName: group.DisplayName,
+		Members:     []SCIMMultiValue{},
+		Meta: &SCIMMeta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt.UTC(),
+			LastModified: group.UpdatedAt.UTC(),
+			Location:     s.BaseURL + "/scim/v2/Groups/" + id,
+		},
+	}
+	for _, member := range group.Members {
+		memberID := strconv.FormatUint(uint64(member.ID), 10)
+		resource.Members = append(resource.Members, SCIMMultiValue{
+			Value:   memberID,
+			Display: member.Username,
+			Ref:     s.BaseURL + "/scim/v2/Users/" + memberID,
+		})
+	}
+	return resource
+}
+
+// parseSCIMListQuery parses the filter of a list request and clamps its
+// pagination (RFC 7644 section 3.4.2.4)
+func parseSCIMListQuery(query SCIMListQuery) (utils.SCIMFilter, int, int, error) {
+	var filter utils.SCIMFilter
+	if query.Filter != "" {
+		parsed, err := utils.ParseSCIMFilter(query.Filter)
+		if err != nil {
+			return nil, 0, 0, scimError(http.StatusBadRequest, "invalidFilter", err.Error())
+		}
+		filter = parsed
+	}
+
+	startIndex, count := query.StartIndex, query.Count
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > SCIMMaxCount {
+		count = SCIMMaxCount
+	}
+	return filter, startIndex, count, nil
+}
+
+// newSCIMListResponse returns an empty page of results
+func newSCIMListResponse(total int64, startIndex int) *SCIMListResponse {
+	return &SCIMListResponse{
+		Schemas:      []string{SCIMListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		Resources:    []interface{}{},
+	}
+}
+
+// primaryValue returns the value of the primary element of a multi-valued
+// attribute, or of its first element
+func primaryValue(values []SCIMMultiValue) string {
+	for _, value := range values {
+		if value.Primary {
+			return value.Value
+		}
+	}
+	if len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
+
+// scimUserError turns the errors of the UserService into SCIM errors
+func scimUserError(err error) error {
+	var usernameErr *UsernamePolicyError
+	var passwordErr *PasswordPolicyError
+	switch {
+	case errors.Is(err, ErrUserExists), errors.Is(err, ErrUsernameConfusable):
+		return scimError(http.StatusConflict, "uniqueness", err.Error())
+	case errors.As(err, &usernameErr), errors.As(err, &passwordErr):
+		return scimError(http.StatusBadRequest, "invalidValue", err.Error())
+	}
+	return err
+}
+
+// scimGroupError turns taken display names into SCIM errors
+func scimGroupError(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return scimError(http.StatusConflict, "uniqueness", "displayName is already taken")
+	}
+	return err
+}
+
+// scimFilterError turns filters the repository cannot apply into SCIM
+// errors
+func scimFilterError(err error) error {
+	if errors.Is(err, utils.ErrInvalidSCIMFilter) {
+		return scimError(http.StatusBadRequest, "invalidFilter", err.Error())
+	}
+	return fmt.Errorf("search failed: %w", err)
+}
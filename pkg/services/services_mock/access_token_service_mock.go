@@ -0,0 +1,49 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+// MockAccessTokenService should implement the AccessTokenService interface
+type MockAccessTokenService struct {
+	mock.Mock
+}
+
+// Ensure that MockAccessTokenService implements AccessTokenServiceInterface
+var _ services.AccessTokenServiceInterface = (*MockAccessTokenService)(nil)
+
+// CreateToken Implement the methods of AccessTokenService
+func (m *MockAccessTokenService) CreateToken(userID, organizationID uint, name string, scopes []string, ttl time.Duration) (string, *models.PersonalAccessToken, error) {
+	args := m.Called(userID, organizationID, name, scopes, ttl)
+	if token := args.Get(1); token != nil {
+		return args.String(0), token.(*models.PersonalAccessToken), args.Error(2)
+	}
+	return args.String(0), nil, args.Error(2)
+}
+
+// ListTokens Implement the methods of AccessTokenService
+func (m *MockAccessTokenService) ListTokens(userID uint) ([]models.PersonalAccessToken, error) {
+	args := m.Called(userID)
+	if tokens := args.Get(0); tokens != nil {
+		return tokens.([]models.PersonalAccessToken), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// RevokeToken Implement the methods of AccessTokenService
+func (m *MockAccessTokenService) RevokeToken(userID, tokenID uint) error {
+	args := m.Called(userID, tokenID)
+	return args.Error(0)
+}
+
+// Authenticate Implement the methods of AccessTokenService
+func (m *MockAccessTokenService) Authenticate(token, ip string) (*models.PersonalAccessToken, error) {
+	args := m.Called(token, ip)
+	if accessToken := args.Get(0); accessToken != nil {
+		return accessToken.(*models.PersonalAccessToken), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
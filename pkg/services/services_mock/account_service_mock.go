@@ -0,0 +1,69 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockAccountService should implement the AccountService interface
+type MockAccountService struct {
+	mock.Mock
+}
+
+// Ensure that MockAccountService implements AccountServiceInterface
+var _ services.AccountServiceInterface = (*MockAccountService)(nil)
+
+// GetAccount Implement the methods of AccountService
+func (m *MockAccountService) GetAccount(userID uint) (*models.User, error) {
+	args := m.Called(userID)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ChangePassword Implement the methods of AccountService
+func (m *MockAccountService) ChangePassword(userID uint, currentPassword, newPassword string) (*models.User, error) {
+	args := m.Called(userID, currentPassword, newPassword)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// UpdateProfile Implement the methods of AccountService
+func (m *MockAccountService) UpdateProfile(userID uint, profile services.Profile) (*models.User, services.Profile, error) {
+	args := m.Called(userID, profile)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Get(1).(services.Profile), args.Error(2)
+	}
+	return nil, services.Profile{}, args.Error(2)
+}
+
+// ChangeUsername Implement the methods of AccountService
+func (m *MockAccountService) ChangeUsername(userID uint, username string) (*models.User, string, error) {
+	args := m.Called(userID, username)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.String(1), args.Error(2)
+	}
+	return nil, args.String(1), args.Error(2)
+}
+
+// ListUsernameChanges Implement the methods of AccountService
+func (m *MockAccountService) ListUsernameChanges(userID uint) ([]models.UsernameChange, error) {
+	args := m.Called(userID)
+	if changes := args.Get(0); changes != nil {
+		return changes.([]models.UsernameChange), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ResolveUsername Implement the methods of AccountService
+func (m *MockAccountService) ResolveUsername(username string) (*models.User, bool, error) {
+	args := m.Called(username)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Bool(1), args.Error(2)
+	}
+	return nil, args.Bool(1), args.Error(2)
+}
@@ -0,0 +1,39 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockAuditService should implement the AuditService interface
+type MockAuditService struct {
+	mock.Mock
+}
+
+// Ensure that MockAuditService implements AuditServiceInterface
+var _ services.AuditServiceInterface = (*MockAuditService)(nil)
+
+// Record Implement the methods of AuditService
+func (m *MockAuditService) Record(event models.AuditEvent) error {
+	args := m.Called(event)
+	return args.Error(0)
+}
+
+// ListEvents Implement the methods of AuditService
+func (m *MockAuditService) ListEvents(filter models.AuditFilter) ([]models.AuditEvent, error) {
+	args := m.Called(filter)
+	if events := args.Get(0); events != nil {
+		return events.([]models.AuditEvent), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// VerifyChain Implement the methods of AuditService
+func (m *MockAuditService) VerifyChain() (*services.AuditVerification, error) {
+	args := m.Called()
+	if verification := args.Get(0); verification != nil {
+		return verification.(*services.AuditVerification), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
@@ -0,0 +1,24 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockAuthenticator should implement the Authenticator interface
+type MockAuthenticator struct {
+	mock.Mock
+}
+
+// Ensure that MockAuthenticator implements Authenticator
+var _ services.Authenticator = (*MockAuthenticator)(nil)
+
+// Authenticate Implement the methods of Authenticator
+func (m *MockAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	args := m.Called(username, password)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
@@ -0,0 +1,30 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"crypto/x509"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockClientCertificateService should implement the ClientCertificateService interface
+type MockClientCertificateService struct {
+	mock.Mock
+}
+
+// Ensure that MockClientCertificateService implements ClientCertificateServiceInterface
+var _ services.ClientCertificateServiceInterface = (*MockClientCertificateService)(nil)
+
+// Authenticate Implement the methods of ClientCertificateService
+func (m *MockClientCertificateService) Authenticate(certificate *x509.Certificate) (*services.ServiceAccount, *models.User, error) {
+	args := m.Called(certificate)
+	var account *services.ServiceAccount
+	if value := args.Get(0); value != nil {
+		account = value.(*services.ServiceAccount)
+	}
+	var user *models.User
+	if value := args.Get(1); value != nil {
+		user = value.(*models.User)
+	}
+	return account, user, args.Error(2)
+}
@@ -0,0 +1,38 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockExternalLoginService should implement the ExternalLoginService interface
+type MockExternalLoginService struct {
+	mock.Mock
+}
+
+// Ensure that MockExternalLoginService implements ExternalLoginServiceInterface
+var _ services.ExternalLoginServiceInterface = (*MockExternalLoginService)(nil)
+
+// Providers Implement the methods of ExternalLoginService
+func (m *MockExternalLoginService) Providers() []services.ExternalProvider {
+	args := m.Called()
+	if providers := args.Get(0); providers != nil {
+		return providers.([]services.ExternalProvider)
+	}
+	return nil
+}
+
+// BeginLogin Implement the methods of ExternalLoginService
+func (m *MockExternalLoginService) BeginLogin(providerID, next string) (string, string, error) {
+	args := m.Called(providerID, next)
+	return args.String(0), args.String(1), args.Error(2)
+}
+
+// CompleteLogin Implement the methods of ExternalLoginService
+func (m *MockExternalLoginService) CompleteLogin(providerID, stateCookie, state, code string) (*services.ExternalLogin, error) {
+	args := m.Called(providerID, stateCookie, state, code)
+	if login := args.Get(0); login != nil {
+		return login.(*services.ExternalLogin), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
@@ -0,0 +1,43 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockImpersonationService should implement the ImpersonationService interface
+type MockImpersonationService struct {
+	mock.Mock
+}
+
+// Ensure that MockImpersonationService implements ImpersonationServiceInterface
+var _ services.ImpersonationServiceInterface = (*MockImpersonationService)(nil)
+
+// CanImpersonate Implement the methods of ImpersonationService
+func (m *MockImpersonationService) CanImpersonate(actorID uint) (bool, error) {
+	args := m.Called(actorID)
+	return args.Bool(0), args.Error(1)
+}
+
+// StartImpersonation Implement the methods of ImpersonationService
+func (m *MockImpersonationService) StartImpersonation(actorID, targetID uint) (*models.User, *models.User, error) {
+	args := m.Called(actorID, targetID)
+	var actor, target *models.User
+	if user := args.Get(0); user != nil {
+		actor = user.(*models.User)
+	}
+	if user := args.Get(1); user != nil {
+		target = user.(*models.User)
+	}
+	return actor, target, args.Error(2)
+}
+
+// StopImpersonation Implement the methods of ImpersonationService
+func (m *MockImpersonationService) StopImpersonation(actorID uint) (*models.User, error) {
+	args := m.Called(actorID)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
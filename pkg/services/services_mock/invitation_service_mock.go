@@ -0,0 +1,75 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"context"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockInvitationService should implement the InvitationService interface
+type MockInvitationService struct {
+	mock.Mock
+}
+
+// Ensure that MockInvitationService implements InvitationServiceInterface
+var _ services.InvitationServiceInterface = (*MockInvitationService)(nil)
+
+// CreateInvitation Implement the methods of InvitationService
+func (m *MockInvitationService) CreateInvitation(ctx context.Context, inviterID uint, email, role, orgRole string) (*models.Invitation, error) {
+	args := m.Called(ctx, inviterID, email, role, orgRole)
+	if invitation := args.Get(0); invitation != nil {
+		return invitation.(*models.Invitation), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ListInvitations Implement the methods of InvitationService
+func (m *MockInvitationService) ListInvitations(ctx context.Context) ([]models.Invitation, error) {
+	args := m.Called(ctx)
+	if invitations := args.Get(0); invitations != nil {
+		return invitations.([]models.Invitation), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ResendInvitation Implement the methods of InvitationService
+func (m *MockInvitationService) ResendInvitation(ctx context.Context, id uint) (*models.Invitation, error) {
+	args := m.Called(ctx, id)
+	if invitation := args.Get(0); invitation != nil {
+		return invitation.(*models.Invitation), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// RevokeInvitation Implement the methods of InvitationService
+func (m *MockInvitationService) RevokeInvitation(ctx context.Context, id uint) (*models.Invitation, error) {
+	args := m.Called(ctx, id)
+	if invitation := args.Get(0); invitation != nil {
+		return invitation.(*models.Invitation), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// GetPendingInvitation Implement the methods of InvitationService
+func (m *MockInvitationService) GetPendingInvitation(token string) (*models.Invitation, error) {
+	args := m.Called(token)
+	if invitation := args.Get(0); invitation != nil {
+		return invitation.(*models.Invitation), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// AcceptInvitation Implement the methods of InvitationService
+func (m *MockInvitationService) AcceptInvitation(token, username, password string) (*models.User, *models.Invitation, error) {
+	args := m.Called(token, username, password)
+	var user *models.User
+	if value := args.Get(0); value != nil {
+		user = value.(*models.User)
+	}
+	var invitation *models.Invitation
+	if value := args.Get(1); value != nil {
+		invitation = value.(*models.Invitation)
+	}
+	return user, invitation, args.Error(2)
+}
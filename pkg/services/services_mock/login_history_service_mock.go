@@ -0,0 +1,33 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockLoginHistoryService should implement the LoginHistoryService interface
+type MockLoginHistoryService struct {
+	mock.Mock
+}
+
+// Ensure that MockLoginHistoryService implements LoginHistoryServiceInterface
+var _ services.LoginHistoryServiceInterface = (*MockLoginHistoryService)(nil)
+
+// RecordLogin Implement the methods of LoginHistoryService
+func (m *MockLoginHistoryService) RecordLogin(username string, user *models.User, outcome, ip, userAgent string) (*models.LoginAttempt, error) {
+	args := m.Called(username, user, outcome, ip, userAgent)
+	if attempt := args.Get(0); attempt != nil {
+		return attempt.(*models.LoginAttempt), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ListLogins Implement the methods of LoginHistoryService
+func (m *MockLoginHistoryService) ListLogins(userID uint, limit int) ([]models.LoginAttempt, error) {
+	args := m.Called(userID, limit)
+	if logins := args.Get(0); logins != nil {
+		return logins.([]models.LoginAttempt), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
@@ -0,0 +1,30 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockMagicLinkService should implement the MagicLinkService interface
+type MockMagicLinkService struct {
+	mock.Mock
+}
+
+// Ensure that MockMagicLinkService implements MagicLinkServiceInterface
+var _ services.MagicLinkServiceInterface = (*MockMagicLinkService)(nil)
+
+// RequestLink Implement the methods of MagicLinkService
+func (m *MockMagicLinkService) RequestLink(identifier, ip, browserSecret string) (string, error) {
+	args := m.Called(identifier, ip, browserSecret)
+	return args.String(0), args.Error(1)
+}
+
+// ConsumeLink Implement the methods of MagicLinkService
+func (m *MockMagicLinkService) ConsumeLink(token, browserSecret string) (*models.User, error) {
+	args := m.Called(token, browserSecret)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
@@ -0,0 +1,149 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+// MockOIDCService should implement the OIDCService interface
+type MockOIDCService struct {
+	mock.Mock
+}
+
+// Ensure that MockOIDCService implements OIDCServiceInterface
+var _ services.OIDCServiceInterface = (*MockOIDCService)(nil)
+
+// RegisterClient Implement the methods of OIDCService
+func (m *MockOIDCService) RegisterClient(name string, redirectURIs []string, public bool, createdByID uint) (string, *models.OAuthClient, error) {
+	args := m.Called(name, redirectURIs, public, createdByID)
+	if client := args.Get(1); client != nil {
+		return args.String(0), client.(*models.OAuthClient), args.Error(2)
+	}
+	return args.String(0), nil, args.Error(2)
+}
+
+// ListClients Implement the methods of OIDCService
+func (m *MockOIDCService) ListClients() ([]models.OAuthClient, error) {
+	args := m.Called()
+	if clients := args.Get(0); clients != nil {
+		return clients.([]models.OAuthClient), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ValidateAuthorizationRequest Implement the methods of OIDCService
+func (m *MockOIDCService) ValidateAuthorizationRequest(request *services.AuthorizationRequest) (*models.OAuthClient, error) {
+	args := m.Called(request)
+	if client := args.Get(0); client != nil {
+		return client.(*models.OAuthClient), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// NeedsConsent Implement the methods of OIDCService
+func (m *MockOIDCService) NeedsConsent(userID uint, request *services.AuthorizationRequest) (bool, error) {
+	args := m.Called(userID, request)
+	return args.Bool(0), args.Error(1)
+}
+
+// ConsentToken Implement the methods of OIDCService
+func (m *MockOIDCService) ConsentToken(userID uint, request *services.AuthorizationRequest) string {
+	args := m.Called(userID, request)
+	return args.String(0)
+}
+
+// GrantConsent Implement the methods of OIDCService
+func (m *MockOIDCService) GrantConsent(userID uint, request *services.AuthorizationRequest, consentToken string) error {
+	args := m.Called(userID, request, consentToken)
+	return args.Error(0)
+}
+
+// CreateAuthorizationCode Implement the methods of OIDCService
+func (m *MockOIDCService) CreateAuthorizationCode(userID uint, authTime time.Time, request *services.AuthorizationRequest) (string, error) {
+	args := m.Called(userID, authTime, request)
+	return args.String(0), args.Error(1)
+}
+
+// Exchange Implement the methods of OIDCService
+func (m *MockOIDCService) Exchange(request *services.TokenRequest) (*services.TokenResponse, error) {
+	args := m.Called(request)
+	if response := args.Get(0); response != nil {
+		return response.(*services.TokenResponse), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// AuthorizeDevice Implement the methods of OIDCService
+func (m *MockOIDCService) AuthorizeDevice(request *services.DeviceAuthorizationRequest) (*services.DeviceAuthorizationResponse, error) {
+	args := m.Called(request)
+	if response := args.Get(0); response != nil {
+		return response.(*services.DeviceAuthorizationResponse), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// PendingDeviceAuthorization Implement the methods of OIDCService
+func (m *MockOIDCService) PendingDeviceAuthorization(userID uint, userCode string) (*models.OAuthDeviceAuthorization, *models.OAuthClient, error) {
+	args := m.Called(userID, userCode)
+	var authorization *models.OAuthDeviceAuthorization
+	if value := args.Get(0); value != nil {
+		authorization = value.(*models.OAuthDeviceAuthorization)
+	}
+	var client *models.OAuthClient
+	if value := args.Get(1); value != nil {
+		client = value.(*models.OAuthClient)
+	}
+	return authorization, client, args.Error(2)
+}
+
+// DeviceConsentToken Implement the methods of OIDCService
+func (m *MockOIDCService) DeviceConsentToken(userID uint, userCode string) string {
+	args := m.Called(userID, userCode)
+	return args.String(0)
+}
+
+// DecideDeviceAuthorization Implement the methods of OIDCService
+func (m *MockOIDCService) DecideDeviceAuthorization(userID uint, userCode string, allow bool, consentToken string) (*models.OAuthDeviceAuthorization, error) {
+	args := m.Called(userID, userCode, allow, consentToken)
+	if authorization := args.Get(0); authorization != nil {
+		return authorization.(*models.OAuthDeviceAuthorization), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// PollDeviceAuthorization Implement the methods of OIDCService
+func (m *MockOIDCService) PollDeviceAuthorization(request *services.TokenRequest) (*models.User, *services.TokenResponse, error) {
+	args := m.Called(request)
+	var user *models.User
+	if value := args.Get(0); value != nil {
+		user = value.(*models.User)
+	}
+	var tokens *services.TokenResponse
+	if value := args.Get(1); value != nil {
+		tokens = value.(*services.TokenResponse)
+	}
+	return user, tokens, args.Error(2)
+}
+
+// UserInfo Implement the methods of OIDCService
+func (m *MockOIDCService) UserInfo(accessToken string) (map[string]interface{}, error) {
+	args := m.Called(accessToken)
+	if info := args.Get(0); info != nil {
+		return info.(map[string]interface{}), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// Discovery Implement the methods of OIDCService
+func (m *MockOIDCService) Discovery() map[string]interface{} {
+	args := m.Called()
+	return args.Get(0).(map[string]interface{})
+}
+
+// JWKS Implement the methods of OIDCService
+func (m *MockOIDCService) JWKS() map[string]interface{} {
+	args := m.Called()
+	return args.Get(0).(map[string]interface{})
+}
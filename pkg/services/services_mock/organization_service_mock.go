@@ -0,0 +1,88 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"context"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockOrganizationService should implement the OrganizationService interface
+type MockOrganizationService struct {
+	mock.Mock
+}
+
+// Ensure that MockOrganizationService implements OrganizationServiceInterface
+var _ services.OrganizationServiceInterface = (*MockOrganizationService)(nil)
+
+// CreateOrganization Implement the methods of OrganizationService
+func (m *MockOrganizationService) CreateOrganization(owner *models.User, name, slug string) (*models.Membership, error) {
+	args := m.Called(owner, name, slug)
+	if membership := args.Get(0); membership != nil {
+		return membership.(*models.Membership), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ListMemberships Implement the methods of OrganizationService
+func (m *MockOrganizationService) ListMemberships(userID uint) ([]models.Membership, error) {
+	args := m.Called(userID)
+	if memberships := args.Get(0); memberships != nil {
+		return memberships.([]models.Membership), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ResolveTenant Implement the methods of OrganizationService
+func (m *MockOrganizationService) ResolveTenant(userID, organizationID uint, fallback bool) (*models.Membership, error) {
+	args := m.Called(userID, organizationID, fallback)
+	if membership := args.Get(0); membership != nil {
+		return membership.(*models.Membership), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// SwitchOrganization Implement the methods of OrganizationService
+func (m *MockOrganizationService) SwitchOrganization(userID, organizationID uint) (*models.User, *models.Membership, error) {
+	args := m.Called(userID, organizationID)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Get(1).(*models.Membership), args.Error(2)
+	}
+	return nil, nil, args.Error(2)
+}
+
+// ListMembers Implement the methods of OrganizationService
+func (m *MockOrganizationService) ListMembers(ctx context.Context) ([]models.Membership, error) {
+	args := m.Called(ctx)
+	if members := args.Get(0); members != nil {
+		return members.([]models.Membership), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// AddMember Implement the methods of OrganizationService
+func (m *MockOrganizationService) AddMember(ctx context.Context, actor *models.Membership, username, role string) (*models.Membership, error) {
+	args := m.Called(ctx, actor, username, role)
+	if membership := args.Get(0); membership != nil {
+		return membership.(*models.Membership), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// SetMemberRole Implement the methods of OrganizationService
+func (m *MockOrganizationService) SetMemberRole(ctx context.Context, actor *models.Membership, userID uint, role string) (*models.Membership, string, error) {
+	args := m.Called(ctx, actor, userID, role)
+	if membership := args.Get(0); membership != nil {
+		return membership.(*models.Membership), args.String(1), args.Error(2)
+	}
+	return nil, args.String(1), args.Error(2)
+}
+
+// RemoveMember Implement the methods of OrganizationService
+func (m *MockOrganizationService) RemoveMember(ctx context.Context, actor *models.Membership, userID uint) (*models.Membership, error) {
+	args := m.Called(ctx, actor, userID)
+	if membership := args.Get(0); membership != nil {
+		return membership.(*models.Membership), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
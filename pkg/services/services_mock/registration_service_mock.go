@@ -0,0 +1,72 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockRegistrationService should implement the RegistrationService interface
+type MockRegistrationService struct {
+	mock.Mock
+}
+
+// Ensure that MockRegistrationService implements RegistrationServiceInterface
+var _ services.RegistrationServiceInterface = (*MockRegistrationService)(nil)
+
+// Policy Implement the methods of RegistrationService
+func (m *MockRegistrationService) Policy() services.RegistrationPolicy {
+	args := m.Called()
+	return args.Get(0).(services.RegistrationPolicy)
+}
+
+// Register Implement the methods of RegistrationService
+func (m *MockRegistrationService) Register(username, password, email string) (*models.User, error) {
+	args := m.Called(username, password, email)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// SendVerification Implement the methods of RegistrationService
+func (m *MockRegistrationService) SendVerification(user *models.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+// VerifyEmail Implement the methods of RegistrationService
+func (m *MockRegistrationService) VerifyEmail(token string) (*models.User, error) {
+	args := m.Called(token)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ListPendingUsers Implement the methods of RegistrationService
+func (m *MockRegistrationService) ListPendingUsers() ([]models.User, error) {
+	args := m.Called()
+	if users := args.Get(0); users != nil {
+		return users.([]models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ApproveUser Implement the methods of RegistrationService
+func (m *MockRegistrationService) ApproveUser(userID uint) (*models.User, error) {
+	args := m.Called(userID)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// RejectUser Implement the methods of RegistrationService
+func (m *MockRegistrationService) RejectUser(userID uint) (*models.User, error) {
+	args := m.Called(userID)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
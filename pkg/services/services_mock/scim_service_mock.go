@@ -0,0 +1,117 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"context"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockSCIMService should implement the SCIMService interface
+type MockSCIMService struct {
+	mock.Mock
+}
+
+// Ensure that MockSCIMService implements SCIMServiceInterface
+var _ services.SCIMServiceInterface = (*MockSCIMService)(nil)
+
+// CreateUser Implement the methods of SCIMService
+func (m *MockSCIMService) CreateUser(ctx context.Context, resource *services.SCIMUser) (*services.SCIMUser, error) {
+	args := m.Called(ctx, resource)
+	if result := args.Get(0); result != nil {
+		return result.(*services.SCIMUser), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// GetUser Implement the methods of SCIMService
+func (m *MockSCIMService) GetUser(ctx context.Context, id string) (*services.SCIMUser, error) {
+	args := m.Called(ctx, id)
+	if result := args.Get(0); result != nil {
+		return result.(*services.SCIMUser), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ListUsers Implement the methods of SCIMService
+func (m *MockSCIMService) ListUsers(ctx context.Context, query services.SCIMListQuery) (*services.SCIMListResponse, error) {
+	args := m.Called(ctx, query)
+	if result := args.Get(0); result != nil {
+		return result.(*services.SCIMListResponse), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ReplaceUser Implement the methods of SCIMService
+func (m *MockSCIMService) ReplaceUser(ctx context.Context, id string, resource *services.SCIMUser) (*services.SCIMUser, error) {
+	args := m.Called(ctx, id, resource)
+	if result := args.Get(0); result != nil {
+		return result.(*services.SCIMUser), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// PatchUser Implement the methods of SCIMService
+func (m *MockSCIMService) PatchUser(ctx context.Context, id string, patch *services.SCIMPatchRequest) (*services.SCIMUser, error) {
+	args := m.Called(ctx, id, patch)
+	if result := args.Get(0); result != nil {
+		return result.(*services.SCIMUser), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// DeleteUser Implement the methods of SCIMService
+func (m *MockSCIMService) DeleteUser(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// CreateGroup Implement the methods of SCIMService
+func (m *MockSCIMService) CreateGroup(ctx context.Context, resource *services.SCIMGroup) (*services.SCIMGroup, error) {
+	args := m.Called(ctx, resource)
+	if result := args.Get(0); result != nil {
+		return result.(*services.SCIMGroup), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// GetGroup Implement the methods of SCIMService
+func (m *MockSCIMService) GetGroup(ctx context.Context, id string) (*services.SCIMGroup, error) {
+	args := m.Called(ctx, id)
+	if result := args.Get(0); result != nil {
+		return result.(*services.SCIMGroup), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ListGroups Implement the methods of SCIMService
+func (m *MockSCIMService) ListGroups(ctx context.Context, query services.SCIMListQuery) (*services.SCIMListResponse, error) {
+	args := m.Called(ctx, query)
+	if result := args.Get(0); result != nil {
+		return result.(*services.SCIMListResponse), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ReplaceGroup Implement the methods of SCIMService
+func (m *MockSCIMService) ReplaceGroup(ctx context.Context, id string, resource *services.SCIMGroup) (*services.SCIMGroup, error) {
+	args := m.Called(ctx, id, resource)
+	if result := args.Get(0); result != nil {
+		return result.(*services.SCIMGroup), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// PatchGroup Implement the methods of SCIMService
+func (m *MockSCIMService) PatchGroup(ctx context.Context, id string, patch *services.SCIMPatchRequest) (*services.SCIMGroup, error) {
+	args := m.Called(ctx, id, patch)
+	if result := args.Get(0); result != nil {
+		return result.(*services.SCIMGroup), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// DeleteGroup Implement the methods of SCIMService
+func (m *MockSCIMService) DeleteGroup(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
@@ -0,0 +1,54 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockSessionService should implement the SessionService interface
+type MockSessionService struct {
+	mock.Mock
+}
+
+// Ensure that MockSessionService implements SessionServiceInterface
+var _ services.SessionServiceInterface = (*MockSessionService)(nil)
+
+// StartSession Implement the methods of SessionService
+func (m *MockSessionService) StartSession(userID uint, userAgent, ip string) (*models.Session, error) {
+	args := m.Called(userID, userAgent, ip)
+	if session := args.Get(0); session != nil {
+		return session.(*models.Session), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// CheckSession Implement the methods of SessionService
+func (m *MockSessionService) CheckSession(userID, sessionID uint, ip string) (*models.Session, error) {
+	args := m.Called(userID, sessionID, ip)
+	if session := args.Get(0); session != nil {
+		return session.(*models.Session), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ListSessions Implement the methods of SessionService
+func (m *MockSessionService) ListSessions(userID uint) ([]models.Session, error) {
+	args := m.Called(userID)
+	if sessions := args.Get(0); sessions != nil {
+		return sessions.([]models.Session), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// RevokeSession Implement the methods of SessionService
+func (m *MockSessionService) RevokeSession(userID, sessionID uint) error {
+	args := m.Called(userID, sessionID)
+	return args.Error(0)
+}
+
+// RevokeSessions Implement the methods of SessionService
+func (m *MockSessionService) RevokeSessions(userID, exceptID uint) (int64, error) {
+	args := m.Called(userID, exceptID)
+	return args.Get(0).(int64), args.Error(1)
+}
@@ -0,0 +1,33 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockUserLifecycleService should implement the UserLifecycleService interface
+type MockUserLifecycleService struct {
+	mock.Mock
+}
+
+// Ensure that MockUserLifecycleService implements UserLifecycleServiceInterface
+var _ services.UserLifecycleServiceInterface = (*MockUserLifecycleService)(nil)
+
+// Transition Implement the methods of UserLifecycleService
+func (m *MockUserLifecycleService) Transition(actorID, userID uint, status, reason string) (*models.User, string, error) {
+	args := m.Called(actorID, userID, status, reason)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.String(1), args.Error(2)
+	}
+	return nil, args.String(1), args.Error(2)
+}
+
+// CheckUser Implement the methods of UserLifecycleService
+func (m *MockUserLifecycleService) CheckUser(userID uint) (*models.User, error) {
+	args := m.Called(userID)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
@@ -3,6 +3,7 @@ package services_mock
 import (
 	"BuildasTechnicalAssessmentGo/pkg/models"
 	"BuildasTechnicalAssessmentGo/pkg/services"
+	"context"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -23,15 +24,33 @@ func (m *MockUserService) GetUserByUsername(username string) (*models.User, erro
 	return nil, args.Error(1)
 }
 
+// GetUserByID Implement the methods of UserService
+func (m *MockUserService) GetUserByID(id uint) (*models.User, error) {
+	args := m.Called(id)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 // RegisterUser Implement the methods of UserService
 func (m *MockUserService) RegisterUser(username, password string) error {
 	args := m.Called(username, password)
 	return args.Error(0)
 }
 
+// CreateAccount Implement the methods of UserService
+func (m *MockUserService) CreateAccount(username, password, email, status string) (*models.User, error) {
+	args := m.Called(username, password, email, status)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 // GetAllUsers Implement the methods of UserService
-func (m *MockUserService) GetAllUsers() ([]models.User, error) {
-	args := m.Called()
+func (m *MockUserService) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	args := m.Called(ctx)
 	if users := args.Get(0); users != nil {
 		return users.([]models.User), args.Error(1)
 	}
@@ -39,7 +58,28 @@ func (m *MockUserService) GetAllUsers() ([]models.User, error) {
 }
 
 // CheckPassword Implement the methods of UserService
-func (m *MockUserService) CheckPassword(hashedPassword, password string) error {
-	args := m.Called(hashedPassword, password)
+func (m *MockUserService) CheckPassword(user *models.User, password string) error {
+	args := m.Called(user, password)
+	return args.Error(0)
+}
+
+// ProvisionUser Implement the methods of UserService
+func (m *MockUserService) ProvisionUser(username, role string) (*models.User, error) {
+	args := m.Called(username, role)
+	if user := args.Get(0); user != nil {
+		return user.(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// SetPassword Implement the methods of UserService
+func (m *MockUserService) SetPassword(user *models.User, password string) error {
+	args := m.Called(user, password)
+	return args.Error(0)
+}
+
+// ChangeUsername Implement the methods of UserService
+func (m *MockUserService) ChangeUsername(user *models.User, username string) error {
+	args := m.Called(user, username)
 	return args.Error(0)
 }
@@ -0,0 +1,75 @@
+package services_mock
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockWebAuthnService should implement the WebAuthnService interface
+type MockWebAuthnService struct {
+	mock.Mock
+}
+
+// Ensure that MockWebAuthnService implements WebAuthnServiceInterface
+var _ services.WebAuthnServiceInterface = (*MockWebAuthnService)(nil)
+
+// BeginRegistration Implement the methods of WebAuthnService
+func (m *MockWebAuthnService) BeginRegistration(userID uint) (*services.CredentialCreationOptions, error) {
+	args := m.Called(userID)
+	if options := args.Get(0); options != nil {
+		return options.(*services.CredentialCreationOptions), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// FinishRegistration Implement the methods of WebAuthnService
+func (m *MockWebAuthnService) FinishRegistration(userID uint, name string, credential *services.PublicKeyCredential) (*models.WebAuthnCredential, error) {
+	args := m.Called(userID, name, credential)
+	if created := args.Get(0); created != nil {
+		return created.(*models.WebAuthnCredential), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// BeginLogin Implement the methods of WebAuthnService
+func (m *MockWebAuthnService) BeginLogin() (*services.CredentialRequestOptions, error) {
+	args := m.Called()
+	if options := args.Get(0); options != nil {
+		return options.(*services.CredentialRequestOptions), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// BeginSecondFactor Implement the methods of WebAuthnService
+func (m *MockWebAuthnService) BeginSecondFactor(user *models.User, next string) (*services.CredentialRequestOptions, error) {
+	args := m.Called(user, next)
+	if options := args.Get(0); options != nil {
+		return options.(*services.CredentialRequestOptions), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// FinishLogin Implement the methods of WebAuthnService
+func (m *MockWebAuthnService) FinishLogin(credential *services.PublicKeyCredential) (*services.WebAuthnLogin, error) {
+	args := m.Called(credential)
+	if login := args.Get(0); login != nil {
+		return login.(*services.WebAuthnLogin), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// ListCredentials Implement the methods of WebAuthnService
+func (m *MockWebAuthnService) ListCredentials(userID uint) ([]models.WebAuthnCredential, error) {
+	args := m.Called(userID)
+	if credentials := args.Get(0); credentials != nil {
+		return credentials.([]models.WebAuthnCredential), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// RemoveCredential Implement the methods of WebAuthnService
+func (m *MockWebAuthnService) RemoveCredential(userID, id uint) error {
+	args := m.Called(userID, id)
+	return args.Error(0)
+}
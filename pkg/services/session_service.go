@@ -0,0 +1,157 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// maxUserAgentLength is the longest user agent stored with a session
+const maxUserAgentLength = 512
+
+// sessionActivityInterval is how often the last activity of a session is
+// saved, so busy sessions do not write on every request
+const sessionActivityInterval = time.Minute
+
+// ErrSessionMissing is returned when a user has no such active session
+var ErrSessionMissing = errors.New("session not found")
+
+// SessionServiceInterface defines the interface for the SessionService
+type SessionServiceInterface interface {
+	StartSession(userID uint, userAgent, ip string) (*models.Session, error)
+	CheckSession(userID, sessionID uint, ip string) (*models.Session, error)
+	ListSessions(userID uint) ([]models.Session, error)
+	RevokeSession(userID, sessionID uint) error
+	RevokeSessions(userID, exceptID uint) (int64, error)
+}
+
+// SessionService records the sessions of users, so they can see where they
+// are logged in and log out any of them
+type SessionService struct {
+	Repo repository.SessionRepository
+	// Lifetime is how long a session lasts, the lifetime of its JWT
+	Lifetime time.Duration
+	Now      func() time.Time
+}
+
+// NewSessionService creates a new SessionService
+func NewSessionService(repo repository.SessionRepository) *SessionService {
+	return &SessionService{Repo: repo, Lifetime: SessionLifetime, Now: time.Now}
+}
+
+// StartSession records a new session of a user, logging in from a device
+// with the given user agent and IP
+func (s *SessionService) StartSession(userID uint, userAgent, ip string) (*models.Session, error) {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	now := s.Now()
+	session := &models.Session{
+		CreatedAt:  now,
+		UserID:     userID,
+		Device:     DescribeDevice(userAgent),
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.Lifetime),
+	}
+	if err := s.Repo.CreateSession(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// CheckSession returns a session of a user if it is still active, or
+// ErrSessionRevoked.
+//
+// The time and IP of the request are saved, at most once a minute per
+// session unless the IP changes. Failing to save them does not fail the
+// check.
+func (s *SessionService) CheckSession(userID, sessionID uint, ip string) (*models.Session, error) {
+	session, err := s.Repo.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.Now()
+	if session == nil || session.UserID != userID || !session.Active(now) {
+		return nil, ErrSessionRevoked
+	}
+
+	if now.Sub(session.LastSeenAt) >= sessionActivityInterval || session.IP != ip {
+		if err := s.Repo.UpdateSessionActivity(session.ID, now, ip); err != nil {
+			log.Printf("Failed to record activity of session %d: %v", session.ID, err)
+		}
+		session.LastSeenAt, session.IP = now, ip
+	}
+	return session, nil
+}
+
+// ListSessions uses the repository to fetch the active sessions of a user
+func (s *SessionService) ListSessions(userID uint) ([]models.Session, error) {
+	return s.Repo.ListActiveSessions(userID, s.Now())
+}
+
+// RevokeSession revokes a session of a user, or returns ErrSessionMissing
+// if the user has no such active session
+func (s *SessionService) RevokeSession(userID, sessionID uint) error {
+	revoked, err := s.Repo.RevokeSession(userID, sessionID, s.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrSessionMissing
+	}
+	return nil
+}
+
+// RevokeSessions revokes every session of a user but the one with the ID
+// exceptID, if not zero, and returns how many were revoked
+func (s *SessionService) RevokeSessions(userID, exceptID uint) (int64, error) {
+	return s.Repo.RevokeUserSessions(userID, exceptID, s.Now())
+}
+
+// userAgentBrowsers and userAgentSystems map the tokens found in user agents
+// to the names shown to users, in the order they are looked for: Edge and
+// Opera claim to be Chrome, and Chrome claims to be Safari
+var (
+	userAgentBrowsers = [][2]string{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"},
+		{"Safari/", "Safari"}, {"curl/", "curl"},
+	}
+	userAgentSystems = [][2]string{
+		{"iPhone", "iOS"}, {"iPad", "iPadOS"}, {"Android", "Android"}, {"Windows", "Windows"},
+		{"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+	}
+)
+
+// DescribeDevice returns a short description of the browser and system of
+// a user agent, such as "Firefox on Linux", to tell sessions apart
+func DescribeDevice(userAgent string) string {
+	browser, system := "", ""
+	for _, candidate := range userAgentBrowsers {
+		if strings.Contains(userAgent, candidate[0]) {
+			browser = candidate[1]
+			break
+		}
+	}
+	for _, candidate := range userAgentSystems {
+		if strings.Contains(userAgent, candidate[0]) {
+			system = candidate[1]
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return "Browser on " + system
+	default:
+		return "Unknown device"
+	}
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Errors returned by the token services
+var (
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrTokenExpired       = errors.New("the token has expired")
+	ErrUnknownTokenFormat = errors.New("unknown token format")
+)
+
+// Names of the token formats, as set in TOKEN_FORMAT
+const (
+	TokenFormatJWT          = "jwt"
+	TokenFormatPASETOLocal  = "v4.local"
+	TokenFormatPASETOPublic = "v4.public"
+)
+
+// Defaults of the token services
+const (
+	// SessionLifetime is how long the token of a session is valid
+	SessionLifetime = 24 * time.Hour
+	// ImpersonationLifetime is how long the token of an impersonation is
+	// valid
+	ImpersonationLifetime = time.Hour
+	// DefaultTokenIssuer and DefaultTokenAudience name the application in
+	// the tokens it issues for itself
+	DefaultTokenIssuer   = "http://localhost:8080"
+	DefaultTokenAudience = "buildas-sessions"
+	// DefaultClockSkew is the difference tolerated between the clocks of
+	// the servers issuing and verifying tokens
+	DefaultClockSkew = time.Minute
+)
+
+// defaultTokenKey signs the tokens of DefaultTokenService
+var defaultTokenKey = []byte("your_secret_key")
+
+// TokenService issues the session tokens of the users, and verifies them.
+//
+// Issue fills in the issuer, audience, ID and issue time of the claims, and
+// their expiry if not set, and returns the signed token. Verify checks the
+// signature of a token, that it was issued by and for this application,
+// and that it is valid at the current time within the clock skew. It
+// returns the claims, or an error wrapping ErrInvalidToken, or
+// ErrTokenExpired.
+type TokenService interface {
+	Issue(claims *models.Claims) (string, error)
+	Verify(token string) (*models.Claims, error)
+}
+
+// TokenFormat encodes the claims of session tokens, and decodes them back
+// once the token checks out with one of its keys. The validity of the
+// claims is checked by the SessionTokenService.
+//
+// Formats are given their secrets newest first: tokens are issued with the
+// first, and checked with any of them, so secrets can be rotated without
+// logging everyone out. Tokens name the key they were issued with.
+type TokenFormat interface {
+	// Name returns the name of the format, such as TokenFormatJWT
+	Name() string
+	// Detect reports whether the token is in this format, from its header
+	Detect(token string) bool
+	Seal(claims *models.Claims) (string, error)
+	// Open returns the claims of a token, or an error wrapping
+	// ErrInvalidToken
+	Open(token string) (*models.Claims, error)
+}
+
+// NewTokenFormat returns the format with the name, with the secrets newest
+// first
+func NewTokenFormat(name string, secrets ...[]byte) (TokenFormat, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("a token format needs a secret")
+	}
+	switch name {
+	case TokenFormatJWT:
+		return NewJWTFormat(secrets...), nil
+	case TokenFormatPASETOLocal:
+		return NewPASETOLocalFormat(secrets...), nil
+	case TokenFormatPASETOPublic:
+		return NewPASETOPublicFormat(secrets...), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownTokenFormat, name)
+}
+
+// tokenKey is a key of a token format, with the ID tokens name it by
+type tokenKey struct {
+	ID  string
+	Key []byte
+}
+
+// tokenKeyID returns the ID tokens name a key by: a short hash of the key,
+// or of its public part
+func tokenKeyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("token-key:"), key...))
+	return base64.RawURLEncoding.EncodeToString(sum[:9])
+}
+
+// deriveTokenKey derives the key of a format from a secret, so each format
+// has its own key even when given the same secrets
+func deriveTokenKey(purpose string, secret []byte) []byte {
+	sum := sha256.Sum256(append([]byte(purpose+":"), secret...))
+	return sum[:]
+}
+
+// SessionTokenService issues session tokens in a TokenFormat, and verifies
+// the tokens of the formats it accepts, detected from their header.
+type SessionTokenService struct {
+	// Format issues the tokens
+	Format TokenFormat
+	// Formats are the other formats accepted, such as the one used before
+	// switching to Format
+	Formats  []TokenFormat
+	Issuer   string
+	Audience string
+	// Lifetime is the validity of the tokens issued without an expiry
+	Lifetime time.Duration
+	// ClockSkew is tolerated when checking the times of a token
+	ClockSkew time.Duration
+	Now       func() time.Time
+}
+
+// NewSessionTokenService creates a new SessionTokenService issuing tokens
+// in the format, valid for SessionLifetime, and accepting the other formats
+func NewSessionTokenService(format TokenFormat, issuer, audience string, accepted ...TokenFormat) *SessionTokenService {
+	return &SessionTokenService{
+		Format:    format,
+		Formats:   accepted,
+		Issuer:    issuer,
+		Audience:  audience,
+		Lifetime:  SessionLifetime,
+		ClockSkew: DefaultClockSkew,
+		Now:       time.Now,
+	}
+}
+
+// Issue seals the claims, see TokenService
+func (s *SessionTokenService) Issue(claims *models.Claims) (string, error) {
+	issued, err := prepareClaims(claims, s.Issuer, s.Audience, s.Lifetime, s.Now())
+	if err != nil {
+		return "", err
+	}
+	return s.Format.Seal(issued)
+}
+
+// Verify opens a token in any accepted format and checks its claims, see
+// TokenService
+func (s *SessionTokenService) Verify(token string) (*models.Claims, error) {
+	for _, format := range append([]TokenFormat{s.Format}, s.Formats...) {
+		if !format.Detect(token) {
+			continue
+		}
+		claims, err := format.Open(token)
+		if err != nil {
+			return nil, err
+		}
+		claims.OrganizationRole = ""
+		if err := checkClaims(claims, s.Issuer, s.Audience, s.ClockSkew, s.Now()); err != nil {
+			return nil, err
+		}
+		return claims, nil
+	}
+	return nil, fmt.Errorf("%w: not in an accepted format", ErrInvalidToken)
+}
+
+// defaultTokenService is returned by DefaultTokenService
+var defaultTokenService = NewSessionTokenService(NewJWTFormat(defaultTokenKey), DefaultTokenIssuer, DefaultTokenAudience)
+
+// DefaultTokenService returns the token service of the tests: HS256 JWTs
+// with the default issuer and audience, signed with a well-known key. It is
+// never used unless given to middlewares.TokenMiddleware.
+func DefaultTokenService() TokenService {
+	return defaultTokenService
+}
+
+// NewSessionClaims returns the claims of the session of a user, with the
+// given ID, carried by "sid". Zero leaves the token without a session, for
+// setups that do not track them. The organization the user last switched
+// to, if any, is the active one of the session.
+func NewSessionClaims(user *models.User, sessionID uint) *models.Claims {
+	claims := &models.Claims{
+		Subject:        strconv.FormatUint(uint64(user.ID), 10),
+		Username:       user.Username,
+		Roles:          []string{user.Role},
+		SessionID:      sessionID,
+		SessionVersion: user.SessionVersion,
+	}
+	if user.ActiveOrganizationID != nil {
+		claims.OrganizationID = *user.ActiveOrganizationID
+	}
+	return claims
+}
+
+// NewDeviceClaims returns the claims of a session a device signed in to
+// through the OAuth client with the device authorization grant. They are
+// those of the user, limited to the approved scope.
+func NewDeviceClaims(user *models.User, sessionID uint, clientID, scope string) *models.Claims {
+	claims := NewSessionClaims(user, sessionID)
+	claims.ClientID = clientID
+	claims.Scope = scope
+	return claims
+}
+
+// NewImpersonationClaims returns the claims logging the actor in as the
+// target user. They are those of the target, so the application behaves as
+// it does for them, without a session of their own, and carry the actor in
+// "act". They are valid for ImpersonationLifetime.
+func NewImpersonationClaims(target *models.User, actor *models.Actor) *models.Claims {
+	claims := NewSessionClaims(target, 0)
+	claims.Actor = actor
+	claims.ExpiresAt = time.Now().Add(ImpersonationLifetime)
+	return claims
+}
+
+// prepareClaims returns a copy of the claims to issue, with the registered
+// claims set
+func prepareClaims(claims *models.Claims, issuer, audience string, lifetime time.Duration, now time.Time) (*models.Claims, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	issued := *claims
+	issued.Issuer = issuer
+	issued.Audience = []string{audience}
+	issued.ID = id
+	issued.IssuedAt = now.Truncate(time.Second)
+	issued.NotBefore = time.Time{}
+	if issued.ExpiresAt.IsZero() {
+		issued.ExpiresAt = now.Add(lifetime)
+	}
+	issued.ExpiresAt = issued.ExpiresAt.Truncate(time.Second)
+	return &issued, nil
+}
+
+// checkClaims checks the registered claims of a token whose signature was
+// verified: that it was issued by and for this application to a user, and
+// that it is valid at the time, within the clock skew
+func checkClaims(claims *models.Claims, issuer, audience string, skew time.Duration, now time.Time) error {
+	switch {
+	case claims.Issuer != issuer:
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	case !containsString(claims.Audience, audience):
+		return fmt.Errorf("%w: not meant for %q", ErrInvalidToken, audience)
+	case claims.UserID() == 0:
+		return fmt.Errorf("%w: invalid subject %q", ErrInvalidToken, claims.Subject)
+	case claims.Actor != nil && claims.Actor.UserID() == 0:
+		return fmt.Errorf("%w: invalid actor %q", ErrInvalidToken, claims.Actor.Subject)
+	case claims.ExpiresAt.IsZero():
+		return fmt.Errorf("%w: no expiry", ErrInvalidToken)
+	case !now.Before(claims.ExpiresAt.Add(skew)):
+		return ErrTokenExpired
+	case !claims.NotBefore.IsZero() && now.Add(skew).Before(claims.NotBefore):
+		return fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	case !claims.IssuedAt.IsZero() && now.Add(skew).Before(claims.IssuedAt):
+		return fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxStatusReasonLength is the longest reason a status change can be given
+const maxStatusReasonLength = 500
+
+// userTransitions lists the statuses each account status can change to.
+// Reactivating a suspended, locked or deactivated account makes it active
+// again; pending and unverified accounts become active when they are
+// approved or verified.
+var userTransitions = map[string][]string{
+	models.UserStatusPending:     {models.UserStatusActive, models.UserStatusDeactivated},
+	models.UserStatusUnverified:  {models.UserStatusActive, models.UserStatusDeactivated},
+	models.UserStatusActive:      {models.UserStatusSuspended, models.UserStatusLocked, models.UserStatusDeactivated},
+	models.UserStatusSuspended:   {models.UserStatusActive, models.UserStatusDeactivated},
+	models.UserStatusLocked:      {models.UserStatusActive, models.UserStatusSuspended, models.UserStatusDeactivated},
+	models.UserStatusDeactivated: {models.UserStatusActive},
+}
+
+// reasonRequired lists the statuses an account cannot be moved to without
+// a reason, so its owner and other admins know why it was blocked
+var reasonRequired = map[string]bool{
+	models.UserStatusSuspended:   true,
+	models.UserStatusLocked:      true,
+	models.UserStatusDeactivated: true,
+}
+
+// Errors returned by the UserLifecycleService
+var (
+	ErrUnknownStatus        = errors.New("unknown account status")
+	ErrIllegalTransition    = errors.New("the account cannot change to this status")
+	ErrStatusReasonRequired = errors.New("a reason is required to block an account")
+	ErrStatusReasonTooLong  = fmt.Errorf("the reason cannot be longer than %d characters", maxStatusReasonLength)
+	ErrOwnStatus            = errors.New("you cannot change the status of your own account")
+)
+
+// UserLifecycleServiceInterface defines the interface for the
+// UserLifecycleService
+type UserLifecycleServiceInterface interface {
+	Transition(actorID, userID uint, status, reason string) (*models.User, string, error)
+	CheckUser(userID uint) (*models.User, error)
+}
+
+// UserLifecycleService moves accounts between their statuses, enforcing the
+// legal transitions, and checks that the user of a session may still use
+// their account
+type UserLifecycleService struct {
+	Repo repository.UserRepository
+	Now  func() time.Time
+}
+
+// NewUserLifecycleService creates a new UserLifecycleService
+func NewUserLifecycleService(repo repository.UserRepository) *UserLifecycleService {
+	return &UserLifecycleService{Repo: repo, Now: time.Now}
+}
+
+// Transition changes the status of a user on behalf of an admin.
+//
+// The change must be one of the legal transitions, or it fails with
+// ErrIllegalTransition; suspending, locking and deactivating an account
+// need a reason. Admins cannot change their own status. Deactivated users
+// get their deactivation time set, and lose it when reactivated. It returns
+// the user with their previous status, so the change can be audited, or
+// ErrUserNotFound. If another request changed the status first, it fails
+// with ErrIllegalTransition.
+func (s *UserLifecycleService) Transition(actorID, userID uint, status, reason string) (*models.User, string, error) {
+	if !containsString(models.UserStatuses, status) {
+		return nil, "", ErrUnknownStatus
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" && reasonRequired[status] {
+		return nil, "", ErrStatusReasonRequired
+	}
+	if utf8.RuneCountInString(reason) > maxStatusReasonLength {
+		return nil, "", ErrStatusReasonTooLong
+	}
+	if actorID == userID {
+		return nil, "", ErrOwnStatus
+	}
+
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if user == nil {
+		return nil, "", ErrUserNotFound
+	}
+	stored, previous := user.Status, user.Status
+	if previous == "" {
+		previous = models.UserStatusActive
+	}
+	if !containsString(userTransitions[previous], status) {
+		return nil, "", fmt.Errorf("%w: %s accounts cannot become %s", ErrIllegalTransition, previous, status)
+	}
+
+	now := s.Now()
+	user.Status, user.StatusReason, user.StatusChangedAt = status, reason, &now
+	user.DeactivatedAt = nil
+	if status == models.UserStatusDeactivated {
+		user.DeactivatedAt = &now
+	}
+	changed, err := s.Repo.SetUserStatus(user, stored)
+	if err != nil {
+		return nil, "", err
+	}
+	if !changed {
+		return nil, "", fmt.Errorf("%w: the account status changed in the meantime", ErrIllegalTransition)
+	}
+	return user, previous, nil
+}
+
+// CheckUser returns the user of a session or token if they may still use
+// their account, so blocking an account ends its sessions at once.
+// Otherwise it returns ErrUserNotFound for deleted users, or the error of
+// AccountStatusError.
+func (s *UserLifecycleService) CheckUser(userID uint) (*models.User, error) {
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if err := AccountStatusError(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
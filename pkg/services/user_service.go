@@ -3,21 +3,48 @@ package services
 import (
 	"BuildasTechnicalAssessmentGo/internal/repository"
 	"BuildasTechnicalAssessmentGo/pkg/models"
+	"context"
 	"errors"
-	"golang.org/x/crypto/bcrypt"
+	"log"
+	"strings"
 )
 
 // UserServiceInterface defines the interface for the UserService
 type UserServiceInterface interface {
 	RegisterUser(username, password string) error
+	CreateAccount(username, password, email, status string) (*models.User, error)
 	GetUserByUsername(username string) (*models.User, error)
-	CheckPassword(hashedPassword, plainPassword string) error
-	GetAllUsers() ([]models.User, error)
+	GetUserByID(id uint) (*models.User, error)
+	CheckPassword(user *models.User, plainPassword string) error
+	GetAllUsers(ctx context.Context) ([]models.User, error)
+	ProvisionUser(username, role string) (*models.User, error)
+	SetPassword(user *models.User, password string) error
+	ChangeUsername(user *models.User, username string) error
 }
 
+// Errors returned by the UserService
+var (
+	ErrUserExists         = errors.New("user already exists")
+	ErrUsernameConfusable = errors.New("username is too similar to an existing user")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserDeactivated    = errors.New("this account has been deactivated")
+	ErrAccountPending     = errors.New("this account is awaiting approval by an administrator")
+	ErrEmailUnverified    = errors.New("please verify your email address first, we sent you a link")
+	ErrAccountSuspended   = errors.New("this account has been suspended, contact an administrator")
+	ErrAccountLocked      = errors.New("this account has been locked for your protection, contact an administrator")
+)
+
 // UserService contains methods for managing users
 type UserService struct {
 	Repo repository.UserRepository
+	// Policy is the password policy new passwords must satisfy; nil means
+	// DefaultPasswordPolicy
+	Policy *PasswordPolicy
+	// Hasher hashes and verifies passwords; nil means DefaultPasswordHasher
+	Hasher PasswordHasher
+	// UsernamePolicy is the policy new usernames must satisfy; nil means
+	// DefaultUsernamePolicy
+	UsernamePolicy *UsernamePolicy
 }
 
 // NewUserService creates a new UserService
@@ -25,53 +52,287 @@ func NewUserService(repo repository.UserRepository) *UserService {
 	return &UserService{Repo: repo}
 }
 
-// RegisterUser handles user registration
+// RegisterUser handles user registration.
+//
+// The username is normalized and checked against the username policy, and
+// the password against the password policy. Registration fails with
+// ErrUserExists if the username only differs from an existing one by case or
+// Unicode form, and with ErrUsernameConfusable if it looks like one.
 func (s *UserService) RegisterUser(username, password string) error {
-	// Check if the user already exists using the repository
-	existingUser, err := s.Repo.GetUserByUsername(username)
+	_, err := s.CreateAccount(username, password, "", models.UserStatusActive)
+	return err
+}
+
+// CreateAccount registers a user like RegisterUser, with an email address
+// and an account status, such as models.UserStatusPending for accounts an
+// admin must approve. It returns the new user.
+func (s *UserService) CreateAccount(username, password, email, status string) (*models.User, error) {
+	// Check the username against the policy
+	normalized, err := s.usernamePolicy().Normalize(username)
 	if err != nil {
-		return err // Return the error if the query fails
+		return nil, err
 	}
-	if existingUser != nil {
-		return errors.New("user already exists") // Return specific error
+
+	// Check the password against the policy
+	if err := s.passwordPolicy().Validate(normalized.Display, password); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkUsernameAvailable(normalized, 0); err != nil {
+		return nil, err
 	}
 
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.passwordHasher().Hash(password)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Create new user
 	newUser := models.User{
-		Username: username,
-		Password: string(hashedPassword),
+		Username:           normalized.Display,
+		Password:           hashedPassword,
+		NormalizedUsername: normalized.Canonical,
+		UsernameSkeleton:   normalized.Skeleton,
+		Email:              email,
+		Status:             status,
 	}
 
 	// Save to the database using the repository
 	err = s.Repo.CreateUser(&newUser)
+	if err != nil {
+		return nil, err
+	}
+
+	return &newUser, nil
+}
+
+// AccountStatusError returns why a user whose password is correct still
+// cannot log in: ErrAccountPending, ErrEmailUnverified, ErrAccountSuspended,
+// ErrAccountLocked or ErrUserDeactivated. It returns nil for active users.
+func AccountStatusError(user *models.User) error {
+	switch {
+	case user.Active():
+		return nil
+	case user.Status == models.UserStatusPending:
+		return ErrAccountPending
+	case user.Status == models.UserStatusUnverified:
+		return ErrEmailUnverified
+	case user.Status == models.UserStatusSuspended:
+		return ErrAccountSuspended
+	case user.Status == models.UserStatusLocked:
+		return ErrAccountLocked
+	default:
+		return ErrUserDeactivated
+	}
+}
+
+// ProvisionUser creates a user signing in through an external identity
+// provider.
+//
+// The username is checked like in RegisterUser. The user has no password,
+// so they can only log in through the provider. An empty role means
+// models.RoleUser.
+func (s *UserService) ProvisionUser(username, role string) (*models.User, error) {
+	if role == "" {
+		role = models.RoleUser
+	}
+	normalized, err := s.usernamePolicy().Normalize(username)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkUsernameAvailable(normalized, 0); err != nil {
+		return nil, err
+	}
+
+	newUser := models.User{
+		Username:           normalized.Display,
+		NormalizedUsername: normalized.Canonical,
+		UsernameSkeleton:   normalized.Skeleton,
+		Role:               role,
+		Status:             models.UserStatusActive,
+	}
+	if err := s.Repo.CreateUser(&newUser); err != nil {
+		return nil, err
+	}
+	return &newUser, nil
+}
+
+// SetPassword checks a new password against the password policy, then
+// hashes and saves it
+func (s *UserService) SetPassword(user *models.User, password string) error {
+	if err := s.passwordPolicy().Validate(user.Username, password); err != nil {
+		return err
+	}
+	hashedPassword, err := s.passwordHasher().Hash(password)
+	if err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+	return s.Repo.UpdateUser(user)
+}
+
+// ChangeUsername renames a user.
+//
+// The new username is checked like in RegisterUser, except against the
+// user themselves, so the case of a username can be changed. The user is
+// not saved.
+func (s *UserService) ChangeUsername(user *models.User, username string) error {
+	normalized, err := s.usernamePolicy().Normalize(username)
 	if err != nil {
 		return err
 	}
+	if normalized.Display == user.Username {
+		return nil
+	}
+	if normalized.Canonical != user.NormalizedUsername {
+		if err := s.checkUsernameAvailable(normalized, user.ID); err != nil {
+			return err
+		}
+	}
 
+	user.Username = normalized.Display
+	user.NormalizedUsername = normalized.Canonical
+	user.UsernameSkeleton = normalized.Skeleton
 	return nil
 }
 
-// GetUserByUsername uses the repository to fetch a user by their username
+// checkUsernameAvailable returns ErrUserExists if the username only differs
+// from an existing one by case or Unicode form, and ErrUsernameConfusable if
+// it looks like one. The user with the excluded ID is ignored, unless the ID
+// is 0.
+func (s *UserService) checkUsernameAvailable(normalized *NormalizedUsername, excludedID uint) error {
+	// Check if the user already exists using the repository
+	existingUser, err := s.Repo.GetUserByUsername(normalized.Canonical)
+	if err != nil {
+		return err // Return the error if the query fails
+	}
+	if existingUser != nil && (excludedID == 0 || existingUser.ID != excludedID) {
+		return ErrUserExists // Return specific error
+	}
+
+	// Check that the username cannot be mistaken for an existing one
+	lookalike, err := s.Repo.GetUserByUsernameSkeleton(normalized.Skeleton)
+	if err != nil {
+		return err
+	}
+	if lookalike != nil && (excludedID == 0 || lookalike.ID != excludedID) {
+		return ErrUsernameConfusable
+	}
+	return nil
+}
+
+// passwordPolicy returns the configured password policy, or the default one
+func (s *UserService) passwordPolicy() *PasswordPolicy {
+	if s.Policy == nil {
+		return DefaultPasswordPolicy()
+	}
+	return s.Policy
+}
+
+// usernamePolicy returns the configured username policy, or the default one
+func (s *UserService) usernamePolicy() *UsernamePolicy {
+	if s.UsernamePolicy == nil {
+		return DefaultUsernamePolicy()
+	}
+	return s.UsernamePolicy
+}
+
+// GetUserByUsername uses the repository to fetch a user by their username,
+// compared in its canonical form
 func (s *UserService) GetUserByUsername(username string) (*models.User, error) {
-	return s.Repo.GetUserByUsername(username)
+	return s.Repo.GetUserByUsername(CanonicalUsername(username))
 }
 
-// CheckPassword compares a plain-text password with a hashed password
-func (s *UserService) CheckPassword(hashedPassword, plainPassword string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
-	if err != nil {
+// GetUserByID uses the repository to fetch a user by their ID
+func (s *UserService) GetUserByID(id uint) (*models.User, error) {
+	return s.Repo.GetUserByID(id)
+}
+
+// CheckPassword compares a plain-text password with the user's hashed password.
+//
+// If the password matches but the hash was made with outdated parameters
+// (algorithm, cost or pepper), the password is transparently rehashed and
+// the user saved. Failing to save the new hash does not fail the check.
+func (s *UserService) CheckPassword(user *models.User, plainPassword string) error {
+	hasher := s.passwordHasher()
+
+	ok, needsRehash, err := hasher.Verify(user.Password, plainPassword)
+	if err != nil || !ok {
 		return errors.New("invalid password")
 	}
+
+	if needsRehash {
+		hashedPassword, err := hasher.Hash(plainPassword)
+		if err == nil {
+			user.Password = hashedPassword
+			err = s.Repo.UpdateUser(user)
+		}
+		if err != nil {
+			log.Printf("Failed to upgrade password hash of user %d: %v", user.ID, err)
+		}
+	}
 	return nil
 }
 
-// GetAllUsers uses the repository to fetch all users
-func (s *UserService) GetAllUsers() ([]models.User, error) {
-	return s.Repo.GetAllUsers()
+// passwordHasher returns the configured password hasher, or the default one
+func (s *UserService) passwordHasher() PasswordHasher {
+	if s.Hasher == nil {
+		return DefaultPasswordHasher()
+	}
+	return s.Hasher
+}
+
+// GetAllUsers uses the repository to fetch the members of the organization
+// of the context
+func (s *UserService) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	return s.Repo.GetAllUsers(ctx)
+}
+
+// GrantPermission grants a permission to a user.
+//
+// It reports whether the user did not have it yet, so only actual changes
+// are audited, or returns ErrUserNotFound if there is no user with that
+// username.
+func (s *UserService) GrantPermission(username, permission string) (*models.User, bool, error) {
+	user, err := s.GetUserByUsername(username)
+	if err != nil {
+		return nil, false, err
+	}
+	if user == nil {
+		return nil, false, ErrUserNotFound
+	}
+
+	if user.HasPermission(permission) {
+		return user, false, nil
+	}
+	user.Permissions = strings.TrimSpace(user.Permissions + " " + permission)
+	if err := s.Repo.UpdateUser(user); err != nil {
+		return nil, false, err
+	}
+	return user, true, nil
+}
+
+// SetRole gives a user a new role.
+//
+// It returns the user with its previous role, so the change can be audited,
+// or ErrUserNotFound if there is no user with that username.
+func (s *UserService) SetRole(username, role string) (*models.User, string, error) {
+	user, err := s.GetUserByUsername(username)
+	if err != nil {
+		return nil, "", err
+	}
+	if user == nil {
+		return nil, "", ErrUserNotFound
+	}
+
+	previous := user.Role
+	if previous == role {
+		return user, previous, nil
+	}
+	user.Role = role
+	if err := s.Repo.UpdateUser(user); err != nil {
+		return nil, "", err
+	}
+	return user, previous, nil
 }
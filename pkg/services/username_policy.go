@@ -0,0 +1,245 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/secure/precis"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Username policy rules, reported with every violation so clients can tell
+// them apart
+const (
+	RuleRequired    = "required"
+	RuleLength      = "length"
+	RuleCharacters  = "characters"
+	RuleMixedScript = "mixed_script"
+	RuleReserved    = "reserved"
+)
+
+// DefaultReservedUsernames are names that could be mistaken for the service
+// itself or its staff
+var DefaultReservedUsernames = []string{
+	"admin", "administrator", "api", "root", "system", "support", "security",
+	"help", "info", "null", "undefined", "anonymous", "staff", "moderator",
+	"superuser", "webmaster", "postmaster", "hostmaster", "noreply", "login",
+	"register", "account", "home", "user", "users",
+}
+
+// allowedScriptSets lists the scripts that may legitimately be combined in a
+// single username, besides Latin mixed with digits and punctuation
+var allowedScriptSets = [][]string{
+	{"Han", "Hiragana", "Katakana"},
+	{"Han", "Hangul"},
+	{"Han", "Bopomofo"},
+}
+
+// confusables maps characters that look like a Latin letter to that letter.
+// It covers the most common homoglyphs from the Unicode confusables list.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x',
+	'і': 'i', 'ј': 'j', 'ѕ': 's', 'һ': 'h', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	'ӏ': 'l', 'к': 'k', 'ь': 'b',
+	// Greek
+	'α': 'a', 'ο': 'o', 'ρ': 'p', 'ν': 'v', 'ι': 'i', 'κ': 'k', 'υ': 'u',
+	'χ': 'x', 'ϲ': 'c', 'ϳ': 'j', 'ε': 'e', 'τ': 't',
+	// Latin look-alikes
+	'ı': 'i', 'ɑ': 'a', 'ɡ': 'g', 'ℓ': 'l', 'ɩ': 'i', 'ʏ': 'y',
+}
+
+// UsernamePolicyError is returned when a username breaks one or more rules
+// of the username policy
+type UsernamePolicyError struct {
+	Violations []PolicyViolation
+}
+
+// Error joins the messages of all violations
+func (e *UsernamePolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Message
+	}
+	return "username does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+// NormalizedUsername holds the forms of a username that passed the policy
+type NormalizedUsername struct {
+	// Display is the username as shown to users, with its case preserved
+	Display string
+	// Canonical is the case-folded form used to compare usernames
+	Canonical string
+	// Skeleton is the canonical form with look-alike characters replaced,
+	// used to detect usernames that could be confused with each other
+	Skeleton string
+}
+
+// UsernamePolicy holds the rules new usernames are checked against
+type UsernamePolicy struct {
+	MinLength     int
+	MaxLength     int
+	ReservedNames []string
+}
+
+// DefaultUsernamePolicy returns the policy used when none is configured
+func DefaultUsernamePolicy() *UsernamePolicy {
+	return &UsernamePolicy{MinLength: 3, MaxLength: 32, ReservedNames: DefaultReservedUsernames}
+}
+
+// Normalize checks a username against every rule of the policy.
+//
+// The username is trimmed, NFKC normalized and enforced with the PRECIS
+// UsernameCasePreserved profile (RFC 8265). It must then be made of letters,
+// digits, dots, dashes and underscores, start and end with a letter or a
+// digit, use a single script, and not be a reserved name. It returns the
+// normalized forms of the username, or a *UsernamePolicyError listing all
+// the violations.
+func (p *UsernamePolicy) Normalize(username string) (*NormalizedUsername, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, &UsernamePolicyError{Violations: []PolicyViolation{{
+			Rule:    RuleRequired,
+			Message: "Username is required",
+		}}}
+	}
+
+	var violations []PolicyViolation
+	display, err := precis.UsernameCasePreserved.String(norm.NFKC.String(username))
+	if err != nil {
+		return nil, &UsernamePolicyError{Violations: []PolicyViolation{{
+			Rule:    RuleCharacters,
+			Message: "Username contains spaces or characters that are not allowed",
+		}}}
+	}
+
+	if length := utf8.RuneCountInString(display); length < p.MinLength || length > p.MaxLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleLength,
+			Message: fmt.Sprintf("Username must be between %d and %d characters long", p.MinLength, p.MaxLength),
+		})
+	}
+
+	if !hasAllowedCharacters(display) {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleCharacters,
+			Message: "Username may only contain letters, digits, '.', '-' and '_', and must start and end with a letter or a digit",
+		})
+	}
+
+	if !isSingleScript(display) {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMixedScript,
+			Message: "Username mixes characters from different alphabets",
+		})
+	}
+
+	normalized := &NormalizedUsername{Display: display, Canonical: CanonicalUsername(display)}
+	normalized.Skeleton = UsernameSkeleton(normalized.Canonical)
+
+	for _, reserved := range p.ReservedNames {
+		reserved = CanonicalUsername(reserved)
+		if normalized.Canonical == reserved || normalized.Skeleton == UsernameSkeleton(reserved) {
+			violations = append(violations, PolicyViolation{
+				Rule:    RuleReserved,
+				Message: "Username is reserved",
+			})
+			break
+		}
+	}
+
+	if len(violations) > 0 {
+		return nil, &UsernamePolicyError{Violations: violations}
+	}
+	return normalized, nil
+}
+
+// CanonicalUsername returns the case-folded form of a username used to
+// compare usernames with each other.
+//
+// It applies NFKC and the PRECIS UsernameCaseMapped profile. Usernames the
+// profile rejects, such as the ones registered before the policy existed,
+// fall back to NFKC with Unicode lower casing, so every username has a
+// canonical form.
+func CanonicalUsername(username string) string {
+	username = norm.NFKC.String(strings.TrimSpace(username))
+	if canonical, err := precis.UsernameCaseMapped.String(username); err == nil {
+		return canonical
+	}
+	return strings.ToLower(username)
+}
+
+// UsernameSkeleton returns the form of a canonical username in which
+// characters that look alike are made identical.
+//
+// Accents are stripped and the characters of the confusables table are
+// replaced by the Latin letter they look like, so that "аdmin" (with a
+// Cyrillic "а") and "admin" share the same skeleton.
+func UsernameSkeleton(canonical string) string {
+	var skeleton strings.Builder
+	for _, r := range norm.NFD.String(canonical) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if latin, ok := confusables[r]; ok {
+			r = latin
+		}
+		skeleton.WriteRune(r)
+	}
+	return skeleton.String()
+}
+
+// hasAllowedCharacters reports whether a username only uses the allowed
+// character set
+func hasAllowedCharacters(username string) bool {
+	runes := []rune(username)
+	for i, r := range runes {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.Is(unicode.Mn, r) && i > 0:
+		case strings.ContainsRune(".-_", r) && i > 0 && i < len(runes)-1:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isSingleScript reports whether the letters of a username all belong to
+// the same script, or to one of the allowedScriptSets
+func isSingleScript(username string) bool {
+	scripts := make(map[string]bool)
+	for _, r := range username {
+		if script := scriptOf(r); script != "" {
+			scripts[script] = true
+		}
+	}
+	if len(scripts) <= 1 {
+		return true
+	}
+
+	for _, set := range allowedScriptSets {
+		covered := 0
+		for _, script := range set {
+			if scripts[script] {
+				covered++
+			}
+		}
+		if covered == len(scripts) {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptOf returns the Unicode script of a rune, or an empty string for the
+// characters shared by all scripts (digits, punctuation, combining marks)
+func scriptOf(r rune) string {
+	for name, table := range unicode.Scripts {
+		if name != "Common" && name != "Inherited" && unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
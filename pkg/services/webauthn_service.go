@@ -0,0 +1,544 @@
+package services
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Limits of the WebAuthn ceremonies
+const (
+	// webAuthnTimeout is how long the user has to complete a ceremony
+	webAuthnTimeout = 5 * time.Minute
+	// maxCredentialNameLength bounds the name users give their credentials
+	maxCredentialNameLength = 64
+)
+
+// Errors returned by the WebAuthnService
+var (
+	ErrWebAuthnChallenge         = errors.New("this passkey request has expired or was already used, please try again")
+	ErrWebAuthnInvalid           = errors.New("the passkey response is invalid")
+	ErrWebAuthnUnknownCredential = errors.New("this passkey is not registered")
+	ErrWebAuthnCredentialExists  = errors.New("this passkey is already registered")
+	ErrWebAuthnCredentialMissing = errors.New("passkey not found")
+)
+
+// RelyingParty identifies the service to authenticators
+type RelyingParty struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+// WebAuthnUserEntity identifies a user to authenticators. ID is the user
+// handle of the user, base64url encoded.
+type WebAuthnUserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CredentialParameter is a type of credential the service accepts
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor refers to a registered credential, by its base64url
+// ID
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection states what the service requires of
+// authenticators creating credentials
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CredentialCreationOptions are the options of navigator.credentials.create,
+// with the binary fields base64url encoded
+type CredentialCreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   WebAuthnUserEntity     `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+}
+
+// CredentialRequestOptions are the options of navigator.credentials.get,
+// with the binary fields base64url encoded
+type CredentialRequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AuthenticatorResponse is the response of an authenticator to a ceremony,
+// with the binary fields base64url encoded. Registrations set
+// AttestationObject, logins AuthenticatorData, Signature and UserHandle.
+type AuthenticatorResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON"`
+	AttestationObject string   `json:"attestationObject,omitempty"`
+	Transports        []string `json:"transports,omitempty"`
+	AuthenticatorData string   `json:"authenticatorData,omitempty"`
+	Signature         string   `json:"signature,omitempty"`
+	UserHandle        string   `json:"userHandle,omitempty"`
+}
+
+// PublicKeyCredential is the credential a browser returns from
+// navigator.credentials.create or get, as posted by the JavaScript of the
+// pages
+type PublicKeyCredential struct {
+	ID       string                `json:"id"`
+	RawID    string                `json:"rawId"`
+	Type     string                `json:"type"`
+	Response AuthenticatorResponse `json:"response"`
+}
+
+// WebAuthnLogin is the outcome of a login with a credential
+type WebAuthnLogin struct {
+	User       *models.User
+	Credential *models.WebAuthnCredential
+	// Next is the local page the second factor login was started from
+	Next string
+	// Passwordless is false when the credential completed a password login
+	Passwordless bool
+}
+
+// WebAuthnServiceInterface defines the interface for the WebAuthnService
+type WebAuthnServiceInterface interface {
+	BeginRegistration(userID uint) (*CredentialCreationOptions, error)
+	FinishRegistration(userID uint, name string, credential *PublicKeyCredential) (*models.WebAuthnCredential, error)
+	BeginLogin() (*CredentialRequestOptions, error)
+	BeginSecondFactor(user *models.User, next string) (*CredentialRequestOptions, error)
+	FinishLogin(credential *PublicKeyCredential) (*WebAuthnLogin, error)
+	ListCredentials(userID uint) ([]models.WebAuthnCredential, error)
+	RemoveCredential(userID, id uint) error
+}
+
+// WebAuthnService registers the passkeys and security keys of users, and
+// logs them in with those credentials, either without a password or as a
+// second factor after it (WebAuthn Level 2)
+type WebAuthnService struct {
+	Repo     repository.WebAuthnRepository
+	UserRepo repository.UserRepository
+	// RP identifies the service; credentials are scoped to RP.ID, the
+	// domain of the service
+	RP RelyingParty
+	// Origins are the origins of the pages allowed to run the ceremonies
+	Origins []string
+	Now     func() time.Time
+}
+
+// NewWebAuthnService creates a new WebAuthnService for the relying party
+// with the given ID and name, used from pages of the given origins
+func NewWebAuthnService(repo repository.WebAuthnRepository, userRepo repository.UserRepository, rpID, rpName string, origins []string) *WebAuthnService {
+	return &WebAuthnService{
+		Repo:     repo,
+		UserRepo: userRepo,
+		RP:       RelyingParty{ID: rpID, Name: rpName},
+		Origins:  origins,
+		Now:      time.Now,
+	}
+}
+
+// BeginRegistration starts adding a credential to the account of a user.
+// It returns the options for the browser; the credentials the user already
+// has are excluded, so an authenticator is not registered twice. It returns
+// ErrUserNotFound if there is no such user.
+func (s *WebAuthnService) BeginRegistration(userID uint) (*CredentialCreationOptions, error) {
+	user, err := s.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	credentials, err := s.Repo.ListCredentials(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := s.newChallenge(models.WebAuthnCeremonyRegistration, &user.ID, "")
+	if err != nil {
+		return nil, err
+	}
+	displayName := user.Username
+	if user.Email != "" {
+		displayName = user.Email
+	}
+	return &CredentialCreationOptions{
+		Challenge: challenge,
+		RP:        s.RP,
+		User: WebAuthnUserEntity{
+			ID:          WebAuthnUserHandle(user.ID),
+			Name:        user.Username,
+			DisplayName: displayName,
+		},
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: utils.COSEAlgES256},
+			{Type: "public-key", Alg: utils.COSEAlgEdDSA},
+			{Type: "public-key", Alg: utils.COSEAlgRS256},
+		},
+		Timeout:            webAuthnTimeout.Milliseconds(),
+		Attestation:        "none",
+		ExcludeCredentials: credentialDescriptors(credentials),
+		// Discoverable credentials can log in without a username
+		AuthenticatorSelection: AuthenticatorSelection{ResidentKey: "preferred", UserVerification: "preferred"},
+	}, nil
+}
+
+// FinishRegistration verifies the credential an authenticator created for
+// BeginRegistration, and adds it to the account of the user under the
+// given name.
+//
+// It returns ErrWebAuthnChallenge if the challenge is unknown, expired,
+// already used or was issued to another user, ErrWebAuthnInvalid if the
+// response does not verify, for instance because it comes from another
+// origin, and ErrWebAuthnCredentialExists if the credential is already
+// registered.
+func (s *WebAuthnService) FinishRegistration(userID uint, name string, credential *PublicKeyCredential) (*models.WebAuthnCredential, error) {
+	clientDataJSON, clientData, err := s.verifyClientData(credential, "webauthn.create")
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := s.Repo.ClaimChallenge(clientData.Challenge, s.Now())
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil || challenge.Ceremony != models.WebAuthnCeremonyRegistration ||
+		challenge.UserID == nil || *challenge.UserID != userID {
+		return nil, ErrWebAuthnChallenge
+	}
+
+	attestationObject, err := decodeWebAuthnField(credential.Response.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+	attestation, err := utils.ParseAttestationObject(attestationObject)
+	if err != nil {
+		return nil, invalidWebAuthn(err)
+	}
+	authData, err := s.verifyAuthenticatorData(attestation.AuthData, false)
+	if err != nil {
+		return nil, err
+	}
+	if !authData.Has(utils.AuthenticatorAttestedData) {
+		return nil, fmt.Errorf("%w: no credential in the response", ErrWebAuthnInvalid)
+	}
+	credentialID := base64.RawURLEncoding.EncodeToString(authData.CredentialID)
+	if credentialID != strings.TrimRight(credential.RawID, "=") {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrWebAuthnInvalid)
+	}
+	key, alg, err := utils.ParseCOSEKey(authData.PublicKey)
+	if err != nil {
+		return nil, invalidWebAuthn(err)
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if err := attestation.VerifyAttestation(key, alg, clientDataHash[:]); err != nil {
+		return nil, invalidWebAuthn(err)
+	}
+
+	existing, err := s.Repo.GetCredential(credentialID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrWebAuthnCredentialExists
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > maxCredentialNameLength {
+		name = name[:maxCredentialNameLength]
+	}
+	created := &models.WebAuthnCredential{
+		UserID:         userID,
+		CredentialID:   credentialID,
+		PublicKey:      authData.PublicKey,
+		Algorithm:      alg,
+		SignCount:      authData.SignCount,
+		Name:           name,
+		Transports:     strings.Join(credential.Response.Transports, ","),
+		BackupEligible: authData.Has(utils.AuthenticatorBackupEligible),
+	}
+	if err := s.Repo.CreateCredential(created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// BeginLogin starts a passwordless login. It returns the options for the
+// browser, which let the authenticator pick any discoverable credential of
+// the service; the user must be verified by the authenticator, so the
+// credential alone is not enough.
+func (s *WebAuthnService) BeginLogin() (*CredentialRequestOptions, error) {
+	challenge, err := s.newChallenge(models.WebAuthnCeremonyLogin, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return &CredentialRequestOptions{
+		Challenge:        challenge,
+		Timeout:          webAuthnTimeout.Milliseconds(),
+		RPID:             s.RP.ID,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "required",
+	}, nil
+}
+
+// BeginSecondFactor starts the second step of the login of a user who gave
+// their password, to go back to the local page next afterwards. It returns
+// the options for the browser, allowing the credentials of the user, or nil
+// and nil if the user has none and their password is enough.
+func (s *WebAuthnService) BeginSecondFactor(user *models.User, next string) (*CredentialRequestOptions, error) {
+	credentials, err := s.Repo.ListCredentials(user.ID)
+	if err != nil || len(credentials) == 0 {
+		return nil, err
+	}
+	challenge, err := s.newChallenge(models.WebAuthnCeremonySecondFactor, &user.ID, next)
+	if err != nil {
+		return nil, err
+	}
+	return &CredentialRequestOptions{
+		Challenge:        challenge,
+		Timeout:          webAuthnTimeout.Milliseconds(),
+		RPID:             s.RP.ID,
+		AllowCredentials: credentialDescriptors(credentials),
+		UserVerification: "discouraged",
+	}, nil
+}
+
+// FinishLogin verifies the assertion an authenticator made for BeginLogin
+// or BeginSecondFactor, and returns the user it logs in.
+//
+// It returns ErrWebAuthnChallenge if the challenge is unknown, expired or
+// already used, ErrWebAuthnUnknownCredential if the credential is not
+// registered, and ErrWebAuthnInvalid if the assertion does not verify: a
+// signature that does not match, another origin, a passwordless login
+// without user verification, a credential of another user than the one who
+// gave their password, or a signature counter that did not increase, which
+// means the authenticator was cloned. Once the credential is known, the
+// login is returned with the error, so the failure can be recorded against
+// its user. If the user may no longer log in, the login is returned with
+// the error of AccountStatusError.
+func (s *WebAuthnService) FinishLogin(credential *PublicKeyCredential) (*WebAuthnLogin, error) {
+	clientDataJSON, clientData, err := s.verifyClientData(credential, "webauthn.get")
+	if err != nil {
+		return nil, err
+	}
+	now := s.Now()
+	challenge, err := s.Repo.ClaimChallenge(clientData.Challenge, now)
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil || challenge.Ceremony == models.WebAuthnCeremonyRegistration {
+		return nil, ErrWebAuthnChallenge
+	}
+
+	stored, err := s.Repo.GetCredential(strings.TrimRight(credential.RawID, "="))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, ErrWebAuthnUnknownCredential
+	}
+	user, err := s.UserRepo.GetUserByID(stored.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrWebAuthnUnknownCredential
+	}
+	login := &WebAuthnLogin{
+		User:         user,
+		Credential:   stored,
+		Next:         challenge.Next,
+		Passwordless: challenge.Ceremony == models.WebAuthnCeremonyLogin,
+	}
+	if err := s.verifyAssertion(credential, clientDataJSON, stored, challenge); err != nil {
+		return login, err
+	}
+
+	if err := s.Repo.UpdateCredentialUse(stored.ID, stored.SignCount, now); err != nil {
+		return nil, err
+	}
+	stored.LastUsedAt = &now
+	return login, AccountStatusError(user)
+}
+
+// ListCredentials returns the credentials of a user
+func (s *WebAuthnService) ListCredentials(userID uint) ([]models.WebAuthnCredential, error) {
+	return s.Repo.ListCredentials(userID)
+}
+
+// RemoveCredential removes a credential of a user. It returns
+// ErrWebAuthnCredentialMissing if the user has no such credential.
+func (s *WebAuthnService) RemoveCredential(userID, id uint) error {
+	deleted, err := s.Repo.DeleteCredential(userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrWebAuthnCredentialMissing
+	}
+	return nil
+}
+
+// WebAuthnUserHandle returns the user handle of a user, base64url encoded:
+// their ID, which reveals nothing else about them
+func WebAuthnUserHandle(userID uint) string {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return base64.RawURLEncoding.EncodeToString(handle)
+}
+
+// newChallenge creates the challenge of a ceremony, for a user unless
+// userID is nil, and returns it base64url encoded
+func (s *WebAuthnService) newChallenge(ceremony string, userID *uint, next string) (string, error) {
+	challenge, _, err := newInvitationToken()
+	if err != nil {
+		return "", err
+	}
+	now := s.Now()
+	err = s.Repo.CreateChallenge(&models.WebAuthnChallenge{
+		CreatedAt: now,
+		Challenge: challenge,
+		Ceremony:  ceremony,
+		UserID:    userID,
+		Next:      next,
+		ExpiresAt: now.Add(webAuthnTimeout),
+	})
+	return challenge, err
+}
+
+// verifyClientData decodes the client data of a response, and checks that
+// it is of the given ceremony type and comes from an allowed origin
+func (s *WebAuthnService) verifyClientData(credential *PublicKeyCredential, ceremonyType string) ([]byte, *utils.ClientData, error) {
+	if credential == nil || credential.Type != "public-key" {
+		return nil, nil, fmt.Errorf("%w: not a public key credential", ErrWebAuthnInvalid)
+	}
+	clientDataJSON, err := decodeWebAuthnField(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, nil, err
+	}
+	clientData, err := utils.ParseClientData(clientDataJSON)
+	if err != nil {
+		return nil, nil, invalidWebAuthn(err)
+	}
+	if clientData.Type != ceremonyType {
+		return nil, nil, fmt.Errorf("%w: unexpected ceremony %q", ErrWebAuthnInvalid, clientData.Type)
+	}
+	for _, origin := range s.Origins {
+		if clientData.Origin == origin {
+			return clientDataJSON, clientData, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: unexpected origin %q", ErrWebAuthnInvalid, clientData.Origin)
+}
+
+// verifyAuthenticatorData parses authenticator data, and checks that it is
+// scoped to the service and that the user was present, and verified if
+// required
+func (s *WebAuthnService) verifyAuthenticatorData(data []byte, userVerification bool) (*utils.AuthenticatorData, error) {
+	authData, err := utils.ParseAuthenticatorData(data)
+	if err != nil {
+		return nil, invalidWebAuthn(err)
+	}
+	rpIDHash := sha256.Sum256([]byte(s.RP.ID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return nil, fmt.Errorf("%w: credential of another relying party", ErrWebAuthnInvalid)
+	}
+	if !authData.Has(utils.AuthenticatorUserPresent) {
+		return nil, fmt.Errorf("%w: user not present", ErrWebAuthnInvalid)
+	}
+	if userVerification && !authData.Has(utils.AuthenticatorUserVerified) {
+		return nil, fmt.Errorf("%w: user not verified", ErrWebAuthnInvalid)
+	}
+	return authData, nil
+}
+
+// verifyAssertion verifies the assertion of a stored credential for a
+// login challenge, and advances the signature counter of the credential
+func (s *WebAuthnService) verifyAssertion(credential *PublicKeyCredential, clientDataJSON []byte, stored *models.WebAuthnCredential, challenge *models.WebAuthnChallenge) error {
+	passwordless := challenge.Ceremony == models.WebAuthnCeremonyLogin
+	if challenge.UserID != nil && *challenge.UserID != stored.UserID {
+		return fmt.Errorf("%w: credential of another user", ErrWebAuthnInvalid)
+	}
+	userHandle := strings.TrimRight(credential.Response.UserHandle, "=")
+	if (passwordless || userHandle != "") && userHandle != WebAuthnUserHandle(stored.UserID) {
+		return fmt.Errorf("%w: user handle mismatch", ErrWebAuthnInvalid)
+	}
+
+	rawAuthData, err := decodeWebAuthnField(credential.Response.AuthenticatorData)
+	if err != nil {
+		return err
+	}
+	authData, err := s.verifyAuthenticatorData(rawAuthData, passwordless)
+	if err != nil {
+		return err
+	}
+	signature, err := decodeWebAuthnField(credential.Response.Signature)
+	if err != nil {
+		return err
+	}
+	key, alg, err := utils.ParseCOSEKey(stored.PublicKey)
+	if err != nil {
+		return err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	if err := utils.VerifyCOSESignature(key, alg, signed, signature); err != nil {
+		return invalidWebAuthn(err)
+	}
+
+	// Authenticators without a counter always sign zero
+	if (authData.SignCount != 0 || stored.SignCount != 0) && authData.SignCount <= stored.SignCount {
+		return fmt.Errorf("%w: signature counter went back, the authenticator may be cloned", ErrWebAuthnInvalid)
+	}
+	stored.SignCount = authData.SignCount
+	return nil
+}
+
+// credentialDescriptors refers to stored credentials in ceremony options
+func credentialDescriptors(credentials []models.WebAuthnCredential) []CredentialDescriptor {
+	descriptors := make([]CredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		descriptor := CredentialDescriptor{Type: "public-key", ID: credential.CredentialID}
+		if credential.Transports != "" {
+			descriptor.Transports = strings.Split(credential.Transports, ",")
+		}
+		descriptors = append(descriptors, descriptor)
+	}
+	return descriptors
+}
+
+// decodeWebAuthnField decodes a base64url field of a response, with or
+// without padding
+func decodeWebAuthnField(field string) ([]byte, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(field, "="))
+	if err != nil || len(decoded) == 0 {
+		return nil, fmt.Errorf("%w: malformed field", ErrWebAuthnInvalid)
+	}
+	return decoded, nil
+}
+
+// invalidWebAuthn wraps a parse or verification error as ErrWebAuthnInvalid
+func invalidWebAuthn(err error) error {
+	return fmt.Errorf("%w: %v", ErrWebAuthnInvalid, err)
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Universal BER tags used by LDAP (X.690)
+const (
+	BERTagBoolean     = 0x01
+	BERTagInteger     = 0x02
+	BERTagOctetString = 0x04
+	BERTagEnumerated  = 0x0a
+	BERTagSequence    = 0x30
+	BERTagSet         = 0x31
+)
+
+// maxBERLength bounds the size of an element, so a peer cannot make us
+// allocate arbitrary amounts of memory
+const maxBERLength = 1 << 20
+
+// ErrInvalidBER is returned for data that is not valid BER
+var ErrInvalidBER = errors.New("invalid BER data")
+
+// BERElement is an element of the Basic Encoding Rules (X.690), the
+// encoding of LDAP messages. Only the single-byte tags LDAP uses are
+// supported, and lengths are always definite.
+type BERElement struct {
+	// Tag is the identifier byte: class, constructed bit and tag number
+	Tag     byte
+	Content []byte
+}
+
+// NewBERString returns a primitive element holding a string, such as an
+// octet string or a context-specific tag
+func NewBERString(tag byte, value string) BERElement {
+	return BERElement{Tag: tag, Content: []byte(value)}
+}
+
+// NewBERInteger returns an integer or enumerated element, in its shortest
+// two's complement form
+func NewBERInteger(tag byte, value int64) BERElement {
+	content := []byte{byte(value)}
+	for value > 0x7f || value < -0x80 {
+		value >>= 8
+		content = append([]byte{byte(value)}, content...)
+	}
+	return BERElement{Tag: tag, Content: content}
+}
+
+// NewBERBoolean returns a boolean element
+func NewBERBoolean(tag byte, value bool) BERElement {
+	if value {
+		return BERElement{Tag: tag, Content: []byte{0xff}}
+	}
+	return BERElement{Tag: tag, Content: []byte{0x00}}
+}
+
+// NewBERConstructed returns a constructed element, such as a sequence, a set
+// or an LDAP operation, made of the children given
+func NewBERConstructed(tag byte, children ...BERElement) BERElement {
+	var content []byte
+	for _, child := range children {
+		content = append(content, child.Encode()...)
+	}
+	return BERElement{Tag: tag, Content: content}
+}
+
+// Encode returns the encoding of the element
+func (e BERElement) Encode() []byte {
+	encoded := []byte{e.Tag}
+	if length := len(e.Content); length < 0x80 {
+		encoded = append(encoded, byte(length))
+	} else {
+		var octets []byte
+		for ; length > 0; length >>= 8 {
+			octets = append([]byte{byte(length)}, octets...)
+		}
+		encoded = append(append(encoded, 0x80|byte(len(octets))), octets...)
+	}
+	return append(encoded, e.Content...)
+}
+
+// String returns the content of the element as a string
+func (e BERElement) String() string {
+	return string(e.Content)
+}
+
+// Integer returns the value of an integer or enumerated element
+func (e BERElement) Integer() (int64, error) {
+	if len(e.Content) == 0 || len(e.Content) > 8 {
+		return 0, fmt.Errorf("%w: integer of %d bytes", ErrInvalidBER, len(e.Content))
+	}
+	value := int64(int8(e.Content[0]))
+	for _, b := range e.Content[1:] {
+		value = value<<8 | int64(b)
+	}
+	return value, nil
+}
+
+// Boolean returns the value of a boolean element
+func (e BERElement) Boolean() bool {
+	return len(e.Content) == 1 && e.Content[0] != 0
+}
+
+// Children parses the content of a constructed element
+func (e BERElement) Children() ([]BERElement, error) {
+	if e.Tag&0x20 == 0 {
+		return nil, fmt.Errorf("%w: tag %#x is not constructed", ErrInvalidBER, e.Tag)
+	}
+	return ParseBER(e.Content)
+}
+
+// ReadBER reads an element from r. It returns io.EOF if r ends before the
+// element starts.
+func ReadBER(r io.Reader) (BERElement, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return BERElement{}, err
+	}
+	if header[0]&0x1f == 0x1f {
+		return BERElement{}, fmt.Errorf("%w: multi-byte tags are not supported", ErrInvalidBER)
+	}
+
+	length := int(header[1])
+	if header[1]&0x80 != 0 {
+		// The long form gives the number of length octets; 0 is the
+		// indefinite form, which LDAP forbids
+		octets := make([]byte, header[1]&0x7f)
+		if len(octets) == 0 || len(octets) > 4 {
+			return BERElement{}, fmt.Errorf("%w: unsupported length form", ErrInvalidBER)
+		}
+		if _, err := io.ReadFull(r, octets); err != nil {
+			return BERElement{}, noEOF(err)
+		}
+		length = 0
+		for _, octet := range octets {
+			length = length<<8 | int(octet)
+		}
+	}
+	if length > maxBERLength {
+		return BERElement{}, fmt.Errorf("%w: element of %d bytes is too long", ErrInvalidBER, length)
+	}
+
+	element := BERElement{Tag: header[0], Content: make([]byte, length)}
+	if _, err := io.ReadFull(r, element.Content); err != nil {
+		return BERElement{}, noEOF(err)
+	}
+	return element, nil
+}
+
+// ParseBER parses consecutive elements
+func ParseBER(data []byte) ([]BERElement, error) {
+	var elements []BERElement
+	reader := bytes.NewReader(data)
+	for reader.Len() > 0 {
+		element, err := ReadBER(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, fmt.Errorf("%w: truncated element", ErrInvalidBER)
+			}
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// noEOF reports the end of the data in the middle of an element as an
+// unexpected one
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// cborMaxDepth bounds the nesting of decoded values, so hostile input cannot
+// recurse forever
+const cborMaxDepth = 16
+
+// Major types of CBOR data items (RFC 8949)
+const (
+	cborUnsigned = iota
+	cborNegative
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// ErrInvalidCBOR is returned for data that is not well-formed CBOR, or uses
+// features WebAuthn messages never use
+var ErrInvalidCBOR = errors.New("invalid CBOR")
+
+// DecodeCBOR decodes the first CBOR data item of data, and returns it with
+// the bytes following it.
+//
+// Only the subset of CBOR used by WebAuthn is supported: definite lengths,
+// integers, byte and text strings, arrays, maps, tags (which are dropped),
+// booleans, null and floats. Integers are decoded as int64, byte strings as
+// []byte, text strings as string, arrays as []interface{} and maps as
+// map[interface{}]interface{}, whose keys are int64 or string.
+func DecodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBOR(data, 0)
+}
+
+// decodeCBOR decodes the data item at the start of data, nested depth deep
+func decodeCBOR(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, fmt.Errorf("%w: nested too deep", ErrInvalidCBOR)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: unexpected end of data", ErrInvalidCBOR)
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	if major == cborSimple {
+		return decodeCBORSimple(data[1:], info)
+	}
+	argument, rest, err := cborArgument(data[1:], info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case cborUnsigned:
+		if argument > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", ErrInvalidCBOR)
+		}
+		return int64(argument), rest, nil
+	case cborNegative:
+		if argument > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", ErrInvalidCBOR)
+		}
+		return -1 - int64(argument), rest, nil
+	case cborBytes, cborText:
+		if argument > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w: string longer than the data", ErrInvalidCBOR)
+		}
+		value := make([]byte, argument)
+		copy(value, rest)
+		if major == cborText {
+			return string(value), rest[argument:], nil
+		}
+		return value, rest[argument:], nil
+	case cborArray:
+		// Every item takes at least a byte
+		if argument > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w: array longer than the data", ErrInvalidCBOR)
+		}
+		array := make([]interface{}, argument)
+		for i := range array {
+			if array[i], rest, err = decodeCBOR(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+		}
+		return array, rest, nil
+	case cborMap:
+		if argument > uint64(len(rest))/2 {
+			return nil, nil, fmt.Errorf("%w: map longer than the data", ErrInvalidCBOR)
+		}
+		values := make(map[interface{}]interface{}, argument)
+		for i := uint64(0); i < argument; i++ {
+			var key, value interface{}
+			if key, rest, err = decodeCBOR(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key", ErrInvalidCBOR)
+			}
+			if value, rest, err = decodeCBOR(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			values[key] = value
+		}
+		return values, rest, nil
+	default: // cborTag
+		return decodeCBOR(rest, depth+1)
+	}
+}
+
+// cborArgument returns the argument of a data item, given the additional
+// information of its initial byte, and the bytes following it
+func cborArgument(data []byte, info byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info > 27:
+		// 28 to 30 are reserved, 31 is an indefinite length
+		return 0, nil, fmt.Errorf("%w: unsupported length", ErrInvalidCBOR)
+	}
+	size := 1 << (info - 24)
+	if len(data) < size {
+		return 0, nil, fmt.Errorf("%w: unexpected end of data", ErrInvalidCBOR)
+	}
+	var argument uint64
+	for _, b := range data[:size] {
+		argument = argument<<8 | uint64(b)
+	}
+	return argument, data[size:], nil
+}
+
+// decodeCBORSimple decodes a simple value or float, given the additional
+// information of its initial byte
+func decodeCBORSimple(data []byte, info byte) (interface{}, []byte, error) {
+	switch info {
+	case 20:
+		return false, data, nil
+	case 21:
+		return true, data, nil
+	case 22, 23:
+		// null and undefined
+		return nil, data, nil
+	case 25:
+		if len(data) < 2 {
+			break
+		}
+		return float64(halfToFloat(binary.BigEndian.Uint16(data))), data[2:], nil
+	case 26:
+		if len(data) < 4 {
+			break
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), data[4:], nil
+	case 27:
+		if len(data) < 8 {
+			break
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), data[8:], nil
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported simple value", ErrInvalidCBOR)
+	}
+	return nil, nil, fmt.Errorf("%w: unexpected end of data", ErrInvalidCBOR)
+}
+
+// halfToFloat converts an IEEE 754 half-precision float
+func halfToFloat(half uint16) float32 {
+	sign := uint32(half>>15) << 31
+	exponent := uint32(half>>10) & 0x1f
+	mantissa := uint32(half) & 0x3ff
+	switch exponent {
+	case 0:
+		// Subnormal numbers
+		value := float32(mantissa) / (1 << 24)
+		return math.Float32frombits(math.Float32bits(value) | sign)
+	case 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | mantissa<<13)
+	default:
+		return math.Float32frombits(sign | (exponent+127-15)<<23 | mantissa<<13)
+	}
+}
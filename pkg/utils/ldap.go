@@ -0,0 +1,490 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tags of the LDAP operations used (RFC 4511 §4)
+const (
+	LDAPBindRequest           = 0x60
+	LDAPBindResponse          = 0x61
+	LDAPUnbindRequest         = 0x42
+	LDAPSearchRequest         = 0x63
+	LDAPSearchResultEntry     = 0x64
+	LDAPSearchResultDone      = 0x65
+	LDAPSearchResultReference = 0x73
+)
+
+// Tags of the LDAP search filters supported (RFC 4511 §4.5.1)
+const (
+	LDAPFilterAnd      = 0xa0
+	LDAPFilterOr       = 0xa1
+	LDAPFilterNot      = 0xa2
+	LDAPFilterEquality = 0xa3
+	LDAPFilterPresent  = 0x87
+)
+
+// ldapSimpleAuthentication is the tag of the password of a simple bind
+const ldapSimpleAuthentication = 0x80
+
+// LDAP result codes
+const (
+	LDAPResultSuccess            = 0
+	LDAPResultProtocolError      = 2
+	LDAPResultNoSuchObject       = 32
+	LDAPResultInvalidCredentials = 49
+)
+
+// LDAP search scopes
+const (
+	LDAPScopeBaseObject   = 0
+	LDAPScopeSingleLevel  = 1
+	LDAPScopeWholeSubtree = 2
+)
+
+// maxLDAPFilterDepth bounds the nesting of the filters parsed
+const maxLDAPFilterDepth = 16
+
+// ErrInvalidLDAPFilter is returned for search filters that cannot be parsed
+var ErrInvalidLDAPFilter = errors.New("invalid LDAP filter")
+
+// LDAPError is a result other than success returned by an LDAP server
+type LDAPError struct {
+	Code    int
+	Message string
+}
+
+func (e *LDAPError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("LDAP result code %d", e.Code)
+	}
+	return fmt.Sprintf("LDAP result code %d: %s", e.Code, e.Message)
+}
+
+// IsLDAPError reports whether err is an LDAPError with the result code
+func IsLDAPError(err error, code int) bool {
+	var ldapErr *LDAPError
+	return errors.As(err, &ldapErr) && ldapErr.Code == code
+}
+
+// LDAPEntry is an entry of an LDAP directory
+type LDAPEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// GetAll returns the values of an attribute, whose name is compared
+// case-insensitively as in LDAP
+func (e *LDAPEntry) GetAll(name string) []string {
+	for attribute, values := range e.Attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// Get returns the first value of an attribute, or "" if it has none
+func (e *LDAPEntry) Get(name string) string {
+	if values := e.GetAll(name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// LDAPSearch is a search request
+type LDAPSearch struct {
+	BaseDN string
+	// Scope is one of the LDAPScope constants
+	Scope int
+	// Filter is written as in RFC 4515, such as "(&(objectClass=user)(uid=bob))"
+	Filter string
+	// Attributes lists the attributes to return; empty returns them all
+	Attributes []string
+}
+
+// LDAPConn is a connection to an LDAP server. It speaks the part of LDAPv3
+// needed to check passwords and look up users: simple binds and searches.
+// It is not safe for concurrent use.
+type LDAPConn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	timeout   time.Duration
+	messageID int64
+}
+
+// DialLDAP connects to the LDAP server at an ldap:// or ldaps:// URL. The
+// tlsConfig is used for ldaps://; nil checks the certificate of the host
+// against the system roots. Connecting, and each request after, must
+// complete within the timeout.
+func DialLDAP(rawURL string, tlsConfig *tls.Config, timeout time.Duration) (*LDAPConn, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := parsed.Host
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	switch parsed.Scheme {
+	case "ldap":
+		if parsed.Port() == "" {
+			host = net.JoinHostPort(parsed.Hostname(), "389")
+		}
+		conn, err = dialer.Dial("tcp", host)
+	case "ldaps":
+		if parsed.Port() == "" {
+			host = net.JoinHostPort(parsed.Hostname(), "636")
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: parsed.Hostname()}
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, tlsConfig)
+	default:
+		return nil, fmt.Errorf("unsupported LDAP URL scheme %q", parsed.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &LDAPConn{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// Bind authenticates the connection as the entry with the DN, with a simple
+// bind. The LDAPError returned for a wrong password has the code
+// LDAPResultInvalidCredentials.
+//
+// Note that servers accept a DN with an empty password as an
+// unauthenticated bind (RFC 4513 §5.1.2): check the password is not empty
+// before taking a successful bind as proof of it.
+func (c *LDAPConn) Bind(dn, password string) error {
+	response, err := c.roundTrip(NewBERConstructed(LDAPBindRequest,
+		NewBERInteger(BERTagInteger, 3),
+		NewBERString(BERTagOctetString, dn),
+		NewBERString(ldapSimpleAuthentication, password),
+	))
+	if err != nil {
+		return err
+	}
+	if response.Tag != LDAPBindResponse {
+		return fmt.Errorf("%w: unexpected response %#x to a bind", ErrInvalidBER, response.Tag)
+	}
+	return ldapResult(response)
+}
+
+// Search returns the entries matching a search request. Search result
+// references to other servers are not followed.
+func (c *LDAPConn) Search(search LDAPSearch) ([]LDAPEntry, error) {
+	filter, err := EncodeLDAPFilter(search.Filter)
+	if err != nil {
+		return nil, err
+	}
+	attributes := make([]BERElement, len(search.Attributes))
+	for i, attribute := range search.Attributes {
+		attributes[i] = NewBERString(BERTagOctetString, attribute)
+	}
+
+	id, err := c.send(NewBERConstructed(LDAPSearchRequest,
+		NewBERString(BERTagOctetString, search.BaseDN),
+		NewBERInteger(BERTagEnumerated, int64(search.Scope)),
+		NewBERInteger(BERTagEnumerated, 0), // Never dereference aliases
+		NewBERInteger(BERTagInteger, 0),    // No size limit
+		NewBERInteger(BERTagInteger, int64(c.timeout/time.Second)),
+		NewBERBoolean(BERTagBoolean, false), // Return the values
+		filter,
+		NewBERConstructed(BERTagSequence, attributes...),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []LDAPEntry
+	for {
+		response, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch response.Tag {
+		case LDAPSearchResultEntry:
+			entry, err := parseLDAPEntry(response)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case LDAPSearchResultReference:
+		case LDAPSearchResultDone:
+			if err := ldapResult(response); err != nil {
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, fmt.Errorf("%w: unexpected response %#x to a search", ErrInvalidBER, response.Tag)
+		}
+	}
+}
+
+// Close unbinds and closes the connection
+func (c *LDAPConn) Close() error {
+	_, _ = c.send(BERElement{Tag: LDAPUnbindRequest})
+	return c.conn.Close()
+}
+
+// roundTrip sends a request and returns its response
+func (c *LDAPConn) roundTrip(operation BERElement) (BERElement, error) {
+	id, err := c.send(operation)
+	if err != nil {
+		return BERElement{}, err
+	}
+	return c.receive(id)
+}
+
+// send sends a request in a new message, and returns the message ID
+func (c *LDAPConn) send(operation BERElement) (int64, error) {
+	c.messageID++
+	message := NewBERConstructed(BERTagSequence, NewBERInteger(BERTagInteger, c.messageID), operation)
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	_, err := c.conn.Write(message.Encode())
+	return c.messageID, err
+}
+
+// receive reads the next response to the message with the ID
+func (c *LDAPConn) receive(id int64) (BERElement, error) {
+	message, err := ReadBER(c.reader)
+	if err != nil {
+		return BERElement{}, err
+	}
+	messageID, operation, err := ParseLDAPMessage(message)
+	if err != nil {
+		return BERElement{}, err
+	}
+	if messageID != id {
+		// Message 0 is an unsolicited notification, such as a notice of
+		// disconnection
+		return BERElement{}, fmt.Errorf("unexpected LDAP message %d: %w", messageID, ldapResult(operation))
+	}
+	return operation, nil
+}
+
+// ParseLDAPMessage returns the ID and the operation of an LDAP message
+func ParseLDAPMessage(message BERElement) (int64, BERElement, error) {
+	if message.Tag != BERTagSequence {
+		return 0, BERElement{}, fmt.Errorf("%w: LDAP message is not a sequence", ErrInvalidBER)
+	}
+	fields, err := message.Children()
+	if err != nil {
+		return 0, BERElement{}, err
+	}
+	if len(fields) < 2 || fields[0].Tag != BERTagInteger {
+		return 0, BERElement{}, fmt.Errorf("%w: malformed LDAP message", ErrInvalidBER)
+	}
+	id, err := fields[0].Integer()
+	return id, fields[1], err
+}
+
+// NewLDAPResult returns a response with a result code, such as a bind
+// response or the end of a search
+func NewLDAPResult(tag byte, code int, message string) BERElement {
+	return NewBERConstructed(tag,
+		NewBERInteger(BERTagEnumerated, int64(code)),
+		NewBERString(BERTagOctetString, ""), // Matched DN
+		NewBERString(BERTagOctetString, message),
+	)
+}
+
+// ldapResult returns the error of a response with a result code, or nil
+// for success
+func ldapResult(response BERElement) error {
+	fields, err := response.Children()
+	if err != nil {
+		return err
+	}
+	if len(fields) < 3 || fields[0].Tag != BERTagEnumerated {
+		return fmt.Errorf("%w: malformed LDAP result", ErrInvalidBER)
+	}
+	code, err := fields[0].Integer()
+	if err != nil {
+		return err
+	}
+	if code != LDAPResultSuccess {
+		return &LDAPError{Code: int(code), Message: fields[2].String()}
+	}
+	return nil
+}
+
+// NewLDAPEntry returns the search result of an entry
+func NewLDAPEntry(entry LDAPEntry) BERElement {
+	var attributes []BERElement
+	for name, values := range entry.Attributes {
+		encoded := make([]BERElement, len(values))
+		for i, value := range values {
+			encoded[i] = NewBERString(BERTagOctetString, value)
+		}
+		attributes = append(attributes, NewBERConstructed(BERTagSequence,
+			NewBERString(BERTagOctetString, name),
+			NewBERConstructed(BERTagSet, encoded...),
+		))
+	}
+	return NewBERConstructed(LDAPSearchResultEntry,
+		NewBERString(BERTagOctetString, entry.DN),
+		NewBERConstructed(BERTagSequence, attributes...),
+	)
+}
+
+// parseLDAPEntry parses the search result of an entry
+func parseLDAPEntry(response BERElement) (LDAPEntry, error) {
+	fields, err := response.Children()
+	if err != nil {
+		return LDAPEntry{}, err
+	}
+	if len(fields) != 2 {
+		return LDAPEntry{}, fmt.Errorf("%w: malformed search result entry", ErrInvalidBER)
+	}
+	attributes, err := fields[1].Children()
+	if err != nil {
+		return LDAPEntry{}, err
+	}
+
+	entry := LDAPEntry{DN: fields[0].String(), Attributes: make(map[string][]string)}
+	for _, attribute := range attributes {
+		parts, err := attribute.Children()
+		if err != nil {
+			return LDAPEntry{}, err
+		}
+		if len(parts) != 2 {
+			return LDAPEntry{}, fmt.Errorf("%w: malformed attribute", ErrInvalidBER)
+		}
+		values, err := parts[1].Children()
+		if err != nil {
+			return LDAPEntry{}, err
+		}
+		name := parts[0].String()
+		for _, value := range values {
+			entry.Attributes[name] = append(entry.Attributes[name], value.String())
+		}
+	}
+	return entry, nil
+}
+
+// EscapeLDAPFilter escapes a value to be put in a search filter, so that
+// user input cannot change the filter (RFC 4515 §3)
+func EscapeLDAPFilter(value string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&escaped, "\\%02x", c)
+		default:
+			escaped.WriteByte(c)
+		}
+	}
+	return escaped.String()
+}
+
+// EncodeLDAPFilter encodes a search filter written as in RFC 4515. It
+// supports the "&", "|" and "!" operators, equality ("(uid=bob)") and
+// presence ("(mail=*)"); substring, ordering, approximate and extensible
+// matches are rejected.
+func EncodeLDAPFilter(filter string) (BERElement, error) {
+	encoded, rest, err := parseLDAPFilter(strings.TrimSpace(filter), 0)
+	if err != nil {
+		return BERElement{}, err
+	}
+	if rest != "" {
+		return BERElement{}, fmt.Errorf("%w: unexpected %q after the filter", ErrInvalidLDAPFilter, rest)
+	}
+	return encoded, nil
+}
+
+// parseLDAPFilter parses the filter at the start of s, and returns the rest
+func parseLDAPFilter(s string, depth int) (BERElement, string, error) {
+	if depth > maxLDAPFilterDepth {
+		return BERElement{}, "", fmt.Errorf("%w: nested too deeply", ErrInvalidLDAPFilter)
+	}
+	if !strings.HasPrefix(s, "(") || len(s) < 2 {
+		return BERElement{}, "", fmt.Errorf("%w: expected '(' at %q", ErrInvalidLDAPFilter, s)
+	}
+	s = s[1:]
+
+	switch s[0] {
+	case '&', '|':
+		tag := byte(LDAPFilterAnd)
+		if s[0] == '|' {
+			tag = LDAPFilterOr
+		}
+		var children []BERElement
+		for s = s[1:]; strings.HasPrefix(s, "("); {
+			child, rest, err := parseLDAPFilter(s, depth+1)
+			if err != nil {
+				return BERElement{}, "", err
+			}
+			children, s = append(children, child), rest
+		}
+		if len(children) == 0 || !strings.HasPrefix(s, ")") {
+			return BERElement{}, "", fmt.Errorf("%w: expected filters and ')' at %q", ErrInvalidLDAPFilter, s)
+		}
+		return NewBERConstructed(tag, children...), s[1:], nil
+	case '!':
+		child, rest, err := parseLDAPFilter(s[1:], depth+1)
+		if err != nil {
+			return BERElement{}, "", err
+		}
+		if !strings.HasPrefix(rest, ")") {
+			return BERElement{}, "", fmt.Errorf("%w: expected ')' at %q", ErrInvalidLDAPFilter, rest)
+		}
+		return NewBERConstructed(LDAPFilterNot, child), rest[1:], nil
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return BERElement{}, "", fmt.Errorf("%w: missing ')'", ErrInvalidLDAPFilter)
+	}
+	item, rest := s[:end], s[end+1:]
+	attribute, value, ok := strings.Cut(item, "=")
+	if !ok || attribute == "" || strings.ContainsAny(attribute, "()*\\<>~: ") || strings.Contains(value, "(") {
+		return BERElement{}, "", fmt.Errorf("%w: unsupported item %q", ErrInvalidLDAPFilter, item)
+	}
+	if value == "*" {
+		return NewBERString(LDAPFilterPresent, attribute), rest, nil
+	}
+	if strings.Contains(value, "*") {
+		return BERElement{}, "", fmt.Errorf("%w: substring matches are not supported", ErrInvalidLDAPFilter)
+	}
+	value, err := unescapeLDAPFilter(value)
+	if err != nil {
+		return BERElement{}, "", err
+	}
+	return NewBERConstructed(LDAPFilterEquality,
+		NewBERString(BERTagOctetString, attribute),
+		NewBERString(BERTagOctetString, value),
+	), rest, nil
+}
+
+// unescapeLDAPFilter decodes the "\xx" escapes of a filter value
+func unescapeLDAPFilter(value string) (string, error) {
+	var unescaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			unescaped.WriteByte(value[i])
+			continue
+		}
+		if i+3 > len(value) {
+			return "", fmt.Errorf("%w: truncated escape in %q", ErrInvalidLDAPFilter, value)
+		}
+		b, err := strconv.ParseUint(value[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid escape in %q", ErrInvalidLDAPFilter, value)
+		}
+		unescaped.WriteByte(byte(b))
+		i += 2
+	}
+	return unescaped.String(), nil
+}
@@ -0,0 +1,355 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+// mmdbMetadataMarker starts the metadata section at the end of a MaxMind DB
+const mmdbMetadataMarker = "\xAB\xCD\xEFMaxMind.com"
+
+// mmdbMaxDepth bounds the nesting of decoded values, so a corrupt file
+// with pointer loops cannot recurse forever
+const mmdbMaxDepth = 32
+
+// Data types of the MaxMind DB data section
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// ErrInvalidMMDB is returned for files that are not valid MaxMind DBs
+var ErrInvalidMMDB = errors.New("invalid MaxMind DB")
+
+// MMDBMetadata describes a MaxMind DB
+type MMDBMetadata struct {
+	DatabaseType string
+	IPVersion    uint
+	NodeCount    uint
+	RecordSize   uint
+	BuildEpoch   uint64
+}
+
+// MMDBReader looks up IP addresses in a database in the MaxMind DB format,
+// the format of the GeoIP2 and GeoLite2 databases. The whole file is kept
+// in memory.
+type MMDBReader struct {
+	Metadata MMDBMetadata
+
+	buffer    []byte
+	data      []byte
+	ipv4Start uint
+}
+
+// OpenMMDB reads a MaxMind DB file
+func OpenMMDB(path string) (*MMDBReader, error) {
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewMMDBReader(buffer)
+}
+
+// NewMMDBReader returns a reader of a MaxMind DB held in memory
+func NewMMDBReader(buffer []byte) (*MMDBReader, error) {
+	start := bytes.LastIndex(buffer, []byte(mmdbMetadataMarker))
+	if start < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", ErrInvalidMMDB)
+	}
+	value, _, err := decodeMMDB(buffer[start+len(mmdbMetadataMarker):], 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalidMMDB)
+	}
+
+	r := &MMDBReader{buffer: buffer}
+	r.Metadata.DatabaseType, _ = fields["database_type"].(string)
+	ipVersion, _ := fields["ip_version"].(uint64)
+	nodeCount, _ := fields["node_count"].(uint64)
+	recordSize, _ := fields["record_size"].(uint64)
+	r.Metadata.BuildEpoch, _ = fields["build_epoch"].(uint64)
+	r.Metadata.IPVersion, r.Metadata.NodeCount, r.Metadata.RecordSize = uint(ipVersion), uint(nodeCount), uint(recordSize)
+	if ipVersion != 4 && ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", ErrInvalidMMDB, ipVersion)
+	}
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidMMDB, recordSize)
+	}
+
+	// The search tree is followed by 16 zero bytes, then the data section
+	treeSize := nodeCount * recordSize / 4
+	if treeSize+16 > uint64(start) {
+		return nil, fmt.Errorf("%w: search tree larger than the file", ErrInvalidMMDB)
+	}
+	r.data = buffer[treeSize+16 : start]
+
+	// IPv4 addresses are found under ::/96 in IPv6 databases
+	if ipVersion == 6 {
+		for i := 0; i < 96 && r.ipv4Start < r.Metadata.NodeCount; i++ {
+			r.ipv4Start = r.readNode(r.ipv4Start, 0)
+		}
+	}
+	return r, nil
+}
+
+// Lookup returns the record of the network containing an IP address, as
+// maps, slices, strings, numbers and booleans, or false if the database
+// has no record for it
+func (r *MMDBReader) Lookup(ip net.IP) (interface{}, bool, error) {
+	address, node := ip.To4(), uint(0)
+	if address != nil {
+		node = r.ipv4Start
+	} else if address = ip.To16(); address == nil {
+		return nil, false, errors.New("invalid IP address")
+	} else if r.Metadata.IPVersion == 4 {
+		return nil, false, errors.New("IPv6 address looked up in an IPv4 database")
+	}
+
+	nodeCount := r.Metadata.NodeCount
+	for i := 0; i < len(address)*8 && node < nodeCount; i++ {
+		node = r.readNode(node, uint(address[i/8]>>(7-i%8))&1)
+	}
+	switch {
+	case node == nodeCount:
+		return nil, false, nil
+	case node < nodeCount:
+		return nil, false, fmt.Errorf("%w: search tree deeper than the address", ErrInvalidMMDB)
+	}
+
+	offset := node - nodeCount - 16
+	if offset >= uint(len(r.data)) {
+		return nil, false, fmt.Errorf("%w: record outside the data section", ErrInvalidMMDB)
+	}
+	value, _, err := decodeMMDB(r.data, offset, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// readNode returns the left (0) or right (1) record of a search tree node
+func (r *MMDBReader) readNode(node, index uint) uint {
+	b := r.buffer
+	switch r.Metadata.RecordSize {
+	case 24:
+		offset := node*6 + index*3
+		return uint(b[offset])<<16 | uint(b[offset+1])<<8 | uint(b[offset+2])
+	case 28:
+		offset := node * 7
+		if index == 0 {
+			return uint(b[offset+3]&0xF0)<<20 | uint(b[offset])<<16 | uint(b[offset+1])<<8 | uint(b[offset+2])
+		}
+		return uint(b[offset+3]&0x0F)<<24 | uint(b[offset+4])<<16 | uint(b[offset+5])<<8 | uint(b[offset+6])
+	default:
+		offset := node*8 + index*4
+		return uint(binary.BigEndian.Uint32(b[offset : offset+4]))
+	}
+}
+
+// decodeMMDB decodes the value at an offset of a data section, following
+// pointers, and returns it with the offset of the next value
+func decodeMMDB(data []byte, offset uint, depth int) (interface{}, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, fmt.Errorf("%w: values nested too deeply", ErrInvalidMMDB)
+	}
+	if offset >= uint(len(data)) {
+		return nil, 0, fmt.Errorf("%w: value outside the data section", ErrInvalidMMDB)
+	}
+	control := data[offset]
+	offset++
+	kind := uint(control >> 5)
+
+	if kind == mmdbPointer {
+		size := uint(control>>3) & 0x3
+		if offset+size+1 > uint(len(data)) {
+			return nil, 0, fmt.Errorf("%w: truncated pointer", ErrInvalidMMDB)
+		}
+		var target uint
+		switch size {
+		case 0:
+			target = uint(control&0x7)<<8 | uint(data[offset])
+		case 1:
+			target = (uint(control&0x7)<<16 | uint(data[offset])<<8 | uint(data[offset+1])) + 2048
+		case 2:
+			target = (uint(control&0x7)<<24 | uint(data[offset])<<16 | uint(data[offset+1])<<8 | uint(data[offset+2])) + 526336
+		default:
+			target = uint(binary.BigEndian.Uint32(data[offset : offset+4]))
+		}
+		value, _, err := decodeMMDB(data, target, depth+1)
+		return value, offset + size + 1, err
+	}
+
+	if kind == mmdbExtended {
+		if offset >= uint(len(data)) {
+			return nil, 0, fmt.Errorf("%w: truncated type", ErrInvalidMMDB)
+		}
+		kind = uint(data[offset]) + 7
+		offset++
+	}
+
+	size := uint(control & 0x1F)
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(data)) {
+			return nil, 0, fmt.Errorf("%w: truncated size", ErrInvalidMMDB)
+		}
+		var value uint
+		for _, b := range data[offset : offset+extra] {
+			value = value<<8 | uint(b)
+		}
+		size = [...]uint{29, 285, 65821}[extra-1] + value
+		offset += extra
+	}
+
+	// Sizes read from corrupt files can be huge, so allocations are bounded
+	// by the size of the data section
+	hint := size
+	if hint > uint(len(data)) {
+		hint = uint(len(data))
+	}
+
+	switch kind {
+	case mmdbMap:
+		fields := make(map[string]interface{}, hint)
+		for i := uint(0); i < size; i++ {
+			key, next, err := decodeMMDB(data, offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", ErrInvalidMMDB)
+			}
+			if fields[name], offset, err = decodeMMDB(data, next, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return fields, offset, nil
+	case mmdbArray:
+		items := make([]interface{}, 0, hint)
+		for i := uint(0); i < size; i++ {
+			item, next, err := decodeMMDB(data, offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items, offset = append(items, item), next
+		}
+		return items, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(data)) {
+		return nil, 0, fmt.Errorf("%w: truncated value", ErrInvalidMMDB)
+	}
+	payload, next := data[offset:offset+size], offset+size
+	switch kind {
+	case mmdbString:
+		return string(payload), next, nil
+	case mmdbBytes:
+		return append([]byte(nil), payload...), next, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: double of %d bytes", ErrInvalidMMDB, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), next, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: float of %d bytes", ErrInvalidMMDB, size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(payload))), next, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("%w: integer of %d bytes", ErrInvalidMMDB, size)
+		}
+		var value uint64
+		for _, b := range payload {
+			value = value<<8 | uint64(b)
+		}
+		return value, next, nil
+	case mmdbInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("%w: integer of %d bytes", ErrInvalidMMDB, size)
+		}
+		var value uint32
+		for _, b := range payload {
+			value = value<<8 | uint32(b)
+		}
+		return int64(int32(value)), next, nil
+	case mmdbUint128:
+		return new(big.Int).SetBytes(payload), next, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unsupported data type %d", ErrInvalidMMDB, kind)
+	}
+}
+
+// MMDBCity is the coarse location of a network in a GeoIP2 or GeoLite2
+// City database
+type MMDBCity struct {
+	// CountryCode is the ISO 3166-1 code of the country
+	CountryCode string
+	Country     string
+	City        string
+	Latitude    float64
+	Longitude   float64
+	// HasCoordinates is false for networks only located to a country
+	HasCoordinates bool
+}
+
+// City looks up the location of an IP address in a City database, with
+// the English names of places. It returns false if the database has no
+// record for the address.
+func (r *MMDBReader) City(ip net.IP) (*MMDBCity, bool, error) {
+	record, found, err := r.Lookup(ip)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	fields, _ := record.(map[string]interface{})
+
+	city := &MMDBCity{}
+	if country, ok := fields["country"].(map[string]interface{}); ok {
+		city.CountryCode, _ = country["iso_code"].(string)
+		city.Country = mmdbName(country)
+	}
+	if place, ok := fields["city"].(map[string]interface{}); ok {
+		city.City = mmdbName(place)
+	}
+	if location, ok := fields["location"].(map[string]interface{}); ok {
+		latitude, hasLatitude := location["latitude"].(float64)
+		longitude, hasLongitude := location["longitude"].(float64)
+		if hasLatitude && hasLongitude {
+			city.Latitude, city.Longitude, city.HasCoordinates = latitude, longitude, true
+		}
+	}
+	return city, true, nil
+}
+
+// mmdbName returns the English name of a place record
+func mmdbName(place map[string]interface{}) string {
+	names, _ := place["names"].(map[string]interface{})
+	name, _ := names["en"].(string)
+	return name
+}
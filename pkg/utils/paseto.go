@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+// Headers of the PASETO version 4 tokens
+const (
+	PASETOv4Local  = "v4.local."
+	PASETOv4Public = "v4.public."
+)
+
+// Sizes of the parts of PASETO version 4 tokens
+const (
+	// PASETOv4KeySize is the size of the keys of v4.local tokens
+	PASETOv4KeySize = 32
+	pasetoNonceSize = 32
+	pasetoTagSize   = 32
+)
+
+// ErrInvalidPASETO is returned for tokens that are not PASETO version 4
+// tokens of the expected purpose, and for those that fail to decrypt or
+// verify
+var ErrInvalidPASETO = errors.New("invalid PASETO token")
+
+// PASETOv4Encrypt returns a v4.local token holding the message, encrypted
+// with XChaCha20 and authenticated with keyed BLAKE2b, along with the
+// footer and the implicit assertion, which is not part of the token but
+// must be given again to decrypt it. The key must be PASETOv4KeySize bytes.
+func PASETOv4Encrypt(key, message, footer, implicit []byte) (string, error) {
+	nonce := make([]byte, pasetoNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return pasetoV4Encrypt(key, nonce, message, footer, implicit)
+}
+
+// pasetoV4Encrypt encrypts the message with the given nonce
+func pasetoV4Encrypt(key, nonce, message, footer, implicit []byte) (string, error) {
+	encryptionKey, counterNonce, authKey, err := pasetoV4SplitKey(key, nonce)
+	if err != nil {
+		return "", err
+	}
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(message))
+	cipher.XORKeyStream(ciphertext, message)
+
+	tag, err := pasetoV4Tag(authKey, nonce, ciphertext, footer, implicit)
+	if err != nil {
+		return "", err
+	}
+	body := append(append(append([]byte{}, nonce...), ciphertext...), tag...)
+	return pasetoToken(PASETOv4Local, body, footer), nil
+}
+
+// PASETOv4Decrypt checks and decrypts a v4.local token with the key and the
+// implicit assertion it was created with, and returns the message and the
+// footer
+func PASETOv4Decrypt(key []byte, token string, implicit []byte) ([]byte, []byte, error) {
+	body, footer, err := pasetoParts(PASETOv4Local, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(body) < pasetoNonceSize+pasetoTagSize {
+		return nil, nil, fmt.Errorf("%w: too short", ErrInvalidPASETO)
+	}
+	nonce := body[:pasetoNonceSize]
+	ciphertext := body[pasetoNonceSize : len(body)-pasetoTagSize]
+	tag := body[len(body)-pasetoTagSize:]
+
+	encryptionKey, counterNonce, authKey, err := pasetoV4SplitKey(key, nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	expected, err := pasetoV4Tag(authKey, nonce, ciphertext, footer, implicit)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare(tag, expected) != 1 {
+		return nil, nil, fmt.Errorf("%w: authentication failed", ErrInvalidPASETO)
+	}
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	message := make([]byte, len(ciphertext))
+	cipher.XORKeyStream(message, ciphertext)
+	return message, footer, nil
+}
+
+// pasetoV4SplitKey derives the encryption key, the XChaCha20 nonce and the
+// authentication key of a v4.local token from its key and nonce
+func pasetoV4SplitKey(key, nonce []byte) ([]byte, []byte, []byte, error) {
+	if len(key) != PASETOv4KeySize {
+		return nil, nil, nil, fmt.Errorf("%w: the key must be %d bytes", ErrInvalidPASETO, PASETOv4KeySize)
+	}
+	encryption, err := blake2b.New(56, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	encryption.Write([]byte("paseto-encryption-key"))
+	encryption.Write(nonce)
+	derived := encryption.Sum(nil)
+
+	auth, err := blake2b.New(32, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	auth.Write([]byte("paseto-auth-key-for-aead"))
+	auth.Write(nonce)
+	return derived[:32], derived[32:], auth.Sum(nil), nil
+}
+
+// pasetoV4Tag returns the authentication tag of a v4.local token
+func pasetoV4Tag(authKey, nonce, ciphertext, footer, implicit []byte) ([]byte, error) {
+	mac, err := blake2b.New(pasetoTagSize, authKey)
+	if err != nil {
+		return nil, err
+	}
+	mac.Write(PASETOPreAuthEncode([]byte(PASETOv4Local), nonce, ciphertext, footer, implicit))
+	return mac.Sum(nil), nil
+}
+
+// PASETOv4Sign returns a v4.public token holding the message, signed with
+// Ed25519 along with the footer and the implicit assertion, which is not
+// part of the token but must be given again to verify it
+func PASETOv4Sign(key ed25519.PrivateKey, message, footer, implicit []byte) string {
+	signature := ed25519.Sign(key, PASETOPreAuthEncode([]byte(PASETOv4Public), message, footer, implicit))
+	return pasetoToken(PASETOv4Public, append(append([]byte{}, message...), signature...), footer)
+}
+
+// PASETOv4Verify checks the signature of a v4.public token with the public
+// key and the implicit assertion it was signed with, and returns the
+// message and the footer
+func PASETOv4Verify(key ed25519.PublicKey, token string, implicit []byte) ([]byte, []byte, error) {
+	body, footer, err := pasetoParts(PASETOv4Public, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(body) < ed25519.SignatureSize {
+		return nil, nil, fmt.Errorf("%w: too short", ErrInvalidPASETO)
+	}
+	message := body[:len(body)-ed25519.SignatureSize]
+	signature := body[len(body)-ed25519.SignatureSize:]
+	if len(key) != ed25519.PublicKeySize ||
+		!ed25519.Verify(key, PASETOPreAuthEncode([]byte(PASETOv4Public), message, footer, implicit), signature) {
+		return nil, nil, fmt.Errorf("%w: invalid signature", ErrInvalidPASETO)
+	}
+	return message, footer, nil
+}
+
+// PASETOFooter returns the footer of a token without checking it, such as
+// to pick the key to check the token with
+func PASETOFooter(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) < 3 || len(parts) > 4 {
+		return nil, ErrInvalidPASETO
+	}
+	if len(parts) == 3 {
+		return nil, nil
+	}
+	footer, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPASETO, err)
+	}
+	return footer, nil
+}
+
+// PASETOPreAuthEncode returns the pre-authentication encoding of the pieces:
+// their count, then each of them prefixed by its length, as unsigned 64
+// bits little-endian integers
+func PASETOPreAuthEncode(pieces ...[]byte) []byte {
+	encoded := binary.LittleEndian.AppendUint64(nil, uint64(len(pieces))&^(1<<63))
+	for _, piece := range pieces {
+		encoded = binary.LittleEndian.AppendUint64(encoded, uint64(len(piece))&^(1<<63))
+		encoded = append(encoded, piece...)
+	}
+	return encoded
+}
+
+// pasetoToken returns a token made of the header, the body and the footer
+func pasetoToken(header string, body, footer []byte) string {
+	token := header + base64.RawURLEncoding.EncodeToString(body)
+	if len(footer) > 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(footer)
+	}
+	return token
+}
+
+// pasetoParts returns the body and the footer of a token with the header
+func pasetoParts(header, token string) ([]byte, []byte, error) {
+	if !strings.HasPrefix(token, header) {
+		return nil, nil, fmt.Errorf("%w: not a %s token", ErrInvalidPASETO, strings.TrimSuffix(header, "."))
+	}
+	encodedBody, encodedFooter, hasFooter := strings.Cut(strings.TrimPrefix(token, header), ".")
+	body, err := base64.RawURLEncoding.DecodeString(encodedBody)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPASETO, err)
+	}
+	var footer []byte
+	if hasFooter {
+		if footer, err = base64.RawURLEncoding.DecodeString(encodedFooter); err != nil || len(footer) == 0 {
+			return nil, nil, fmt.Errorf("%w: invalid footer", ErrInvalidPASETO)
+		}
+	}
+	return body, footer, nil
+}
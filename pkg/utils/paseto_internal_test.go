@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPASETOv4LocalVector(t *testing.T) {
+	// Test vector 4-E-1 of the PASETO specification, which needs the nonce
+	// PASETOv4Encrypt draws at random
+	key, _ := hex.DecodeString("707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f")
+	nonce := make([]byte, pasetoNonceSize)
+	message := []byte(`{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`)
+	expected := "v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQg"
+
+	token, err := pasetoV4Encrypt(key, nonce, message, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, expected, token)
+
+	decrypted, footer, err := PASETOv4Decrypt(key, expected, nil)
+	require.NoError(t, err)
+	assert.Equal(t, message, decrypted)
+	assert.Empty(t, footer)
+}
@@ -0,0 +1,351 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidSCIMFilter is returned for filters that cannot be parsed or
+// applied
+var ErrInvalidSCIMFilter = errors.New("invalid filter")
+
+// SCIMFilter is a parsed SCIM filter (RFC 7644 section 3.4.2.2): a
+// SCIMComparison, SCIMLogical or SCIMNot
+type SCIMFilter interface {
+	scimFilter()
+}
+
+// SCIMComparison compares an attribute with a value. Path is lower-cased,
+// without schema URN, such as "username" or "name.familyname"; attributes
+// inside a value path filter are prefixed with their parent, such as
+// "emails.type". Value is nil for the "pr" operator.
+type SCIMComparison struct {
+	Path     string
+	Operator string
+	Value    interface{}
+}
+
+// SCIMLogical joins two filters with "and" or "or"
+type SCIMLogical struct {
+	Operator    string
+	Left, Right SCIMFilter
+}
+
+// SCIMNot negates a filter
+type SCIMNot struct {
+	Filter SCIMFilter
+}
+
+func (SCIMComparison) scimFilter() {}
+func (SCIMLogical) scimFilter()    {}
+func (SCIMNot) scimFilter()        {}
+
+// scimOperators lists the comparison operators
+var scimOperators = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true, "pr": true,
+}
+
+// SCIMCoreSchemaPrefix starts the fully qualified names of core attributes,
+// such as "urn:ietf:params:scim:schemas:core:2.0:User:userName"
+const SCIMCoreSchemaPrefix = "urn:ietf:params:scim:schemas:core:2.0:"
+
+// ParseSCIMFilter parses a SCIM filter expression. Keywords, operators and
+// attribute names are case-insensitive; "and" binds tighter than "or".
+func ParseSCIMFilter(filter string) (SCIMFilter, error) {
+	tokens, err := tokenizeSCIMFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	parser := &scimFilterParser{tokens: tokens}
+	parsed, err := parser.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(parser.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidSCIMFilter, parser.tokens[parser.pos].text)
+	}
+	return parsed, nil
+}
+
+// SCIMAttributePath returns the lower-cased path of an attribute, without
+// the URN of the core schemas
+func SCIMAttributePath(path string) string {
+	lower := strings.ToLower(path)
+	if strings.HasPrefix(lower, strings.ToLower(SCIMCoreSchemaPrefix)) {
+		// Skip the resource type, such as "User:"
+		rest := lower[len(SCIMCoreSchemaPrefix):]
+		if i := strings.Index(rest, ":"); i >= 0 {
+			return rest[i+1:]
+		}
+	}
+	return lower
+}
+
+// MatchSCIMFilter reports whether a JSON object, such as an element of a
+// multi-valued attribute, satisfies a filter. Paths are looked up
+// relative to the object, ignoring the prefix before the first dot when
+// prefixed is true. String comparisons are case-insensitive.
+func MatchSCIMFilter(filter SCIMFilter, object map[string]interface{}, prefixed bool) bool {
+	switch f := filter.(type) {
+	case SCIMLogical:
+		if f.Operator == "and" {
+			return MatchSCIMFilter(f.Left, object, prefixed) && MatchSCIMFilter(f.Right, object, prefixed)
+		}
+		return MatchSCIMFilter(f.Left, object, prefixed) || MatchSCIMFilter(f.Right, object, prefixed)
+	case SCIMNot:
+		return !MatchSCIMFilter(f.Filter, object, prefixed)
+	case SCIMComparison:
+		path := f.Path
+		if prefixed {
+			if i := strings.Index(path, "."); i >= 0 {
+				path = path[i+1:]
+			}
+		}
+		var value interface{}
+		for key, v := range object {
+			if strings.EqualFold(key, path) {
+				value = v
+			}
+		}
+		return compareSCIMValue(value, f.Operator, f.Value)
+	}
+	return false
+}
+
+// compareSCIMValue applies a comparison operator to a JSON value
+func compareSCIMValue(actual interface{}, operator string, expected interface{}) bool {
+	if operator == "pr" {
+		return actual != nil && actual != ""
+	}
+
+	actualString, actualIsString := actual.(string)
+	expectedString, expectedIsString := expected.(string)
+	if actualIsString && expectedIsString {
+		a, e := strings.ToLower(actualString), strings.ToLower(expectedString)
+		switch operator {
+		case "eq":
+			return a == e
+		case "ne":
+			return a != e
+		case "co":
+			return strings.Contains(a, e)
+		case "sw":
+			return strings.HasPrefix(a, e)
+		case "ew":
+			return strings.HasSuffix(a, e)
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+		return false
+	}
+
+	switch operator {
+	case "eq":
+		return actual == expected
+	case "ne":
+		return actual != expected
+	}
+	return false
+}
+
+// scimToken is a token of a filter; quoted strings keep their quotes so
+// they are not mistaken for keywords
+type scimToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeSCIMFilter splits a filter into brackets, quoted strings and
+// words
+func tokenizeSCIMFilter(filter string) ([]scimToken, error) {
+	var tokens []scimToken
+	runes := []rune(filter)
+	for i := 0; i < len(runes); {
+		switch r := runes[i]; {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("()[]", r):
+			tokens = append(tokens, scimToken{text: string(r)})
+			i++
+		case r == '"':
+			// Find the closing quote, skipping escaped characters
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidSCIMFilter)
+			}
+			tokens = append(tokens, scimToken{text: string(runes[i : j+1]), quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("()[]\"", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, scimToken{text: string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// scimFilterParser is a recursive descent parser over the tokens of a
+// filter
+type scimFilterParser struct {
+	tokens []scimToken
+	pos    int
+}
+
+// peekKeyword reports whether the next token is the unquoted keyword
+func (p *scimFilterParser) peekKeyword(keyword string) bool {
+	return p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, keyword)
+}
+
+// expect consumes the next token, which must be the keyword
+func (p *scimFilterParser) expect(keyword string) error {
+	if !p.peekKeyword(keyword) {
+		return fmt.Errorf("%w: expected %q", ErrInvalidSCIMFilter, keyword)
+	}
+	p.pos++
+	return nil
+}
+
+// parseOr parses "or" expressions. parent is the attribute of the value
+// path being parsed, if any.
+func (p *scimFilterParser) parseOr(parent string) (SCIMFilter, error) {
+	left, err := p.parseAnd(parent)
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd(parent)
+		if err != nil {
+			return nil, err
+		}
+		left = SCIMLogical{Operator: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses "and" expressions
+func (p *scimFilterParser) parseAnd(parent string) (SCIMFilter, error) {
+	left, err := p.parseUnary(parent)
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.pos++
+		right, err := p.parseUnary(parent)
+		if err != nil {
+			return nil, err
+		}
+		left = SCIMLogical{Operator: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseUnary parses negations, groups, value paths and comparisons
+func (p *scimFilterParser) parseUnary(parent string) (SCIMFilter, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected end", ErrInvalidSCIMFilter)
+	}
+
+	switch {
+	case p.peekKeyword("not"):
+		p.pos++
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseOr(parent)
+		if err != nil {
+			return nil, err
+		}
+		return SCIMNot{Filter: inner}, p.expect(")")
+	case p.peekKeyword("("):
+		p.pos++
+		inner, err := p.parseOr(parent)
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	}
+
+	token := p.tokens[p.pos]
+	if token.quoted || strings.ContainsAny(token.text, "()[]") {
+		return nil, fmt.Errorf("%w: expected an attribute, got %q", ErrInvalidSCIMFilter, token.text)
+	}
+	p.pos++
+	path := SCIMAttributePath(token.text)
+	if parent != "" {
+		path = parent + "." + path
+	}
+
+	// A value path filters the elements of a multi-valued attribute
+	if p.peekKeyword("[") {
+		if parent != "" {
+			return nil, fmt.Errorf("%w: nested value paths", ErrInvalidSCIMFilter)
+		}
+		p.pos++
+		inner, err := p.parseOr(path)
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect("]")
+	}
+
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].quoted {
+		return nil, fmt.Errorf("%w: expected an operator after %q", ErrInvalidSCIMFilter, token.text)
+	}
+	operator := strings.ToLower(p.tokens[p.pos].text)
+	if !scimOperators[operator] {
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidSCIMFilter, p.tokens[p.pos].text)
+	}
+	p.pos++
+	if operator == "pr" {
+		return SCIMComparison{Path: path, Operator: operator}, nil
+	}
+
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("%w: expected a value after %q", ErrInvalidSCIMFilter, operator)
+	}
+	value, err := parseSCIMValue(p.tokens[p.pos])
+	if err != nil {
+		return nil, err
+	}
+	p.pos++
+	return SCIMComparison{Path: path, Operator: operator, Value: value}, nil
+}
+
+// parseSCIMValue parses a comparison value: a string, number, boolean or
+// null
+func parseSCIMValue(token scimToken) (interface{}, error) {
+	text := token.text
+	if !token.quoted {
+		text = strings.ToLower(text)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, fmt.Errorf("%w: invalid value %s", ErrInvalidSCIMFilter, token.text)
+	}
+	if _, isObject := value.(map[string]interface{}); isObject {
+		return nil, fmt.Errorf("%w: invalid value %s", ErrInvalidSCIMFilter, token.text)
+	}
+	if _, isArray := value.([]interface{}); isArray {
+		return nil, fmt.Errorf("%w: invalid value %s", ErrInvalidSCIMFilter, token.text)
+	}
+	return value, nil
+}
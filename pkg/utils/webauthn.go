@@ -0,0 +1,282 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms of the WebAuthn credentials accepted (RFC 9053)
+const (
+	COSEAlgES256 = -7
+	COSEAlgEdDSA = -8
+	COSEAlgRS256 = -257
+)
+
+// COSE key types and curves
+const (
+	coseKeyTypeOKP   = 1
+	coseKeyTypeEC2   = 2
+	coseKeyTypeRSA   = 3
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+// Flags of the WebAuthn authenticator data
+const (
+	// AuthenticatorUserPresent is set when the user touched the
+	// authenticator
+	AuthenticatorUserPresent = 0x01
+	// AuthenticatorUserVerified is set when the authenticator verified the
+	// user, with a PIN or biometrics
+	AuthenticatorUserVerified = 0x04
+	// AuthenticatorBackupEligible is set for credentials that can be synced
+	// between devices, such as most passkeys
+	AuthenticatorBackupEligible = 0x08
+	// AuthenticatorBackedUp is set for credentials currently synced
+	AuthenticatorBackedUp = 0x10
+	// AuthenticatorAttestedData is set when a new credential follows
+	AuthenticatorAttestedData = 0x40
+	// AuthenticatorExtensionData is set when extension outputs follow
+	AuthenticatorExtensionData = 0x80
+)
+
+// ErrInvalidWebAuthn is returned for WebAuthn messages that cannot be
+// parsed, and for signatures that do not verify
+var ErrInvalidWebAuthn = errors.New("invalid WebAuthn data")
+
+// AuthenticatorData is the data an authenticator signs (WebAuthn §6.1)
+type AuthenticatorData struct {
+	// RPIDHash is the SHA-256 hash of the relying party ID the credential
+	// is scoped to
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+	// The attested credential data, set when a credential is created
+	AAGUID       []byte
+	CredentialID []byte
+	// PublicKey is the COSE key of the credential
+	PublicKey []byte
+}
+
+// Has reports whether a flag of the authenticator data is set
+func (d *AuthenticatorData) Has(flag byte) bool {
+	return d.Flags&flag != 0
+}
+
+// ParseAuthenticatorData parses the authenticator data of an attestation or
+// assertion
+func ParseAuthenticatorData(data []byte) (*AuthenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidWebAuthn)
+	}
+	authData := &AuthenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+	if authData.Has(AuthenticatorAttestedData) {
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidWebAuthn)
+		}
+		authData.AAGUID = rest[:16]
+		length := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if length == 0 || length > 1023 || len(rest) < length {
+			return nil, fmt.Errorf("%w: invalid credential ID", ErrInvalidWebAuthn)
+		}
+		authData.CredentialID, rest = rest[:length], rest[length:]
+
+		// The key is followed by the extensions, if any
+		_, after, err := DecodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: credential public key: %v", ErrInvalidWebAuthn, err)
+		}
+		authData.PublicKey, rest = rest[:len(rest)-len(after)], after
+	}
+	if authData.Has(AuthenticatorExtensionData) {
+		_, after, err := DecodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: extensions: %v", ErrInvalidWebAuthn, err)
+		}
+		rest = after
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: trailing bytes in authenticator data", ErrInvalidWebAuthn)
+	}
+	return authData, nil
+}
+
+// ClientData is the client data of a WebAuthn ceremony, collected by the
+// browser (WebAuthn §5.8.1)
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ParseClientData parses the JSON client data of a ceremony
+func ParseClientData(data []byte) (*ClientData, error) {
+	var clientData ClientData
+	if err := json.Unmarshal(data, &clientData); err != nil {
+		return nil, fmt.Errorf("%w: client data: %v", ErrInvalidWebAuthn, err)
+	}
+	return &clientData, nil
+}
+
+// AttestationObject is the response of an authenticator creating a
+// credential (WebAuthn §6.5)
+type AttestationObject struct {
+	// Format is the attestation statement format, such as "none" or
+	// "packed"
+	Format    string
+	AuthData  []byte
+	Statement map[interface{}]interface{}
+}
+
+// ParseAttestationObject parses the CBOR attestation object of a new
+// credential
+func ParseAttestationObject(data []byte) (*AttestationObject, error) {
+	value, rest, err := DecodeCBOR(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestation object: %v", ErrInvalidWebAuthn, err)
+	}
+	fields, ok := value.(map[interface{}]interface{})
+	if !ok || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: attestation object is not a map", ErrInvalidWebAuthn)
+	}
+	object := &AttestationObject{}
+	object.Format, _ = fields["fmt"].(string)
+	object.AuthData, _ = fields["authData"].([]byte)
+	object.Statement, _ = fields["attStmt"].(map[interface{}]interface{})
+	if object.Format == "" || object.AuthData == nil || object.Statement == nil {
+		return nil, fmt.Errorf("%w: incomplete attestation object", ErrInvalidWebAuthn)
+	}
+	return object, nil
+}
+
+// VerifyAttestation verifies the attestation statement of a new credential,
+// whose public key and algorithm are given, over its authenticator data and
+// the hash of its client data.
+//
+// The "none" format has nothing to verify. The "packed" format is verified
+// with the certificate it carries, or with the credential itself for self
+// attestation; the certificate is not checked against any trust anchor, so
+// attestation only proves the response is consistent, not which
+// authenticator made it. Other formats are rejected.
+func (o *AttestationObject) VerifyAttestation(key crypto.PublicKey, alg int64, clientDataHash []byte) error {
+	switch o.Format {
+	case "none":
+		return nil
+	case "packed":
+		statementAlg, ok := o.Statement["alg"].(int64)
+		signature, _ := o.Statement["sig"].([]byte)
+		if !ok || signature == nil {
+			return fmt.Errorf("%w: incomplete packed attestation", ErrInvalidWebAuthn)
+		}
+		signed := append(append([]byte{}, o.AuthData...), clientDataHash...)
+		chain, hasCertificate := o.Statement["x5c"].([]interface{})
+		if !hasCertificate {
+			if statementAlg != alg {
+				return fmt.Errorf("%w: self attestation algorithm mismatch", ErrInvalidWebAuthn)
+			}
+			return VerifyCOSESignature(key, alg, signed, signature)
+		}
+		if len(chain) == 0 {
+			return fmt.Errorf("%w: empty attestation certificate chain", ErrInvalidWebAuthn)
+		}
+		leaf, _ := chain[0].([]byte)
+		certificate, err := x509.ParseCertificate(leaf)
+		if err != nil {
+			return fmt.Errorf("%w: invalid attestation certificate", ErrInvalidWebAuthn)
+		}
+		return VerifyCOSESignature(certificate.PublicKey, statementAlg, signed, signature)
+	default:
+		return fmt.Errorf("%w: unsupported attestation format %q", ErrInvalidWebAuthn, o.Format)
+	}
+}
+
+// ParseCOSEKey returns the public key of a COSE key (RFC 9052), and its
+// algorithm: ES256 with P-256, EdDSA with Ed25519 or RS256
+func ParseCOSEKey(data []byte) (crypto.PublicKey, int64, error) {
+	value, rest, err := DecodeCBOR(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: COSE key: %v", ErrInvalidWebAuthn, err)
+	}
+	fields, ok := value.(map[interface{}]interface{})
+	if !ok || len(rest) > 0 {
+		return nil, 0, fmt.Errorf("%w: COSE key is not a map", ErrInvalidWebAuthn)
+	}
+	keyType, _ := fields[int64(1)].(int64)
+	alg, _ := fields[int64(3)].(int64)
+	curve, _ := fields[int64(-1)].(int64)
+	first, _ := fields[int64(-1)].([]byte)
+	x, _ := fields[int64(-2)].([]byte)
+	y, _ := fields[int64(-3)].([]byte)
+
+	switch {
+	case keyType == coseKeyTypeEC2 && alg == COSEAlgES256 && curve == coseCurveP256:
+		if len(x) != 32 || len(y) != 32 {
+			break
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			break
+		}
+		return key, alg, nil
+	case keyType == coseKeyTypeOKP && alg == COSEAlgEdDSA && curve == coseCurveEd25519:
+		if len(x) != ed25519.PublicKeySize {
+			break
+		}
+		return ed25519.PublicKey(x), alg, nil
+	case keyType == coseKeyTypeRSA && alg == COSEAlgRS256:
+		// The modulus and exponent are -1 and -2
+		exponent := new(big.Int).SetBytes(x)
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(first)}
+		if key.N.BitLen() < 2048 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			break
+		}
+		key.E = int(exponent.Int64())
+		return key, alg, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unsupported COSE key type %d with algorithm %d", ErrInvalidWebAuthn, keyType, alg)
+	}
+	return nil, 0, fmt.Errorf("%w: malformed COSE key", ErrInvalidWebAuthn)
+}
+
+// VerifyCOSESignature verifies the signature of data with a public key and
+// a COSE algorithm. ES256 signatures are ASN.1 encoded, as in WebAuthn.
+func VerifyCOSESignature(key crypto.PublicKey, alg int64, data, signature []byte) error {
+	valid := false
+	switch alg {
+	case COSEAlgES256:
+		if ecdsaKey, ok := key.(*ecdsa.PublicKey); ok && ecdsaKey.Curve == elliptic.P256() {
+			digest := sha256.Sum256(data)
+			valid = ecdsa.VerifyASN1(ecdsaKey, digest[:], signature)
+		}
+	case COSEAlgEdDSA:
+		if edKey, ok := key.(ed25519.PublicKey); ok {
+			valid = ed25519.Verify(edKey, data, signature)
+		}
+	case COSEAlgRS256:
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			digest := sha256.Sum256(data)
+			valid = rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature) == nil
+		}
+	}
+	if !valid {
+		return fmt.Errorf("%w: signature does not verify", ErrInvalidWebAuthn)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package database_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/database"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB opens an in-memory SQLite database with the User table
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.User{}))
+	return db
+}
+
+func TestNormalizeUsernamesMigration(t *testing.T) {
+	db := openTestDB(t)
+	assert.NoError(t, db.Create(&models.User{Username: "Alice", Password: "x"}).Error)
+	assert.NoError(t, db.Create(&models.User{Username: "Bob", Password: "x"}).Error)
+
+	assert.NoError(t, database.RunMigrations(db))
+
+	var alice models.User
+	assert.NoError(t, db.Where("username = ?", "Alice").First(&alice).Error)
+	assert.Equal(t, "alice", alice.NormalizedUsername)
+	assert.Equal(t, "alice", alice.UsernameSkeleton)
+
+	// The unique index now rejects usernames differing only by case
+	err := db.Create(&models.User{Username: "ALICE", Password: "x", NormalizedUsername: "alice"}).Error
+	assert.Error(t, err)
+}
+
+func TestNormalizeUsernamesMigrationPendingOnCollisions(t *testing.T) {
+	db := openTestDB(t)
+	for _, username := range []string{"Alice", "alice", "Ａｌｉｃｅ", "Bob"} {
+		assert.NoError(t, db.Create(&models.User{Username: username, Password: "x"}).Error)
+	}
+
+	assert.NoError(t, database.RunMigrations(db))
+
+	collisions, err := database.ReportUsernameCollisions(db, "normalized_username")
+	assert.NoError(t, err)
+	assert.Equal(t, []database.UsernameCollision{
+		{Key: "alice", Usernames: []string{"Alice", "alice", "Ａｌｉｃｅ"}},
+	}, collisions)
+
+	// The migration is retried once the collisions are resolved
+	var applied int64
+	db.Model(&database.SchemaMigration{}).Where("id = ?", "0001_normalize_usernames").Count(&applied)
+	assert.Equal(t, int64(0), applied)
+
+	assert.NoError(t, db.Where("username <> ?", "Alice").Where("normalized_username = ?", "alice").Delete(&models.User{}).Error)
+	assert.NoError(t, database.RunMigrations(db))
+	db.Model(&database.SchemaMigration{}).Where("id = ?", "0001_normalize_usernames").Count(&applied)
+	assert.Equal(t, int64(1), applied)
+}
+
+func TestDefaultOrganizationMigration(t *testing.T) {
+	db := openTestDB(t)
+	assert.NoError(t, db.AutoMigrate(&models.Group{}, &models.Organization{}, &models.Membership{}))
+	assert.NoError(t, db.Create(&models.User{Username: "alice", Password: "x", Role: models.RoleAdmin}).Error)
+	assert.NoError(t, db.Create(&models.User{Username: "bob", Password: "x"}).Error)
+	assert.NoError(t, db.Create(&models.Group{DisplayName: "Guides"}).Error)
+
+	assert.NoError(t, database.RunMigrations(db))
+
+	// Existing users and groups moved to the default organization
+	var organization models.Organization
+	assert.NoError(t, db.Where("slug = ?", database.DefaultOrganization).First(&organization).Error)
+	var memberships []models.Membership
+	assert.NoError(t, db.Order("user_id").Find(&memberships).Error)
+	if assert.Len(t, memberships, 2) {
+		assert.Equal(t, organization.ID, memberships[0].OrganizationID)
+		assert.Equal(t, models.OrgRoleOwner, memberships[0].Role)
+		assert.Equal(t, models.OrgRoleMember, memberships[1].Role)
+	}
+	var group models.Group
+	assert.NoError(t, db.First(&group).Error)
+	assert.Equal(t, organization.ID, group.OrganizationID)
+
+	// Nothing is created without data to move
+	empty := openTestDB(t)
+	assert.NoError(t, empty.AutoMigrate(&models.Organization{}, &models.Membership{}))
+	assert.NoError(t, database.RunMigrations(empty))
+	var count int64
+	empty.Model(&models.Organization{}).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestDefaultOrganizationMigrationRunsWhileUsernamesPending(t *testing.T) {
+	db := openTestDB(t)
+	assert.NoError(t, db.AutoMigrate(&models.Group{}, &models.Organization{}, &models.Membership{}))
+	assert.NoError(t, db.Exec("CREATE UNIQUE INDEX idx_groups_display_name ON groups (display_name)").Error)
+	for _, username := range []string{"Alice", "alice"} {
+		assert.NoError(t, db.Create(&models.User{Username: username, Password: "x"}).Error)
+	}
+	assert.NoError(t, db.Create(&models.Group{DisplayName: "Guides"}).Error)
+
+	assert.NoError(t, database.RunMigrations(db))
+
+	// The usernames still collide, but the groups moved all the same
+	var applied []string
+	db.Model(&database.SchemaMigration{}).Pluck("id", &applied)
+	assert.Equal(t, []string{"0002_default_organization"}, applied)
+
+	var group models.Group
+	assert.NoError(t, db.First(&group).Error)
+	assert.NotZero(t, group.OrganizationID)
+	assert.False(t, db.Migrator().HasIndex(&models.Group{}, "idx_groups_display_name"))
+}
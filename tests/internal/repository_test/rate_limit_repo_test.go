@@ -0,0 +1,79 @@
+package repository_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// rateLimitBackends returns every RateLimitRepository implementation, so the
+// same behaviour is checked against each of them
+func rateLimitBackends(t *testing.T) map[string]repository.RateLimitRepository {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return map[string]repository.RateLimitRepository{
+		"memory": repository.NewMemoryRateLimitRepository(),
+		"redis":  repository.NewRedisRateLimitRepository(client),
+	}
+}
+
+func TestRateLimitRepositoryBurstAndRefill(t *testing.T) {
+	policy := models.RateLimitPolicy{Limit: 3, Period: 3 * time.Second}
+	now := time.Unix(1700000000, 0)
+
+	for name, repo := range rateLimitBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			// The whole burst is available straight away
+			for i := 2; i >= 0; i-- {
+				result, err := repo.Take("login|1.2.3.4", policy, now)
+				assert.NoError(t, err)
+				assert.True(t, result.Allowed)
+				assert.Equal(t, i, result.Remaining)
+			}
+
+			// The next request has to wait for one emission interval
+			result, err := repo.Take("login|1.2.3.4", policy, now)
+			assert.NoError(t, err)
+			assert.False(t, result.Allowed)
+			assert.Equal(t, time.Second, result.RetryAfter)
+			assert.Equal(t, 3*time.Second, result.ResetAfter)
+
+			// Other keys have their own bucket
+			result, err = repo.Take("login|5.6.7.8", policy, now)
+			assert.NoError(t, err)
+			assert.True(t, result.Allowed)
+
+			// A single request is refilled after one interval
+			result, err = repo.Take("login|1.2.3.4", policy, now.Add(time.Second))
+			assert.NoError(t, err)
+			assert.True(t, result.Allowed)
+			assert.Equal(t, 0, result.Remaining)
+		})
+	}
+}
+
+func TestRateLimitRepositoryCustomBurst(t *testing.T) {
+	policy := models.RateLimitPolicy{Limit: 1, Burst: 2, Period: time.Minute}
+	now := time.Unix(1700000000, 0)
+
+	for name, repo := range rateLimitBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				result, err := repo.Take("add|42", policy, now)
+				assert.NoError(t, err)
+				assert.True(t, result.Allowed)
+			}
+
+			result, err := repo.Take("add|42", policy, now)
+			assert.NoError(t, err)
+			assert.False(t, result.Allowed)
+			assert.Equal(t, time.Minute, result.RetryAfter)
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package repository_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/internal/tenant"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"testing"
+	"time"
+)
+
+// tenantFixture holds two organizations sharing a database: alice belongs
+// to acme, bob to globex, and carol to both. Each organization has a group
+// named "Staff".
+type tenantFixture struct {
+	db                     *gorm.DB
+	users                  *repository.PostgresUserRepository
+	organizations          *repository.PostgresOrganizationRepository
+	groups                 *repository.PostgresGroupRepository
+	acme, globex           context.Context
+	alice, bob, carol      models.User
+	acmeGroup, globexGroup models.Group
+}
+
+// newTenantFixture creates the organizations, users and groups of a
+// tenantFixture in an in-memory SQLite database
+func newTenantFixture(t *testing.T) *tenantFixture {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard, TranslateError: true})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Organization{}, &models.Membership{}, &models.Group{}))
+
+	f := &tenantFixture{
+		db:            db,
+		users:         &repository.PostgresUserRepository{DB: db},
+		organizations: &repository.PostgresOrganizationRepository{DB: db},
+		groups:        &repository.PostgresGroupRepository{DB: db},
+	}
+	f.alice.Username, f.bob.Username, f.carol.Username = "alice", "bob", "carol"
+	for _, user := range []*models.User{&f.alice, &f.bob, &f.carol} {
+		user.NormalizedUsername = user.Username
+		require.NoError(t, db.Create(user).Error)
+	}
+
+	acme := &models.Organization{Name: "Acme", Slug: "acme"}
+	require.NoError(t, f.organizations.CreateOrganization(acme, &models.Membership{UserID: f.alice.ID, Role: models.OrgRoleOwner}))
+	globex := &models.Organization{Name: "Globex", Slug: "globex"}
+	require.NoError(t, f.organizations.CreateOrganization(globex, &models.Membership{UserID: f.bob.ID, Role: models.OrgRoleOwner}))
+	f.acme = tenant.WithOrganization(context.Background(), acme.ID)
+	f.globex = tenant.WithOrganization(context.Background(), globex.ID)
+	require.NoError(t, f.organizations.AddMember(f.acme, &models.Membership{UserID: f.carol.ID, Role: models.OrgRoleMember}))
+	require.NoError(t, f.organizations.AddMember(f.globex, &models.Membership{UserID: f.carol.ID, Role: models.OrgRoleAdmin}))
+
+	f.acmeGroup = models.Group{DisplayName: "Staff", Members: []models.User{f.alice, f.carol}}
+	require.NoError(t, f.groups.CreateGroup(f.acme, &f.acmeGroup))
+	f.globexGroup = models.Group{DisplayName: "Staff", Members: []models.User{f.bob}}
+	require.NoError(t, f.groups.CreateGroup(f.globex, &f.globexGroup))
+	return f
+}
+
+// usernames returns the usernames of the members
+func usernames(memberships []models.Membership) []string {
+	var names []string
+	for _, membership := range memberships {
+		names = append(names, membership.User.Username)
+	}
+	return names
+}
+
+func TestUsersAreScopedToTenant(t *testing.T) {
+	f := newTenantFixture(t)
+
+	users, err := f.users.GetAllUsers(f.acme)
+	require.NoError(t, err)
+	var names []string
+	for _, user := range users {
+		names = append(names, user.Username)
+	}
+	assert.Equal(t, []string{"alice", "carol"}, names)
+
+	members, err := f.organizations.ListMembers(f.globex)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob", "carol"}, usernames(members))
+
+	// Members of another organization cannot be read, even by ID or filter
+	membership, err := f.organizations.GetMembership(f.acme, f.bob.ID)
+	require.NoError(t, err)
+	assert.Nil(t, membership)
+	membership, err = f.organizations.GetMembership(f.globex, f.carol.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrgRoleAdmin, membership.Role)
+
+	filter, err := utils.ParseSCIMFilter(`userName eq "bob" or userName eq "carol"`)
+	require.NoError(t, err)
+	found, total, err := f.organizations.SearchMembers(f.acme, filter, 0, 10)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, total)
+	assert.Equal(t, []string{"carol"}, usernames(found))
+}
+
+func TestGroupsAreScopedToTenant(t *testing.T) {
+	f := newTenantFixture(t)
+
+	// Groups of another organization cannot be read
+	group, err := f.groups.GetGroup(f.acme, f.globexGroup.ID)
+	require.NoError(t, err)
+	assert.Nil(t, group)
+	group, err = f.groups.GetGroup(f.acme, f.acmeGroup.ID)
+	require.NoError(t, err)
+	assert.Len(t, group.Members, 2)
+
+	groups, total, err := f.groups.SearchGroups(f.globex, nil, 0, 10)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, total)
+	assert.Equal(t, f.globexGroup.ID, groups[0].ID)
+
+	// Carol only sees the groups of the organization she acts in
+	groups, err = f.groups.ListGroupsByUser(f.globex, f.carol.ID)
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+	groups, err = f.groups.ListGroupsByUser(f.acme, f.carol.ID)
+	require.NoError(t, err)
+	assert.Len(t, groups, 1)
+
+	// Groups of another organization cannot be changed either
+	f.globexGroup.DisplayName = "Renamed"
+	assert.Error(t, f.groups.UpdateGroup(f.acme, &f.globexGroup))
+	assert.NoError(t, f.groups.DeleteGroup(f.acme, f.globexGroup.ID))
+	group, err = f.groups.GetGroup(f.globex, f.globexGroup.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Staff", group.DisplayName)
+}
+
+func TestMembersAreChangedWithinTenant(t *testing.T) {
+	f := newTenantFixture(t)
+
+	// Removing carol from acme leaves her globex membership and groups alone
+	require.NoError(t, f.organizations.RemoveMember(f.acme, f.carol.ID))
+	membership, err := f.organizations.GetMembership(f.globex, f.carol.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, membership)
+	group, err := f.groups.GetGroup(f.acme, f.acmeGroup.ID)
+	require.NoError(t, err)
+	assert.Len(t, group.Members, 1)
+
+	// Memberships of another organization cannot be updated
+	membership.Role = models.OrgRoleOwner
+	assert.Error(t, f.organizations.UpdateMember(f.acme, membership))
+	membership, err = f.organizations.GetMembership(f.globex, f.carol.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrgRoleAdmin, membership.Role)
+}
+
+func TestQueriesWithoutTenantFail(t *testing.T) {
+	f := newTenantFixture(t)
+	ctx := context.Background()
+
+	_, err := f.users.GetAllUsers(ctx)
+	assert.ErrorIs(t, err, tenant.ErrNoTenant)
+	_, err = f.organizations.ListMembers(ctx)
+	assert.ErrorIs(t, err, tenant.ErrNoTenant)
+	_, err = f.organizations.GetMembership(ctx, f.alice.ID)
+	assert.ErrorIs(t, err, tenant.ErrNoTenant)
+	_, _, err = f.organizations.SearchMembers(ctx, nil, 0, 10)
+	assert.ErrorIs(t, err, tenant.ErrNoTenant)
+	_, err = f.groups.GetGroup(ctx, f.acmeGroup.ID)
+	assert.ErrorIs(t, err, tenant.ErrNoTenant)
+	_, _, err = f.groups.SearchGroups(ctx, nil, 0, 10)
+	assert.ErrorIs(t, err, tenant.ErrNoTenant)
+	assert.ErrorIs(t, f.groups.CreateGroup(ctx, &models.Group{DisplayName: "Orphans"}), tenant.ErrNoTenant)
+}
+
+func TestUserRecordsAreKeyedByUser(t *testing.T) {
+	// Sessions, tokens, logins and consents are not scoped to a tenant but
+	// to their user, so nobody reaches those of another organization's user
+	f := newTenantFixture(t)
+	require.NoError(t, f.db.AutoMigrate(&models.Session{}, &models.PersonalAccessToken{}, &models.LoginAttempt{}, &models.OAuthConsent{}))
+	now := time.Now()
+
+	sessions := &repository.PostgresSessionRepository{DB: f.db}
+	aliceSession := models.Session{UserID: f.alice.ID, ExpiresAt: now.Add(time.Hour)}
+	bobSession := models.Session{UserID: f.bob.ID, ExpiresAt: now.Add(time.Hour)}
+	require.NoError(t, sessions.CreateSession(&aliceSession))
+	require.NoError(t, sessions.CreateSession(&bobSession))
+	active, err := sessions.ListActiveSessions(f.alice.ID, now)
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+	assert.Equal(t, aliceSession.ID, active[0].ID)
+	revoked, err := sessions.RevokeSession(f.alice.ID, bobSession.ID, now)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	tokens := &repository.PostgresAccessTokenRepository{DB: f.db}
+	acmeID, _ := tenant.OrganizationID(f.acme)
+	globexID, _ := tenant.OrganizationID(f.globex)
+	aliceToken := models.PersonalAccessToken{UserID: f.alice.ID, OrganizationID: &acmeID, Name: "ci", TokenHash: "a", ExpiresAt: now.Add(time.Hour)}
+	bobToken := models.PersonalAccessToken{UserID: f.bob.ID, OrganizationID: &globexID, Name: "ci", TokenHash: "b", ExpiresAt: now.Add(time.Hour)}
+	require.NoError(t, tokens.CreateToken(&aliceToken))
+	require.NoError(t, tokens.CreateToken(&bobToken))
+	listed, err := tokens.ListTokensByUser(f.alice.ID)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, aliceToken.ID, listed[0].ID)
+	revoked, err = tokens.RevokeToken(f.alice.ID, bobToken.ID, now)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	logins := &repository.PostgresLoginAttemptRepository{DB: f.db}
+	require.NoError(t, logins.CreateLoginAttempt(&models.LoginAttempt{UserID: &f.alice.ID, Username: "alice", Outcome: models.AuditSuccess}))
+	require.NoError(t, logins.CreateLoginAttempt(&models.LoginAttempt{UserID: &f.bob.ID, Username: "bob", Outcome: models.AuditSuccess}))
+	attempts, err := logins.ListLoginAttempts(f.alice.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+	assert.Equal(t, "alice", attempts[0].Username)
+
+	oauth := &repository.PostgresOAuthRepository{DB: f.db}
+	require.NoError(t, oauth.SaveConsent(&models.OAuthConsent{UserID: f.bob.ID, ClientID: "wiki", Scope: "openid"}))
+	consent, err := oauth.GetConsent(f.alice.ID, "wiki")
+	require.NoError(t, err)
+	assert.Nil(t, consent)
+}
@@ -0,0 +1,110 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newAccessTokenRouter returns a router serving the token handlers to a user
+// authenticated with the given claims
+func newAccessTokenRouter(mockTokens *services_mock.MockAccessTokenService, claims *models.Claims) *gin.Engine {
+	router := gin.Default()
+	router.Use(func(c *gin.Context) { middlewares.SetClaims(c, claims) })
+	router.POST("/api/v1/user/tokens", func(c *gin.Context) { handlers.CreateAccessToken(c, mockTokens) })
+	router.DELETE("/api/v1/user/tokens/:id", func(c *gin.Context) { handlers.RevokeAccessToken(c, mockTokens) })
+	return router
+}
+
+// mockScopedTokens returns an access token service authenticating each token
+// of the map as a personal access token of the user granted the scopes
+func mockScopedTokens(user models.User, tokens map[string]string) *services_mock.MockAccessTokenService {
+	mockTokens := new(services_mock.MockAccessTokenService)
+	id := uint(100)
+	for token, scopes := range tokens {
+		id++
+		mockTokens.On("Authenticate", token, mock.Anything).Return(&models.PersonalAccessToken{ID: id, UserID: user.ID, User: user, Scopes: scopes}, nil)
+	}
+	return mockTokens
+}
+
+func TestCreateAccessToken(t *testing.T) {
+	tests := []struct {
+		name         string
+		claims       *models.Claims
+		body         gin.H
+		expectedCode int
+	}{
+		{
+			name:         "Session",
+			claims:       &models.Claims{Subject: "1", Username: "alice"},
+			body:         gin.H{"name": "ci", "scopes": []string{"users:read"}, "expires_in_days": 30},
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name:         "Missing fields",
+			claims:       &models.Claims{Subject: "1", Username: "alice"},
+			body:         gin.H{"scopes": []string{"users:read"}},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Token cannot escalate its scopes",
+			claims:       &models.Claims{Subject: "1", Username: "alice", Scope: "tokens:write", TokenID: 2},
+			body:         gin.H{"name": "ci", "scopes": []string{"users:read"}, "expires_in_days": 30},
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTokens := new(services_mock.MockAccessTokenService)
+			mockTokens.On("CreateToken", uint(1), uint(0), "ci", []string{"users:read"}, 30*24*time.Hour).
+				Return("bpat_secret", &models.PersonalAccessToken{ID: 3, Name: "ci", DisplayPrefix: "bpat_secret"[:11]}, nil)
+
+			body, _ := json.Marshal(tt.body)
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/tokens", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			newAccessTokenRouter(mockTokens, tt.claims).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedCode == http.StatusCreated {
+				assert.Contains(t, w.Body.String(), `"token":"bpat_secret"`)
+			} else {
+				mockTokens.AssertNotCalled(t, "CreateToken")
+			}
+		})
+	}
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	mockTokens := new(services_mock.MockAccessTokenService)
+	mockTokens.On("RevokeToken", uint(1), uint(3)).Return(nil)
+	mockTokens.On("RevokeToken", uint(1), uint(4)).Return(services.ErrAccessTokenMissing)
+	router := newAccessTokenRouter(mockTokens, &models.Claims{Subject: "1", Username: "alice"})
+
+	for path, expectedCode := range map[string]int{
+		"/api/v1/user/tokens/3":   http.StatusNoContent,
+		"/api/v1/user/tokens/4":   http.StatusNotFound,
+		"/api/v1/user/tokens/abc": http.StatusNotFound,
+	} {
+		req, _ := http.NewRequest(http.MethodDelete, path, nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, expectedCode, w.Code, path)
+	}
+}
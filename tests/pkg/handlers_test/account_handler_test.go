@@ -0,0 +1,144 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newAccountRouter returns a router serving the account handlers to a
+// session of bob, or to his personal access token if accessToken is true
+func newAccountRouter(mockAccounts *services_mock.MockAccountService, accessToken bool) *gin.Engine {
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	account := router.Group("/api/v1/user/account", func(c *gin.Context) {
+		claims := models.Claims{Subject: "7", Username: "bob", Roles: []string{models.RoleUser}}
+		if accessToken {
+			claims.TokenID = 3
+		}
+		middlewares.SetClaims(c, &claims)
+	})
+	account.POST("/profile", func(c *gin.Context) { handlers.UpdateProfile(c, mockAccounts) })
+	account.POST("/password", func(c *gin.Context) { handlers.ChangePassword(c, mockAccounts) })
+	account.POST("/username", func(c *gin.Context) { handlers.ChangeUsername(c, mockAccounts) })
+	router.GET("/api/v1/users/:username", func(c *gin.Context) { handlers.UserProfile(c, mockAccounts) })
+	return router
+}
+
+func TestChangePassword(t *testing.T) {
+	bob := &models.User{Model: gorm.Model{ID: 7}, Username: "bob", SessionVersion: 1}
+
+	mockAccounts := new(services_mock.MockAccountService)
+	mockAccounts.On("ChangePassword", uint(7), "correct horse battery staple", "a brand new passphrase").Return(bob, nil)
+	mockAccounts.On("ChangePassword", uint(7), "wrong password", "a brand new passphrase").Return(nil, services.ErrWrongPassword)
+	router := newAccountRouter(mockAccounts, false)
+
+	// The session making the change gets a new cookie
+	w := postJSON(router, "/api/v1/user/account/password", gin.H{"current_password": "correct horse battery staple", "password": "a brand new passphrase"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "Authorization=")
+	assert.Contains(t, w.Body.String(), "token")
+
+	w = postJSON(router, "/api/v1/user/account/password", gin.H{"current_password": "wrong password", "password": "a brand new passphrase"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = postJSON(router, "/api/v1/user/account/password", gin.H{"password": "a brand new passphrase"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockAccounts.AssertExpectations(t)
+
+	// Personal access tokens cannot take over the account
+	w = postJSON(newAccountRouter(mockAccounts, true), "/api/v1/user/account/password",
+		gin.H{"current_password": "correct horse battery staple", "password": "a brand new passphrase"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockAccounts.AssertNumberOfCalls(t, "ChangePassword", 2)
+}
+
+func TestChangeCredentialsRequiresScope(t *testing.T) {
+	bob := models.User{Model: gorm.Model{ID: 7}, Username: "bob"}
+	mockTokens := mockScopedTokens(bob, map[string]string{"bpat_read": models.ScopeUsersRead})
+	mockAccounts := new(services_mock.MockAccountService)
+	router := gin.New()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.AccessTokenMiddleware(mockTokens))
+	handlers.RegisterAccountRoutes(router, mockAccounts)
+
+	for _, path := range []string{"/api/v1/user/account/password", "/api/v1/user/account/username"} {
+		t.Run(path, func(t *testing.T) {
+			w := sendAuthorized(router, http.MethodPost, path, "bpat_read")
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			assert.Contains(t, w.Header().Get("WWW-Authenticate"), "insufficient_scope")
+		})
+	}
+	mockAccounts.AssertNotCalled(t, "ChangePassword", mock.Anything, mock.Anything, mock.Anything)
+	mockAccounts.AssertNotCalled(t, "ChangeUsername", mock.Anything, mock.Anything)
+}
+
+func TestChangeUsernameAndProfile(t *testing.T) {
+	robert := &models.User{Model: gorm.Model{ID: 7}, Username: "robert"}
+
+	mockAccounts := new(services_mock.MockAccountService)
+	mockAccounts.On("ChangeUsername", uint(7), "robert").Return(robert, "bob", nil)
+	mockAccounts.On("ChangeUsername", uint(7), "carol").Return(nil, "", services.ErrUserExists)
+	mockAccounts.On("ChangeUsername", uint(7), "bob").Return(nil, "", services.ErrSameUsername)
+	mockAccounts.On("UpdateProfile", uint(7), services.Profile{DisplayName: "Robert"}).Return(robert, services.Profile{}, nil)
+	mockAccounts.On("UpdateProfile", uint(7), services.Profile{GivenName: "x"}).Return(nil, services.Profile{}, services.ErrProfileTooLong)
+	router := newAccountRouter(mockAccounts, false)
+
+	tests := []struct {
+		name         string
+		path         string
+		body         gin.H
+		expectedCode int
+	}{
+		{"Rename", "/api/v1/user/account/username", gin.H{"username": "robert"}, http.StatusOK},
+		{"Taken username", "/api/v1/user/account/username", gin.H{"username": "carol"}, http.StatusBadRequest},
+		{"Same username", "/api/v1/user/account/username", gin.H{"username": "bob"}, http.StatusBadRequest},
+		{"Update profile", "/api/v1/user/account/profile", gin.H{"display_name": "Robert"}, http.StatusOK},
+		{"Invalid email", "/api/v1/user/account/profile", gin.H{"email": "not an address"}, http.StatusBadRequest},
+		{"Name too long", "/api/v1/user/account/profile", gin.H{"given_name": "x"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(router, tt.path, tt.body)
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+	mockAccounts.AssertExpectations(t)
+}
+
+func TestUserProfileRedirectsOldUsernames(t *testing.T) {
+	robert := &models.User{Model: gorm.Model{ID: 7}, Username: "robert"}
+
+	mockAccounts := new(services_mock.MockAccountService)
+	mockAccounts.On("ResolveUsername", "bob").Return(robert, true, nil)
+	mockAccounts.On("ResolveUsername", "robert").Return(robert, false, nil)
+	mockAccounts.On("ResolveUsername", "dave").Return(nil, false, services.ErrUsernameUnknown)
+	router := newAccountRouter(mockAccounts, false)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/api/v1/users/bob")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/api/v1/users/robert", w.Header().Get("Location"))
+	w = get("/api/v1/users/robert")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"username":"robert"`)
+	w = get("/api/v1/users/dave")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
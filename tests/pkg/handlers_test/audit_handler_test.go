@@ -0,0 +1,148 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAddUserRecordsAuditEvent(t *testing.T) {
+	router := gin.Default()
+	mockService := new(services_mock.MockUserService)
+	mockAudit := new(services_mock.MockAuditService)
+
+	mockService.On("RegisterUser", "NewUser", "correct horse battery staple").Return(nil)
+	mockService.On("GetUserByUsername", "NewUser").Return(&models.User{Model: gorm.Model{ID: 7}, Username: "NewUser", Role: models.RoleUser}, nil)
+	mockAudit.On("Record", mock.MatchedBy(func(event models.AuditEvent) bool {
+		return event.Action == models.AuditUserCreate &&
+			event.Outcome == models.AuditSuccess &&
+			event.ActorUsername == "admin" && event.ActorID != nil && *event.ActorID == 1 &&
+			event.TargetUsername == "NewUser" && event.TargetID != nil && *event.TargetID == 7 &&
+			event.RequestID == "req-42" && event.UserAgent == "test-agent" &&
+			strings.Contains(event.Changes, `"role":{"from":null,"to":"user"}`)
+	})).Return(nil).Once()
+
+	router.Use(middlewares.RequestIDMiddleware(), middlewares.AuditMiddleware(mockAudit))
+	router.POST("/api/v1/user/add", func(c *gin.Context) {
+		middlewares.SetClaims(c, &models.Claims{Subject: "1", Username: "admin", Roles: []string{models.RoleAdmin}})
+		handlers.AddUser(c, mockService)
+	})
+
+	form := url.Values{}
+	form.Add("username", "NewUser")
+	form.Add("password", "correct horse battery staple")
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/add", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("X-Request-ID", "req-42")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "req-42", w.Header().Get("X-Request-ID"))
+	mockAudit.AssertExpectations(t)
+}
+
+func TestListAuditEvents(t *testing.T) {
+	router := gin.Default()
+	mockAudit := new(services_mock.MockAuditService)
+
+	events := []models.AuditEvent{{ID: 2, Action: models.AuditLogin, Outcome: models.AuditFailure, ActorUsername: "mallory"}}
+	mockAudit.On("ListEvents", models.AuditFilter{
+		Action: models.AuditLogin,
+		Since:  time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		Until:  time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC), // until is inclusive
+		Limit:  100,
+	}).Return(events, nil)
+	mockAudit.On("VerifyChain").Return(&services.AuditVerification{Valid: true, Checked: 2}, nil)
+
+	router.GET("/api/v1/admin/audit", func(c *gin.Context) { handlers.ListAuditEvents(c, mockAudit) })
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/admin/audit?action=user.login&since=2024-05-01&until=2024-05-02", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Events       []models.AuditEvent
+		Verification services.AuditVerification
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "mallory", response.Events[0].ActorUsername)
+	assert.True(t, response.Verification.Valid)
+
+	// Dates must be valid
+	req, _ = http.NewRequest(http.MethodGet, "/api/v1/admin/audit?since=yesterday", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExportAuditEvents(t *testing.T) {
+	router := gin.Default()
+	mockAudit := new(services_mock.MockAuditService)
+
+	mockAudit.On("ListEvents", models.AuditFilter{Actor: "admin"}).Return([]models.AuditEvent{{ID: 1}}, nil)
+	mockAudit.On("VerifyChain").Return(&services.AuditVerification{Valid: true, Checked: 1}, nil)
+
+	router.GET("/api/v1/admin/audit/export", func(c *gin.Context) { handlers.ExportAuditEvents(c, mockAudit) })
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/admin/audit/export?actor=admin&offset=100", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment; filename=\"audit-")
+	assert.Contains(t, w.Body.String(), `"verification":{"valid":true,"checked":1}`)
+}
+
+func TestAuditRoutesRequireScopes(t *testing.T) {
+	admin := models.User{Model: gorm.Model{ID: 1}, Username: "alice", Role: models.RoleAdmin}
+	mockTokens := mockScopedTokens(admin, map[string]string{
+		"bpat_users":  models.ScopeUsersRead + " " + models.ScopeUsersWrite,
+		"bpat_read":   models.ScopeAuditRead,
+		"bpat_export": models.ScopeAuditRead + " " + models.ScopeAuditExport,
+	})
+	mockAudit := new(services_mock.MockAuditService)
+	mockAudit.On("ListEvents", mock.Anything).Return([]models.AuditEvent{{ID: 1}}, nil)
+	mockAudit.On("VerifyChain").Return(&services.AuditVerification{Valid: true, Checked: 1}, nil)
+
+	router := gin.New()
+	router.Use(middlewares.AccessTokenMiddleware(mockTokens))
+	handlers.RegisterAuditRoutes(router, mockAudit)
+
+	tests := []struct {
+		name         string
+		path         string
+		token        string
+		expectedCode int
+	}{
+		{"List without the scope", "/api/v1/admin/audit", "bpat_users", http.StatusForbidden},
+		{"List", "/api/v1/admin/audit", "bpat_read", http.StatusOK},
+		{"Export without the scope", "/api/v1/admin/audit/export", "bpat_read", http.StatusForbidden},
+		{"Export", "/api/v1/admin/audit/export", "bpat_export", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := sendAuthorized(router, http.MethodGet, tt.path, tt.token)
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
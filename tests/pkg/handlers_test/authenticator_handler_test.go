@@ -0,0 +1,59 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"fmt"
+	"html/template"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLoginUsesAuthenticator(t *testing.T) {
+	alice := &models.User{Username: "alice", Status: models.UserStatusActive}
+	alice.ID = 5
+	mockAuthenticator := new(services_mock.MockAuthenticator)
+	mockAuthenticator.On("Authenticate", "alice", "alice-secret").Return(alice, nil)
+	mockAuthenticator.On("Authenticate", "alice", "wrong").Return(alice, services.ErrInvalidCredentials)
+	mockAuthenticator.On("Authenticate", "bob", "bob-secret").
+		Return(nil, fmt.Errorf("%w: connection refused", services.ErrDirectoryUnavailable))
+	mockAuthenticator.On("Authenticate", "carol", "carol-secret").Return(nil, services.ErrDirectoryUserConflict)
+	mockLogins := new(services_mock.MockLoginHistoryService)
+	mockLogins.On("RecordLogin", "alice", alice, mock.Anything, mock.Anything, mock.Anything).Return(&models.LoginAttempt{}, nil)
+	mockLogins.On("RecordLogin", mock.Anything, (*models.User)(nil), models.AuditFailure, mock.Anything, mock.Anything).Return(&models.LoginAttempt{}, nil)
+
+	// The user service is not used to check passwords
+	mockUsers := new(services_mock.MockUserService)
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.SetHTMLTemplate(template.Must(template.New("error.html").Parse(`{{ .error }}`)))
+	router.Use(middlewares.AuthenticatorMiddleware(mockAuthenticator), middlewares.LoginHistoryMiddleware(mockLogins))
+	router.POST("/api/v1/user/login", func(c *gin.Context) { handlers.LoginUser(c, mockUsers) })
+	login := func(username, password string) (int, string) {
+		w := postJSON(router, "/api/v1/user/login", gin.H{"username": username, "password": password, "next": "/api/v1/user/home"})
+		return w.Code, w.Body.String()
+	}
+
+	code, _ := login("alice", "alice-secret")
+	assert.Equal(t, http.StatusSeeOther, code)
+	code, body := login("alice", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Contains(t, body, "Invalid credentials")
+	code, body = login("bob", "bob-secret")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.NotContains(t, body, "connection refused")
+	code, _ = login("carol", "carol-secret")
+	assert.Equal(t, http.StatusForbidden, code)
+
+	mockAuthenticator.AssertExpectations(t)
+	mockLogins.AssertNumberOfCalls(t, "RecordLogin", 4)
+	mockUsers.AssertNotCalled(t, "GetUserByUsername", mock.Anything)
+}
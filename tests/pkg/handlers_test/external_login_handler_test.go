@@ -0,0 +1,167 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newExternalLoginRouter returns a router serving the external login
+// routes behind the given middlewares, with a login.html template showing
+// the error and the providers
+func newExternalLoginRouter(mockLogin *services_mock.MockExternalLoginService, mockAudit *services_mock.MockAuditService, use ...gin.HandlerFunc) *gin.Engine {
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.SetHTMLTemplate(template.Must(template.New("login.html").Parse(
+		`{{ .error }}{{ range .providers }}[{{ .Name }}]{{ end }}`)))
+	router.Use(middlewares.AuditMiddleware(mockAudit))
+	router.Use(use...)
+
+	mockLogin.On("Providers").Return([]services.ExternalProvider{{ID: "corp", Name: "Corp SSO"}})
+	handlers.RegisterExternalLoginRoutes(router, mockLogin)
+	return router
+}
+
+func TestBeginExternalLogin(t *testing.T) {
+	mockLogin := new(services_mock.MockExternalLoginService)
+	router := newExternalLoginRouter(mockLogin, new(services_mock.MockAuditService))
+
+	// Only local pages are kept as the next page
+	mockLogin.On("BeginLogin", "corp", "/oauth2/authorize?client_id=wiki").Return("https://sso.example.com/authorize?state=s", "signed-state", nil)
+	mockLogin.On("BeginLogin", "corp", "").Return("https://sso.example.com/authorize?state=s", "signed-state", nil)
+
+	for _, next := range []string{"%2Foauth2%2Fauthorize%3Fclient_id%3Dwiki", "https%3A%2F%2Fevil.example.com"} {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/user/login/corp?next="+next, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://sso.example.com/authorize?state=s", w.Header().Get("Location"))
+		cookie := w.Header().Get("Set-Cookie")
+		assert.Contains(t, cookie, "external_login=signed-state")
+		assert.Contains(t, cookie, "Path=/api/v1/user/login/")
+		assert.Contains(t, cookie, "HttpOnly")
+		assert.Contains(t, cookie, "SameSite=Lax")
+	}
+	mockLogin.AssertExpectations(t)
+}
+
+func TestCompleteExternalLogin(t *testing.T) {
+	mockLogin := new(services_mock.MockExternalLoginService)
+	mockAudit := new(services_mock.MockAuditService)
+	router := newExternalLoginRouter(mockLogin, mockAudit)
+
+	user := &models.User{Model: gorm.Model{ID: 3}, Username: "alice", Role: models.RoleUser}
+	mockLogin.On("CompleteLogin", "corp", "signed-state", "s", "c").Return(&services.ExternalLogin{
+		User:     user,
+		Identity: &models.Identity{Provider: "corp", Email: "alice@corp.example.com"},
+		Next:     "/oauth2/authorize?client_id=wiki",
+		Created:  true,
+	}, nil)
+	mockAudit.On("Record", mock.MatchedBy(func(event models.AuditEvent) bool {
+		return event.Action == models.AuditRegister && event.TargetUsername == "alice" &&
+			strings.Contains(event.Changes, `"provider":{"from":null,"to":"corp"}`)
+	})).Return(nil).Once()
+	mockAudit.On("Record", mock.MatchedBy(func(event models.AuditEvent) bool {
+		return event.Action == models.AuditLogin && event.Outcome == models.AuditSuccess && event.ActorUsername == "alice"
+	})).Return(nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/user/login/corp/callback?state=s&code=c", nil)
+	req.AddCookie(&http.Cookie{Name: "external_login", Value: "signed-state"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/oauth2/authorize?client_id=wiki", w.Header().Get("Location"))
+	cookies := strings.Join(w.Header().Values("Set-Cookie"), "\n")
+	assert.Contains(t, cookies, "external_login=;")
+	assert.Contains(t, cookies, "Authorization=")
+	mockLogin.AssertExpectations(t)
+	mockAudit.AssertExpectations(t)
+}
+
+func TestCompleteExternalLoginAsksForPasskey(t *testing.T) {
+	mockLogin := new(services_mock.MockExternalLoginService)
+	mockAudit := new(services_mock.MockAuditService)
+	mockPasskeys := new(services_mock.MockWebAuthnService)
+	router := newExternalLoginRouter(mockLogin, mockAudit, middlewares.WebAuthnMiddleware(mockPasskeys))
+
+	user := &models.User{Model: gorm.Model{ID: 3}, Username: "alice", Role: models.RoleUser}
+	mockLogin.On("CompleteLogin", "corp", "signed-state", "s", "c").Return(&services.ExternalLogin{
+		User:     user,
+		Identity: &models.Identity{Provider: "corp", Email: "alice@corp.example.com"},
+		Next:     "/oauth2/authorize?client_id=wiki",
+	}, nil)
+	mockPasskeys.On("BeginSecondFactor", user, "/oauth2/authorize?client_id=wiki").
+		Return(&services.CredentialRequestOptions{Challenge: "challenge", RPID: "localhost"}, nil)
+
+	// The provider alone does not log in a user with a passkey, and the
+	// login is recorded once the passkey confirms it
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/user/login/corp/callback?state=s&code=c", nil)
+	req.Header.Set("Accept", "application/json")
+	req.AddCookie(&http.Cookie{Name: "external_login", Value: "signed-state"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"second_factor":"webauthn"`)
+	assert.NotContains(t, w.Header().Get("Set-Cookie"), "Authorization=")
+	mockPasskeys.AssertExpectations(t)
+	mockAudit.AssertNotCalled(t, "Record", mock.Anything)
+}
+
+func TestCompleteExternalLoginErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		err          error
+		expectedCode int
+		expectedBody string
+	}{
+		{"Provider error", "?error=access_denied", nil, http.StatusUnauthorized, "did not sign you in (access_denied)"},
+		{"Foreign state", "?state=s&code=c", services.ErrExternalLoginState, http.StatusBadRequest, "started in another browser"},
+		{"Unlinked account", "?state=s&code=c", services.ErrIdentityNotLinked, http.StatusForbidden, "not linked to any user"},
+		{"Domain", "?state=s&code=c", services.ErrIdentityDomain, http.StatusForbidden, "cannot sign in"},
+		{"Refused link", "?state=s&code=c", services.ErrIdentityLink, http.StatusForbidden, "cannot be linked"},
+		{"Taken username", "?state=s&code=c", services.ErrUserExists, http.StatusConflict, "contact an admin"},
+		{"Provider failure", "?state=s&code=c", errors.New("token request to corp failed"), http.StatusBadGateway, "please try again"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockLogin := new(services_mock.MockExternalLoginService)
+			mockAudit := new(services_mock.MockAuditService)
+			router := newExternalLoginRouter(mockLogin, mockAudit)
+
+			mockLogin.On("CompleteLogin", "corp", "signed-state", "s", "c").Return(nil, tt.err)
+			mockAudit.On("Record", mock.MatchedBy(func(event models.AuditEvent) bool {
+				return event.Action == models.AuditLogin && event.Outcome == models.AuditFailure && event.ActorID == nil
+			})).Return(nil).Once()
+
+			req, _ := http.NewRequest(http.MethodGet, "/api/v1/user/login/corp/callback"+tt.query, nil)
+			req.AddCookie(&http.Cookie{Name: "external_login", Value: "signed-state"})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.expectedBody)
+			assert.Contains(t, w.Body.String(), "[Corp SSO]")
+			assert.NotContains(t, w.Header().Get("Set-Cookie"), "Authorization=")
+			mockAudit.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// sendAuthorized sends a JSON request with no body and a bearer JWT to the
+// router
+func sendAuthorized(router *gin.Engine, method, path, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestStartImpersonation(t *testing.T) {
+	alice := &models.User{Model: gorm.Model{ID: 1}, Username: "alice", Role: models.RoleAdmin, SessionVersion: 2}
+	bob := &models.User{Model: gorm.Model{ID: 5}, Username: "bob", Role: models.RoleUser}
+	carol := &models.User{Model: gorm.Model{ID: 6}, Username: "carol", Role: models.RoleAdmin}
+	mockImpersonation := new(services_mock.MockImpersonationService)
+	mockImpersonation.On("StartImpersonation", uint(1), uint(5)).Return(alice, bob, nil)
+	mockImpersonation.On("StartImpersonation", uint(1), uint(6)).Return(alice, carol, services.ErrImpersonationTarget)
+	mockImpersonation.On("StartImpersonation", uint(1), uint(9)).Return(alice, nil, services.ErrUserNotFound)
+	mockAudit := new(services_mock.MockAuditService)
+	mockAudit.On("Record", mock.Anything).Return(nil)
+
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.AuditMiddleware(mockAudit))
+	router.POST("/api/v1/admin/users/:id/impersonate", func(c *gin.Context) {
+		middlewares.SetClaims(c, &models.Claims{Subject: "1", Username: "alice", Roles: []string{models.RoleAdmin}, SessionID: 4})
+	}, func(c *gin.Context) { handlers.StartImpersonation(c, mockImpersonation) })
+
+	// A reason is required
+	w := postJSON(router, "/api/v1/admin/users/5/impersonate", gin.H{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The token is the user's, with the admin and their session as actor
+	w = postJSON(router, "/api/v1/admin/users/5/impersonate", gin.H{"reason": "ticket 42"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "Authorization="+response.Token)
+	claims := testutil.VerifyToken(t, response.Token)
+	assert.Equal(t, uint(5), claims.UserID())
+	assert.Equal(t, "bob", claims.Username)
+	assert.Zero(t, claims.SessionID)
+	assert.Equal(t, &models.Actor{Subject: "1", Username: "alice", SessionID: 4, SessionVersion: 2}, claims.Actor)
+
+	event := mockAudit.Calls[0].Arguments.Get(0).(models.AuditEvent)
+	assert.Equal(t, models.AuditImpersonate, event.Action)
+	assert.Equal(t, models.AuditSuccess, event.Outcome)
+	assert.Equal(t, "alice", event.ActorUsername)
+	assert.Equal(t, uint(5), *event.TargetID)
+	assert.Contains(t, event.Changes, "ticket 42")
+
+	// Refusals are recorded too
+	w = postJSON(router, "/api/v1/admin/users/6/impersonate", gin.H{"reason": "ticket 42"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	require.Len(t, mockAudit.Calls, 2)
+	event = mockAudit.Calls[1].Arguments.Get(0).(models.AuditEvent)
+	assert.Equal(t, models.AuditFailure, event.Outcome)
+	assert.Equal(t, "carol", event.TargetUsername)
+
+	w = postJSON(router, "/api/v1/admin/users/9/impersonate", gin.H{"reason": "ticket 42"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Len(t, mockAudit.Calls, 2)
+}
+
+func TestStartImpersonationRejectsAccessTokens(t *testing.T) {
+	mockImpersonation := new(services_mock.MockImpersonationService)
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.POST("/api/v1/admin/users/:id/impersonate", func(c *gin.Context) {
+		middlewares.SetClaims(c, &models.Claims{Subject: "1", Roles: []string{models.RoleAdmin}, Scope: models.ScopeUsersWrite, TokenID: 3})
+	}, func(c *gin.Context) { handlers.StartImpersonation(c, mockImpersonation) })
+
+	w := postJSON(router, "/api/v1/admin/users/5/impersonate", gin.H{"reason": "ticket 42"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockImpersonation.AssertNotCalled(t, "StartImpersonation", mock.Anything, mock.Anything)
+}
+
+func TestStopImpersonation(t *testing.T) {
+	alice := &models.User{Model: gorm.Model{ID: 1}, Username: "alice", Role: models.RoleAdmin, SessionVersion: 2}
+	mockImpersonation := new(services_mock.MockImpersonationService)
+	mockImpersonation.On("StopImpersonation", uint(1)).Return(alice, nil).Once()
+	mockImpersonation.On("StopImpersonation", uint(1)).Return(nil, services.ErrImpersonationNotAllowed)
+	mockAudit := new(services_mock.MockAuditService)
+	mockAudit.On("Record", mock.Anything).Return(nil)
+
+	act := &models.Actor{Subject: "1", Username: "alice", SessionID: 4, SessionVersion: 2}
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.AuditMiddleware(mockAudit))
+	router.POST("/stop", func(c *gin.Context) {
+		middlewares.SetClaims(c, &models.Claims{Subject: "5", Username: "bob", Actor: act})
+	}, func(c *gin.Context) { handlers.StopImpersonation(c, mockImpersonation) })
+	router.POST("/stop-plain", func(c *gin.Context) {
+		middlewares.SetClaims(c, &models.Claims{Subject: "5", Username: "bob"})
+	}, func(c *gin.Context) { handlers.StopImpersonation(c, mockImpersonation) })
+
+	// The admin gets their session back
+	w := postJSON(router, "/stop", gin.H{})
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	claims := testutil.VerifyToken(t, response.Token)
+	assert.Equal(t, uint(1), claims.UserID())
+	assert.Equal(t, uint(4), claims.SessionID)
+	assert.Nil(t, claims.Actor)
+
+	event := mockAudit.Calls[0].Arguments.Get(0).(models.AuditEvent)
+	assert.Equal(t, models.AuditImpersonateEnd, event.Action)
+	assert.Equal(t, uint(1), *event.ActorID)
+	assert.Equal(t, "alice", event.ActorUsername)
+	assert.Equal(t, "bob", event.TargetUsername)
+
+	// Admins who can no longer log in are logged out
+	w = postJSON(router, "/stop", gin.H{})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "Authorization=;")
+
+	w = postJSON(router, "/stop-plain", gin.H{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestImpersonationBlocksSensitiveActions(t *testing.T) {
+	mockAccounts := new(services_mock.MockAccountService)
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	handlers.RegisterAccountRoutes(router, mockAccounts)
+
+	bob := &models.User{Model: gorm.Model{ID: 5}, Username: "bob"}
+	token := testutil.IssueToken(t, services.NewImpersonationClaims(bob, &models.Actor{Subject: "1", Username: "alice"}))
+	for _, path := range []string{"/api/v1/user/account/password", "/api/v1/user/account/username", "/api/v1/user/account/profile"} {
+		w := sendAuthorized(router, http.MethodPost, path, token)
+		assert.Equal(t, http.StatusForbidden, w.Code, path)
+		assert.Contains(t, w.Body.String(), services.ErrImpersonating.Error())
+	}
+	mockAccounts.AssertNotCalled(t, "ChangePassword", mock.Anything, mock.Anything, mock.Anything)
+}
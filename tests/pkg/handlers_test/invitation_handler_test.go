@@ -0,0 +1,97 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newInvitationRouter returns a router serving the invitation handlers, the
+// admin ones to an admin authenticated with the given claims
+func newInvitationRouter(mockInvitations *services_mock.MockInvitationService, claims *models.Claims) *gin.Engine {
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	admin := router.Group("/api/v1/admin/invitations", func(c *gin.Context) { middlewares.SetClaims(c, claims) })
+	admin.POST("", func(c *gin.Context) { handlers.CreateInvitation(c, mockInvitations) })
+	router.POST("/api/v1/user/invitations/:token", func(c *gin.Context) { handlers.AcceptInvitation(c, mockInvitations) })
+	return router
+}
+
+func TestCreateInvitation(t *testing.T) {
+	invitation := &models.Invitation{ID: 4, OrganizationID: 2, Email: "bob@example.com", Role: models.RoleUser,
+		OrgRole: models.OrgRoleMember, ExpiresAt: time.Now().Add(72 * time.Hour)}
+
+	tests := []struct {
+		name         string
+		invitation   *models.Invitation
+		err          error
+		expectedCode int
+	}{
+		{"Success", invitation, nil, http.StatusCreated},
+		{"Pending invitation", nil, services.ErrInvitationExists, http.StatusConflict},
+		{"Unknown role", nil, services.ErrInvalidRole, http.StatusBadRequest},
+		{"Email not sent", invitation, services.ErrInvitationNotSent, http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockInvitations := new(services_mock.MockInvitationService)
+			mockInvitations.On("CreateInvitation", mock.Anything, uint(1), "bob@example.com", models.RoleUser, "").
+				Return(tt.invitation, tt.err)
+
+			router := newInvitationRouter(mockInvitations, &models.Claims{Subject: "1", Username: "alice", Roles: []string{models.RoleAdmin}})
+			w := postJSON(router, "/api/v1/admin/invitations", gin.H{"email": "bob@example.com", "role": models.RoleUser})
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+
+	// Addresses are checked before anything is sent
+	mockInvitations := new(services_mock.MockInvitationService)
+	router := newInvitationRouter(mockInvitations, &models.Claims{Subject: "1", Username: "alice", Roles: []string{models.RoleAdmin}})
+	w := postJSON(router, "/api/v1/admin/invitations", gin.H{"email": "not an address"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockInvitations.AssertNotCalled(t, "CreateInvitation", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	invitation := &models.Invitation{ID: 4, OrganizationID: 2, Email: "bob@example.com", Role: models.RoleUser,
+		OrgRole: models.OrgRoleMember, ExpiresAt: time.Now().Add(time.Hour)}
+	invitation.Organization.Name = "Acme"
+	bob := &models.User{Model: gorm.Model{ID: 7}, Username: "bob", Role: models.RoleUser}
+
+	mockInvitations := new(services_mock.MockInvitationService)
+	mockInvitations.On("GetPendingInvitation", "good").Return(invitation, nil)
+	mockInvitations.On("GetPendingInvitation", "old").Return(nil, services.ErrInvitationExpired)
+	mockInvitations.On("AcceptInvitation", "good", "alice", mock.Anything).Return(nil, nil, services.ErrUserExists)
+	mockInvitations.On("AcceptInvitation", "good", "bob", mock.Anything).Return(bob, invitation, nil)
+	router := newInvitationRouter(mockInvitations, nil)
+
+	// The invitee is logged in
+	w := postJSON(router, "/api/v1/user/invitations/good", gin.H{"username": "bob", "password": "correct horse battery staple"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "Authorization="+response.Token)
+
+	// Taken usernames can be changed and the invitation used again
+	w = postJSON(router, "/api/v1/user/invitations/good", gin.H{"username": "alice", "password": "correct horse battery staple"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/api/v1/user/invitations/old", gin.H{"username": "bob", "password": "correct horse battery staple"})
+	assert.Equal(t, http.StatusGone, w.Code)
+}
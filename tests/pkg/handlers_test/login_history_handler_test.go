@@ -0,0 +1,107 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoginRecordsHistory(t *testing.T) {
+	bob := &models.User{Username: "bob"}
+	bob.ID = 7
+	mockUsers := new(services_mock.MockUserService)
+	mockUsers.On("GetUserByUsername", "bob").Return(bob, nil)
+	mockUsers.On("CheckPassword", bob, "correct horse battery staple").Return(nil)
+	mockLogins := new(services_mock.MockLoginHistoryService)
+	mockLogins.On("RecordLogin", "bob", bob, models.AuditSuccess, "192.0.2.1", "test-agent").
+		Return(&models.LoginAttempt{ID: 3, Alerts: models.LoginAlertNewDevice}, nil)
+
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.LoginHistoryMiddleware(mockLogins))
+	router.POST("/api/v1/user/login", func(c *gin.Context) { handlers.LoginUser(c, mockUsers) })
+
+	form := url.Values{"username": {"bob"}, "password": {"correct horse battery staple"}, "next": {"/api/v1/user/home"}}
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "test-agent")
+	req.RemoteAddr = "192.0.2.1:4321"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	mockLogins.AssertExpectations(t)
+}
+
+func TestListLogins(t *testing.T) {
+	latitude, longitude := 48.8566, 2.3522
+	mockLogins := new(services_mock.MockLoginHistoryService)
+	mockLogins.On("ListLogins", uint(7), mock.Anything).Return([]models.LoginAttempt{
+		{ID: 3, Outcome: models.AuditSuccess, Device: "Firefox on Linux", City: "Paris", Country: "France",
+			Latitude: &latitude, Longitude: &longitude, Alerts: models.LoginAlertImpossibleTravel},
+	}, nil)
+	mockLogins.On("ListLogins", uint(8), mock.Anything).Return(nil, errors.New("database is down"))
+
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.GET("/api/v1/user/account/logins", func(c *gin.Context) {
+		middlewares.SetClaims(c, &models.Claims{Subject: "7", Username: "bob"})
+		handlers.ListLogins(c, mockLogins)
+	})
+	router.GET("/api/v1/admin/users/:id/logins", func(c *gin.Context) {
+		middlewares.SetClaims(c, &models.Claims{Subject: "1", Username: "alice", Roles: []string{models.RoleAdmin}})
+		handlers.ListUserLogins(c, mockLogins)
+	})
+
+	w := sendJSON(router, http.MethodGet, "/api/v1/user/account/logins")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"city":"Paris"`)
+	assert.Contains(t, w.Body.String(), `"alerts":"impossible_travel"`)
+
+	w = sendJSON(router, http.MethodGet, "/api/v1/admin/users/7/logins")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Firefox on Linux")
+
+	w = sendJSON(router, http.MethodGet, "/api/v1/admin/users/8/logins")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "database is down")
+	w = sendJSON(router, http.MethodGet, "/api/v1/admin/users/abc/logins")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	mockLogins.AssertExpectations(t)
+}
+
+func TestAccountPageShowsRecentLogins(t *testing.T) {
+	bob := &models.User{Username: "bob"}
+	bob.ID = 7
+	mockAccounts := new(services_mock.MockAccountService)
+	mockAccounts.On("GetAccount", uint(7)).Return(bob, nil)
+	mockAccounts.On("ListUsernameChanges", uint(7)).Return([]models.UsernameChange{}, nil)
+	mockLogins := new(services_mock.MockLoginHistoryService)
+	mockLogins.On("ListLogins", uint(7), 5).Return([]models.LoginAttempt{{ID: 3, Device: "Safari on iOS", Alerts: models.LoginAlertNewDevice}}, nil)
+
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.LoginHistoryMiddleware(mockLogins))
+	router.GET("/api/v1/user/account", func(c *gin.Context) {
+		middlewares.SetClaims(c, &models.Claims{Subject: "7", Username: "bob"})
+		handlers.AccountPage(c, mockAccounts)
+	})
+
+	w := sendJSON(router, http.MethodGet, "/api/v1/user/account")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"recent_logins":[{"id":3`)
+	assert.Contains(t, w.Body.String(), "Safari on iOS")
+	mockLogins.AssertExpectations(t)
+}
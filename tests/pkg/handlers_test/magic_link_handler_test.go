@@ -0,0 +1,122 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newMagicLinkRouter(mockMagicLinks *services_mock.MockMagicLinkService, use ...gin.HandlerFunc) *gin.Engine {
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(use...)
+	router.POST("/api/v1/user/magic-link", func(c *gin.Context) { handlers.RequestMagicLink(c, mockMagicLinks) })
+	router.POST("/api/v1/user/magic-link/verify", func(c *gin.Context) { handlers.MagicLinkLogin(c, mockMagicLinks) })
+	return router
+}
+
+// postMagicLink posts a JSON body to the router from 192.0.2.1, in a
+// browser holding the given magic link secret, if any
+func postMagicLink(router *gin.Engine, path, body, browserSecret string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.RemoteAddr = "192.0.2.1:4321"
+	if browserSecret != "" {
+		req.AddCookie(&http.Cookie{Name: "magic_link", Value: browserSecret})
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequestMagicLink(t *testing.T) {
+	mockMagicLinks := new(services_mock.MockMagicLinkService)
+	mockMagicLinks.On("RequestLink", "alice", "192.0.2.1", "").Return("new-secret", nil)
+	mockMagicLinks.On("RequestLink", "nobody", "192.0.2.1", "kept-secret").Return("kept-secret", nil)
+	router := newMagicLinkRouter(mockMagicLinks)
+
+	// The browser gets the secret the link is bound to
+	w := postMagicLink(router, "/api/v1/user/magic-link", `{"identifier":"alice"}`, "")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	cookie := w.Header().Get("Set-Cookie")
+	assert.Contains(t, cookie, "magic_link=new-secret")
+	assert.Contains(t, cookie, "Path=/api/v1/user/magic-link")
+	assert.Contains(t, cookie, "HttpOnly")
+	assert.Contains(t, cookie, "SameSite=Lax")
+
+	// Unknown accounts get the same answer
+	notice := w.Body.String()
+	w = postMagicLink(router, "/api/v1/user/magic-link", `{"identifier":"nobody"}`, "kept-secret")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, notice, w.Body.String())
+
+	w = postMagicLink(router, "/api/v1/user/magic-link", `{}`, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockMagicLinks.AssertExpectations(t)
+}
+
+func TestMagicLinkLogin(t *testing.T) {
+	alice := &models.User{Username: "alice", Status: models.UserStatusActive}
+	alice.ID = 3
+	bob := &models.User{Username: "bob", Status: models.UserStatusLocked}
+	bob.ID = 4
+	mockMagicLinks := new(services_mock.MockMagicLinkService)
+	mockMagicLinks.On("ConsumeLink", "good", "secret").Return(alice, nil)
+	mockMagicLinks.On("ConsumeLink", "good", "").Return(nil, services.ErrMagicLinkBrowser)
+	mockMagicLinks.On("ConsumeLink", "used", "secret").Return(nil, services.ErrMagicLinkInvalid)
+	mockMagicLinks.On("ConsumeLink", "locked", "secret").Return(bob, services.ErrAccountLocked)
+	router := newMagicLinkRouter(mockMagicLinks)
+
+	w := postMagicLink(router, "/api/v1/user/magic-link/verify", `{"token":"good"}`, "secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"token":"`)
+	cookies := strings.Join(w.Header().Values("Set-Cookie"), "\n")
+	assert.Contains(t, cookies, "magic_link=;")
+	assert.Contains(t, cookies, "Authorization=")
+
+	w = postMagicLink(router, "/api/v1/user/magic-link/verify", `{"token":"good"}`, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "another browser")
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+
+	w = postMagicLink(router, "/api/v1/user/magic-link/verify", `{"token":"used"}`, "secret")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postMagicLink(router, "/api/v1/user/magic-link/verify", `{"token":"locked"}`, "secret")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "locked")
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+	mockMagicLinks.AssertExpectations(t)
+}
+
+func TestMagicLinkLoginAsksForPasskey(t *testing.T) {
+	alice := &models.User{Username: "alice", Status: models.UserStatusActive}
+	alice.ID = 3
+	mockMagicLinks := new(services_mock.MockMagicLinkService)
+	mockMagicLinks.On("ConsumeLink", "good", "secret").Return(alice, nil)
+	mockPasskeys := new(services_mock.MockWebAuthnService)
+	mockPasskeys.On("BeginSecondFactor", alice, "").
+		Return(&services.CredentialRequestOptions{Challenge: "challenge", RPID: "localhost"}, nil)
+	router := newMagicLinkRouter(mockMagicLinks, middlewares.WebAuthnMiddleware(mockPasskeys))
+
+	// Access to the mailbox alone does not log in a user with a passkey
+	w := postMagicLink(router, "/api/v1/user/magic-link/verify", `{"token":"good"}`, "secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"second_factor":"webauthn"`)
+	assert.NotContains(t, w.Body.String(), `"token":"`)
+	cookies := strings.Join(w.Header().Values("Set-Cookie"), "\n")
+	assert.Contains(t, cookies, "magic_link=;")
+	assert.NotContains(t, cookies, "Authorization=")
+	mockPasskeys.AssertExpectations(t)
+}
@@ -0,0 +1,517 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const authorizeQuery = "/oauth2/authorize?response_type=code&client_id=wiki&redirect_uri=https%3A%2F%2Fwiki.example.com%2Fcb&scope=openid&state=xyz&code_challenge=abc&code_challenge_method=S256"
+
+// sessionCookie returns the session cookie of a logged in user
+func sessionCookie(t *testing.T) *http.Cookie {
+	token := testutil.SessionToken(t, &models.User{Model: gorm.Model{ID: 1}, Username: "alice", Role: models.RoleUser}, 0)
+	return &http.Cookie{Name: "Authorization", Value: token}
+}
+
+// isWikiRequest matches the authorization request of authorizeQuery
+var isWikiRequest = mock.MatchedBy(func(request *services.AuthorizationRequest) bool {
+	return request.ClientID == "wiki" && request.RedirectURI == "https://wiki.example.com/cb" && request.State == "xyz"
+})
+
+var wikiClient = &models.OAuthClient{ClientID: "wiki", Name: "Wiki", RedirectURIs: "https://wiki.example.com/cb"}
+
+func TestAuthorizeRedirectsAnonymousUsersToLogin(t *testing.T) {
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	mockOIDC := new(services_mock.MockOIDCService)
+	handlers.RegisterOIDCRoutes(router, mockOIDC)
+
+	mockOIDC.On("ValidateAuthorizationRequest", isWikiRequest).Return(wikiClient, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, authorizeQuery, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/api/v1/user/login?next="+url.QueryEscape(authorizeQuery), w.Header().Get("Location"))
+}
+
+func TestAuthorizeIssuesCodeWhenConsented(t *testing.T) {
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	mockOIDC := new(services_mock.MockOIDCService)
+	handlers.RegisterOIDCRoutes(router, mockOIDC)
+
+	mockOIDC.On("ValidateAuthorizationRequest", isWikiRequest).Return(wikiClient, nil)
+	mockOIDC.On("NeedsConsent", uint(1), isWikiRequest).Return(false, nil)
+	mockOIDC.On("CreateAuthorizationCode", uint(1), mock.Anything, isWikiRequest).Return("the-code", nil)
+
+	req, _ := http.NewRequest(http.MethodGet, authorizeQuery, nil)
+	req.AddCookie(sessionCookie(t))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://wiki.example.com/cb?code=the-code&state=xyz", w.Header().Get("Location"))
+	mockOIDC.AssertExpectations(t)
+}
+
+func TestAuthorizeSendsErrorsToClient(t *testing.T) {
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	mockOIDC := new(services_mock.MockOIDCService)
+	handlers.RegisterOIDCRoutes(router, mockOIDC)
+
+	mockOIDC.On("ValidateAuthorizationRequest", isWikiRequest).
+		Return(nil, &services.OAuthError{Code: "invalid_scope", Description: "the openid scope is required"})
+
+	req, _ := http.NewRequest(http.MethodGet, authorizeQuery, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	assert.Equal(t, "wiki.example.com", location.Host)
+	assert.Equal(t, "invalid_scope", location.Query().Get("error"))
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+}
+
+func TestAuthorizeConsentDenied(t *testing.T) {
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	mockOIDC := new(services_mock.MockOIDCService)
+	handlers.RegisterOIDCRoutes(router, mockOIDC)
+
+	mockOIDC.On("ValidateAuthorizationRequest", isWikiRequest).Return(wikiClient, nil)
+
+	query, _ := url.Parse(authorizeQuery)
+	form := query.Query()
+	form.Set("decision", "deny")
+	req, _ := http.NewRequest(http.MethodPost, "/oauth2/authorize", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(sessionCookie(t))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), "error=access_denied")
+	mockOIDC.AssertNotCalled(t, "GrantConsent", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAuthorizeRedirectsSuspendedUsersToLogin(t *testing.T) {
+	mockOIDC := new(services_mock.MockOIDCService)
+	mockLifecycle := new(services_mock.MockUserLifecycleService)
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.UserLifecycleMiddleware(mockLifecycle))
+	handlers.RegisterOIDCRoutes(router, mockOIDC)
+
+	mockOIDC.On("ValidateAuthorizationRequest", isWikiRequest).Return(wikiClient, nil)
+	mockLifecycle.On("CheckUser", uint(1)).Return(nil, services.ErrAccountSuspended)
+
+	req, _ := http.NewRequest(http.MethodGet, authorizeQuery, nil)
+	req.AddCookie(sessionCookie(t))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/api/v1/user/login?next="+url.QueryEscape(authorizeQuery), w.Header().Get("Location"))
+	mockOIDC.AssertNotCalled(t, "CreateAuthorizationCode", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAuthorizeConsentRecordsActor(t *testing.T) {
+	mockOIDC := new(services_mock.MockOIDCService)
+	mockAudit := new(services_mock.MockAuditService)
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.AuditMiddleware(mockAudit))
+	handlers.RegisterOIDCRoutes(router, mockOIDC)
+
+	mockOIDC.On("ValidateAuthorizationRequest", isWikiRequest).Return(wikiClient, nil)
+	mockOIDC.On("GrantConsent", uint(1), isWikiRequest, "the-consent-token").Return(nil)
+	mockOIDC.On("CreateAuthorizationCode", uint(1), mock.Anything, isWikiRequest).Return("the-code", nil)
+	mockAudit.On("Record", mock.MatchedBy(func(event models.AuditEvent) bool {
+		return event.Action == models.AuditConsentGrant && event.ActorUsername == "alice" && event.ActorID != nil && *event.ActorID == 1
+	})).Return(nil)
+
+	query, _ := url.Parse(authorizeQuery)
+	form := query.Query()
+	form.Set("decision", "allow")
+	form.Set("consent_token", "the-consent-token")
+	req, _ := http.NewRequest(http.MethodPost, "/oauth2/authorize", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(sessionCookie(t))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://wiki.example.com/cb?code=the-code&state=xyz", w.Header().Get("Location"))
+	mockAudit.AssertExpectations(t)
+}
+
+func TestRegisterOAuthClientRequiresScope(t *testing.T) {
+	admin := models.User{Model: gorm.Model{ID: 1}, Username: "alice", Role: models.RoleAdmin}
+	mockTokens := mockScopedTokens(admin, map[string]string{"bpat_read": models.ScopeUsersRead})
+	mockOIDC := new(services_mock.MockOIDCService)
+	router := gin.New()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.AccessTokenMiddleware(mockTokens))
+	handlers.RegisterOIDCRoutes(router, mockOIDC)
+
+	w := sendAuthorized(router, http.MethodPost, "/api/v1/admin/oauth/clients", "bpat_read")
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockOIDC.AssertNotCalled(t, "RegisterClient", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestToken(t *testing.T) {
+	tests := []struct {
+		name         string
+		response     *services.TokenResponse
+		err          error
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "Success",
+			response:     &services.TokenResponse{AccessToken: "at", TokenType: "Bearer", ExpiresIn: 3600, IDToken: "it", Scope: "openid"},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"access_token":"at","token_type":"Bearer","expires_in":3600,"id_token":"it","scope":"openid"}`,
+		},
+		{
+			name:         "Invalid client",
+			err:          &services.OAuthError{Code: "invalid_client", Description: "client authentication failed"},
+			expectedCode: http.StatusUnauthorized,
+			expectedBody: `{"error":"invalid_client","error_description":"client authentication failed"}`,
+		},
+		{
+			name:         "Invalid grant",
+			err:          &services.OAuthError{Code: "invalid_grant", Description: "the code is invalid"},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"invalid_grant","error_description":"the code is invalid"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.Default()
+			router.Use(testutil.TokenMiddleware())
+			mockOIDC := new(services_mock.MockOIDCService)
+			handlers.RegisterOIDCRoutes(router, mockOIDC)
+
+			// Basic credentials are form encoded and take precedence
+			mockOIDC.On("Exchange", mock.MatchedBy(func(request *services.TokenRequest) bool {
+				return request.ClientID == "wiki" && request.ClientSecret == "s3cret/+" &&
+					request.Code == "the-code" && request.CodeVerifier == "verifier"
+			})).Return(tt.response, tt.err)
+
+			form := url.Values{"grant_type": {"authorization_code"}, "code": {"the-code"}, "code_verifier": {"verifier"}}
+			req, _ := http.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetBasicAuth("wiki", url.QueryEscape("s3cret/+"))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			mockOIDC.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserInfo(t *testing.T) {
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	mockOIDC := new(services_mock.MockOIDCService)
+	handlers.RegisterOIDCRoutes(router, mockOIDC)
+
+	mockOIDC.On("UserInfo", "good").Return(map[string]interface{}{"sub": "1", "preferred_username": "alice"}, nil)
+	mockOIDC.On("UserInfo", "bad").Return(nil, &services.OAuthError{Code: "invalid_token", Description: "the access token is invalid or expired"})
+
+	for token, expectedCode := range map[string]int{"good": http.StatusOK, "bad": http.StatusUnauthorized, "": http.StatusUnauthorized} {
+		req, _ := http.NewRequest(http.MethodGet, "/oauth2/userinfo", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, expectedCode, w.Code, token)
+		if expectedCode == http.StatusOK {
+			var info map[string]interface{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+			assert.Equal(t, "alice", info["preferred_username"])
+		} else {
+			assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+// newDeviceRouter returns a router serving the OIDC routes after the given
+// middlewares, with stand-ins for the templates of the device page
+func newDeviceRouter(mockOIDC *services_mock.MockOIDCService, use ...gin.HandlerFunc) *gin.Engine {
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(use...)
+	templates := template.Must(template.New("device.html").Parse(
+		`{{ .error }}{{ .notice }}{{ with .client }}{{ .Name }} {{ end }}{{ .consentToken }}`))
+	template.Must(templates.New("error.html").Parse(`{{ .error }}`))
+	router.SetHTMLTemplate(templates)
+	handlers.RegisterOIDCRoutes(router, mockOIDC)
+	return router
+}
+
+func TestDeviceAuthorization(t *testing.T) {
+	mockOIDC := new(services_mock.MockOIDCService)
+	router := newDeviceRouter(mockOIDC)
+
+	mockOIDC.On("AuthorizeDevice", &services.DeviceAuthorizationRequest{ClientID: "cli", Scope: "openid"}).Return(&services.DeviceAuthorizationResponse{
+		DeviceCode: "device-code", UserCode: "BCDF-GHJK", VerificationURI: "https://id.example.com/device",
+		VerificationURIComplete: "https://id.example.com/device?user_code=BCDF-GHJK", ExpiresIn: 600, Interval: 5,
+	}, nil)
+	mockOIDC.On("AuthorizeDevice", &services.DeviceAuthorizationRequest{ClientID: "unknown"}).
+		Return(nil, &services.OAuthError{Code: "invalid_client", Description: "unknown client"})
+
+	form := url.Values{"client_id": {"cli"}, "scope": {"openid"}}
+	req, _ := http.NewRequest(http.MethodPost, "/oauth2/device_authorization", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"device_code":"device-code","user_code":"BCDF-GHJK","verification_uri":"https://id.example.com/device",
+		"verification_uri_complete":"https://id.example.com/device?user_code=BCDF-GHJK","expires_in":600,"interval":5}`, w.Body.String())
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	req, _ = http.NewRequest(http.MethodPost, "/oauth2/device_authorization", strings.NewReader("client_id=unknown"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error":"invalid_client","error_description":"unknown client"}`, w.Body.String())
+}
+
+func TestTokenDeviceGrant(t *testing.T) {
+	mockOIDC := new(services_mock.MockOIDCService)
+	router := newDeviceRouter(mockOIDC)
+
+	alice := &models.User{Model: gorm.Model{ID: 1}, Username: "alice", Role: models.RoleUser, Status: models.UserStatusActive}
+	isDeviceCode := func(code string) interface{} {
+		return mock.MatchedBy(func(request *services.TokenRequest) bool {
+			return request.ClientID == "cli" && request.DeviceCode == code
+		})
+	}
+	mockOIDC.On("PollDeviceAuthorization", isDeviceCode("approved")).Return(alice, &services.TokenResponse{
+		TokenType: "Bearer", IDToken: "the-id-token", Scope: "openid",
+	}, nil)
+	mockOIDC.On("PollDeviceAuthorization", isDeviceCode("pending")).
+		Return(nil, nil, &services.OAuthError{Code: "authorization_pending", Description: "the user has not approved the device yet"})
+	mockOIDC.On("PollDeviceAuthorization", isDeviceCode("fast")).
+		Return(nil, nil, &services.OAuthError{Code: "slow_down", Description: "poll at most every 10 seconds"})
+
+	poll := func(code string) *httptest.ResponseRecorder {
+		form := url.Values{"grant_type": {services.DeviceCodeGrantType}, "client_id": {"cli"}, "device_code": {code}}
+		req, _ := http.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Approved devices get a session token limited to the approved scope,
+	// and no cookie
+	w := poll("approved")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tokens services.TokenResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+	assert.Equal(t, services.TokenResponse{
+		AccessToken: tokens.AccessToken, TokenType: "Bearer", ExpiresIn: int(services.SessionLifetime.Seconds()),
+		IDToken: "the-id-token", Scope: "openid",
+	}, tokens)
+	claims, err := services.DefaultTokenService().Verify(tokens.AccessToken)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", claims.Username)
+		assert.Equal(t, "cli", claims.ClientID)
+		assert.Equal(t, "openid", claims.Scope)
+	}
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+
+	w = poll("pending")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"authorization_pending","error_description":"the user has not approved the device yet"}`, w.Body.String())
+	w = poll("fast")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"error":"slow_down"`)
+	mockOIDC.AssertNotCalled(t, "Exchange", mock.Anything)
+}
+
+func TestDeviceTokenReachesTheAPI(t *testing.T) {
+	mockOIDC := new(services_mock.MockOIDCService)
+	router := newDeviceRouter(mockOIDC)
+	api := router.Group("/api/v1/user", middlewares.AuthMiddleware())
+	api.GET("/profile", middlewares.RequireScope(models.ScopeUsersRead), func(c *gin.Context) { c.Status(http.StatusOK) })
+	api.POST("/password", middlewares.RequireScope(models.ScopeUsersWrite), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	alice := &models.User{Model: gorm.Model{ID: 1}, Username: "alice", Role: models.RoleUser, Status: models.UserStatusActive}
+	mockOIDC.On("PollDeviceAuthorization", mock.Anything).Return(alice, &services.TokenResponse{
+		TokenType: "Bearer", Scope: "users:read",
+	}, nil)
+
+	form := url.Values{"grant_type": {services.DeviceCodeGrantType}, "client_id": {"cli"}, "device_code": {"approved"}}
+	req, _ := http.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tokens services.TokenResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+
+	call := func(method, path string) int {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The polled token passes AuthMiddleware, within the approved scope only
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/v1/user/profile"))
+	assert.Equal(t, http.StatusForbidden, call(http.MethodPost, "/api/v1/user/password"))
+}
+
+func TestDevicePage(t *testing.T) {
+	mockOIDC := new(services_mock.MockOIDCService)
+	router := newDeviceRouter(mockOIDC)
+
+	cli := &models.OAuthClient{ClientID: "cli", Name: "Deploy CLI"}
+	mockOIDC.On("PendingDeviceAuthorization", uint(1), "BCDF-GHJK").Return(&models.OAuthDeviceAuthorization{ClientID: "cli"}, cli, nil)
+	mockOIDC.On("PendingDeviceAuthorization", uint(1), "ZZZZ-ZZZZ").Return(nil, nil, services.ErrDeviceCodeInvalid)
+	mockOIDC.On("PendingDeviceAuthorization", uint(1), "XXXX-XXXX").Return(nil, nil, services.ErrDeviceCodeAttempts)
+	mockOIDC.On("DeviceConsentToken", uint(1), "BCDF-GHJK").Return("consent-token")
+
+	// Log in first, then come back
+	req, _ := http.NewRequest(http.MethodGet, "/device?user_code=BCDF-GHJK", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/api/v1/user/login?next="+url.QueryEscape("/device?user_code=BCDF-GHJK"), w.Header().Get("Location"))
+
+	req, _ = http.NewRequest(http.MethodGet, "/device?user_code=BCDF-GHJK", nil)
+	req.AddCookie(sessionCookie(t))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Deploy CLI consent-token", w.Body.String())
+
+	req, _ = http.NewRequest(http.MethodGet, "/device?user_code=ZZZZ-ZZZZ", nil)
+	req.AddCookie(sessionCookie(t))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, services.ErrDeviceCodeInvalid.Error(), w.Body.String())
+
+	// Users entering too many codes must wait
+	req, _ = http.NewRequest(http.MethodGet, "/device?user_code=XXXX-XXXX", nil)
+	req.AddCookie(sessionCookie(t))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, services.ErrDeviceCodeAttempts.Error(), w.Body.String())
+}
+
+func TestDeviceDecision(t *testing.T) {
+	mockOIDC := new(services_mock.MockOIDCService)
+	router := newDeviceRouter(mockOIDC)
+
+	mockOIDC.On("DecideDeviceAuthorization", uint(1), "BCDF-GHJK", true, "consent-token").
+		Return(&models.OAuthDeviceAuthorization{ClientID: "cli", Status: models.DeviceAuthorizationApproved}, nil)
+	mockOIDC.On("DecideDeviceAuthorization", uint(1), "BCDF-GHJK", false, "forged").Return(nil, services.ErrDeviceConsentFailed)
+
+	decide := func(decision, consentToken string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		form := url.Values{"user_code": {"BCDF-GHJK"}, "decision": {decision}, "consent_token": {consentToken}}
+		req, _ := http.NewRequest(http.MethodPost, "/device", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := decide("allow", "consent-token", sessionCookie(t))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "now connected")
+
+	w = decide("deny", "forged", sessionCookie(t))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, services.ErrDeviceConsentFailed.Error(), w.Body.String())
+
+	w = decide("allow", "consent-token", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	mockOIDC.AssertNumberOfCalls(t, "DecideDeviceAuthorization", 2)
+}
+
+func TestDeviceChecksSession(t *testing.T) {
+	mockOIDC := new(services_mock.MockOIDCService)
+	mockLifecycle := new(services_mock.MockUserLifecycleService)
+	mockLifecycle.On("CheckUser", uint(1)).Return(nil, services.ErrAccountSuspended)
+	router := newDeviceRouter(mockOIDC, middlewares.UserLifecycleMiddleware(mockLifecycle))
+
+	// Suspended users are sent to the login form
+	req, _ := http.NewRequest(http.MethodGet, "/device?user_code=BCDF-GHJK", nil)
+	req.AddCookie(sessionCookie(t))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	form := url.Values{"user_code": {"BCDF-GHJK"}, "decision": {"allow"}, "consent_token": {"consent-token"}}
+	req, _ = http.NewRequest(http.MethodPost, "/device", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(sessionCookie(t))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	mockOIDC.AssertNotCalled(t, "PendingDeviceAuthorization", mock.Anything, mock.Anything)
+	mockOIDC.AssertNotCalled(t, "DecideDeviceAuthorization", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDeviceDecisionRecordsActor(t *testing.T) {
+	mockOIDC := new(services_mock.MockOIDCService)
+	mockAudit := new(services_mock.MockAuditService)
+	router := newDeviceRouter(mockOIDC, middlewares.AuditMiddleware(mockAudit))
+
+	mockOIDC.On("DecideDeviceAuthorization", uint(1), "BCDF-GHJK", true, "consent-token").
+		Return(&models.OAuthDeviceAuthorization{ClientID: "cli", Scope: "openid", Status: models.DeviceAuthorizationApproved}, nil)
+	mockAudit.On("Record", mock.MatchedBy(func(event models.AuditEvent) bool {
+		return event.Action == models.AuditDeviceApprove && event.ActorUsername == "alice" && event.ActorID != nil && *event.ActorID == 1
+	})).Return(nil)
+
+	form := url.Values{"user_code": {"BCDF-GHJK"}, "decision": {"allow"}, "consent_token": {"consent-token"}}
+	req, _ := http.NewRequest(http.MethodPost, "/device", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(sessionCookie(t))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockAudit.AssertExpectations(t)
+}
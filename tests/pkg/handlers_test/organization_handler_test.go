@@ -0,0 +1,119 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newOrganizationRouter returns a router serving the organization handlers
+// to a user authenticated with the given claims
+func newOrganizationRouter(mockOrganizations *services_mock.MockOrganizationService, claims *models.Claims) *gin.Engine {
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(func(c *gin.Context) { middlewares.SetClaims(c, claims) })
+	router.POST("/api/v1/user/orgs/switch", func(c *gin.Context) { handlers.SwitchOrganization(c, mockOrganizations) })
+	router.POST("/api/v1/user/orgs/members/:id/role", func(c *gin.Context) { handlers.SetOrganizationMemberRole(c, mockOrganizations) })
+	return router
+}
+
+// postJSON sends a JSON POST request to the router
+func postJSON(router *gin.Engine, path string, body gin.H) *httptest.ResponseRecorder {
+	encoded, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, path, bytes.NewReader(encoded))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSwitchOrganization(t *testing.T) {
+	acme := uint(2)
+	user := &models.User{Model: gorm.Model{ID: 1}, Username: "alice", ActiveOrganizationID: &acme}
+	mockOrganizations := new(services_mock.MockOrganizationService)
+	mockOrganizations.On("SwitchOrganization", uint(1), acme).Return(user, &models.Membership{OrganizationID: acme, UserID: 1, Role: models.OrgRoleAdmin}, nil)
+	mockOrganizations.On("SwitchOrganization", uint(1), uint(3)).Return(nil, nil, services.ErrNotMember)
+
+	session := &models.Claims{Subject: "1", Username: "alice"}
+	router := newOrganizationRouter(mockOrganizations, session)
+
+	// The new session acts in the organization
+	w := postJSON(router, "/api/v1/user/orgs/switch", gin.H{"organization_id": acme})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	claims := testutil.VerifyToken(t, response.Token)
+	assert.Equal(t, acme, claims.OrganizationID)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "Authorization="+response.Token)
+
+	// Organizations of others cannot be switched to
+	w = postJSON(router, "/api/v1/user/orgs/switch", gin.H{"organization_id": 3})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Access tokens stay in the organization they were created in
+	token := &models.Claims{Subject: "1", Username: "alice", Scope: "users:write", TokenID: 4}
+	w = postJSON(newOrganizationRouter(mockOrganizations, token), "/api/v1/user/orgs/switch", gin.H{"organization_id": acme})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockOrganizations.AssertNumberOfCalls(t, "SwitchOrganization", 2)
+}
+
+func TestSwitchOrganizationRequiresScope(t *testing.T) {
+	user := models.User{Model: gorm.Model{ID: 1}, Username: "alice"}
+	mockTokens := mockScopedTokens(user, map[string]string{"bpat_read": models.ScopeUsersRead})
+	mockOrganizations := new(services_mock.MockOrganizationService)
+	router := gin.New()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.AccessTokenMiddleware(mockTokens))
+	handlers.RegisterOrganizationRoutes(router, mockOrganizations)
+
+	w := sendAuthorized(router, http.MethodPost, "/api/v1/user/orgs/switch", "bpat_read")
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockOrganizations.AssertNotCalled(t, "SwitchOrganization", mock.Anything, mock.Anything)
+}
+
+func TestSetOrganizationMemberRole(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		expectedCode int
+	}{
+		{"Success", nil, http.StatusOK},
+		{"Member of another organization", services.ErrNotMember, http.StatusNotFound},
+		{"Admin granting owner", services.ErrOwnerRequired, http.StatusForbidden},
+		{"Last owner", services.ErrLastOwner, http.StatusConflict},
+		{"Unknown role", services.ErrInvalidOrganizationRole, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockOrganizations := new(services_mock.MockOrganizationService)
+			call := mockOrganizations.On("SetMemberRole", mock.Anything, mock.Anything, uint(5), models.OrgRoleOwner)
+			if tt.err == nil {
+				call.Return(&models.Membership{OrganizationID: 2, UserID: 5, Role: models.OrgRoleOwner}, models.OrgRoleMember, nil)
+			} else {
+				call.Return(nil, "", tt.err)
+			}
+
+			router := newOrganizationRouter(mockOrganizations, &models.Claims{Subject: "1", Username: "alice"})
+			w := postJSON(router, "/api/v1/user/orgs/members/5/role", gin.H{"role": models.OrgRoleOwner})
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
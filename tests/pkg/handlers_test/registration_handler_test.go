@@ -0,0 +1,89 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRegistrationRouter returns a router applying the registration policy
+// of mockRegistrations, serving the registration and invitation handlers
+// and, to an admin, the approval queue
+func newRegistrationRouter(mockRegistrations *services_mock.MockRegistrationService) *gin.Engine {
+	router := gin.Default()
+	router.Use(middlewares.RegistrationMiddleware(mockRegistrations))
+	router.POST("/api/v1/user/register", func(c *gin.Context) { handlers.RegisterUser(c, new(services_mock.MockUserService)) })
+	router.POST("/api/v1/user/invitations/:token", func(c *gin.Context) {
+		handlers.AcceptInvitation(c, new(services_mock.MockInvitationService))
+	})
+	admin := router.Group("/api/v1/admin/registrations", func(c *gin.Context) {
+		middlewares.SetClaims(c, &models.Claims{Subject: "1", Username: "alice", Roles: []string{models.RoleAdmin}})
+	})
+	admin.POST("/:id/approve", func(c *gin.Context) { handlers.ApproveRegistration(c, mockRegistrations) })
+	admin.POST("/:id/reject", func(c *gin.Context) { handlers.RejectRegistration(c, mockRegistrations) })
+	return router
+}
+
+func TestRegisterUserWithPolicy(t *testing.T) {
+	pending := &models.User{Model: gorm.Model{ID: 7}, Username: "bob", Email: "bob@example.com", Status: models.UserStatusPending}
+
+	mockRegistrations := new(services_mock.MockRegistrationService)
+	mockRegistrations.On("Policy").Return(services.RegistrationPolicy{Mode: services.RegistrationApproval})
+	mockRegistrations.On("Register", "bob", "correct horse battery staple", "bob@example.com").Return(pending, nil)
+	mockRegistrations.On("Register", "carol", "correct horse battery staple", "").Return(nil, services.ErrEmailRequired)
+	router := newRegistrationRouter(mockRegistrations)
+
+	// Pending accounts are not logged in
+	w := postJSON(router, "/api/v1/user/register", gin.H{"username": "bob", "password": "correct horse battery staple", "email": "bob@example.com"})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+	assert.Contains(t, w.Body.String(), "administrator")
+
+	w = postJSON(router, "/api/v1/user/register", gin.H{"username": "carol", "password": "correct horse battery staple"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = postJSON(router, "/api/v1/user/register", gin.H{"username": "carol", "password": "correct horse battery staple", "email": "not an address"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRegisterUserClosed(t *testing.T) {
+	mockRegistrations := new(services_mock.MockRegistrationService)
+	mockRegistrations.On("Policy").Return(services.RegistrationPolicy{Mode: services.RegistrationDisabled})
+	mockRegistrations.On("Register", "bob", "correct horse battery staple", "").Return(nil, services.ErrRegistrationDisabled)
+	router := newRegistrationRouter(mockRegistrations)
+
+	w := postJSON(router, "/api/v1/user/register", gin.H{"username": "bob", "password": "correct horse battery staple"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Invitations cannot be accepted either
+	w = postJSON(router, "/api/v1/user/invitations/good", gin.H{"username": "bob", "password": "correct horse battery staple"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestApproveAndRejectRegistration(t *testing.T) {
+	approved := &models.User{Model: gorm.Model{ID: 7}, Username: "bob", Status: models.UserStatusActive}
+	rejected := &models.User{Model: gorm.Model{ID: 8}, Username: "carol", Status: models.UserStatusPending}
+
+	mockRegistrations := new(services_mock.MockRegistrationService)
+	mockRegistrations.On("ApproveUser", uint(7)).Return(approved, nil)
+	mockRegistrations.On("ApproveUser", uint(9)).Return(nil, services.ErrRegistrationMissing)
+	mockRegistrations.On("RejectUser", uint(8)).Return(rejected, nil)
+	router := newRegistrationRouter(mockRegistrations)
+
+	w := postJSON(router, "/api/v1/admin/registrations/7/approve", gin.H{})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = postJSON(router, "/api/v1/admin/registrations/8/reject", gin.H{})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = postJSON(router, "/api/v1/admin/registrations/9/approve", gin.H{})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = postJSON(router, "/api/v1/admin/registrations/abc/reject", gin.H{})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	mockRegistrations.AssertExpectations(t)
+}
@@ -0,0 +1,306 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newSCIMRouter returns a router serving the SCIM endpoints over an
+// in-memory SQLite database. The token "bpat_scim" belongs to an admin
+// granted the scim scope, "bpat_read" to an admin without it and
+// "bpat_user" to a user with it. They act in organization 1, except
+// "bpat_left", created in an organization the admin has since left.
+func newSCIMRouter(t *testing.T) *gin.Engine {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard, TranslateError: true})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Group{}, &models.Organization{}, &models.Membership{}))
+	require.NoError(t, db.Create(&models.Organization{ID: 1, Name: "Acme", Slug: "acme"}).Error)
+
+	userRepo := &repository.PostgresUserRepository{DB: db}
+	scimService := services.NewSCIMService(services.NewUserService(userRepo), userRepo,
+		&repository.PostgresOrganizationRepository{DB: db}, &repository.PostgresGroupRepository{DB: db}, "https://example.com")
+
+	acme, left := uint(1), uint(2)
+	admin := models.User{Model: gorm.Model{ID: 100}, Username: "okta", Role: models.RoleAdmin}
+	mockTokens := new(services_mock.MockAccessTokenService)
+	mockTokens.On("Authenticate", "bpat_scim", mock.Anything).Return(&models.PersonalAccessToken{ID: 1, UserID: 100, User: admin, OrganizationID: &acme, Scopes: models.ScopeSCIM}, nil)
+	mockTokens.On("Authenticate", "bpat_read", mock.Anything).Return(&models.PersonalAccessToken{ID: 2, UserID: 100, User: admin, OrganizationID: &acme, Scopes: models.ScopeUsersRead}, nil)
+	mockTokens.On("Authenticate", "bpat_user", mock.Anything).Return(&models.PersonalAccessToken{ID: 3, UserID: 7, User: models.User{Model: gorm.Model{ID: 7}, Username: "alice", Role: models.RoleUser}, OrganizationID: &acme, Scopes: models.ScopeSCIM}, nil)
+	mockTokens.On("Authenticate", "bpat_left", mock.Anything).Return(&models.PersonalAccessToken{ID: 4, UserID: 100, User: admin, OrganizationID: &left, Scopes: models.ScopeSCIM}, nil)
+	mockTokens.On("Authenticate", mock.Anything, mock.Anything).Return(nil, services.ErrInvalidAccessToken)
+
+	// Tokens act in the organization they were created in, without fallback
+	mockOrganizations := new(services_mock.MockOrganizationService)
+	mockOrganizations.On("ResolveTenant", uint(100), acme, false).Return(&models.Membership{OrganizationID: acme, UserID: 100, Role: models.OrgRoleOwner}, nil)
+	mockOrganizations.On("ResolveTenant", uint(7), acme, false).Return(&models.Membership{OrganizationID: acme, UserID: 7, Role: models.OrgRoleMember}, nil)
+	mockOrganizations.On("ResolveTenant", mock.Anything, mock.Anything, mock.Anything).Return(nil, services.ErrNotMember)
+
+	router := gin.New()
+	router.Use(middlewares.AccessTokenMiddleware(mockTokens), middlewares.OrganizationMiddleware(mockOrganizations))
+	handlers.RegisterSCIMRoutes(router, scimService)
+	return router
+}
+
+// scimRequest sends a SCIM request with the token, and decodes the JSON
+// response into a map
+func scimRequest(t *testing.T, router *gin.Engine, method, path, token, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(method, path, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", middlewares.SCIMContentType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var decoded map[string]interface{}
+	if w.Body.Len() > 0 {
+		assert.Equal(t, middlewares.SCIMContentType, w.Header().Get("Content-Type"))
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &decoded), w.Body.String())
+	}
+	return w, decoded
+}
+
+// assertSCIMErrorResponse checks a SCIM error response (RFC 7644 section
+// 3.12)
+func assertSCIMErrorResponse(t *testing.T, w *httptest.ResponseRecorder, body map[string]interface{}, status int, scimType string) {
+	t.Helper()
+	assert.Equal(t, status, w.Code)
+	assert.Equal(t, []interface{}{services.SCIMErrorSchema}, body["schemas"])
+	assert.Equal(t, strconv.Itoa(status), body["status"])
+	if scimType != "" {
+		assert.Equal(t, scimType, body["scimType"])
+	}
+}
+
+func TestSCIMAuthentication(t *testing.T) {
+	router := newSCIMRouter(t)
+
+	tests := []struct {
+		name         string
+		token        string
+		expectedCode int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"invalid token", "bpat_unknown", http.StatusUnauthorized},
+		{"missing scope", "bpat_read", http.StatusForbidden},
+		{"not an admin", "bpat_user", http.StatusForbidden},
+		{"scim token", "bpat_scim", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, body := scimRequest(t, router, http.MethodGet, "/scim/v2/Users", tt.token, "")
+			if tt.expectedCode == http.StatusOK {
+				assert.Equal(t, http.StatusOK, w.Code)
+				return
+			}
+			assertSCIMErrorResponse(t, w, body, tt.expectedCode, "")
+			assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+		})
+	}
+
+	// Tokens cannot provision an organization their user has left
+	w, body := scimRequest(t, router, http.MethodGet, "/scim/v2/Users", "bpat_left", "")
+	assertSCIMErrorResponse(t, w, body, http.StatusForbidden, "")
+}
+
+func TestSCIMUsers(t *testing.T) {
+	router := newSCIMRouter(t)
+
+	// RFC 7644 section 3.3
+	w, created := scimRequest(t, router, http.MethodPost, "/scim/v2/Users", "bpat_scim", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "bjensen",
+		"externalId": "bjensen",
+		"name": {"formatted": "Ms. Barbara J Jensen III", "familyName": "Jensen", "givenName": "Barbara"}
+	}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	id := created["id"].(string)
+	assert.Equal(t, "https://example.com/scim/v2/Users/"+id, w.Header().Get("Location"))
+	assert.Equal(t, []interface{}{services.SCIMUserSchema}, created["schemas"])
+	assert.Equal(t, "bjensen", created["userName"])
+	assert.Equal(t, true, created["active"])
+	meta := created["meta"].(map[string]interface{})
+	assert.Equal(t, "User", meta["resourceType"])
+	assert.Equal(t, w.Header().Get("Location"), meta["location"])
+
+	w, body := scimRequest(t, router, http.MethodPost, "/scim/v2/Users", "bpat_scim", `{"userName": "BJENSEN"}`)
+	assertSCIMErrorResponse(t, w, body, http.StatusConflict, "uniqueness")
+
+	// RFC 7644 section 3.4.1
+	w, body = scimRequest(t, router, http.MethodGet, "/scim/v2/Users/"+id, "bpat_scim", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Barbara", body["name"].(map[string]interface{})["givenName"])
+
+	// RFC 7644 section 3.4.2
+	scimRequest(t, router, http.MethodPost, "/scim/v2/Users", "bpat_scim", `{"userName": "jsmith"}`)
+	w, body = scimRequest(t, router, http.MethodGet, `/scim/v2/Users?filter=userName+eq+%22bjensen%22`, "bpat_scim", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{services.SCIMListResponseSchema}, body["schemas"])
+	assert.EqualValues(t, 1, body["totalResults"])
+	assert.Equal(t, "bjensen", body["Resources"].([]interface{})[0].(map[string]interface{})["userName"])
+
+	w, body = scimRequest(t, router, http.MethodGet, "/scim/v2/Users?startIndex=2&count=1", "bpat_scim", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 2, body["totalResults"])
+	assert.EqualValues(t, 2, body["startIndex"])
+	assert.EqualValues(t, 1, body["itemsPerPage"])
+	assert.Equal(t, "jsmith", body["Resources"].([]interface{})[0].(map[string]interface{})["userName"])
+
+	w, body = scimRequest(t, router, http.MethodGet, `/scim/v2/Users?filter=userName+zz+%22bjensen%22`, "bpat_scim", "")
+	assertSCIMErrorResponse(t, w, body, http.StatusBadRequest, "invalidFilter")
+
+	// RFC 7644 section 3.5.1
+	w, body = scimRequest(t, router, http.MethodPut, "/scim/v2/Users/"+id, "bpat_scim", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"id": "`+id+`",
+		"userName": "bjensen",
+		"externalId": "bjensen",
+		"name": {"familyName": "Jensen", "givenName": "Barbara"},
+		"emails": [{"value": "bjensen@example.com"}]
+	}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "bjensen@example.com", body["emails"].([]interface{})[0].(map[string]interface{})["value"])
+
+	// Deactivation, RFC 7644 section 3.5.2.3
+	w, body = scimRequest(t, router, http.MethodPatch, "/scim/v2/Users/"+id, "bpat_scim", `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "replace", "value": {"active": false}}]
+	}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, false, body["active"])
+
+	w, body = scimRequest(t, router, http.MethodGet, `/scim/v2/Users?filter=active+eq+false`, "bpat_scim", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 1, body["totalResults"])
+
+	w, body = scimRequest(t, router, http.MethodPatch, "/scim/v2/Users/"+id, "bpat_scim", `{"Operations": [{"op": "replace", "path": "meta.created", "value": "x"}]}`)
+	assertSCIMErrorResponse(t, w, body, http.StatusBadRequest, "mutability")
+
+	w, body = scimRequest(t, router, http.MethodPatch, "/scim/v2/Users/"+id, "bpat_scim", `{"Operations": `)
+	assertSCIMErrorResponse(t, w, body, http.StatusBadRequest, "invalidSyntax")
+
+	// RFC 7644 section 3.6
+	w, _ = scimRequest(t, router, http.MethodDelete, "/scim/v2/Users/"+id, "bpat_scim", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w, body = scimRequest(t, router, http.MethodGet, "/scim/v2/Users/"+id, "bpat_scim", "")
+	assertSCIMErrorResponse(t, w, body, http.StatusNotFound, "")
+	w, body = scimRequest(t, router, http.MethodDelete, "/scim/v2/Users/"+id, "bpat_scim", "")
+	assertSCIMErrorResponse(t, w, body, http.StatusNotFound, "")
+}
+
+func TestSCIMGroups(t *testing.T) {
+	router := newSCIMRouter(t)
+	_, bjensen := scimRequest(t, router, http.MethodPost, "/scim/v2/Users", "bpat_scim", `{"userName": "bjensen"}`)
+	_, jsmith := scimRequest(t, router, http.MethodPost, "/scim/v2/Users", "bpat_scim", `{"userName": "jsmith"}`)
+
+	w, created := scimRequest(t, router, http.MethodPost, "/scim/v2/Groups", "bpat_scim", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"],
+		"displayName": "Tour Guides",
+		"members": [{"value": "`+bjensen["id"].(string)+`"}]
+	}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	id := created["id"].(string)
+	assert.Equal(t, "https://example.com/scim/v2/Groups/"+id, w.Header().Get("Location"))
+	assert.Len(t, created["members"], 1)
+
+	w, body := scimRequest(t, router, http.MethodPost, "/scim/v2/Groups", "bpat_scim", `{"displayName": "Tour Guides"}`)
+	assertSCIMErrorResponse(t, w, body, http.StatusConflict, "uniqueness")
+
+	// RFC 7644 section 3.5.2.1
+	w, body = scimRequest(t, router, http.MethodPatch, "/scim/v2/Groups/"+id, "bpat_scim", `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{
+			"op": "add",
+			"path": "members",
+			"value": [{"display": "jsmith", "$ref": "https://example.com/v2/Users/`+jsmith["id"].(string)+`", "value": "`+jsmith["id"].(string)+`"}]
+		}]
+	}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Len(t, body["members"], 2)
+
+	// RFC 7644 section 3.5.2.2
+	w, body = scimRequest(t, router, http.MethodPatch, "/scim/v2/Groups/"+id, "bpat_scim", `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "remove", "path": "members[value eq \"`+bjensen["id"].(string)+`\"]"}]
+	}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	members := body["members"].([]interface{})
+	require.Len(t, members, 1)
+	assert.Equal(t, jsmith["id"], members[0].(map[string]interface{})["value"])
+
+	w, body = scimRequest(t, router, http.MethodGet, "/scim/v2/Users/"+jsmith["id"].(string), "bpat_scim", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Tour Guides", body["groups"].([]interface{})[0].(map[string]interface{})["display"])
+
+	w, body = scimRequest(t, router, http.MethodGet, `/scim/v2/Groups?filter=displayName+sw+%22tour%22`, "bpat_scim", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 1, body["totalResults"])
+
+	w, body = scimRequest(t, router, http.MethodPut, "/scim/v2/Groups/"+id, "bpat_scim", `{"displayName": "Guides", "members": []}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "Guides", body["displayName"])
+	assert.Empty(t, body["members"])
+
+	w, _ = scimRequest(t, router, http.MethodDelete, "/scim/v2/Groups/"+id, "bpat_scim", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w, body = scimRequest(t, router, http.MethodGet, "/scim/v2/Groups/"+id, "bpat_scim", "")
+	assertSCIMErrorResponse(t, w, body, http.StatusNotFound, "")
+}
+
+func TestSCIMDiscovery(t *testing.T) {
+	router := newSCIMRouter(t)
+
+	w, body := scimRequest(t, router, http.MethodGet, "/scim/v2/ServiceProviderConfig", "bpat_scim", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, body["patch"].(map[string]interface{})["supported"])
+	assert.Equal(t, false, body["bulk"].(map[string]interface{})["supported"])
+
+	w, body = scimRequest(t, router, http.MethodGet, "/scim/v2/ResourceTypes", "bpat_scim", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 2, body["totalResults"])
+}
+
+func TestSCIMInternalErrorsAreHidden(t *testing.T) {
+	mockSCIM := new(services_mock.MockSCIMService)
+	mockSCIM.On("GetUser", mock.Anything, "1").Return(nil, assert.AnError)
+	mockTokens := new(services_mock.MockAccessTokenService)
+	mockTokens.On("Authenticate", "bpat_scim", mock.Anything).Return(&models.PersonalAccessToken{
+		ID:     1,
+		UserID: 100,
+		User:   models.User{Model: gorm.Model{ID: 100}, Username: "okta", Role: models.RoleAdmin},
+		Scopes: models.ScopeSCIM,
+	}, nil)
+
+	router := gin.New()
+	router.Use(middlewares.AccessTokenMiddleware(mockTokens))
+	handlers.RegisterSCIMRoutes(router, mockSCIM)
+
+	w, body := scimRequest(t, router, http.MethodGet, "/scim/v2/Users/1", "bpat_scim", "")
+	assertSCIMErrorResponse(t, w, body, http.StatusInternalServerError, "")
+	assert.NotContains(t, w.Body.String(), assert.AnError.Error())
+}
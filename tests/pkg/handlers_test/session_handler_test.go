@@ -0,0 +1,123 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newSessionRouter returns a router serving the session handlers to bob,
+// logged in with session 4, and to an admin
+func newSessionRouter(mockSessions *services_mock.MockSessionService) *gin.Engine {
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	sessions := router.Group("/api/v1/user/sessions", func(c *gin.Context) {
+		middlewares.SetClaims(c, &models.Claims{Subject: "7", Username: "bob", SessionID: 4})
+	})
+	sessions.GET("", func(c *gin.Context) { handlers.ListSessions(c, mockSessions) })
+	sessions.DELETE("/:id", func(c *gin.Context) { handlers.RevokeSession(c, mockSessions) })
+	admin := router.Group("/api/v1/admin/users", func(c *gin.Context) {
+		middlewares.SetClaims(c, &models.Claims{Subject: "1", Username: "alice", Roles: []string{models.RoleAdmin}})
+	})
+	admin.POST("/:id/sessions/revoke", func(c *gin.Context) { handlers.RevokeUserSessions(c, mockSessions) })
+	admin.DELETE("/:id/sessions/:session", func(c *gin.Context) { handlers.RevokeUserSession(c, mockSessions) })
+	return router
+}
+
+// sendJSON sends a JSON request with no body to the router
+func sendJSON(router *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestListAndRevokeSessions(t *testing.T) {
+	mockSessions := new(services_mock.MockSessionService)
+	mockSessions.On("ListSessions", uint(7)).Return([]models.Session{{ID: 4, UserID: 7, Device: "Firefox on Linux"}, {ID: 5, UserID: 7}}, nil)
+	mockSessions.On("RevokeSession", uint(7), uint(5)).Return(nil)
+	mockSessions.On("RevokeSession", uint(7), uint(4)).Return(nil)
+	mockSessions.On("RevokeSession", uint(7), uint(9)).Return(services.ErrSessionMissing)
+	router := newSessionRouter(mockSessions)
+
+	w := sendJSON(router, http.MethodGet, "/api/v1/user/sessions")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"current_session_id":4`)
+	assert.Contains(t, w.Body.String(), "Firefox on Linux")
+
+	w = sendJSON(router, http.MethodDelete, "/api/v1/user/sessions/5")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+
+	// Revoking the current session logs it out
+	w = sendJSON(router, http.MethodDelete, "/api/v1/user/sessions/4")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "Authorization=;")
+
+	w = sendJSON(router, http.MethodDelete, "/api/v1/user/sessions/9")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = sendJSON(router, http.MethodDelete, "/api/v1/user/sessions/abc")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	mockSessions.AssertExpectations(t)
+}
+
+func TestAdminRevokeUserSessions(t *testing.T) {
+	mockSessions := new(services_mock.MockSessionService)
+	mockSessions.On("RevokeSessions", uint(7), uint(0)).Return(int64(2), nil)
+	mockSessions.On("RevokeSession", uint(7), uint(5)).Return(nil)
+	mockSessions.On("RevokeSession", uint(8), uint(5)).Return(services.ErrSessionMissing)
+	router := newSessionRouter(mockSessions)
+
+	w := postJSON(router, "/api/v1/admin/users/7/sessions/revoke", gin.H{})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"revoked":2}`, w.Body.String())
+	w = sendJSON(router, http.MethodDelete, "/api/v1/admin/users/7/sessions/5")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// The session must belong to the user in the path
+	w = sendJSON(router, http.MethodDelete, "/api/v1/admin/users/8/sessions/5")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	mockSessions.AssertExpectations(t)
+}
+
+func TestLoginStartsSession(t *testing.T) {
+	bob := &models.User{Username: "bob"}
+	bob.ID = 7
+	mockUsers := new(services_mock.MockUserService)
+	mockUsers.On("GetUserByUsername", "bob").Return(bob, nil)
+	mockUsers.On("CheckPassword", bob, "correct horse battery staple").Return(nil)
+	mockSessions := new(services_mock.MockSessionService)
+	mockSessions.On("StartSession", uint(7), "test-agent", mock.Anything).Return(&models.Session{ID: 4, UserID: 7}, nil)
+
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.SessionMiddleware(mockSessions))
+	router.POST("/api/v1/user/login", func(c *gin.Context) { handlers.LoginUser(c, mockUsers) })
+
+	form := url.Values{"username": {"bob"}, "password": {"correct horse battery staple"}, "next": {"/api/v1/user/home"}}
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "test-agent")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// The cookie carries the new session
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	cookie := w.Result().Cookies()[0]
+	claims := testutil.VerifyToken(t, cookie.Value)
+	assert.Equal(t, uint(4), claims.SessionID)
+	mockSessions.AssertExpectations(t)
+}
@@ -3,13 +3,17 @@ package handlers_test
 import (
 	"BuildasTechnicalAssessmentGo/internal/repository/repository_mock"
 	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
 	"BuildasTechnicalAssessmentGo/pkg/models"
 	"BuildasTechnicalAssessmentGo/pkg/services"
 	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
 	"bytes"
-	"errors"
-	"github.com/golang-jwt/jwt/v4"
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"html/template"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -19,6 +23,15 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// userTemplates stands in for the user pages, rendering the name of the
+// page and the users it shows
+func userTemplates() *template.Template {
+	templates := template.Must(template.New("login.html").Parse(`login.html`))
+	template.Must(templates.New("register.html").Parse(`register.html`))
+	template.Must(templates.New("home.html").Parse(`home.html {{ .username }}{{ range .users }} {{ .Username }}{{ end }}`))
+	return templates
+}
+
 func TestRegisterUser(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -28,27 +41,39 @@ func TestRegisterUser(t *testing.T) {
 	}{
 		{
 			name:        "Valid Registration",
-			requestBody: `{"username":"newuser","password":"password123"}`,
-			mockBehavior: func(mock *repository_mock.MockUserRepository) {
-				mock.On("GetUserByUsername", "newuser").Return(nil, nil) // Simulate no existing user
-				mock.On("CreateUser", &models.User{Username: "newuser", Password: "password123"}).Return(nil)
+			requestBody: `{"username":"newuser","password":"correct horse battery staple"}`,
+			mockBehavior: func(m *repository_mock.MockUserRepository) {
+				m.On("GetUserByUsername", "newuser").Return(nil, nil).Once() // Simulate no existing user
+				m.On("GetUserByUsernameSkeleton", "newuser").Return(nil, nil)
+				m.On("CreateUser", mock.MatchedBy(func(user *models.User) bool {
+					return user.Username == "newuser" && user.Password != "correct horse battery staple"
+				})).Return(nil)
+				m.On("GetUserByUsername", "newuser").Return(&models.User{Username: "newuser"}, nil).Once()
 			},
 			expectedCode: http.StatusOK,
 		},
 		{
 			name:        "Duplicate User",
-			requestBody: `{"username":"existinguser","password":"password123"}`,
-			mockBehavior: func(mock *repository_mock.MockUserRepository) {
-				mock.On("CreateUser", &models.User{Username: "existinguser", Password: "password123"}).Return(errors.New("user already exists"))
+			requestBody: `{"username":"existinguser","password":"correct horse battery staple"}`,
+			mockBehavior: func(m *repository_mock.MockUserRepository) {
+				m.On("GetUserByUsername", "existinguser").Return(&models.User{Username: "existinguser"}, nil)
 			},
 			expectedCode: http.StatusBadRequest,
 		},
+		{
+			name:         "Missing Password",
+			requestBody:  `{"username":"newuser"}`,
+			mockBehavior: func(m *repository_mock.MockUserRepository) {},
+			expectedCode: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
+			// Store the token service, as the router would
+			testutil.TokenMiddleware()(c)
 
 			c.Request = httptest.NewRequest("POST", "/register", bytes.NewBufferString(tt.requestBody))
 			c.Request.Header.Set("Content-Type", "application/json")
@@ -77,10 +102,12 @@ func TestRegisterUser(t *testing.T) {
 
 func TestAddUser(t *testing.T) {
 	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
 	mockService := new(services_mock.MockUserService)
 
 	// Mock the service response
-	mockService.On("RegisterUser", "NewUser", "password123").Return(nil)
+	mockService.On("RegisterUser", "NewUser", "correct horse battery staple").Return(nil)
+	mockService.On("GetUserByUsername", "NewUser").Return(&models.User{Username: "NewUser"}, nil)
 
 	router.POST("/api/v1/user/add", func(c *gin.Context) {
 		handlers.AddUser(c, mockService)
@@ -88,7 +115,7 @@ func TestAddUser(t *testing.T) {
 
 	form := url.Values{}
 	form.Add("username", "NewUser")
-	form.Add("password", "password123")
+	form.Add("password", "correct horse battery staple")
 	req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/add", strings.NewReader(form.Encode()))
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
@@ -101,11 +128,13 @@ func TestAddUser(t *testing.T) {
 
 func TestLoginUser(t *testing.T) {
 	router := gin.Default()
+	router.SetHTMLTemplate(userTemplates())
+	router.Use(testutil.TokenMiddleware())
 	mockService := new(services_mock.MockUserService)
 
 	user := &models.User{Username: "TestUser", Password: "hashedpassword"}
 	mockService.On("GetUserByUsername", "TestUser").Return(user, nil)
-	mockService.On("CheckPassword", "hashedpassword", "password123").Return(nil)
+	mockService.On("CheckPassword", user, "correct horse battery staple").Return(nil)
 
 	router.POST("/api/v1/user/login", func(c *gin.Context) {
 		handlers.LoginUser(c, mockService)
@@ -113,7 +142,7 @@ func TestLoginUser(t *testing.T) {
 
 	form := url.Values{}
 	form.Add("username", "TestUser")
-	form.Add("password", "password123")
+	form.Add("password", "correct horse battery staple")
 	req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/login", strings.NewReader(form.Encode()))
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
@@ -126,9 +155,10 @@ func TestLoginUser(t *testing.T) {
 
 func TestRegisterUser2(t *testing.T) {
 	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
 	mockService := new(services_mock.MockUserService)
 
-	mockService.On("RegisterUser", "NewUser", "password123").Return(nil)
+	mockService.On("RegisterUser", "NewUser", "correct horse battery staple").Return(nil)
 	mockService.On("GetUserByUsername", "NewUser").Return(&models.User{Username: "NewUser"}, nil)
 
 	router.POST("/api/v1/user/register", func(c *gin.Context) {
@@ -137,7 +167,7 @@ func TestRegisterUser2(t *testing.T) {
 
 	form := url.Values{}
 	form.Add("username", "NewUser")
-	form.Add("password", "password123")
+	form.Add("password", "correct horse battery staple")
 	req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/register", strings.NewReader(form.Encode()))
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
@@ -150,6 +180,8 @@ func TestRegisterUser2(t *testing.T) {
 
 func TestLoginUserForm(t *testing.T) {
 	router := gin.Default()
+	router.SetHTMLTemplate(userTemplates())
+	router.Use(testutil.TokenMiddleware())
 	router.GET("/api/v1/user/login/form", handlers.LoginUserForm)
 
 	req, _ := http.NewRequest(http.MethodGet, "/api/v1/user/login/form", nil)
@@ -162,6 +194,8 @@ func TestLoginUserForm(t *testing.T) {
 
 func TestUserRegisterForm(t *testing.T) {
 	router := gin.Default()
+	router.SetHTMLTemplate(userTemplates())
+	router.Use(testutil.TokenMiddleware())
 	router.GET("/api/v1/user/register", handlers.UserRegisterForm)
 
 	req, _ := http.NewRequest(http.MethodGet, "/api/v1/user/register", nil)
@@ -174,18 +208,20 @@ func TestUserRegisterForm(t *testing.T) {
 
 func TestHome(t *testing.T) {
 	router := gin.Default()
+	router.SetHTMLTemplate(userTemplates())
+	router.Use(testutil.TokenMiddleware())
 	mockService := new(services_mock.MockUserService)
 
 	// Mock the service response
-	mockService.On("GetAllUsers").Return([]models.User{
+	mockService.On("GetAllUsers", mock.Anything).Return([]models.User{
 		{Username: "User1"},
 		{Username: "User2"},
 	}, nil)
 
 	// Add claims to context
 	router.GET("/api/v1/user/home", func(c *gin.Context) {
-		claims := &jwt.MapClaims{"username": "TestUser"}
-		c.Set("claims", claims)
+		claims := &models.Claims{Username: "TestUser"}
+		middlewares.SetClaims(c, claims)
 		handlers.Home(c, mockService)
 	})
 
@@ -199,3 +235,60 @@ func TestHome(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "User1")
 	assert.Contains(t, w.Body.String(), "User2")
 }
+
+func TestRegisterUserValidationErrors(t *testing.T) {
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	mockService := new(services_mock.MockUserService)
+
+	router.POST("/api/v1/user/register", func(c *gin.Context) {
+		handlers.RegisterUser(c, mockService)
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/register", strings.NewReader(`{"username":" ","password":"short"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response struct {
+		Errors []handlers.FieldError `json:"errors"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	fields := map[string][]string{}
+	for _, fieldErr := range response.Errors {
+		fields[fieldErr.Field] = append(fields[fieldErr.Field], fieldErr.Rule)
+	}
+	assert.Equal(t, []string{"required"}, fields["username"])
+	assert.Equal(t, []string{"min_length"}, fields["password"], "the strength is not checked for passwords of the wrong length")
+	mockService.AssertNotCalled(t, "RegisterUser", mock.Anything, mock.Anything)
+}
+
+func TestRegisterUserMultipart(t *testing.T) {
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	mockService := new(services_mock.MockUserService)
+
+	mockService.On("RegisterUser", "NewUser", "correct horse battery staple").Return(nil)
+	mockService.On("GetUserByUsername", "NewUser").Return(&models.User{Username: "NewUser"}, nil)
+
+	router.POST("/api/v1/user/register", func(c *gin.Context) {
+		handlers.RegisterUser(c, mockService)
+	})
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	_ = writer.WriteField("username", "NewUser")
+	_ = writer.WriteField("password", "correct horse battery staple")
+	_ = writer.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/register", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	mockService.AssertExpectations(t)
+}
@@ -0,0 +1,61 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetUserStatus(t *testing.T) {
+	suspended := &models.User{Model: gorm.Model{ID: 7}, Username: "bob", Status: models.UserStatusSuspended, StatusReason: "spam"}
+	active := &models.User{Model: gorm.Model{ID: 7}, Username: "bob", Status: models.UserStatusActive}
+
+	mockLifecycle := new(services_mock.MockUserLifecycleService)
+	mockLifecycle.On("Transition", uint(1), uint(7), models.UserStatusSuspended, "spam").Return(suspended, models.UserStatusActive, nil)
+	mockLifecycle.On("Transition", uint(1), uint(7), models.UserStatusSuspended, "").Return(nil, "", services.ErrStatusReasonRequired)
+	mockLifecycle.On("Transition", uint(1), uint(7), models.UserStatusActive, "").Return(active, models.UserStatusSuspended, nil)
+	mockLifecycle.On("Transition", uint(1), uint(7), models.UserStatusLocked, "stolen password").
+		Return(nil, "", fmt.Errorf("%w: suspended accounts cannot become locked", services.ErrIllegalTransition))
+	mockLifecycle.On("Transition", uint(1), uint(1), models.UserStatusSuspended, "oops").Return(nil, "", services.ErrOwnStatus)
+	mockLifecycle.On("Transition", uint(1), uint(9), models.UserStatusActive, "").Return(nil, "", services.ErrUserNotFound)
+
+	router := gin.Default()
+	admin := router.Group("/api/v1/admin/users", func(c *gin.Context) {
+		middlewares.SetClaims(c, &models.Claims{Subject: "1", Username: "alice", Roles: []string{models.RoleAdmin}})
+	})
+	admin.POST("/:id/suspend", func(c *gin.Context) { handlers.SetUserStatus(c, mockLifecycle, models.UserStatusSuspended) })
+	admin.POST("/:id/reactivate", func(c *gin.Context) { handlers.SetUserStatus(c, mockLifecycle, models.UserStatusActive) })
+	admin.POST("/:id/status", func(c *gin.Context) { handlers.SetUserStatus(c, mockLifecycle, "") })
+
+	tests := []struct {
+		name         string
+		path         string
+		body         gin.H
+		expectedCode int
+	}{
+		{"Suspend", "/api/v1/admin/users/7/suspend", gin.H{"reason": "spam"}, http.StatusOK},
+		{"Suspend without reason", "/api/v1/admin/users/7/suspend", gin.H{}, http.StatusBadRequest},
+		{"Reactivate", "/api/v1/admin/users/7/reactivate", gin.H{}, http.StatusOK},
+		{"Illegal transition", "/api/v1/admin/users/7/status", gin.H{"status": models.UserStatusLocked, "reason": "stolen password"}, http.StatusConflict},
+		{"Own account", "/api/v1/admin/users/1/suspend", gin.H{"reason": "oops"}, http.StatusForbidden},
+		{"Unknown user", "/api/v1/admin/users/9/reactivate", gin.H{}, http.StatusNotFound},
+		{"Invalid ID", "/api/v1/admin/users/abc/reactivate", gin.H{}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(router, tt.path, tt.body)
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+	mockLifecycle.AssertExpectations(t)
+}
@@ -0,0 +1,167 @@
+package handlers_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/handlers"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoginAsksForPasskey(t *testing.T) {
+	bob := &models.User{Username: "bob", Status: models.UserStatusActive}
+	bob.ID = 7
+	carol := &models.User{Username: "carol", Status: models.UserStatusActive}
+	carol.ID = 8
+	mockUsers := new(services_mock.MockUserService)
+	mockUsers.On("GetUserByUsername", "bob").Return(bob, nil)
+	mockUsers.On("GetUserByUsername", "carol").Return(carol, nil)
+	mockUsers.On("CheckPassword", mock.Anything, "correct horse battery staple").Return(nil)
+	mockPasskeys := new(services_mock.MockWebAuthnService)
+	mockPasskeys.On("BeginSecondFactor", bob, "/api/v1/user/home").
+		Return(&services.CredentialRequestOptions{Challenge: "challenge", RPID: "localhost"}, nil)
+	mockPasskeys.On("BeginSecondFactor", carol, "/api/v1/user/home").Return(nil, nil)
+
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.WebAuthnMiddleware(mockPasskeys))
+	router.POST("/api/v1/user/login", func(c *gin.Context) { handlers.LoginUser(c, mockUsers) })
+
+	// Bob has a passkey: the password alone does not log him in
+	w := postJSON(router, "/api/v1/user/login", gin.H{"username": "bob", "password": "correct horse battery staple", "next": "/api/v1/user/home"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"second_factor":"webauthn"`)
+	assert.Contains(t, w.Body.String(), `"challenge":"challenge"`)
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+
+	w = postJSON(router, "/api/v1/user/login", gin.H{"username": "carol", "password": "correct horse battery staple", "next": "/api/v1/user/home"})
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "Authorization=")
+	mockPasskeys.AssertExpectations(t)
+}
+
+func TestFinishPasskeyLogin(t *testing.T) {
+	alice := &models.User{Username: "alice", Status: models.UserStatusActive}
+	alice.ID = 3
+	bob := &models.User{Username: "bob", Status: models.UserStatusLocked}
+	bob.ID = 4
+	mockPasskeys := new(services_mock.MockWebAuthnService)
+	mockPasskeys.On("FinishLogin", mock.MatchedBy(func(c *services.PublicKeyCredential) bool { return c.ID == "good" })).
+		Return(&services.WebAuthnLogin{User: alice, Next: "/oauth/authorize?client_id=app"}, nil)
+	mockPasskeys.On("FinishLogin", mock.MatchedBy(func(c *services.PublicKeyCredential) bool { return c.ID == "cloned" })).
+		Return(&services.WebAuthnLogin{User: alice}, services.ErrWebAuthnInvalid)
+	mockPasskeys.On("FinishLogin", mock.MatchedBy(func(c *services.PublicKeyCredential) bool { return c.ID == "unknown" })).
+		Return(nil, services.ErrWebAuthnUnknownCredential)
+	mockPasskeys.On("FinishLogin", mock.MatchedBy(func(c *services.PublicKeyCredential) bool { return c.ID == "locked" })).
+		Return(&services.WebAuthnLogin{User: bob, Passwordless: true}, services.ErrAccountLocked)
+	mockLogins := new(services_mock.MockLoginHistoryService)
+	mockLogins.On("RecordLogin", "alice", alice, models.AuditSuccess, mock.Anything, mock.Anything).Return(&models.LoginAttempt{}, nil)
+	mockLogins.On("RecordLogin", "alice", alice, models.AuditFailure, mock.Anything, mock.Anything).Return(&models.LoginAttempt{}, nil)
+	mockLogins.On("RecordLogin", "bob", bob, models.AuditFailure, mock.Anything, mock.Anything).Return(&models.LoginAttempt{}, nil)
+
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.LoginHistoryMiddleware(mockLogins))
+	router.POST("/api/v1/user/webauthn/login/finish", func(c *gin.Context) { handlers.FinishPasskeyLogin(c, mockPasskeys) })
+	finish := func(id string) (int, string, string) {
+		w := postJSON(router, "/api/v1/user/webauthn/login/finish", gin.H{"credential": gin.H{"id": id, "type": "public-key"}})
+		return w.Code, w.Body.String(), w.Header().Get("Set-Cookie")
+	}
+
+	code, body, cookie := finish("good")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"token":"`)
+	assert.Contains(t, body, `"next":"/oauth/authorize?client_id=app"`)
+	assert.Contains(t, cookie, "Authorization=")
+
+	code, _, cookie = finish("cloned")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Empty(t, cookie)
+	code, _, _ = finish("unknown")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, body, cookie = finish("locked")
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Contains(t, body, "locked")
+	assert.Empty(t, cookie)
+	mockPasskeys.AssertExpectations(t)
+	mockLogins.AssertExpectations(t)
+}
+
+func TestManagePasskeys(t *testing.T) {
+	mockPasskeys := new(services_mock.MockWebAuthnService)
+	mockPasskeys.On("BeginRegistration", uint(7)).Return(&services.CredentialCreationOptions{Challenge: "challenge"}, nil)
+	mockPasskeys.On("FinishRegistration", uint(7), "Phone", mock.Anything).
+		Return(&models.WebAuthnCredential{ID: 2, UserID: 7, Name: "Phone"}, nil)
+	mockPasskeys.On("FinishRegistration", uint(7), "Again", mock.Anything).Return(nil, services.ErrWebAuthnCredentialExists)
+	mockPasskeys.On("RemoveCredential", uint(7), uint(2)).Return(nil)
+	mockPasskeys.On("RemoveCredential", uint(7), uint(3)).Return(services.ErrWebAuthnCredentialMissing)
+
+	router := gin.Default()
+	router.Use(testutil.TokenMiddleware())
+	passkeys := router.Group("/api/v1/user/webauthn", func(c *gin.Context) {
+		claims := models.Claims{Subject: "7", Username: "bob"}
+		if c.GetHeader("X-Access-Token") != "" {
+			claims.TokenID = 1
+		}
+		middlewares.SetClaims(c, &claims)
+	})
+	passkeys.POST("/register/begin", func(c *gin.Context) { handlers.BeginPasskeyRegistration(c, mockPasskeys) })
+	passkeys.POST("/register/finish", func(c *gin.Context) { handlers.FinishPasskeyRegistration(c, mockPasskeys) })
+	passkeys.DELETE("/credentials/:id", func(c *gin.Context) { handlers.RemovePasskey(c, mockPasskeys) })
+
+	w := postJSON(router, "/api/v1/user/webauthn/register/begin", gin.H{})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"public_key":{"challenge":"challenge"`)
+
+	w = postJSON(router, "/api/v1/user/webauthn/register/finish", gin.H{"name": "Phone", "credential": gin.H{"id": "new"}})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Phone"`)
+	w = postJSON(router, "/api/v1/user/webauthn/register/finish", gin.H{"name": "Again", "credential": gin.H{"id": "new"}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Personal access tokens cannot add passkeys
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/webauthn/register/begin", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Access-Token", "1")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = sendJSON(router, http.MethodDelete, "/api/v1/user/webauthn/credentials/2")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = sendJSON(router, http.MethodDelete, "/api/v1/user/webauthn/credentials/3")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = sendJSON(router, http.MethodDelete, "/api/v1/user/webauthn/credentials/abc")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	mockPasskeys.AssertExpectations(t)
+}
+
+func TestManagePasskeysRequiresScope(t *testing.T) {
+	bob := models.User{Model: gorm.Model{ID: 7}, Username: "bob"}
+	mockTokens := mockScopedTokens(bob, map[string]string{"bpat_read": models.ScopeUsersRead})
+	mockPasskeys := new(services_mock.MockWebAuthnService)
+	router := gin.New()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.AccessTokenMiddleware(mockTokens))
+	handlers.RegisterWebAuthnRoutes(router, mockPasskeys, nil)
+
+	for _, path := range []string{"/api/v1/user/webauthn/register/begin", "/api/v1/user/webauthn/credentials/2/delete"} {
+		t.Run(path, func(t *testing.T) {
+			w := sendAuthorized(router, http.MethodPost, path, "bpat_read")
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			assert.Contains(t, w.Header().Get("WWW-Authenticate"), "insufficient_scope")
+		})
+	}
+	mockPasskeys.AssertNotCalled(t, "BeginRegistration", mock.Anything)
+	mockPasskeys.AssertNotCalled(t, "RemoveCredential", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,75 @@
+package middlewares_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	router := gin.New()
+	router.Use(middlewares.RequestIDMiddleware())
+	router.GET("/", func(c *gin.Context) { c.String(http.StatusOK, c.GetString(middlewares.RequestIDKey)) })
+
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{"Reuses a valid ID", "abc-123", "abc-123"},
+		{"Replaces an invalid ID", "<script>", ""},
+		{"Generates a missing ID", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Request-ID", tt.header)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if tt.expected != "" {
+				assert.Equal(t, tt.expected, w.Body.String())
+			} else {
+				assert.Len(t, w.Body.String(), 32)
+			}
+			assert.Equal(t, w.Body.String(), w.Header().Get("X-Request-ID"))
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name         string
+		claims       *models.Claims
+		expectedCode int
+	}{
+		{"Admin", &models.Claims{Roles: []string{models.RoleAdmin}}, http.StatusOK},
+		{"User", &models.Claims{Roles: []string{models.RoleUser}}, http.StatusForbidden},
+		{"Token without role", &models.Claims{}, http.StatusForbidden},
+		{"Not authenticated", nil, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tt.claims != nil {
+					middlewares.SetClaims(c, tt.claims)
+				}
+			}, middlewares.RequireRole(models.RoleAdmin))
+			router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
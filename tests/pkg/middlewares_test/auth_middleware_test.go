@@ -0,0 +1,147 @@
+package middlewares_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newAuthRouter returns a router answering the claims of authenticated
+// requests to /home, and requiring the users:write scope on /add
+func newAuthRouter(accessTokenService services.AccessTokenServiceInterface) *gin.Engine {
+	router := gin.New()
+	router.Use(testutil.TokenMiddleware())
+	if accessTokenService != nil {
+		router.Use(middlewares.AccessTokenMiddleware(accessTokenService))
+	}
+	router.Use(middlewares.AuthMiddleware())
+	router.GET("/home", func(c *gin.Context) { c.JSON(http.StatusOK, middlewares.GetClaims(c)) })
+	router.POST("/add", middlewares.RequireScope(models.ScopeUsersWrite), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func TestAuthMiddlewareBearerTokens(t *testing.T) {
+	mockTokens := new(services_mock.MockAccessTokenService)
+	mockTokens.On("Authenticate", "bpat_valid", "192.0.2.1").Return(&models.PersonalAccessToken{
+		ID:     3,
+		UserID: 7,
+		User:   models.User{Model: gorm.Model{ID: 7}, Username: "ci-bot", Role: models.RoleUser},
+		Scopes: models.ScopeUsersRead,
+	}, nil)
+	mockTokens.On("Authenticate", "bpat_revoked", "192.0.2.1").Return(nil, services.ErrAccessTokenExpired)
+
+	jwtToken := testutil.SessionToken(t, &models.User{Model: gorm.Model{ID: 1}, Username: "alice", Role: models.RoleAdmin}, 0)
+
+	tests := []struct {
+		name         string
+		header       string
+		expectedCode int
+		expectedUser string
+	}{
+		{"Personal access token", "Bearer bpat_valid", http.StatusOK, "ci-bot"},
+		{"JWT", "Bearer " + jwtToken, http.StatusOK, "alice"},
+		{"Revoked token", "Bearer bpat_revoked", http.StatusUnauthorized, ""},
+		{"Invalid JWT", "Bearer not-a-jwt", http.StatusUnauthorized, ""},
+		{"Wrong scheme", "Basic YWxpY2U6c2VjcmV0", http.StatusUnauthorized, ""},
+	}
+
+	router := newAuthRouter(mockTokens)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/home", nil)
+			req.Header.Set("Authorization", tt.header)
+			req.Header.Set("Accept", "application/json")
+			req.RemoteAddr = "192.0.2.1:1234"
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedCode != http.StatusOK {
+				assert.Contains(t, w.Header().Get("WWW-Authenticate"), "invalid_token")
+				return
+			}
+			var claims models.Claims
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &claims))
+			assert.Equal(t, tt.expectedUser, claims.Username)
+		})
+	}
+}
+
+func TestAuthMiddlewareRejectsAccessTokensWhenDisabled(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/home", nil)
+	req.Header.Set("Authorization", "Bearer bpat_valid")
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	newAuthRouter(nil).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAuthMiddlewareRejectsTokensWithoutTokenService(t *testing.T) {
+	router := gin.New()
+	router.GET("/home", middlewares.AuthMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/session", func(c *gin.Context) {
+		if middlewares.SessionClaims(c) == nil {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	jwtToken := testutil.SessionToken(t, &models.User{Model: gorm.Model{ID: 1}, Username: "alice", Role: models.RoleAdmin}, 0)
+
+	// Tokens signed with the default key are not trusted unless the router
+	// was given the default token service
+	req, _ := http.NewRequest(http.MethodGet, "/home", nil)
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/session", nil)
+	req.AddCookie(&http.Cookie{Name: "Authorization", Value: jwtToken})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRequireScope(t *testing.T) {
+	mockTokens := new(services_mock.MockAccessTokenService)
+	mockTokens.On("Authenticate", "bpat_read", "192.0.2.1").Return(&models.PersonalAccessToken{ID: 3, UserID: 7, Scopes: models.ScopeUsersRead}, nil)
+	mockTokens.On("Authenticate", "bpat_write", "192.0.2.1").Return(&models.PersonalAccessToken{ID: 4, UserID: 7, Scopes: "users:read users:write"}, nil)
+
+	jwtToken := testutil.SessionToken(t, &models.User{Model: gorm.Model{ID: 1}, Username: "alice"}, 0)
+
+	tests := []struct {
+		name         string
+		header       string
+		expectedCode int
+	}{
+		{"Token without the scope", "Bearer bpat_read", http.StatusForbidden},
+		{"Token with the scope", "Bearer bpat_write", http.StatusOK},
+		{"Sessions are not scoped", "Bearer " + jwtToken, http.StatusOK},
+	}
+
+	router := newAuthRouter(mockTokens)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/add", nil)
+			req.Header.Set("Authorization", tt.header)
+			req.Header.Set("Accept", "application/json")
+			req.RemoteAddr = "192.0.2.1:1234"
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package middlewares_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository/repository_mock"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newClientCertificateRouter returns a router accepting the client
+// certificates of the billing and reports services, answering the principal
+// of authenticated requests to /home and requiring the users:write scope on
+// /add
+func newClientCertificateRouter(t *testing.T) *gin.Engine {
+	userRepo := new(repository_mock.MockUserRepository)
+	userRepo.On("GetUserByUsername", "svc-billing").Return(&models.User{Model: gorm.Model{ID: 20}, Username: "svc-billing", Role: models.RoleUser}, nil)
+	userRepo.On("GetUserByUsername", "svc-reports").Return(&models.User{Model: gorm.Model{ID: 21}, Username: "svc-reports", Role: models.RoleUser, Status: models.UserStatusSuspended}, nil)
+	clientCertificateService, err := services.NewClientCertificateService(userRepo, []services.ServiceAccount{
+		{ID: "billing", Username: "svc-billing", Subjects: []string{"CN=billing", "URI:spiffe://corp/billing"}, Scopes: []string{models.ScopeUsersRead}},
+		{ID: "reports", Username: "svc-reports", Subjects: []string{"DNS:reports.internal"}, Scopes: []string{models.ScopeUsersWrite}},
+	})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(testutil.TokenMiddleware())
+	router.SetHTMLTemplate(template.Must(template.New("error.html").Parse(`{{ .error }}`)))
+	router.Use(middlewares.ClientCertificateMiddleware(clientCertificateService), middlewares.AuthMiddleware())
+	router.GET("/home", func(c *gin.Context) {
+		claims := middlewares.GetClaims(c)
+		c.JSON(http.StatusOK, gin.H{"username": claims.Username, "service_account": claims.ServiceAccount, "scope": claims.Scope})
+	})
+	router.POST("/add", middlewares.RequireScope(models.ScopeUsersWrite), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+// principal is the body of /home
+type principal struct {
+	Username       string `json:"username"`
+	ServiceAccount string `json:"service_account"`
+	Scope          string `json:"scope"`
+}
+
+// getHome requests /home with the client and the Authorization header, if
+// any, and returns the status and the principal
+func getHome(t *testing.T, client *http.Client, server string, authorization string) (int, *principal) {
+	req, _ := http.NewRequest(http.MethodGet, server+"/home", nil)
+	req.Header.Set("Accept", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+	var body principal
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, &body
+}
+
+func TestAuthMiddlewareClientCertificates(t *testing.T) {
+	ca := testutil.NewCertificateAuthority(t, "Internal CA")
+	server := testutil.NewMTLSServer(t, newClientCertificateRouter(t), ca, tls.VerifyClientCertIfGiven)
+	spiffeID, _ := url.Parse("spiffe://corp/billing")
+
+	tests := []struct {
+		name            string
+		certificate     *x509.Certificate
+		expectedCode    int
+		expectedAccount string
+	}{
+		{"Common name", &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}, http.StatusOK, "billing"},
+		{"URI SAN", &x509.Certificate{Subject: pkix.Name{CommonName: "billing-7f9c"}, URIs: []*url.URL{spiffeID}}, http.StatusOK, "billing"},
+		{"Unknown subject", &x509.Certificate{Subject: pkix.Name{CommonName: "payroll"}}, http.StatusUnauthorized, ""},
+		{"Suspended service account", &x509.Certificate{DNSNames: []string{"Reports.Internal"}}, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := testutil.MTLSClient(server, ca.IssueClientCertificate(t, tt.certificate))
+			code, body := getHome(t, client, server.URL, "")
+
+			assert.Equal(t, tt.expectedCode, code)
+			if tt.expectedCode == http.StatusOK {
+				assert.Equal(t, tt.expectedAccount, body.ServiceAccount)
+				assert.Equal(t, "svc-billing", body.Username)
+				assert.Equal(t, models.ScopeUsersRead, body.Scope)
+			}
+		})
+	}
+
+	// Without a certificate, the request needs a token as usual
+	code, _ := getHome(t, testutil.MTLSClient(server), server.URL, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// Tokens take precedence over certificates
+	billing := ca.IssueClientCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}})
+	jwtToken := testutil.SessionToken(t, &models.User{Model: gorm.Model{ID: 1}, Username: "alice", Role: models.RoleAdmin}, 0)
+	code, body := getHome(t, testutil.MTLSClient(server, billing), server.URL, "Bearer "+jwtToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "alice", body.Username)
+	assert.Empty(t, body.ServiceAccount)
+}
+
+func TestAuthMiddlewareClientCertificateScopes(t *testing.T) {
+	ca := testutil.NewCertificateAuthority(t, "Internal CA")
+	server := testutil.NewMTLSServer(t, newClientCertificateRouter(t), ca, tls.VerifyClientCertIfGiven)
+	billing := ca.IssueClientCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}})
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/add", nil)
+	req.Header.Set("Accept", "application/json")
+	resp, err := testutil.MTLSClient(server, billing).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "insufficient_scope")
+}
+
+func TestMTLSServerVerifiesClientCertificates(t *testing.T) {
+	ca := testutil.NewCertificateAuthority(t, "Internal CA")
+	foreign := testutil.NewCertificateAuthority(t, "Internal CA")
+	forged := foreign.IssueClientCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}})
+	billing := ca.IssueClientCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}})
+
+	// Certificates from another CA fail the handshake, even with the name of
+	// the trusted CA
+	accepting := testutil.NewMTLSServer(t, newClientCertificateRouter(t), ca, tls.VerifyClientCertIfGiven)
+	_, err := testutil.MTLSClient(accepting, forged).Get(accepting.URL + "/home")
+	assert.Error(t, err)
+
+	// Requiring certificates turns away clients without one
+	requiring := testutil.NewMTLSServer(t, newClientCertificateRouter(t), ca, tls.RequireAndVerifyClientCert)
+	_, err = testutil.MTLSClient(requiring).Get(requiring.URL + "/home")
+	assert.Error(t, err)
+	code, body := getHome(t, testutil.MTLSClient(requiring, billing), requiring.URL, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "billing", body.ServiceAccount)
+}
+
+func TestAuthMiddlewareIgnoresClientCertificatesWhenDisabled(t *testing.T) {
+	ca := testutil.NewCertificateAuthority(t, "Internal CA")
+	router := gin.New()
+	router.Use(testutil.TokenMiddleware())
+	router.SetHTMLTemplate(template.Must(template.New("error.html").Parse(`{{ .error }}`)))
+	router.Use(middlewares.AuthMiddleware())
+	router.GET("/home", func(c *gin.Context) { c.Status(http.StatusOK) })
+	server := testutil.NewMTLSServer(t, router, ca, tls.VerifyClientCertIfGiven)
+	billing := ca.IssueClientCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}})
+
+	code, _ := getHome(t, testutil.MTLSClient(server, billing), server.URL, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
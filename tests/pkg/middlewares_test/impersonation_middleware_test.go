@@ -0,0 +1,145 @@
+package middlewares_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// impersonationToken returns the JWT of alice, an admin with session 4,
+// impersonating bob
+func impersonationToken(t *testing.T) string {
+	bob := &models.User{Model: gorm.Model{ID: 5}, Username: "bob<script>", Role: models.RoleUser}
+	return testutil.IssueToken(t, services.NewImpersonationClaims(bob, &models.Actor{Subject: "1", Username: "alice", SessionID: 4, SessionVersion: 2}))
+}
+
+// sendWithCookie sends a browser request with the session to the router,
+// asking for JSON errors
+func sendWithCookie(router *gin.Engine, method, path, session string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.AddCookie(&http.Cookie{Name: "Authorization", Value: session})
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthMiddlewareChecksImpersonator(t *testing.T) {
+	alice := &models.User{Model: gorm.Model{ID: 1}, Username: "alice", Role: models.RoleAdmin,
+		Permissions: models.PermissionImpersonate, SessionVersion: 2}
+	mockLifecycle := new(services_mock.MockUserLifecycleService)
+	mockLifecycle.On("CheckUser", uint(5)).Return(&models.User{Model: gorm.Model{ID: 5}, Username: "bob"}, nil)
+	checkAlice := mockLifecycle.On("CheckUser", uint(1)).Return(alice, nil)
+	mockSessions := new(services_mock.MockSessionService)
+	mockSessions.On("CheckSession", uint(1), uint(4), mock.Anything).Return(&models.Session{ID: 4, UserID: 1}, nil)
+	mockAudit := new(services_mock.MockAuditService)
+	mockAudit.On("Record", mock.Anything).Return(nil)
+
+	router := gin.New()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.AuditMiddleware(mockAudit), middlewares.UserLifecycleMiddleware(mockLifecycle),
+		middlewares.SessionMiddleware(mockSessions), middlewares.AuthMiddleware())
+	router.GET("/protected", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/missing", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+	session := impersonationToken(t)
+
+	// The requests are checked against the admin, and attributed to them
+	w := sendWithCookie(router, http.MethodGet, "/protected", session)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendWithCookie(router, http.MethodGet, "/missing", session)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	mockSessions.AssertExpectations(t)
+	require.Len(t, mockAudit.Calls, 2)
+	event := mockAudit.Calls[0].Arguments.Get(0).(models.AuditEvent)
+	assert.Equal(t, models.AuditImpersonatedRequest, event.Action)
+	assert.Equal(t, models.AuditSuccess, event.Outcome)
+	assert.Equal(t, uint(1), *event.ActorID)
+	assert.Equal(t, "alice", event.ActorUsername)
+	assert.Equal(t, uint(5), *event.TargetID)
+	assert.Contains(t, event.Changes, `"/protected"`)
+	event = mockAudit.Calls[1].Arguments.Get(0).(models.AuditEvent)
+	assert.Equal(t, models.AuditFailure, event.Outcome)
+
+	// The impersonation ends with the account, password or permission of
+	// the admin, without telling the user why
+	checkAlice.Unset()
+	for _, admin := range []*models.User{
+		{Model: gorm.Model{ID: 1}, Role: models.RoleAdmin, Permissions: models.PermissionImpersonate, SessionVersion: 3},
+		{Model: gorm.Model{ID: 1}, Role: models.RoleAdmin, SessionVersion: 2},
+		{Model: gorm.Model{ID: 1}, Role: models.RoleUser, Permissions: models.PermissionImpersonate, SessionVersion: 2},
+	} {
+		call := mockLifecycle.On("CheckUser", uint(1)).Return(admin, nil)
+		w = sendWithCookie(router, http.MethodGet, "/protected", session)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		call.Unset()
+	}
+	mockLifecycle.On("CheckUser", uint(1)).Return(nil, services.ErrAccountSuspended)
+	w = sendWithCookie(router, http.MethodGet, "/protected", session)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotContains(t, w.Body.String(), "suspended")
+	assert.Len(t, mockAudit.Calls, 2)
+}
+
+func TestDenyImpersonation(t *testing.T) {
+	router := gin.New()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.AuthMiddleware(), middlewares.DenyImpersonation())
+	router.POST("/password", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req, _ := http.NewRequest(http.MethodPost, "/password", nil)
+	req.Header.Set("Authorization", "Bearer "+impersonationToken(t))
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), services.ErrImpersonating.Error())
+
+	user := &models.User{Model: gorm.Model{ID: 5}, Username: "bob"}
+	session := testutil.SessionToken(t, user, 0)
+	req, _ = http.NewRequest(http.MethodPost, "/password", nil)
+	req.Header.Set("Authorization", "Bearer "+session)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestImpersonationBannerMiddleware(t *testing.T) {
+	router := gin.New()
+	router.Use(testutil.TokenMiddleware())
+	router.SetHTMLTemplate(template.Must(template.New("page.html").Parse(
+		`<!DOCTYPE html><html><head><title>{{ .title }}</title></head><body class="page"><h1>{{ .title }}</h1></body></html>`)))
+	router.Use(middlewares.ImpersonationBannerMiddleware())
+	router.GET("/page", func(c *gin.Context) { c.HTML(http.StatusOK, "page.html", gin.H{"title": "Home"}) })
+	router.GET("/data", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"body": "<body>"}) })
+
+	// The banner follows the body tag, with a button to stop
+	w := sendWithCookie(router, http.MethodGet, "/page", impersonationToken(t))
+	assert.Equal(t, http.StatusOK, w.Code)
+	page := w.Body.String()
+	banner := strings.Index(page, `<div class="impersonation-banner"`)
+	require.Greater(t, banner, strings.Index(page, `<body class="page">`))
+	assert.Less(t, banner, strings.Index(page, "<h1>"))
+	assert.Contains(t, page, "<strong>bob&lt;script&gt;</strong> as alice")
+	assert.Contains(t, page, `action="`+middlewares.ImpersonationStopPath+`"`)
+	assert.Contains(t, page, "Stop impersonating")
+
+	// Other responses and sessions are left alone
+	w = sendWithCookie(router, http.MethodGet, "/data", impersonationToken(t))
+	assert.JSONEq(t, `{"body": "<body>"}`, w.Body.String())
+	session := testutil.SessionToken(t, &models.User{Model: gorm.Model{ID: 5}, Username: "bob"}, 0)
+	w = sendWithCookie(router, http.MethodGet, "/page", session)
+	assert.NotContains(t, w.Body.String(), "impersonation-banner")
+	assert.Contains(t, w.Body.String(), `<body class="page"><h1>Home</h1>`)
+}
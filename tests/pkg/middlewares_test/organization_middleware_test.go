@@ -0,0 +1,106 @@
+package middlewares_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/tenant"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newOrganizationRouter returns a router answering the organization of
+// authenticated requests to /org, and only letting owners and admins
+// through /manage
+func newOrganizationRouter(accessTokenService services.AccessTokenServiceInterface, organizationService services.OrganizationServiceInterface) *gin.Engine {
+	router := gin.New()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.AccessTokenMiddleware(accessTokenService), middlewares.OrganizationMiddleware(organizationService))
+	router.Use(middlewares.AuthMiddleware())
+	router.GET("/org", func(c *gin.Context) {
+		organizationID, err := tenant.OrganizationID(c.Request.Context())
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		claims := middlewares.GetClaims(c)
+		c.JSON(http.StatusOK, gin.H{"organization_id": organizationID, "org": claims.OrganizationID, "org_role": claims.OrganizationRole})
+	})
+	router.POST("/manage", middlewares.RequireOrganizationRole(models.OrgRoleOwner, models.OrgRoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func TestAuthMiddlewareResolvesOrganization(t *testing.T) {
+	acme := uint(2)
+	mockTokens := new(services_mock.MockAccessTokenService)
+	mockTokens.On("Authenticate", "bpat_acme", mock.Anything).Return(&models.PersonalAccessToken{
+		ID: 3, UserID: 7, OrganizationID: &acme, Scopes: models.ScopeUsersRead,
+		User: models.User{Model: gorm.Model{ID: 7}, Username: "ci-bot", Role: models.RoleUser},
+	}, nil)
+
+	mockOrganizations := new(services_mock.MockOrganizationService)
+	// Sessions fall back to another organization, tokens do not
+	mockOrganizations.On("ResolveTenant", uint(1), acme, true).Return(&models.Membership{OrganizationID: acme, UserID: 1, Role: models.OrgRoleAdmin}, nil)
+	mockOrganizations.On("ResolveTenant", uint(1), uint(0), true).Return(&models.Membership{OrganizationID: 5, UserID: 1, Role: models.OrgRoleMember}, nil)
+	mockOrganizations.On("ResolveTenant", uint(7), acme, false).Return(nil, services.ErrNotMember)
+
+	sessionWithOrg := testutil.SessionToken(t, &models.User{Model: gorm.Model{ID: 1}, Username: "alice", ActiveOrganizationID: &acme}, 0)
+	sessionWithoutOrg := testutil.SessionToken(t, &models.User{Model: gorm.Model{ID: 1}, Username: "alice"}, 0)
+
+	tests := []struct {
+		name         string
+		header       string
+		expectedCode int
+		expectedOrg  uint
+		expectedRole string
+	}{
+		{"Session with an organization", "Bearer " + sessionWithOrg, http.StatusOK, 2, models.OrgRoleAdmin},
+		{"Session without organization", "Bearer " + sessionWithoutOrg, http.StatusOK, 5, models.OrgRoleMember},
+		{"Token of an organization left", "Bearer bpat_acme", http.StatusForbidden, 0, ""},
+	}
+
+	router := newOrganizationRouter(mockTokens, mockOrganizations)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/org", nil)
+			req.Header.Set("Authorization", tt.header)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+			assert.JSONEq(t, `{"organization_id": `+fmt.Sprint(tt.expectedOrg)+`, "org": `+fmt.Sprint(tt.expectedOrg)+`, "org_role": "`+tt.expectedRole+`"}`, w.Body.String())
+		})
+	}
+}
+
+func TestRequireOrganizationRole(t *testing.T) {
+	mockOrganizations := new(services_mock.MockOrganizationService)
+	mockOrganizations.On("ResolveTenant", uint(1), uint(0), true).Return(&models.Membership{OrganizationID: 2, UserID: 1, Role: models.OrgRoleAdmin}, nil)
+	mockOrganizations.On("ResolveTenant", uint(2), uint(0), true).Return(&models.Membership{OrganizationID: 2, UserID: 2, Role: models.OrgRoleMember}, nil)
+
+	admin := testutil.SessionToken(t, &models.User{Model: gorm.Model{ID: 1}, Username: "alice"}, 0)
+	member := testutil.SessionToken(t, &models.User{Model: gorm.Model{ID: 2}, Username: "bob"}, 0)
+
+	router := newOrganizationRouter(new(services_mock.MockAccessTokenService), mockOrganizations)
+	for token, expectedCode := range map[string]int{admin: http.StatusOK, member: http.StatusForbidden} {
+		req, _ := http.NewRequest(http.MethodPost, "/manage", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, expectedCode, w.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package middlewares_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimitPolicies(t *testing.T) {
+	policies, err := services.ParseRateLimitPolicies("POST /api/v1/user/login=5/1m; * /api/v1/user/add=10+20/1h:user")
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+	assert.Equal(t, "POST", policies[0].Method)
+	assert.Equal(t, "/api/v1/user/login", policies[0].Route)
+	assert.Equal(t, 5, policies[0].Limit)
+	assert.Equal(t, time.Minute, policies[0].Period)
+	assert.Equal(t, "ip", policies[0].KeyBy)
+	assert.Equal(t, 20, policies[1].Burst)
+	assert.Equal(t, "user", policies[1].KeyBy)
+
+	_, err = services.ParseRateLimitPolicies("POST /login=5/1m:nope")
+	assert.Error(t, err)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	policies, _ := services.ParseRateLimitPolicies("POST /api/v1/user/login=2/1m:ip")
+	rateLimitService := services.NewRateLimitService(repository.NewMemoryRateLimitRepository(), policies)
+	now := time.Unix(1700000000, 0)
+	rateLimitService.Now = func() time.Time { return now }
+
+	router := gin.New()
+	router.Use(middlewares.RateLimitMiddleware(rateLimitService))
+	router.POST("/api/v1/user/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/api/v1/user/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(method string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/api/v1/user/login", nil)
+		req.Header.Set("Accept", "application/json")
+		req.RemoteAddr = "10.0.0.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodPost)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+
+	assert.Equal(t, http.StatusOK, send(http.MethodPost).Code)
+
+	w = send(http.MethodPost)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Contains(t, w.Body.String(), "Too many requests")
+
+	// Routes without a policy are not limited
+	w = send(http.MethodGet)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitMiddlewareAdvertisesBurst(t *testing.T) {
+	policies, _ := services.ParseRateLimitPolicies("POST /api/v1/user/login=2+5/1m:ip")
+	rateLimitService := services.NewRateLimitService(repository.NewMemoryRateLimitRepository(), policies)
+
+	router := gin.New()
+	router.Use(middlewares.RateLimitMiddleware(rateLimitService))
+	router.POST("/api/v1/user/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/login", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2;w=60;burst=5", w.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, "4", w.Header().Get("RateLimit-Remaining"))
+}
+
+func TestRateLimitMiddlewareIgnoresForwardedForFromUntrustedPeers(t *testing.T) {
+	policies, _ := services.ParseRateLimitPolicies("POST /api/v1/user/login=1/1m:ip")
+	rateLimitService := services.NewRateLimitService(repository.NewMemoryRateLimitRepository(), policies)
+
+	router := gin.New()
+	assert.NoError(t, router.SetTrustedProxies(nil))
+	router.Use(middlewares.RateLimitMiddleware(rateLimitService))
+	router.POST("/api/v1/user/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(forwardedFor string) int {
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/login", nil)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.RemoteAddr = "10.0.0.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A new spoofed address on each request still lands in the peer's bucket
+	assert.Equal(t, http.StatusOK, send("203.0.113.1"))
+	assert.Equal(t, http.StatusTooManyRequests, send("203.0.113.2"))
+}
+
+func TestRateLimitMiddlewareUsesForwardedForFromTrustedProxies(t *testing.T) {
+	policies, _ := services.ParseRateLimitPolicies("POST /api/v1/user/login=1/1m:ip")
+	rateLimitService := services.NewRateLimitService(repository.NewMemoryRateLimitRepository(), policies)
+
+	router := gin.New()
+	assert.NoError(t, router.SetTrustedProxies([]string{"10.0.0.0/8"}))
+	router.Use(middlewares.RateLimitMiddleware(rateLimitService))
+	router.POST("/api/v1/user/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(forwardedFor string) int {
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/login", nil)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.RemoteAddr = "10.0.0.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Clients behind the proxy get a bucket each
+	assert.Equal(t, http.StatusOK, send("203.0.113.1"))
+	assert.Equal(t, http.StatusOK, send("203.0.113.2"))
+	assert.Equal(t, http.StatusTooManyRequests, send("203.0.113.1"))
+}
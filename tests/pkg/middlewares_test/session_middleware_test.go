@@ -0,0 +1,53 @@
+package middlewares_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthMiddlewareChecksSession(t *testing.T) {
+	mockSessions := new(services_mock.MockSessionService)
+	mockSessions.On("CheckSession", uint(1), uint(4), mock.Anything).Return(&models.Session{ID: 4, UserID: 1}, nil)
+	mockSessions.On("CheckSession", uint(1), uint(5), mock.Anything).Return(nil, services.ErrSessionRevoked)
+
+	router := gin.New()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.SessionMiddleware(mockSessions), middlewares.AuthMiddleware())
+	router.GET("/protected", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name         string
+		sessionID    uint
+		expectedCode int
+	}{
+		{"Active session", 4, http.StatusOK},
+		{"Revoked session", 5, http.StatusUnauthorized},
+		{"Token issued without a session", 0, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{Username: "user"}
+			user.ID = 1
+			session := testutil.SessionToken(t, user, tt.sessionID)
+
+			req, _ := http.NewRequest(http.MethodGet, "/protected", nil)
+			req.AddCookie(&http.Cookie{Name: "Authorization", Value: session})
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+	mockSessions.AssertNumberOfCalls(t, "CheckSession", 2)
+}
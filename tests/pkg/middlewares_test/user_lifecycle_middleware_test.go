@@ -0,0 +1,73 @@
+package middlewares_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/services/services_mock"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthMiddlewareChecksAccountStatus(t *testing.T) {
+	mockLifecycle := new(services_mock.MockUserLifecycleService)
+	mockLifecycle.On("CheckUser", uint(1)).Return(&models.User{Model: gorm.Model{ID: 1}, Username: "alice"}, nil)
+	mockLifecycle.On("CheckUser", uint(2)).Return(nil, services.ErrAccountSuspended)
+	mockLifecycle.On("CheckUser", uint(3)).Return(nil, services.ErrUserNotFound)
+	mockLifecycle.On("CheckUser", uint(4)).Return(nil, errors.New("connection refused"))
+	mockLifecycle.On("CheckUser", uint(5)).Return(&models.User{Model: gorm.Model{ID: 5}, Username: "bob", SessionVersion: 1}, nil)
+
+	router := gin.New()
+	router.Use(testutil.TokenMiddleware())
+	router.Use(middlewares.UserLifecycleMiddleware(mockLifecycle), middlewares.AuthMiddleware())
+	router.GET("/protected", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name         string
+		userID       uint
+		expectedCode int
+	}{
+		{"Active account", 1, http.StatusOK},
+		{"Suspended since the session started", 2, http.StatusUnauthorized},
+		{"Deleted account", 3, http.StatusUnauthorized},
+		{"Lookup failure", 4, http.StatusInternalServerError},
+		{"Password changed since the session started", 5, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{Username: "user"}
+			user.ID = tt.userID
+			session := testutil.SessionToken(t, user, 0)
+
+			req, _ := http.NewRequest(http.MethodGet, "/protected", nil)
+			req.Header.Set("Authorization", "Bearer "+session)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+	assert.Contains(t, performCookieRequest(t, router, 2).Body.String(), "suspended")
+}
+
+// performCookieRequest sends a browser request with the session of a user
+// to /protected
+func performCookieRequest(t *testing.T, router *gin.Engine, userID uint) *httptest.ResponseRecorder {
+	user := &models.User{Username: "user"}
+	user.ID = userID
+	session := testutil.SessionToken(t, user, 0)
+	req, _ := http.NewRequest(http.MethodGet, "/protected", nil)
+	req.AddCookie(&http.Cookie{Name: "Authorization", Value: session})
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
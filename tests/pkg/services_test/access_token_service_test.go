@@ -0,0 +1,139 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newTestAccessTokenService returns an AccessTokenService backed by an
+// in-memory SQLite database holding the user "alice", a clock the test can
+// move, and the database
+func newTestAccessTokenService(t *testing.T) (*services.AccessTokenService, *time.Time, *gorm.DB) {
+	db := openTestDB(t, &models.User{}, &models.PersonalAccessToken{})
+	require.NoError(t, db.Create(&models.User{Username: "alice", Password: "x", Role: models.RoleUser}).Error)
+
+	accessTokenService := services.NewAccessTokenService(&repository.PostgresAccessTokenRepository{DB: db}, 90*24*time.Hour)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	accessTokenService.Now = func() time.Time { return now }
+	return accessTokenService, &now, db
+}
+
+func TestAccessTokenServiceCreateToken(t *testing.T) {
+	accessTokenService, _, db := newTestAccessTokenService(t)
+
+	plain, token, err := accessTokenService.CreateToken(1, 0, " ci ", []string{models.ScopeUsersRead}, 30*24*time.Hour)
+	require.NoError(t, err)
+
+	// The token is recognizable, and only its hash is stored
+	assert.True(t, strings.HasPrefix(plain, models.AccessTokenPrefix))
+	assert.Len(t, plain, len(models.AccessTokenPrefix)+43)
+	assert.True(t, strings.HasPrefix(plain, token.DisplayPrefix))
+	assert.Equal(t, "ci", token.Name)
+	assert.Equal(t, time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC), token.ExpiresAt)
+
+	var stored models.PersonalAccessToken
+	require.NoError(t, db.First(&stored, token.ID).Error)
+	assert.NotContains(t, stored.TokenHash, plain[len(models.AccessTokenPrefix):])
+	assert.Len(t, stored.TokenHash, 64)
+
+	tests := []struct {
+		name   string
+		tName  string
+		scopes []string
+		ttl    time.Duration
+	}{
+		{"Missing name", " ", []string{models.ScopeUsersRead}, time.Hour},
+		{"Missing scopes", "ci", nil, time.Hour},
+		{"Unknown scope", "ci", []string{"admin"}, time.Hour},
+		{"Lifetime too long", "ci", []string{models.ScopeUsersRead}, 91 * 24 * time.Hour},
+		{"No lifetime", "ci", []string{models.ScopeUsersRead}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := accessTokenService.CreateToken(1, 0, tt.tName, tt.scopes, tt.ttl)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAccessTokenServiceAuthenticate(t *testing.T) {
+	accessTokenService, now, db := newTestAccessTokenService(t)
+	plain, created, err := accessTokenService.CreateToken(1, 0, "ci", []string{models.ScopeUsersRead, models.ScopeUsersWrite}, 7*24*time.Hour)
+	require.NoError(t, err)
+
+	lastUse := func() (time.Time, string) {
+		var stored models.PersonalAccessToken
+		require.NoError(t, db.First(&stored, created.ID).Error)
+		require.NotNil(t, stored.LastUsedAt)
+		return stored.LastUsedAt.UTC(), stored.LastUsedIP
+	}
+
+	// The token authenticates its user, and the use is recorded
+	token, err := accessTokenService.Authenticate(plain, "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", token.User.Username)
+	assert.Equal(t, []string{models.ScopeUsersRead, models.ScopeUsersWrite}, token.ScopeList())
+	usedAt, ip := lastUse()
+	assert.Equal(t, *now, usedAt)
+	assert.Equal(t, "10.0.0.1", ip)
+
+	// Uses within a minute from the same IP are not saved again
+	firstUse := *now
+	*now = now.Add(30 * time.Second)
+	_, err = accessTokenService.Authenticate(plain, "10.0.0.1")
+	require.NoError(t, err)
+	usedAt, _ = lastUse()
+	assert.Equal(t, firstUse, usedAt)
+
+	// A new IP is always saved
+	_, err = accessTokenService.Authenticate(plain, "10.0.0.2")
+	require.NoError(t, err)
+	usedAt, ip = lastUse()
+	assert.Equal(t, *now, usedAt)
+	assert.Equal(t, "10.0.0.2", ip)
+
+	// Unknown and malformed tokens are rejected
+	_, err = accessTokenService.Authenticate(plain+"x", "10.0.0.1")
+	assert.ErrorIs(t, err, services.ErrInvalidAccessToken)
+	_, err = accessTokenService.Authenticate(strings.TrimPrefix(plain, models.AccessTokenPrefix), "10.0.0.1")
+	assert.ErrorIs(t, err, services.ErrInvalidAccessToken)
+
+	// Tokens of deactivated users are rejected
+	require.NoError(t, db.Model(&models.User{}).Where("id = ?", 1).Update("deactivated_at", *now).Error)
+	_, err = accessTokenService.Authenticate(plain, "10.0.0.1")
+	assert.ErrorIs(t, err, services.ErrInvalidAccessToken)
+	require.NoError(t, db.Model(&models.User{}).Where("id = ?", 1).Update("deactivated_at", nil).Error)
+
+	// Expired tokens are rejected
+	*now = now.Add(8 * 24 * time.Hour)
+	_, err = accessTokenService.Authenticate(plain, "10.0.0.1")
+	assert.ErrorIs(t, err, services.ErrAccessTokenExpired)
+}
+
+func TestAccessTokenServiceRevokeToken(t *testing.T) {
+	accessTokenService, _, db := newTestAccessTokenService(t)
+	require.NoError(t, db.Create(&models.User{Username: "bob", Password: "x"}).Error)
+	plain, token, err := accessTokenService.CreateToken(1, 0, "ci", []string{models.ScopeUsersRead}, time.Hour)
+	require.NoError(t, err)
+
+	// Users can only revoke their own tokens, once
+	assert.ErrorIs(t, accessTokenService.RevokeToken(2, token.ID), services.ErrAccessTokenMissing)
+	assert.NoError(t, accessTokenService.RevokeToken(1, token.ID))
+	assert.ErrorIs(t, accessTokenService.RevokeToken(1, token.ID), services.ErrAccessTokenMissing)
+
+	_, err = accessTokenService.Authenticate(plain, "10.0.0.1")
+	assert.ErrorIs(t, err, services.ErrAccessTokenExpired)
+
+	tokens, err := accessTokenService.ListTokens(1)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.NotNil(t, tokens[0].RevokedAt)
+}
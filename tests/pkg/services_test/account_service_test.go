@@ -0,0 +1,111 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAccountService(t *testing.T) (*services.AccountService, *services.UserService) {
+	db := openTestDB(t, &models.User{}, &models.Group{}, &models.UsernameChange{})
+	userRepo := &repository.PostgresUserRepository{DB: db}
+	userService := &services.UserService{Repo: userRepo, Hasher: fastHasher(services.AlgorithmArgon2id)}
+	return services.NewAccountService(userService, userRepo), userService
+}
+
+func TestAccountServiceChangePassword(t *testing.T) {
+	accounts, userService := newTestAccountService(t)
+	require.NoError(t, userService.RegisterUser("bob", "correct horse battery staple"))
+	bob, err := userService.GetUserByUsername("bob")
+	require.NoError(t, err)
+
+	_, err = accounts.ChangePassword(bob.ID, "wrong password", "a brand new passphrase")
+	assert.ErrorIs(t, err, services.ErrWrongPassword)
+	_, err = accounts.ChangePassword(bob.ID, "correct horse battery staple", "correct horse battery staple")
+	assert.ErrorIs(t, err, services.ErrSamePassword)
+	_, err = accounts.ChangePassword(bob.ID, "correct horse battery staple", "short")
+	assert.Error(t, err)
+
+	// Changing the password ends the other sessions
+	user, err := accounts.ChangePassword(bob.ID, "correct horse battery staple", "a brand new passphrase")
+	require.NoError(t, err)
+	assert.Equal(t, bob.SessionVersion+1, user.SessionVersion)
+
+	stored, err := accounts.GetAccount(bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.SessionVersion, stored.SessionVersion)
+	assert.NoError(t, userService.CheckPassword(stored, "a brand new passphrase"))
+	assert.Error(t, userService.CheckPassword(stored, "correct horse battery staple"))
+}
+
+func TestAccountServiceUpdateProfile(t *testing.T) {
+	accounts, userService := newTestAccountService(t)
+	require.NoError(t, userService.RegisterUser("bob", "correct horse battery staple"))
+	bob, err := userService.GetUserByUsername("bob")
+	require.NoError(t, err)
+
+	_, _, err = accounts.UpdateProfile(bob.ID, services.Profile{DisplayName: strings.Repeat("x", 101)})
+	assert.ErrorIs(t, err, services.ErrProfileTooLong)
+	_, _, err = accounts.UpdateProfile(bob.ID, services.Profile{Email: "not an address"})
+	assert.ErrorIs(t, err, services.ErrInvalidEmail)
+
+	user, previous, err := accounts.UpdateProfile(bob.ID, services.Profile{
+		DisplayName: "  Bob B. ",
+		GivenName:   "Bob",
+		Email:       " Bob@Example.COM ",
+	})
+	require.NoError(t, err)
+	assert.Empty(t, previous.DisplayName)
+	assert.Equal(t, "Bob B.", user.DisplayName)
+	assert.Equal(t, "bob@example.com", user.Email)
+	_, _, err = accounts.UpdateProfile(99, services.Profile{})
+	assert.ErrorIs(t, err, services.ErrUserNotFound)
+}
+
+func TestAccountServiceChangeUsername(t *testing.T) {
+	accounts, userService := newTestAccountService(t)
+	require.NoError(t, userService.RegisterUser("bob", "correct horse battery staple"))
+	require.NoError(t, userService.RegisterUser("carol", "correct horse battery staple"))
+	bob, err := userService.GetUserByUsername("bob")
+	require.NoError(t, err)
+
+	_, _, err = accounts.ChangeUsername(bob.ID, "bob")
+	assert.ErrorIs(t, err, services.ErrSameUsername)
+	_, _, err = accounts.ChangeUsername(bob.ID, "Carol")
+	assert.ErrorIs(t, err, services.ErrUserExists)
+
+	user, previous, err := accounts.ChangeUsername(bob.ID, "robert")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", previous)
+	assert.Equal(t, "robert", user.Username)
+
+	changes, err := accounts.ListUsernameChanges(bob.ID)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "bob", changes[0].OldUsername)
+	assert.Equal(t, "robert", changes[0].NewUsername)
+
+	// The old username redirects to the new one
+	resolved, redirected, err := accounts.ResolveUsername("Bob")
+	require.NoError(t, err)
+	assert.True(t, redirected)
+	assert.Equal(t, "robert", resolved.Username)
+	resolved, redirected, err = accounts.ResolveUsername("robert")
+	require.NoError(t, err)
+	assert.False(t, redirected)
+	assert.Equal(t, bob.ID, resolved.ID)
+	_, _, err = accounts.ResolveUsername("dave")
+	assert.ErrorIs(t, err, services.ErrUsernameUnknown)
+
+	// Until someone else takes it
+	require.NoError(t, userService.RegisterUser("bob", "correct horse battery staple"))
+	resolved, redirected, err = accounts.ResolveUsername("bob")
+	require.NoError(t, err)
+	assert.False(t, redirected)
+	assert.NotEqual(t, bob.ID, resolved.ID)
+}
@@ -0,0 +1,156 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB opens an in-memory SQLite database with the given tables
+func openTestDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard, TranslateError: true})
+	require.NoError(t, err)
+	// Every connection would open a new in-memory database
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(tables...))
+	return db
+}
+
+// newTestAuditService returns an AuditService backed by an in-memory SQLite
+// database, and the database so tests can tamper with it
+func newTestAuditService(t *testing.T) (*services.AuditService, *gorm.DB) {
+	db := openTestDB(t, &models.AuditEvent{})
+
+	auditService := services.NewAuditService(&repository.PostgresAuditRepository{DB: db})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	auditService.Now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+	return auditService, db
+}
+
+// recordTestEvents records a login, a registration and a role change
+func recordTestEvents(t *testing.T, auditService *services.AuditService) {
+	events := []models.AuditEvent{
+		{Action: models.AuditLogin, Outcome: models.AuditFailure, ActorUsername: "mallory", IP: "10.0.0.1"},
+		{Action: models.AuditRegister, Outcome: models.AuditSuccess, ActorUsername: "alice", TargetUsername: "alice"},
+		{Action: models.AuditRoleChange, Outcome: models.AuditSuccess, ActorUsername: "system", TargetUsername: "alice",
+			Changes: services.AuditChanges(map[string]interface{}{"role": "user"}, map[string]interface{}{"role": "admin"})},
+	}
+	for _, event := range events {
+		require.NoError(t, auditService.Record(event))
+	}
+}
+
+func TestAuditServiceChainsEvents(t *testing.T) {
+	auditService, _ := newTestAuditService(t)
+	recordTestEvents(t, auditService)
+
+	events, err := auditService.ListEvents(models.AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+
+	// Most recent first, each pointing to the one before
+	assert.Equal(t, models.AuditRoleChange, events[0].Action)
+	assert.Equal(t, events[1].Hash, events[0].PrevHash)
+	assert.Equal(t, events[2].Hash, events[1].PrevHash)
+	assert.Equal(t, models.AuditGenesisHash, events[2].PrevHash)
+
+	verification, err := auditService.VerifyChain()
+	require.NoError(t, err)
+	assert.Equal(t, &services.AuditVerification{Valid: true, Checked: 3}, verification)
+}
+
+func TestAuditServiceFiltersEvents(t *testing.T) {
+	auditService, _ := newTestAuditService(t)
+	recordTestEvents(t, auditService)
+
+	tests := []struct {
+		name    string
+		filter  models.AuditFilter
+		actions []string
+	}{
+		{"By action", models.AuditFilter{Action: models.AuditLogin}, []string{models.AuditLogin}},
+		{"By outcome", models.AuditFilter{Outcome: models.AuditSuccess}, []string{models.AuditRoleChange, models.AuditRegister}},
+		{"By actor", models.AuditFilter{Actor: "system"}, []string{models.AuditRoleChange}},
+		{"By target", models.AuditFilter{Target: "alice"}, []string{models.AuditRoleChange, models.AuditRegister}},
+		{"By date", models.AuditFilter{Since: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)}, nil},
+		{"Paginated", models.AuditFilter{Limit: 1, Offset: 1}, []string{models.AuditRegister}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := auditService.ListEvents(tt.filter)
+			require.NoError(t, err)
+
+			var actions []string
+			for _, event := range events {
+				actions = append(actions, event.Action)
+			}
+			assert.Equal(t, tt.actions, actions)
+		})
+	}
+}
+
+func TestAuditServiceDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(db *gorm.DB) error
+		reason string
+	}{
+		{
+			name: "Altered event",
+			tamper: func(db *gorm.DB) error {
+				return db.Exec("UPDATE audit_events SET outcome = ? WHERE id = 2", models.AuditFailure).Error
+			},
+			reason: "event was altered",
+		},
+		{
+			name: "Deleted event",
+			tamper: func(db *gorm.DB) error {
+				return db.Exec("DELETE FROM audit_events WHERE id = 2").Error
+			},
+			reason: "previous event is missing or was altered",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditService, db := newTestAuditService(t)
+			recordTestEvents(t, auditService)
+			require.NoError(t, tt.tamper(db))
+
+			verification, err := auditService.VerifyChain()
+			require.NoError(t, err)
+			assert.False(t, verification.Valid)
+			assert.Equal(t, tt.reason, verification.Reason)
+			assert.NotZero(t, verification.BrokenAt)
+		})
+	}
+}
+
+func TestAuditChanges(t *testing.T) {
+	before := map[string]interface{}{"username": "alice", "role": "user"}
+	after := map[string]interface{}{"username": "alice", "role": "admin", "password": services.Redacted}
+
+	// Unchanged fields are left out, missing ones are null
+	assert.JSONEq(t, `{
+		"role": {"from": "user", "to": "admin"},
+		"password": {"from": null, "to": "[redacted]"}
+	}`, services.AuditChanges(before, after))
+
+	assert.JSONEq(t, `{"username": {"from": null, "to": "bob"}}`,
+		services.AuditChanges(nil, map[string]interface{}{"username": "bob"}))
+	assert.Empty(t, services.AuditChanges(before, before))
+}
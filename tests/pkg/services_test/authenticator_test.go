@@ -0,0 +1,196 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const (
+	testServiceDN = "cn=login,ou=services,dc=example,dc=com"
+	testAdminsDN  = "cn=admins,ou=groups,dc=example,dc=com"
+	testStaffDN   = "cn=staff,ou=groups,dc=example,dc=com"
+	testAliceDN   = "uid=alice,ou=people,dc=example,dc=com"
+)
+
+// aliceEntry returns the directory entry of alice, a member of the groups
+func aliceEntry(groups ...string) utils.LDAPEntry {
+	return utils.LDAPEntry{
+		DN: testAliceDN,
+		Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"uid":         {"alice"},
+			"mail":        {"alice@example.com"},
+			"givenName":   {"Alice"},
+			"sn":          {"Liddell"},
+			"displayName": {"Alice Liddell"},
+			"memberOf":    groups,
+		},
+	}
+}
+
+// newTestLDAPAuthenticator returns an LDAPAuthenticator searching a
+// directory with alice, a local user service and their database
+func newTestLDAPAuthenticator(t *testing.T) (*services.LDAPAuthenticator, *services.UserService, *testutil.LDAPServer, *gorm.DB) {
+	db := openTestDB(t, &models.User{}, &models.Identity{})
+	userRepo := &repository.PostgresUserRepository{DB: db}
+	userService := &services.UserService{Repo: userRepo, Hasher: fastHasher(services.AlgorithmArgon2id)}
+
+	directory := testutil.NewLDAPServer(t)
+	directory.AddEntry(utils.LDAPEntry{DN: testServiceDN, Attributes: map[string][]string{"cn": {"login"}}}, "service-secret")
+	directory.AddEntry(aliceEntry(testStaffDN, testAdminsDN), "alice-secret")
+
+	authenticator := services.NewLDAPAuthenticator(userService, userRepo, &repository.PostgresIdentityRepository{DB: db},
+		directory.URL(), "ou=people,dc=example,dc=com")
+	authenticator.BindDN, authenticator.BindPassword = testServiceDN, "service-secret"
+	authenticator.UserFilter = "(&(objectClass=person)(uid={username}))"
+	authenticator.GroupRoles = []services.LDAPGroupRole{{Group: testAdminsDN, Role: models.RoleAdmin}}
+	authenticator.Timeout = time.Second
+	return authenticator, userService, directory, db
+}
+
+func TestLDAPAuthenticatorCreatesUsers(t *testing.T) {
+	authenticator, _, directory, db := newTestLDAPAuthenticator(t)
+
+	user, err := authenticator.Authenticate("Alice", "alice-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, models.RoleAdmin, user.Role)
+	assert.Equal(t, models.UserStatusActive, user.Status)
+	assert.Equal(t, "alice@example.com", user.Email)
+	assert.Equal(t, "Alice Liddell", user.DisplayName)
+	assert.Empty(t, user.Password)
+	assert.Equal(t, []string{testServiceDN, testAliceDN}, directory.Binds())
+
+	var identity models.Identity
+	require.NoError(t, db.Where("user_id = ?", user.ID).First(&identity).Error)
+	assert.Equal(t, services.LDAPProvider, identity.Provider)
+	assert.Equal(t, testAliceDN, identity.Subject)
+
+	// The next login finds the same user, with the role of their groups
+	directory.AddEntry(aliceEntry(testStaffDN), "alice-secret")
+	again, err := authenticator.Authenticate("alice", "alice-secret")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+	assert.Equal(t, models.RoleUser, again.Role)
+	var count int64
+	require.NoError(t, db.Model(&models.User{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+	var stored models.User
+	require.NoError(t, db.First(&stored, user.ID).Error)
+	assert.Equal(t, models.RoleUser, stored.Role)
+}
+
+func TestLDAPAuthenticatorRejectsInvalidCredentials(t *testing.T) {
+	authenticator, _, directory, _ := newTestLDAPAuthenticator(t)
+
+	// Unknown users are not told apart from wrong passwords
+	user, err := authenticator.Authenticate("alice", "wrong")
+	assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	assert.Nil(t, user)
+	_, err = authenticator.Authenticate("mallory", "alice-secret")
+	assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+
+	// The username cannot change the filter
+	_, err = authenticator.Authenticate("*", "alice-secret")
+	assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	_, err = authenticator.Authenticate("alice)(uid=*", "alice-secret")
+	assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+
+	// An empty password would be an unauthenticated bind, which succeeds
+	_, err = authenticator.Authenticate("alice", "")
+	assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	assert.NotContains(t, directory.Binds(), testAliceDN)
+
+	// Once alice is known, failures are recorded against her
+	created, err := authenticator.Authenticate("alice", "alice-secret")
+	require.NoError(t, err)
+	user, err = authenticator.Authenticate("alice", "wrong")
+	assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	require.NotNil(t, user)
+	assert.Equal(t, created.ID, user.ID)
+}
+
+func TestLDAPAuthenticatorDoesNotTakeOverLocalUsers(t *testing.T) {
+	authenticator, userService, _, _ := newTestLDAPAuthenticator(t)
+	require.NoError(t, userService.RegisterUser("alice", "correct horse battery staple"))
+
+	user, err := authenticator.Authenticate("alice", "alice-secret")
+	assert.ErrorIs(t, err, services.ErrDirectoryUserConflict)
+	assert.Nil(t, user)
+}
+
+func TestLDAPAuthenticatorReportsOutages(t *testing.T) {
+	authenticator, _, _, _ := newTestLDAPAuthenticator(t)
+
+	authenticator.BindPassword = "expired"
+	_, err := authenticator.Authenticate("alice", "alice-secret")
+	assert.ErrorIs(t, err, services.ErrDirectoryUnavailable)
+
+	stopped := testutil.NewLDAPServer(t)
+	authenticator.URL = stopped.URL()
+	stopped.Close()
+	_, err = authenticator.Authenticate("alice", "alice-secret")
+	assert.ErrorIs(t, err, services.ErrDirectoryUnavailable)
+}
+
+func TestParseLDAPGroupRoles(t *testing.T) {
+	groupRoles, err := services.ParseLDAPGroupRoles("admin:" + testAdminsDN + "; user:" + testStaffDN + ";")
+	require.NoError(t, err)
+	assert.Equal(t, []services.LDAPGroupRole{
+		{Group: testAdminsDN, Role: models.RoleAdmin},
+		{Group: testStaffDN, Role: models.RoleUser},
+	}, groupRoles)
+
+	for _, invalid := range []string{testAdminsDN, "admin:", "owner:" + testAdminsDN} {
+		_, err := services.ParseLDAPGroupRoles(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestAuthenticatorChain(t *testing.T) {
+	ldapAuthenticator, userService, _, _ := newTestLDAPAuthenticator(t)
+	require.NoError(t, userService.RegisterUser("dave", "correct horse battery staple"))
+	chain := services.AuthenticatorChain{&services.LocalAuthenticator{Users: userService}, ldapAuthenticator}
+
+	// Local users log in with their password, directory users with theirs,
+	// even once they have a local account without a password
+	dave, err := chain.Authenticate("dave", "correct horse battery staple")
+	require.NoError(t, err)
+	assert.Equal(t, "dave", dave.Username)
+	for i := 0; i < 2; i++ {
+		alice, err := chain.Authenticate("alice", "alice-secret")
+		require.NoError(t, err)
+		assert.Equal(t, "alice", alice.Username)
+	}
+
+	// Failures name the user a backend recognized
+	user, err := chain.Authenticate("dave", "wrong")
+	assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	require.NotNil(t, user)
+	assert.Equal(t, dave.ID, user.ID)
+	user, err = chain.Authenticate("nobody", "wrong")
+	assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	assert.Nil(t, user)
+
+	// Local users still log in while the directory is down, and directory
+	// users are told it is
+	stopped := testutil.NewLDAPServer(t)
+	ldapAuthenticator.URL = stopped.URL()
+	stopped.Close()
+	_, err = chain.Authenticate("dave", "correct horse battery staple")
+	assert.NoError(t, err)
+	_, err = chain.Authenticate("nobody", "alice-secret")
+	assert.ErrorIs(t, err, services.ErrDirectoryUnavailable)
+	user, err = chain.Authenticate("dave", "wrong")
+	assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	assert.NotNil(t, user)
+}
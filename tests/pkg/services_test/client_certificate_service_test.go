@@ -0,0 +1,101 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository/repository_mock"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newTestClientCertificateService returns a ClientCertificateService with
+// the billing, reports and audit service accounts
+func newTestClientCertificateService(t *testing.T) *services.ClientCertificateService {
+	userRepo := new(repository_mock.MockUserRepository)
+	userRepo.On("GetUserByUsername", "svc-billing").Return(&models.User{Model: gorm.Model{ID: 20}, Username: "svc-billing"}, nil)
+	userRepo.On("GetUserByUsername", "svc-reports").Return(&models.User{Model: gorm.Model{ID: 21}, Username: "svc-reports", Status: models.UserStatusSuspended}, nil)
+	userRepo.On("GetUserByUsername", "svc-audit").Return(nil, nil)
+
+	clientCertificateService, err := services.NewClientCertificateService(userRepo, []services.ServiceAccount{
+		{ID: "billing", Username: "svc-billing", Subjects: []string{"CN=billing", "dns:Billing.Internal", "URI:spiffe://corp/billing", "EMAIL:Billing@Example.com"}, Scopes: []string{models.ScopeUsersRead}},
+		{ID: "reports", Username: "svc-reports", Subjects: []string{"CN=reports"}},
+		{ID: "audit", Username: "svc-audit", Subjects: []string{"CN=audit"}},
+		{ID: "shadow", Username: "svc-reports", Subjects: []string{"CN=billing"}},
+	})
+	require.NoError(t, err)
+	return clientCertificateService
+}
+
+func TestClientCertificateServiceMapsIdentities(t *testing.T) {
+	clientCertificateService := newTestClientCertificateService(t)
+	spiffeID, _ := url.Parse("spiffe://corp/billing")
+
+	tests := []struct {
+		name        string
+		certificate *x509.Certificate
+	}{
+		{"Common name", &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}},
+		{"DNS name in any case", &x509.Certificate{Subject: pkix.Name{CommonName: "host-1"}, DNSNames: []string{"other.internal", "BILLING.internal"}}},
+		{"URI", &x509.Certificate{URIs: []*url.URL{spiffeID}}},
+		{"Email address in any case", &x509.Certificate{EmailAddresses: []string{"billing@example.COM"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account, user, err := clientCertificateService.Authenticate(tt.certificate)
+			require.NoError(t, err)
+			assert.Equal(t, "billing", account.ID, "the first matching account is used")
+			assert.Equal(t, []string{models.ScopeUsersRead}, account.Scopes)
+			assert.Equal(t, uint(20), user.ID)
+		})
+	}
+}
+
+func TestClientCertificateServiceRejectsCertificates(t *testing.T) {
+	clientCertificateService := newTestClientCertificateService(t)
+	otherSpiffeID, _ := url.Parse("spiffe://corp/billing/admin")
+
+	tests := []struct {
+		name        string
+		certificate *x509.Certificate
+		expectedErr error
+	}{
+		{"Unknown common name", &x509.Certificate{Subject: pkix.Name{CommonName: "Billing"}}, services.ErrUnknownClientCertificate},
+		{"Common name given as a DNS name", &x509.Certificate{DNSNames: []string{"billing"}}, services.ErrUnknownClientCertificate},
+		{"Other URI", &x509.Certificate{URIs: []*url.URL{otherSpiffeID}}, services.ErrUnknownClientCertificate},
+		{"Organization only", &x509.Certificate{Subject: pkix.Name{Organization: []string{"billing"}}}, services.ErrUnknownClientCertificate},
+		{"Suspended user", &x509.Certificate{Subject: pkix.Name{CommonName: "reports"}}, services.ErrAccountSuspended},
+		{"Missing user", &x509.Certificate{Subject: pkix.Name{CommonName: "audit"}}, services.ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account, _, err := clientCertificateService.Authenticate(tt.certificate)
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Nil(t, account)
+		})
+	}
+}
+
+func TestNewClientCertificateServiceChecksAccounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		account services.ServiceAccount
+	}{
+		{"No username", services.ServiceAccount{ID: "billing", Subjects: []string{"CN=billing"}}},
+		{"No subjects", services.ServiceAccount{ID: "billing", Username: "svc-billing"}},
+		{"Unknown subject kind", services.ServiceAccount{ID: "billing", Username: "svc-billing", Subjects: []string{"OU=billing"}}},
+		{"Empty subject", services.ServiceAccount{ID: "billing", Username: "svc-billing", Subjects: []string{"CN="}}},
+		{"Unknown scope", services.ServiceAccount{ID: "billing", Username: "svc-billing", Subjects: []string{"CN=billing"}, Scopes: []string{"admin"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := services.NewClientCertificateService(new(repository_mock.MockUserRepository), []services.ServiceAccount{tt.account})
+			assert.Error(t, err)
+		})
+	}
+}
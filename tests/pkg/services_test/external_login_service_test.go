@@ -0,0 +1,259 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newTestExternalLoginService returns an ExternalLoginService logging in
+// with a mock provider, and its database. The provider settings can be
+// changed by configure.
+func newTestExternalLoginService(t *testing.T, configure func(provider *services.ExternalProvider)) (*services.ExternalLoginService, *testutil.OIDCProvider, *gorm.DB) {
+	db := openTestDB(t, &models.User{}, &models.Identity{})
+	provider := testutil.NewOIDCProvider(t)
+
+	userService := services.NewUserService(&repository.PostgresUserRepository{DB: db})
+	settings := services.ExternalProvider{
+		ID:           "corp",
+		Name:         "Corp SSO",
+		Issuer:       provider.Issuer(),
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		Scopes:       []string{"openid", "profile", "email"},
+		Provisioning: services.ProvisionCreate,
+	}
+	if configure != nil {
+		configure(&settings)
+	}
+	externalLoginService := services.NewExternalLoginService(&repository.PostgresIdentityRepository{DB: db}, userService,
+		"https://app.example.com", nil, []services.ExternalProvider{settings})
+	return externalLoginService, provider, db
+}
+
+// externalLogin runs a whole login with the provider, in a single browser
+func externalLogin(t *testing.T, externalLoginService *services.ExternalLoginService, provider *testutil.OIDCProvider) (*services.ExternalLogin, error) {
+	authURL, cookie, err := externalLoginService.BeginLogin("corp", "/oauth2/authorize?client_id=wiki")
+	require.NoError(t, err)
+	callback := provider.Authorize(t, authURL)
+	return externalLoginService.CompleteLogin("corp", cookie, callback.Query().Get("state"), callback.Query().Get("code"))
+}
+
+func TestExternalLoginAuthorizationRequest(t *testing.T) {
+	externalLoginService, provider, _ := newTestExternalLoginService(t, nil)
+
+	authURL, cookie, err := externalLoginService.BeginLogin("corp", "")
+	require.NoError(t, err)
+	assert.NotEmpty(t, cookie)
+
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	query := parsed.Query()
+	assert.Equal(t, provider.Issuer()+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+	assert.Equal(t, "https://app.example.com/api/v1/user/login/corp/callback", query.Get("redirect_uri"))
+	assert.Equal(t, "openid profile email", query.Get("scope"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	for _, param := range []string{"state", "nonce", "code_challenge"} {
+		assert.Len(t, query.Get(param), 43, param)
+	}
+
+	_, _, err = externalLoginService.BeginLogin("other", "")
+	assert.ErrorIs(t, err, services.ErrUnknownProvider)
+}
+
+func TestExternalLoginProvisionsUsers(t *testing.T) {
+	externalLoginService, provider, db := newTestExternalLoginService(t, nil)
+	provider.Claims["email"] = "alice@corp.example.com"
+
+	login, err := externalLogin(t, externalLoginService, provider)
+	require.NoError(t, err)
+	assert.True(t, login.Created)
+	assert.Equal(t, "alice", login.User.Username)
+	assert.Equal(t, models.RoleUser, login.User.Role)
+	assert.Empty(t, login.User.Password)
+	assert.Equal(t, "/oauth2/authorize?client_id=wiki", login.Next)
+
+	// The next login finds the user through the identity, even after the
+	// username changed at the provider
+	provider.Claims["preferred_username"] = "alice.smith"
+	again, err := externalLogin(t, externalLoginService, provider)
+	require.NoError(t, err)
+	assert.False(t, again.Created)
+	assert.Equal(t, login.User.ID, again.User.ID)
+
+	var identities []models.Identity
+	require.NoError(t, db.Find(&identities).Error)
+	require.Len(t, identities, 1)
+	assert.Equal(t, "corp", identities[0].Provider)
+	assert.Equal(t, "subject-1", identities[0].Subject)
+	assert.NotNil(t, identities[0].LastLoginAt)
+}
+
+func TestExternalLoginProvisioningRules(t *testing.T) {
+	tests := []struct {
+		name           string
+		provisioning   string
+		allowedDomains []string
+		usernameClaim  string
+		claims         map[string]interface{}
+		existingUser   string
+		existingEmail  string
+		existingRole   string
+		expectedErr    error
+		expectedUser   string
+		expectedLinked bool
+	}{
+		{name: "None", provisioning: services.ProvisionNone, expectedErr: services.ErrIdentityNotLinked},
+		{name: "Create with taken username", provisioning: services.ProvisionCreate, existingUser: "alice", expectedErr: services.ErrUserExists},
+		{
+			name: "Link existing user", provisioning: services.ProvisionLink, existingUser: "Alice", existingEmail: "alice@corp.example.com",
+			claims:       map[string]interface{}{"email": "Alice@corp.example.com", "email_verified": true},
+			expectedUser: "Alice", expectedLinked: true,
+		},
+		{
+			name: "Link with unverified email", provisioning: services.ProvisionLink, existingUser: "Alice", existingEmail: "alice@corp.example.com",
+			claims:      map[string]interface{}{"email": "alice@corp.example.com", "email_verified": false},
+			expectedErr: services.ErrIdentityLink,
+		},
+		{
+			name: "Link with other email", provisioning: services.ProvisionLink, existingUser: "Alice", existingEmail: "alice@corp.example.com",
+			claims:      map[string]interface{}{"email": "alice@anywhere.com", "email_verified": true, "preferred_username": "alice@anywhere.com"},
+			expectedErr: services.ErrIdentityLink,
+		},
+		{
+			name: "Link user without email", provisioning: services.ProvisionLink, existingUser: "Alice",
+			claims:      map[string]interface{}{"email": "", "email_verified": true},
+			expectedErr: services.ErrIdentityLink,
+		},
+		{
+			name: "Link admin", provisioning: services.ProvisionLink, existingUser: "Alice", existingEmail: "alice@corp.example.com",
+			existingRole: models.RoleAdmin,
+			claims:       map[string]interface{}{"email": "alice@corp.example.com", "email_verified": true},
+			expectedErr:  services.ErrIdentityLink,
+		},
+		{name: "Link creates missing user", provisioning: services.ProvisionLink, expectedUser: "alice"},
+		{
+			name: "Allowed domain", provisioning: services.ProvisionCreate, allowedDomains: []string{"corp.example.com"},
+			claims:       map[string]interface{}{"email": "alice@Corp.Example.com", "email_verified": true},
+			expectedUser: "alice",
+		},
+		{
+			name: "Other domain", provisioning: services.ProvisionCreate, allowedDomains: []string{"corp.example.com"},
+			claims:      map[string]interface{}{"email": "alice@gmail.com", "email_verified": true},
+			expectedErr: services.ErrIdentityDomain,
+		},
+		{
+			name: "Unverified email", provisioning: services.ProvisionCreate, allowedDomains: []string{"corp.example.com"},
+			claims:      map[string]interface{}{"email": "alice@corp.example.com", "email_verified": false},
+			expectedErr: services.ErrIdentityDomain,
+		},
+		{
+			name: "Username from email", provisioning: services.ProvisionCreate, usernameClaim: "email",
+			claims:       map[string]interface{}{"email": "carol@corp.example.com"},
+			expectedUser: "carol",
+		},
+		{
+			name: "Missing username", provisioning: services.ProvisionCreate,
+			claims:      map[string]interface{}{"preferred_username": nil},
+			expectedErr: services.ErrInvalidIDToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			externalLoginService, provider, db := newTestExternalLoginService(t, func(provider *services.ExternalProvider) {
+				provider.Provisioning = tt.provisioning
+				provider.AllowedDomains = tt.allowedDomains
+				provider.UsernameClaim = tt.usernameClaim
+			})
+			for name, value := range tt.claims {
+				provider.Claims[name] = value
+			}
+			if tt.existingUser != "" {
+				user := models.User{Username: tt.existingUser, NormalizedUsername: "alice", Password: "x", Email: tt.existingEmail, Role: tt.existingRole}
+				require.NoError(t, db.Create(&user).Error)
+			}
+
+			login, err := externalLogin(t, externalLoginService, provider)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedUser, login.User.Username)
+			assert.Equal(t, tt.expectedLinked, login.Linked)
+			assert.Equal(t, !tt.expectedLinked, login.Created)
+		})
+	}
+}
+
+func TestExternalLoginRejectsForeignState(t *testing.T) {
+	externalLoginService, provider, _ := newTestExternalLoginService(t, nil)
+
+	authURL, cookie, err := externalLoginService.BeginLogin("corp", "")
+	require.NoError(t, err)
+	callback := provider.Authorize(t, authURL)
+	code := callback.Query().Get("code")
+
+	// A login started in another browser
+	_, otherCookie, err := externalLoginService.BeginLogin("corp", "")
+	require.NoError(t, err)
+	_, err = externalLoginService.CompleteLogin("corp", otherCookie, callback.Query().Get("state"), code)
+	assert.ErrorIs(t, err, services.ErrExternalLoginState)
+
+	// No cookie, or a forged one
+	_, err = externalLoginService.CompleteLogin("corp", "", callback.Query().Get("state"), code)
+	assert.ErrorIs(t, err, services.ErrExternalLoginState)
+	_, err = externalLoginService.CompleteLogin("corp", cookie+"x", callback.Query().Get("state"), code)
+	assert.ErrorIs(t, err, services.ErrExternalLoginState)
+
+	// An expired login
+	externalLoginService.Now = func() time.Time { return time.Now().Add(11 * time.Minute) }
+	_, err = externalLoginService.CompleteLogin("corp", cookie, callback.Query().Get("state"), code)
+	assert.ErrorIs(t, err, services.ErrExternalLoginState)
+}
+
+func TestExternalLoginVerifiesIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(claims jwt.MapClaims)
+	}{
+		{"Wrong nonce", func(claims jwt.MapClaims) { claims["nonce"] = "replayed" }},
+		{"Wrong issuer", func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" }},
+		{"Wrong audience", func(claims jwt.MapClaims) { claims["aud"] = "other-client" }},
+		{"Shared audience without azp", func(claims jwt.MapClaims) { claims["aud"] = []string{"test-client", "other-client"} }},
+		{"Expired", func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-2 * time.Minute).Unix() }},
+		{"Issued in the future", func(claims jwt.MapClaims) { claims["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{"No subject", func(claims jwt.MapClaims) { delete(claims, "sub") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			externalLoginService, provider, _ := newTestExternalLoginService(t, nil)
+			provider.TamperIDToken = tt.tamper
+
+			_, err := externalLogin(t, externalLoginService, provider)
+			assert.ErrorIs(t, err, services.ErrInvalidIDToken)
+		})
+	}
+}
+
+func TestExternalLoginRejectsWrongClientSecret(t *testing.T) {
+	externalLoginService, provider, _ := newTestExternalLoginService(t, nil)
+	provider.ClientSecret = "rotated"
+
+	_, err := externalLogin(t, externalLoginService, provider)
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, services.ErrInvalidIDToken))
+	assert.Contains(t, err.Error(), "invalid_client")
+}
@@ -0,0 +1,83 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// createImpersonationUser creates a user with a role and permissions
+func createImpersonationUser(t *testing.T, db *gorm.DB, username, role, permissions, status string) *models.User {
+	user := &models.User{Username: username, Password: "x", Role: role, Permissions: permissions, Status: status}
+	require.NoError(t, db.Create(user).Error)
+	return user
+}
+
+func TestImpersonationService(t *testing.T) {
+	db := openTestDB(t, &models.User{})
+	impersonation := services.NewImpersonationService(&repository.PostgresUserRepository{DB: db})
+	alice := createImpersonationUser(t, db, "alice", models.RoleAdmin, "audit "+models.PermissionImpersonate, models.UserStatusActive)
+	carol := createImpersonationUser(t, db, "carol", models.RoleAdmin, "", models.UserStatusActive)
+	bob := createImpersonationUser(t, db, "bob", models.RoleUser, "", models.UserStatusActive)
+	dave := createImpersonationUser(t, db, "dave", models.RoleUser, "", models.UserStatusSuspended)
+	mallory := createImpersonationUser(t, db, "mallory", models.RoleUser, models.PermissionImpersonate, models.UserStatusActive)
+
+	// Only admins granted the permission may impersonate
+	for user, allowed := range map[*models.User]bool{alice: true, carol: false, bob: false, mallory: false} {
+		can, err := impersonation.CanImpersonate(user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, allowed, can, user.Username)
+	}
+	_, _, err := impersonation.StartImpersonation(carol.ID, bob.ID)
+	assert.ErrorIs(t, err, services.ErrImpersonationNotAllowed)
+	_, _, err = impersonation.StartImpersonation(mallory.ID, bob.ID)
+	assert.ErrorIs(t, err, services.ErrImpersonationNotAllowed)
+
+	actor, target, err := impersonation.StartImpersonation(alice.ID, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", actor.Username)
+	assert.Equal(t, "bob", target.Username)
+
+	// Admins, the actor and users who cannot log in are not impersonated
+	for _, user := range []*models.User{carol, alice, dave} {
+		_, _, err := impersonation.StartImpersonation(alice.ID, user.ID)
+		assert.ErrorIs(t, err, services.ErrImpersonationTarget, user.Username)
+	}
+	_, _, err = impersonation.StartImpersonation(alice.ID, 99)
+	assert.ErrorIs(t, err, services.ErrUserNotFound)
+
+	// Stopping needs the admin to still be able to log in
+	actor, err = impersonation.StopImpersonation(alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, actor.ID)
+	require.NoError(t, db.Model(alice).Update("status", models.UserStatusLocked).Error)
+	_, err = impersonation.StopImpersonation(alice.ID)
+	assert.ErrorIs(t, err, services.ErrImpersonationNotAllowed)
+	_, err = impersonation.StopImpersonation(99)
+	assert.ErrorIs(t, err, services.ErrUserNotFound)
+}
+
+func TestGrantPermission(t *testing.T) {
+	db := openTestDB(t, &models.User{})
+	userService := &services.UserService{Repo: &repository.PostgresUserRepository{DB: db}, Hasher: fastHasher(services.AlgorithmArgon2id)}
+	require.NoError(t, userService.RegisterUser("alice", "correct horse battery staple"))
+
+	user, granted, err := userService.GrantPermission("alice", models.PermissionImpersonate)
+	require.NoError(t, err)
+	assert.True(t, granted)
+	assert.True(t, user.HasPermission(models.PermissionImpersonate))
+
+	// Granting it again changes nothing
+	user, granted, err = userService.GrantPermission("alice", models.PermissionImpersonate)
+	require.NoError(t, err)
+	assert.False(t, granted)
+	assert.Equal(t, models.PermissionImpersonate, user.Permissions)
+
+	_, _, err = userService.GrantPermission("nobody", models.PermissionImpersonate)
+	assert.ErrorIs(t, err, services.ErrUserNotFound)
+}
@@ -0,0 +1,196 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/internal/tenant"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// sentEmail is an email recorded by recordingMailer
+type sentEmail struct {
+	To, Subject, Body string
+}
+
+// recordingMailer records the emails it is asked to send, or fails to send
+// them when err is set
+type recordingMailer struct {
+	sent []sentEmail
+	err  error
+}
+
+// Send records the email
+func (m *recordingMailer) Send(to, subject, body string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, sentEmail{To: to, Subject: subject, Body: body})
+	return nil
+}
+
+// lastToken returns the token of the accept link in the last email sent
+func (m *recordingMailer) lastToken(t *testing.T) string {
+	require.NotEmpty(t, m.sent)
+	body := m.sent[len(m.sent)-1].Body
+	start := strings.Index(body, services.InvitationPath)
+	require.GreaterOrEqual(t, start, 0)
+	return strings.Fields(body[start+len(services.InvitationPath):])[0]
+}
+
+// invitationFixture holds an InvitationService backed by an in-memory
+// SQLite database, with a clock tests can move and alice, an owner of acme
+type invitationFixture struct {
+	invitations *services.InvitationService
+	mailer      *recordingMailer
+	db          *gorm.DB
+	now         time.Time
+	acme        context.Context
+	alice       *models.User
+}
+
+func newInvitationFixture(t *testing.T) *invitationFixture {
+	db := openTestDB(t, &models.User{}, &models.Organization{}, &models.Membership{}, &models.Invitation{})
+	userRepo := &repository.PostgresUserRepository{DB: db}
+	organizationRepo := &repository.PostgresOrganizationRepository{DB: db}
+	userService := &services.UserService{Repo: userRepo, Hasher: fastHasher(services.AlgorithmArgon2id)}
+
+	f := &invitationFixture{mailer: &recordingMailer{}, db: db, now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	f.invitations = services.NewInvitationService(&repository.PostgresInvitationRepository{DB: db}, userService, userRepo,
+		organizationRepo, f.mailer, "https://example.com/", 72*time.Hour)
+	f.invitations.Now = func() time.Time { return f.now }
+
+	f.alice = createOrgUser(t, db, "alice")
+	acme := &models.Organization{Name: "Acme", Slug: "acme"}
+	require.NoError(t, organizationRepo.CreateOrganization(acme, &models.Membership{UserID: f.alice.ID, Role: models.OrgRoleOwner}))
+	f.acme = tenant.WithOrganization(context.Background(), acme.ID)
+	return f
+}
+
+func TestInvitationServiceCreateInvitation(t *testing.T) {
+	f := newInvitationFixture(t)
+
+	invitation, err := f.invitations.CreateInvitation(f.acme, f.alice.ID, " Bob@Example.com ", models.RoleAdmin, models.OrgRoleAdmin)
+	require.NoError(t, err)
+	assert.Equal(t, "bob@example.com", invitation.Email)
+	assert.Equal(t, f.now.Add(72*time.Hour), invitation.ExpiresAt)
+
+	// The token is only sent to the invitee, and only its hash is stored
+	require.Len(t, f.mailer.sent, 1)
+	assert.Equal(t, "bob@example.com", f.mailer.sent[0].To)
+	assert.Contains(t, f.mailer.sent[0].Subject, "Acme")
+	assert.Contains(t, f.mailer.sent[0].Body, "alice invited you")
+	assert.Contains(t, f.mailer.sent[0].Body, "https://example.com/api/v1/user/invitations/")
+	assert.NotEqual(t, f.mailer.lastToken(t), invitation.TokenHash)
+
+	_, err = f.invitations.CreateInvitation(f.acme, f.alice.ID, "bob@example.com", "", "")
+	assert.ErrorIs(t, err, services.ErrInvitationExists)
+	_, err = f.invitations.CreateInvitation(f.acme, f.alice.ID, "Bob <carol@example.com>", "", "")
+	assert.ErrorIs(t, err, services.ErrInvalidEmail)
+	_, err = f.invitations.CreateInvitation(f.acme, f.alice.ID, "carol@example.com", "root", "")
+	assert.ErrorIs(t, err, services.ErrInvalidRole)
+	_, err = f.invitations.CreateInvitation(f.acme, f.alice.ID, "carol@example.com", "", "superuser")
+	assert.ErrorIs(t, err, services.ErrInvalidOrganizationRole)
+
+	// Invitations failing to send are kept, to be resent
+	f.mailer.err = errors.New("connection refused")
+	invitation, err = f.invitations.CreateInvitation(f.acme, f.alice.ID, "carol@example.com", "", "")
+	assert.ErrorIs(t, err, services.ErrInvitationNotSent)
+	require.NotNil(t, invitation)
+	assert.Equal(t, models.RoleUser, invitation.Role)
+	assert.Equal(t, models.OrgRoleMember, invitation.OrgRole)
+
+	// Other organizations do not see them
+	other := organizationContext(t, f.db, "globex")
+	invitations, err := f.invitations.ListInvitations(other)
+	require.NoError(t, err)
+	assert.Empty(t, invitations)
+	invitations, err = f.invitations.ListInvitations(f.acme)
+	require.NoError(t, err)
+	assert.Len(t, invitations, 2)
+	_, err = f.invitations.CreateInvitation(other, f.alice.ID, "dave@example.com", "", "")
+	assert.ErrorIs(t, err, services.ErrNotMember)
+}
+
+func TestInvitationServiceAcceptInvitation(t *testing.T) {
+	f := newInvitationFixture(t)
+	invitation, err := f.invitations.CreateInvitation(f.acme, f.alice.ID, "bob@example.com", models.RoleAdmin, models.OrgRoleAdmin)
+	require.NoError(t, err)
+	token := f.mailer.lastToken(t)
+
+	pending, err := f.invitations.GetPendingInvitation(token)
+	require.NoError(t, err)
+	assert.Equal(t, "Acme", pending.Organization.Name)
+
+	// A taken username leaves the invitation usable
+	_, _, err = f.invitations.AcceptInvitation(token, "alice", "correct horse battery staple")
+	assert.ErrorIs(t, err, services.ErrUserExists)
+
+	user, accepted, err := f.invitations.AcceptInvitation(token, "bob", "correct horse battery staple")
+	require.NoError(t, err)
+	assert.Equal(t, invitation.ID, accepted.ID)
+	assert.Equal(t, models.RoleAdmin, user.Role)
+	assert.Equal(t, "bob@example.com", user.Email)
+	assert.Equal(t, invitation.OrganizationID, *user.ActiveOrganizationID)
+
+	var membership models.Membership
+	require.NoError(t, f.db.Where("user_id = ?", user.ID).First(&membership).Error)
+	assert.Equal(t, models.OrgRoleAdmin, membership.Role)
+	var stored models.User
+	require.NoError(t, f.db.First(&stored, user.ID).Error)
+	assert.NotEmpty(t, stored.Password)
+
+	// Invitations are single-use
+	_, _, err = f.invitations.AcceptInvitation(token, "bob2", "correct horse battery staple")
+	assert.ErrorIs(t, err, services.ErrInvitationInvalid)
+	_, err = f.invitations.GetPendingInvitation("not-a-token")
+	assert.ErrorIs(t, err, services.ErrInvitationInvalid)
+	_, err = f.invitations.ResendInvitation(f.acme, invitation.ID)
+	assert.ErrorIs(t, err, services.ErrInvitationMissing)
+	_, err = f.invitations.RevokeInvitation(f.acme, invitation.ID)
+	assert.ErrorIs(t, err, services.ErrInvitationMissing)
+}
+
+func TestInvitationServiceExpiryResendAndRevoke(t *testing.T) {
+	f := newInvitationFixture(t)
+	invitation, err := f.invitations.CreateInvitation(f.acme, f.alice.ID, "bob@example.com", "", "")
+	require.NoError(t, err)
+	firstToken := f.mailer.lastToken(t)
+
+	// Expired invitations cannot be accepted, and are listed as such
+	f.now = f.now.Add(73 * time.Hour)
+	_, _, err = f.invitations.AcceptInvitation(firstToken, "bob", "correct horse battery staple")
+	assert.ErrorIs(t, err, services.ErrInvitationExpired)
+	invitations, err := f.invitations.ListInvitations(f.acme)
+	require.NoError(t, err)
+	assert.Equal(t, models.InvitationExpired, invitations[0].Status(f.now))
+
+	// Resending replaces the link and its expiry
+	resent, err := f.invitations.ResendInvitation(f.acme, invitation.ID)
+	require.NoError(t, err)
+	assert.Equal(t, f.now.Add(72*time.Hour), resent.ExpiresAt)
+	secondToken := f.mailer.lastToken(t)
+	assert.NotEqual(t, firstToken, secondToken)
+	_, err = f.invitations.GetPendingInvitation(firstToken)
+	assert.ErrorIs(t, err, services.ErrInvitationInvalid)
+	_, err = f.invitations.GetPendingInvitation(secondToken)
+	assert.NoError(t, err)
+
+	// Invitations of other organizations cannot be revoked
+	_, err = f.invitations.RevokeInvitation(organizationContext(t, f.db, "globex"), invitation.ID)
+	assert.ErrorIs(t, err, services.ErrInvitationMissing)
+
+	revoked, err := f.invitations.RevokeInvitation(f.acme, invitation.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.InvitationRevoked, revoked.Status(f.now))
+	_, _, err = f.invitations.AcceptInvitation(secondToken, "bob", "correct horse battery staple")
+	assert.ErrorIs(t, err, services.ErrInvitationInvalid)
+}
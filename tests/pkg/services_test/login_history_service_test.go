@@ -0,0 +1,171 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const chromeUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Safari/537.36"
+
+// stubGeoLocator locates the IPs it knows, and leaves the others unlocated
+type stubGeoLocator map[string]services.GeoLocation
+
+// Locate returns the location of a known IP
+func (l stubGeoLocator) Locate(ip string) (*services.GeoLocation, error) {
+	location, ok := l[ip]
+	if !ok {
+		return nil, nil
+	}
+	return &location, nil
+}
+
+var testGeoLocator = stubGeoLocator{
+	"192.0.2.1":    {CountryCode: "FR", Country: "France", City: "Paris", Latitude: 48.8566, Longitude: 2.3522, HasCoordinates: true},
+	"198.51.100.1": {CountryCode: "FR", Country: "France", City: "Lyon", Latitude: 45.764, Longitude: 4.8357, HasCoordinates: true},
+	"203.0.113.1":  {CountryCode: "AU", Country: "Australia", City: "Sydney", Latitude: -33.8688, Longitude: 151.2093, HasCoordinates: true},
+}
+
+func newTestLoginHistoryService(t *testing.T) (*services.LoginHistoryService, *recordingMailer, *time.Time) {
+	db := openTestDB(t, &models.LoginAttempt{})
+	mailer := &recordingMailer{}
+	loginHistoryService := services.NewLoginHistoryService(&repository.PostgresLoginAttemptRepository{DB: db},
+		testGeoLocator, &services.MailLoginNotifier{Mailer: mailer})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	loginHistoryService.Now = func() time.Time { return now }
+	return loginHistoryService, mailer, &now
+}
+
+func loginHistoryUser() *models.User {
+	user := &models.User{Username: "alice", Email: "alice@example.com"}
+	user.ID = 1
+	return user
+}
+
+func TestLoginHistoryServiceNewDevice(t *testing.T) {
+	loginHistoryService, mailer, now := newTestLoginHistoryService(t)
+	user := loginHistoryUser()
+
+	// The first login has nothing to compare with
+	first, err := loginHistoryService.RecordLogin("alice", user, models.AuditSuccess, "192.0.2.1", firefoxUserAgent)
+	require.NoError(t, err)
+	assert.Empty(t, first.AlertList())
+	assert.Equal(t, "Paris, France", first.Location())
+	assert.Equal(t, "Firefox on Linux", first.Device)
+
+	*now = now.Add(time.Hour)
+	again, err := loginHistoryService.RecordLogin("alice", user, models.AuditSuccess, "198.51.100.1", firefoxUserAgent)
+	require.NoError(t, err)
+	assert.Empty(t, again.AlertList())
+
+	*now = now.Add(time.Hour)
+	other, err := loginHistoryService.RecordLogin("alice", user, models.AuditSuccess, "198.51.100.1", chromeUserAgent)
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.LoginAlertNewDevice}, other.AlertList())
+
+	// The user is emailed about the new device only
+	require.Len(t, mailer.sent, 1)
+	assert.Equal(t, "alice@example.com", mailer.sent[0].To)
+	assert.Contains(t, mailer.sent[0].Body, "Login from a new device or browser")
+	assert.Contains(t, mailer.sent[0].Body, "Location: Lyon, France")
+
+	// Unknown user agents are never flagged
+	*now = now.Add(time.Hour)
+	unknown, err := loginHistoryService.RecordLogin("alice", user, models.AuditSuccess, "198.51.100.1", "")
+	require.NoError(t, err)
+	assert.Empty(t, unknown.AlertList())
+}
+
+func TestLoginHistoryServiceImpossibleTravel(t *testing.T) {
+	loginHistoryService, mailer, now := newTestLoginHistoryService(t)
+	user := loginHistoryUser()
+
+	_, err := loginHistoryService.RecordLogin("alice", user, models.AuditSuccess, "192.0.2.1", firefoxUserAgent)
+	require.NoError(t, err)
+
+	// Paris to Lyon is short enough to be ignored, even within minutes
+	*now = now.Add(10 * time.Minute)
+	lyon, err := loginHistoryService.RecordLogin("alice", user, models.AuditSuccess, "198.51.100.1", firefoxUserAgent)
+	require.NoError(t, err)
+	assert.Empty(t, lyon.AlertList())
+
+	// Lyon to Sydney takes longer than two hours
+	*now = now.Add(2 * time.Hour)
+	sydney, err := loginHistoryService.RecordLogin("alice", user, models.AuditSuccess, "203.0.113.1", firefoxUserAgent)
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.LoginAlertImpossibleTravel}, sydney.AlertList())
+	require.Len(t, mailer.sent, 1)
+
+	// But not longer than a day, and unlocated logins are not compared
+	*now = now.Add(24 * time.Hour)
+	paris, err := loginHistoryService.RecordLogin("alice", user, models.AuditSuccess, "192.0.2.1", firefoxUserAgent)
+	require.NoError(t, err)
+	assert.Empty(t, paris.AlertList())
+	unlocated, err := loginHistoryService.RecordLogin("alice", user, models.AuditSuccess, "10.0.0.1", firefoxUserAgent)
+	require.NoError(t, err)
+	assert.Empty(t, unlocated.AlertList())
+	assert.Nil(t, unlocated.Latitude)
+}
+
+func TestLoginHistoryServiceFailureBurst(t *testing.T) {
+	loginHistoryService, mailer, now := newTestLoginHistoryService(t)
+	user := loginHistoryUser()
+
+	// The fifth failure within 15 minutes raises a single alert
+	var alerted []int
+	for i := 1; i <= 7; i++ {
+		attempt, err := loginHistoryService.RecordLogin("alice", user, models.AuditFailure, "203.0.113.1", firefoxUserAgent)
+		require.NoError(t, err)
+		if len(attempt.AlertList()) > 0 {
+			assert.Equal(t, []string{models.LoginAlertFailureBurst}, attempt.AlertList())
+			alerted = append(alerted, i)
+		}
+		*now = now.Add(time.Minute)
+	}
+	assert.Equal(t, []int{5}, alerted)
+	require.Len(t, mailer.sent, 1)
+	assert.Contains(t, mailer.sent[0].Body, "Many failed attempts to log in")
+
+	// Failures older than the window are not counted
+	*now = now.Add(time.Hour)
+	for i := 1; i <= 4; i++ {
+		attempt, err := loginHistoryService.RecordLogin("alice", user, models.AuditFailure, "203.0.113.1", firefoxUserAgent)
+		require.NoError(t, err)
+		assert.Empty(t, attempt.AlertList())
+	}
+}
+
+func TestLoginHistoryServiceListLogins(t *testing.T) {
+	loginHistoryService, mailer, now := newTestLoginHistoryService(t)
+	user := loginHistoryUser()
+	user.Email = ""
+
+	// Unknown usernames are recorded without a user
+	unknown, err := loginHistoryService.RecordLogin("mallory", nil, models.AuditFailure, "203.0.113.1", firefoxUserAgent)
+	require.NoError(t, err)
+	assert.Nil(t, unknown.UserID)
+
+	_, err = loginHistoryService.RecordLogin("alice", user, models.AuditSuccess, "192.0.2.1", firefoxUserAgent)
+	require.NoError(t, err)
+	*now = now.Add(time.Minute)
+	_, err = loginHistoryService.RecordLogin("alice", user, models.AuditSuccess, "192.0.2.1", chromeUserAgent)
+	require.NoError(t, err)
+	// Users without an email address are not alerted
+	assert.Empty(t, mailer.sent)
+
+	logins, err := loginHistoryService.ListLogins(1, 10)
+	require.NoError(t, err)
+	require.Len(t, logins, 2)
+	assert.Equal(t, "Chrome on Windows", logins[0].Device)
+	assert.Equal(t, []string{"Login from a new device or browser"}, logins[0].AlertMessages())
+	assert.Equal(t, "Firefox on Linux", logins[1].Device)
+
+	logins, err = loginHistoryService.ListLogins(1, 1)
+	require.NoError(t, err)
+	assert.Len(t, logins, 1)
+}
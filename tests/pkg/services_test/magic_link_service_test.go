@@ -0,0 +1,185 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestMagicLinkService(t *testing.T) (*services.MagicLinkService, *recordingMailer, *gorm.DB, *time.Time) {
+	db := openTestDB(t, &models.User{}, &models.MagicLink{})
+	mailer := &recordingMailer{}
+	magicLinkService := services.NewMagicLinkService(&repository.PostgresMagicLinkRepository{DB: db},
+		&repository.PostgresUserRepository{DB: db}, mailer, repository.NewMemoryRateLimitRepository(), 3,
+		[]byte("magic-link-secret"), "https://auth.example.com/", 15*time.Minute)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	magicLinkService.Now = func() time.Time { return now }
+	return magicLinkService, mailer, db, &now
+}
+
+// createMagicLinkUser creates an active user with an email address
+func createMagicLinkUser(t *testing.T, db *gorm.DB, username, email string) *models.User {
+	user := &models.User{Username: username, NormalizedUsername: username, Email: email, Status: models.UserStatusActive}
+	require.NoError(t, db.Create(user).Error)
+	return user
+}
+
+// lastMagicLinkToken returns the token of the login link in the last email
+// sent
+func lastMagicLinkToken(t *testing.T, mailer *recordingMailer) string {
+	require.NotEmpty(t, mailer.sent)
+	body := mailer.sent[len(mailer.sent)-1].Body
+	prefix := "https://auth.example.com" + services.MagicLinkPath + "?token="
+	start := strings.Index(body, prefix)
+	require.GreaterOrEqual(t, start, 0)
+	escaped := body[start+len(prefix):]
+	escaped = escaped[:strings.IndexByte(escaped, '\n')]
+	token, err := url.QueryUnescape(escaped)
+	require.NoError(t, err)
+	return token
+}
+
+func TestMagicLinkServiceLogin(t *testing.T) {
+	magicLinkService, mailer, db, now := newTestMagicLinkService(t)
+	alice := createMagicLinkUser(t, db, "alice", "alice@example.com")
+
+	browser, err := magicLinkService.RequestLink("Alice", "192.0.2.1", "")
+	require.NoError(t, err)
+	assert.NotEmpty(t, browser)
+	require.Len(t, mailer.sent, 1)
+	assert.Equal(t, "alice@example.com", mailer.sent[0].To)
+	token := lastMagicLinkToken(t, mailer)
+
+	// The link only works in the browser it was requested from
+	_, err = magicLinkService.ConsumeLink(token, "")
+	assert.ErrorIs(t, err, services.ErrMagicLinkBrowser)
+	_, err = magicLinkService.ConsumeLink(token, "another-browser")
+	assert.ErrorIs(t, err, services.ErrMagicLinkBrowser)
+
+	*now = now.Add(10 * time.Minute)
+	user, err := magicLinkService.ConsumeLink(token, browser)
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, user.ID)
+
+	// And only once
+	_, err = magicLinkService.ConsumeLink(token, browser)
+	assert.ErrorIs(t, err, services.ErrMagicLinkInvalid)
+}
+
+func TestMagicLinkServiceRejectsInvalidLinks(t *testing.T) {
+	magicLinkService, mailer, db, now := newTestMagicLinkService(t)
+	createMagicLinkUser(t, db, "alice", "alice@example.com")
+
+	browser, err := magicLinkService.RequestLink("alice@EXAMPLE.com", "192.0.2.1", "")
+	require.NoError(t, err)
+	token := lastMagicLinkToken(t, mailer)
+
+	// Tokens not signed by the service are rejected
+	nonce, _, _ := strings.Cut(token, ".")
+	for _, forged := range []string{"", nonce, nonce + ".forged", token + "x"} {
+		_, err = magicLinkService.ConsumeLink(forged, browser)
+		assert.ErrorIs(t, err, services.ErrMagicLinkInvalid, forged)
+	}
+
+	// Signed by another secret
+	magicLinkService.Secret = []byte("another-secret")
+	_, err = magicLinkService.ConsumeLink(token, browser)
+	assert.ErrorIs(t, err, services.ErrMagicLinkInvalid)
+	magicLinkService.Secret = []byte("magic-link-secret")
+
+	*now = now.Add(15 * time.Minute)
+	_, err = magicLinkService.ConsumeLink(token, browser)
+	assert.ErrorIs(t, err, services.ErrMagicLinkInvalid)
+}
+
+func TestMagicLinkServiceConcurrentUse(t *testing.T) {
+	magicLinkService, mailer, db, _ := newTestMagicLinkService(t)
+	createMagicLinkUser(t, db, "alice", "alice@example.com")
+	browser, err := magicLinkService.RequestLink("alice", "192.0.2.1", "")
+	require.NoError(t, err)
+	token := lastMagicLinkToken(t, mailer)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	logins := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := magicLinkService.ConsumeLink(token, browser); err == nil {
+				mu.Lock()
+				logins++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, logins)
+}
+
+func TestMagicLinkServiceRecipients(t *testing.T) {
+	magicLinkService, mailer, db, _ := newTestMagicLinkService(t)
+	createMagicLinkUser(t, db, "alice", "shared@example.com")
+	createMagicLinkUser(t, db, "bob", "shared@example.com")
+	createMagicLinkUser(t, db, "carol", "")
+	suspended := createMagicLinkUser(t, db, "dave", "dave@example.com")
+	require.NoError(t, db.Model(suspended).Update("status", models.UserStatusSuspended).Error)
+
+	// Unknown accounts, accounts without an address and blocked accounts
+	// get nothing, without an error
+	for _, identifier := range []string{"nobody", "nobody@example.com", "carol", "dave", "not an address@"} {
+		browser, err := magicLinkService.RequestLink(identifier, "192.0.2.1", "")
+		require.NoError(t, err, identifier)
+		assert.NotEmpty(t, browser)
+	}
+	assert.Empty(t, mailer.sent)
+
+	// Every account sharing an address gets a link, bound to the same
+	// browser, which keeps its secret
+	browser, err := magicLinkService.RequestLink("shared@example.com", "192.0.2.1", "kept-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "kept-secret", browser)
+	require.Len(t, mailer.sent, 2)
+	assert.Contains(t, mailer.sent[0].Body, "Hello alice")
+	assert.Contains(t, mailer.sent[1].Body, "Hello bob")
+	user, err := magicLinkService.ConsumeLink(lastMagicLinkToken(t, mailer), browser)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", user.Username)
+
+	// A link whose account was blocked since it was sent does not log in
+	_, err = magicLinkService.RequestLink("alice", "192.0.2.1", browser)
+	require.NoError(t, err)
+	token := lastMagicLinkToken(t, mailer)
+	require.NoError(t, db.Model(&models.User{}).Where("username = ?", "alice").Update("status", models.UserStatusLocked).Error)
+	user, err = magicLinkService.ConsumeLink(token, browser)
+	assert.ErrorIs(t, err, services.ErrAccountLocked)
+	require.NotNil(t, user)
+	assert.Equal(t, "alice", user.Username)
+}
+
+func TestMagicLinkServiceAddressLimit(t *testing.T) {
+	magicLinkService, mailer, db, now := newTestMagicLinkService(t)
+	createMagicLinkUser(t, db, "alice", "alice@example.com")
+
+	// Three links an hour reach an address, whether asked for by username
+	// or address
+	for _, identifier := range []string{"alice", "alice@example.com", "ALICE", "alice", "alice@example.com"} {
+		_, err := magicLinkService.RequestLink(identifier, "192.0.2.1", "")
+		require.NoError(t, err)
+	}
+	assert.Len(t, mailer.sent, 3)
+
+	*now = now.Add(20 * time.Minute)
+	_, err := magicLinkService.RequestLink("alice", "192.0.2.1", "")
+	require.NoError(t, err)
+	assert.Len(t, mailer.sent, 4)
+}
@@ -0,0 +1,168 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authorizeDevice registers a public CLI client and starts a device
+// authorization for it
+func authorizeDevice(t *testing.T, oidcService *services.OIDCService) (*models.OAuthClient, *services.DeviceAuthorizationResponse) {
+	_, client, err := oidcService.RegisterClient("CLI", []string{"http://127.0.0.1/callback"}, true, 1)
+	require.NoError(t, err)
+	response, err := oidcService.AuthorizeDevice(&services.DeviceAuthorizationRequest{ClientID: client.ClientID, Scope: "openid profile users:read admin"})
+	require.NoError(t, err)
+	return client, response
+}
+
+// pollDevice polls the token endpoint with the device code of a response
+// and returns the OAuth error code, empty on success
+func pollDevice(t *testing.T, oidcService *services.OIDCService, clientID string, response *services.DeviceAuthorizationResponse) string {
+	_, _, err := oidcService.PollDeviceAuthorization(&services.TokenRequest{
+		GrantType:  services.DeviceCodeGrantType,
+		ClientID:   clientID,
+		DeviceCode: response.DeviceCode,
+	})
+	if err == nil {
+		return ""
+	}
+	var oauthErr *services.OAuthError
+	require.True(t, errors.As(err, &oauthErr), err)
+	return oauthErr.Code
+}
+
+func TestOIDCServiceDeviceFlow(t *testing.T) {
+	oidcService, now := newTestOIDCService(t)
+	client, response := authorizeDevice(t, oidcService)
+
+	assert.Regexp(t, regexp.MustCompile(`^[B-Z]{4}-[B-Z]{4}$`), response.UserCode)
+	assert.Equal(t, "https://id.example.com/device", response.VerificationURI)
+	assert.Equal(t, "https://id.example.com/device?user_code="+response.UserCode, response.VerificationURIComplete)
+	assert.Equal(t, 600, response.ExpiresIn)
+	assert.Equal(t, 5, response.Interval)
+
+	// The device waits for the user, at its interval
+	assert.Equal(t, "authorization_pending", pollDevice(t, oidcService, client.ClientID, response))
+	*now = now.Add(2 * time.Second)
+	assert.Equal(t, "slow_down", pollDevice(t, oidcService, client.ClientID, response))
+	*now = now.Add(6 * time.Second)
+	assert.Equal(t, "slow_down", pollDevice(t, oidcService, client.ClientID, response), "the interval is now 10 seconds")
+	*now = now.Add(15 * time.Second)
+	assert.Equal(t, "authorization_pending", pollDevice(t, oidcService, client.ClientID, response))
+
+	// The user finds the request with the code as they typed it
+	typed := strings.ToLower(strings.ReplaceAll(response.UserCode, "-", " "))
+	authorization, found, err := oidcService.PendingDeviceAuthorization(1, typed)
+	require.NoError(t, err)
+	assert.Equal(t, client.ClientID, found.ClientID)
+	assert.Equal(t, "openid profile users:read", authorization.Scope)
+
+	// The decision must come from the form shown to the user
+	_, err = oidcService.DecideDeviceAuthorization(1, response.UserCode, true, "forged")
+	assert.ErrorIs(t, err, services.ErrDeviceConsentFailed)
+	_, err = oidcService.DecideDeviceAuthorization(2, response.UserCode, true, oidcService.DeviceConsentToken(1, response.UserCode))
+	assert.ErrorIs(t, err, services.ErrDeviceConsentFailed)
+
+	decided, err := oidcService.DecideDeviceAuthorization(1, typed, true, oidcService.DeviceConsentToken(1, typed))
+	require.NoError(t, err)
+	assert.Equal(t, models.DeviceAuthorizationApproved, decided.Status)
+	_, err = oidcService.DecideDeviceAuthorization(1, typed, false, oidcService.DeviceConsentToken(1, typed))
+	assert.ErrorIs(t, err, services.ErrDeviceCodeInvalid, "already decided")
+
+	*now = now.Add(15 * time.Second)
+	user, tokens, err := oidcService.PollDeviceAuthorization(&services.TokenRequest{
+		GrantType:  services.DeviceCodeGrantType,
+		ClientID:   client.ClientID,
+		DeviceCode: response.DeviceCode,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, "openid profile users:read", tokens.Scope)
+	assert.NotEmpty(t, tokens.IDToken)
+
+	// The access token is the session the caller issues to the device
+	assert.Empty(t, tokens.AccessToken)
+
+	// The device code gets a single token
+	*now = now.Add(15 * time.Second)
+	assert.Equal(t, "invalid_grant", pollDevice(t, oidcService, client.ClientID, response))
+}
+
+func TestOIDCServiceDeviceFlowDenied(t *testing.T) {
+	oidcService, now := newTestOIDCService(t)
+	client, response := authorizeDevice(t, oidcService)
+
+	_, err := oidcService.DecideDeviceAuthorization(1, response.UserCode, false, oidcService.DeviceConsentToken(1, response.UserCode))
+	require.NoError(t, err)
+	assert.Equal(t, "access_denied", pollDevice(t, oidcService, client.ClientID, response))
+
+	// Denied requests cannot be approved afterwards
+	_, _, err = oidcService.PendingDeviceAuthorization(1, response.UserCode)
+	assert.ErrorIs(t, err, services.ErrDeviceCodeInvalid)
+	*now = now.Add(10 * time.Second)
+	assert.Equal(t, "access_denied", pollDevice(t, oidcService, client.ClientID, response))
+}
+
+func TestOIDCServiceDeviceCodesExpire(t *testing.T) {
+	oidcService, now := newTestOIDCService(t)
+	client, response := authorizeDevice(t, oidcService)
+
+	*now = now.Add(11 * time.Minute)
+	assert.Equal(t, "expired_token", pollDevice(t, oidcService, client.ClientID, response))
+	_, _, err := oidcService.PendingDeviceAuthorization(1, response.UserCode)
+	assert.ErrorIs(t, err, services.ErrDeviceCodeInvalid)
+	_, err = oidcService.DecideDeviceAuthorization(1, response.UserCode, true, oidcService.DeviceConsentToken(1, response.UserCode))
+	assert.ErrorIs(t, err, services.ErrDeviceCodeInvalid)
+}
+
+func TestOIDCServiceDeviceFlowChecksClients(t *testing.T) {
+	oidcService, _ := newTestOIDCService(t)
+	_, response := authorizeDevice(t, oidcService)
+	secret, wiki, _ := authorize(t, oidcService, false)
+
+	// Device codes only work for the client they were issued to
+	assert.Equal(t, "invalid_client", pollDevice(t, oidcService, "unknown", response))
+	_, _, err := oidcService.PollDeviceAuthorization(&services.TokenRequest{
+		GrantType:    services.DeviceCodeGrantType,
+		ClientID:     wiki.ClientID,
+		ClientSecret: secret,
+		DeviceCode:   response.DeviceCode,
+	})
+	var oauthErr *services.OAuthError
+	require.True(t, errors.As(err, &oauthErr))
+	assert.Equal(t, "invalid_grant", oauthErr.Code)
+
+	// Confidential clients authenticate
+	_, err = oidcService.AuthorizeDevice(&services.DeviceAuthorizationRequest{ClientID: wiki.ClientID})
+	require.True(t, errors.As(err, &oauthErr))
+	assert.Equal(t, "invalid_client", oauthErr.Code)
+	_, err = oidcService.AuthorizeDevice(&services.DeviceAuthorizationRequest{ClientID: wiki.ClientID, ClientSecret: secret})
+	assert.NoError(t, err)
+}
+
+func TestOIDCServiceLimitsUserCodes(t *testing.T) {
+	oidcService, _ := newTestOIDCService(t)
+	oidcService.Limiter = repository.NewMemoryRateLimitRepository()
+	oidcService.UserCodeLimit.Limit = 2
+	_, response := authorizeDevice(t, oidcService)
+
+	_, _, err := oidcService.PendingDeviceAuthorization(1, "BCDF-GHJK")
+	assert.ErrorIs(t, err, services.ErrDeviceCodeInvalid)
+	_, _, err = oidcService.PendingDeviceAuthorization(1, response.UserCode)
+	require.NoError(t, err)
+
+	// Even the right code is refused once the user entered too many
+	_, _, err = oidcService.PendingDeviceAuthorization(1, response.UserCode)
+	assert.ErrorIs(t, err, services.ErrDeviceCodeAttempts)
+	_, _, err = oidcService.PendingDeviceAuthorization(2, response.UserCode)
+	assert.NoError(t, err, "other users have their own quota")
+}
@@ -0,0 +1,290 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCodeVerifier is a valid PKCE verifier, and testCodeChallenge its S256
+// challenge
+const testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+var testCodeChallenge = func() string {
+	sum := sha256.Sum256([]byte(testCodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}()
+
+// newTestOIDCService returns an OIDCService backed by an in-memory SQLite
+// database holding the user "alice", and a clock the test can move
+func newTestOIDCService(t *testing.T) (*services.OIDCService, *time.Time) {
+	db := openTestDB(t, &models.User{}, &models.OAuthClient{}, &models.OAuthAuthorizationCode{}, &models.OAuthConsent{},
+		&models.OAuthDeviceAuthorization{})
+	require.NoError(t, db.Create(&models.User{Username: "alice", Password: "x"}).Error)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	userService := services.NewUserService(&repository.PostgresUserRepository{DB: db})
+	oidcService := services.NewOIDCService(&repository.PostgresOAuthRepository{DB: db}, userService, "https://id.example.com/", key)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	oidcService.Now = func() time.Time { return now }
+	return oidcService, &now
+}
+
+// authorize registers a client and returns it with a valid authorization
+// request for it
+func authorize(t *testing.T, oidcService *services.OIDCService, public bool) (string, *models.OAuthClient, *services.AuthorizationRequest) {
+	secret, client, err := oidcService.RegisterClient("Wiki", []string{"https://wiki.example.com/callback"}, public, 1)
+	require.NoError(t, err)
+
+	request := &services.AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            client.ClientID,
+		RedirectURI:         "https://wiki.example.com/callback",
+		Scope:               "openid profile email",
+		State:               "xyz",
+		Nonce:               "n-0S6_WzA2Mj",
+		CodeChallenge:       testCodeChallenge,
+		CodeChallengeMethod: "S256",
+	}
+	_, err = oidcService.ValidateAuthorizationRequest(request)
+	require.NoError(t, err)
+	return secret, client, request
+}
+
+func TestOIDCServiceAuthorizationCodeFlow(t *testing.T) {
+	oidcService, now := newTestOIDCService(t)
+	secret, client, request := authorize(t, oidcService, false)
+	assert.NotEmpty(t, secret)
+
+	// Unknown scopes are dropped
+	assert.Equal(t, "openid profile", request.Scope)
+
+	authTime := now.Add(-time.Hour)
+	code, err := oidcService.CreateAuthorizationCode(1, authTime, request)
+	require.NoError(t, err)
+
+	response, err := oidcService.Exchange(&services.TokenRequest{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectURI:  request.RedirectURI,
+		ClientID:     client.ClientID,
+		ClientSecret: secret,
+		CodeVerifier: testCodeVerifier,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", response.TokenType)
+	assert.Equal(t, 3600, response.ExpiresIn)
+
+	// The ID token verifies with the published key and carries the username
+	jwks := oidcService.JWKS()["keys"].([]utils.JWK)
+	publicKey, err := utils.RSAPublicKeyFromJWK(jwks[0])
+	require.NoError(t, err)
+
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	idToken, err := parser.Parse(response.IDToken, func(token *jwt.Token) (interface{}, error) {
+		assert.Equal(t, jwks[0].Kid, token.Header["kid"])
+		return publicKey, nil
+	})
+	require.NoError(t, err)
+	claims := idToken.Claims.(jwt.MapClaims)
+	assert.Equal(t, "https://id.example.com", claims["iss"])
+	assert.Equal(t, "1", claims["sub"])
+	assert.Equal(t, client.ClientID, claims["aud"])
+	assert.Equal(t, "alice", claims["preferred_username"])
+	assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+	assert.Equal(t, float64(authTime.Unix()), claims["auth_time"])
+
+	// The access token opens the userinfo endpoint
+	info, err := oidcService.UserInfo(response.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"sub": "1", "preferred_username": "alice"}, info)
+
+	// The ID token is not an access token
+	_, err = oidcService.UserInfo(response.IDToken)
+	assert.Error(t, err)
+
+	// The access token expires after an hour
+	*now = now.Add(time.Hour + time.Second)
+	_, err = oidcService.UserInfo(response.AccessToken)
+	assert.Error(t, err)
+}
+
+func TestOIDCServiceValidateAuthorizationRequest(t *testing.T) {
+	oidcService, _ := newTestOIDCService(t)
+	_, _, valid := authorize(t, oidcService, true)
+
+	tests := []struct {
+		name     string
+		change   func(request *services.AuthorizationRequest)
+		expected string
+	}{
+		{"Unknown client", func(r *services.AuthorizationRequest) { r.ClientID = "nope" }, services.ErrOAuthUnknownClient.Error()},
+		{"Unregistered redirect URI", func(r *services.AuthorizationRequest) { r.RedirectURI = "https://evil.example.com/callback" }, services.ErrOAuthRedirectURI.Error()},
+		{"Implicit flow", func(r *services.AuthorizationRequest) { r.ResponseType = "token" }, "unsupported_response_type"},
+		{"Without openid", func(r *services.AuthorizationRequest) { r.Scope = "profile" }, "invalid_scope"},
+		{"Without PKCE", func(r *services.AuthorizationRequest) { r.CodeChallenge = "" }, "invalid_request"},
+		{"Plain PKCE", func(r *services.AuthorizationRequest) { r.CodeChallengeMethod = "plain" }, "invalid_request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := *valid
+			tt.change(&request)
+			_, err := oidcService.ValidateAuthorizationRequest(&request)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expected)
+		})
+	}
+}
+
+func TestOIDCServiceExchangeRejectsInvalidRequests(t *testing.T) {
+	oidcService, now := newTestOIDCService(t)
+	secret, client, request := authorize(t, oidcService, false)
+
+	valid := services.TokenRequest{
+		GrantType:    "authorization_code",
+		RedirectURI:  request.RedirectURI,
+		ClientID:     client.ClientID,
+		ClientSecret: secret,
+		CodeVerifier: testCodeVerifier,
+	}
+
+	tests := []struct {
+		name     string
+		change   func(request *services.TokenRequest)
+		expected string
+	}{
+		{"Wrong grant", func(r *services.TokenRequest) { r.GrantType = "password" }, "unsupported_grant_type"},
+		{"Wrong secret", func(r *services.TokenRequest) { r.ClientSecret = "nope" }, "invalid_client"},
+		{"Missing secret", func(r *services.TokenRequest) { r.ClientSecret = "" }, "invalid_client"},
+		{"Wrong redirect URI", func(r *services.TokenRequest) { r.RedirectURI = "https://wiki.example.com/other" }, "invalid_grant"},
+		{"Wrong verifier", func(r *services.TokenRequest) { r.CodeVerifier = strings.Repeat("a", 43) }, "invalid_grant"},
+		{"Expired code", func(r *services.TokenRequest) { *now = now.Add(2 * time.Minute) }, "invalid_grant"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := oidcService.CreateAuthorizationCode(1, *now, request)
+			require.NoError(t, err)
+
+			tokenRequest := valid
+			tokenRequest.Code = code
+			tt.change(&tokenRequest)
+
+			_, err = oidcService.Exchange(&tokenRequest)
+			var oauthErr *services.OAuthError
+			require.True(t, errors.As(err, &oauthErr), err)
+			assert.Equal(t, tt.expected, oauthErr.Code)
+		})
+	}
+}
+
+func TestOIDCServiceRejectsSuspendedUsers(t *testing.T) {
+	oidcService, now := newTestOIDCService(t)
+	_, client, request := authorize(t, oidcService, true)
+
+	code, err := oidcService.CreateAuthorizationCode(1, *now, request)
+	require.NoError(t, err)
+	tokens, err := oidcService.Exchange(&services.TokenRequest{
+		GrantType: "authorization_code", Code: code, RedirectURI: request.RedirectURI, ClientID: client.ClientID, CodeVerifier: testCodeVerifier,
+	})
+	require.NoError(t, err)
+
+	// The account is suspended after the code was issued
+	code, err = oidcService.CreateAuthorizationCode(1, *now, request)
+	require.NoError(t, err)
+	db := oidcService.Users.(*services.UserService).Repo.(*repository.PostgresUserRepository).DB
+	require.NoError(t, db.Model(&models.User{}).Where("id = ?", 1).Update("status", models.UserStatusSuspended).Error)
+
+	_, err = oidcService.Exchange(&services.TokenRequest{
+		GrantType: "authorization_code", Code: code, RedirectURI: request.RedirectURI, ClientID: client.ClientID, CodeVerifier: testCodeVerifier,
+	})
+	var oauthErr *services.OAuthError
+	require.True(t, errors.As(err, &oauthErr), err)
+	assert.Equal(t, "invalid_grant", oauthErr.Code)
+
+	_, err = oidcService.UserInfo(tokens.AccessToken)
+	require.True(t, errors.As(err, &oauthErr), err)
+	assert.Equal(t, "invalid_token", oauthErr.Code)
+}
+
+func TestOIDCServiceCodesAreSingleUse(t *testing.T) {
+	oidcService, now := newTestOIDCService(t)
+	_, client, request := authorize(t, oidcService, true)
+
+	code, err := oidcService.CreateAuthorizationCode(1, *now, request)
+	require.NoError(t, err)
+	tokenRequest := &services.TokenRequest{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectURI:  request.RedirectURI,
+		ClientID:     client.ClientID,
+		CodeVerifier: testCodeVerifier,
+	}
+
+	// Public clients only need PKCE
+	_, err = oidcService.Exchange(tokenRequest)
+	require.NoError(t, err)
+
+	_, err = oidcService.Exchange(tokenRequest)
+	var oauthErr *services.OAuthError
+	require.True(t, errors.As(err, &oauthErr))
+	assert.Equal(t, "invalid_grant", oauthErr.Code)
+}
+
+func TestOIDCServiceConsent(t *testing.T) {
+	oidcService, _ := newTestOIDCService(t)
+	_, _, request := authorize(t, oidcService, true)
+
+	needsConsent, err := oidcService.NeedsConsent(1, request)
+	require.NoError(t, err)
+	assert.True(t, needsConsent)
+
+	// The consent token is bound to the user and the request
+	assert.Error(t, oidcService.GrantConsent(1, request, oidcService.ConsentToken(2, request)))
+	assert.Error(t, oidcService.GrantConsent(1, request, "forged"))
+	require.NoError(t, oidcService.GrantConsent(1, request, oidcService.ConsentToken(1, request)))
+
+	needsConsent, err = oidcService.NeedsConsent(1, request)
+	require.NoError(t, err)
+	assert.False(t, needsConsent)
+
+	// Fewer scopes are covered by the consent, other users are not
+	narrower := *request
+	narrower.Scope = "openid"
+	needsConsent, err = oidcService.NeedsConsent(1, &narrower)
+	require.NoError(t, err)
+	assert.False(t, needsConsent)
+	needsConsent, err = oidcService.NeedsConsent(2, request)
+	require.NoError(t, err)
+	assert.True(t, needsConsent)
+}
+
+func TestOIDCServiceRegisterClient(t *testing.T) {
+	oidcService, _ := newTestOIDCService(t)
+
+	secret, client, err := oidcService.RegisterClient("SPA", []string{"http://localhost:3000/cb"}, true, 1)
+	require.NoError(t, err)
+	assert.Empty(t, secret)
+	assert.Empty(t, client.SecretHash)
+
+	for _, uris := range [][]string{nil, {"/relative"}, {"https://app.example.com/cb#fragment"}} {
+		_, _, err := oidcService.RegisterClient("App", uris, false, 1)
+		assert.Error(t, err, uris)
+	}
+}
@@ -0,0 +1,146 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/internal/tenant"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newTestOrganizationService returns an OrganizationService backed by an
+// in-memory SQLite database, and the database
+func newTestOrganizationService(t *testing.T) (*services.OrganizationService, *gorm.DB) {
+	db := openTestDB(t, &models.User{}, &models.Organization{}, &models.Membership{}, &models.Group{})
+	organizationService := services.NewOrganizationService(&repository.PostgresOrganizationRepository{DB: db},
+		&repository.PostgresUserRepository{DB: db}, "default")
+	return organizationService, db
+}
+
+// createOrgUser creates a user with a normalized username
+func createOrgUser(t *testing.T, db *gorm.DB, username string) *models.User {
+	user := &models.User{Username: username, NormalizedUsername: username}
+	require.NoError(t, db.Create(user).Error)
+	return user
+}
+
+func TestOrganizationServiceCreateOrganization(t *testing.T) {
+	organizationService, db := newTestOrganizationService(t)
+	alice := createOrgUser(t, db, "alice")
+
+	membership, err := organizationService.CreateOrganization(alice, "Acme Corp!", "")
+	require.NoError(t, err)
+	assert.Equal(t, "acme-corp", membership.Organization.Slug)
+	assert.Equal(t, models.OrgRoleOwner, membership.Role)
+
+	_, err = organizationService.CreateOrganization(alice, "Acme", "acme-corp")
+	assert.ErrorIs(t, err, services.ErrOrganizationExists)
+	_, err = organizationService.CreateOrganization(alice, " ", "")
+	assert.ErrorIs(t, err, services.ErrInvalidOrganizationName)
+	_, err = organizationService.CreateOrganization(alice, "Acme", "Not A Slug")
+	assert.ErrorIs(t, err, services.ErrInvalidOrganizationSlug)
+}
+
+func TestOrganizationServiceResolveTenant(t *testing.T) {
+	organizationService, db := newTestOrganizationService(t)
+	alice := createOrgUser(t, db, "alice")
+	bob := createOrgUser(t, db, "bob")
+	acme, err := organizationService.CreateOrganization(alice, "Acme", "acme")
+	require.NoError(t, err)
+	globex, err := organizationService.CreateOrganization(alice, "Globex", "globex")
+	require.NoError(t, err)
+
+	// Users without organization join the default one
+	membership, err := organizationService.ResolveTenant(bob.ID, 0, true)
+	require.NoError(t, err)
+	assert.Equal(t, "default", membership.Organization.Slug)
+	assert.Equal(t, models.OrgRoleMember, membership.Role)
+
+	// The requested organization must be one of the user
+	membership, err = organizationService.ResolveTenant(alice.ID, globex.OrganizationID, false)
+	require.NoError(t, err)
+	assert.Equal(t, globex.OrganizationID, membership.OrganizationID)
+	_, err = organizationService.ResolveTenant(bob.ID, acme.OrganizationID, false)
+	assert.ErrorIs(t, err, services.ErrNotMember)
+
+	// Sessions fall back to another organization of the user
+	membership, err = organizationService.ResolveTenant(bob.ID, acme.OrganizationID, true)
+	require.NoError(t, err)
+	assert.Equal(t, "default", membership.Organization.Slug)
+
+	// The organization switched to is used and remembered
+	user, membership, err := organizationService.SwitchOrganization(alice.ID, globex.OrganizationID)
+	require.NoError(t, err)
+	assert.Equal(t, globex.OrganizationID, *user.ActiveOrganizationID)
+	membership, err = organizationService.ResolveTenant(alice.ID, 0, true)
+	require.NoError(t, err)
+	assert.Equal(t, globex.OrganizationID, membership.OrganizationID)
+	_, _, err = organizationService.SwitchOrganization(bob.ID, globex.OrganizationID)
+	assert.ErrorIs(t, err, services.ErrNotMember)
+
+	// Deactivated members cannot act in the organization
+	ctx := tenant.WithOrganization(context.Background(), globex.OrganizationID)
+	_, err = organizationService.AddMember(ctx, globex, "bob", models.OrgRoleMember)
+	require.NoError(t, err)
+	require.NoError(t, db.Model(&models.Membership{}).Where("user_id = ? AND organization_id = ?", bob.ID, globex.OrganizationID).
+		Update("deactivated_at", gorm.Expr("CURRENT_TIMESTAMP")).Error)
+	_, err = organizationService.ResolveTenant(bob.ID, globex.OrganizationID, false)
+	assert.ErrorIs(t, err, services.ErrNotMember)
+}
+
+func TestOrganizationServiceMembers(t *testing.T) {
+	organizationService, db := newTestOrganizationService(t)
+	alice := createOrgUser(t, db, "alice")
+	createOrgUser(t, db, "bob")
+	createOrgUser(t, db, "carol")
+	owner, err := organizationService.CreateOrganization(alice, "Acme", "acme")
+	require.NoError(t, err)
+	ctx := tenant.WithOrganization(context.Background(), owner.OrganizationID)
+
+	admin, err := organizationService.AddMember(ctx, owner, "bob", models.OrgRoleAdmin)
+	require.NoError(t, err)
+	_, err = organizationService.AddMember(ctx, owner, "bob", "")
+	assert.ErrorIs(t, err, services.ErrAlreadyMember)
+	_, err = organizationService.AddMember(ctx, owner, "nobody", "")
+	assert.ErrorIs(t, err, services.ErrUserNotFound)
+	_, err = organizationService.AddMember(ctx, owner, "carol", "superuser")
+	assert.ErrorIs(t, err, services.ErrInvalidOrganizationRole)
+
+	// Only owners grant or revoke the owner role
+	_, err = organizationService.AddMember(ctx, admin, "carol", models.OrgRoleOwner)
+	assert.ErrorIs(t, err, services.ErrOwnerRequired)
+	carol, err := organizationService.AddMember(ctx, admin, "carol", "")
+	require.NoError(t, err)
+	assert.Equal(t, models.OrgRoleMember, carol.Role)
+	_, _, err = organizationService.SetMemberRole(ctx, admin, alice.ID, models.OrgRoleMember)
+	assert.ErrorIs(t, err, services.ErrOwnerRequired)
+	_, err = organizationService.RemoveMember(ctx, admin, alice.ID)
+	assert.ErrorIs(t, err, services.ErrOwnerRequired)
+
+	// The last owner stays
+	_, _, err = organizationService.SetMemberRole(ctx, owner, alice.ID, models.OrgRoleAdmin)
+	assert.ErrorIs(t, err, services.ErrLastOwner)
+	_, err = organizationService.RemoveMember(ctx, owner, alice.ID)
+	assert.ErrorIs(t, err, services.ErrLastOwner)
+
+	membership, previousRole, err := organizationService.SetMemberRole(ctx, owner, carol.UserID, models.OrgRoleOwner)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrgRoleMember, previousRole)
+	assert.Equal(t, models.OrgRoleOwner, membership.Role)
+	_, err = organizationService.RemoveMember(ctx, owner, alice.ID)
+	assert.NoError(t, err)
+
+	members, err := organizationService.ListMembers(ctx)
+	require.NoError(t, err)
+	assert.Len(t, members, 2)
+
+	// Members of other organizations are not found
+	other := tenant.WithOrganization(context.Background(), owner.OrganizationID+1)
+	_, err = organizationService.RemoveMember(other, membership, carol.UserID)
+	assert.ErrorIs(t, err, services.ErrNotMember)
+}
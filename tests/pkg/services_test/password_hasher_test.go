@@ -0,0 +1,158 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository/repository_mock"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fastHasher returns a hasher with cheap parameters to keep the tests quick
+func fastHasher(algorithm string) *services.PHCPasswordHasher {
+	return &services.PHCPasswordHasher{
+		Algorithm:         algorithm,
+		BcryptCost:        bcrypt.MinCost,
+		Argon2Memory:      1024,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+	}
+}
+
+func TestPasswordHasherRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{services.AlgorithmArgon2id, services.AlgorithmBcrypt} {
+		t.Run(algorithm, func(t *testing.T) {
+			hasher := fastHasher(algorithm)
+
+			encoded, err := hasher.Hash("correct horse battery staple")
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(encoded, "$"+algorithm+"$"))
+
+			ok, needsRehash, err := hasher.Verify(encoded, "correct horse battery staple")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.False(t, needsRehash)
+
+			ok, _, err = hasher.Verify(encoded, "wrong password")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestPasswordHasherNeedsRehash(t *testing.T) {
+	current := fastHasher(services.AlgorithmArgon2id)
+
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	bcryptHash, _ := fastHasher(services.AlgorithmBcrypt).Hash("secret")
+	weaker := fastHasher(services.AlgorithmArgon2id)
+	weaker.Argon2Memory = 512
+	weakerHash, _ := weaker.Hash("secret")
+
+	for name, encoded := range map[string]string{
+		"Legacy bcrypt":    string(legacy),
+		"Other algorithm":  bcryptHash,
+		"Older parameters": weakerHash,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ok, needsRehash, err := current.Verify(encoded, "secret")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.True(t, needsRehash)
+		})
+	}
+}
+
+func TestPasswordHasherPepper(t *testing.T) {
+	plain := fastHasher(services.AlgorithmArgon2id)
+	peppered := fastHasher(services.AlgorithmArgon2id)
+	peppered.Pepper, peppered.PepperID = []byte("server-side secret"), "2024"
+
+	encoded, err := peppered.Hash("secret")
+	assert.NoError(t, err)
+	assert.Contains(t, encoded, "keyid=2024")
+
+	ok, needsRehash, err := peppered.Verify(encoded, "secret")
+	assert.True(t, ok)
+	assert.False(t, needsRehash)
+	assert.NoError(t, err)
+
+	// Hashes made before the pepper was introduced still verify, but are upgraded
+	unpeppered, _ := plain.Hash("secret")
+	ok, needsRehash, _ = peppered.Verify(unpeppered, "secret")
+	assert.True(t, ok)
+	assert.True(t, needsRehash)
+
+	// Without the pepper, peppered hashes cannot be verified
+	ok, _, err = plain.Verify(encoded, "secret")
+	assert.False(t, ok)
+	assert.Error(t, err)
+}
+
+func TestPasswordHasherRotatesPepper(t *testing.T) {
+	old := fastHasher(services.AlgorithmArgon2id)
+	old.Pepper, old.PepperID = []byte("old secret"), "2024"
+	encoded, err := old.Hash("secret")
+	assert.NoError(t, err)
+
+	// After the rotation, hashes made with the retired pepper still verify,
+	// and are upgraded to the current one
+	rotated := fastHasher(services.AlgorithmArgon2id)
+	rotated.Pepper, rotated.PepperID = []byte("new secret"), "2025"
+	rotated.PreviousPeppers = map[string][]byte{"2024": []byte("old secret")}
+	ok, needsRehash, err := rotated.Verify(encoded, "secret")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, needsRehash)
+	ok, _, err = rotated.Verify(encoded, "wrong")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	rehashed, err := rotated.Hash("secret")
+	assert.NoError(t, err)
+	assert.Contains(t, rehashed, "keyid=2025")
+	ok, needsRehash, err = rotated.Verify(rehashed, "secret")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, needsRehash)
+
+	// Once the retired pepper is dropped, its hashes cannot be verified
+	rotated.PreviousPeppers = nil
+	_, _, err = rotated.Verify(encoded, "secret")
+	assert.Error(t, err)
+}
+
+func TestParsePreviousPeppers(t *testing.T) {
+	peppers, err := services.ParsePreviousPeppers("2023:first; 2024:se:cond")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"2023": []byte("first"), "2024": []byte("se:cond")}, peppers)
+
+	for _, spec := range []string{"2024", ":secret", "2024:"} {
+		_, err := services.ParsePreviousPeppers(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCheckPasswordUpgradesHash(t *testing.T) {
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	user := &models.User{Username: "alice", Password: string(legacy)}
+
+	mockRepo := new(repository_mock.MockUserRepository)
+	mockRepo.On("UpdateUser", mock.MatchedBy(func(u *models.User) bool {
+		return strings.HasPrefix(u.Password, "$argon2id$")
+	})).Return(nil).Once()
+
+	userService := &services.UserService{Repo: mockRepo, Hasher: fastHasher(services.AlgorithmArgon2id)}
+
+	assert.NoError(t, userService.CheckPassword(user, "secret"))
+	mockRepo.AssertExpectations(t)
+
+	// The upgraded hash is current, so the next login does not save again
+	assert.NoError(t, userService.CheckPassword(user, "secret"))
+	assert.Error(t, userService.CheckPassword(user, "wrong password"))
+	mockRepo.AssertNumberOfCalls(t, "UpdateUser", 1)
+}
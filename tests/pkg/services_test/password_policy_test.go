@@ -0,0 +1,102 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeBreachFile writes a Pwned Passwords style file, sorted by hash, with
+// the given passwords and a few unrelated hashes
+func writeBreachFile(t *testing.T, passwords map[string]int) string {
+	var lines []string
+	for password, count := range passwords {
+		sum := sha1.Sum([]byte(password))
+		lines = append(lines, fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), count))
+	}
+	for i := 0; i < 200; i++ {
+		sum := sha1.Sum([]byte(fmt.Sprintf("filler-%d", i)))
+		lines = append(lines, fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), i+1))
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned-passwords.txt")
+	assert.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600))
+	return path
+}
+
+func rules(err error) []string {
+	var policyErr *services.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return nil
+	}
+	var names []string
+	for _, violation := range policyErr.Violations {
+		names = append(names, violation.Rule)
+	}
+	return names
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := &services.PasswordPolicy{
+		MinLength:    10,
+		MinStrength:  3,
+		ContextWords: []string{"Buildas"},
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		rules    []string
+	}{
+		{name: "Empty", username: "alice", password: "", rules: []string{services.RuleMinLength}},
+		{name: "Short and weak", username: "alice", password: "qwerty", rules: []string{services.RuleMinLength}},
+		{name: "Weak", username: "alice", password: "qwertyuiop", rules: []string{services.RuleStrength}},
+		{name: "Contains username", username: "Alice", password: "alice-h7$Kq9!zLm2@", rules: []string{services.RuleUsername}},
+		{name: "Contains context word", username: "alice", password: "BUILDAS-h7$Kq9!zLm2@", rules: []string{services.RuleContextWord}},
+		{name: "Too long", username: "alice", password: strings.Repeat("h7$Kq9!zLm2@", 7), rules: []string{services.RuleMaxLength}},
+		{name: "Too long and weak", username: "alice", password: "alice" + strings.Repeat("a", 100000), rules: []string{services.RuleMaxLength}},
+		{name: "Strong", username: "alice", password: "correct horse battery staple", rules: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.rules, rules(policy.Validate(tt.username, tt.password)))
+		})
+	}
+}
+
+func TestPasswordPolicyBreachedPasswords(t *testing.T) {
+	path := writeBreachFile(t, map[string]int{
+		"correct horse battery staple": 42,
+		"P@ssw0rd":                     1000,
+	})
+	policy := &services.PasswordPolicy{Breaches: &repository.FileBreachedPasswordRepository{Path: path}}
+
+	err := policy.Validate("alice", "correct horse battery staple")
+	assert.Equal(t, []string{services.RuleBreached}, rules(err))
+	assert.Contains(t, err.Error(), "42 times")
+
+	assert.Equal(t, []string{services.RuleBreached}, rules(policy.Validate("alice", "P@ssw0rd")))
+	assert.NoError(t, policy.Validate("alice", "h7$Kq9!zLm2@ never breached"))
+}
+
+func TestPasswordPolicyBreachFileUnavailable(t *testing.T) {
+	policy := &services.PasswordPolicy{
+		Breaches: &repository.FileBreachedPasswordRepository{Path: filepath.Join(t.TempDir(), "missing.txt")},
+	}
+
+	// A missing breach list must not prevent users from registering
+	assert.NoError(t, policy.Validate("alice", "correct horse battery staple"))
+}
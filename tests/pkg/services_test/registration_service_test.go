@@ -0,0 +1,152 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registrationFixture holds a RegistrationService backed by an in-memory
+// SQLite database, with a clock tests can move
+type registrationFixture struct {
+	registrations *services.RegistrationService
+	mailer        *recordingMailer
+	now           time.Time
+}
+
+func newRegistrationFixture(t *testing.T, policy services.RegistrationPolicy) *registrationFixture {
+	db := openTestDB(t, &models.User{}, &models.Group{}, &models.Membership{})
+	userRepo := &repository.PostgresUserRepository{DB: db}
+	userService := &services.UserService{Repo: userRepo, Hasher: fastHasher(services.AlgorithmArgon2id)}
+
+	f := &registrationFixture{mailer: &recordingMailer{}, now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	f.registrations = services.NewRegistrationService(userService, userRepo, f.mailer, policy,
+		"https://example.com/", []byte("secret"))
+	f.registrations.Now = func() time.Time { return f.now }
+	return f
+}
+
+// lastVerificationToken returns the token of the verification link in the
+// last email sent
+func (f *registrationFixture) lastVerificationToken(t *testing.T) string {
+	require.NotEmpty(t, f.mailer.sent)
+	body := f.mailer.sent[len(f.mailer.sent)-1].Body
+	start := strings.Index(body, services.EmailVerificationPath+"?token=")
+	require.GreaterOrEqual(t, start, 0)
+	token, err := url.QueryUnescape(strings.Fields(body[start+len(services.EmailVerificationPath+"?token="):])[0])
+	require.NoError(t, err)
+	return token
+}
+
+func TestRegistrationServiceClosedModes(t *testing.T) {
+	for mode, expected := range map[string]error{
+		services.RegistrationDisabled:   services.ErrRegistrationDisabled,
+		services.RegistrationInviteOnly: services.ErrRegistrationInviteOnly,
+	} {
+		f := newRegistrationFixture(t, services.RegistrationPolicy{Mode: mode})
+		_, err := f.registrations.Register("bob", "correct horse battery staple", "bob@example.com")
+		assert.ErrorIs(t, err, expected, mode)
+	}
+
+	// Open registration creates active accounts, with or without an address
+	f := newRegistrationFixture(t, services.RegistrationPolicy{})
+	user, err := f.registrations.Register("bob", "correct horse battery staple", "")
+	require.NoError(t, err)
+	assert.True(t, user.Active())
+	assert.NoError(t, services.AccountStatusError(user))
+	assert.Empty(t, f.mailer.sent)
+}
+
+func TestRegistrationServiceDomainAllowlist(t *testing.T) {
+	f := newRegistrationFixture(t, services.RegistrationPolicy{
+		Mode:           services.RegistrationDomainAllowlist,
+		AllowedDomains: []string{"example.com"},
+	})
+
+	_, err := f.registrations.Register("bob", "correct horse battery staple", "")
+	assert.ErrorIs(t, err, services.ErrEmailRequired)
+	_, err = f.registrations.Register("bob", "correct horse battery staple", "bob@evil.example")
+	assert.ErrorIs(t, err, services.ErrEmailDomainNotAllowed)
+	_, err = f.registrations.Register("bob", "correct horse battery staple", "bob@mail.example.com")
+	assert.ErrorIs(t, err, services.ErrEmailDomainNotAllowed)
+
+	// Accounts wait until their owner proves the address is theirs
+	user, err := f.registrations.Register("bob", "correct horse battery staple", "Bob@EXAMPLE.com")
+	require.NoError(t, err)
+	assert.Equal(t, "bob@example.com", user.Email)
+	assert.Equal(t, models.UserStatusUnverified, user.Status)
+	assert.ErrorIs(t, services.AccountStatusError(user), services.ErrEmailUnverified)
+	require.Len(t, f.mailer.sent, 1)
+	assert.Equal(t, "bob@example.com", f.mailer.sent[0].To)
+	assert.Contains(t, f.mailer.sent[0].Body, "https://example.com"+services.EmailVerificationPath)
+	token := f.lastVerificationToken(t)
+
+	// Tampered and expired links are rejected
+	_, err = f.registrations.VerifyEmail(token + "x")
+	assert.ErrorIs(t, err, services.ErrVerificationInvalid)
+	parts := strings.SplitN(token, ".", 2)
+	_, err = f.registrations.VerifyEmail("99." + parts[1])
+	assert.ErrorIs(t, err, services.ErrVerificationInvalid)
+	f.now = f.now.Add(49 * time.Hour)
+	_, err = f.registrations.VerifyEmail(token)
+	assert.ErrorIs(t, err, services.ErrVerificationInvalid)
+
+	// A new link works, once
+	require.NoError(t, f.registrations.SendVerification(user))
+	token = f.lastVerificationToken(t)
+	verified, err := f.registrations.VerifyEmail(token)
+	require.NoError(t, err)
+	assert.True(t, verified.Active())
+	_, err = f.registrations.VerifyEmail(token)
+	assert.ErrorIs(t, err, services.ErrVerificationInvalid)
+}
+
+func TestRegistrationServiceApproval(t *testing.T) {
+	f := newRegistrationFixture(t, services.RegistrationPolicy{Mode: services.RegistrationApproval})
+
+	_, err := f.registrations.Register("bob", "correct horse battery staple", "")
+	assert.ErrorIs(t, err, services.ErrEmailRequired)
+
+	bob, err := f.registrations.Register("bob", "correct horse battery staple", "bob@example.com")
+	require.NoError(t, err)
+	assert.ErrorIs(t, services.AccountStatusError(bob), services.ErrAccountPending)
+	carol, err := f.registrations.Register("carol", "correct horse battery staple", "carol@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, f.mailer.sent)
+
+	pending, err := f.registrations.ListPendingUsers()
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, "bob", pending[0].Username)
+
+	// Approved users can log in and are told so
+	approved, err := f.registrations.ApproveUser(bob.ID)
+	require.NoError(t, err)
+	assert.True(t, approved.Active())
+	require.Len(t, f.mailer.sent, 1)
+	assert.Equal(t, "bob@example.com", f.mailer.sent[0].To)
+	assert.Contains(t, f.mailer.sent[0].Subject, "approved")
+	_, err = f.registrations.ApproveUser(bob.ID)
+	assert.ErrorIs(t, err, services.ErrRegistrationMissing)
+	_, err = f.registrations.RejectUser(bob.ID)
+	assert.ErrorIs(t, err, services.ErrRegistrationMissing)
+
+	// Rejected accounts are deleted and their owner told
+	_, err = f.registrations.RejectUser(carol.ID)
+	require.NoError(t, err)
+	require.Len(t, f.mailer.sent, 2)
+	assert.Equal(t, "carol@example.com", f.mailer.sent[1].To)
+	assert.Contains(t, f.mailer.sent[1].Subject, "declined")
+	pending, err = f.registrations.ListPendingUsers()
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	_, err = f.registrations.ApproveUser(carol.ID)
+	assert.ErrorIs(t, err, services.ErrRegistrationMissing)
+}
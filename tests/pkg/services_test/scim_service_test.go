@@ -0,0 +1,459 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/internal/tenant"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newTestSCIMService returns a SCIMService backed by an in-memory SQLite
+// database, the database and a context acting in an organization
+func newTestSCIMService(t *testing.T) (*services.SCIMService, *gorm.DB, context.Context) {
+	db := openTestDB(t, &models.User{}, &models.Group{}, &models.Organization{}, &models.Membership{})
+	userRepo := &repository.PostgresUserRepository{DB: db}
+	userService := &services.UserService{Repo: userRepo, Hasher: fastHasher(services.AlgorithmArgon2id)}
+
+	scimService := services.NewSCIMService(userService, userRepo, &repository.PostgresOrganizationRepository{DB: db},
+		&repository.PostgresGroupRepository{DB: db}, "https://example.com/")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	scimService.Now = func() time.Time { return now }
+	return scimService, db, organizationContext(t, db, "acme")
+}
+
+// organizationContext creates an organization and returns a context acting
+// in it
+func organizationContext(t *testing.T, db *gorm.DB, slug string) context.Context {
+	organization := &models.Organization{Name: slug, Slug: slug}
+	require.NoError(t, db.Create(organization).Error)
+	return tenant.WithOrganization(context.Background(), organization.ID)
+}
+
+// createSCIMUser provisions a user with an email and a family name
+func createSCIMUser(t *testing.T, ctx context.Context, scimService *services.SCIMService, username, email, familyName string) *services.SCIMUser {
+	user, err := scimService.CreateUser(ctx, &services.SCIMUser{
+		UserName: username,
+		Name:     &services.SCIMName{GivenName: "Test", FamilyName: familyName},
+		Emails:   []services.SCIMMultiValue{{Value: email, Type: "work", Primary: true}},
+	})
+	require.NoError(t, err)
+	return user
+}
+
+// patchRequest returns a PATCH request made of operations written as JSON
+func patchRequest(t *testing.T, operations string) *services.SCIMPatchRequest {
+	patch := &services.SCIMPatchRequest{Schemas: []string{services.SCIMPatchOpSchema}}
+	require.NoError(t, json.Unmarshal([]byte(operations), &patch.Operations))
+	return patch
+}
+
+// assertSCIMError checks the HTTP status and scimType of an error
+func assertSCIMError(t *testing.T, err error, status int, scimType string) {
+	t.Helper()
+	var scimErr *services.SCIMError
+	require.True(t, errors.As(err, &scimErr), "expected a SCIMError, got %v", err)
+	assert.Equal(t, status, scimErr.Status)
+	assert.Equal(t, scimType, scimErr.ScimType)
+}
+
+func TestParseSCIMFilter(t *testing.T) {
+	// Filters of RFC 7644 section 3.4.2.2
+	tests := []struct {
+		filter   string
+		expected utils.SCIMFilter
+	}{
+		{`userName Eq "john"`, utils.SCIMComparison{Path: "username", Operator: "eq", Value: "john"}},
+		{`Username eq "john"`, utils.SCIMComparison{Path: "username", Operator: "eq", Value: "john"}},
+		{`name.familyName co "O'Malley"`, utils.SCIMComparison{Path: "name.familyname", Operator: "co", Value: "O'Malley"}},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName sw "J"`, utils.SCIMComparison{Path: "username", Operator: "sw", Value: "J"}},
+		{`title pr`, utils.SCIMComparison{Path: "title", Operator: "pr"}},
+		{`meta.lastModified gt "2011-05-13T04:42:34Z"`, utils.SCIMComparison{Path: "meta.lastmodified", Operator: "gt", Value: "2011-05-13T04:42:34Z"}},
+		{`title pr and userType eq "Employee"`, utils.SCIMLogical{
+			Operator: "and",
+			Left:     utils.SCIMComparison{Path: "title", Operator: "pr"},
+			Right:    utils.SCIMComparison{Path: "usertype", Operator: "eq", Value: "Employee"},
+		}},
+		{`userType eq "Employee" and (emails co "example.com" or emails.value co "example.org")`, utils.SCIMLogical{
+			Operator: "and",
+			Left:     utils.SCIMComparison{Path: "usertype", Operator: "eq", Value: "Employee"},
+			Right: utils.SCIMLogical{
+				Operator: "or",
+				Left:     utils.SCIMComparison{Path: "emails", Operator: "co", Value: "example.com"},
+				Right:    utils.SCIMComparison{Path: "emails.value", Operator: "co", Value: "example.org"},
+			},
+		}},
+		{`userType ne "Employee" and not (emails co "example.com")`, utils.SCIMLogical{
+			Operator: "and",
+			Left:     utils.SCIMComparison{Path: "usertype", Operator: "ne", Value: "Employee"},
+			Right:    utils.SCIMNot{Filter: utils.SCIMComparison{Path: "emails", Operator: "co", Value: "example.com"}},
+		}},
+		{`emails[type eq "work" and value co "@example.com"]`, utils.SCIMLogical{
+			Operator: "and",
+			Left:     utils.SCIMComparison{Path: "emails.type", Operator: "eq", Value: "work"},
+			Right:    utils.SCIMComparison{Path: "emails.value", Operator: "co", Value: "@example.com"},
+		}},
+		{`active eq true`, utils.SCIMComparison{Path: "active", Operator: "eq", Value: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			filter, err := utils.ParseSCIMFilter(tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, filter)
+		})
+	}
+
+	for _, invalid := range []string{``, `userName`, `userName eq`, `userName xx "john"`, `(userName eq "john"`, `userName eq "john" and`, `emails[type eq "work"`} {
+		_, err := utils.ParseSCIMFilter(invalid)
+		assert.ErrorIs(t, err, utils.ErrInvalidSCIMFilter, invalid)
+	}
+}
+
+func TestSCIMServiceListUsersFilters(t *testing.T) {
+	scimService, _, ctx := newTestSCIMService(t)
+	bjensen := createSCIMUser(t, ctx, scimService, "bjensen", "bjensen@example.com", "Jensen")
+	createSCIMUser(t, ctx, scimService, "jsmith", "jsmith@example.org", "Smith")
+	createSCIMUser(t, ctx, scimService, "momalley", "momalley@example.com", "O'Malley")
+	_, err := scimService.PatchUser(ctx, bjensen.ID, patchRequest(t, `[{"op": "replace", "path": "active", "value": false}]`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		filter   string
+		expected []string
+	}{
+		{`userName eq "BJENSEN"`, []string{"bjensen"}},
+		{`userName sw "j"`, []string{"jsmith"}},
+		{`name.familyName co "O'Malley"`, []string{"momalley"}},
+		{`emails co "example.com"`, []string{"bjensen", "momalley"}},
+		{`emails[type eq "work" and value ew "example.org"]`, []string{"jsmith"}},
+		{`userName eq "bjensen" or userName eq "jsmith"`, []string{"bjensen", "jsmith"}},
+		{`not (emails co "example.com")`, []string{"jsmith"}},
+		{`active eq true`, []string{"jsmith", "momalley"}},
+		{`active eq false`, []string{"bjensen"}},
+		{`id eq "` + bjensen.ID + `"`, []string{"bjensen"}},
+		{`displayName pr`, nil},
+		{`meta.created gt "2000-01-01T00:00:00Z"`, []string{"bjensen", "jsmith", "momalley"}},
+		{`userName ew "%"`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			response, err := scimService.ListUsers(ctx, services.SCIMListQuery{Filter: tt.filter, StartIndex: 1, Count: 10})
+			require.NoError(t, err)
+			var usernames []string
+			for _, resource := range response.Resources {
+				usernames = append(usernames, resource.(*services.SCIMUser).UserName)
+			}
+			assert.Equal(t, tt.expected, usernames)
+			assert.EqualValues(t, len(tt.expected), response.TotalResults)
+		})
+	}
+
+	// Filters on unknown attributes or with invalid values are rejected
+	for _, invalid := range []string{`title pr`, `userName eq`, `meta.created gt "yesterday"`} {
+		_, err := scimService.ListUsers(ctx, services.SCIMListQuery{Filter: invalid, StartIndex: 1, Count: 10})
+		assertSCIMError(t, err, http.StatusBadRequest, "invalidFilter")
+	}
+}
+
+func TestSCIMServiceListUsersPagination(t *testing.T) {
+	scimService, _, ctx := newTestSCIMService(t)
+	for _, username := range []string{"user1", "user2", "user3", "user4", "user5"} {
+		createSCIMUser(t, ctx, scimService, username, username+"@example.com", "User")
+	}
+
+	// RFC 7644 section 3.4.2.4: startIndex is 1-based and count is a maximum
+	response, err := scimService.ListUsers(ctx, services.SCIMListQuery{StartIndex: 2, Count: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{services.SCIMListResponseSchema}, response.Schemas)
+	assert.EqualValues(t, 5, response.TotalResults)
+	assert.Equal(t, 2, response.StartIndex)
+	assert.Equal(t, 2, response.ItemsPerPage)
+	assert.Equal(t, "user2", response.Resources[0].(*services.SCIMUser).UserName)
+	assert.Equal(t, "user3", response.Resources[1].(*services.SCIMUser).UserName)
+
+	// A start index below 1 is treated as 1, and count 0 only returns the
+	// number of results
+	response, err = scimService.ListUsers(ctx, services.SCIMListQuery{StartIndex: -3, Count: 0})
+	require.NoError(t, err)
+	assert.Equal(t, 1, response.StartIndex)
+	assert.EqualValues(t, 5, response.TotalResults)
+	assert.Empty(t, response.Resources)
+	assert.NotNil(t, response.Resources)
+
+	// Past the last page
+	response, err = scimService.ListUsers(ctx, services.SCIMListQuery{StartIndex: 10, Count: 2})
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, response.TotalResults)
+	assert.Empty(t, response.Resources)
+}
+
+func TestSCIMServiceCreateUser(t *testing.T) {
+	scimService, db, ctx := newTestSCIMService(t)
+
+	active := services.SCIMBool(true)
+	user, err := scimService.CreateUser(ctx, &services.SCIMUser{
+		Schemas:     []string{services.SCIMUserSchema},
+		ExternalID:  "701984",
+		UserName:    "bjensen",
+		Name:        &services.SCIMName{GivenName: "Barbara", FamilyName: "Jensen"},
+		DisplayName: "Babs Jensen",
+		Emails:      []services.SCIMMultiValue{{Value: "bjensen@example.com", Type: "work", Primary: true}},
+		Active:      &active,
+		Password:    "t1meMa$heen-correct-horse",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "1", user.ID)
+	assert.Equal(t, "701984", user.ExternalID)
+	assert.Equal(t, "bjensen", user.UserName)
+	assert.Equal(t, "Barbara Jensen", user.Name.Formatted)
+	assert.Equal(t, "Babs Jensen", user.DisplayName)
+	assert.True(t, bool(*user.Active))
+	assert.Empty(t, user.Password)
+	assert.Equal(t, "User", user.Meta.ResourceType)
+	assert.Equal(t, "https://example.com/scim/v2/Users/1", user.Meta.Location)
+
+	var stored models.User
+	require.NoError(t, db.First(&stored, 1).Error)
+	assert.Equal(t, "bjensen@example.com", stored.Email)
+	assert.Equal(t, models.RoleUser, stored.Role)
+	assert.NotEmpty(t, stored.Password)
+
+	// Usernames are unique, whatever their case
+	_, err = scimService.CreateUser(ctx, &services.SCIMUser{UserName: "BJensen"})
+	assertSCIMError(t, err, http.StatusConflict, "uniqueness")
+
+	// Usernames follow the username policy
+	_, err = scimService.CreateUser(ctx, &services.SCIMUser{UserName: "bjensen@example.com"})
+	assertSCIMError(t, err, http.StatusBadRequest, "invalidValue")
+
+	// A password breaking the policy does not leave a user behind
+	_, err = scimService.CreateUser(ctx, &services.SCIMUser{UserName: "jsmith", Password: "short"})
+	assertSCIMError(t, err, http.StatusBadRequest, "invalidValue")
+	var count int64
+	require.NoError(t, db.Model(&models.User{}).Count(&count).Error)
+	assert.EqualValues(t, 1, count)
+
+	_, err = scimService.CreateUser(ctx, &services.SCIMUser{})
+	assertSCIMError(t, err, http.StatusBadRequest, "invalidValue")
+}
+
+func TestSCIMServiceReplaceUser(t *testing.T) {
+	scimService, _, ctx := newTestSCIMService(t)
+	user := createSCIMUser(t, ctx, scimService, "bjensen", "bjensen@example.com", "Jensen")
+	createSCIMUser(t, ctx, scimService, "jsmith", "jsmith@example.com", "Smith")
+
+	replaced, err := scimService.ReplaceUser(ctx, user.ID, &services.SCIMUser{
+		UserName:   "BJensen",
+		ExternalID: "bjensen",
+		Name:       &services.SCIMName{GivenName: "Barbara", FamilyName: "Jensen"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "BJensen", replaced.UserName)
+	assert.Equal(t, "bjensen", replaced.ExternalID)
+	assert.Equal(t, "Barbara", replaced.Name.GivenName)
+	// Attributes missing from the resource are cleared
+	assert.Empty(t, replaced.Emails)
+	assert.True(t, bool(*replaced.Active))
+
+	_, err = scimService.ReplaceUser(ctx, user.ID, &services.SCIMUser{UserName: "jsmith"})
+	assertSCIMError(t, err, http.StatusConflict, "uniqueness")
+
+	_, err = scimService.ReplaceUser(ctx, "999", &services.SCIMUser{UserName: "nobody"})
+	assertSCIMError(t, err, http.StatusNotFound, "")
+	_, err = scimService.GetUser(ctx, "not-a-number")
+	assertSCIMError(t, err, http.StatusNotFound, "")
+}
+
+func TestSCIMServicePatchUser(t *testing.T) {
+	scimService, db, ctx := newTestSCIMService(t)
+	user := createSCIMUser(t, ctx, scimService, "bjensen", "bjensen@example.com", "Jensen")
+
+	// Operations with and without path, as sent by identity providers
+	patched, err := scimService.PatchUser(ctx, user.ID, patchRequest(t, `[
+		{"op": "replace", "path": "name.givenName", "value": "Barbara"},
+		{"op": "Replace", "path": "emails[type eq \"work\"].value", "value": "babs@example.com"},
+		{"op": "add", "value": {"displayName": "Babs Jensen", "externalId": "701984"}},
+		{"op": "remove", "path": "urn:ietf:params:scim:schemas:core:2.0:User:name.familyName"},
+		{"op": "replace", "path": "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", "value": "Tour Operations"}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, "Barbara", patched.Name.GivenName)
+	assert.Empty(t, patched.Name.FamilyName)
+	assert.Equal(t, "babs@example.com", patched.Emails[0].Value)
+	assert.Equal(t, "Babs Jensen", patched.DisplayName)
+	assert.Equal(t, "701984", patched.ExternalID)
+
+	// Deactivation, with the boolean sent as a string
+	patched, err = scimService.PatchUser(ctx, user.ID, patchRequest(t, `[{"op": "Replace", "path": "active", "value": "False"}]`))
+	require.NoError(t, err)
+	assert.False(t, bool(*patched.Active))
+	// Only the membership is deactivated, the account may belong to other
+	// organizations
+	var stored models.Membership
+	require.NoError(t, db.Where("user_id = ?", user.ID).First(&stored).Error)
+	assert.Equal(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), stored.DeactivatedAt.UTC())
+	assert.False(t, stored.Active())
+	var account models.User
+	require.NoError(t, db.First(&account, user.ID).Error)
+	assert.True(t, account.Active())
+
+	patched, err = scimService.PatchUser(ctx, user.ID, patchRequest(t, `[{"op": "replace", "value": {"active": true}}]`))
+	require.NoError(t, err)
+	assert.True(t, bool(*patched.Active))
+
+	// Invalid operations
+	_, err = scimService.PatchUser(ctx, user.ID, patchRequest(t, `[{"op": "replace", "path": "id", "value": "2"}]`))
+	assertSCIMError(t, err, http.StatusBadRequest, "mutability")
+	_, err = scimService.PatchUser(ctx, user.ID, patchRequest(t, `[{"op": "move", "path": "userName"}]`))
+	assertSCIMError(t, err, http.StatusBadRequest, "invalidSyntax")
+	_, err = scimService.PatchUser(ctx, user.ID, patchRequest(t, `[{"op": "remove"}]`))
+	assertSCIMError(t, err, http.StatusBadRequest, "noTarget")
+	_, err = scimService.PatchUser(ctx, user.ID, patchRequest(t, `[{"op": "replace", "path": "emails[type eq", "value": "x"}]`))
+	assertSCIMError(t, err, http.StatusBadRequest, "invalidPath")
+	_, err = scimService.PatchUser(ctx, user.ID, patchRequest(t, `[]`))
+	assertSCIMError(t, err, http.StatusBadRequest, "invalidSyntax")
+}
+
+func TestSCIMServiceDeleteUser(t *testing.T) {
+	scimService, _, ctx := newTestSCIMService(t)
+	user := createSCIMUser(t, ctx, scimService, "bjensen", "bjensen@example.com", "Jensen")
+	group, err := scimService.CreateGroup(ctx, &services.SCIMGroup{
+		DisplayName: "Tour Guides",
+		Members:     []services.SCIMMultiValue{{Value: user.ID}},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, scimService.DeleteUser(ctx, user.ID))
+
+	_, err = scimService.GetUser(ctx, user.ID)
+	assertSCIMError(t, err, http.StatusNotFound, "")
+	assertSCIMError(t, scimService.DeleteUser(ctx, user.ID), http.StatusNotFound, "")
+
+	// The user left their groups
+	group, err = scimService.GetGroup(ctx, group.ID)
+	require.NoError(t, err)
+	assert.Empty(t, group.Members)
+}
+
+func TestSCIMServiceTenantIsolation(t *testing.T) {
+	scimService, db, acme := newTestSCIMService(t)
+	globex := organizationContext(t, db, "globex")
+	bjensen := createSCIMUser(t, acme, scimService, "bjensen", "bjensen@example.com", "Jensen")
+	group, err := scimService.CreateGroup(acme, &services.SCIMGroup{DisplayName: "Tour Guides"})
+	require.NoError(t, err)
+
+	// Another organization sees neither the user nor the group
+	_, err = scimService.GetUser(globex, bjensen.ID)
+	assertSCIMError(t, err, http.StatusNotFound, "")
+	_, err = scimService.GetGroup(globex, group.ID)
+	assertSCIMError(t, err, http.StatusNotFound, "")
+	users, err := scimService.ListUsers(globex, services.SCIMListQuery{StartIndex: 1, Count: 10})
+	require.NoError(t, err)
+	assert.Zero(t, users.TotalResults)
+	_, err = scimService.CreateGroup(globex, &services.SCIMGroup{DisplayName: "Drivers", Members: []services.SCIMMultiValue{{Value: bjensen.ID}}})
+	assertSCIMError(t, err, http.StatusBadRequest, "invalidValue")
+
+	// Display names are unique per organization only
+	_, err = scimService.CreateGroup(globex, &services.SCIMGroup{DisplayName: "Tour Guides"})
+	assert.NoError(t, err)
+
+	// Leaving one of two organizations keeps the account
+	globexID, err := tenant.OrganizationID(globex)
+	require.NoError(t, err)
+	var user models.User
+	require.NoError(t, db.Where("username = ?", "bjensen").First(&user).Error)
+	require.NoError(t, db.Create(&models.Membership{OrganizationID: globexID, UserID: user.ID, Role: models.OrgRoleMember}).Error)
+	require.NoError(t, scimService.DeleteUser(acme, bjensen.ID))
+	_, err = scimService.GetUser(globex, bjensen.ID)
+	assert.NoError(t, err)
+
+	// Leaving the last one deletes it
+	require.NoError(t, scimService.DeleteUser(globex, bjensen.ID))
+	var count int64
+	require.NoError(t, db.Model(&models.User{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestSCIMServiceGroups(t *testing.T) {
+	scimService, _, ctx := newTestSCIMService(t)
+	bjensen := createSCIMUser(t, ctx, scimService, "bjensen", "bjensen@example.com", "Jensen")
+	jsmith := createSCIMUser(t, ctx, scimService, "jsmith", "jsmith@example.com", "Smith")
+
+	group, err := scimService.CreateGroup(ctx, &services.SCIMGroup{
+		Schemas:     []string{services.SCIMGroupSchema},
+		DisplayName: "Tour Guides",
+		ExternalID:  "tour-guides",
+		Members:     []services.SCIMMultiValue{{Value: bjensen.ID}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/scim/v2/Groups/1", group.Meta.Location)
+	assert.Equal(t, []services.SCIMMultiValue{{
+		Value:   bjensen.ID,
+		Display: "bjensen",
+		Ref:     "https://example.com/scim/v2/Users/" + bjensen.ID,
+	}}, group.Members)
+
+	// Users list their groups
+	user, err := scimService.GetUser(ctx, bjensen.ID)
+	require.NoError(t, err)
+	require.Len(t, user.Groups, 1)
+	assert.Equal(t, "Tour Guides", user.Groups[0].Display)
+
+	// RFC 7644 section 3.5.2.1 and 3.5.2.2: add and remove members
+	group, err = scimService.PatchGroup(ctx, group.ID, patchRequest(t, `[
+		{"op": "add", "path": "members", "value": [{"value": "`+jsmith.ID+`"}, {"value": "`+bjensen.ID+`"}]}
+	]`))
+	require.NoError(t, err)
+	assert.Len(t, group.Members, 2)
+
+	group, err = scimService.PatchGroup(ctx, group.ID, patchRequest(t, `[
+		{"op": "remove", "path": "members[value eq \"`+bjensen.ID+`\"]"}
+	]`))
+	require.NoError(t, err)
+	require.Len(t, group.Members, 1)
+	assert.Equal(t, jsmith.ID, group.Members[0].Value)
+
+	// Removal with a value, as sent by Azure AD
+	group, err = scimService.PatchGroup(ctx, group.ID, patchRequest(t, `[
+		{"op": "remove", "path": "members", "value": [{"value": "`+jsmith.ID+`"}]},
+		{"op": "replace", "path": "displayName", "value": "Guides"}
+	]`))
+	require.NoError(t, err)
+	assert.Empty(t, group.Members)
+	assert.Equal(t, "Guides", group.DisplayName)
+
+	// Filters on members
+	_, err = scimService.ReplaceGroup(ctx, group.ID, &services.SCIMGroup{DisplayName: "Guides", Members: []services.SCIMMultiValue{{Value: jsmith.ID}}})
+	require.NoError(t, err)
+	response, err := scimService.ListGroups(ctx, services.SCIMListQuery{Filter: `members[value eq "` + jsmith.ID + `"]`, StartIndex: 1, Count: 10})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, response.TotalResults)
+	response, err = scimService.ListGroups(ctx, services.SCIMListQuery{Filter: `members eq "` + bjensen.ID + `"`, StartIndex: 1, Count: 10})
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, response.TotalResults)
+
+	// Errors
+	_, err = scimService.CreateGroup(ctx, &services.SCIMGroup{DisplayName: "Guides"})
+	assertSCIMError(t, err, http.StatusConflict, "uniqueness")
+	_, err = scimService.CreateGroup(ctx, &services.SCIMGroup{DisplayName: "Drivers", Members: []services.SCIMMultiValue{{Value: "999"}}})
+	assertSCIMError(t, err, http.StatusBadRequest, "invalidValue")
+	_, err = scimService.PatchGroup(ctx, group.ID, patchRequest(t, `[{"op": "replace", "path": "meta.created", "value": "2020-01-01T00:00:00Z"}]`))
+	assertSCIMError(t, err, http.StatusBadRequest, "mutability")
+
+	require.NoError(t, scimService.DeleteGroup(ctx, group.ID))
+	_, err = scimService.GetGroup(ctx, group.ID)
+	assertSCIMError(t, err, http.StatusNotFound, "")
+}
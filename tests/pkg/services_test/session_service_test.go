@@ -0,0 +1,113 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const firefoxUserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0"
+
+func newTestSessionService(t *testing.T) (*services.SessionService, *time.Time) {
+	db := openTestDB(t, &models.Session{})
+	sessionService := services.NewSessionService(&repository.PostgresSessionRepository{DB: db})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sessionService.Now = func() time.Time { return now }
+	return sessionService, &now
+}
+
+func TestSessionServiceCheckSession(t *testing.T) {
+	sessionService, now := newTestSessionService(t)
+
+	session, err := sessionService.StartSession(1, firefoxUserAgent, "192.0.2.1")
+	require.NoError(t, err)
+	assert.Equal(t, "Firefox on Linux", session.Device)
+	assert.Equal(t, now.Add(24*time.Hour), session.ExpiresAt)
+
+	// Activity is saved at most once a minute, unless the IP changes
+	*now = now.Add(30 * time.Second)
+	checked, err := sessionService.CheckSession(1, session.ID, "192.0.2.1")
+	require.NoError(t, err)
+	sessions, err := sessionService.ListSessions(1)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.True(t, sessions[0].LastSeenAt.Equal(session.LastSeenAt))
+	assert.True(t, checked.LastSeenAt.Equal(session.LastSeenAt))
+
+	*now = now.Add(time.Minute)
+	_, err = sessionService.CheckSession(1, session.ID, "192.0.2.1")
+	require.NoError(t, err)
+	_, err = sessionService.CheckSession(1, session.ID, "198.51.100.7")
+	require.NoError(t, err)
+	sessions, err = sessionService.ListSessions(1)
+	require.NoError(t, err)
+	assert.True(t, sessions[0].LastSeenAt.Equal(*now))
+	assert.Equal(t, "198.51.100.7", sessions[0].IP)
+
+	// Sessions belong to their user, and expire with their JWT
+	_, err = sessionService.CheckSession(2, session.ID, "192.0.2.1")
+	assert.ErrorIs(t, err, services.ErrSessionRevoked)
+	_, err = sessionService.CheckSession(1, 99, "192.0.2.1")
+	assert.ErrorIs(t, err, services.ErrSessionRevoked)
+	*now = now.Add(24 * time.Hour)
+	_, err = sessionService.CheckSession(1, session.ID, "192.0.2.1")
+	assert.ErrorIs(t, err, services.ErrSessionRevoked)
+	sessions, err = sessionService.ListSessions(1)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestSessionServiceRevoke(t *testing.T) {
+	sessionService, _ := newTestSessionService(t)
+
+	laptop, err := sessionService.StartSession(1, firefoxUserAgent, "192.0.2.1")
+	require.NoError(t, err)
+	phone, err := sessionService.StartSession(1, "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) Safari/604.1", "192.0.2.2")
+	require.NoError(t, err)
+	assert.Equal(t, "Safari on iOS", phone.Device)
+	tablet, err := sessionService.StartSession(1, "", "192.0.2.3")
+	require.NoError(t, err)
+	assert.Equal(t, "Unknown device", tablet.Device)
+	other, err := sessionService.StartSession(2, firefoxUserAgent, "192.0.2.4")
+	require.NoError(t, err)
+
+	// Users can only revoke their own sessions, once
+	assert.ErrorIs(t, sessionService.RevokeSession(1, other.ID), services.ErrSessionMissing)
+	require.NoError(t, sessionService.RevokeSession(1, phone.ID))
+	assert.ErrorIs(t, sessionService.RevokeSession(1, phone.ID), services.ErrSessionMissing)
+	_, err = sessionService.CheckSession(1, phone.ID, "192.0.2.2")
+	assert.ErrorIs(t, err, services.ErrSessionRevoked)
+
+	// Revoking the other sessions keeps the current one
+	revoked, err := sessionService.RevokeSessions(1, laptop.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+	sessions, err := sessionService.ListSessions(1)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, laptop.ID, sessions[0].ID)
+
+	revoked, err = sessionService.RevokeSessions(1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+	_, err = sessionService.CheckSession(2, other.ID, "192.0.2.4")
+	assert.NoError(t, err)
+}
+
+func TestDescribeDevice(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Safari/537.36 Edg/124.0": "Edge on Windows",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_4) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Safari/537.36":        "Chrome on macOS",
+		"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Mobile Safari/537.36":              "Chrome on Android",
+		"curl/8.5.0": "curl",
+		"":           "Unknown device",
+	}
+	for userAgent, device := range tests {
+		assert.Equal(t, device, services.DescribeDevice(userAgent), userAgent)
+	}
+}
@@ -0,0 +1,249 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// tokenFormats are the formats every token service test runs with
+var tokenFormats = []string{services.TokenFormatJWT, services.TokenFormatPASETOLocal, services.TokenFormatPASETOPublic}
+
+// testTokenSecret is the secret of the token services of the tests
+var testTokenSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// newTestTokenFormat returns the format with the name and the secrets
+func newTestTokenFormat(t *testing.T, name string, secrets ...[]byte) services.TokenFormat {
+	format, err := services.NewTokenFormat(name, secrets...)
+	require.NoError(t, err)
+	return format
+}
+
+// newTestTokenService returns a SessionTokenService issuing tokens in the
+// format with the test secret, whose clock is read from now
+func newTestTokenService(t *testing.T, format string, now *time.Time, issuer, audience string) *services.SessionTokenService {
+	tokenService := services.NewSessionTokenService(newTestTokenFormat(t, format, testTokenSecret), issuer, audience)
+	tokenService.Now = func() time.Time { return *now }
+	return tokenService
+}
+
+// tamper returns the token with a character of its signed part changed
+func tamper(token string) string {
+	i := len(token) / 2
+	if token[i] == '.' {
+		i++
+	}
+	replacement := "A"
+	if token[i] == 'A' {
+		replacement = "B"
+	}
+	return token[:i] + replacement + token[i+1:]
+}
+
+func TestTokenServiceRoundTrip(t *testing.T) {
+	for _, format := range tokenFormats {
+		t.Run(format, func(t *testing.T) {
+			now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+			tokenService := newTestTokenService(t, format, &now, "https://id.example.com", "sessions")
+			acme := uint(2)
+			user := &models.User{Model: gorm.Model{ID: 7}, Username: "bob", Role: models.RoleUser, SessionVersion: 3, ActiveOrganizationID: &acme}
+
+			token, err := tokenService.Issue(services.NewSessionClaims(user, 4))
+			require.NoError(t, err)
+			if format != services.TokenFormatJWT {
+				assert.True(t, strings.HasPrefix(token, format+"."))
+			}
+			claims, err := tokenService.Verify(token)
+			require.NoError(t, err)
+			assert.Equal(t, "https://id.example.com", claims.Issuer)
+			assert.Equal(t, []string{"sessions"}, claims.Audience)
+			assert.NotEmpty(t, claims.ID)
+			assert.True(t, now.Equal(claims.IssuedAt))
+			assert.True(t, now.Add(services.SessionLifetime).Equal(claims.ExpiresAt))
+			assert.Equal(t, uint(7), claims.UserID())
+			assert.Equal(t, "bob", claims.Username)
+			assert.True(t, claims.HasRole(models.RoleUser))
+			assert.False(t, claims.HasRole(models.RoleAdmin))
+			assert.Equal(t, uint(4), claims.SessionID)
+			assert.Equal(t, uint(3), claims.SessionVersion)
+			assert.Equal(t, acme, claims.OrganizationID)
+			assert.Nil(t, claims.Actor)
+
+			// Every token gets its own ID
+			other, err := tokenService.Issue(services.NewSessionClaims(user, 4))
+			require.NoError(t, err)
+			otherClaims, err := tokenService.Verify(other)
+			require.NoError(t, err)
+			assert.NotEqual(t, claims.ID, otherClaims.ID)
+
+			// Impersonations carry the admin
+			actor := &models.Actor{Subject: "1", Username: "alice", SessionID: 9, SessionVersion: 2}
+			token, err = tokenService.Issue(services.NewImpersonationClaims(user, actor))
+			require.NoError(t, err)
+			claims, err = tokenService.Verify(token)
+			require.NoError(t, err)
+			assert.Equal(t, actor, claims.Actor)
+			assert.Zero(t, claims.SessionID)
+		})
+	}
+}
+
+func TestTokenServicePASETOLocalHidesClaims(t *testing.T) {
+	now := time.Now()
+	tokenService := newTestTokenService(t, services.TokenFormatPASETOLocal, &now, "https://id.example.com", "sessions")
+	token, err := tokenService.Issue(&models.Claims{Subject: "7", Username: "bobthebuilder"})
+	require.NoError(t, err)
+	for _, part := range strings.Split(token, ".") {
+		decoded, _ := base64.RawURLEncoding.DecodeString(part)
+		assert.NotContains(t, string(decoded), "bobthebuilder")
+	}
+}
+
+func TestTokenServiceChecksTimes(t *testing.T) {
+	for _, format := range tokenFormats {
+		t.Run(format, func(t *testing.T) {
+			issued := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+			now := issued
+			tokenService := newTestTokenService(t, format, &now, "https://id.example.com", "sessions")
+			token, err := tokenService.Issue(&models.Claims{Subject: "7", ExpiresAt: issued.Add(time.Hour)})
+			require.NoError(t, err)
+
+			tests := []struct {
+				name        string
+				now         time.Time
+				expectedErr error
+			}{
+				{"Valid", issued.Add(30 * time.Minute), nil},
+				{"Expired within the clock skew", issued.Add(time.Hour + 30*time.Second), nil},
+				{"Expired", issued.Add(time.Hour + 2*time.Minute), services.ErrTokenExpired},
+				{"Issued ahead within the clock skew", issued.Add(-30 * time.Second), nil},
+				{"Issued in the future", issued.Add(-2 * time.Minute), services.ErrInvalidToken},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					now = tt.now
+					_, err := tokenService.Verify(token)
+					if tt.expectedErr == nil {
+						assert.NoError(t, err)
+					} else {
+						assert.ErrorIs(t, err, tt.expectedErr)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestTokenServiceRejectsForeignTokens(t *testing.T) {
+	for _, format := range tokenFormats {
+		t.Run(format, func(t *testing.T) {
+			now := time.Now()
+			tokenService := newTestTokenService(t, format, &now, "https://id.example.com", "sessions")
+			token, err := tokenService.Issue(&models.Claims{Subject: "7", Username: "bob"})
+			require.NoError(t, err)
+
+			otherKey := services.NewSessionTokenService(newTestTokenFormat(t, format, []byte("another key")), "https://id.example.com", "sessions")
+			tests := []struct {
+				name     string
+				verifier services.TokenService
+				token    string
+			}{
+				{"Other issuer", newTestTokenService(t, format, &now, "https://other.example.com", "sessions"), token},
+				{"Other audience", newTestTokenService(t, format, &now, "https://id.example.com", "api"), token},
+				{"Other key", otherKey, token},
+				{"Tampered", tokenService, tamper(token)},
+				{"Truncated", tokenService, token[:len(token)-10]},
+				{"Not a token", tokenService, "not-a-token"},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					_, err := tt.verifier.Verify(tt.token)
+					assert.ErrorIs(t, err, services.ErrInvalidToken)
+				})
+			}
+
+			// Tokens must be issued to a user
+			token, err = tokenService.Issue(&models.Claims{Subject: "service"})
+			require.NoError(t, err)
+			_, err = tokenService.Verify(token)
+			assert.ErrorIs(t, err, services.ErrInvalidToken)
+		})
+	}
+}
+
+func TestTokenServiceRotatesKeys(t *testing.T) {
+	for _, format := range tokenFormats {
+		t.Run(format, func(t *testing.T) {
+			oldSecret, newSecret := []byte("old secret"), []byte("new secret")
+			before := services.NewSessionTokenService(newTestTokenFormat(t, format, oldSecret), "https://id.example.com", "sessions")
+			oldToken, err := before.Issue(&models.Claims{Subject: "7"})
+			require.NoError(t, err)
+
+			// After the rotation, tokens are issued with the new secret and
+			// those issued with the old one are still accepted
+			rotated := services.NewSessionTokenService(newTestTokenFormat(t, format, newSecret, oldSecret), "https://id.example.com", "sessions")
+			_, err = rotated.Verify(oldToken)
+			assert.NoError(t, err)
+			newToken, err := rotated.Issue(&models.Claims{Subject: "7"})
+			require.NoError(t, err)
+			_, err = before.Verify(newToken)
+			assert.ErrorIs(t, err, services.ErrInvalidToken)
+
+			// Once the old secret is retired, its tokens are refused
+			retired := services.NewSessionTokenService(newTestTokenFormat(t, format, newSecret), "https://id.example.com", "sessions")
+			_, err = retired.Verify(newToken)
+			assert.NoError(t, err)
+			_, err = retired.Verify(oldToken)
+			assert.ErrorIs(t, err, services.ErrInvalidToken)
+		})
+	}
+}
+
+func TestTokenServiceDetectsFormats(t *testing.T) {
+	now := time.Now()
+	jwtToken, err := newTestTokenService(t, services.TokenFormatJWT, &now, "https://id.example.com", "sessions").Issue(&models.Claims{Subject: "7"})
+	require.NoError(t, err)
+	publicToken, err := newTestTokenService(t, services.TokenFormatPASETOPublic, &now, "https://id.example.com", "sessions").Issue(&models.Claims{Subject: "7"})
+	require.NoError(t, err)
+
+	// A service switched to PASETO still accepts the JWTs issued before
+	local := newTestTokenFormat(t, services.TokenFormatPASETOLocal, testTokenSecret)
+	migrating := services.NewSessionTokenService(local, "https://id.example.com", "sessions", newTestTokenFormat(t, services.TokenFormatJWT, testTokenSecret))
+	claims, err := migrating.Verify(jwtToken)
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), claims.UserID())
+
+	// Formats that are not accepted are refused
+	strict := services.NewSessionTokenService(local, "https://id.example.com", "sessions")
+	for _, token := range []string{jwtToken, publicToken} {
+		_, err = strict.Verify(token)
+		assert.ErrorIs(t, err, services.ErrInvalidToken)
+	}
+
+	_, err = services.NewTokenFormat("v2.local", testTokenSecret)
+	assert.ErrorIs(t, err, services.ErrUnknownTokenFormat)
+}
+
+func TestJWTFormatRestrictsAlgorithm(t *testing.T) {
+	now := time.Now()
+	tokenService := newTestTokenService(t, services.TokenFormatJWT, &now, "https://id.example.com", "sessions")
+	token, err := tokenService.Issue(&models.Claims{Subject: "7", Username: "bob"})
+	require.NoError(t, err)
+	parts := strings.Split(token, ".")
+
+	for _, header := range []string{`{"alg":"none","typ":"JWT"}`, `{"alg":"HS512","typ":"JWT"}`, `{"alg":"RS256","typ":"JWT"}`} {
+		forged := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + parts[1] + "." + parts[2]
+		_, err := tokenService.Verify(forged)
+		assert.ErrorIs(t, err, services.ErrInvalidToken, header)
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + "."
+	_, err = tokenService.Verify(unsigned)
+	assert.ErrorIs(t, err, services.ErrInvalidToken)
+}
@@ -0,0 +1,89 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestUserLifecycleService(t *testing.T) (*services.UserLifecycleService, *models.User, *models.User) {
+	db := openTestDB(t, &models.User{})
+	lifecycle := services.NewUserLifecycleService(&repository.PostgresUserRepository{DB: db})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	lifecycle.Now = func() time.Time { return now }
+	return lifecycle, createOrgUser(t, db, "admin"), createOrgUser(t, db, "bob")
+}
+
+func TestUserLifecycleServiceSuspendAndReactivate(t *testing.T) {
+	lifecycle, admin, bob := newTestUserLifecycleService(t)
+
+	// Blocking an account needs a reason
+	_, _, err := lifecycle.Transition(admin.ID, bob.ID, models.UserStatusSuspended, "  ")
+	assert.ErrorIs(t, err, services.ErrStatusReasonRequired)
+	_, _, err = lifecycle.Transition(admin.ID, bob.ID, models.UserStatusSuspended, strings.Repeat("x", 501))
+	assert.ErrorIs(t, err, services.ErrStatusReasonTooLong)
+	_, _, err = lifecycle.Transition(admin.ID, bob.ID, "banned", "spam")
+	assert.ErrorIs(t, err, services.ErrUnknownStatus)
+	_, _, err = lifecycle.Transition(admin.ID, admin.ID, models.UserStatusSuspended, "oops")
+	assert.ErrorIs(t, err, services.ErrOwnStatus)
+	_, _, err = lifecycle.Transition(admin.ID, 99, models.UserStatusSuspended, "spam")
+	assert.ErrorIs(t, err, services.ErrUserNotFound)
+
+	suspended, previous, err := lifecycle.Transition(admin.ID, bob.ID, models.UserStatusSuspended, " spam ")
+	require.NoError(t, err)
+	assert.Equal(t, models.UserStatusActive, previous)
+	assert.Equal(t, "spam", suspended.StatusReason)
+	assert.NotNil(t, suspended.StatusChangedAt)
+
+	// Their sessions stop working
+	_, err = lifecycle.CheckUser(bob.ID)
+	assert.ErrorIs(t, err, services.ErrAccountSuspended)
+	_, err = lifecycle.CheckUser(99)
+	assert.ErrorIs(t, err, services.ErrUserNotFound)
+
+	// Suspended accounts cannot be locked, only reactivated or deactivated
+	_, _, err = lifecycle.Transition(admin.ID, bob.ID, models.UserStatusLocked, "stolen password")
+	assert.ErrorIs(t, err, services.ErrIllegalTransition)
+	_, _, err = lifecycle.Transition(admin.ID, bob.ID, models.UserStatusSuspended, "spam")
+	assert.ErrorIs(t, err, services.ErrIllegalTransition)
+
+	reactivated, previous, err := lifecycle.Transition(admin.ID, bob.ID, models.UserStatusActive, "")
+	require.NoError(t, err)
+	assert.Equal(t, models.UserStatusSuspended, previous)
+	assert.Empty(t, reactivated.StatusReason)
+	user, err := lifecycle.CheckUser(bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", user.Username)
+}
+
+func TestUserLifecycleServiceDeactivate(t *testing.T) {
+	lifecycle, admin, bob := newTestUserLifecycleService(t)
+
+	_, _, err := lifecycle.Transition(admin.ID, bob.ID, models.UserStatusLocked, "suspicious logins")
+	require.NoError(t, err)
+	_, err = lifecycle.CheckUser(bob.ID)
+	assert.ErrorIs(t, err, services.ErrAccountLocked)
+
+	deactivated, _, err := lifecycle.Transition(admin.ID, bob.ID, models.UserStatusDeactivated, "left the company")
+	require.NoError(t, err)
+	assert.NotNil(t, deactivated.DeactivatedAt)
+	_, err = lifecycle.CheckUser(bob.ID)
+	assert.ErrorIs(t, err, services.ErrUserDeactivated)
+
+	// Deactivated accounts can only be reactivated
+	_, _, err = lifecycle.Transition(admin.ID, bob.ID, models.UserStatusSuspended, "spam")
+	assert.ErrorIs(t, err, services.ErrIllegalTransition)
+	reactivated, _, err := lifecycle.Transition(admin.ID, bob.ID, models.UserStatusActive, "came back")
+	require.NoError(t, err)
+	assert.Nil(t, reactivated.DeactivatedAt)
+	assert.Equal(t, "came back", reactivated.StatusReason)
+
+	_, _, err = lifecycle.Transition(admin.ID, bob.ID, models.UserStatusActive, "")
+	assert.ErrorIs(t, err, services.ErrIllegalTransition)
+}
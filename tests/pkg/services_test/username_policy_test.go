@@ -0,0 +1,91 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository/repository_mock"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func usernameRules(err error) []string {
+	var policyErr *services.UsernamePolicyError
+	if !errors.As(err, &policyErr) {
+		return nil
+	}
+	var names []string
+	for _, violation := range policyErr.Violations {
+		names = append(names, violation.Rule)
+	}
+	return names
+}
+
+func TestUsernamePolicyNormalize(t *testing.T) {
+	policy := services.DefaultUsernamePolicy()
+
+	tests := []struct {
+		name      string
+		username  string
+		display   string
+		canonical string
+		rules     []string
+	}{
+		{name: "Case preserved", username: "  Alice ", display: "Alice", canonical: "alice"},
+		{name: "Fullwidth", username: "Ａｌｉｃｅ", display: "Alice", canonical: "alice"},
+		{name: "Accented", username: "José.Díaz", display: "José.Díaz", canonical: "josé.díaz"},
+		{name: "Single script", username: "Дмитрий", display: "Дмитрий", canonical: "дмитрий"},
+		{name: "Japanese", username: "山田たろう", display: "山田たろう", canonical: "山田たろう"},
+		{name: "Empty", username: "   ", rules: []string{services.RuleRequired}},
+		{name: "Inner space", username: "alice smith", rules: []string{services.RuleCharacters}},
+		{name: "Too short", username: "al", rules: []string{services.RuleLength}},
+		{name: "Leading dot", username: ".alice", rules: []string{services.RuleCharacters}},
+		{name: "Mixed scripts", username: "pаypal", rules: []string{services.RuleMixedScript}},
+		{name: "Reserved", username: "Admin", rules: []string{services.RuleReserved}},
+		{name: "Reserved look-alike", username: "аdmіn", rules: []string{services.RuleMixedScript, services.RuleReserved}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, err := policy.Normalize(tt.username)
+			assert.Equal(t, tt.rules, usernameRules(err))
+			if tt.rules == nil {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.display, normalized.Display)
+				assert.Equal(t, tt.canonical, normalized.Canonical)
+			}
+		})
+	}
+}
+
+func TestUsernameSkeleton(t *testing.T) {
+	// Cyrillic "р", "а" and "у" look like Latin letters
+	assert.Equal(t, "paypal", services.UsernameSkeleton(services.CanonicalUsername("Раураӏ")))
+	assert.Equal(t, services.UsernameSkeleton("jose"), services.UsernameSkeleton("josé"))
+	assert.NotEqual(t, services.UsernameSkeleton("bob"), services.UsernameSkeleton("rob"))
+}
+
+func TestRegisterUserRejectsEquivalentUsernames(t *testing.T) {
+	existing := &models.User{Username: "Alice"}
+	password := "correct horse battery staple"
+
+	mockRepo := new(repository_mock.MockUserRepository)
+	mockRepo.On("GetUserByUsername", "alice").Return(existing, nil)
+	mockRepo.On("GetUserByUsername", "раураӏ").Return((*models.User)(nil), nil)
+	mockRepo.On("GetUserByUsernameSkeleton", "paypal").Return(&models.User{Username: "paypal"}, nil)
+	mockRepo.On("GetUserByUsername", "bob").Return((*models.User)(nil), nil)
+	mockRepo.On("GetUserByUsernameSkeleton", "bob").Return((*models.User)(nil), nil)
+	mockRepo.On("CreateUser", mock.MatchedBy(func(u *models.User) bool {
+		return u.Username == "Bob" && u.NormalizedUsername == "bob" && u.UsernameSkeleton == "bob"
+	})).Return(nil)
+
+	userService := &services.UserService{Repo: mockRepo, Hasher: fastHasher(services.AlgorithmArgon2id)}
+
+	assert.ErrorIs(t, userService.RegisterUser("ALICE", password), services.ErrUserExists)
+	assert.ErrorIs(t, userService.RegisterUser("Ａｌｉｃｅ", password), services.ErrUserExists)
+	assert.ErrorIs(t, userService.RegisterUser("раураӏ", password), services.ErrUsernameConfusable)
+	assert.NoError(t, userService.RegisterUser(" Bob ", password))
+	mockRepo.AssertExpectations(t)
+}
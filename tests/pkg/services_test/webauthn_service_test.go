@@ -0,0 +1,467 @@
+package services_test
+
+import (
+	"BuildasTechnicalAssessmentGo/internal/repository"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const webAuthnOrigin = "https://auth.example.com"
+
+// cborEntry is a key and value of a cborMap
+type cborEntry struct {
+	key, value interface{}
+}
+
+// cborMap is a CBOR map whose entries are encoded in order
+type cborMap []cborEntry
+
+// cborEncode encodes the integers, byte and text strings and maps of
+// WebAuthn messages
+func cborEncode(value interface{}) []byte {
+	switch v := value.(type) {
+	case int:
+		return cborEncode(int64(v))
+	case int64:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case cborMap:
+		encoded := cborHead(5, uint64(len(v)))
+		for _, entry := range v {
+			encoded = append(encoded, cborEncode(entry.key)...)
+			encoded = append(encoded, cborEncode(entry.value)...)
+		}
+		return encoded
+	default:
+		panic("unsupported CBOR value")
+	}
+}
+
+// cborHead encodes the initial bytes of a data item
+func cborHead(major byte, argument uint64) []byte {
+	switch {
+	case argument < 24:
+		return []byte{major<<5 | byte(argument)}
+	case argument < 1<<8:
+		return []byte{major<<5 | 24, byte(argument)}
+	case argument < 1<<16:
+		return []byte{major<<5 | 25, byte(argument >> 8), byte(argument)}
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(argument))
+	}
+}
+
+// softAuthenticator is a software WebAuthn authenticator holding one
+// credential, standing in for security keys and platform authenticators
+type softAuthenticator struct {
+	origin       string
+	credentialID []byte
+	ecdsaKey     *ecdsa.PrivateKey
+	ed25519Key   ed25519.PrivateKey
+	// userHandle is the user the credential was created for
+	userHandle string
+	signCount  uint32
+	// verified makes the authenticator verify the user
+	verified bool
+	// format is the attestation format, "none" or "packed" self attestation
+	format string
+}
+
+// newSoftAuthenticator creates an authenticator with an ES256 credential,
+// used from the pages of the service
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	credentialID := make([]byte, 16)
+	_, err = rand.Read(credentialID)
+	require.NoError(t, err)
+	return &softAuthenticator{origin: webAuthnOrigin, credentialID: credentialID, ecdsaKey: key, verified: true, format: "none"}
+}
+
+// newEd25519Authenticator creates an authenticator with an EdDSA
+// credential
+func newEd25519Authenticator(t *testing.T) *softAuthenticator {
+	authenticator := newSoftAuthenticator(t)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	authenticator.ecdsaKey, authenticator.ed25519Key = nil, key
+	return authenticator
+}
+
+// create creates the credential, as navigator.credentials.create
+func (a *softAuthenticator) create(t *testing.T, options *services.CredentialCreationOptions) *services.PublicKeyCredential {
+	a.userHandle = options.User.ID
+	clientDataJSON := a.clientData(t, "webauthn.create", options.Challenge)
+	authData := a.authData(options.RP.ID, utils.AuthenticatorAttestedData)
+	authData = binary.BigEndian.AppendUint16(append(authData, make([]byte, 16)...), uint16(len(a.credentialID)))
+	authData = append(append(authData, a.credentialID...), a.publicKey()...)
+
+	statement := cborMap{}
+	if a.format == "packed" {
+		clientDataHash := sha256.Sum256(clientDataJSON)
+		statement = cborMap{{"alg", a.alg()}, {"sig", a.sign(t, append(authData, clientDataHash[:]...))}}
+	}
+	attestationObject := cborEncode(cborMap{{"fmt", a.format}, {"authData", authData}, {"attStmt", statement}})
+	return &services.PublicKeyCredential{
+		ID:    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		RawID: base64.RawURLEncoding.EncodeToString(a.credentialID),
+		Type:  "public-key",
+		Response: services.AuthenticatorResponse{
+			ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+			AttestationObject: base64.RawURLEncoding.EncodeToString(attestationObject),
+			Transports:        []string{"internal", "hybrid"},
+		},
+	}
+}
+
+// get signs an assertion with the credential, as navigator.credentials.get
+func (a *softAuthenticator) get(t *testing.T, options *services.CredentialRequestOptions) *services.PublicKeyCredential {
+	a.signCount++
+	clientDataJSON := a.clientData(t, "webauthn.get", options.Challenge)
+	authData := a.authData(options.RPID, 0)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signature := a.sign(t, append(append([]byte{}, authData...), clientDataHash[:]...))
+	return &services.PublicKeyCredential{
+		ID:    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		RawID: base64.RawURLEncoding.EncodeToString(a.credentialID),
+		Type:  "public-key",
+		Response: services.AuthenticatorResponse{
+			ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+			AuthenticatorData: base64.RawURLEncoding.EncodeToString(authData),
+			Signature:         base64.RawURLEncoding.EncodeToString(signature),
+			UserHandle:        a.userHandle,
+		},
+	}
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremonyType, challenge string) []byte {
+	clientDataJSON, err := json.Marshal(map[string]interface{}{
+		"type": ceremonyType, "challenge": challenge, "origin": a.origin, "crossOrigin": false,
+	})
+	require.NoError(t, err)
+	return clientDataJSON
+}
+
+// authData returns the authenticator data up to the attested credential
+// data, with the user present and the given flags
+func (a *softAuthenticator) authData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags |= utils.AuthenticatorUserPresent
+	if a.verified {
+		flags |= utils.AuthenticatorUserVerified
+	}
+	return binary.BigEndian.AppendUint32(append(rpIDHash[:], flags), a.signCount)
+}
+
+func (a *softAuthenticator) alg() int {
+	if a.ed25519Key != nil {
+		return utils.COSEAlgEdDSA
+	}
+	return utils.COSEAlgES256
+}
+
+// publicKey returns the COSE key of the credential
+func (a *softAuthenticator) publicKey() []byte {
+	if a.ed25519Key != nil {
+		return cborEncode(cborMap{{1, 1}, {3, utils.COSEAlgEdDSA}, {-1, 6}, {-2, []byte(a.ed25519Key.Public().(ed25519.PublicKey))}})
+	}
+	x, y := make([]byte, 32), make([]byte, 32)
+	a.ecdsaKey.X.FillBytes(x)
+	a.ecdsaKey.Y.FillBytes(y)
+	return cborEncode(cborMap{{1, 2}, {3, utils.COSEAlgES256}, {-1, 1}, {-2, x}, {-3, y}})
+}
+
+func (a *softAuthenticator) sign(t *testing.T, data []byte) []byte {
+	if a.ed25519Key != nil {
+		return ed25519.Sign(a.ed25519Key, data)
+	}
+	digest := sha256.Sum256(data)
+	signature, err := ecdsa.SignASN1(rand.Reader, a.ecdsaKey, digest[:])
+	require.NoError(t, err)
+	return signature
+}
+
+func newTestWebAuthnService(t *testing.T) (*services.WebAuthnService, *gorm.DB, *time.Time) {
+	db := openTestDB(t, &models.User{}, &models.WebAuthnCredential{}, &models.WebAuthnChallenge{})
+	webAuthnService := services.NewWebAuthnService(&repository.PostgresWebAuthnRepository{DB: db},
+		&repository.PostgresUserRepository{DB: db}, "auth.example.com", "Example", []string{webAuthnOrigin})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	webAuthnService.Now = func() time.Time { return now }
+	return webAuthnService, db, &now
+}
+
+// registerPasskey registers the credential of an authenticator for a user
+func registerPasskey(t *testing.T, webAuthnService *services.WebAuthnService, user *models.User, authenticator *softAuthenticator) *models.WebAuthnCredential {
+	options, err := webAuthnService.BeginRegistration(user.ID)
+	require.NoError(t, err)
+	credential, err := webAuthnService.FinishRegistration(user.ID, "Laptop", authenticator.create(t, options))
+	require.NoError(t, err)
+	return credential
+}
+
+func TestWebAuthnServicePasswordlessLogin(t *testing.T) {
+	webAuthnService, db, now := newTestWebAuthnService(t)
+	alice := createMagicLinkUser(t, db, "alice", "alice@example.com")
+	authenticator := newSoftAuthenticator(t)
+
+	options, err := webAuthnService.BeginRegistration(alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "auth.example.com", options.RP.ID)
+	assert.Equal(t, services.WebAuthnUserHandle(alice.ID), options.User.ID)
+	assert.Equal(t, "alice@example.com", options.User.DisplayName)
+	assert.Empty(t, options.ExcludeCredentials)
+	created, err := webAuthnService.FinishRegistration(alice.ID, "  Laptop ", authenticator.create(t, options))
+	require.NoError(t, err)
+	assert.Equal(t, "Laptop", created.Name)
+	assert.Equal(t, int64(utils.COSEAlgES256), created.Algorithm)
+	assert.Equal(t, "internal,hybrid", created.Transports)
+
+	// The passkey is excluded from the next registrations
+	options, err = webAuthnService.BeginRegistration(alice.ID)
+	require.NoError(t, err)
+	require.Len(t, options.ExcludeCredentials, 1)
+	assert.Equal(t, created.CredentialID, options.ExcludeCredentials[0].ID)
+	assert.Equal(t, []string{"internal", "hybrid"}, options.ExcludeCredentials[0].Transports)
+
+	loginOptions, err := webAuthnService.BeginLogin()
+	require.NoError(t, err)
+	assert.Empty(t, loginOptions.AllowCredentials)
+	assert.Equal(t, "required", loginOptions.UserVerification)
+	login, err := webAuthnService.FinishLogin(authenticator.get(t, loginOptions))
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, login.User.ID)
+	assert.True(t, login.Passwordless)
+
+	credentials, err := webAuthnService.ListCredentials(alice.ID)
+	require.NoError(t, err)
+	require.Len(t, credentials, 1)
+	assert.Equal(t, uint32(1), credentials[0].SignCount)
+	require.NotNil(t, credentials[0].LastUsedAt)
+	assert.True(t, now.Equal(*credentials[0].LastUsedAt))
+}
+
+func TestWebAuthnServiceSecondFactor(t *testing.T) {
+	webAuthnService, db, _ := newTestWebAuthnService(t)
+	alice := createMagicLinkUser(t, db, "alice", "alice@example.com")
+	bob := createMagicLinkUser(t, db, "bob", "bob@example.com")
+	aliceKey, bobKey := newSoftAuthenticator(t), newEd25519Authenticator(t)
+	aliceKey.verified, bobKey.verified = false, false
+
+	// The password is enough until the user has a passkey
+	options, err := webAuthnService.BeginSecondFactor(alice, "/home")
+	require.NoError(t, err)
+	assert.Nil(t, options)
+
+	credential := registerPasskey(t, webAuthnService, alice, aliceKey)
+	registerPasskey(t, webAuthnService, bob, bobKey)
+	options, err = webAuthnService.BeginSecondFactor(alice, "/oauth/authorize?client_id=app")
+	require.NoError(t, err)
+	require.Len(t, options.AllowCredentials, 1)
+	assert.Equal(t, credential.CredentialID, options.AllowCredentials[0].ID)
+
+	// Security keys without user verification are enough as a second
+	// factor
+	login, err := webAuthnService.FinishLogin(aliceKey.get(t, options))
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, login.User.ID)
+	assert.False(t, login.Passwordless)
+	assert.Equal(t, "/oauth/authorize?client_id=app", login.Next)
+
+	// The passkey of another user does not complete the login of Alice
+	options, err = webAuthnService.BeginSecondFactor(alice, "")
+	require.NoError(t, err)
+	login, err = webAuthnService.FinishLogin(bobKey.get(t, options))
+	assert.ErrorIs(t, err, services.ErrWebAuthnInvalid)
+	require.NotNil(t, login)
+	assert.Equal(t, bob.ID, login.User.ID)
+
+	// Nor do they log in without a password without user verification
+	loginOptions, err := webAuthnService.BeginLogin()
+	require.NoError(t, err)
+	_, err = webAuthnService.FinishLogin(aliceKey.get(t, loginOptions))
+	assert.ErrorIs(t, err, services.ErrWebAuthnInvalid)
+}
+
+func TestWebAuthnServicePackedAttestation(t *testing.T) {
+	webAuthnService, db, _ := newTestWebAuthnService(t)
+	alice := createMagicLinkUser(t, db, "alice", "alice@example.com")
+	authenticator := newEd25519Authenticator(t)
+	authenticator.format = "packed"
+
+	created := registerPasskey(t, webAuthnService, alice, authenticator)
+	assert.Equal(t, int64(utils.COSEAlgEdDSA), created.Algorithm)
+
+	// A statement that does not verify is rejected
+	forger := newSoftAuthenticator(t)
+	forger.format = "packed"
+	options, err := webAuthnService.BeginRegistration(alice.ID)
+	require.NoError(t, err)
+	credential := forger.create(t, options)
+	// The statement comes last, ending with its signature
+	attestationObject, err := base64.RawURLEncoding.DecodeString(credential.Response.AttestationObject)
+	require.NoError(t, err)
+	attestationObject[len(attestationObject)-1] ^= 0x01
+	credential.Response.AttestationObject = base64.RawURLEncoding.EncodeToString(attestationObject)
+	_, err = webAuthnService.FinishRegistration(alice.ID, "Forged", credential)
+	assert.ErrorIs(t, err, services.ErrWebAuthnInvalid)
+}
+
+func TestWebAuthnServiceRejectsReplays(t *testing.T) {
+	webAuthnService, db, now := newTestWebAuthnService(t)
+	alice := createMagicLinkUser(t, db, "alice", "alice@example.com")
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, webAuthnService, alice, authenticator)
+
+	options, err := webAuthnService.BeginLogin()
+	require.NoError(t, err)
+	assertion := authenticator.get(t, options)
+	_, err = webAuthnService.FinishLogin(assertion)
+	require.NoError(t, err)
+	_, err = webAuthnService.FinishLogin(assertion)
+	assert.ErrorIs(t, err, services.ErrWebAuthnChallenge)
+
+	// Challenges expire
+	options, err = webAuthnService.BeginLogin()
+	require.NoError(t, err)
+	*now = now.Add(6 * time.Minute)
+	_, err = webAuthnService.FinishLogin(authenticator.get(t, options))
+	assert.ErrorIs(t, err, services.ErrWebAuthnChallenge)
+
+	// A signature counter going back means the authenticator was cloned
+	options, err = webAuthnService.BeginLogin()
+	require.NoError(t, err)
+	authenticator.signCount = 0
+	login, err := webAuthnService.FinishLogin(authenticator.get(t, options))
+	assert.ErrorIs(t, err, services.ErrWebAuthnInvalid)
+	require.NotNil(t, login)
+	assert.Equal(t, alice.ID, login.User.ID)
+
+	// Registration challenges do not log in, nor the other way around
+	registration, err := webAuthnService.BeginRegistration(alice.ID)
+	require.NoError(t, err)
+	authenticator.signCount = 10
+	_, err = webAuthnService.FinishLogin(authenticator.get(t, &services.CredentialRequestOptions{
+		Challenge: registration.Challenge, RPID: registration.RP.ID,
+	}))
+	assert.ErrorIs(t, err, services.ErrWebAuthnChallenge)
+}
+
+func TestWebAuthnServiceRejectsForgedResponses(t *testing.T) {
+	webAuthnService, db, _ := newTestWebAuthnService(t)
+	alice := createMagicLinkUser(t, db, "alice", "alice@example.com")
+	bob := createMagicLinkUser(t, db, "bob", "bob@example.com")
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, webAuthnService, alice, authenticator)
+
+	// A phishing page gets assertions for its own origin
+	options, err := webAuthnService.BeginLogin()
+	require.NoError(t, err)
+	authenticator.origin = "https://auth.example.com.evil.test"
+	_, err = webAuthnService.FinishLogin(authenticator.get(t, options))
+	assert.ErrorIs(t, err, services.ErrWebAuthnInvalid)
+	authenticator.origin = webAuthnOrigin
+
+	// Credentials of another relying party
+	options, err = webAuthnService.BeginLogin()
+	require.NoError(t, err)
+	options.RPID = "evil.test"
+	_, err = webAuthnService.FinishLogin(authenticator.get(t, options))
+	assert.ErrorIs(t, err, services.ErrWebAuthnInvalid)
+
+	// Signatures by another key
+	options, err = webAuthnService.BeginLogin()
+	require.NoError(t, err)
+	assertion := authenticator.get(t, options)
+	impostor := newSoftAuthenticator(t)
+	impostor.credentialID, impostor.userHandle = authenticator.credentialID, authenticator.userHandle
+	impostor.signCount = authenticator.signCount - 1 // Signs the same data
+	assertion.Response.Signature = impostor.get(t, options).Response.Signature
+	_, err = webAuthnService.FinishLogin(assertion)
+	assert.ErrorIs(t, err, services.ErrWebAuthnInvalid)
+
+	// A user handle claiming the credential is someone else's
+	options, err = webAuthnService.BeginLogin()
+	require.NoError(t, err)
+	authenticator.userHandle = services.WebAuthnUserHandle(bob.ID)
+	_, err = webAuthnService.FinishLogin(authenticator.get(t, options))
+	assert.ErrorIs(t, err, services.ErrWebAuthnInvalid)
+
+	// Unregistered credentials
+	options, err = webAuthnService.BeginLogin()
+	require.NoError(t, err)
+	_, err = webAuthnService.FinishLogin(newSoftAuthenticator(t).get(t, options))
+	assert.ErrorIs(t, err, services.ErrWebAuthnUnknownCredential)
+}
+
+func TestWebAuthnServiceRegistrationChecks(t *testing.T) {
+	webAuthnService, db, _ := newTestWebAuthnService(t)
+	alice := createMagicLinkUser(t, db, "alice", "alice@example.com")
+	bob := createMagicLinkUser(t, db, "bob", "bob@example.com")
+	authenticator := newSoftAuthenticator(t)
+
+	// A registration started by Bob cannot add a passkey to Alice
+	options, err := webAuthnService.BeginRegistration(bob.ID)
+	require.NoError(t, err)
+	_, err = webAuthnService.FinishRegistration(alice.ID, "Laptop", authenticator.create(t, options))
+	assert.ErrorIs(t, err, services.ErrWebAuthnChallenge)
+
+	// Nor be completed from another origin
+	options, err = webAuthnService.BeginRegistration(alice.ID)
+	require.NoError(t, err)
+	authenticator.origin = "https://evil.test"
+	_, err = webAuthnService.FinishRegistration(alice.ID, "Laptop", authenticator.create(t, options))
+	assert.ErrorIs(t, err, services.ErrWebAuthnInvalid)
+	authenticator.origin = webAuthnOrigin
+
+	credential := registerPasskey(t, webAuthnService, alice, authenticator)
+	options, err = webAuthnService.BeginRegistration(bob.ID)
+	require.NoError(t, err)
+	_, err = webAuthnService.FinishRegistration(bob.ID, "Laptop", authenticator.create(t, options))
+	assert.ErrorIs(t, err, services.ErrWebAuthnCredentialExists)
+
+	_, err = webAuthnService.BeginRegistration(9999)
+	assert.ErrorIs(t, err, services.ErrUserNotFound)
+
+	// Users only remove their own passkeys
+	assert.ErrorIs(t, webAuthnService.RemoveCredential(bob.ID, credential.ID), services.ErrWebAuthnCredentialMissing)
+	require.NoError(t, webAuthnService.RemoveCredential(alice.ID, credential.ID))
+	credentials, err := webAuthnService.ListCredentials(alice.ID)
+	require.NoError(t, err)
+	assert.Empty(t, credentials)
+}
+
+func TestWebAuthnServiceBlockedAccounts(t *testing.T) {
+	webAuthnService, db, _ := newTestWebAuthnService(t)
+	alice := createMagicLinkUser(t, db, "alice", "alice@example.com")
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, webAuthnService, alice, authenticator)
+	require.NoError(t, db.Model(alice).Update("status", models.UserStatusSuspended).Error)
+
+	options, err := webAuthnService.BeginLogin()
+	require.NoError(t, err)
+	login, err := webAuthnService.FinishLogin(authenticator.get(t, options))
+	assert.ErrorIs(t, err, services.ErrAccountSuspended)
+	require.NotNil(t, login)
+	assert.Equal(t, alice.ID, login.User.ID)
+}
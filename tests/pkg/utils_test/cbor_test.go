@@ -0,0 +1,87 @@
+package utils_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// Examples of RFC 8949 Appendix A
+	tests := []struct {
+		encoded string
+		value   interface{}
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1903e8", int64(1000)},
+		{"1a000f4240", int64(1000000)},
+		{"20", int64(-1)},
+		{"3863", int64(-100)},
+		{"390100", int64(-257)},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"f93c00", 1.0},
+		{"f9c400", -4.0},
+		{"fa47c35000", 100000.0},
+		{"fb3ff199999999999a", 1.1},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"6449455446", "IETF"},
+		{"83010203", []interface{}{int64(1), int64(2), int64(3)}},
+		{"a201020304", map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		// Tags are dropped
+		{"c11a514b67b0", int64(1363896240)},
+	}
+	for _, test := range tests {
+		data, err := hex.DecodeString(test.encoded)
+		require.NoError(t, err)
+		value, rest, err := utils.DecodeCBOR(data)
+		require.NoError(t, err, test.encoded)
+		assert.Equal(t, test.value, value, test.encoded)
+		assert.Empty(t, rest, test.encoded)
+	}
+}
+
+func TestDecodeCBORReturnsTheFollowingBytes(t *testing.T) {
+	value, rest, err := utils.DecodeCBOR([]byte{0x18, 0x64, 0xff, 0x01})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), value)
+	assert.Equal(t, []byte{0xff, 0x01}, rest)
+
+	half, _, err := utils.DecodeCBOR([]byte{0xf9, 0x7c, 0x00})
+	require.NoError(t, err)
+	assert.True(t, math.IsInf(half.(float64), 1))
+}
+
+func TestDecodeCBORRejectsMalformedData(t *testing.T) {
+	nested := make([]byte, 40)
+	for i := range nested {
+		nested[i] = 0x81 // An array of one item, nested
+	}
+	for _, encoded := range []string{
+		"",
+		"18",                 // Missing argument
+		"4401",               // Byte string longer than the data
+		"9f0102ff",           // Indefinite length
+		"830102",             // Array shorter than its length
+		"a1f401",             // Boolean map key
+		"9a7fffffff",         // Array longer than the data
+		"1bffffffffffffffff", // Integer overflow
+		"fe",                 // Reserved simple value
+	} {
+		data, err := hex.DecodeString(encoded)
+		require.NoError(t, err)
+		_, _, err = utils.DecodeCBOR(data)
+		assert.ErrorIs(t, err, utils.ErrInvalidCBOR, encoded)
+	}
+
+	_, _, err := utils.DecodeCBOR(append(nested, 0x00))
+	assert.ErrorIs(t, err, utils.ErrInvalidCBOR)
+}
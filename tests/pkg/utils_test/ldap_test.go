@@ -0,0 +1,160 @@
+package utils_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"BuildasTechnicalAssessmentGo/tests/testutil"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBERIntegers(t *testing.T) {
+	tests := []struct {
+		value   int64
+		encoded string
+	}{
+		{0, "020100"},
+		{127, "02017f"},
+		{128, "02020080"},
+		{256, "02020100"},
+		{-128, "020180"},
+		{-129, "0202ff7f"},
+	}
+	for _, test := range tests {
+		element := utils.NewBERInteger(utils.BERTagInteger, test.value)
+		assert.Equal(t, test.encoded, hex.EncodeToString(element.Encode()), test.value)
+
+		parsed, err := utils.ParseBER(element.Encode())
+		require.NoError(t, err)
+		value, err := parsed[0].Integer()
+		require.NoError(t, err)
+		assert.Equal(t, test.value, value)
+	}
+}
+
+func TestBERLongLengths(t *testing.T) {
+	element := utils.NewBERString(utils.BERTagOctetString, strings.Repeat("a", 300))
+	encoded := element.Encode()
+	assert.Equal(t, "0482012c", hex.EncodeToString(encoded[:4]))
+
+	parsed, err := utils.ParseBER(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, element, parsed[0])
+
+	for _, malformed := range []string{
+		"04",         // Missing length
+		"0405616263", // Content shorter than its length
+		"3080",       // Indefinite length
+		"1f0100",     // Multi-byte tag
+		"0484ffffffff",
+	} {
+		data, err := hex.DecodeString(malformed)
+		require.NoError(t, err)
+		_, err = utils.ParseBER(data)
+		assert.ErrorIs(t, err, utils.ErrInvalidBER, malformed)
+	}
+}
+
+func TestEncodeLDAPFilter(t *testing.T) {
+	filter, err := utils.EncodeLDAPFilter("(&(objectClass=person)(|(uid=bob)(!(mail=*))))")
+	require.NoError(t, err)
+	assert.Equal(t, byte(utils.LDAPFilterAnd), filter.Tag)
+	children, err := filter.Children()
+	require.NoError(t, err)
+	require.Len(t, children, 2)
+	assert.Equal(t, utils.NewBERConstructed(utils.LDAPFilterEquality,
+		utils.NewBERString(utils.BERTagOctetString, "objectClass"),
+		utils.NewBERString(utils.BERTagOctetString, "person"),
+	), children[0])
+	assert.Equal(t, byte(utils.LDAPFilterOr), children[1].Tag)
+
+	// Escapes are decoded
+	filter, err = utils.EncodeLDAPFilter("(cn=a\\2ab\\28\\29\\5c)")
+	require.NoError(t, err)
+	parts, err := filter.Children()
+	require.NoError(t, err)
+	assert.Equal(t, "a*b()\\", parts[1].String())
+
+	for _, invalid := range []string{
+		"",
+		"uid=bob",
+		"(uid=bob",
+		"(uid=bob))",
+		"(&)",
+		"(!(uid=bob)(uid=alice))",
+		"(uid=b*)",   // Substrings
+		"(uid>=bob)", // Ordering
+		"(uid=\\2)",
+		"(uid=\\zz)",
+		strings.Repeat("(!", 20) + "(uid=bob)" + strings.Repeat(")", 20),
+	} {
+		_, err := utils.EncodeLDAPFilter(invalid)
+		assert.ErrorIs(t, err, utils.ErrInvalidLDAPFilter, invalid)
+	}
+}
+
+func TestEscapeLDAPFilter(t *testing.T) {
+	assert.Equal(t, "bob", utils.EscapeLDAPFilter("bob"))
+	assert.Equal(t, "\\2a\\29\\28uid=\\2a\\5c\\00", utils.EscapeLDAPFilter("*)(uid=*\\\x00"))
+
+	// An escaped value stays a single equality match
+	filter, err := utils.EncodeLDAPFilter("(uid=" + utils.EscapeLDAPFilter("*)(uid=*") + ")")
+	require.NoError(t, err)
+	parts, err := filter.Children()
+	require.NoError(t, err)
+	assert.Equal(t, byte(utils.LDAPFilterEquality), filter.Tag)
+	assert.Equal(t, "*)(uid=*", parts[1].String())
+}
+
+func TestLDAPConn(t *testing.T) {
+	server := testutil.NewLDAPServer(t)
+	server.AddEntry(utils.LDAPEntry{
+		DN:         "uid=bob,ou=people,dc=example,dc=com",
+		Attributes: map[string][]string{"uid": {"bob"}, "mail": {"bob@example.com"}, "memberOf": {"cn=staff", "cn=admins"}},
+	}, "bob-secret")
+	server.AddEntry(utils.LDAPEntry{
+		DN:         "uid=alice,ou=people,dc=example,dc=com",
+		Attributes: map[string][]string{"uid": {"alice"}},
+	}, "")
+
+	conn, err := utils.DialLDAP(server.URL(), nil, time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	err = conn.Bind("uid=bob,ou=people,dc=example,dc=com", "wrong")
+	assert.True(t, utils.IsLDAPError(err, utils.LDAPResultInvalidCredentials), err)
+	require.NoError(t, conn.Bind("uid=bob,ou=people,dc=example,dc=com", "bob-secret"))
+
+	entries, err := conn.Search(utils.LDAPSearch{
+		BaseDN:     "dc=example,dc=com",
+		Scope:      utils.LDAPScopeWholeSubtree,
+		Filter:     "(uid=BOB)",
+		Attributes: []string{"MAIL", "memberOf"},
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "uid=bob,ou=people,dc=example,dc=com", entries[0].DN)
+	assert.Equal(t, "bob@example.com", entries[0].Get("mail"))
+	assert.Equal(t, []string{"cn=staff", "cn=admins"}, entries[0].GetAll("memberof"))
+	assert.Empty(t, entries[0].Get("uid"))
+
+	entries, err = conn.Search(utils.LDAPSearch{BaseDN: "dc=example,dc=com", Scope: utils.LDAPScopeWholeSubtree, Filter: "(uid=*)"})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	entries, err = conn.Search(utils.LDAPSearch{BaseDN: "ou=groups,dc=example,dc=com", Scope: utils.LDAPScopeWholeSubtree, Filter: "(uid=*)"})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = conn.Search(utils.LDAPSearch{BaseDN: "dc=example,dc=com", Filter: "(uid=b*)"})
+	assert.ErrorIs(t, err, utils.ErrInvalidLDAPFilter)
+	assert.Equal(t, []string{"uid=bob,ou=people,dc=example,dc=com"}, server.Binds())
+}
+
+func TestDialLDAPRejectsOtherSchemes(t *testing.T) {
+	_, err := utils.DialLDAP("http://localhost", nil, time.Second)
+	assert.Error(t, err)
+}
@@ -0,0 +1,272 @@
+package utils_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mmdbWriter builds small MaxMind DBs with 28-bit records, the record size
+// of the GeoLite2 City database
+type mmdbWriter struct {
+	ipVersion int
+	nodes     [][2]mmdbRecord
+	data      []byte
+}
+
+// mmdbRecord is a search tree record: a node, a data offset or empty
+type mmdbRecord struct {
+	node   int
+	offset int
+	isData bool
+}
+
+func newMMDBWriter(ipVersion int) *mmdbWriter {
+	return &mmdbWriter{ipVersion: ipVersion, nodes: make([][2]mmdbRecord, 1)}
+}
+
+// insert maps a network to the value encoded at a data offset
+func (w *mmdbWriter) insert(t *testing.T, cidr string, offset int) {
+	_, network, err := net.ParseCIDR(cidr)
+	require.NoError(t, err)
+	ones, _ := network.Mask.Size()
+	address := network.IP.To16()
+	if ip4 := network.IP.To4(); ip4 != nil {
+		if w.ipVersion == 4 {
+			address = ip4
+		} else {
+			// IPv4 networks live under ::/96
+			address, ones = append(make([]byte, 12), ip4...), ones+96
+		}
+	}
+
+	node := 0
+	for i := 0; i < ones; i++ {
+		bit := int(address[i/8]>>(7-i%8)) & 1
+		if i == ones-1 {
+			w.nodes[node][bit] = mmdbRecord{offset: offset, isData: true}
+			return
+		}
+		next := w.nodes[node][bit]
+		if next.node == 0 {
+			w.nodes = append(w.nodes, [2]mmdbRecord{})
+			next = mmdbRecord{node: len(w.nodes) - 1}
+			w.nodes[node][bit] = next
+		}
+		node = next.node
+	}
+}
+
+// add encodes a value in the data section and returns its offset
+func (w *mmdbWriter) add(value interface{}) int {
+	offset := len(w.data)
+	w.data = append(w.data, encodeMMDB(value)...)
+	return offset
+}
+
+// bytes returns the database file
+func (w *mmdbWriter) bytes() []byte {
+	var file bytes.Buffer
+	nodeCount := len(w.nodes)
+	value := func(record mmdbRecord) uint32 {
+		switch {
+		case record.isData:
+			return uint32(nodeCount + 16 + record.offset)
+		case record.node == 0:
+			return uint32(nodeCount)
+		default:
+			return uint32(record.node)
+		}
+	}
+	for _, node := range w.nodes {
+		left, right := value(node[0]), value(node[1])
+		file.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left),
+			byte(left>>24)<<4 | byte(right>>24)&0x0F, byte(right >> 16), byte(right >> 8), byte(right)})
+	}
+	file.Write(make([]byte, 16))
+	file.Write(w.data)
+	file.WriteString("\xAB\xCD\xEFMaxMind.com")
+	file.Write(encodeMMDB(map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1714564800),
+		"database_type":               "GeoLite2-City",
+		"ip_version":                  uint16(w.ipVersion),
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(28),
+	}))
+	return file.Bytes()
+}
+
+// mmdbPointerTo is a value encoded as a pointer to a data offset
+type mmdbPointerTo int
+
+// encodeMMDB encodes a value of the data section
+func encodeMMDB(value interface{}) []byte {
+	control := func(kind, size int) []byte {
+		if kind > 7 {
+			return []byte{byte(size), byte(kind - 7)}
+		}
+		return []byte{byte(kind<<5 | size)}
+	}
+	unsigned := func(kind int, value uint64) []byte {
+		var payload []byte
+		for ; value > 0; value >>= 8 {
+			payload = append([]byte{byte(value)}, payload...)
+		}
+		return append(control(kind, len(payload)), payload...)
+	}
+
+	switch v := value.(type) {
+	case string:
+		return append(control(2, len(v)), v...)
+	case float64:
+		encoded := make([]byte, 8)
+		binary.BigEndian.PutUint64(encoded, math.Float64bits(v))
+		return append(control(3, 8), encoded...)
+	case uint16:
+		return unsigned(5, uint64(v))
+	case uint32:
+		return unsigned(6, uint64(v))
+	case uint64:
+		return unsigned(9, v)
+	case bool:
+		if v {
+			return control(14, 1)
+		}
+		return control(14, 0)
+	case []interface{}:
+		encoded := control(11, len(v))
+		for _, item := range v {
+			encoded = append(encoded, encodeMMDB(item)...)
+		}
+		return encoded
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		encoded := control(7, len(v))
+		for _, key := range keys {
+			encoded = append(encoded, encodeMMDB(key)...)
+			encoded = append(encoded, encodeMMDB(v[key])...)
+		}
+		return encoded
+	case mmdbPointerTo:
+		return []byte{byte(1<<5 | int(v)>>8&0x7), byte(v)}
+	default:
+		panic("unsupported value")
+	}
+}
+
+// cityRecord returns a GeoLite2 City record
+func cityRecord(country interface{}, city string, latitude, longitude float64) map[string]interface{} {
+	return map[string]interface{}{
+		"country":  country,
+		"city":     map[string]interface{}{"names": map[string]interface{}{"en": city, "fr": city}},
+		"location": map[string]interface{}{"latitude": latitude, "longitude": longitude, "accuracy_radius": uint16(20)},
+	}
+}
+
+// writeTestCityDB writes a City database locating a few networks
+func writeTestCityDB(t *testing.T) string {
+	w := newMMDBWriter(6)
+	france := w.add(map[string]interface{}{"iso_code": "FR", "names": map[string]interface{}{"en": "France"}})
+	paris := w.add(cityRecord(mmdbPointerTo(france), "Paris", 48.8566, 2.3522))
+	lyon := w.add(cityRecord(mmdbPointerTo(france), "Lyon", 45.764, 4.8357))
+	sydney := w.add(cityRecord(map[string]interface{}{"iso_code": "AU", "names": map[string]interface{}{"en": "Australia"}},
+		"Sydney", -33.8688, 151.2093))
+	japan := w.add(map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": "JP", "names": map[string]interface{}{"en": "Japan"}},
+		"flags":   []interface{}{true, false, uint64(1) << 40},
+	})
+	w.insert(t, "192.0.2.0/24", paris)
+	w.insert(t, "198.51.100.0/25", lyon)
+	w.insert(t, "203.0.113.0/24", sydney)
+	w.insert(t, "2001:db8::/32", japan)
+
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	require.NoError(t, os.WriteFile(path, w.bytes(), 0o600))
+	return path
+}
+
+func TestMMDBReaderCity(t *testing.T) {
+	reader, err := utils.OpenMMDB(writeTestCityDB(t))
+	require.NoError(t, err)
+	assert.Equal(t, "GeoLite2-City", reader.Metadata.DatabaseType)
+	assert.Equal(t, uint(6), reader.Metadata.IPVersion)
+	assert.Equal(t, uint(28), reader.Metadata.RecordSize)
+
+	// IPv4 addresses are looked up in the IPv6 tree
+	city, found, err := reader.City(net.ParseIP("192.0.2.77"))
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, &utils.MMDBCity{CountryCode: "FR", Country: "France", City: "Paris",
+		Latitude: 48.8566, Longitude: 2.3522, HasCoordinates: true}, city)
+
+	city, found, err = reader.City(net.ParseIP("198.51.100.1"))
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "Lyon", city.City)
+	assert.Equal(t, "France", city.Country)
+	_, found, err = reader.City(net.ParseIP("198.51.100.200"))
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// Networks located to a country only have no coordinates
+	city, found, err = reader.City(net.ParseIP("2001:db8::1"))
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "JP", city.CountryCode)
+	assert.False(t, city.HasCoordinates)
+	record, _, err := reader.Lookup(net.ParseIP("2001:db8::1"))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{true, false, uint64(1) << 40}, record.(map[string]interface{})["flags"])
+
+	_, found, err = reader.City(net.ParseIP("2001:db9::1"))
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestMMDBReaderIPv4Database(t *testing.T) {
+	w := newMMDBWriter(4)
+	w.insert(t, "10.0.0.0/8", w.add(map[string]interface{}{"country": map[string]interface{}{"iso_code": "NL"}}))
+	reader, err := utils.NewMMDBReader(w.bytes())
+	require.NoError(t, err)
+
+	city, found, err := reader.City(net.ParseIP("10.1.2.3"))
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "NL", city.CountryCode)
+	_, _, err = reader.City(net.ParseIP("2001:db8::1"))
+	assert.Error(t, err)
+}
+
+func TestMMDBReaderInvalidFiles(t *testing.T) {
+	_, err := utils.NewMMDBReader([]byte("not a database"))
+	assert.ErrorIs(t, err, utils.ErrInvalidMMDB)
+
+	// Truncated search tree
+	file := newMMDBWriter(6).bytes()
+	file = append([]byte(nil), file[bytes.Index(file, []byte("\xAB\xCD\xEF")):]...)
+	_, err = utils.NewMMDBReader(file)
+	assert.ErrorIs(t, err, utils.ErrInvalidMMDB)
+
+	// Pointers looping forever
+	w := newMMDBWriter(4)
+	w.insert(t, "10.0.0.0/8", w.add(mmdbPointerTo(0)))
+	reader, err := utils.NewMMDBReader(w.bytes())
+	require.NoError(t, err)
+	_, _, err = reader.Lookup(net.ParseIP("10.0.0.1"))
+	assert.ErrorIs(t, err, utils.ErrInvalidMMDB)
+}
@@ -0,0 +1,93 @@
+package utils_test
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"crypto/ed25519"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPASETOPreAuthEncode(t *testing.T) {
+	// Examples of the PASETO specification
+	assert.Equal(t, "0000000000000000", hex.EncodeToString(utils.PASETOPreAuthEncode()))
+	assert.Equal(t, "01000000000000000000000000000000", hex.EncodeToString(utils.PASETOPreAuthEncode([]byte{})))
+	assert.Equal(t, "0100000000000000040000000000000074657374", hex.EncodeToString(utils.PASETOPreAuthEncode([]byte("test"))))
+}
+
+func TestPASETOv4Public(t *testing.T) {
+	// Test vector 4-S-1 of the PASETO specification
+	secret, _ := hex.DecodeString("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a3774" +
+		"1eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2")
+	key := ed25519.PrivateKey(secret)
+	message := []byte(`{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`)
+	token := utils.PASETOv4Sign(key, message, nil, nil)
+	assert.Equal(t, "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9"+
+		"bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA", token)
+
+	verified, footer, err := utils.PASETOv4Verify(key.Public().(ed25519.PublicKey), token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, message, verified)
+	assert.Nil(t, footer)
+
+	// The footer and the implicit assertion are signed too
+	token = utils.PASETOv4Sign(key, message, []byte(`{"kid":"1"}`), []byte("bound"))
+	footer, err = utils.PASETOFooter(token)
+	require.NoError(t, err)
+	assert.Equal(t, `{"kid":"1"}`, string(footer))
+	_, _, err = utils.PASETOv4Verify(key.Public().(ed25519.PublicKey), token, []byte("other"))
+	assert.ErrorIs(t, err, utils.ErrInvalidPASETO)
+	signed := token[:strings.LastIndex(token, ".")]
+	_, _, err = utils.PASETOv4Verify(key.Public().(ed25519.PublicKey), signed+".eyJraWQiOiIyIn0", []byte("bound"))
+	assert.ErrorIs(t, err, utils.ErrInvalidPASETO)
+
+	// Other keys and purposes are refused
+	_, other, _ := ed25519.GenerateKey(nil)
+	_, _, err = utils.PASETOv4Verify(other.Public().(ed25519.PublicKey), token, []byte("bound"))
+	assert.ErrorIs(t, err, utils.ErrInvalidPASETO)
+	_, _, err = utils.PASETOv4Decrypt(make([]byte, utils.PASETOv4KeySize), token, []byte("bound"))
+	assert.ErrorIs(t, err, utils.ErrInvalidPASETO)
+}
+
+func TestPASETOv4Local(t *testing.T) {
+	key, _ := hex.DecodeString("707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f")
+	message := []byte(`{"data":"this is a secret message"}`)
+	token, err := utils.PASETOv4Encrypt(key, message, []byte(`{"kid":"1"}`), []byte("bound"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, utils.PASETOv4Local))
+	assert.NotContains(t, token, "c2VjcmV0")
+
+	decrypted, footer, err := utils.PASETOv4Decrypt(key, token, []byte("bound"))
+	require.NoError(t, err)
+	assert.Equal(t, message, decrypted)
+	assert.Equal(t, `{"kid":"1"}`, string(footer))
+
+	// Every token gets its own nonce
+	other, err := utils.PASETOv4Encrypt(key, message, nil, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, token[:60], other[:60])
+
+	// Tampering with any part is detected
+	body, encodedFooter, _ := strings.Cut(strings.TrimPrefix(token, utils.PASETOv4Local), ".")
+	flipped := []byte(body)
+	if flipped[50] = 'A'; body[50] == 'A' {
+		flipped[50] = 'B'
+	}
+	for name, tampered := range map[string]string{
+		"Body":      utils.PASETOv4Local + string(flipped) + "." + encodedFooter,
+		"Footer":    utils.PASETOv4Local + body + ".eyJraWQiOiIyIn0",
+		"Truncated": utils.PASETOv4Local + body[:40],
+	} {
+		_, _, err = utils.PASETOv4Decrypt(key, tampered, []byte("bound"))
+		assert.ErrorIs(t, err, utils.ErrInvalidPASETO, name)
+	}
+	_, _, err = utils.PASETOv4Decrypt(key, token, []byte("other"))
+	assert.ErrorIs(t, err, utils.ErrInvalidPASETO)
+	_, _, err = utils.PASETOv4Decrypt(make([]byte, utils.PASETOv4KeySize), token, []byte("bound"))
+	assert.ErrorIs(t, err, utils.ErrInvalidPASETO)
+	_, err = utils.PASETOv4Encrypt(key[:16], message, nil, nil)
+	assert.ErrorIs(t, err, utils.ErrInvalidPASETO)
+}
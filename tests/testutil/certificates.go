@@ -0,0 +1,110 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// CertificateAuthority is a CA generated for a test, issuing the client
+// certificates of internal services
+type CertificateAuthority struct {
+	Certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+// NewCertificateAuthority generates a CA with the common name, valid for a
+// day
+func NewCertificateAuthority(t *testing.T, commonName string) *CertificateAuthority {
+	key := generateKey(t)
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber(t),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CertificateAuthority{Certificate: certificate, key: key}
+}
+
+// Pool returns a pool holding the CA only, like the bundle of MTLS_CA_FILE
+func (ca *CertificateAuthority) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Certificate)
+	return pool
+}
+
+// IssueClientCertificate issues a client certificate with the subject and
+// subject alternative names of the template, valid for a day
+func (ca *CertificateAuthority) IssueClientCertificate(t *testing.T, template *x509.Certificate) tls.Certificate {
+	key := generateKey(t)
+	issued := *template
+	issued.SerialNumber = serialNumber(t)
+	issued.NotBefore = time.Now().Add(-time.Hour)
+	issued.NotAfter = time.Now().Add(24 * time.Hour)
+	issued.KeyUsage = x509.KeyUsageDigitalSignature
+	issued.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, &issued, ca.Certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// NewMTLSServer starts an in-process HTTPS server verifying client
+// certificates against the CA, as the server does with MTLS_CLIENT_AUTH set
+// to accept (tls.VerifyClientCertIfGiven) or require
+// (tls.RequireAndVerifyClientCert). It is stopped when the test ends.
+func NewMTLSServer(t *testing.T, handler http.Handler, ca *CertificateAuthority, clientAuth tls.ClientAuthType) *httptest.Server {
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{ClientCAs: ca.Pool(), ClientAuth: clientAuth}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// MTLSClient returns a client of the server presenting the certificate, if
+// any
+func MTLSClient(server *httptest.Server, certificates ...tls.Certificate) *http.Client {
+	client := server.Client()
+	transport := client.Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = certificates
+	client.Transport = transport
+	return client
+}
+
+// generateKey generates a P-256 key
+func generateKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// serialNumber returns a random certificate serial number
+func serialNumber(t *testing.T) *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serial
+}
@@ -0,0 +1,205 @@
+package testutil
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/utils"
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// LDAPServer is an in-process LDAP server standing in for a directory such
+// as Active Directory. It answers simple binds and searches over its
+// entries, with the filters utils.EncodeLDAPFilter supports.
+//
+// Like a real server, it accepts a DN with an empty password as an
+// unauthenticated bind.
+type LDAPServer struct {
+	listener net.Listener
+
+	mu        sync.Mutex
+	entries   []utils.LDAPEntry
+	passwords map[string]string
+	binds     []string
+}
+
+// NewLDAPServer starts an LDAPServer without entries, stopped when the test
+// ends
+func NewLDAPServer(t *testing.T) *LDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &LDAPServer{listener: listener, passwords: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+// URL returns the ldap:// URL of the server
+func (s *LDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// Close stops the server, to test a directory that is down
+func (s *LDAPServer) Close() {
+	s.listener.Close()
+}
+
+// AddEntry adds an entry, or replaces the one with the same DN. A non-empty
+// password lets clients bind as the entry.
+func (s *LDAPServer) AddEntry(entry utils.LDAPEntry, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.passwords[entry.DN] = password
+	for i := range s.entries {
+		if s.entries[i].DN == entry.DN {
+			s.entries[i] = entry
+			return
+		}
+	}
+	s.entries = append(s.entries, entry)
+}
+
+// Binds returns the DNs of the successful binds, in order
+func (s *LDAPServer) Binds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+// serve answers the requests of a connection until it is unbound
+func (s *LDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		message, err := utils.ReadBER(reader)
+		if err != nil {
+			return
+		}
+		id, operation, err := utils.ParseLDAPMessage(message)
+		if err != nil {
+			return
+		}
+
+		var responses []utils.BERElement
+		switch operation.Tag {
+		case utils.LDAPBindRequest:
+			responses = []utils.BERElement{s.bind(operation)}
+		case utils.LDAPSearchRequest:
+			responses = s.search(operation)
+		default:
+			return
+		}
+		for _, response := range responses {
+			reply := utils.NewBERConstructed(utils.BERTagSequence, utils.NewBERInteger(utils.BERTagInteger, id), response)
+			if _, err := conn.Write(reply.Encode()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind answers a simple bind
+func (s *LDAPServer) bind(operation utils.BERElement) utils.BERElement {
+	fields, err := operation.Children()
+	if err != nil || len(fields) != 3 {
+		return utils.NewLDAPResult(utils.LDAPBindResponse, utils.LDAPResultProtocolError, "malformed bind")
+	}
+	dn, password := fields[1].String(), fields[2].String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if expected := s.passwords[dn]; password != "" && (expected == "" || password != expected) {
+		return utils.NewLDAPResult(utils.LDAPBindResponse, utils.LDAPResultInvalidCredentials, "invalid credentials")
+	}
+	s.binds = append(s.binds, dn)
+	return utils.NewLDAPResult(utils.LDAPBindResponse, utils.LDAPResultSuccess, "")
+}
+
+// search answers a search with the matching entries
+func (s *LDAPServer) search(operation utils.BERElement) []utils.BERElement {
+	fields, err := operation.Children()
+	if err != nil || len(fields) != 8 {
+		return []utils.BERElement{utils.NewLDAPResult(utils.LDAPSearchResultDone, utils.LDAPResultProtocolError, "malformed search")}
+	}
+	baseDN := strings.ToLower(fields[0].String())
+	scope, _ := fields[1].Integer()
+	var attributes []string
+	if requested, err := fields[7].Children(); err == nil {
+		for _, attribute := range requested {
+			attributes = append(attributes, attribute.String())
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var responses []utils.BERElement
+	for _, entry := range s.entries {
+		dn := strings.ToLower(entry.DN)
+		inScope := dn == baseDN || (scope != utils.LDAPScopeBaseObject && strings.HasSuffix(dn, ","+baseDN))
+		if inScope && matchLDAPFilter(entry, fields[6]) {
+			responses = append(responses, utils.NewLDAPEntry(selectLDAPAttributes(entry, attributes)))
+		}
+	}
+	return append(responses, utils.NewLDAPResult(utils.LDAPSearchResultDone, utils.LDAPResultSuccess, ""))
+}
+
+// selectLDAPAttributes returns the entry with the requested attributes only
+func selectLDAPAttributes(entry utils.LDAPEntry, attributes []string) utils.LDAPEntry {
+	if len(attributes) == 0 {
+		return entry
+	}
+	selected := utils.LDAPEntry{DN: entry.DN, Attributes: make(map[string][]string)}
+	for _, attribute := range attributes {
+		if values := entry.GetAll(attribute); values != nil {
+			selected.Attributes[attribute] = values
+		}
+	}
+	return selected
+}
+
+// matchLDAPFilter evaluates an encoded search filter on an entry. Values
+// are compared case-insensitively, as most directory attributes are.
+func matchLDAPFilter(entry utils.LDAPEntry, filter utils.BERElement) bool {
+	switch filter.Tag {
+	case utils.LDAPFilterPresent:
+		return entry.GetAll(filter.String()) != nil
+	case utils.LDAPFilterAnd, utils.LDAPFilterOr, utils.LDAPFilterNot:
+		children, err := filter.Children()
+		if err != nil {
+			return false
+		}
+		if filter.Tag == utils.LDAPFilterNot {
+			return len(children) == 1 && !matchLDAPFilter(entry, children[0])
+		}
+		// "&" stops at the first mismatch, "|" at the first match
+		or := filter.Tag == utils.LDAPFilterOr
+		for _, child := range children {
+			if matchLDAPFilter(entry, child) == or {
+				return or
+			}
+		}
+		return !or
+	case utils.LDAPFilterEquality:
+		parts, err := filter.Children()
+		if err != nil || len(parts) != 2 {
+			return false
+		}
+		for _, value := range entry.GetAll(parts[0].String()) {
+			if strings.EqualFold(value, parts[1].String()) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package testutil
+
+import (
+	"BuildasTechnicalAssessmentGo/pkg/middlewares"
+	"BuildasTechnicalAssessmentGo/pkg/models"
+	"BuildasTechnicalAssessmentGo/pkg/services"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// TokenMiddleware returns the middleware storing the default token service,
+// so that the routers of the tests accept the tokens of IssueToken and issue
+// the ones VerifyToken checks
+func TokenMiddleware() gin.HandlerFunc {
+	return middlewares.TokenMiddleware(services.DefaultTokenService())
+}
+
+// IssueToken returns a session token for the claims, issued by the default
+// token service, which routers get with TokenMiddleware
+func IssueToken(t *testing.T, claims *models.Claims) string {
+	token, err := services.DefaultTokenService().Issue(claims)
+	require.NoError(t, err)
+	return token
+}
+
+// SessionToken returns a session token of the user, for the session with
+// the given ID, zero for none
+func SessionToken(t *testing.T, user *models.User, sessionID uint) string {
+	return IssueToken(t, services.NewSessionClaims(user, sessionID))
+}
+
+// VerifyToken returns the claims of a token issued by the default token
+// service, failing the test if it is not valid
+func VerifyToken(t *testing.T, token string) *models.Claims {
+	claims, err := services.DefaultTokenService().Verify(token)
+	require.NoError(t, err)
+	return claims
+}
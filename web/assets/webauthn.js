@@ -0,0 +1,144 @@
+// Passkey ceremonies of the login, second factor and account pages.
+//
+// The server sends the options of navigator.credentials with their binary
+// fields base64url encoded, and expects the credentials back the same way.
+(function () {
+    "use strict";
+
+    var webAuthnPath = "/api/v1/user/webauthn";
+
+    function toBytes(value) {
+        var base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+        var binary = atob(base64 + "===".slice((base64.length + 3) % 4));
+        return Uint8Array.from(binary, function (c) { return c.charCodeAt(0); });
+    }
+
+    function toBase64URL(buffer) {
+        var binary = String.fromCharCode.apply(null, new Uint8Array(buffer));
+        return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+    }
+
+    function descriptors(list) {
+        return (list || []).map(function (descriptor) {
+            return Object.assign({}, descriptor, { id: toBytes(descriptor.id) });
+        });
+    }
+
+    function creationOptions(options) {
+        return Object.assign({}, options, {
+            challenge: toBytes(options.challenge),
+            user: Object.assign({}, options.user, { id: toBytes(options.user.id) }),
+            excludeCredentials: descriptors(options.excludeCredentials)
+        });
+    }
+
+    function requestOptions(options) {
+        return Object.assign({}, options, {
+            challenge: toBytes(options.challenge),
+            allowCredentials: descriptors(options.allowCredentials)
+        });
+    }
+
+    function credentialJSON(credential) {
+        var response = credential.response;
+        var json = {
+            id: credential.id,
+            rawId: toBase64URL(credential.rawId),
+            type: credential.type,
+            response: { clientDataJSON: toBase64URL(response.clientDataJSON) }
+        };
+        if (response.attestationObject) {
+            json.response.attestationObject = toBase64URL(response.attestationObject);
+            json.response.transports = response.getTransports ? response.getTransports() : [];
+        }
+        if (response.authenticatorData) {
+            json.response.authenticatorData = toBase64URL(response.authenticatorData);
+            json.response.signature = toBase64URL(response.signature);
+            if (response.userHandle) {
+                json.response.userHandle = toBase64URL(response.userHandle);
+            }
+        }
+        return json;
+    }
+
+    function post(path, body) {
+        return fetch(path, {
+            method: "POST",
+            credentials: "same-origin",
+            headers: { "Accept": "application/json", "Content-Type": "application/json" },
+            body: JSON.stringify(body || {})
+        }).then(function (response) {
+            return response.json().catch(function () { return {}; }).then(function (data) {
+                if (!response.ok) {
+                    throw new Error(data.error || "Request failed");
+                }
+                return data;
+            });
+        });
+    }
+
+    // login asks the authenticator for an assertion and logs in with it
+    function login(options) {
+        return navigator.credentials.get({ publicKey: requestOptions(options) }).then(function (credential) {
+            return post(webAuthnPath + "/login/finish", { credential: credentialJSON(credential) });
+        }).then(function (data) {
+            window.location.assign(data.next);
+        });
+    }
+
+    function register(name) {
+        return post(webAuthnPath + "/register/begin").then(function (data) {
+            return navigator.credentials.create({ publicKey: creationOptions(data.public_key) });
+        }).then(function (credential) {
+            return post(webAuthnPath + "/register/finish", { name: name, credential: credentialJSON(credential) });
+        }).then(function () {
+            window.location.assign("/api/v1/user/account?updated=passkey");
+        });
+    }
+
+    document.addEventListener("DOMContentLoaded", function () {
+        var error = document.getElementById("passkey-error");
+        function showError(err) {
+            error.textContent = err.message;
+            error.hidden = false;
+        }
+
+        if (!window.PublicKeyCredential) {
+            document.querySelectorAll(".passkey-action").forEach(function (element) {
+                element.disabled = true;
+            });
+            if (error) {
+                showError(new Error("This browser does not support passkeys."));
+            }
+            return;
+        }
+
+        // Passwordless login, from the login form
+        var loginButton = document.getElementById("passkey-login");
+        if (loginButton) {
+            loginButton.addEventListener("click", function () {
+                post(webAuthnPath + "/login/begin").then(function (data) {
+                    return login(data.public_key);
+                }).catch(showError);
+            });
+        }
+
+        // Second factor, after the password
+        var secondFactor = document.getElementById("passkey-options");
+        if (secondFactor) {
+            var options = JSON.parse(secondFactor.textContent);
+            document.getElementById("passkey-verify").addEventListener("click", function () {
+                login(options).catch(showError);
+            });
+        }
+
+        // New passkey, from the account page
+        var registerForm = document.getElementById("passkey-register");
+        if (registerForm) {
+            registerForm.addEventListener("submit", function (event) {
+                event.preventDefault();
+                register(registerForm.elements.name.value).catch(showError);
+            });
+        }
+    });
+})();